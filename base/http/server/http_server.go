@@ -2,14 +2,12 @@ package server
 
 import (
 	"fmt"
-	"go-demo/utils/seq"
+	"go-demo/sdk/blob"
 	"io"
 	"io/ioutil"
 	"log"
-	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
+	"sync"
 )
 
 // 创建一个简单的web服务器
@@ -51,95 +49,42 @@ func Index(w http.ResponseWriter, request *http.Request) {
 
 const (
 	// 2 MB
-	maxUploadSize = 2 * 1024 * 2014
+	maxUploadSize = 2 * 1024 * 1024
 	uploadPath    = "upload"
 )
 
-// 上传文件
-func Upload(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("文件大小超过限制")
-		return
-	}
-
-	file, _, err := r.FormFile("file")
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("无效的file")
-		return
-	}
-	defer file.Close()
+var (
+	storeOnce sync.Once
+	uploader  http.Handler
+	loader    http.Handler
+)
 
-	fileBytes, err := ioutil.ReadAll(file)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Println("读取文件失败")
-		return
-	}
-	// 获取文件类型
-	fileType := http.DetectContentType(fileBytes)
-	if fileType != "image/jpg" && fileType != "image/png" {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("此文件类型是:%s,目前仅支持image/jpg和image/png格式 \n", fileType)
-		return
-	}
-	// 组装文件保存路径
-	fileName := seq.UUID()
-	fileEndings, err := mime.ExtensionsByType(fileType)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Println("获取文件扩展名失败")
-		return
-	}
-	newPath := filepath.Join(uploadPath, fileName+fileEndings[0])
-	log.Printf("Get file type:%s, path: %s", fileType, newPath)
-	// 判断上传的文件夹是否存在，不存在则创建
-	_, err = os.Stat(uploadPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			err := os.MkdirAll(uploadPath, 0666)
-			if err != nil {
+// 上传和下载都通过 blob.Local 读写 upload 目录，第一次请求时创建
+func handlers() (http.Handler, http.Handler) {
+	storeOnce.Do(func() {
+		store, err := blob.NewLocal(uploadPath)
+		if err != nil {
+			log.Printf("创建上传目录失败,err:%s \n", err.Error())
+			failed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusInternalServerError)
-				log.Println("文件夹不存在，创建失败")
-				return
-			}
+			})
+			uploader, loader = failed, failed
+			return
 		}
-	}
-	// 复制文件
-	newFile, err := os.Create(newPath)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Println("创建文件失败")
-		return
-	}
-	defer newFile.Close()
+		uploader = blob.UploadHandler(store, blob.WithMaxSize(maxUploadSize), blob.WithAllowedTypes("image/jpeg", "image/png"))
+		loader = blob.DownloadHandler(store)
+	})
+	return uploader, loader
+}
 
-	if _, err := newFile.Write(fileBytes); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Println("写入文件失败")
-		return
-	}
-	w.Write([]byte("上传成功"))
+// 上传文件，仅支持 jpg 和 png，返回保存后的对象信息
+func Upload(w http.ResponseWriter, r *http.Request) {
+	upload, _ := handlers()
+	upload.ServeHTTP(w, r)
 }
 
-// 下载文件
+// 下载文件，key 参数为上传时返回的 key，支持 Range 断点续传
 func Download(w http.ResponseWriter, r *http.Request) {
-	filePath := r.FormValue("filePath")
-	file, err := os.Open(filePath)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("打开文件失败,err:%s \n", err.Error())
-		return
-	}
-
-	bytes, err := ioutil.ReadAll(file)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("读取文件失败,err:%s \n", err.Error())
-		return
-	}
-	w.Header().Add("Content-Disposition", "attachment;filename=\""+filePath+"\"")
-	w.Header().Add("Content-Type", "application/octect-stream")
-	w.Write(bytes)
+	_, download := handlers()
+	download.ServeHTTP(w, r)
 }
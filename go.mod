@@ -1,6 +1,6 @@
 module go-demo
 
-go 1.17
+go 1.18
 
 require (
 	github.com/360EntSecGroup-Skylar/excelize v1.4.1 // indirect
@@ -10,6 +10,8 @@ require (
 	github.com/TruthHun/html2md v0.0.0-20190507142218-8352cc68f88e
 	github.com/afex/hystrix-go v0.0.0-20180502004556-fa1af6a1f4f5
 	github.com/alibaba/sentinel-golang v0.3.0
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/aliyun/alibaba-cloud-sdk-go v1.61.1333
 	github.com/aliyun/aliyun-oss-go-sdk v2.0.1+incompatible
 	github.com/andybalholm/cascadia v1.2.0 // indirect
@@ -31,7 +33,6 @@ require (
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/gin-gonic/gin v1.6.3
 	github.com/go-redis/redis v6.15.6+incompatible
-	github.com/go-session/session v3.1.2+incompatible
 	github.com/go-sql-driver/mysql v1.5.0 // indirect
 	github.com/go-vgo/robotgo v0.0.0-20191216133555-c86926da97a5
 	github.com/gobwas/glob v0.2.3 // indirect
@@ -60,6 +61,7 @@ require (
 	github.com/lxn/win v0.0.0-20191128105842-2da648fda5b4 // indirect
 	github.com/marusama/cyclicbarrier v1.1.0
 	github.com/mattn/go-colorable v0.1.6
+	github.com/mattn/go-sqlite3 v1.10.0 // indirect
 	github.com/mdp/qrterminal/v3 v3.0.0
 	github.com/microcosm-cc/bluemonday v1.0.2
 	github.com/mozillazg/go-pinyin v0.18.0
@@ -98,6 +100,7 @@ require (
 	github.com/xuri/excelize v1.4.0
 	github.com/yanyiwu/gojieba v1.1.2
 	github.com/youzan/go-nsq v1.3.1
+	github.com/yuin/gopher-lua v0.0.0-20220504180219-658193537a64 // indirect
 	go.mongodb.org/mongo-driver v1.2.0
 	go.uber.org/ratelimit v0.1.0
 	go.uber.org/zap v1.13.0 // indirect
@@ -110,11 +113,9 @@ require (
 	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
 	google.golang.org/appengine v1.6.6 // indirect
 	google.golang.org/grpc v1.27.0
-	google.golang.org/protobuf v1.24.0 // indirect
+	google.golang.org/protobuf v1.24.0
 	gopkg.in/Knetic/govaluate.v3 v3.0.0
-	gopkg.in/go-oauth2/redis.v3 v3.2.1
 	gopkg.in/go-playground/pool.v3 v3.1.1
-	gopkg.in/oauth2.v3 v3.12.0
 	gopkg.in/sourcemap.v1 v1.0.5 // indirect
 	gopkg.in/yaml.v2 v2.2.8
 	sigs.k8s.io/yaml v1.1.0 // indirect
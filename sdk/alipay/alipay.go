@@ -1,184 +1,350 @@
-package main
+package alipay
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"net/http"
 	"net/url"
-	"os/exec"
-	"strings"
 	"time"
 
-	"github.com/smartwalle/alipay/v3"
-)
+	ali "github.com/smartwalle/alipay/v3"
 
-var (
-	appId = "2016091800540000"
-	//生成CSR文件中的私钥
-	privateKey = "MIIEowIBAAKCAQEA5hhBBH4CSO1AySXprGazNZKVR/+G87GHt1U2SQL33WCFPKFYqE0qlpdLKECLb6xgOlSGFD676hxJcBH//l+A16Wb0WjVAbIIc7ichjantyg9t3FQP97t9wI5mYlUGMsTu2TqzFu/0hq/KAhSeNlg15m3v+4g81qITnTapzFAbC/6LLw9Sznq+eKi3bK3scAWZtkpJRyT/UqEXDsixskMzezISqYOQW9xHdfBvkzcGKuxi/N0z6rfoxyG2D1fNQ6dQ91vb54Ph0rdojDKUB29CdY92KoxPvAumXBgVf6k3MRpF4di0c9lR5cqgpbTUkotcuidCWgx8w13HNenpF2dKQIDAQABAoIBAASZa4NJeYY3p9nddiRKET765R0BUJNCczII9ALVmlrEeSVTHFCQ6k8ESy5My/y5d1rzIZL6BguR8S3aTkGpawvkdY7kB433HxAhGo/cO9H/bexiyXXdYOhVFQ2qnxG3zXcrdz4Kf3UVr8h/Ehb0UWk921xsyB/VKXBYCZ7Z7y26ZhO6J+ZRHqGgAW7vXeXmhhAyIixIuUQnVkRSXrKKnx+HHYxhioIgKUtny9N/636jnC9rMi2mKK5cjgPjgX4EVJMNTn/jdTNrYZxgg6F+innwvyHpMGggxiCMpTjtC3efujOocMmMgNSb1J7NVdqOW22n2MNlG5JLgAktLs4HYnkCgYEA9X15fkrQYqahNuvgUZtGofZQHPwXXOLcP/t4rZcdunwKuyjMaiFnhBX3p8WBaVi0zwIXe86OkaLWZhalbDpmcGnZRaUVJq9KLnIaA9QDectnoqDpiR1IxFfKM2IsIYRU8Y5+OKQwXtAHfuEbySnb++McTUPUB9poZI6BswxWngsCgYEA7/IMfgejlRPQpysecyDx1y5x6ndnZ2VapJdaS5Q/g+1j/ZjX52oo3qeEA3DVBmDGQnvo8voCcdtLIp+vITEEsEtiDWrJk3giGF73HaPvRqrYtH5uhLLQy1Ehub0Nc/jWSrV3S2bSir6Qmk9ptu4ndGSOeiFziS/iwrFF70ayFhsCgYBGfDVjBpYYjSFixI0OwVehbziHafZHTDfTAyAeL3Jwteba4Bb5Lggry6bk+/dxSO/5M++MM72JoUiP3Va34XjCNBIXRhPxnIjfFxHTIY+x664g6rTDEq5u+YnsAPcM1JMTHEevea0NvAs66eVxd9xa0VWx9ZSugI5SuPwSbat9CwKBgQCaVNx2H6G23GTjcReHw5Pp7OS2g5CN76IKpZMdc8AashETZ0DPhve8ppCBygwqqwo6bwqZZfc2lm9QWNdDCQ1T+1iY+qum36lGdaaKeQwJLxBtn7ikP4OOkqOXnSLPCimDKg8N/5fCR+ooZpW/ZJUaByehJGz0u0kmIvGxgo4/KwKBgAYbhMiE0IMsAYr5dPhX52FWaSRzcF/5WALFIOes5jCctSrMFMVPMq0xp1QWFK6iHeA1nv8Uk2NOQXbn13iTr+LTD01aT0WUJ7r5fhatrvfqIUHm7tcTzgwjui6QYv0y2m3hUXA1wCwMW9OL4Eadk32x4okssyMxWbJdCRvX4Ssz"
-	client     *alipay.Client
+	"go-demo/sdk/payment"
 )
 
-func init() {
-	client, _ = alipay.New(appId, privateKey, false)
-	client.LoadAppPublicCertFromFile("appPublic.crt")
-	client.LoadAliPayPublicCertFromFile("aliPayPublic.crt")
-	client.LoadAliPayRootCertFromFile("aliPayRoot.crt")
-}
-
-// 调转支付宝网站支付
-func WebPageAlipay() {
-	pay := alipay.TradePagePay{}
+const (
 	// 支付宝回调地址（需要在支付宝后台配置）
 	// 支付成功后，支付宝会发送一个POST消息到该地址
-	pay.NotifyURL = "http://www.pibigstar/alipay"
+	NotifyURL = "http://www.pibigstar/alipay"
 	// 支付成功之后，浏览器将会重定向到该 URL
-	pay.ReturnURL = "http://localhost:8088/return"
-	//支付标题
-	pay.Subject = "网页扫码支付"
-	//订单号，一个订单号只能支付一次
-	pay.OutTradeNo = time.Now().String()
-	//销售产品码，与支付宝签约的产品码名称,目前仅支持FAST_INSTANT_TRADE_PAY
-	pay.ProductCode = "FAST_INSTANT_TRADE_PAY"
-	//金额
-	pay.TotalAmount = "0.01"
-	v := url.Values{}
-	v.Add("orgId", "123456")
-	body := v.Encode()
-	// 支付宝回传参数，需要经过UrlEncode
-	pay.PassbackParams = body
-
-	url, err := client.TradePagePay(pay)
-	if err != nil {
-		fmt.Println(err)
-	}
-	payURL := url.String()
-	//这个 payURL 即是用于支付的 URL，可将输出的内容复制，到浏览器中访问该 URL 即可打开支付页面。
-	fmt.Println(payURL)
+	ReturnURL = "http://localhost:8088/return"
 
-	//打开默认浏览器
-	payURL = strings.Replace(payURL, "&", "^&", -1)
-	exec.Command("cmd", "/c", "start", payURL).Start()
-}
+	// 渠道名
+	Name = "alipay"
 
-// https://docs.open.alipay.com/204/105695/
-// 手机网页支付(可转到APP支付）
-func WapAlipay() {
-	pay := alipay.TradeWapPay{}
-	// 支付宝回调地址（需要在支付宝后台配置）
-	// 支付成功后，支付宝会发送一个POST消息到该地址
-	pay.NotifyURL = "http://www.pibigstar/alipay"
-	// 支付成功之后，浏览器将会重定向到该 URL
-	pay.ReturnURL = "http://localhost:8088/return"
-	//支付标题
-	pay.Subject = "手机网页支付"
-	//订单号，一个订单号只能支付一次
-	pay.OutTradeNo = time.Now().String()
-	//商品code
-	pay.ProductCode = "QUICK_WAP_WAY"
-	//支付失败后返回地址
-	pay.QuitURL = "http://www.pibigstar/alipay"
-	//金额
-	pay.TotalAmount = "0.01"
-	v := url.Values{}
-	v.Add("orgId", "123456")
-	body := v.Encode()
-	// 支付宝回传参数，需要经过UrlEncode
-	pay.PassbackParams = body
-
-	url, err := client.TradeWapPay(pay)
-	if err != nil {
-		fmt.Println(err)
-	}
-	payURL := url.String()
-	//这个 payURL 即是用于支付的 URL，可将输出的内容复制，到浏览器中访问该 URL 即可打开支付页面。
-	fmt.Println(payURL)
-	//打开默认浏览器
-	payURL = strings.Replace(payURL, "&", "^&", -1)
-	exec.Command("cmd", "/c", "start", payURL).Start()
+	timeFormat = "2006-01-02 15:04:05"
+)
+
+// 支付宝返回的时间为北京时间
+var cst = time.FixedZone("CST", 8*3600)
+
+// tradeClient *ali.Client 中用到的接口，测试时替换为模拟实现
+type tradeClient interface {
+	TradePagePay(param ali.TradePagePay) (*url.URL, error)
+	TradeWapPay(param ali.TradeWapPay) (*url.URL, error)
+	TradeAppPay(param ali.TradeAppPay) (string, error)
+	TradePreCreate(param ali.TradePreCreate) (*ali.TradePreCreateRsp, error)
+	TradeQuery(param ali.TradeQuery) (*ali.TradeQueryRsp, error)
+	TradeClose(param ali.TradeClose) (*ali.TradeCloseRsp, error)
+	TradeRefund(param ali.TradeRefund) (*ali.TradeRefundRsp, error)
+	TradeFastPayRefundQuery(param ali.TradeFastPayRefundQuery) (*ali.TradeFastPayRefundQueryRsp, error)
+	GetTradeNotification(req *http.Request) (*ali.TradeNotification, error)
 }
 
-// APP支付
-func GetAppPayURL() {
-	pay := alipay.TradeAppPay{}
-	// 支付宝回调地址（需要在支付宝后台配置）
-	// 支付成功后，支付宝会发送一个POST消息到该地址
-	pay.NotifyURL = "http://www.pibigstar/alipay"
-	//支付标题
-	pay.Subject = "APP支付"
+// Client 支付宝支付，实现 payment.PaymentGateway。
+// 支付宝的接口不支持 context，只在请求前检查 ctx 是否已经结束
+type Client struct {
+	appID  string
+	client tradeClient
+	opts   *options
+}
 
-	//二维码使用的Code
-	pay.ProductCode = time.Now().String()
-	pay.TotalAmount = "10.00"
-	//订单号，一个订单号只能支付一次
-	pay.OutTradeNo = time.Now().String()
+var _ payment.PaymentGateway = (*Client)(nil)
 
-	result, err := client.TradeAppPay(pay)
+// NewClient privateKey 为生成CSR文件中的应用私钥，使用公钥证书模式，证书文件通过 WithCertFiles 指定
+func NewClient(appID, privateKey string, opts ...Option) (*Client, error) {
+	o := evaluateOptions(opts)
+	client, err := ali.New(appID, privateKey, o.production)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
+	}
+	if o.httpClient != nil {
+		client.Client = o.httpClient
+	}
+	if err = client.LoadAppPublicCertFromFile(o.appPublic); err != nil {
+		return nil, err
 	}
-	// 跳转APP支付参数
-	fmt.Println(result)
+	if err = client.LoadAliPayPublicCertFromFile(o.aliPayPublic); err != nil {
+		return nil, err
+	}
+	if err = client.LoadAliPayRootCertFromFile(o.aliPayRoot); err != nil {
+		return nil, err
+	}
+	return &Client{appID: appID, client: client, opts: o}, nil
 }
 
-// https://docs.open.alipay.com/api_1/alipay.trade.pay/
-// 扫码支付(生成支付的二维码的链接）
-func GetQrPayURL() {
-	pay := alipay.TradePreCreate{}
-	// 支付宝回调地址（需要在支付宝后台配置）
-	// 支付成功后，支付宝会发送一个POST消息到该地址
-	pay.NotifyURL = "http://www.pibigstar/alipay"
-	// 支付成功之后，浏览器将会重定向到该 URL
-	pay.ReturnURL = "http://localhost:8088/return"
-	//支付标题
-	pay.Subject = "支付宝支付测试"
-
-	//二维码使用的Code
-	pay.ProductCode = "FACE_TO_FACE_PAYMENT"
-	pay.TotalAmount = "10.00"
-	//订单号，一个订单号只能支付一次
-	pay.OutTradeNo = time.Now().String()
+func (c *Client) Name() string {
+	return Name
+}
 
-	url, err := client.TradePreCreate(pay)
-	if err != nil {
-		fmt.Println(err)
+// Create 按场景下单，订单号相同时支付宝返回同一笔交易
+// 电脑网站：https://docs.open.alipay.com/270/105899/
+// 手机网站：https://docs.open.alipay.com/204/105695/
+// 扫码：https://docs.open.alipay.com/api_1/alipay.trade.precreate/
+func (c *Client) Create(ctx context.Context, req *payment.CreateRequest) (*payment.CreateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.Amount <= 0 {
+		return nil, payment.ErrInvalidAmount
+	}
+	trade := ali.Trade{
+		NotifyURL:   firstNonEmpty(req.NotifyURL, c.opts.notifyURL),
+		ReturnURL:   firstNonEmpty(req.ReturnURL, c.opts.returnURL),
+		Subject:     req.Subject,
+		OutTradeNo:  req.OutTradeNo,
+		TotalAmount: payment.FormatYuan(req.Amount),
+		// 支付宝回传参数，需要经过UrlEncode
+		PassbackParams: url.QueryEscape(req.Passback),
 	}
-	//二维码链接，可用此链接生成一个二维码扫码支付
-	fmt.Println(url.Content.QRCode)
-}
 
-func main() {
-	//生成支付URL
-	WapAlipay()
-	//支付成功之后的返回URL页面
-	http.HandleFunc("/return", func(rep http.ResponseWriter, req *http.Request) {
-		req.ParseForm()
-		ok, err := client.VerifySign(req.Form)
-		if err == nil && ok {
-			rep.Write([]byte("支付成功"))
+	result := &payment.CreateResult{OutTradeNo: req.OutTradeNo}
+	switch req.Scene {
+	case payment.ScenePage:
+		trade.ProductCode = "FAST_INSTANT_TRADE_PAY"
+		u, err := c.client.TradePagePay(ali.TradePagePay{Trade: trade})
+		if err != nil {
+			return nil, err
 		}
-	})
-	//支付成功之后的通知页面
-	http.HandleFunc("/alipay", func(rep http.ResponseWriter, req *http.Request) {
-		var notification, err = client.GetTradeNotification(req)
+		result.PayURL = u.String()
+	case payment.SceneWap:
+		trade.ProductCode = "QUICK_WAP_WAY"
+		// 支付失败后返回地址
+		u, err := c.client.TradeWapPay(ali.TradeWapPay{Trade: trade, QuitURL: trade.ReturnURL})
+		if err != nil {
+			return nil, err
+		}
+		result.PayURL = u.String()
+	case payment.SceneApp:
+		trade.ProductCode = "QUICK_MSECURITY_PAY"
+		orderString, err := c.client.TradeAppPay(ali.TradeAppPay{Trade: trade})
 		if err != nil {
-			fmt.Println("支付失败")
-			rep.WriteHeader(http.StatusForbidden)
-			return
+			return nil, err
 		}
-		values, err := url.ParseQuery(notification.PassbackParams)
+		// 跳转APP支付参数
+		result.Params = map[string]string{"order_string": orderString}
+	case payment.SceneNative:
+		trade.ProductCode = "FACE_TO_FACE_PAYMENT"
+		rsp, err := c.client.TradePreCreate(ali.TradePreCreate{Trade: trade})
 		if err != nil {
-			fmt.Println("解析参数失败")
-			rep.WriteHeader(http.StatusForbidden)
-			return
+			return nil, tradeError(err)
 		}
-		fmt.Println(values.Get("orgId"))
-		//支付宝支付成功之后的信息
-		fmt.Printf("%+v", notification)
-		fmt.Println("支付成功")
-		//修改订单状态。。。。
-		alipay.AckNotification(rep) // 确认收到通知消息
+		if !rsp.IsSuccess() {
+			return nil, newError(rsp.Content.Code, rsp.Content.Msg, rsp.Content.SubCode, rsp.Content.SubMsg)
+		}
+		// 二维码链接，可用此链接生成一个二维码扫码支付
+		result.PayURL = rsp.Content.QRCode
+	default:
+		return nil, payment.ErrUnsupportedScene
+	}
+	return result, nil
+}
+
+// Query 查询交易，用户还没有扫码或登录时交易不存在，返回 payment.ErrTradeNotFound
+// https://docs.open.alipay.com/api_1/alipay.trade.query/
+func (c *Client) Query(ctx context.Context, outTradeNo string) (*payment.Trade, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rsp, err := c.client.TradeQuery(ali.TradeQuery{OutTradeNo: outTradeNo})
+	if err != nil {
+		return nil, tradeError(err)
+	}
+	if !rsp.IsSuccess() {
+		return nil, newError(rsp.Content.Code, rsp.Content.Msg, rsp.Content.SubCode, rsp.Content.SubMsg)
+	}
+	trade := &payment.Trade{
+		OutTradeNo: rsp.Content.OutTradeNo,
+		TradeNo:    rsp.Content.TradeNo,
+		Status:     tradeStatus(rsp.Content.TradeStatus, ""),
+	}
+	if trade.Amount, err = payment.ParseYuan(rsp.Content.TotalAmount); err != nil {
+		return nil, err
+	}
+	trade.PaidAt, _ = time.ParseInLocation(timeFormat, rsp.Content.SendPayDate, cst)
+	return trade, nil
+}
+
+// Close 关闭未付款的交易，交易不存在（用户还没有扫码）或已经关闭时不报错
+// https://docs.open.alipay.com/api_1/alipay.trade.close/
+func (c *Client) Close(ctx context.Context, outTradeNo string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rsp, err := c.client.TradeClose(ali.TradeClose{OutTradeNo: outTradeNo})
+	if err != nil {
+		return tradeError(err)
+	}
+	if rsp.Content.Code == ali.K_SUCCESS_CODE {
+		return nil
+	}
+	err = newError(rsp.Content.Code, rsp.Content.Msg, rsp.Content.SubCode, rsp.Content.SubMsg)
+	switch {
+	case errors.Is(err, payment.ErrTradeNotFound):
+		return nil
+	case rsp.Content.SubCode == "ACQ.TRADE_STATUS_ERROR":
+		// 已经关闭或者已经付款，查询后区分
+		trade, qerr := c.Query(ctx, outTradeNo)
+		if qerr != nil {
+			return err
+		}
+		switch trade.Status {
+		case payment.StatusClosed:
+			return nil
+		case payment.StatusSuccess, payment.StatusRefund:
+			return &payment.Error{Provider: Name, Code: rsp.Content.SubCode, Message: rsp.Content.SubMsg, Err: payment.ErrTradePaid}
+		}
+	}
+	return err
+}
+
+// Refund 退款，同一个 OutRefundNo 重复请求只退一次。支付宝同步返回退款结果
+// https://docs.open.alipay.com/api_1/alipay.trade.refund/
+func (c *Client) Refund(ctx context.Context, req *payment.RefundRequest) (*payment.Refund, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.Amount <= 0 {
+		return nil, payment.ErrInvalidAmount
+	}
+	rsp, err := c.client.TradeRefund(ali.TradeRefund{
+		OutTradeNo:   req.OutTradeNo,
+		RefundAmount: payment.FormatYuan(req.Amount),
+		RefundReason: req.Reason,
+		OutRequestNo: req.OutRefundNo,
 	})
+	if err != nil {
+		return nil, tradeError(err)
+	}
+	if !rsp.IsSuccess() {
+		return nil, newError(rsp.Content.Code, rsp.Content.Msg, rsp.Content.SubCode, rsp.Content.SubMsg)
+	}
+	return &payment.Refund{
+		OutTradeNo:  req.OutTradeNo,
+		OutRefundNo: req.OutRefundNo,
+		RefundNo:    rsp.Content.TradeNo,
+		Amount:      req.Amount,
+		Status:      payment.RefundSuccess,
+	}, nil
+}
+
+// QueryRefund 查询退款，退款请求不存在时支付宝返回成功但没有退款金额
+// https://docs.open.alipay.com/api_1/alipay.trade.fastpay.refund.query
+func (c *Client) QueryRefund(ctx context.Context, outTradeNo, outRefundNo string) (*payment.Refund, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rsp, err := c.client.TradeFastPayRefundQuery(ali.TradeFastPayRefundQuery{OutTradeNo: outTradeNo, OutRequestNo: outRefundNo})
+	if err != nil {
+		return nil, tradeError(err)
+	}
+	if !rsp.IsSuccess() {
+		return nil, newError(rsp.Content.Code, rsp.Content.Msg, rsp.Content.SubCode, rsp.Content.SubMsg)
+	}
+	if rsp.Content.RefundAmount == "" {
+		return nil, payment.ErrTradeNotFound
+	}
+	amount, err := payment.ParseYuan(rsp.Content.RefundAmount)
+	if err != nil {
+		return nil, err
+	}
+	return &payment.Refund{
+		OutTradeNo:  outTradeNo,
+		OutRefundNo: outRefundNo,
+		RefundNo:    rsp.Content.TradeNo,
+		Amount:      amount,
+		Status:      payment.RefundSuccess,
+	}, nil
+}
+
+// VerifyNotification 解析并验签异步通知，付款成功、交易关闭和退款都会通知
+// https://docs.open.alipay.com/203/105286/
+func (c *Client) VerifyNotification(r *http.Request) (*payment.Notification, error) {
+	noti, err := c.client.GetTradeNotification(r)
+	if err != nil || noti == nil {
+		return nil, payment.ErrInvalidSignature
+	}
+	if noti.AppId != c.appID {
+		return nil, payment.ErrInvalidSignature
+	}
+	n := &payment.Notification{
+		Provider:   Name,
+		OutTradeNo: noti.OutTradeNo,
+		TradeNo:    noti.TradeNo,
+		Status:     tradeStatus(noti.TradeStatus, noti.RefundFee),
+		Passback:   noti.PassbackParams,
+		Raw:        make(map[string]string, len(r.Form)),
+	}
+	if passback, err := url.QueryUnescape(noti.PassbackParams); err == nil {
+		n.Passback = passback
+	}
+	if n.Amount, err = payment.ParseYuan(noti.TotalAmount); err != nil {
+		return nil, err
+	}
+	n.PaidAt, _ = time.ParseInLocation(timeFormat, noti.GmtPayment, cst)
+	for k := range r.Form {
+		n.Raw[k] = r.Form.Get(k)
+	}
+	return n, nil
+}
+
+// AckNotification 返回 success 确认收到通知，返回其他内容时支付宝会在 25 小时内重新通知
+func (c *Client) AckNotification(w http.ResponseWriter, err error) {
+	if err != nil {
+		http.Error(w, "fail", http.StatusInternalServerError)
+		return
+	}
+	ali.AckNotification(w)
+}
 
-	fmt.Println("server start....")
-	http.ListenAndServe(":8088", nil)
+// tradeStatus 全额退款后交易状态也是 TRADE_CLOSED，通知中带有退款金额时视为退款
+func tradeStatus(status, refundFee string) payment.TradeStatus {
+	if refundFee != "" && refundFee != "0.00" {
+		return payment.StatusRefund
+	}
+	switch status {
+	case ali.K_TRADE_STATUS_TRADE_SUCCESS, ali.K_TRADE_STATUS_TRADE_FINISHED:
+		return payment.StatusSuccess
+	case ali.K_TRADE_STATUS_TRADE_CLOSED:
+		return payment.StatusClosed
+	}
+	return payment.StatusNotPay
+}
+
+// tradeError 支付宝返回 error_response 时 SDK 返回 *ali.ErrorRsp
+func tradeError(err error) error {
+	var rsp *ali.ErrorRsp
+	if errors.As(err, &rsp) {
+		return newError(rsp.Code, rsp.Msg, rsp.SubCode, rsp.SubMsg)
+	}
+	return err
+}
+
+func newError(code, msg, subCode, subMsg string) error {
+	e := &payment.Error{Provider: Name, Code: firstNonEmpty(subCode, code), Message: firstNonEmpty(subMsg, msg)}
+	switch subCode {
+	case "ACQ.TRADE_NOT_EXIST":
+		e.Err = payment.ErrTradeNotFound
+	case "ACQ.TRADE_HAS_SUCCESS", "ACQ.TRADE_HAS_FINISHED":
+		e.Err = payment.ErrTradePaid
+	case "ACQ.TRADE_HAS_CLOSE":
+		e.Err = payment.ErrTradeClosed
+	case "ACQ.REFUND_AMT_NOT_EQUAL_TOTAL", "ACQ.REFUND_FEE_ERROR":
+		e.Err = payment.ErrRefundExceeded
+	case "ACQ.TRADE_NOT_ALLOW_REFUND":
+		e.Err = payment.ErrTradeNotPaid
+	case "ACQ.CONTEXT_INCONSISTENT":
+		// 订单号已经使用过，但参数不一致
+		e.Err = payment.ErrDuplicateTrade
+	}
+	return e
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
@@ -0,0 +1,302 @@
+package alipay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	ali "github.com/smartwalle/alipay/v3"
+
+	"go-demo/sdk/payment"
+)
+
+// fakeTradeClient 模拟支付宝接口，按 out_trade_no 保存交易
+type fakeTradeClient struct {
+	trades  map[string]*ali.Trade
+	status  map[string]string
+	refunds map[string]string
+	last    interface{}
+}
+
+func newTestClient() (*Client, *fakeTradeClient) {
+	fake := &fakeTradeClient{trades: map[string]*ali.Trade{}, status: map[string]string{}, refunds: map[string]string{}}
+	return &Client{appID: "2016091800540000", client: fake, opts: evaluateOptions(nil)}, fake
+}
+
+func (f *fakeTradeClient) TradePagePay(param ali.TradePagePay) (*url.URL, error) {
+	f.last = param
+	return url.Parse("https://openapi.alipaydev.com/gateway.do?out_trade_no=" + param.OutTradeNo)
+}
+
+func (f *fakeTradeClient) TradeWapPay(param ali.TradeWapPay) (*url.URL, error) {
+	f.last = param
+	return url.Parse("https://openapi.alipaydev.com/gateway.do?wap=" + param.OutTradeNo)
+}
+
+func (f *fakeTradeClient) TradeAppPay(param ali.TradeAppPay) (string, error) {
+	f.last = param
+	return "app_id=2016091800540000&biz_content=" + param.OutTradeNo, nil
+}
+
+func (f *fakeTradeClient) TradePreCreate(param ali.TradePreCreate) (*ali.TradePreCreateRsp, error) {
+	f.last = param
+	rsp := &ali.TradePreCreateRsp{}
+	if f.status[param.OutTradeNo] == ali.K_TRADE_STATUS_TRADE_SUCCESS {
+		rsp.Content.Code, rsp.Content.SubCode, rsp.Content.SubMsg = "40004", "ACQ.TRADE_HAS_SUCCESS", "交易已被支付"
+		return rsp, nil
+	}
+	f.trades[param.OutTradeNo] = &param.Trade
+	rsp.Content.Code = ali.K_SUCCESS_CODE
+	rsp.Content.QRCode = "https://qr.alipay.com/" + param.OutTradeNo
+	return rsp, nil
+}
+
+func (f *fakeTradeClient) TradeQuery(param ali.TradeQuery) (*ali.TradeQueryRsp, error) {
+	rsp := &ali.TradeQueryRsp{}
+	trade, ok := f.trades[param.OutTradeNo]
+	if !ok || f.status[param.OutTradeNo] == "" {
+		rsp.Content.Code, rsp.Content.SubCode, rsp.Content.SubMsg = "40004", "ACQ.TRADE_NOT_EXIST", "交易不存在"
+		return rsp, nil
+	}
+	rsp.Content.Code = ali.K_SUCCESS_CODE
+	rsp.Content.OutTradeNo = param.OutTradeNo
+	rsp.Content.TradeNo = "2019" + param.OutTradeNo
+	rsp.Content.TradeStatus = f.status[param.OutTradeNo]
+	rsp.Content.TotalAmount = trade.TotalAmount
+	if rsp.Content.TradeStatus == ali.K_TRADE_STATUS_TRADE_SUCCESS {
+		rsp.Content.SendPayDate = "2019-10-01 12:00:00"
+	}
+	return rsp, nil
+}
+
+func (f *fakeTradeClient) TradeClose(param ali.TradeClose) (*ali.TradeCloseRsp, error) {
+	rsp := &ali.TradeCloseRsp{}
+	switch f.status[param.OutTradeNo] {
+	case "":
+		rsp.Content.Code, rsp.Content.SubCode = "40004", "ACQ.TRADE_NOT_EXIST"
+	case ali.K_TRADE_STATUS_WAIT_BUYER_PAY:
+		f.status[param.OutTradeNo] = ali.K_TRADE_STATUS_TRADE_CLOSED
+		rsp.Content.Code = ali.K_SUCCESS_CODE
+	default:
+		rsp.Content.Code, rsp.Content.SubCode = "40004", "ACQ.TRADE_STATUS_ERROR"
+	}
+	return rsp, nil
+}
+
+func (f *fakeTradeClient) TradeRefund(param ali.TradeRefund) (*ali.TradeRefundRsp, error) {
+	rsp := &ali.TradeRefundRsp{}
+	if f.status[param.OutTradeNo] != ali.K_TRADE_STATUS_TRADE_SUCCESS {
+		rsp.Content.Code, rsp.Content.SubCode = "40004", "ACQ.TRADE_NOT_ALLOW_REFUND"
+		return rsp, nil
+	}
+	amount, _ := payment.ParseYuan(param.RefundAmount)
+	total, _ := payment.ParseYuan(f.trades[param.OutTradeNo].TotalAmount)
+	if amount > total {
+		rsp.Content.Code, rsp.Content.SubCode = "40004", "ACQ.REFUND_AMT_NOT_EQUAL_TOTAL"
+		return rsp, nil
+	}
+	f.refunds[param.OutRequestNo] = param.RefundAmount
+	rsp.Content.Code = ali.K_SUCCESS_CODE
+	rsp.Content.TradeNo = "2019" + param.OutTradeNo
+	return rsp, nil
+}
+
+func (f *fakeTradeClient) TradeFastPayRefundQuery(param ali.TradeFastPayRefundQuery) (*ali.TradeFastPayRefundQueryRsp, error) {
+	rsp := &ali.TradeFastPayRefundQueryRsp{}
+	rsp.Content.Code = ali.K_SUCCESS_CODE
+	rsp.Content.RefundAmount = f.refunds[param.OutRequestNo]
+	return rsp, nil
+}
+
+func (f *fakeTradeClient) GetTradeNotification(req *http.Request) (*ali.TradeNotification, error) {
+	req.ParseForm()
+	if req.Form.Get("sign") != "valid" {
+		return nil, errors.New("alipay: verify sign failed")
+	}
+	return &ali.TradeNotification{
+		AppId:          req.Form.Get("app_id"),
+		OutTradeNo:     req.Form.Get("out_trade_no"),
+		TradeNo:        req.Form.Get("trade_no"),
+		TradeStatus:    req.Form.Get("trade_status"),
+		TotalAmount:    req.Form.Get("total_amount"),
+		RefundFee:      req.Form.Get("refund_fee"),
+		GmtPayment:     req.Form.Get("gmt_payment"),
+		PassbackParams: req.Form.Get("passback_params"),
+	}, nil
+}
+
+func TestCreate(t *testing.T) {
+	ctx := context.Background()
+	c, fake := newTestClient()
+	no := payment.OutTradeNo("order-1", 0)
+	req := &payment.CreateRequest{OutTradeNo: no, Subject: "网页扫码支付", Amount: 1, Passback: "orgId=123456"}
+
+	for scene, want := range map[payment.Scene]string{
+		payment.ScenePage:   "FAST_INSTANT_TRADE_PAY",
+		payment.SceneWap:    "QUICK_WAP_WAY",
+		payment.SceneApp:    "QUICK_MSECURITY_PAY",
+		payment.SceneNative: "FACE_TO_FACE_PAYMENT",
+	} {
+		req.Scene = scene
+		result, err := c.Create(ctx, req)
+		if err != nil {
+			t.Fatalf("%s: %v", scene, err)
+		}
+		if result.PayURL == "" && result.Params["order_string"] == "" {
+			t.Errorf("%s: empty result", scene)
+		}
+		var trade ali.Trade
+		switch p := fake.last.(type) {
+		case ali.TradePagePay:
+			trade = p.Trade
+		case ali.TradeWapPay:
+			trade = p.Trade
+			if p.QuitURL != ReturnURL {
+				t.Errorf("quit url %s", p.QuitURL)
+			}
+		case ali.TradeAppPay:
+			trade = p.Trade
+		case ali.TradePreCreate:
+			trade = p.Trade
+			if result.PayURL != "https://qr.alipay.com/"+no {
+				t.Errorf("qr code %s", result.PayURL)
+			}
+		}
+		if trade.ProductCode != want || trade.TotalAmount != "0.01" || trade.NotifyURL != NotifyURL ||
+			trade.PassbackParams != "orgId%3D123456" || trade.OutTradeNo != no {
+			t.Errorf("%s: trade %+v", scene, trade)
+		}
+	}
+
+	req.Scene = payment.SceneJSAPI
+	if _, err := c.Create(ctx, req); err != payment.ErrUnsupportedScene {
+		t.Errorf("jsapi: %v", err)
+	}
+	req.Scene, req.Amount = payment.SceneNative, 0
+	if _, err := c.Create(ctx, req); err != payment.ErrInvalidAmount {
+		t.Errorf("zero amount: %v", err)
+	}
+	fake.status[no] = ali.K_TRADE_STATUS_TRADE_SUCCESS
+	req.Amount = 1
+	if _, err := c.Create(ctx, req); !errors.Is(err, payment.ErrTradePaid) {
+		t.Errorf("paid: %v", err)
+	}
+}
+
+func TestQueryCloseRefund(t *testing.T) {
+	ctx := context.Background()
+	c, fake := newTestClient()
+	no := payment.OutTradeNo("order-1", 0)
+	if _, err := c.Create(ctx, &payment.CreateRequest{OutTradeNo: no, Subject: "book", Amount: 1000, Scene: payment.SceneNative}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 用户扫码之前交易不存在，可以直接关闭
+	if _, err := c.Query(ctx, no); !errors.Is(err, payment.ErrTradeNotFound) {
+		t.Errorf("before scan: %v", err)
+	}
+	if err := c.Close(ctx, no); err != nil {
+		t.Errorf("close before scan: %v", err)
+	}
+
+	fake.status[no] = ali.K_TRADE_STATUS_WAIT_BUYER_PAY
+	trade, err := c.Query(ctx, no)
+	if err != nil || trade.Status != payment.StatusNotPay || trade.Amount != 1000 {
+		t.Fatalf("Query %+v, %v", trade, err)
+	}
+	fake.status[no] = ali.K_TRADE_STATUS_TRADE_SUCCESS
+	trade, err = c.Query(ctx, no)
+	if err != nil || trade.Status != payment.StatusSuccess || trade.PaidAt.UTC().Format("15:04") != "04:00" {
+		t.Fatalf("Query paid %+v, %v", trade, err)
+	}
+	if err = c.Close(ctx, no); !errors.Is(err, payment.ErrTradePaid) {
+		t.Errorf("close paid: %v", err)
+	}
+
+	refundNo := payment.OutRefundNo(no, 0)
+	if _, err = c.QueryRefund(ctx, no, refundNo); err != payment.ErrTradeNotFound {
+		t.Errorf("refund before request: %v", err)
+	}
+	refund, err := c.Refund(ctx, &payment.RefundRequest{OutTradeNo: no, OutRefundNo: refundNo, Amount: 600})
+	if err != nil || refund.Status != payment.RefundSuccess || refund.Amount != 600 {
+		t.Fatalf("Refund %+v, %v", refund, err)
+	}
+	if refund, err = c.QueryRefund(ctx, no, refundNo); err != nil || refund.Amount != 600 {
+		t.Errorf("QueryRefund %+v, %v", refund, err)
+	}
+
+	other := payment.OutTradeNo("order-2", 0)
+	c.Create(ctx, &payment.CreateRequest{OutTradeNo: other, Subject: "pen", Amount: 1, Scene: payment.SceneNative})
+	fake.status[other] = ali.K_TRADE_STATUS_WAIT_BUYER_PAY
+	if err = c.Close(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Close(ctx, other); err != nil {
+		t.Errorf("close twice: %v", err)
+	}
+	if _, err = c.Refund(ctx, &payment.RefundRequest{OutTradeNo: other, OutRefundNo: "r", Amount: 1}); !errors.Is(err, payment.ErrTradeNotPaid) {
+		t.Errorf("refund closed: %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = c.Query(canceled, no); err != context.Canceled {
+		t.Errorf("canceled: %v", err)
+	}
+}
+
+func TestVerifyNotification(t *testing.T) {
+	c, _ := newTestClient()
+	notify := func(values url.Values) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/alipay", strings.NewReader(values.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	values := url.Values{
+		"app_id":          {"2016091800540000"},
+		"out_trade_no":    {"t1"},
+		"trade_no":        {"2019t1"},
+		"trade_status":    {"TRADE_SUCCESS"},
+		"total_amount":    {"10.00"},
+		"gmt_payment":     {"2019-10-01 12:00:00"},
+		"passback_params": {"orgId%3D123456"},
+		"sign":            {"valid"},
+	}
+	n, err := c.VerifyNotification(notify(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Provider != Name || n.Status != payment.StatusSuccess || n.Amount != 1000 || n.Passback != "orgId=123456" ||
+		n.Raw["trade_no"] != "2019t1" || n.PaidAt.IsZero() {
+		t.Errorf("notification %+v", n)
+	}
+
+	values.Set("refund_fee", "10.00")
+	values.Set("trade_status", "TRADE_CLOSED")
+	if n, err = c.VerifyNotification(notify(values)); err != nil || n.Status != payment.StatusRefund {
+		t.Errorf("refund notification %+v, %v", n, err)
+	}
+	values.Set("app_id", "other")
+	if _, err = c.VerifyNotification(notify(values)); err != payment.ErrInvalidSignature {
+		t.Errorf("other app: %v", err)
+	}
+	values.Set("sign", "forged")
+	if _, err = c.VerifyNotification(notify(values)); err != payment.ErrInvalidSignature {
+		t.Errorf("forged: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c.AckNotification(w, nil)
+	if w.Body.String() != "success" {
+		t.Errorf("ack %q", w.Body)
+	}
+	w = httptest.NewRecorder()
+	c.AckNotification(w, errors.New("db down"))
+	if strings.Contains(w.Body.String(), "success") {
+		t.Errorf("nack %q", w.Body)
+	}
+}
@@ -0,0 +1,69 @@
+package alipay
+
+import "net/http"
+
+type (
+	Option  func(*options)
+	options struct {
+		production   bool
+		appPublic    string
+		aliPayPublic string
+		aliPayRoot   string
+		notifyURL    string
+		returnURL    string
+		httpClient   *http.Client
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		appPublic:    "appPublic.crt",
+		aliPayPublic: "aliPayPublic.crt",
+		aliPayRoot:   "aliPayRoot.crt",
+		notifyURL:    NotifyURL,
+		returnURL:    ReturnURL,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+// WithProduction uses the production gateway instead of the sandbox, default false.
+func WithProduction(production bool) Option {
+	return func(opts *options) {
+		opts.production = production
+	}
+}
+
+// WithCertFiles sets the app public cert, alipay public cert and alipay root cert files,
+// default appPublic.crt, aliPayPublic.crt and aliPayRoot.crt.
+func WithCertFiles(appPublic, aliPayPublic, aliPayRoot string) Option {
+	return func(opts *options) {
+		opts.appPublic = appPublic
+		opts.aliPayPublic = aliPayPublic
+		opts.aliPayRoot = aliPayRoot
+	}
+}
+
+// WithNotifyURL sets the default notify url used when the request has none, default NotifyURL.
+func WithNotifyURL(notifyURL string) Option {
+	return func(opts *options) {
+		opts.notifyURL = notifyURL
+	}
+}
+
+// WithReturnURL sets the default return url used when the request has none, default ReturnURL.
+func WithReturnURL(returnURL string) Option {
+	return func(opts *options) {
+		opts.returnURL = returnURL
+	}
+}
+
+// WithHTTPClient sets the http client used to call the gateway.
+func WithHTTPClient(client *http.Client) Option {
+	return func(opts *options) {
+		opts.httpClient = client
+	}
+}
@@ -0,0 +1,132 @@
+/**
+ * 对象存储抽象
+ *   1. BlobStore 统一上传、下载、范围下载、删除、按前缀列举、签名 URL 和分片上传
+ *   2. Local 本地磁盘实现，写入先落临时文件再改名，签名 URL 由 DownloadHandler 校验，见 local.go
+ *   3. OSS 阿里云 OSS 实现，见 oss.go
+ *   4. S3 兼容 S3 协议的服务（AWS S3、MinIO、腾讯云 COS 等），自带 SigV4 签名，见 s3.go
+ *   5. UploadHandler/DownloadHandler 基于 BlobStore 的上传下载接口，支持大小和类型限制、Range 下载，见 handler.go
+ */
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound         = errors.New("blob: object not found")
+	ErrInvalidKey       = errors.New("blob: invalid key")
+	ErrInvalidRange     = errors.New("blob: invalid range")
+	ErrNoSuchUpload     = errors.New("blob: multipart upload not found")
+	ErrInvalidPart      = errors.New("blob: invalid multipart part")
+	ErrNotSupported     = errors.New("blob: not supported")
+	ErrInvalidSignature = errors.New("blob: invalid or expired signature")
+)
+
+// Object 对象的元信息
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Part 分片上传中已经上传的分片，完成上传时按 Number 递增传入
+type Part struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// BlobStore 对象存储，key 使用 / 分隔的相对路径
+type BlobStore interface {
+	// Put 写入对象，同名对象被覆盖
+	Put(ctx context.Context, key string, r io.Reader, opts ...PutOption) (*Object, error)
+	// Get 读取对象，调用方负责关闭返回的 ReadCloser，对象不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// GetRange 读取从 offset 开始的 length 个字节，length 小于 0 时读到末尾，
+	// offset 超出对象大小时返回 ErrInvalidRange。返回的 Object 为整个对象的信息
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *Object, error)
+	// Stat 读取对象信息，对象不存在时返回 ErrNotFound
+	Stat(ctx context.Context, key string) (*Object, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// List 列举 key 以 prefix 开头的所有对象，按 key 排序
+	List(ctx context.Context, prefix string) ([]*Object, error)
+	// SignedURL 生成 expires 内有效的 method（GET、PUT）访问地址
+	SignedURL(ctx context.Context, key, method string, expires time.Duration) (string, error)
+
+	// CreateMultipart 开始分片上传，返回上传 ID
+	CreateMultipart(ctx context.Context, key string, opts ...PutOption) (string, error)
+	// UploadPart 上传第 number 个分片，number 从 1 开始，除最后一个外的分片大小需要满足服务的下限
+	UploadPart(ctx context.Context, key, uploadID string, number int, r io.Reader, size int64) (Part, error)
+	// CompleteMultipart 按 parts 的顺序合并分片
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) (*Object, error)
+	// AbortMultipart 取消分片上传并删除已经上传的分片
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+}
+
+// PutMultipart 把 r 按 partSize 切分后分片上传，适合大小未知或很大的数据，失败时取消上传
+func PutMultipart(ctx context.Context, store BlobStore, key string, r io.Reader, partSize int64, opts ...PutOption) (*Object, error) {
+	uploadID, err := store.CreateMultipart(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := uploadParts(ctx, store, key, uploadID, r, partSize, nil)
+	if err != nil {
+		// 取消失败时未完成的分片由服务端生命周期规则清理
+		store.AbortMultipart(context.Background(), key, uploadID)
+		return nil, err
+	}
+	return obj, nil
+}
+
+// uploadParts 从 r 读取分片并上传，first 为已经读出的第一个分片
+func uploadParts(ctx context.Context, store BlobStore, key, uploadID string, r io.Reader, partSize int64, first []byte) (*Object, error) {
+	var parts []Part
+	buf := make([]byte, partSize)
+	for number := 1; ; number++ {
+		var data []byte
+		if number == 1 && first != nil {
+			data = first
+		} else {
+			n, err := io.ReadFull(r, buf)
+			if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				return nil, err
+			}
+			// 空对象也需要一个分片
+			if n == 0 && number > 1 {
+				break
+			}
+			data = buf[:n]
+		}
+		part, err := store.UploadPart(ctx, key, uploadID, number, bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		if int64(len(data)) < partSize {
+			break
+		}
+	}
+	return store.CompleteMultipart(ctx, key, uploadID, parts)
+}
+
+// ValidKey key 不能为空、不能以 / 开头或结尾，不能包含 . 或 .. 路径段
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return path.Clean(key) == key
+}
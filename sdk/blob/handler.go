@@ -0,0 +1,281 @@
+package blob
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"go-demo/utils/seq"
+)
+
+var errTooLarge = errors.New("blob: upload too large")
+
+// UploadHandler 接收 multipart 表单中的文件写入 store，成功时返回 201 和对象信息的 JSON。
+// 文件边读边写，不在内存中缓存，超过 WithMaxSize 时返回 413，类型不在 WithAllowedTypes 中时返回 415
+func UploadHandler(store BlobStore, opts ...HandlerOption) http.Handler {
+	o := evaluateHandlerOptions(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// 留出表单其他字段和分隔符的空间，文件本身的大小单独限制
+		r.Body = http.MaxBytesReader(w, r.Body, o.maxSize+64<<10)
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				http.Error(w, "missing form field "+o.field, http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if part.FormName() != o.field {
+				part.Close()
+				continue
+			}
+			upload(w, r, store, o, part.FileName(), part)
+			part.Close()
+			return
+		}
+	})
+}
+
+func upload(w http.ResponseWriter, r *http.Request, store BlobStore, o *handlerOptions, filename string, body io.Reader) {
+	// 按内容判断类型，不相信客户端给出的 Content-Type 和扩展名
+	br := bufio.NewReaderSize(body, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentType := http.DetectContentType(head)
+	if len(o.types) > 0 && !allowed(o.types, contentType) {
+		http.Error(w, "unsupported content type "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	key := o.keyFunc(r, filename, contentType)
+	if !ValidKey(key) {
+		http.Error(w, ErrInvalidKey.Error(), http.StatusBadRequest)
+		return
+	}
+	if o.authorize != nil {
+		if err := o.authorize(r, key); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	obj, err := store.Put(r.Context(), key, &maxReader{r: br, n: o.maxSize}, WithContentType(contentType))
+	if err != nil {
+		// MaxBytesReader 的错误没有导出，只能比较错误信息
+		if errors.Is(err, errTooLarge) || strings.Contains(err.Error(), "request body too large") {
+			http.Error(w, fmt.Sprintf("file larger than %d bytes", o.maxSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(obj)
+}
+
+// DownloadHandler 读取 key 参数或 URL 路径（配合 http.StripPrefix）对应的对象，
+// 支持 HEAD、单个 Range 和 If-None-Match
+func DownloadHandler(store BlobStore, opts ...HandlerOption) http.Handler {
+	o := evaluateHandlerOptions(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			key = strings.TrimPrefix(r.URL.Path, "/")
+		}
+		if !ValidKey(key) {
+			http.Error(w, ErrInvalidKey.Error(), http.StatusBadRequest)
+			return
+		}
+		if o.authorize != nil {
+			if err := o.authorize(r, key); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		obj, err := store.Stat(r.Context(), key)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		etag := `"` + obj.ETag + `"`
+		h := w.Header()
+		h.Set("ETag", etag)
+		h.Set("Accept-Ranges", "bytes")
+		h.Set("Content-Type", obj.ContentType)
+		// 浏览器不按内容猜测类型，避免上传的文件被当作 html 执行
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(key)}))
+		if !obj.LastModified.IsZero() {
+			h.Set("Last-Modified", obj.LastModified.UTC().Format(http.TimeFormat))
+		}
+		if match := r.Header.Get("If-None-Match"); match != "" && (match == etag || match == "*") {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		offset, length, status := int64(0), obj.Size, http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			var ok bool
+			offset, length, ok = parseRange(rng, obj.Size)
+			if !ok {
+				h.Set("Content-Range", fmt.Sprintf("bytes */%d", obj.Size))
+				http.Error(w, ErrInvalidRange.Error(), http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			if length != obj.Size {
+				status = http.StatusPartialContent
+				h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, obj.Size))
+			}
+		}
+		h.Set("Content-Length", strconv.FormatInt(length, 10))
+		if r.Method == http.MethodHead {
+			w.WriteHeader(status)
+			return
+		}
+
+		var body io.ReadCloser
+		if status == http.StatusPartialContent {
+			body, _, err = store.GetRange(r.Context(), key, offset, length)
+		} else {
+			body, _, err = store.Get(r.Context(), key)
+		}
+		if err != nil {
+			h.Del("Content-Length")
+			writeError(w, err)
+			return
+		}
+		defer body.Close()
+		w.WriteHeader(status)
+		io.CopyN(w, body, length)
+	})
+}
+
+// parseRange 解析单个 bytes 范围，多个范围时返回整个对象，范围无效时 ok 为 false
+func parseRange(header string, size int64) (offset, length int64, ok bool) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, 0, false
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	if strings.Contains(spec, ",") {
+		return 0, size, true
+	}
+	i := strings.Index(spec, "-")
+	if i < 0 || size == 0 {
+		return 0, 0, false
+	}
+	start, end := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if start == "" {
+		// 最后 n 个字节
+		n, err := strconv.ParseInt(end, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil || offset < 0 || offset >= size {
+		return 0, 0, false
+	}
+	last := size - 1
+	if end != "" {
+		e, err := strconv.ParseInt(end, 10, 64)
+		if err != nil || e < offset {
+			return 0, 0, false
+		}
+		if e < last {
+			last = e
+		}
+	}
+	return offset, last - offset + 1, true
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrInvalidKey):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrInvalidRange):
+		status = http.StatusRequestedRangeNotSatisfiable
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func allowed(types []string, contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, t := range types {
+		if t == contentType || t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultKey 随机 uuid 加上内容类型对应的扩展名，文件名的扩展名属于该类型时优先使用。
+// 下载时按扩展名返回 Content-Type，不能用客户端给出的扩展名，否则 png 内容可以存为 .html
+func defaultKey(r *http.Request, filename, contentType string) string {
+	exts, _ := mime.ExtensionsByType(contentType)
+	if len(exts) == 0 {
+		return seq.UUID()
+	}
+	ext := exts[0]
+	for _, e := range exts {
+		if strings.EqualFold(e, path.Ext(filename)) {
+			ext = e
+			break
+		}
+	}
+	return seq.UUID() + ext
+}
+
+// maxReader 读取超过 n 个字节时返回 errTooLarge
+type maxReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *maxReader) Read(p []byte) (int, error) {
+	if m.n < 0 {
+		return 0, errTooLarge
+	}
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	if m.n < 0 {
+		return n, errTooLarge
+	}
+	return n, err
+}
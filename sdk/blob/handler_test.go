@@ -0,0 +1,245 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func uploadRequest(t *testing.T, field, filename string, data []byte) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("title", "avatar")
+	fw, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	w.Close()
+	r := httptest.NewRequest(http.MethodPost, "/upload", &buf)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	return r
+}
+
+func TestUploadHandler(t *testing.T) {
+	l := newTestLocal(t)
+	h := UploadHandler(l, WithMaxSize(1024), WithAllowedTypes("image/png", "image/jpeg"))
+
+	data := append(append([]byte(nil), pngHeader...), bytes.Repeat([]byte{1}, 100)...)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, uploadRequest(t, "file", "a.png", data))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var obj Object
+	if err := json.Unmarshal(rec.Body.Bytes(), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(obj.Key, ".png") || obj.Size != int64(len(data)) || obj.ContentType != "image/png" {
+		t.Errorf("object %+v", obj)
+	}
+	if got, err := l.Stat(context.Background(), obj.Key); err != nil || got.Size != obj.Size {
+		t.Errorf("stored %+v, %v", got, err)
+	}
+
+	tests := []struct {
+		name   string
+		field  string
+		data   []byte
+		status int
+	}{
+		{"too large", "file", append(append([]byte(nil), pngHeader...), make([]byte, 1024)...), http.StatusRequestEntityTooLarge},
+		{"request too large", "file", append(append([]byte(nil), pngHeader...), make([]byte, 100<<10)...), http.StatusRequestEntityTooLarge},
+		{"content type", "file", []byte("plain text pretending to be png"), http.StatusUnsupportedMediaType},
+		{"missing field", "other", data, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, uploadRequest(t, tt.field, "a.png", tt.data))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, rec.Code, tt.status, rec.Body)
+		}
+	}
+	// 扩展名按内容类型决定，png 内容不能存为 .html
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, uploadRequest(t, "file", "x.html", data))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(obj.Key, ".png") {
+		t.Errorf("key %s, want .png extension", obj.Key)
+	}
+	if got, err := l.Stat(context.Background(), obj.Key); err != nil || got.ContentType != "image/png" {
+		t.Errorf("stored %+v, %v", got, err)
+	}
+
+	// 失败的上传不留下对象和临时文件
+	objects, _ := l.List(context.Background(), "")
+	if len(objects) != 2 {
+		t.Errorf("objects %d", len(objects))
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status %d", rec.Code)
+	}
+}
+
+func TestUploadHandlerKeyAndAuthorizer(t *testing.T) {
+	l := newTestLocal(t)
+	h := UploadHandler(l,
+		WithFormField("avatar"),
+		WithKeyFunc(func(r *http.Request, filename, contentType string) string {
+			return "users/" + r.URL.Query().Get("user") + "/" + filename
+		}),
+		WithAuthorizer(func(r *http.Request, key string) error {
+			if r.Header.Get("X-User") == "" {
+				return errors.New("login required")
+			}
+			return nil
+		}),
+	)
+	r := uploadRequest(t, "avatar", "me.txt", []byte("hello"))
+	r.URL.RawQuery = "user=42"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("anonymous status %d", rec.Code)
+	}
+
+	r = uploadRequest(t, "avatar", "me.txt", []byte("hello"))
+	r.URL.RawQuery = "user=42"
+	r.Header.Set("X-User", "42")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := l.Stat(context.Background(), "users/42/me.txt"); err != nil {
+		t.Error(err)
+	}
+
+	// key 函数生成的 key 无效时拒绝
+	r = uploadRequest(t, "avatar", "me.txt", []byte("hello"))
+	r.URL.RawQuery = "user=.."
+	r.Header.Set("X-User", "42")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid key status %d", rec.Code)
+	}
+}
+
+func TestDownloadHandler(t *testing.T) {
+	l := newTestLocal(t)
+	obj, err := l.Put(context.Background(), "docs/digits.txt", strings.NewReader("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.StripPrefix("/files/", DownloadHandler(l))
+	serve := func(method, target string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := serve("GET", "/files/docs/digits.txt", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("GET %d %q", rec.Code, rec.Body)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag != `"`+obj.ETag+`"` || rec.Header().Get("Accept-Ranges") != "bytes" ||
+		!strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") ||
+		rec.Header().Get("Content-Disposition") != `attachment; filename=digits.txt` ||
+		rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("headers %v", rec.Header())
+	}
+
+	rec = serve("GET", "/files/?key=docs/digits.txt", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Errorf("key param %d %q", rec.Code, rec.Body)
+	}
+
+	ranges := []struct {
+		header, body, contentRange string
+		status                     int
+	}{
+		{"bytes=2-4", "234", "bytes 2-4/10", http.StatusPartialContent},
+		{"bytes=7-", "789", "bytes 7-9/10", http.StatusPartialContent},
+		{"bytes=-2", "89", "bytes 8-9/10", http.StatusPartialContent},
+		{"bytes=5-100", "56789", "bytes 5-9/10", http.StatusPartialContent},
+		{"bytes=0-", "0123456789", "", http.StatusOK},
+		{"bytes=0-1,3-4", "0123456789", "", http.StatusOK},
+		{"bytes=10-", "", "bytes */10", http.StatusRequestedRangeNotSatisfiable},
+		{"bytes=4-2", "", "bytes */10", http.StatusRequestedRangeNotSatisfiable},
+		{"items=0-1", "", "bytes */10", http.StatusRequestedRangeNotSatisfiable},
+	}
+	for _, tt := range ranges {
+		rec := serve("GET", "/files/docs/digits.txt", map[string]string{"Range": tt.header})
+		if rec.Code != tt.status || rec.Header().Get("Content-Range") != tt.contentRange ||
+			(tt.status != http.StatusRequestedRangeNotSatisfiable && rec.Body.String() != tt.body) {
+			t.Errorf("%s: %d %q %q", tt.header, rec.Code, rec.Header().Get("Content-Range"), rec.Body)
+		}
+	}
+
+	rec = serve("HEAD", "/files/docs/digits.txt", map[string]string{"Range": "bytes=0-3"})
+	if rec.Code != http.StatusPartialContent || rec.Header().Get("Content-Length") != "4" || rec.Body.Len() != 0 {
+		t.Errorf("HEAD %d %v %q", rec.Code, rec.Header(), rec.Body)
+	}
+	rec = serve("GET", "/files/docs/digits.txt", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match %d", rec.Code)
+	}
+	if rec = serve("GET", "/files/docs/missing.txt", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("missing %d", rec.Code)
+	}
+	if rec = serve("GET", "/files/?key=../etc/passwd", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid key %d", rec.Code)
+	}
+	if rec = serve("DELETE", "/files/docs/digits.txt", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE %d", rec.Code)
+	}
+}
+
+func TestDownloadHandlerSigned(t *testing.T) {
+	l := newTestLocal(t, WithSigning("http://example.com/files/", []byte("secret")))
+	ctx := context.Background()
+	if _, err := l.Put(ctx, "private/report.csv", strings.NewReader("a,b\n")); err != nil {
+		t.Fatal(err)
+	}
+	h := http.StripPrefix("/files/", DownloadHandler(l, WithAuthorizer(l.Verify)))
+
+	signed, err := l.SignedURL(ctx, "private/report.csv", "GET", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, signed, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "a,b\n" {
+		t.Errorf("signed %d %q", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/private/report.csv", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("unsigned %d", rec.Code)
+	}
+}
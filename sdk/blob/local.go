@@ -0,0 +1,455 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 临时文件和未完成的分片上传所在的目录，不能作为 key 使用
+const localReserved = ".blob"
+
+// Local 把对象保存为 root 下的文件，key 即相对路径。
+// 内容类型按扩展名推断，不单独保存，ETag 由修改时间和大小计算
+type Local struct {
+	root string
+	opts *localOptions
+}
+
+var _ BlobStore = (*Local)(nil)
+
+func NewLocal(root string, opts ...LocalOption) (*Local, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Join(root, localReserved, "tmp"), 0755); err != nil {
+		return nil, err
+	}
+	return &Local{root: root, opts: evaluateLocalOptions(opts)}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	if !ValidKey(key) || key == localReserved || strings.HasPrefix(key, localReserved+"/") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, opts ...PutOption) (*Object, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	tmp, err := l.writeTemp(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if err = l.commit(tmp, name); err != nil {
+		return nil, err
+	}
+	return l.Stat(ctx, key)
+}
+
+// writeTemp 把 r 写入临时文件，返回文件名，失败时删除临时文件
+func (l *Local) writeTemp(ctx context.Context, r io.Reader) (string, error) {
+	f, err := ioutil.TempFile(filepath.Join(l.root, localReserved, "tmp"), "put-")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, ctxReader{ctx: ctx, r: r})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// commit 把写好的临时文件改名为对象，读取方不会看到写了一半的对象
+func (l *Local) commit(tmp, name string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	return l.GetRange(ctx, key, 0, -1)
+}
+
+func (l *Local) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *Object, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, notFound(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, ErrNotFound
+	}
+	obj := l.object(key, info)
+	if offset < 0 || (offset > 0 && offset >= obj.Size) {
+		f.Close()
+		return nil, nil, ErrInvalidRange
+	}
+	if offset == 0 && length < 0 {
+		return f, obj, nil
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if length < 0 {
+		length = obj.Size - offset
+	}
+	return limitedReadCloser{Reader: io.LimitReader(f, length), Closer: f}, obj, nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (*Object, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if info.IsDir() {
+		return nil, ErrNotFound
+	}
+	return l.object(key, info), nil
+}
+
+func (l *Local) object(key string, info os.FileInfo) *Object {
+	return &Object{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  typeByKey(key),
+		ETag:         fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}
+}
+
+// Delete 删除对象，并删除因此变空的上级目录
+func (l *Local) Delete(ctx context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := filepath.Dir(name); dir != l.root; dir = filepath.Dir(dir) {
+		// 目录不为空时删除失败，停止向上
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// listStart 返回 prefix 中最深的目录，prefix 以 / 开头、包含 \ 或者目录部分有 . 和 .. 时返回 ErrInvalidKey，防止遍历 root 之外的目录
+func (l *Local) listStart(prefix string) (string, error) {
+	if strings.HasPrefix(prefix, "/") || strings.Contains(prefix, "\\") {
+		return "", ErrInvalidKey
+	}
+	i := strings.LastIndex(prefix, "/")
+	if i <= 0 {
+		return l.root, nil
+	}
+	for _, seg := range strings.Split(prefix[:i], "/") {
+		if seg == "." || seg == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	start := filepath.Join(l.root, filepath.FromSlash(prefix[:i]))
+	if rel, err := filepath.Rel(l.root, start); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return start, nil
+}
+
+func (l *Local) List(ctx context.Context, prefix string) ([]*Object, error) {
+	start, err := l.listStart(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var objects []*Object
+	err = filepath.Walk(start, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		// prefix 在保留目录中时从保留目录开始遍历，整个跳过
+		if key == localReserved || strings.HasPrefix(key, localReserved+"/") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, l.object(key, info))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// SignedURL 生成由 Verify 校验的地址，需要 WithSigning
+func (l *Local) SignedURL(ctx context.Context, key, method string, expires time.Duration) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	if l.opts.secret == nil {
+		return "", ErrNotSupported
+	}
+	exp := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{"expires": {exp}, "signature": {l.sign(method, key, exp)}}
+	return strings.TrimSuffix(l.opts.baseURL, "/") + "/" + escapeKey(key) + "?" + query.Encode(), nil
+}
+
+// Verify 校验 SignedURL 生成的地址没有被修改且没有过期，HEAD 请求可以使用 GET 的签名，
+// 可以作为 WithAuthorizer 的参数
+func (l *Local) Verify(r *http.Request, key string) error {
+	if l.opts.secret == nil {
+		return ErrNotSupported
+	}
+	query := r.URL.Query()
+	exp := query.Get("expires")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(l.sign(method, key, exp))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (l *Local) sign(method, key, expires string) string {
+	mac := hmac.New(sha256.New, l.opts.secret)
+	io.WriteString(mac, strings.ToUpper(method)+"\n"+key+"\n"+expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 分片上传的目录为 .blob/uploads/{uploadID}，其中 key 文件保存对象 key，分片保存为编号命名的文件
+
+func (l *Local) uploadDir(key, uploadID string) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", ErrNoSuchUpload
+	}
+	dir := filepath.Join(l.root, localReserved, "uploads", uploadID)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "key"))
+	if err != nil || string(data) != key {
+		return "", ErrNoSuchUpload
+	}
+	return dir, nil
+}
+
+func (l *Local) CreateMultipart(ctx context.Context, key string, opts ...PutOption) (string, error) {
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(b)
+	dir := filepath.Join(l.root, localReserved, "uploads", uploadID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "key"), []byte(key), 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return uploadID, nil
+}
+
+func (l *Local) UploadPart(ctx context.Context, key, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	dir, err := l.uploadDir(key, uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	if number < 1 {
+		return Part{}, ErrInvalidPart
+	}
+	h := md5.New()
+	tmp, err := l.writeTemp(ctx, io.TeeReader(r, h))
+	if err != nil {
+		return Part{}, err
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return Part{}, err
+	}
+	if size >= 0 && info.Size() != size {
+		os.Remove(tmp)
+		return Part{}, fmt.Errorf("%w: part %d has %d bytes, expected %d", ErrInvalidPart, number, info.Size(), size)
+	}
+	if err = l.commit(tmp, filepath.Join(dir, strconv.Itoa(number))); err != nil {
+		return Part{}, err
+	}
+	return Part{Number: number, ETag: hex.EncodeToString(h.Sum(nil)), Size: info.Size()}, nil
+}
+
+func (l *Local) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) (*Object, error) {
+	dir, err := l.uploadDir(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := l.path(key)
+	if len(parts) == 0 {
+		return nil, ErrInvalidPart
+	}
+	readers := make([]io.Reader, 0, len(parts))
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for i, part := range parts {
+		if i > 0 && part.Number <= parts[i-1].Number {
+			return nil, fmt.Errorf("%w: parts must be in ascending order", ErrInvalidPart)
+		}
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(part.Number)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: part %d not uploaded", ErrInvalidPart, part.Number)
+		}
+		files = append(files, f)
+		// 分片被重新上传过时 ETag 不一致
+		h := md5.New()
+		if _, err = io.Copy(h, f); err != nil {
+			return nil, err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != part.ETag {
+			return nil, fmt.Errorf("%w: part %d etag mismatch", ErrInvalidPart, part.Number)
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		readers = append(readers, f)
+	}
+	tmp, err := l.writeTemp(ctx, io.MultiReader(readers...))
+	if err != nil {
+		return nil, err
+	}
+	if err = l.commit(tmp, name); err != nil {
+		return nil, err
+	}
+	os.RemoveAll(dir)
+	return l.Stat(ctx, key)
+}
+
+func (l *Local) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	dir, err := l.uploadDir(key, uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func notFound(err error) error {
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// escapeKey 按路径段转义 key，保留 /
+func escapeKey(key string) string {
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// ctxReader ctx 结束后读取返回错误，用来中断大文件的复制
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
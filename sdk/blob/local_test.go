@@ -0,0 +1,346 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T, opts ...LocalOption) *Local {
+	t.Helper()
+	l, err := NewLocal(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func readAll(t *testing.T, l *Local, key string, offset, length int64) string {
+	t.Helper()
+	body, _, err := l.GetRange(context.Background(), key, offset, length)
+	if err != nil {
+		t.Fatalf("GetRange %s %d %d: %v", key, offset, length, err)
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLocalPutGet(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+
+	obj, err := l.Put(ctx, "docs/readme.txt", strings.NewReader("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Key != "docs/readme.txt" || obj.Size != 11 || !strings.HasPrefix(obj.ContentType, "text/plain") || obj.ETag == "" {
+		t.Errorf("Put %+v", obj)
+	}
+
+	body, got, err := l.Get(ctx, "docs/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+	if string(data) != "hello world" || got.Size != 11 || got.ETag != obj.ETag {
+		t.Errorf("Get %q %+v", data, got)
+	}
+
+	// 覆盖
+	if _, err = l.Put(ctx, "docs/readme.txt", strings.NewReader("bye")); err != nil {
+		t.Fatal(err)
+	}
+	if s := readAll(t, l, "docs/readme.txt", 0, -1); s != "bye" {
+		t.Errorf("after overwrite %q", s)
+	}
+
+	if _, _, err = l.Get(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err = l.Stat(ctx, "docs"); err != ErrNotFound {
+		t.Errorf("directory should not be an object, got %v", err)
+	}
+	if _, err = l.Put(ctx, "empty", bytes.NewReader(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if s := readAll(t, l, "empty", 0, -1); s != "" {
+		t.Errorf("empty %q", s)
+	}
+}
+
+func TestLocalInvalidKey(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+	for _, key := range []string{"", "/abs", "dir/", "../escape", "a/../../b", "a//b", "./a", `a\b`, ".blob/tmp/x", ".blob"} {
+		if _, err := l.Put(ctx, key, strings.NewReader("x")); err != ErrInvalidKey {
+			t.Errorf("Put %q: expected ErrInvalidKey, got %v", key, err)
+		}
+		if _, _, err := l.Get(ctx, key); err != ErrInvalidKey {
+			t.Errorf("Get %q: expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(l.root), "escape")); !os.IsNotExist(err) {
+		t.Error("wrote outside of root")
+	}
+}
+
+func TestLocalRange(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+	if _, err := l.Put(ctx, "digits", strings.NewReader("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{0, 3, "012"},
+		{4, 3, "456"},
+		{7, -1, "789"},
+		{8, 100, "89"},
+	}
+	for _, tt := range tests {
+		if got := readAll(t, l, "digits", tt.offset, tt.length); got != tt.want {
+			t.Errorf("range %d %d: got %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+	for _, offset := range []int64{10, 11, -1} {
+		if _, _, err := l.GetRange(ctx, "digits", offset, 1); err != ErrInvalidRange {
+			t.Errorf("offset %d: expected ErrInvalidRange, got %v", offset, err)
+		}
+	}
+	_, obj, err := l.GetRange(ctx, "digits", 2, 2)
+	if err != nil || obj.Size != 10 {
+		t.Errorf("range object %+v, %v", obj, err)
+	}
+}
+
+func TestLocalDeleteList(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+	for _, key := range []string{"a/1.txt", "a/2.txt", "a/b/3.txt", "a.txt", "b/4.txt"} {
+		if _, err := l.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 未完成的分片上传和临时文件不出现在结果中
+	if _, err := l.CreateMultipart(ctx, "a/pending"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := func(prefix string) string {
+		objects, err := l.List(ctx, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+		}
+		return strings.Join(keys, ",")
+	}
+	tests := map[string]string{
+		"":               "a.txt,a/1.txt,a/2.txt,a/b/3.txt,b/4.txt",
+		"a":              "a.txt,a/1.txt,a/2.txt,a/b/3.txt",
+		"a/":             "a/1.txt,a/2.txt,a/b/3.txt",
+		"a/b":            "a/b/3.txt",
+		"a/b/3":          "a/b/3.txt",
+		"c":              "",
+		"c/d/":           "",
+		".blob/":         "",
+		".blob/uploads/": "",
+		".blob/tmp/":     "",
+		"b/4.txt":        "b/4.txt",
+	}
+	for prefix, want := range tests {
+		if got := keys(prefix); got != want {
+			t.Errorf("List %q: got %s, want %s", prefix, got, want)
+		}
+	}
+
+	if err := l.Delete(ctx, "a/b/3.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// 变空的目录一起删除，对象不存在时不报错
+	if _, err := os.Stat(filepath.Join(l.root, "a", "b")); !os.IsNotExist(err) {
+		t.Errorf("empty directory left: %v", err)
+	}
+	if err := l.Delete(ctx, "a/b/3.txt"); err != nil {
+		t.Errorf("delete missing: %v", err)
+	}
+	if got := keys("a/"); got != "a/1.txt,a/2.txt" {
+		t.Errorf("List after delete %s", got)
+	}
+
+	// 在 root 旁边放一个文件，prefix 不能遍历到 root 之外
+	secret := filepath.Join(filepath.Dir(l.root), "secret")
+	if err := os.MkdirAll(secret, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(secret, "key.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{"../secret/", "a/../../secret/", "./a/", "/a/", `\a`, `a\..\..\secret/`} {
+		if objects, err := l.List(ctx, prefix); err != ErrInvalidKey {
+			t.Errorf("List %q: expected ErrInvalidKey, got %d objects, %v", prefix, len(objects), err)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := l.List(canceled, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestLocalMultipart(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+	id, err := l.CreateMultipart(ctx, "big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := l.UploadPart(ctx, "big.bin", id, 2, strings.NewReader("world"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1, err := l.UploadPart(ctx, "big.bin", id, 1, strings.NewReader("hello "), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.UploadPart(ctx, "big.bin", id, 3, strings.NewReader("short"), 10); !errors.Is(err, ErrInvalidPart) {
+		t.Errorf("size mismatch: expected ErrInvalidPart, got %v", err)
+	}
+	if _, err = l.UploadPart(ctx, "other", id, 1, strings.NewReader("x"), 1); err != ErrNoSuchUpload {
+		t.Errorf("wrong key: expected ErrNoSuchUpload, got %v", err)
+	}
+	// 对象在完成前不可见
+	if _, err = l.Stat(ctx, "big.bin"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound before complete, got %v", err)
+	}
+	if _, err = l.CompleteMultipart(ctx, "big.bin", id, []Part{p2, p1}); !errors.Is(err, ErrInvalidPart) {
+		t.Errorf("wrong order: expected ErrInvalidPart, got %v", err)
+	}
+	if _, err = l.CompleteMultipart(ctx, "big.bin", id, []Part{p1, {Number: 2, ETag: "bad"}}); !errors.Is(err, ErrInvalidPart) {
+		t.Errorf("bad etag: expected ErrInvalidPart, got %v", err)
+	}
+
+	obj, err := l.CompleteMultipart(ctx, "big.bin", id, []Part{p1, p2})
+	if err != nil || obj.Size != 11 {
+		t.Fatalf("Complete %+v, %v", obj, err)
+	}
+	if s := readAll(t, l, "big.bin", 0, -1); s != "hello world" {
+		t.Errorf("content %q", s)
+	}
+	if _, err = l.UploadPart(ctx, "big.bin", id, 3, strings.NewReader("x"), 1); err != ErrNoSuchUpload {
+		t.Errorf("after complete: expected ErrNoSuchUpload, got %v", err)
+	}
+
+	// 取消后分片被删除
+	id, _ = l.CreateMultipart(ctx, "aborted")
+	if _, err = l.UploadPart(ctx, "aborted", id, 1, strings.NewReader("x"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.AbortMultipart(ctx, "aborted", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.CompleteMultipart(ctx, "aborted", id, nil); err != ErrNoSuchUpload {
+		t.Errorf("after abort: expected ErrNoSuchUpload, got %v", err)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Join(l.root, localReserved, "uploads")); len(entries) != 0 {
+		t.Errorf("uploads left: %d", len(entries))
+	}
+}
+
+func TestPutMultipart(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+	data := strings.Repeat("0123456789", 10)
+	for _, size := range []int{0, 1, 30, 99, 100} {
+		obj, err := PutMultipart(ctx, l, "multi", strings.NewReader(data[:size]), 10)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if obj.Size != int64(size) || readAll(t, l, "multi", 0, -1) != data[:size] {
+			t.Errorf("size %d: object %+v", size, obj)
+		}
+	}
+	// 读取失败时取消上传
+	_, err := PutMultipart(ctx, l, "failed", &failingReader{data: []byte(data[:25])}, 10)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Join(l.root, localReserved, "uploads")); len(entries) != 0 {
+		t.Errorf("uploads left: %d", len(entries))
+	}
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+	if _, err := l.SignedURL(ctx, "a.txt", "GET", time.Minute); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported without secret, got %v", err)
+	}
+
+	l = newTestLocal(t, WithSigning("http://files.example.com/download/", []byte("secret")))
+	signed, err := l.SignedURL(ctx, "dir/a b.txt", "GET", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil || u.Host != "files.example.com" || u.Path != "/download/dir/a b.txt" {
+		t.Fatalf("signed url %s, %v", signed, err)
+	}
+
+	verify := func(method, rawURL, key string) error {
+		return l.Verify(httptest.NewRequest(method, rawURL, nil), key)
+	}
+	if err = verify("GET", signed, "dir/a b.txt"); err != nil {
+		t.Errorf("GET: %v", err)
+	}
+	if err = verify("HEAD", signed, "dir/a b.txt"); err != nil {
+		t.Errorf("HEAD: %v", err)
+	}
+	if err = verify("PUT", signed, "dir/a b.txt"); err != ErrInvalidSignature {
+		t.Errorf("PUT with GET signature: %v", err)
+	}
+	if err = verify("GET", signed, "dir/other.txt"); err != ErrInvalidSignature {
+		t.Errorf("other key: %v", err)
+	}
+	tampered := strings.Replace(signed, "expires=", "expires=9", 1)
+	if err = verify("GET", tampered, "dir/a b.txt"); err != ErrInvalidSignature {
+		t.Errorf("tampered expires: %v", err)
+	}
+	expired, _ := l.SignedURL(ctx, "dir/a b.txt", "GET", -time.Minute)
+	if err = verify("GET", expired, "dir/a b.txt"); err != ErrInvalidSignature {
+		t.Errorf("expired: %v", err)
+	}
+}
+
+// failingReader 读完 data 后返回错误
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("read failed")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
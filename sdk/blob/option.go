@@ -0,0 +1,189 @@
+package blob
+
+import (
+	"net/http"
+	"time"
+)
+
+type (
+	PutOption  func(*putOptions)
+	putOptions struct {
+		contentType string
+	}
+
+	LocalOption  func(*localOptions)
+	localOptions struct {
+		baseURL string
+		secret  []byte
+	}
+
+	S3Option  func(*s3Options)
+	s3Options struct {
+		endpoint     string
+		region       string
+		accessKey    string
+		secretKey    string
+		sessionToken string
+		pathStyle    bool
+		partSize     int64
+		httpClient   *http.Client
+		now          func() time.Time
+	}
+
+	HandlerOption  func(*handlerOptions)
+	handlerOptions struct {
+		maxSize   int64
+		types     []string
+		field     string
+		keyFunc   func(r *http.Request, filename, contentType string) string
+		authorize func(r *http.Request, key string) error
+	}
+)
+
+func evaluatePutOptions(opts []PutOption) *putOptions {
+	optCopy := &putOptions{}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+func evaluateLocalOptions(opts []LocalOption) *localOptions {
+	optCopy := &localOptions{}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+func evaluateS3Options(opts []S3Option) *s3Options {
+	optCopy := &s3Options{
+		endpoint:   "https://s3.amazonaws.com",
+		region:     "us-east-1",
+		partSize:   8 << 20,
+		httpClient: http.DefaultClient,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	// S3 除最后一个外的分片不能小于 5MB
+	if optCopy.partSize < 5<<20 {
+		optCopy.partSize = 5 << 20
+	}
+
+	return optCopy
+}
+
+func evaluateHandlerOptions(opts []HandlerOption) *handlerOptions {
+	optCopy := &handlerOptions{
+		maxSize: 2 << 20,
+		field:   "file",
+		keyFunc: defaultKey,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+// WithContentType sets the content type of the object, default detected from the key extension.
+func WithContentType(contentType string) PutOption {
+	return func(opts *putOptions) {
+		opts.contentType = contentType
+	}
+}
+
+// WithSigning enables Local.SignedURL, the urls are baseURL + "/" + key and are
+// verified by Local.Verify with secret.
+func WithSigning(baseURL string, secret []byte) LocalOption {
+	return func(opts *localOptions) {
+		opts.baseURL = baseURL
+		opts.secret = secret
+	}
+}
+
+// WithEndpoint sets the S3 endpoint, default https://s3.amazonaws.com.
+func WithEndpoint(endpoint string) S3Option {
+	return func(opts *s3Options) {
+		opts.endpoint = endpoint
+	}
+}
+
+// WithRegion sets the region used in signatures, default us-east-1.
+func WithRegion(region string) S3Option {
+	return func(opts *s3Options) {
+		opts.region = region
+	}
+}
+
+// WithCredentials sets the access key, secret key and the optional session token.
+func WithCredentials(accessKey, secretKey, sessionToken string) S3Option {
+	return func(opts *s3Options) {
+		opts.accessKey = accessKey
+		opts.secretKey = secretKey
+		opts.sessionToken = sessionToken
+	}
+}
+
+// WithPathStyle sets whether the bucket is put in the path instead of the host name,
+// MinIO and most self-hosted services need it, default false.
+func WithPathStyle(pathStyle bool) S3Option {
+	return func(opts *s3Options) {
+		opts.pathStyle = pathStyle
+	}
+}
+
+// WithPartSize sets the part size used by Put for large objects, min and default 5MB and 8MB.
+func WithPartSize(size int64) S3Option {
+	return func(opts *s3Options) {
+		opts.partSize = size
+	}
+}
+
+// WithHTTPClient sets the http client, default http.DefaultClient.
+func WithHTTPClient(client *http.Client) S3Option {
+	return func(opts *s3Options) {
+		opts.httpClient = client
+	}
+}
+
+// WithMaxSize sets the max upload size in bytes, default 2MB.
+func WithMaxSize(size int64) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.maxSize = size
+	}
+}
+
+// WithAllowedTypes sets the content types accepted by UploadHandler, detected from the content,
+// default all types.
+func WithAllowedTypes(types ...string) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.types = types
+	}
+}
+
+// WithFormField sets the multipart form field of the file, default "file".
+func WithFormField(field string) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.field = field
+	}
+}
+
+// WithKeyFunc sets how UploadHandler names objects, default a random uuid with the extension of the content type.
+func WithKeyFunc(fn func(r *http.Request, filename, contentType string) string) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.keyFunc = fn
+	}
+}
+
+// WithAuthorizer sets the function checking every request of the handler, a non-nil error responds 403.
+// Local.Verify can be used to accept only signed urls.
+func WithAuthorizer(fn func(r *http.Request, key string) error) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.authorize = fn
+	}
+}
@@ -0,0 +1,219 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// OSS 阿里云对象存储。SDK 不支持 context，只在请求前检查 ctx 是否已经结束
+type OSS struct {
+	bucket *oss.Bucket
+}
+
+var _ BlobStore = (*OSS)(nil)
+
+func NewOSS(endpoint, accessKeyID, accessKeySecret, bucket string, opts ...oss.ClientOption) (*OSS, error) {
+	client, err := oss.New(endpoint, accessKeyID, accessKeySecret, opts...)
+	if err != nil {
+		return nil, err
+	}
+	b, err := client.Bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &OSS{bucket: b}, nil
+}
+
+func (o *OSS) Put(ctx context.Context, key string, r io.Reader, opts ...PutOption) (*Object, error) {
+	if err := check(ctx, key); err != nil {
+		return nil, err
+	}
+	contentType := ossContentType(key, opts)
+	if err := o.bucket.PutObject(key, r, oss.ContentType(contentType)); err != nil {
+		return nil, ossError(err)
+	}
+	return o.Stat(ctx, key)
+}
+
+func (o *OSS) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	return o.GetRange(ctx, key, 0, -1)
+}
+
+func (o *OSS) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *Object, error) {
+	if err := check(ctx, key); err != nil {
+		return nil, nil, err
+	}
+	if offset < 0 || length == 0 {
+		return nil, nil, ErrInvalidRange
+	}
+	// 先读取元信息，OSS 对超出范围的 Range 返回整个对象而不是错误
+	obj, err := o.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset > 0 && offset >= obj.Size {
+		return nil, nil, ErrInvalidRange
+	}
+	var options []oss.Option
+	if offset > 0 || length > 0 {
+		end := ""
+		if length > 0 {
+			end = strconv.FormatInt(offset+length-1, 10)
+		}
+		options = append(options, oss.NormalizedRange(fmt.Sprintf("%d-%s", offset, end)))
+	}
+	body, err := o.bucket.GetObject(key, options...)
+	if err != nil {
+		return nil, nil, ossError(err)
+	}
+	return body, obj, nil
+}
+
+func (o *OSS) Stat(ctx context.Context, key string) (*Object, error) {
+	if err := check(ctx, key); err != nil {
+		return nil, err
+	}
+	header, err := o.bucket.GetObjectDetailedMeta(key)
+	if err != nil {
+		return nil, ossError(err)
+	}
+	obj := &Object{
+		Key:         key,
+		ContentType: header.Get("Content-Type"),
+		ETag:        strings.Trim(header.Get("ETag"), `"`),
+	}
+	obj.Size, _ = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	obj.LastModified, _ = http.ParseTime(header.Get("Last-Modified"))
+	return obj, nil
+}
+
+func (o *OSS) Delete(ctx context.Context, key string) error {
+	if err := check(ctx, key); err != nil {
+		return err
+	}
+	return ossError(o.bucket.DeleteObject(key))
+}
+
+func (o *OSS) List(ctx context.Context, prefix string) ([]*Object, error) {
+	var objects []*Object
+	marker := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := o.bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000))
+		if err != nil {
+			return nil, ossError(err)
+		}
+		for _, p := range result.Objects {
+			objects = append(objects, &Object{
+				Key:          p.Key,
+				Size:         p.Size,
+				ContentType:  typeByKey(p.Key),
+				ETag:         strings.Trim(p.ETag, `"`),
+				LastModified: p.LastModified,
+			})
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextMarker
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (o *OSS) SignedURL(ctx context.Context, key, method string, expires time.Duration) (string, error) {
+	if err := check(ctx, key); err != nil {
+		return "", err
+	}
+	signed, err := o.bucket.SignURL(key, oss.HTTPMethod(strings.ToUpper(method)), int64(expires/time.Second))
+	return signed, ossError(err)
+}
+
+func (o *OSS) CreateMultipart(ctx context.Context, key string, opts ...PutOption) (string, error) {
+	if err := check(ctx, key); err != nil {
+		return "", err
+	}
+	imur, err := o.bucket.InitiateMultipartUpload(key, oss.ContentType(ossContentType(key, opts)))
+	if err != nil {
+		return "", ossError(err)
+	}
+	return imur.UploadID, nil
+}
+
+func (o *OSS) UploadPart(ctx context.Context, key, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	if err := check(ctx, key); err != nil {
+		return Part{}, err
+	}
+	part, err := o.bucket.UploadPart(o.imur(key, uploadID), r, size, number)
+	if err != nil {
+		return Part{}, ossError(err)
+	}
+	return Part{Number: part.PartNumber, ETag: strings.Trim(part.ETag, `"`), Size: size}, nil
+}
+
+func (o *OSS) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) (*Object, error) {
+	if err := check(ctx, key); err != nil {
+		return nil, err
+	}
+	uploaded := make([]oss.UploadPart, len(parts))
+	for i, p := range parts {
+		uploaded[i] = oss.UploadPart{PartNumber: p.Number, ETag: `"` + p.ETag + `"`}
+	}
+	if _, err := o.bucket.CompleteMultipartUpload(o.imur(key, uploadID), uploaded); err != nil {
+		return nil, ossError(err)
+	}
+	return o.Stat(ctx, key)
+}
+
+func (o *OSS) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	if err := check(ctx, key); err != nil {
+		return err
+	}
+	return ossError(o.bucket.AbortMultipartUpload(o.imur(key, uploadID)))
+}
+
+func (o *OSS) imur(key, uploadID string) oss.InitiateMultipartUploadResult {
+	return oss.InitiateMultipartUploadResult{Bucket: o.bucket.BucketName, Key: key, UploadID: uploadID}
+}
+
+func check(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	return ctx.Err()
+}
+
+func ossContentType(key string, opts []PutOption) string {
+	if o := evaluatePutOptions(opts); o.contentType != "" {
+		return o.contentType
+	}
+	return typeByKey(key)
+}
+
+// ossError 把 OSS 的错误码转换为包内的错误，保留原错误信息
+func ossError(err error) error {
+	var e oss.ServiceError
+	if !errors.As(err, &e) {
+		return err
+	}
+	switch {
+	case e.Code == "NoSuchKey" || (e.Code == "" && e.StatusCode == http.StatusNotFound):
+		return fmt.Errorf("%w: %s", ErrNotFound, e.Message)
+	case e.Code == "NoSuchUpload":
+		return fmt.Errorf("%w: %s", ErrNoSuchUpload, e.Message)
+	case e.Code == "InvalidPart" || e.Code == "InvalidPartOrder" || e.Code == "EntityTooSmall":
+		return fmt.Errorf("%w: %s", ErrInvalidPart, e.Message)
+	}
+	return err
+}
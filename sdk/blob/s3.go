@@ -0,0 +1,509 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	amzDateFormat    = "20060102T150405Z"
+)
+
+// S3Error S3 返回的错误，NoSuchKey 等错误码可以用 errors.Is 和 ErrNotFound 等比较
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestID  string `xml:"RequestId"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("blob: s3 status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *S3Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == "NoSuchKey" || (e.Code == "" && e.StatusCode == http.StatusNotFound)
+	case ErrNoSuchUpload:
+		return e.Code == "NoSuchUpload"
+	case ErrInvalidRange:
+		return e.Code == "InvalidRange" || e.StatusCode == http.StatusRequestedRangeNotSatisfiable
+	case ErrInvalidPart:
+		return e.Code == "InvalidPart" || e.Code == "InvalidPartOrder" || e.Code == "EntityTooSmall"
+	}
+	return false
+}
+
+// S3 兼容 S3 协议的对象存储，使用 AWS Signature Version 4 签名
+type S3 struct {
+	bucket   string
+	opts     *s3Options
+	endpoint *url.URL
+}
+
+var _ BlobStore = (*S3)(nil)
+
+func NewS3(bucket string, opts ...S3Option) (*S3, error) {
+	o := evaluateS3Options(opts)
+	endpoint, err := url.Parse(o.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("blob: invalid s3 endpoint %q", o.endpoint)
+	}
+	return &S3{bucket: bucket, opts: o, endpoint: endpoint}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, opts ...PutOption) (*Object, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	// 不超过一个分片时直接上传，否则分片上传
+	buf := make([]byte, s.opts.partSize)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if int64(n) == s.opts.partSize {
+		uploadID, err := s.CreateMultipart(ctx, key, opts...)
+		if err != nil {
+			return nil, err
+		}
+		obj, err := uploadParts(ctx, s, key, uploadID, r, s.opts.partSize, buf)
+		if err != nil {
+			s.AbortMultipart(context.Background(), key, uploadID)
+			return nil, err
+		}
+		return obj, nil
+	}
+
+	data := buf[:n]
+	sum := sha256.Sum256(data)
+	contentType := s.contentType(key, opts)
+	header := http.Header{"Content-Type": {contentType}}
+	resp, err := s.do(ctx, http.MethodPut, key, nil, header, bytes.NewReader(data), int64(n), hex.EncodeToString(sum[:]))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return &Object{
+		Key:          key,
+		Size:         int64(n),
+		ContentType:  contentType,
+		ETag:         strings.Trim(resp.Header.Get("ETag"), `"`),
+		LastModified: s.opts.now(),
+	}, nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
+
+func (s *S3) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *Object, error) {
+	if !ValidKey(key) {
+		return nil, nil, ErrInvalidKey
+	}
+	if offset < 0 || length == 0 {
+		return nil, nil, ErrInvalidRange
+	}
+	header := http.Header{}
+	if offset > 0 || length > 0 {
+		rng := fmt.Sprintf("bytes=%d-", offset)
+		if length > 0 {
+			rng += strconv.FormatInt(offset+length-1, 10)
+		}
+		header.Set("Range", rng)
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, header, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj := objectFromHeader(key, resp.Header)
+	obj.Size = resp.ContentLength
+	// 范围请求时对象大小在 Content-Range 的 / 之后
+	if cr := resp.Header.Get("Content-Range"); cr != "" {
+		if i := strings.LastIndex(cr, "/"); i >= 0 {
+			obj.Size, _ = strconv.ParseInt(cr[i+1:], 10, 64)
+		}
+	}
+	return resp.Body, obj, nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*Object, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	obj := objectFromHeader(key, resp.Header)
+	obj.Size = resp.ContentLength
+	return obj, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]*Object, error) {
+	var objects []*Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		var result struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				LastModified time.Time `xml:"LastModified"`
+				ETag         string    `xml:"ETag"`
+				Size         int64     `xml:"Size"`
+			} `xml:"Contents"`
+		}
+		if err := s.doXML(ctx, http.MethodGet, "", query, nil, &result); err != nil {
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			objects = append(objects, &Object{
+				Key:          c.Key,
+				Size:         c.Size,
+				ContentType:  typeByKey(c.Key),
+				ETag:         strings.Trim(c.ETag, `"`),
+				LastModified: c.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// SignedURL 生成预签名地址，expires 最长 7 天
+func (s *S3) SignedURL(ctx context.Context, key, method string, expires time.Duration) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	now := s.opts.now().UTC()
+	u := s.url(key)
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.opts.accessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(amzDateFormat)},
+		"X-Amz-Expires":       {strconv.FormatInt(int64(expires/time.Second), 10)},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if s.opts.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.opts.sessionToken)
+	}
+	header := http.Header{"Host": {u.Host}}
+	signature := s.signature(strings.ToUpper(method), u, query, header, unsignedPayload, now)
+	query.Set("X-Amz-Signature", signature)
+	u.RawQuery = canonicalQuery(query)
+	return u.String(), nil
+}
+
+func (s *S3) CreateMultipart(ctx context.Context, key string, opts ...PutOption) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	header := http.Header{"Content-Type": {s.contentType(key, opts)}}
+	if err := s.doXML(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, header, &result); err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+func (s *S3) UploadPart(ctx context.Context, key, uploadID string, number int, r io.Reader, size int64) (Part, error) {
+	if !ValidKey(key) {
+		return Part{}, ErrInvalidKey
+	}
+	if number < 1 || size < 0 {
+		return Part{}, ErrInvalidPart
+	}
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	resp, err := s.do(ctx, http.MethodPut, key, query, nil, r, size, unsignedPayload)
+	if err != nil {
+		return Part{}, err
+	}
+	resp.Body.Close()
+	return Part{Number: number, ETag: strings.Trim(resp.Header.Get("ETag"), `"`), Size: size}, nil
+}
+
+func (s *S3) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) (*Object, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	body := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{}
+	for _, p := range parts {
+		body.Parts = append(body.Parts, part{PartNumber: p.Number, ETag: `"` + p.ETag + `"`})
+	}
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, bytes.NewReader(data), int64(len(data)), hex.EncodeToString(sum[:]))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// 合并过程中出错时状态码仍然是 200，错误在响应体中
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(respBody, []byte("<Error>")) {
+		return nil, parseS3Error(resp.StatusCode, respBody)
+	}
+	return s.Stat(ctx, key)
+}
+
+func (s *S3) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3) contentType(key string, opts []PutOption) string {
+	if o := evaluatePutOptions(opts); o.contentType != "" {
+		return o.contentType
+	}
+	return typeByKey(key)
+}
+
+// url 对象的地址，key 为空时为 bucket 的地址
+func (s *S3) url(key string) *url.URL {
+	u := *s.endpoint
+	p := "/" + key
+	if s.opts.pathStyle {
+		p = "/" + s.bucket + p
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.Path = p
+	u.RawPath = awsEscape(p, false)
+	return &u
+}
+
+// do 签名并发送请求，状态码不是 2xx 时关闭响应并返回 *S3Error
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	u := s.url(key)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.URL.RawPath = u.RawPath
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req, payloadHash, s.opts.now().UTC())
+
+	resp, err := s.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, parseS3Error(resp.StatusCode, data)
+	}
+	return resp, nil
+}
+
+func (s *S3) doXML(ctx context.Context, method, key string, query url.Values, header http.Header, v interface{}) error {
+	resp, err := s.do(ctx, method, key, query, header, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+// sign 在请求头中添加 Authorization，签名 host、Content-Type、Range 和 x-amz-* 头
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.opts.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.opts.sessionToken)
+	}
+	header := http.Header{"Host": {req.URL.Host}}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-type" || lk == "range" || lk == "content-md5" {
+			header[k] = v
+		}
+	}
+	signature := s.signature(req.Method, req.URL, req.URL.Query(), header, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.accessKey, s.scope(now), signedHeaders(header), signature))
+}
+
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.opts.region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(method string, u *url.URL, query url.Values, header http.Header, payloadHash string, now time.Time) string {
+	var headers strings.Builder
+	names := headerNames(header)
+	for _, name := range names {
+		values := header[http.CanonicalHeaderKey(name)]
+		if name == "host" {
+			values = header["Host"]
+		}
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers.WriteString(name + ":" + strings.Join(trimmed, ",") + "\n")
+	}
+	canonical := strings.Join([]string{
+		method,
+		awsEscape(u.Path, false),
+		canonicalQuery(query),
+		headers.String(),
+		strings.Join(names, ";"),
+		payloadHash,
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(amzDateFormat),
+		s.scope(now),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.opts.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.opts.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, data)
+	return mac.Sum(nil)
+}
+
+func headerNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for k := range header {
+		names = append(names, strings.ToLower(k))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func signedHeaders(header http.Header) string {
+	return strings.Join(headerNames(header), ";")
+}
+
+// canonicalQuery 按 key 排序并按 AWS 的规则转义
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape 除 A-Za-z0-9-._~ 外都转义为 %XX，encodeSlash 为 false 时保留 /
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func parseS3Error(status int, body []byte) error {
+	e := &S3Error{StatusCode: status}
+	xml.Unmarshal(body, e)
+	return e
+}
+
+func objectFromHeader(key string, header http.Header) *Object {
+	obj := &Object{
+		Key:         key,
+		ContentType: header.Get("Content-Type"),
+		ETag:        strings.Trim(header.Get("ETag"), `"`),
+	}
+	obj.LastModified, _ = http.ParseTime(header.Get("Last-Modified"))
+	return obj
+}
+
+func typeByKey(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
@@ -1,104 +1,93 @@
+/**
+ * ElasticSearch 工具集
+ *   1. NewClient 通过 ClientOption 配置地址和认证，请求经过 Transport 记录 OpenTracing span
+ *   2. Repository[T] 按索引名模板读写文档，模板中的时间按文档时间格式化，如 logs-{2006.01.02}，见 repository.go
+ *   3. BulkIndexer 后台批量写入，按数量、大小和时间刷新，失败重试，队列满时阻塞调用方，见 indexer.go
+ *   4. Field[T]、Bool 构建带类型的 term/range/bool 查询，见 query.go
+ */
 package elastic
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"time"
 
 	"github.com/olivere/elastic"
 )
 
-var client *esClient
+// ES 6 每个索引只有一个类型
+const docType = "_doc"
 
-type esClient struct {
+var ErrNotFound = errors.New("elastic: document not found")
+
+// Client extend client and have itself func
+type Client struct {
 	*elastic.Client
-	ctx context.Context
 }
 
-const host = "http://127.0.0.1:9200"
-
-// build the elasticSearch the client
-func NewElasticSearchClient() error {
+// NewClient 创建客户端并 Ping 第一个节点，连接失败时返回错误
+func NewClient(opts ...ClientOption) (*Client, error) {
+	o := evaluateClientOptions(opts)
 	errLog := log.New(os.Stdout, "Elastic", log.LstdFlags)
 
-	tr := NewTransport(WithDebug(false))
-	httpCli := &http.Client{
-		Transport: tr,
-	}
-	esCli, err := elastic.NewClient(
+	options := []elastic.ClientOptionFunc{
 		elastic.SetErrorLog(errLog),
-		elastic.SetURL(host),
-		elastic.SetBasicAuth("elastic", "123456"),
-		elastic.SetHttpClient(httpCli),
+		elastic.SetURL(o.urls...),
+		elastic.SetHttpClient(o.httpClient),
+		elastic.SetSniff(o.sniff),
 		elastic.SetHealthcheck(false),
-	)
-	if err != nil {
-		return err
 	}
-	client = &esClient{Client: esCli, ctx: context.Background()}
-	result, code, err := client.Ping(host).Do(context.Background())
-	if err != nil {
-		return err
+	if o.username != "" {
+		options = append(options, elastic.SetBasicAuth(o.username, o.password))
 	}
-	log.Printf("Elasticsearch returned with code: %d and version: %s", code, result.Version.Number)
-
-	version, err := client.ElasticsearchVersion(host)
+	esCli, err := elastic.NewClient(options...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	log.Printf("Elasticsearch version :%s", version)
-
-	return nil
-}
-
-// init the elastic search
-func init() {
-	err := NewElasticSearchClient()
-	if err != nil {
-		fmt.Println(err.Error())
+	if _, _, err = esCli.Ping(o.urls[0]).Do(context.Background()); err != nil {
+		esCli.Stop()
+		return nil, fmt.Errorf("elastic: connect %s: %w", o.urls[0], err)
 	}
+	return &Client{Client: esCli}, nil
 }
 
 // insert a document to the index
-func (client *esClient) Insert(index string, value interface{}) (*elastic.IndexResponse, error) {
-	// access by the http://localhost:9700/pibigstar/employee/id
-	response, err := client.Index().
+func (client *Client) Insert(ctx context.Context, index string, value interface{}) (*elastic.IndexResponse, error) {
+	// access by the http://localhost:9200/index/_doc/id
+	return client.Index().
 		Index(index).
+		Type(docType).
 		BodyJson(value).
-		Do(client.ctx)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+		Do(ctx)
 }
 
-// get the document by id
-func (client *esClient) GetById(index string, id string) ([]byte, error) {
-	// id 必须存在，不然会报错，如果想查找请用search
-	result, err := client.Get().Index(index).Id(id).Do(client.ctx)
-	if err != nil && !result.Found {
+// get the document by id, return ErrNotFound if the document does not exist
+func (client *Client) GetById(ctx context.Context, index string, id string) ([]byte, error) {
+	result, err := client.Get().Index(index).Type(docType).Id(id).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
 		return nil, err
 	}
-	if result.Found {
-		bytes, _ := result.Source.MarshalJSON()
-		return bytes, nil
+	if !result.Found || result.Source == nil {
+		return nil, ErrNotFound
 	}
-	return nil, nil
+	return *result.Source, nil
 }
 
 // search the result by query strings
-func (client *esClient) Query(index, keyword string) (*elastic.SearchResult, error) {
+func (client *Client) Query(ctx context.Context, index, keyword string) (*elastic.SearchResult, error) {
 	// 根据名字查询
 	query := elastic.NewQueryStringQuery(keyword)
-	result, err := client.Search().Index(index).Query(query).Do(client.ctx)
-	return result, err
+	return client.Search().Index(index).Query(query).Do(ctx)
 }
 
 // Aggregate query
-func (client *esClient) AggQuery(index, keyword string) (*elastic.SearchResult, error) {
+func (client *Client) AggQuery(ctx context.Context, index, keyword string) (*elastic.SearchResult, error) {
 	agg := elastic.NewDateHistogramAggregation().
 		Field("@timestamp").
 		TimeZone("Asia/Shanghai").
@@ -115,7 +104,7 @@ func (client *esClient) AggQuery(index, keyword string) (*elastic.SearchResult,
 			Type("best_fields").
 			Lenient(true))
 
-	result, err := client.Search().
+	return client.Search().
 		Index(index).
 		Query(boolQuery).
 		Timeout("30000ms").
@@ -124,72 +113,60 @@ func (client *esClient) AggQuery(index, keyword string) (*elastic.SearchResult,
 		Aggregation("aggs", agg).
 		Version(true).
 		StoredFields("*").
-		Do(client.ctx)
-
-	return result, err
+		Do(ctx)
 }
 
 // delete the document by id
-func (client *esClient) DeleteById(index, id string) (*elastic.DeleteResponse, error) {
-	response, err := client.Delete().Index(index).Id(id).Do(client.ctx)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+func (client *Client) DeleteById(ctx context.Context, index, id string) (*elastic.DeleteResponse, error) {
+	return client.Delete().Index(index).Type(docType).Id(id).Do(ctx)
 }
 
 // update the document by id
 // values : map[string]interface{}{"age": 12}
-func (client *esClient) UpdateById(index, id string, values map[string]interface{}) (*elastic.UpdateResponse, error) {
-	response, err := client.Update().
+func (client *Client) UpdateById(ctx context.Context, index, id string, values map[string]interface{}) (*elastic.UpdateResponse, error) {
+	return client.Update().
 		Index(index).
+		Type(docType).
 		Id(id).
-		Doc(values).Do(client.ctx)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+		Doc(values).Do(ctx)
 }
 
-// 批量执行操作
-func (client *esClient) MUpdate(index, id string, values map[string]interface{}) (*elastic.BulkResponse, error) {
-	response, err := client.Bulk().
-		Add(elastic.NewBulkUpdateRequest().Index(index).Id(id).Doc(values)).
-		Add(elastic.NewBulkDeleteRequest().Index(index).Id(id)).
-		Do(client.ctx)
+// 批量更新，docs 的 key 为文档 id，有文档更新失败时同时返回响应和错误
+func (client *Client) MUpdate(ctx context.Context, index string, docs map[string]map[string]interface{}) (*elastic.BulkResponse, error) {
+	bulk := client.Bulk()
+	for id, values := range docs {
+		bulk.Add(elastic.NewBulkUpdateRequest().Index(index).Type(docType).Id(id).Doc(values))
+	}
+	if bulk.NumberOfActions() == 0 {
+		return &elastic.BulkResponse{}, nil
+	}
+	response, err := bulk.Do(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if failed := response.Failed(); len(failed) > 0 {
+		return response, fmt.Errorf("elastic: %d of %d updates failed, first: %w", len(failed), len(docs), newBulkError(nil, failed[0]))
+	}
 	return response, nil
 }
 
 // 批量获取
-func (client *esClient) MGet(index string, ids []string) (*elastic.MgetResponse, error) {
+func (client *Client) MGet(ctx context.Context, index string, ids []string) (*elastic.MgetResponse, error) {
 	var getItems []*elastic.MultiGetItem
 	for _, id := range ids {
-		getItems = append(getItems, elastic.NewMultiGetItem().Index(index).Id(id))
+		getItems = append(getItems, elastic.NewMultiGetItem().Index(index).Type(docType).Id(id))
 	}
 
-	response, err := client.Mget().Add(getItems...).
-		Do(client.ctx)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return client.Mget().Add(getItems...).Do(ctx)
 }
 
 // 批量搜索
-func (client *esClient) MSearch(index string, ids []string) (*elastic.MultiSearchResult, error) {
+func (client *Client) MSearch(ctx context.Context, index string, ids []string) (*elastic.MultiSearchResult, error) {
 	var searchRequests []*elastic.SearchRequest
 	for _, id := range ids {
 		searchRequests = append(searchRequests,
 			elastic.NewSearchRequest().Index(index).Query(
 				elastic.NewBoolQuery().Must(elastic.NewTermQuery("id", id))))
 	}
-	response, err := client.MultiSearch().Add(searchRequests...).
-		Do(client.ctx)
-	if err != nil {
-		return nil, err
-	}
-	return response, nil
+	return client.MultiSearch().Add(searchRequests...).Do(ctx)
 }
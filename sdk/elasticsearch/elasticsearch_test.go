@@ -1,8 +1,8 @@
 package elastic
 
 import (
+	"context"
 	"encoding/json"
-	"os"
 	"testing"
 )
 
@@ -12,22 +12,75 @@ type User struct {
 }
 
 func TestElasticSearch(t *testing.T) {
-	hostname, _ := os.Hostname()
-	if hostname == "pibigstar" {
-		user := &User{Name: "pibigstar", Age: 18}
+	ctx := context.Background()
+	es, client := newFakeES(t)
+	user := &User{Name: "pibigstar", Age: 18}
 
-		response, err := client.Insert("test", user)
-		if err != nil {
-			t.Error(err)
+	response, err := client.Insert(ctx, "test", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, err := client.GetById(ctx, "test", response.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := new(User)
+	if err = json.Unmarshal(bytes, result); err != nil || *result != *user {
+		t.Errorf("GetById %+v, %v", result, err)
+	}
+	// 文档不存在时返回错误而不是 panic
+	if _, err = client.GetById(ctx, "test", "missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err = client.UpdateById(ctx, "test", response.Id, map[string]interface{}{"age": 19}); err != nil {
+		t.Fatal(err)
+	}
+	if age := es.doc("test", response.Id)["age"]; age != float64(19) {
+		t.Errorf("age after update %v", age)
+	}
+
+	if _, err = client.DeleteById(ctx, "test", response.Id); err != nil {
+		t.Fatal(err)
+	}
+	if es.count("test") != 0 {
+		t.Errorf("count after delete %d", es.count("test"))
+	}
+}
+
+func TestMUpdate(t *testing.T) {
+	ctx := context.Background()
+	es, client := newFakeES(t)
+	for _, id := range []string{"1", "2"} {
+		if _, err := client.Index().Index("users").Type(docType).Id(id).BodyJson(User{Name: id}).Do(ctx); err != nil {
+			t.Fatal(err)
 		}
-		t.Logf("%+v", response)
+	}
 
-		bytes, err := client.GetById("test", response.Id)
-		if err != nil {
-			t.Error(err)
+	_, err := client.MUpdate(ctx, "users", map[string]map[string]interface{}{
+		"1": {"age": 1},
+		"2": {"age": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 更新后文档仍然存在
+	for id, age := range map[string]float64{"1": 1, "2": 2} {
+		doc := es.doc("users", id)
+		if doc == nil || doc["name"] != id || doc["age"] != age {
+			t.Errorf("doc %s after MUpdate %v", id, doc)
 		}
-		result := new(User)
-		json.Unmarshal(bytes, result)
-		t.Logf("%+v", result)
+	}
+
+	response, err := client.MUpdate(ctx, "users", map[string]map[string]interface{}{
+		"1":       {"age": 10},
+		"missing": {"age": 0},
+	})
+	if err == nil || response == nil || len(response.Failed()) != 1 {
+		t.Errorf("expected one failed update, got %v", err)
+	}
+	if age := es.doc("users", "1")["age"]; age != float64(10) {
+		t.Errorf("age %v", age)
 	}
 }
@@ -0,0 +1,385 @@
+package elastic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeES 内存中的 ES REST API，只实现测试用到的接口和查询
+type fakeES struct {
+	mu        sync.Mutex
+	indices   map[string]map[string]map[string]interface{}
+	templates map[string]map[string]interface{}
+	nextID    int
+	bulks     int
+	// 返回非 0 时整个 bulk 请求以该状态码失败
+	failBulk func(n int) int
+	// 返回非 0 时该文档以该状态码失败
+	rejectItem func(action, index, id string) int
+}
+
+func newFakeES(t *testing.T) (*fakeES, *Client) {
+	t.Helper()
+	es := &fakeES{
+		indices:   make(map[string]map[string]map[string]interface{}),
+		templates: make(map[string]map[string]interface{}),
+	}
+	srv := httptest.NewServer(es)
+	t.Cleanup(srv.Close)
+	client, err := NewClient(WithURLs(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Stop)
+	return es, client
+}
+
+func (es *fakeES) doc(index, id string) map[string]interface{} {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.indices[index][id]
+}
+
+func (es *fakeES) count(index string) int {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return len(es.indices[index])
+}
+
+func (es *fakeES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/":
+		reply(w, 200, map[string]interface{}{"version": map[string]interface{}{"number": "6.8.0"}, "tagline": "You Know, for Search"})
+	case parts[0] == "_template" && len(parts) == 2 && r.Method == http.MethodPut:
+		var tpl map[string]interface{}
+		json.Unmarshal(body, &tpl)
+		es.templates[parts[1]] = tpl
+		reply(w, 200, map[string]interface{}{"acknowledged": true})
+	case parts[0] == "_bulk":
+		es.bulk(w, body)
+	case len(parts) == 2 && parts[1] == "_search":
+		es.search(w, parts[0], body)
+	case len(parts) == 2 && parts[1] == "_doc" && r.Method == http.MethodPost:
+		es.nextID++
+		es.index(w, parts[0], fmt.Sprintf("auto-%d", es.nextID), body)
+	case len(parts) == 3 && parts[1] == "_doc":
+		index, id := parts[0], parts[2]
+		switch r.Method {
+		case http.MethodPut, http.MethodPost:
+			es.index(w, index, id, body)
+		case http.MethodGet:
+			doc, ok := es.indices[index][id]
+			res := map[string]interface{}{"_index": index, "_type": docType, "_id": id, "found": ok}
+			if !ok {
+				reply(w, 404, res)
+				return
+			}
+			res["_source"] = doc
+			reply(w, 200, res)
+		case http.MethodDelete:
+			status, res := es.delete(index, id)
+			reply(w, status, res)
+		}
+	case len(parts) == 4 && parts[3] == "_update":
+		var update struct {
+			Doc map[string]interface{} `json:"doc"`
+		}
+		json.Unmarshal(body, &update)
+		status, res := es.update(parts[0], parts[2], update.Doc)
+		reply(w, status, res)
+	default:
+		reply(w, 400, errorBody(400, "illegal_argument_exception", "unsupported "+r.Method+" "+r.URL.Path))
+	}
+}
+
+func (es *fakeES) index(w http.ResponseWriter, index, id string, body []byte) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		reply(w, 400, errorBody(400, "mapper_parsing_exception", err.Error()))
+		return
+	}
+	status, res := es.put(index, id, doc)
+	reply(w, status, res)
+}
+
+func (es *fakeES) put(index, id string, doc map[string]interface{}) (int, map[string]interface{}) {
+	if es.indices[index] == nil {
+		es.indices[index] = make(map[string]map[string]interface{})
+	}
+	status, result := 201, "created"
+	if _, ok := es.indices[index][id]; ok {
+		status, result = 200, "updated"
+	}
+	es.indices[index][id] = doc
+	return status, map[string]interface{}{"_index": index, "_type": docType, "_id": id, "result": result, "status": status}
+}
+
+func (es *fakeES) update(index, id string, values map[string]interface{}) (int, map[string]interface{}) {
+	doc, ok := es.indices[index][id]
+	if !ok {
+		res := errorBody(404, "document_missing_exception", "["+docType+"]["+id+"]: document missing")
+		res["_index"], res["_id"] = index, id
+		return 404, res
+	}
+	for k, v := range values {
+		doc[k] = v
+	}
+	return 200, map[string]interface{}{"_index": index, "_type": docType, "_id": id, "result": "updated", "status": 200}
+}
+
+func (es *fakeES) delete(index, id string) (int, map[string]interface{}) {
+	res := map[string]interface{}{"_index": index, "_type": docType, "_id": id, "result": "not_found", "status": 404}
+	if _, ok := es.indices[index][id]; !ok {
+		return 404, res
+	}
+	delete(es.indices[index], id)
+	res["result"], res["status"] = "deleted", 200
+	return 200, res
+}
+
+func (es *fakeES) bulk(w http.ResponseWriter, body []byte) {
+	es.bulks++
+	if es.failBulk != nil {
+		if status := es.failBulk(es.bulks); status != 0 {
+			reply(w, status, errorBody(status, "unavailable", "injected failure"))
+			return
+		}
+	}
+	var items []interface{}
+	hasErrors := false
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	for scanner.Scan() {
+		var line map[string]map[string]interface{}
+		json.Unmarshal(scanner.Bytes(), &line)
+		for action, meta := range line {
+			index, _ := meta["_index"].(string)
+			id, _ := meta["_id"].(string)
+			var source map[string]interface{}
+			if action != "delete" && scanner.Scan() {
+				json.Unmarshal(scanner.Bytes(), &source)
+			}
+			var (
+				status int
+				res    map[string]interface{}
+			)
+			if es.rejectItem != nil {
+				status = es.rejectItem(action, index, id)
+			}
+			switch {
+			case status != 0:
+				res = errorBody(status, "es_rejected_execution_exception", "injected rejection")
+				res["_index"], res["_id"], res["status"] = index, id, status
+			case action == "index" || action == "create":
+				status, res = es.put(index, id, source)
+			case action == "update":
+				values, _ := source["doc"].(map[string]interface{})
+				status, res = es.update(index, id, values)
+				res["status"] = status
+			case action == "delete":
+				status, res = es.delete(index, id)
+			}
+			if status >= 300 {
+				hasErrors = true
+			}
+			items = append(items, map[string]interface{}{action: res})
+		}
+	}
+	reply(w, 200, map[string]interface{}{"took": 1, "errors": hasErrors, "items": items})
+}
+
+func (es *fakeES) search(w http.ResponseWriter, pattern string, body []byte) {
+	var req struct {
+		Query map[string]interface{}              `json:"query"`
+		From  int                                 `json:"from"`
+		Size  *int                                `json:"size"`
+		Sort  []map[string]map[string]interface{} `json:"sort"`
+	}
+	json.Unmarshal(body, &req)
+
+	type hit struct {
+		index, id string
+		doc       map[string]interface{}
+	}
+	var hits []hit
+	for index, docs := range es.indices {
+		if ok, _ := path.Match(pattern, index); !ok {
+			continue
+		}
+		for id, doc := range docs {
+			if req.Query == nil || matches(req.Query, id, doc) {
+				hits = append(hits, hit{index, id, doc})
+			}
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		for _, s := range req.Sort {
+			for field, opts := range s {
+				a, b := hits[i].doc[field], hits[j].doc[field]
+				if compare(a, b) == 0 {
+					continue
+				}
+				if opts["order"] == "desc" {
+					return compare(a, b) > 0
+				}
+				return compare(a, b) < 0
+			}
+		}
+		return hits[i].index+"/"+hits[i].id < hits[j].index+"/"+hits[j].id
+	})
+
+	total := len(hits)
+	size := 10
+	if req.Size != nil {
+		size = *req.Size
+	}
+	if req.From > len(hits) {
+		req.From = len(hits)
+	}
+	hits = hits[req.From:]
+	if size < len(hits) {
+		hits = hits[:size]
+	}
+	results := make([]interface{}, len(hits))
+	for i, h := range hits {
+		results[i] = map[string]interface{}{"_index": h.index, "_type": docType, "_id": h.id, "_source": h.doc}
+	}
+	reply(w, 200, map[string]interface{}{"took": 1, "hits": map[string]interface{}{"total": total, "hits": results}})
+}
+
+// matches 计算 bool/term/terms/range/exists/ids/match_all 查询
+func matches(query map[string]interface{}, id string, doc map[string]interface{}) bool {
+	for kind, v := range query {
+		params, _ := v.(map[string]interface{})
+		switch kind {
+		case "match_all":
+		case "ids":
+			if !contains(params["values"], id) {
+				return false
+			}
+		case "term":
+			for field, value := range params {
+				if compare(doc[field], value) != 0 {
+					return false
+				}
+			}
+		case "terms":
+			for field, values := range params {
+				if !contains(values, doc[field]) {
+					return false
+				}
+			}
+		case "exists":
+			if doc[params["field"].(string)] == nil {
+				return false
+			}
+		case "range":
+			for field, bounds := range params {
+				value, ok := doc[field]
+				if !ok {
+					return false
+				}
+				for op, bound := range bounds.(map[string]interface{}) {
+					c := compare(value, bound)
+					if (op == "gt" && c <= 0) || (op == "gte" && c < 0) || (op == "lt" && c >= 0) || (op == "lte" && c > 0) {
+						return false
+					}
+				}
+			}
+		case "bool":
+			if !matchBool(params, id, doc) {
+				return false
+			}
+		default:
+			panic("fake es: unsupported query " + kind)
+		}
+	}
+	return true
+}
+
+func matchBool(params map[string]interface{}, id string, doc map[string]interface{}) bool {
+	clauses := func(name string) []map[string]interface{} {
+		list, _ := params[name].([]interface{})
+		queries := make([]map[string]interface{}, len(list))
+		for i, q := range list {
+			queries[i] = q.(map[string]interface{})
+		}
+		return queries
+	}
+	for _, q := range append(clauses("must"), clauses("filter")...) {
+		if !matches(q, id, doc) {
+			return false
+		}
+	}
+	for _, q := range clauses("must_not") {
+		if matches(q, id, doc) {
+			return false
+		}
+	}
+	should := clauses("should")
+	min := 0
+	if n, ok := params["minimum_should_match"].(float64); ok {
+		min = int(n)
+	} else if len(should) > 0 && params["must"] == nil && params["filter"] == nil {
+		min = 1
+	}
+	n := 0
+	for _, q := range should {
+		if matches(q, id, doc) {
+			n++
+		}
+	}
+	return n >= min
+}
+
+func contains(list interface{}, v interface{}) bool {
+	values, _ := list.([]interface{})
+	for _, item := range values {
+		if compare(item, v) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compare 比较两个 JSON 值，数字按大小，其他按字符串
+func compare(a, b interface{}) int {
+	fa, aok := a.(float64)
+	fb, bok := b.(float64)
+	if aok && bok {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func errorBody(status int, typ, reason string) map[string]interface{} {
+	return map[string]interface{}{
+		"status": status,
+		"error":  map[string]interface{}{"type": typ, "reason": reason},
+	}
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,291 @@
+package elastic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/olivere/elastic"
+
+	"go-demo/utils/retry"
+)
+
+var ErrIndexerClosed = errors.New("elastic: bulk indexer closed")
+
+// BulkError 重试后仍然失败的 bulk 请求。整个 bulk 请求失败时 Err 不为空，否则为单个文档的失败原因
+type BulkError struct {
+	// MUpdate 和 SaveAll 返回的错误中为 nil
+	Request elastic.BulkableRequest
+	Index   string
+	ID      string
+	Status  int
+	Type    string
+	Reason  string
+	Err     error
+}
+
+func newBulkError(req elastic.BulkableRequest, item *elastic.BulkResponseItem) *BulkError {
+	e := &BulkError{Request: req, Index: item.Index, ID: item.Id, Status: item.Status}
+	if item.Error != nil {
+		e.Type, e.Reason = item.Error.Type, item.Error.Reason
+	}
+	return e
+}
+
+func (e *BulkError) Error() string {
+	if e.Err != nil {
+		return "elastic: bulk request: " + e.Err.Error()
+	}
+	return fmt.Sprintf("elastic: bulk item %s/%s status %d: %s: %s", e.Index, e.ID, e.Status, e.Type, e.Reason)
+}
+
+func (e *BulkError) Unwrap() error {
+	return e.Err
+}
+
+// IndexerStats BulkIndexer 的累计计数
+type IndexerStats struct {
+	Added     int64 // 加入队列的请求
+	Succeeded int64 // 写入成功的请求
+	Failed    int64 // 重试后仍然失败的请求
+	Retried   int64 // 重试的请求，同一个请求重试多次时计多次
+	Flushed   int64 // 发送的 bulk 请求
+}
+
+// BulkIndexer 在后台把请求攒成 bulk 请求发送，数量达到 WithFlushSize、大小达到 WithFlushBytes
+// 或者距离上次发送超过 WithFlushInterval 时发送。整个请求失败或单个文档被拒绝（429、5xx）时退避重试，
+// 其他失败交给 WithBulkErrorHandler。发送期间不读取队列，队列满时 Add 阻塞，调用方随之减速
+type BulkIndexer struct {
+	client *Client
+	opts   *indexerOptions
+	queue  chan elastic.BulkableRequest
+	flushc chan chan error
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	// 只在后台 goroutine 中访问
+	batch []elastic.BulkableRequest
+	bytes int
+
+	stats IndexerStats
+}
+
+func NewBulkIndexer(client *Client, opts ...IndexerOption) *BulkIndexer {
+	o := evaluateIndexerOptions(opts)
+	b := &BulkIndexer{
+		client: client,
+		opts:   o,
+		queue:  make(chan elastic.BulkableRequest, o.queueSize),
+		flushc: make(chan chan error),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Add 把请求加入队列，队列满时阻塞直到有空位或 ctx 结束，关闭后返回 ErrIndexerClosed
+func (b *BulkIndexer) Add(ctx context.Context, req elastic.BulkableRequest) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrIndexerClosed
+	}
+	select {
+	case b.queue <- req:
+		atomic.AddInt64(&b.stats.Added, 1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush 立即发送之前加入的所有请求并等待完成，有请求最终失败时返回错误
+func (b *BulkIndexer) Flush(ctx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case b.flushc <- reply:
+	case <-b.done:
+		return ErrIndexerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 不再接受新请求，发送队列中剩余的请求后返回。ctx 结束时不再等待，剩余请求仍在后台发送
+func (b *BulkIndexer) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats 当前的累计计数
+func (b *BulkIndexer) Stats() IndexerStats {
+	return IndexerStats{
+		Added:     atomic.LoadInt64(&b.stats.Added),
+		Succeeded: atomic.LoadInt64(&b.stats.Succeeded),
+		Failed:    atomic.LoadInt64(&b.stats.Failed),
+		Retried:   atomic.LoadInt64(&b.stats.Retried),
+		Flushed:   atomic.LoadInt64(&b.stats.Flushed),
+	}
+}
+
+func (b *BulkIndexer) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.opts.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case req, ok := <-b.queue:
+			if !ok {
+				b.flush()
+				return
+			}
+			b.add(req)
+		case <-ticker.C:
+			b.flush()
+		case reply := <-b.flushc:
+			// Flush 之前 Add 成功的请求都已经在队列中
+			failed, open := b.drain()
+			if failed+b.flush() > 0 {
+				reply <- errors.New("elastic: some bulk requests failed, see the bulk error handler")
+			} else {
+				reply <- nil
+			}
+			if !open {
+				return
+			}
+		}
+	}
+}
+
+// drain 取出队列中已有的请求，返回期间失败的请求数，队列已经关闭时 open 为 false
+func (b *BulkIndexer) drain() (failed int, open bool) {
+	for {
+		select {
+		case req, ok := <-b.queue:
+			if !ok {
+				return failed, false
+			}
+			failed += b.add(req)
+		default:
+			return failed, true
+		}
+	}
+}
+
+// add 加入当前批次，批次满时发送，返回失败的请求数
+func (b *BulkIndexer) add(req elastic.BulkableRequest) int {
+	lines, err := req.Source()
+	if err != nil {
+		atomic.AddInt64(&b.stats.Failed, 1)
+		b.opts.errorHandler(&BulkError{Request: req, Err: err})
+		return 1
+	}
+	n := 0
+	for _, line := range lines {
+		n += len(line) + 1
+	}
+	failed := 0
+	if b.opts.flushBytes > 0 && len(b.batch) > 0 && b.bytes+n > b.opts.flushBytes {
+		failed += b.flush()
+	}
+	b.batch = append(b.batch, req)
+	b.bytes += n
+	if len(b.batch) >= b.opts.flushSize {
+		failed += b.flush()
+	}
+	return failed
+}
+
+// flush 发送当前批次，返回最终失败的请求数
+func (b *BulkIndexer) flush() int {
+	if len(b.batch) == 0 {
+		return 0
+	}
+	reqs := b.batch
+	b.batch, b.bytes = nil, 0
+	return b.commit(reqs)
+}
+
+func (b *BulkIndexer) commit(reqs []elastic.BulkableRequest) int {
+	failed := 0
+	for attempt := 0; len(reqs) > 0; attempt++ {
+		if attempt > 0 {
+			atomic.AddInt64(&b.stats.Retried, int64(len(reqs)))
+			time.Sleep(retry.Backoff(b.opts.backoff, b.opts.maxBackoff, attempt))
+		}
+		canRetry := attempt < b.opts.maxRetries
+		atomic.AddInt64(&b.stats.Flushed, 1)
+		// 请求会缓存序列化的结果，重试时不会重复编码
+		response, err := b.client.Bulk().Add(reqs...).Do(context.Background())
+		if err != nil {
+			if canRetry && retryable(err) {
+				continue
+			}
+			for _, req := range reqs {
+				b.opts.errorHandler(&BulkError{Request: req, Err: err})
+			}
+			atomic.AddInt64(&b.stats.Failed, int64(len(reqs)))
+			return failed + len(reqs)
+		}
+
+		var retries []elastic.BulkableRequest
+		for i, item := range response.Items {
+			if i >= len(reqs) {
+				break
+			}
+			for _, res := range item {
+				switch {
+				case res.Status >= 200 && res.Status <= 299:
+					atomic.AddInt64(&b.stats.Succeeded, 1)
+				case canRetry && retryableStatus(res.Status):
+					retries = append(retries, reqs[i])
+				default:
+					failed++
+					atomic.AddInt64(&b.stats.Failed, 1)
+					b.opts.errorHandler(newBulkError(reqs[i], res))
+				}
+			}
+		}
+		reqs = retries
+	}
+	return failed
+}
+
+// retryable 连接失败和服务端过载可以重试，请求本身的错误重试也不会成功
+func retryable(err error) bool {
+	var e *elastic.Error
+	if errors.As(err, &e) {
+		return retryableStatus(e.Status)
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package elastic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic"
+)
+
+func TestBulkIndexer(t *testing.T) {
+	ctx := context.Background()
+	es, client := newFakeES(t)
+	repo := NewRepository[*User](client, "users")
+	ix := NewBulkIndexer(client, WithFlushSize(10), WithFlushInterval(time.Hour))
+
+	for i := 0; i < 25; i++ {
+		if err := ix.Add(ctx, repo.IndexRequest(&User{Name: fmt.Sprint(i), Age: i})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 满 10 个发送一次，剩下的 5 个等待 Flush
+	if err := ix.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if es.count("users") != 25 {
+		t.Errorf("count %d", es.count("users"))
+	}
+	stats := ix.Stats()
+	if stats.Added != 25 || stats.Succeeded != 25 || stats.Flushed != 3 {
+		t.Errorf("stats %+v", stats)
+	}
+
+	if err := ix.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Add(ctx, repo.IndexRequest(&User{Name: "late"})); err != ErrIndexerClosed {
+		t.Errorf("expected ErrIndexerClosed, got %v", err)
+	}
+	if err := ix.Flush(ctx); err != ErrIndexerClosed {
+		t.Errorf("expected ErrIndexerClosed, got %v", err)
+	}
+}
+
+func TestBulkIndexerInterval(t *testing.T) {
+	es, client := newFakeES(t)
+	repo := NewRepository[*User](client, "users")
+	ix := NewBulkIndexer(client, WithFlushInterval(20*time.Millisecond))
+	defer ix.Close(context.Background())
+
+	if err := ix.Add(context.Background(), repo.IndexRequest(&User{Name: "a"})); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for es.count("users") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("not flushed by interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBulkIndexerRetry(t *testing.T) {
+	ctx := context.Background()
+	es, client := newFakeES(t)
+	// 前两次整个请求失败，a 被拒绝一次，bad 一直失败
+	es.failBulk = func(n int) int {
+		if n <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+	rejected := false
+	es.rejectItem = func(action, index, id string) int {
+		switch {
+		case id == "bad":
+			return http.StatusBadRequest
+		case id == "a" && !rejected:
+			rejected = true
+			return http.StatusTooManyRequests
+		}
+		return 0
+	}
+
+	var (
+		mu     sync.Mutex
+		errors []*BulkError
+	)
+	repo := NewRepository[*User](client, "users")
+	ix := NewBulkIndexer(client,
+		WithRetry(3, time.Millisecond, 5*time.Millisecond),
+		WithBulkErrorHandler(func(e *BulkError) {
+			mu.Lock()
+			errors = append(errors, e)
+			mu.Unlock()
+		}),
+	)
+	for _, name := range []string{"a", "b", "bad"} {
+		if err := ix.Add(ctx, repo.IndexRequest(&User{Name: name})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ix.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if es.doc("users", "a") == nil || es.doc("users", "b") == nil || es.doc("users", "bad") != nil {
+		t.Errorf("documents a, b, bad: %v, %v, %v", es.doc("users", "a"), es.doc("users", "b"), es.doc("users", "bad"))
+	}
+	mu.Lock()
+	if len(errors) != 1 || errors[0].ID != "bad" || errors[0].Status != http.StatusBadRequest || errors[0].Request == nil {
+		t.Errorf("errors %v", errors)
+	}
+	mu.Unlock()
+	stats := ix.Stats()
+	// 两次整个请求重试 3 个，a 重试 1 个
+	if stats.Succeeded != 2 || stats.Failed != 1 || stats.Retried != 7 || stats.Flushed != 4 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestBulkIndexerGiveUp(t *testing.T) {
+	ctx := context.Background()
+	es, client := newFakeES(t)
+	es.failBulk = func(int) int { return http.StatusServiceUnavailable }
+	var failed []*BulkError
+	repo := NewRepository[*User](client, "users")
+	ix := NewBulkIndexer(client,
+		WithRetry(2, time.Millisecond, time.Millisecond),
+		WithBulkErrorHandler(func(e *BulkError) { failed = append(failed, e) }),
+	)
+	if err := ix.Add(ctx, repo.IndexRequest(&User{Name: "a"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Flush(ctx); err == nil {
+		t.Error("expected flush error")
+	}
+	if err := ix.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	es.mu.Lock()
+	bulks := es.bulks
+	es.mu.Unlock()
+	if len(failed) != 1 || failed[0].Err == nil || bulks != 3 {
+		t.Errorf("failed %v after %d requests", failed, bulks)
+	}
+}
+
+func TestBulkIndexerDrainFailed(t *testing.T) {
+	es, client := newFakeES(t)
+	es.failBulk = func(int) int { return http.StatusBadRequest }
+	repo := NewRepository[*User](client, "users")
+	// 不启动后台 goroutine，直接检查 Flush 取出队列时按大小发送的批次
+	b := &BulkIndexer{
+		client: client,
+		opts: evaluateIndexerOptions([]IndexerOption{
+			WithFlushSize(2),
+			WithBulkErrorHandler(func(*BulkError) {}),
+		}),
+		queue: make(chan elastic.BulkableRequest, 3),
+	}
+	for i := 0; i < 3; i++ {
+		b.queue <- repo.IndexRequest(&User{Name: fmt.Sprint(i)})
+	}
+	failed, open := b.drain()
+	if failed != 2 || !open || len(b.batch) != 1 {
+		t.Errorf("drain failed %d open %v batch %d", failed, open, len(b.batch))
+	}
+	if n := b.flush(); n != 1 {
+		t.Errorf("flush failed %d", n)
+	}
+}
+
+func TestBulkIndexerBackpressure(t *testing.T) {
+	ctx := context.Background()
+	es, client := newFakeES(t)
+	gate := make(chan struct{})
+	es.failBulk = func(int) int {
+		<-gate
+		return 0
+	}
+	repo := NewRepository[*User](client, "users")
+	ix := NewBulkIndexer(client, WithFlushSize(1), WithQueueSize(2))
+
+	// 第一个请求发送中阻塞，队列再放两个后 Add 阻塞
+	for i := 0; i < 3; i++ {
+		if err := ix.Add(ctx, repo.IndexRequest(&User{Name: fmt.Sprint(i)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		err := ix.Add(timeout, repo.IndexRequest(&User{Name: "blocked"}))
+		cancel()
+		if err == context.DeadlineExceeded {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 后台还没取走第一个请求时队列有空位
+		if time.Now().After(deadline) {
+			t.Fatal("Add did not block")
+		}
+	}
+
+	close(gate)
+	if err := ix.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := es.count("users"); n < 3 {
+		t.Errorf("count %d", n)
+	}
+}
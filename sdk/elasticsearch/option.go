@@ -0,0 +1,150 @@
+package elastic
+
+import (
+	"net/http"
+	"time"
+)
+
+type (
+	ClientOption  func(*clientOptions)
+	clientOptions struct {
+		urls       []string
+		username   string
+		password   string
+		sniff      bool
+		debug      bool
+		httpClient *http.Client
+	}
+
+	IndexerOption  func(*indexerOptions)
+	indexerOptions struct {
+		flushSize     int
+		flushBytes    int
+		flushInterval time.Duration
+		queueSize     int
+		maxRetries    int
+		backoff       time.Duration
+		maxBackoff    time.Duration
+		errorHandler  func(*BulkError)
+	}
+)
+
+func evaluateClientOptions(opts []ClientOption) *clientOptions {
+	optCopy := &clientOptions{
+		urls: []string{"http://127.0.0.1:9200"},
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.httpClient == nil {
+		optCopy.httpClient = &http.Client{Transport: NewTransport(WithDebug(optCopy.debug))}
+	}
+
+	return optCopy
+}
+
+func evaluateIndexerOptions(opts []IndexerOption) *indexerOptions {
+	optCopy := &indexerOptions{
+		flushSize:     1000,
+		flushBytes:    5 << 20,
+		flushInterval: time.Second,
+		queueSize:     10000,
+		maxRetries:    3,
+		backoff:       100 * time.Millisecond,
+		maxBackoff:    10 * time.Second,
+		errorHandler:  func(*BulkError) {},
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.flushSize < 1 {
+		optCopy.flushSize = 1
+	}
+	if optCopy.queueSize < 1 {
+		optCopy.queueSize = 1
+	}
+
+	return optCopy
+}
+
+// WithURLs sets the elasticsearch nodes, default http://127.0.0.1:9200.
+func WithURLs(urls ...string) ClientOption {
+	return func(opts *clientOptions) {
+		opts.urls = urls
+	}
+}
+
+// WithBasicAuth sets the username and password.
+func WithBasicAuth(username, password string) ClientOption {
+	return func(opts *clientOptions) {
+		opts.username = username
+		opts.password = password
+	}
+}
+
+// WithSniff sets whether the other nodes of the cluster are discovered from the given urls, default false.
+func WithSniff(sniff bool) ClientOption {
+	return func(opts *clientOptions) {
+		opts.sniff = sniff
+	}
+}
+
+// WithTraceDebug sets whether request bodies are recorded on the tracing spans, default false.
+func WithTraceDebug(debug bool) ClientOption {
+	return func(opts *clientOptions) {
+		opts.debug = debug
+	}
+}
+
+// WithHTTPClient sets the http client, default a client with the tracing Transport.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(opts *clientOptions) {
+		opts.httpClient = client
+	}
+}
+
+// WithFlushSize sets how many requests are sent in one bulk request, default 1000.
+func WithFlushSize(n int) IndexerOption {
+	return func(opts *indexerOptions) {
+		opts.flushSize = n
+	}
+}
+
+// WithFlushBytes sets the max body size of one bulk request, default 5MB. 0 disables the limit.
+func WithFlushBytes(n int) IndexerOption {
+	return func(opts *indexerOptions) {
+		opts.flushBytes = n
+	}
+}
+
+// WithFlushInterval sets how often queued requests are sent even if the batch is not full, default 1s.
+func WithFlushInterval(d time.Duration) IndexerOption {
+	return func(opts *indexerOptions) {
+		opts.flushInterval = d
+	}
+}
+
+// WithQueueSize sets how many requests can wait in the queue, Add blocks when it is full, default 10000.
+func WithQueueSize(n int) IndexerOption {
+	return func(opts *indexerOptions) {
+		opts.queueSize = n
+	}
+}
+
+// WithRetry sets how many times a failed bulk request or a rejected item is retried,
+// and the first and the max delay between retries, the delay doubles after every retry,
+// default 3, 100ms and 10s.
+func WithRetry(maxRetries int, backoff, max time.Duration) IndexerOption {
+	return func(opts *indexerOptions) {
+		opts.maxRetries = maxRetries
+		opts.backoff = backoff
+		opts.maxBackoff = max
+	}
+}
+
+// WithBulkErrorHandler sets the function receiving requests that failed after all retries.
+func WithBulkErrorHandler(fn func(*BulkError)) IndexerOption {
+	return func(opts *indexerOptions) {
+		opts.errorHandler = fn
+	}
+}
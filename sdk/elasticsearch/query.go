@@ -0,0 +1,159 @@
+package elastic
+
+import "github.com/olivere/elastic"
+
+// Query 查询条件，和 olivere/elastic 的查询可以混用
+type Query = elastic.Query
+
+// Field 文档字段，类型参数约束查询值的类型，如 Field[int]("age").Gte(18)
+type Field[T any] string
+
+// Term 字段等于 v，text 字段需要使用 keyword 子字段
+func (f Field[T]) Term(v T) Query {
+	return source{"term": map[string]interface{}{string(f): v}}
+}
+
+// Terms 字段等于 vs 中的任意一个
+func (f Field[T]) Terms(vs ...T) Query {
+	values := make([]interface{}, len(vs))
+	for i, v := range vs {
+		values[i] = v
+	}
+	return source{"terms": map[string]interface{}{string(f): values}}
+}
+
+// Exists 字段存在且不为 null
+func (f Field[T]) Exists() Query {
+	return source{"exists": map[string]interface{}{"field": string(f)}}
+}
+
+// Range 范围查询，没有设置任何边界时匹配所有有值的文档
+func (f Field[T]) Range() *RangeQuery[T] {
+	return &RangeQuery[T]{field: string(f), bounds: make(map[string]interface{})}
+}
+
+func (f Field[T]) Gt(v T) *RangeQuery[T]  { return f.Range().Gt(v) }
+func (f Field[T]) Gte(v T) *RangeQuery[T] { return f.Range().Gte(v) }
+func (f Field[T]) Lt(v T) *RangeQuery[T]  { return f.Range().Lt(v) }
+func (f Field[T]) Lte(v T) *RangeQuery[T] { return f.Range().Lte(v) }
+
+// Between 闭区间 [from, to]
+func (f Field[T]) Between(from, to T) *RangeQuery[T] {
+	return f.Range().Gte(from).Lte(to)
+}
+
+// RangeQuery range 查询
+type RangeQuery[T any] struct {
+	field  string
+	bounds map[string]interface{}
+	format string
+}
+
+func (q *RangeQuery[T]) Gt(v T) *RangeQuery[T]  { return q.set("gt", v) }
+func (q *RangeQuery[T]) Gte(v T) *RangeQuery[T] { return q.set("gte", v) }
+func (q *RangeQuery[T]) Lt(v T) *RangeQuery[T]  { return q.set("lt", v) }
+func (q *RangeQuery[T]) Lte(v T) *RangeQuery[T] { return q.set("lte", v) }
+
+// Format 日期字段的格式，如 strict_date_optional_time
+func (q *RangeQuery[T]) Format(format string) *RangeQuery[T] {
+	q.format = format
+	return q
+}
+
+func (q *RangeQuery[T]) set(op string, v T) *RangeQuery[T] {
+	q.bounds[op] = v
+	return q
+}
+
+func (q *RangeQuery[T]) Source() (interface{}, error) {
+	params := make(map[string]interface{}, len(q.bounds)+1)
+	for k, v := range q.bounds {
+		params[k] = v
+	}
+	if q.format != "" {
+		params["format"] = q.format
+	}
+	return map[string]interface{}{"range": map[string]interface{}{q.field: params}}, nil
+}
+
+// BoolQuery bool 组合查询，Filter 和 MustNot 不参与打分
+type BoolQuery struct {
+	must, filter, should, mustNot []Query
+	minimumShouldMatch            int
+}
+
+func Bool() *BoolQuery {
+	return &BoolQuery{}
+}
+
+// Must 必须全部匹配并参与打分
+func (q *BoolQuery) Must(queries ...Query) *BoolQuery {
+	q.must = append(q.must, queries...)
+	return q
+}
+
+// Filter 必须全部匹配，不参与打分，结果可以被缓存
+func (q *BoolQuery) Filter(queries ...Query) *BoolQuery {
+	q.filter = append(q.filter, queries...)
+	return q
+}
+
+// Should 没有 Must 和 Filter 时至少匹配一个，否则只影响打分，可以用 MinimumShouldMatch 修改
+func (q *BoolQuery) Should(queries ...Query) *BoolQuery {
+	q.should = append(q.should, queries...)
+	return q
+}
+
+// MustNot 必须全部不匹配
+func (q *BoolQuery) MustNot(queries ...Query) *BoolQuery {
+	q.mustNot = append(q.mustNot, queries...)
+	return q
+}
+
+// MinimumShouldMatch Should 中至少匹配的个数
+func (q *BoolQuery) MinimumShouldMatch(n int) *BoolQuery {
+	q.minimumShouldMatch = n
+	return q
+}
+
+func (q *BoolQuery) Source() (interface{}, error) {
+	params := make(map[string]interface{})
+	for _, clause := range []struct {
+		name    string
+		queries []Query
+	}{{"must", q.must}, {"filter", q.filter}, {"should", q.should}, {"must_not", q.mustNot}} {
+		if len(clause.queries) == 0 {
+			continue
+		}
+		sources := make([]interface{}, len(clause.queries))
+		for i, query := range clause.queries {
+			src, err := query.Source()
+			if err != nil {
+				return nil, err
+			}
+			sources[i] = src
+		}
+		params[clause.name] = sources
+	}
+	if q.minimumShouldMatch > 0 {
+		params["minimum_should_match"] = q.minimumShouldMatch
+	}
+	return map[string]interface{}{"bool": params}, nil
+}
+
+// IDs 文档 ID 等于 ids 中的任意一个
+func IDs(ids ...string) Query {
+	return source{"ids": map[string]interface{}{"values": ids}}
+}
+
+// MatchAll 匹配所有文档
+func MatchAll() Query {
+	return source{"match_all": map[string]interface{}{}}
+}
+
+// source 已经构建好的查询
+type source map[string]interface{}
+
+func (s source) Source() (interface{}, error) {
+	return map[string]interface{}(s), nil
+}
@@ -0,0 +1,54 @@
+package elastic
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic"
+)
+
+func TestQuery(t *testing.T) {
+	createdAt := Field[time.Time]("created_at")
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	tests := []struct {
+		query Query
+		want  string
+	}{
+		{Field[string]("user").Term("a"), `{"term":{"user":"a"}}`},
+		{Field[int]("status").Terms(1, 2), `{"terms":{"status":[1,2]}}`},
+		{Field[int]("age").Gte(18).Lt(60), `{"range":{"age":{"gte":18,"lt":60}}}`},
+		{
+			createdAt.Between(from, to).Format("strict_date_optional_time"),
+			`{"range":{"created_at":{"format":"strict_date_optional_time","gte":"2021-01-01T00:00:00Z","lte":"2021-02-01T00:00:00Z"}}}`,
+		},
+		{Field[string]("email").Exists(), `{"exists":{"field":"email"}}`},
+		{IDs("1", "2"), `{"ids":{"values":["1","2"]}}`},
+		{Bool(), `{"bool":{}}`},
+		{
+			Bool().
+				Must(Field[string]("user").Term("a")).
+				Filter(Field[int]("age").Gt(18)).
+				Should(Field[bool]("vip").Term(true)).
+				MustNot(elastic.NewTermQuery("deleted", true)).
+				MinimumShouldMatch(1),
+			`{"bool":{"filter":[{"range":{"age":{"gt":18}}}],"minimum_should_match":1,` +
+				`"must":[{"term":{"user":"a"}}],"must_not":[{"term":{"deleted":true}}],"should":[{"term":{"vip":true}}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		src, err := tt.query.Source()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("got %s, want %s", data, tt.want)
+		}
+	}
+}
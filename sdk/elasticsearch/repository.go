@@ -0,0 +1,171 @@
+package elastic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic"
+)
+
+// Document 存入 Repository 的文档
+type Document interface {
+	DocID() string
+}
+
+// Timed 文档实现 Timed 时，索引名模板中的时间按 DocTime 格式化，否则按当前时间
+type Timed interface {
+	DocTime() time.Time
+}
+
+// Repository 读写同一类文档，索引名可以是模板，如 logs-{2006.01.02} 按天分索引，
+// 写入时按文档时间选择索引，读取时查询所有匹配 logs-* 的索引
+type Repository[T Document] struct {
+	client *Client
+	index  string
+	// 模板中 {} 前后的部分和时间格式，不是模板时 layout 为空
+	prefix, layout, suffix string
+}
+
+func NewRepository[T Document](client *Client, index string) *Repository[T] {
+	r := &Repository[T]{client: client, index: index}
+	start := strings.Index(index, "{")
+	end := strings.LastIndex(index, "}")
+	if start >= 0 && end > start {
+		r.prefix, r.layout, r.suffix = index[:start], index[start+1:end], index[end+1:]
+	}
+	return r
+}
+
+// IndexName 文档写入的索引
+func (r *Repository[T]) IndexName(doc T) string {
+	if r.layout == "" {
+		return r.index
+	}
+	t := time.Now()
+	if timed, ok := interface{}(doc).(Timed); ok {
+		t = timed.DocTime()
+	}
+	return r.prefix + t.Format(r.layout) + r.suffix
+}
+
+// Pattern 读取时查询的索引，模板中的时间替换为 *
+func (r *Repository[T]) Pattern() string {
+	if r.layout == "" {
+		return r.index
+	}
+	return r.prefix + "*" + r.suffix
+}
+
+// PutTemplate 创建或覆盖匹配 Pattern 的索引模板，之后自动创建的索引使用 settings 和 mappings
+func (r *Repository[T]) PutTemplate(ctx context.Context, settings, mappings map[string]interface{}) error {
+	name := strings.Trim(r.prefix+r.suffix, "-_.")
+	if r.layout == "" || name == "" {
+		name = r.index
+	}
+	body := map[string]interface{}{"index_patterns": []string{r.Pattern()}}
+	if settings != nil {
+		body["settings"] = settings
+	}
+	if mappings != nil {
+		body["mappings"] = map[string]interface{}{docType: mappings}
+	}
+	_, err := r.client.IndexPutTemplate(name).BodyJson(body).Do(ctx)
+	return err
+}
+
+// Save 写入文档，ID 相同时覆盖
+func (r *Repository[T]) Save(ctx context.Context, doc T) error {
+	_, err := r.client.Index().
+		Index(r.IndexName(doc)).
+		Type(docType).
+		Id(doc.DocID()).
+		BodyJson(doc).
+		Do(ctx)
+	return err
+}
+
+// SaveAll 通过一个 bulk 请求写入多个文档，有文档写入失败时返回第一个错误
+func (r *Repository[T]) SaveAll(ctx context.Context, docs ...T) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	bulk := r.client.Bulk()
+	for _, doc := range docs {
+		bulk.Add(r.IndexRequest(doc))
+	}
+	response, err := bulk.Do(ctx)
+	if err != nil {
+		return err
+	}
+	if failed := response.Failed(); len(failed) > 0 {
+		return fmt.Errorf("elastic: %d of %d documents failed, first: %w", len(failed), len(docs), newBulkError(nil, failed[0]))
+	}
+	return nil
+}
+
+// IndexRequest 写入文档的 bulk 请求，可以交给 BulkIndexer 批量写入
+func (r *Repository[T]) IndexRequest(doc T) elastic.BulkableRequest {
+	return elastic.NewBulkIndexRequest().Index(r.IndexName(doc)).Type(docType).Id(doc.DocID()).Doc(doc)
+}
+
+// Get 按 ID 读取文档，不存在时返回 ErrNotFound。索引名是模板时通过搜索查找，不是实时的
+func (r *Repository[T]) Get(ctx context.Context, id string) (T, error) {
+	var doc T
+	if r.layout == "" {
+		data, err := r.client.GetById(ctx, r.index, id)
+		if err != nil {
+			return doc, err
+		}
+		err = json.Unmarshal(data, &doc)
+		return doc, err
+	}
+	docs, _, err := r.Search(ctx, IDs(id), 0, 1)
+	if err != nil {
+		return doc, err
+	}
+	if len(docs) == 0 {
+		return doc, ErrNotFound
+	}
+	return docs[0], nil
+}
+
+// Delete 删除文档，不存在时返回 ErrNotFound
+func (r *Repository[T]) Delete(ctx context.Context, doc T) error {
+	_, err := r.client.DeleteById(ctx, r.IndexName(doc), doc.DocID())
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Search 查询文档，返回 [from, from+size) 的结果和匹配的总数
+func (r *Repository[T]) Search(ctx context.Context, query Query, from, size int, sorters ...elastic.Sorter) ([]T, int64, error) {
+	result, err := r.client.Search().
+		Index(r.Pattern()).
+		Query(query).
+		From(from).
+		Size(size).
+		SortBy(sorters...).
+		Do(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if result.Hits == nil {
+		return nil, 0, nil
+	}
+	docs := make([]T, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		if hit.Source == nil {
+			continue
+		}
+		var doc T
+		if err = json.Unmarshal(*hit.Source, &doc); err != nil {
+			return nil, 0, fmt.Errorf("elastic: decode %s/%s: %w", hit.Index, hit.Id, err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, result.Hits.TotalHits, nil
+}
@@ -0,0 +1,116 @@
+package elastic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic"
+)
+
+type order struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Amount    int       `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (o *order) DocID() string      { return o.ID }
+func (o *order) DocTime() time.Time { return o.CreatedAt }
+func (u *User) DocID() string       { return u.Name }
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	es, client := newFakeES(t)
+	repo := NewRepository[*order](client, "orders-{2006.01}")
+	if repo.Pattern() != "orders-*" {
+		t.Errorf("Pattern %s", repo.Pattern())
+	}
+
+	jan := time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC)
+	if err := repo.Save(ctx, &order{ID: "1", User: "a", Amount: 100, CreatedAt: jan}); err != nil {
+		t.Fatal(err)
+	}
+	err := repo.SaveAll(ctx,
+		&order{ID: "2", User: "b", Amount: 200, CreatedAt: feb},
+		&order{ID: "3", User: "a", Amount: 300, CreatedAt: feb},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if es.count("orders-2021.01") != 1 || es.count("orders-2021.02") != 2 {
+		t.Errorf("documents not split by month: %d, %d", es.count("orders-2021.01"), es.count("orders-2021.02"))
+	}
+
+	// 模板索引按 ID 搜索所有月份
+	o, err := repo.Get(ctx, "1")
+	if err != nil || o.Amount != 100 || !o.CreatedAt.Equal(jan) {
+		t.Errorf("Get %+v, %v", o, err)
+	}
+	if _, err = repo.Get(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	amount := Field[int]("amount")
+	query := Bool().
+		Filter(Field[string]("user").Term("a")).
+		Should(amount.Gte(300), amount.Lt(150)).
+		MinimumShouldMatch(1)
+	orders, total, err := repo.Search(ctx, query, 0, 10, elastic.NewFieldSort("amount").Desc())
+	if err != nil || total != 2 || len(orders) != 2 || orders[0].ID != "3" || orders[1].ID != "1" {
+		t.Errorf("Search %v, %d, %v", orders, total, err)
+	}
+	orders, total, err = repo.Search(ctx, MatchAll(), 1, 1, elastic.NewFieldSort("amount"))
+	if err != nil || total != 3 || len(orders) != 1 || orders[0].ID != "2" {
+		t.Errorf("Search page %v, %d, %v", orders, total, err)
+	}
+
+	if err = repo.Delete(ctx, o); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Delete(ctx, o); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRepositoryStatic(t *testing.T) {
+	ctx := context.Background()
+	_, client := newFakeES(t)
+	repo := NewRepository[*User](client, "users")
+	if repo.Pattern() != "users" || repo.IndexName(&User{}) != "users" {
+		t.Errorf("index %s, %s", repo.Pattern(), repo.IndexName(&User{}))
+	}
+	if err := repo.Save(ctx, &User{Name: "pibigstar", Age: 18}); err != nil {
+		t.Fatal(err)
+	}
+	u, err := repo.Get(ctx, "pibigstar")
+	if err != nil || u.Age != 18 {
+		t.Errorf("Get %+v, %v", u, err)
+	}
+	if _, err = repo.Get(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPutTemplate(t *testing.T) {
+	es, client := newFakeES(t)
+	repo := NewRepository[*order](client, "orders-{2006.01}")
+	err := repo.PutTemplate(context.Background(),
+		map[string]interface{}{"number_of_shards": 1},
+		map[string]interface{}{"properties": map[string]interface{}{"user": map[string]interface{}{"type": "keyword"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	tpl := es.templates["orders"]
+	patterns, _ := tpl["index_patterns"].([]interface{})
+	if len(patterns) != 1 || patterns[0] != "orders-*" || tpl["settings"] == nil {
+		t.Errorf("template %v", tpl)
+	}
+	if mappings, _ := tpl["mappings"].(map[string]interface{}); mappings[docType] == nil {
+		t.Errorf("mappings %v", tpl["mappings"])
+	}
+}
@@ -0,0 +1,221 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+type (
+	// Handler 处理一条消息，返回 nil 后标记位移，返回错误时退避重试
+	Handler func(ctx context.Context, msg *sarama.ConsumerMessage) error
+	// BatchHandler 处理同一分区的一批消息，返回 nil 后标记最后一条的位移
+	BatchHandler func(ctx context.Context, msgs []*sarama.ConsumerMessage) error
+	// RebalanceFunc 分区分配或回收时回调
+	RebalanceFunc func(e RebalanceEvent)
+)
+
+type RebalanceType int
+
+const (
+	Assigned RebalanceType = iota
+	Revoked
+)
+
+func (t RebalanceType) String() string {
+	if t == Assigned {
+		return "assigned"
+	}
+	return "revoked"
+}
+
+// RebalanceEvent Revoked 回调之后提交已标记的位移
+type RebalanceEvent struct {
+	Type         RebalanceType
+	MemberID     string
+	GenerationID int32
+	Claims       map[string][]int32
+}
+
+type Consumer struct {
+	group  sarama.ConsumerGroup
+	topics []string
+	opts   *options
+	errors sync.WaitGroup
+}
+
+// NewConsumer 加入 consumer group 消费 topics，调用 Run 或 RunBatch 开始消费
+func NewConsumer(addrs []string, groupID string, topics []string, opts ...Option) (*Consumer, error) {
+	group, err := sarama.NewConsumerGroup(addrs, groupID, evaluateOptions(opts).consumerConfig())
+	if err != nil {
+		return nil, err
+	}
+	return NewConsumerFromGroup(group, topics, opts...), nil
+}
+
+// NewConsumerFromGroup 使用已经创建的 consumer group
+func NewConsumerFromGroup(group sarama.ConsumerGroup, topics []string, opts ...Option) *Consumer {
+	c := &Consumer{group: group, topics: topics, opts: evaluateOptions(opts)}
+	c.errors.Add(1)
+	go func() {
+		defer c.errors.Done()
+		for err := range group.Errors() {
+			c.opts.errorHandler(err)
+		}
+	}()
+	return c
+}
+
+// Run 逐条消费，阻塞直到 ctx 取消或 Consumer 关闭。
+// ctx 取消后等待处理中的消息完成，提交已标记的位移后返回 ctx.Err()
+func (c *Consumer) Run(ctx context.Context, h Handler) error {
+	return c.RunBatch(ctx, func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+		for _, msg := range msgs {
+			if err := h(ctx, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunBatch 按分区批量消费，批次大小和等待时间见 WithBatch
+func (c *Consumer) RunBatch(ctx context.Context, h BatchHandler) error {
+	gh := &groupHandler{opts: c.opts, handle: h}
+	for {
+		// 每次 rebalance 后 Consume 返回，重新加入 group
+		if err := c.group.Consume(ctx, c.topics, gh); err != nil {
+			if err == sarama.ErrClosedConsumerGroup {
+				return ErrClosed
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.opts.errorHandler(err)
+			select {
+			case <-time.After(c.opts.retryBackoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// Close 离开 consumer group，应在 Run 返回后调用
+func (c *Consumer) Close() error {
+	err := c.group.Close()
+	c.errors.Wait()
+	return err
+}
+
+type groupHandler struct {
+	opts   *options
+	handle BatchHandler
+}
+
+func (h *groupHandler) Setup(s sarama.ConsumerGroupSession) error {
+	h.rebalance(Assigned, s)
+	return nil
+}
+
+func (h *groupHandler) Cleanup(s sarama.ConsumerGroupSession) error {
+	h.rebalance(Revoked, s)
+	return nil
+}
+
+func (h *groupHandler) rebalance(t RebalanceType, s sarama.ConsumerGroupSession) {
+	if h.opts.rebalance != nil {
+		h.opts.rebalance(RebalanceEvent{Type: t, MemberID: s.MemberID(), GenerationID: s.GenerationID(), Claims: s.Claims()})
+	}
+}
+
+func (h *groupHandler) ConsumeClaim(s sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	var (
+		batch []*sarama.ConsumerMessage
+		timer *time.Timer
+		wait  <-chan time.Time
+	)
+	flush := func() bool {
+		if timer != nil {
+			timer.Stop()
+			timer, wait = nil, nil
+		}
+		if len(batch) == 0 {
+			return true
+		}
+		if !h.process(s, batch) {
+			return false
+		}
+		s.MarkMessage(batch[len(batch)-1], "")
+		batch = nil
+		return true
+	}
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				flush()
+				return nil
+			}
+			batch = append(batch, msg)
+			if len(batch) >= h.opts.batchSize {
+				if !flush() {
+					return nil
+				}
+			} else if timer == nil {
+				timer = time.NewTimer(h.opts.batchWait)
+				wait = timer.C
+			}
+		case <-wait:
+			timer, wait = nil, nil
+			if !flush() {
+				return nil
+			}
+		case <-s.Context().Done():
+			// rebalance 或退出，未处理的批次不标记，由分区的下一个消费者重新消费
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil
+		}
+	}
+}
+
+// process 处理失败时退避重试直到成功，session 结束时返回 false
+func (h *groupHandler) process(s sarama.ConsumerGroupSession, msgs []*sarama.ConsumerMessage) bool {
+	backoff := h.opts.retryBackoff
+	for {
+		err := call(s.Context(), h.handle, msgs)
+		if err == nil {
+			return true
+		}
+		first := msgs[0]
+		h.opts.errorHandler(&HandlerError{Topic: first.Topic, Partition: first.Partition, Offset: first.Offset, Err: err})
+		select {
+		case <-time.After(backoff):
+		case <-s.Context().Done():
+			return false
+		}
+		if backoff *= 2; backoff > h.opts.maxRetryBackoff {
+			backoff = h.opts.maxRetryBackoff
+		}
+	}
+}
+
+// call handler panic 时按错误处理
+func call(ctx context.Context, h BatchHandler, msgs []*sarama.ConsumerMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("kafka: handler panic: %v", r)
+		}
+	}()
+	return h(ctx, msgs)
+}
@@ -0,0 +1,69 @@
+/**
+ * Kafka 客户端
+ *   1. Consumer 基于 consumer group，分区分配和回收时回调 RebalanceFunc
+ *   2. 至少一次：handler 成功后才标记位移，失败时退避重试，不会提交未处理的消息
+ *   3. 支持按分区批量处理，ctx 取消后处理完当前批次再退出并提交位移
+ *   4. Producer、AsyncProducer 默认开启幂等，重试不会在分区中写入重复消息
+ */
+package kafka
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+var ErrClosed = errors.New("kafka: consumer closed")
+
+// HandlerError handler 处理失败，消息会在退避后重试
+type HandlerError struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("kafka: handle %s/%d@%d: %v", e.Topic, e.Partition, e.Offset, e.Err)
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+func (o *options) consumerConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.Version = o.version
+	config.ClientID = o.clientID
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = o.initialOffset
+	config.Consumer.Offsets.CommitInterval = o.commitInterval
+	if o.configure != nil {
+		o.configure(config)
+	}
+	return config
+}
+
+func (o *options) producerConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.Version = o.version
+	config.ClientID = o.clientID
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	if o.idempotent {
+		// 幂等要求 0.11 以上、acks=all、可以重试并且同一连接上只有一个请求
+		if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+			config.Version = sarama.V0_11_0_0
+		}
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+		if config.Producer.Retry.Max < 1 {
+			config.Producer.Retry.Max = 1
+		}
+	}
+	if o.configure != nil {
+		o.configure(config)
+	}
+	return config
+}
@@ -0,0 +1,354 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+const (
+	testTopic = "orders"
+	testGroup = "billing"
+)
+
+// assignment 编码 SyncGroupResponse 中分配给当前成员的分区
+func assignment(topic string, partitions ...int32) []byte {
+	var buf bytes.Buffer
+	put := func(v interface{}) { binary.Write(&buf, binary.BigEndian, v) }
+	put(int16(0))
+	put(int32(1))
+	put(int16(len(topic)))
+	buf.WriteString(topic)
+	put(int32(len(partitions)))
+	put(partitions)
+	// user data 为 null
+	put(int32(-1))
+	return buf.Bytes()
+}
+
+// newGroupBroker 单节点的 mock broker，当前成员分到 orders 的 0 号分区，分区中有 values
+func newGroupBroker(t *testing.T, values ...string) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	fetch := sarama.NewMockFetchResponse(t, 1).SetVersion(3).SetHighWaterMark(testTopic, 0, int64(len(values)))
+	for i, v := range values {
+		fetch.SetMessage(testTopic, 0, int64(i), sarama.StringEncoder(v))
+	}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(testTopic, 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, testGroup, broker),
+		"JoinGroupRequest": sarama.NewMockWrapper(&sarama.JoinGroupResponse{
+			Version: 1, GenerationId: 1, GroupProtocol: "range", LeaderId: "leader", MemberId: "member-1",
+		}),
+		"SyncGroupRequest":  sarama.NewMockWrapper(&sarama.SyncGroupResponse{MemberAssignment: assignment(testTopic, 0)}),
+		"HeartbeatRequest":  sarama.NewMockWrapper(&sarama.HeartbeatResponse{}),
+		"LeaveGroupRequest": sarama.NewMockWrapper(&sarama.LeaveGroupResponse{}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset(testGroup, testTopic, 0, -1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset(testTopic, 0, sarama.OffsetOldest, 0).
+			SetOffset(testTopic, 0, sarama.OffsetNewest, int64(len(values))),
+		"FetchRequest":        fetch,
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+	})
+	return broker
+}
+
+// committed broker 收到的最后一次位移提交
+func committed(broker *sarama.MockBroker) int64 {
+	offset := int64(-1)
+	for _, rr := range broker.History() {
+		if req, ok := rr.Request.(*sarama.OffsetCommitRequest); ok {
+			if o, _, err := req.Offset(testTopic, 0); err == nil {
+				offset = o
+			}
+		}
+	}
+	return offset
+}
+
+func newTestConsumer(t *testing.T, broker *sarama.MockBroker, opts ...Option) *Consumer {
+	t.Helper()
+	opts = append([]Option{
+		WithVersion(sarama.V0_10_2_0),
+		WithRetryBackoff(time.Millisecond, 5*time.Millisecond),
+		WithConfig(func(c *sarama.Config) {
+			c.Metadata.Retry.Backoff = 10 * time.Millisecond
+			c.Consumer.Retry.Backoff = 10 * time.Millisecond
+			c.Consumer.MaxWaitTime = 10 * time.Millisecond
+		}),
+	}, opts...)
+	c, err := NewConsumer([]string{broker.Addr()}, testGroup, []string{testTopic}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestConsumerGroup(t *testing.T) {
+	broker := newGroupBroker(t, "a", "b", "c")
+	defer broker.Close()
+
+	var (
+		mu     sync.Mutex
+		events []RebalanceEvent
+		errs   []error
+		got    []string
+		failed bool
+	)
+	c := newTestConsumer(t, broker,
+		WithRebalanceCallback(func(e RebalanceEvent) {
+			mu.Lock()
+			events = append(events, e)
+			mu.Unlock()
+		}),
+		WithErrorHandler(func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx, func(_ context.Context, msg *sarama.ConsumerMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			// b 第一次处理失败，重试后成功
+			if string(msg.Value) == "b" && !failed {
+				failed = true
+				return errors.New("db down")
+			}
+			got = append(got, string(msg.Value))
+			if len(got) == 3 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("handled %v", got)
+	}
+	var herr *HandlerError
+	if len(errs) != 1 || !errors.As(errs[0], &herr) || herr.Offset != 1 {
+		t.Errorf("errors %v", errs)
+	}
+	if len(events) != 2 || events[0].Type != Assigned || events[1].Type != Revoked ||
+		events[0].MemberID != "member-1" || len(events[0].Claims[testTopic]) != 1 {
+		t.Errorf("rebalance events %+v", events)
+	}
+	// 退出时提交下一条要消费的位移
+	if offset := committed(broker); offset != 3 {
+		t.Errorf("committed offset %d, want 3", offset)
+	}
+}
+
+func TestBatchHandler(t *testing.T) {
+	broker := newGroupBroker(t, "1", "2", "3", "4", "5")
+	defer broker.Close()
+	c := newTestConsumer(t, broker, WithBatch(2, 20*time.Millisecond))
+	defer c.Close()
+
+	var (
+		mu      sync.Mutex
+		batches [][]string
+		total   int
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.RunBatch(ctx, func(_ context.Context, msgs []*sarama.ConsumerMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			var batch []string
+			for _, msg := range msgs {
+				batch = append(batch, string(msg.Value))
+			}
+			batches = append(batches, batch)
+			if total += len(msgs); total == 5 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// 最后一条不够一批，等待 batchWait 后单独处理
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[1]) != 2 || len(batches[2]) != 1 || batches[2][0] != "5" {
+		t.Errorf("batches %v", batches)
+	}
+	if offset := committed(broker); offset != 5 {
+		t.Errorf("committed offset %d, want 5", offset)
+	}
+}
+
+// TestShutdownUncommitted 退出时正在重试的消息不提交
+func TestShutdownUncommitted(t *testing.T) {
+	broker := newGroupBroker(t, "ok", "poison")
+	defer broker.Close()
+	c := newTestConsumer(t, broker)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var once sync.Once
+	err := c.Run(ctx, func(_ context.Context, msg *sarama.ConsumerMessage) error {
+		if string(msg.Value) == "poison" {
+			once.Do(cancel)
+			return errors.New("cannot parse")
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("Run returned %v", err)
+	}
+	if offset := committed(broker); offset != 1 {
+		t.Errorf("committed offset %d, want 1", offset)
+	}
+}
+
+func TestIdempotentProducer(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(testTopic, 0, broker.BrokerID()),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 1000, ProducerEpoch: 1}),
+		"ProduceRequest":        sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	p, err := NewProducer([]string{broker.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = p.Send(testTopic, []byte("user-1"), []byte("paid")); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var initialized, produced bool
+	for _, rr := range broker.History() {
+		switch rr.Request.(type) {
+		case *sarama.InitProducerIDRequest:
+			initialized = true
+		case *sarama.ProduceRequest:
+			produced = true
+		}
+	}
+	if !initialized || !produced {
+		t.Errorf("producer id requested %v, produced %v", initialized, produced)
+	}
+
+	// 非幂等时允许低版本
+	if config := evaluateOptions([]Option{WithIdempotent(false), WithVersion(sarama.V0_10_0_0)}).producerConfig(); config.Producer.Idempotent ||
+		config.Version != sarama.V0_10_0_0 {
+		t.Error("WithIdempotent(false) should keep the version")
+	}
+	if config := evaluateOptions([]Option{WithVersion(sarama.V0_10_0_0)}).producerConfig(); config.Validate() != nil ||
+		config.Net.MaxOpenRequests != 1 {
+		t.Errorf("idempotent config invalid: %v", config.Validate())
+	}
+}
+
+func TestAsyncProducer(t *testing.T) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	mock := mocks.NewAsyncProducer(t, config)
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+
+	var (
+		mu        sync.Mutex
+		successes int
+		errs      []error
+	)
+	p := NewAsyncProducerFrom(mock,
+		WithSuccessHandler(func(*sarama.ProducerMessage) {
+			mu.Lock()
+			successes++
+			mu.Unlock()
+		}),
+		WithErrorHandler(func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}),
+	)
+	for _, v := range []string{"a", "b"} {
+		if err := p.Send(context.Background(), &sarama.ProducerMessage{Topic: testTopic, Value: sarama.StringEncoder(v)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Close 等待所有回调完成
+	p.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	var perr *sarama.ProducerError
+	if successes != 1 || len(errs) != 1 || !errors.As(errs[0], &perr) || perr.Err != sarama.ErrNotLeaderForPartition {
+		t.Errorf("successes %d, errors %v", successes, errs)
+	}
+
+	// Input 阻塞时 Send 随 ctx 返回
+	blocked := NewAsyncProducerFrom(stuckProducer{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := blocked.Send(ctx, &sarama.ProducerMessage{Topic: testTopic}); err != context.DeadlineExceeded {
+		t.Errorf("Send returned %v", err)
+	}
+	blocked.Close()
+}
+
+// stuckProducer 不接收消息的 AsyncProducer
+type stuckProducer struct {
+	sarama.AsyncProducer
+}
+
+func (stuckProducer) Input() chan<- *sarama.ProducerMessage { return nil }
+
+func (stuckProducer) Successes() <-chan *sarama.ProducerMessage {
+	ch := make(chan *sarama.ProducerMessage)
+	close(ch)
+	return ch
+}
+
+func (stuckProducer) Errors() <-chan *sarama.ProducerError {
+	ch := make(chan *sarama.ProducerError)
+	close(ch)
+	return ch
+}
+
+func (stuckProducer) AsyncClose() {}
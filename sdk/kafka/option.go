@@ -0,0 +1,134 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+type (
+	Option  func(*options)
+	options struct {
+		version         sarama.KafkaVersion
+		clientID        string
+		initialOffset   int64
+		commitInterval  time.Duration
+		idempotent      bool
+		rebalance       RebalanceFunc
+		batchSize       int
+		batchWait       time.Duration
+		retryBackoff    time.Duration
+		maxRetryBackoff time.Duration
+		errorHandler    func(error)
+		onSuccess       func(*sarama.ProducerMessage)
+		configure       func(*sarama.Config)
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		version:         sarama.V0_11_0_0,
+		clientID:        "go-demo",
+		initialOffset:   sarama.OffsetOldest,
+		commitInterval:  time.Second,
+		idempotent:      true,
+		batchSize:       1,
+		batchWait:       time.Second,
+		retryBackoff:    100 * time.Millisecond,
+		maxRetryBackoff: 10 * time.Second,
+		errorHandler:    func(error) {},
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.batchSize < 1 {
+		optCopy.batchSize = 1
+	}
+
+	return optCopy
+}
+
+// WithVersion sets the kafka version, default 0.11.0.0.
+// Consumer groups need 0.10.2 and the idempotent producer needs 0.11.
+func WithVersion(version sarama.KafkaVersion) Option {
+	return func(opts *options) {
+		opts.version = version
+	}
+}
+
+// WithClientID sets the client id reported to the brokers, default "go-demo".
+func WithClientID(id string) Option {
+	return func(opts *options) {
+		opts.clientID = id
+	}
+}
+
+// WithInitialOffset sets where a group without committed offsets starts,
+// sarama.OffsetOldest (default) or sarama.OffsetNewest.
+func WithInitialOffset(offset int64) Option {
+	return func(opts *options) {
+		opts.initialOffset = offset
+	}
+}
+
+// WithCommitInterval sets how often the offsets marked after successful handling are committed,
+// marked offsets are also committed when partitions are revoked and on shutdown.
+func WithCommitInterval(interval time.Duration) Option {
+	return func(opts *options) {
+		opts.commitInterval = interval
+	}
+}
+
+// WithIdempotent enables the idempotent producer (default true),
+// retries after a lost ack then never write duplicates to a partition.
+func WithIdempotent(idempotent bool) Option {
+	return func(opts *options) {
+		opts.idempotent = idempotent
+	}
+}
+
+// WithRebalanceCallback sets the function called when partitions are assigned or revoked.
+func WithRebalanceCallback(fn RebalanceFunc) Option {
+	return func(opts *options) {
+		opts.rebalance = fn
+	}
+}
+
+// WithBatch sets the max size of a batch passed to a BatchHandler and how long to wait for it to fill.
+func WithBatch(size int, wait time.Duration) Option {
+	return func(opts *options) {
+		opts.batchSize = size
+		opts.batchWait = wait
+	}
+}
+
+// WithRetryBackoff sets the first and the max delay before a failed handler is retried,
+// the delay doubles after every failure.
+func WithRetryBackoff(backoff, max time.Duration) Option {
+	return func(opts *options) {
+		opts.retryBackoff = backoff
+		opts.maxRetryBackoff = max
+	}
+}
+
+// WithErrorHandler sets the function receiving handler failures, consumer group errors
+// and async producer errors.
+func WithErrorHandler(fn func(error)) Option {
+	return func(opts *options) {
+		opts.errorHandler = fn
+	}
+}
+
+// WithSuccessHandler sets the function called for every message acknowledged by the async producer.
+func WithSuccessHandler(fn func(*sarama.ProducerMessage)) Option {
+	return func(opts *options) {
+		opts.onSuccess = fn
+	}
+}
+
+// WithConfig adjusts the sarama config after the options are applied.
+func WithConfig(fn func(*sarama.Config)) Option {
+	return func(opts *options) {
+		opts.configure = fn
+	}
+}
@@ -0,0 +1,103 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// Producer 同步发送，返回时消息已被所有 ISR 确认
+type Producer struct {
+	producer sarama.SyncProducer
+}
+
+// NewProducer 默认开启幂等，见 WithIdempotent
+func NewProducer(addrs []string, opts ...Option) (*Producer, error) {
+	producer, err := sarama.NewSyncProducer(addrs, evaluateOptions(opts).producerConfig())
+	if err != nil {
+		return nil, err
+	}
+	return NewProducerFromSync(producer), nil
+}
+
+// NewProducerFromSync 使用已经创建的 SyncProducer，如 sarama/mocks
+func NewProducerFromSync(producer sarama.SyncProducer) *Producer {
+	return &Producer{producer: producer}
+}
+
+// Send 发送到 topic，相同 key 的消息进入同一分区
+func (p *Producer) Send(topic string, key, value []byte) (partition int32, offset int64, err error) {
+	msg := &sarama.ProducerMessage{Topic: topic, Value: sarama.ByteEncoder(value)}
+	if key != nil {
+		msg.Key = sarama.ByteEncoder(key)
+	}
+	return p.producer.SendMessage(msg)
+}
+
+func (p *Producer) SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error) {
+	return p.producer.SendMessage(msg)
+}
+
+// SendMessages 批量发送，返回的 sarama.ProducerErrors 中为失败的消息
+func (p *Producer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	return p.producer.SendMessages(msgs)
+}
+
+func (p *Producer) Close() error {
+	return p.producer.Close()
+}
+
+// AsyncProducer 异步发送，结果通过 WithSuccessHandler、WithErrorHandler 回调
+type AsyncProducer struct {
+	producer sarama.AsyncProducer
+	opts     *options
+	wg       sync.WaitGroup
+}
+
+// NewAsyncProducer 默认开启幂等，见 WithIdempotent
+func NewAsyncProducer(addrs []string, opts ...Option) (*AsyncProducer, error) {
+	producer, err := sarama.NewAsyncProducer(addrs, evaluateOptions(opts).producerConfig())
+	if err != nil {
+		return nil, err
+	}
+	return NewAsyncProducerFrom(producer, opts...), nil
+}
+
+// NewAsyncProducerFrom 使用已经创建的 AsyncProducer，需要开启 Producer.Return.Successes 和 Errors
+func NewAsyncProducerFrom(producer sarama.AsyncProducer, opts ...Option) *AsyncProducer {
+	p := &AsyncProducer{producer: producer, opts: evaluateOptions(opts)}
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		for msg := range producer.Successes() {
+			if p.opts.onSuccess != nil {
+				p.opts.onSuccess(msg)
+			}
+		}
+	}()
+	go func() {
+		defer p.wg.Done()
+		for err := range producer.Errors() {
+			p.opts.errorHandler(err)
+		}
+	}()
+	return p
+}
+
+// Send 把消息放入发送队列，队列满时阻塞直到 ctx 取消
+func (p *AsyncProducer) Send(ctx context.Context, msg *sarama.ProducerMessage) error {
+	select {
+	case p.producer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 等待队列中的消息发送完成，所有回调结束后返回
+func (p *AsyncProducer) Close() error {
+	p.producer.AsyncClose()
+	p.wg.Wait()
+	return nil
+}
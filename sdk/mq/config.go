@@ -0,0 +1,113 @@
+package mq
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Config 消息队列配置，Driver 决定使用哪个适配器
+type Config struct {
+	// Driver memory、nsq、rabbitmq、kafka、mqtt，适配器包需要先导入
+	Driver string   `yaml:"driver" json:"driver"`
+	Addrs  []string `yaml:"addrs" json:"addrs"`
+	// Group 消费组，对应 nsq 的 channel、rabbitmq 的队列名前缀、kafka 的 group id、mqtt 的共享订阅组
+	Group       string `yaml:"group" json:"group"`
+	Concurrency int    `yaml:"concurrency" json:"concurrency"`
+	// Params 适配器特有的参数，见各适配器的说明
+	Params map[string]string `yaml:"params" json:"params"`
+}
+
+// Param 读取字符串参数
+func (c Config) Param(key, def string) string {
+	if v, ok := c.Params[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// IntParam 读取整数参数
+func (c Config) IntParam(key string, def int) (int, error) {
+	v, ok := c.Params[key]
+	if !ok || v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("mq: param %s: %v", key, err)
+	}
+	return n, nil
+}
+
+// Workers 并发处理数，至少为 1
+func (c Config) Workers() int {
+	if c.Concurrency < 1 {
+		return 1
+	}
+	return c.Concurrency
+}
+
+// Driver 适配器在 init 中通过 Register 注册
+type Driver interface {
+	NewPublisher(cfg Config) (Publisher, error)
+	NewSubscriber(cfg Config) (Subscriber, error)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// Register 注册适配器，重复注册时 panic
+func Register(name string, d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if d == nil {
+		panic("mq: Register driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("mq: Register called twice for driver " + name)
+	}
+	drivers[name] = d
+}
+
+// Drivers 已注册的适配器名
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func driver(name string) (Driver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	d, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q (forgotten import?)", ErrUnknownDriver, name)
+	}
+	return d, nil
+}
+
+// NewPublisher 根据配置创建 Publisher
+func NewPublisher(cfg Config) (Publisher, error) {
+	d, err := driver(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+	return d.NewPublisher(cfg)
+}
+
+// NewSubscriber 根据配置创建 Subscriber
+func NewSubscriber(cfg Config) (Subscriber, error) {
+	d, err := driver(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+	return d.NewSubscriber(cfg)
+}
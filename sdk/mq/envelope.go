@@ -0,0 +1,60 @@
+package mq
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrNotEnvelope 消息体不是 Marshal 编码的信封，如旧代码直接发布的消息
+var ErrNotEnvelope = errors.New("mq: not an envelope")
+
+// envelope 没有 header 的 broker(nsq、mqtt 3.1.1)把信封编码到消息体中
+type envelope struct {
+	ID        string            `json:"id"`
+	Key       string            `json:"key,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Timestamp int64             `json:"ts"` // unix 毫秒
+	Attempt   int               `json:"attempt"`
+	Body      []byte            `json:"body"`
+}
+
+// Marshal 将信封和消息体编码为 JSON
+func Marshal(m *Message) ([]byte, error) {
+	return json.Marshal(&envelope{
+		ID:        m.ID,
+		Key:       m.Key,
+		Headers:   m.Headers,
+		Timestamp: m.Timestamp.UnixNano() / int64(time.Millisecond),
+		Attempt:   m.Attempt,
+		Body:      m.Body,
+	})
+}
+
+// Unmarshal 解码 Marshal 的结果，不是信封时返回 ErrNotEnvelope
+func Unmarshal(data []byte) (*Message, error) {
+	var e envelope
+	if err := json.Unmarshal(data, &e); err != nil || e.ID == "" {
+		return nil, ErrNotEnvelope
+	}
+	m := &Message{
+		ID:        e.ID,
+		Key:       e.Key,
+		Headers:   e.Headers,
+		Body:      e.Body,
+		Timestamp: time.Unix(0, e.Timestamp*int64(time.Millisecond)),
+		Attempt:   e.Attempt,
+	}
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+	return m, nil
+}
+
+// Decode 解码信封，不是信封时把整个消息体作为 Body，兼容没有使用本包的发布方
+func Decode(data []byte) *Message {
+	if m, err := Unmarshal(data); err == nil {
+		return m
+	}
+	return &Message{Body: data, Headers: make(map[string]string), Attempt: 1}
+}
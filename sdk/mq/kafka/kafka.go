@@ -0,0 +1,262 @@
+// Package kafka mq 的 kafka 适配器，基于 sdk/kafka 的 Producer 和 Consumer，
+// 信封字段放在 kafka 的 key、timestamp 和 header 中。
+//
+// Config.Addrs 为 broker 地址，Group 为 consumer group，
+// Params: version kafka 版本，默认 0.11.0.0(header 需要 0.11 及以上)；
+// offset 新 group 从 oldest 还是 newest 开始消费，默认 oldest。
+// 同一分区的消息按顺序处理，Nack(true) 把消息重新发布到原 topic 的末尾并提交位移，
+// 重新发布失败时由 Consumer 退避后重新处理这条消息
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+
+	"go-demo/sdk/kafka"
+	"go-demo/sdk/mq"
+)
+
+const (
+	headerID      = "mq-id"
+	headerAttempt = "mq-attempt"
+	defaultGroup  = "default"
+)
+
+func init() {
+	mq.Register("kafka", driver{})
+}
+
+type driver struct{}
+
+func (driver) NewPublisher(cfg mq.Config) (mq.Publisher, error) {
+	opts, err := configOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := kafka.NewProducer(cfg.Addrs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewPublisher(producer), nil
+}
+
+func (driver) NewSubscriber(cfg mq.Config) (mq.Subscriber, error) {
+	opts, err := configOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewSubscriber(cfg.Addrs, cfg.Group, opts...)
+}
+
+func configOptions(cfg mq.Config) ([]kafka.Option, error) {
+	version, err := sarama.ParseKafkaVersion(cfg.Param("version", "0.11.0.0"))
+	if err != nil {
+		return nil, err
+	}
+	opts := []kafka.Option{kafka.WithVersion(version)}
+	switch cfg.Param("offset", "oldest") {
+	case "oldest":
+		opts = append(opts, kafka.WithInitialOffset(sarama.OffsetOldest))
+	case "newest":
+		opts = append(opts, kafka.WithInitialOffset(sarama.OffsetNewest))
+	default:
+		return nil, errors.New("kafka: offset must be oldest or newest")
+	}
+	return opts, nil
+}
+
+// Publisher 同步发布，Publish 返回时消息已被 broker 确认
+type Publisher struct {
+	producer *kafka.Producer
+}
+
+// NewPublisher 使用已有的 producer，测试中可以用 kafka.NewProducerFromSync 包装 sarama/mocks
+func NewPublisher(producer *kafka.Producer) *Publisher {
+	return &Publisher{producer: producer}
+}
+
+func (p *Publisher) Publish(ctx context.Context, topic string, msgs ...*mq.Message) error {
+	if topic == "" {
+		return mq.ErrEmptyTopic
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	batch := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, m := range msgs {
+		mq.Prepare(m, topic)
+		batch = append(batch, ToProducerMessage(m))
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return p.producer.SendMessages(batch)
+}
+
+func (p *Publisher) Close() error {
+	return p.producer.Close()
+}
+
+// ToProducerMessage 信封转换为 kafka 消息，key 为空时随机分区
+func ToProducerMessage(m *mq.Message) *sarama.ProducerMessage {
+	pm := &sarama.ProducerMessage{
+		Topic:     m.Topic,
+		Value:     sarama.ByteEncoder(m.Body),
+		Timestamp: m.Timestamp,
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(headerID), Value: []byte(m.ID)},
+			{Key: []byte(headerAttempt), Value: []byte(strconv.Itoa(m.Attempt))},
+		},
+	}
+	if m.Key != "" {
+		pm.Key = sarama.StringEncoder(m.Key)
+	}
+	for k, v := range m.Headers {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return pm
+}
+
+// FromConsumerMessage kafka 消息转换为信封
+func FromConsumerMessage(cm *sarama.ConsumerMessage) *mq.Message {
+	m := &mq.Message{
+		Topic:     cm.Topic,
+		Key:       string(cm.Key),
+		Headers:   make(map[string]string, len(cm.Headers)),
+		Body:      cm.Value,
+		Timestamp: cm.Timestamp,
+		Attempt:   1,
+	}
+	for _, h := range cm.Headers {
+		switch key := string(h.Key); key {
+		case headerID:
+			m.ID = string(h.Value)
+		case headerAttempt:
+			if n, err := strconv.Atoi(string(h.Value)); err == nil && n > 0 {
+				m.Attempt = n
+			}
+		default:
+			m.Headers[key] = string(h.Value)
+		}
+	}
+	// 其他生产者发布的消息没有 ID，使用分区和位移
+	if m.ID == "" {
+		m.ID = cm.Topic + "-" + strconv.Itoa(int(cm.Partition)) + "-" + strconv.FormatInt(cm.Offset, 10)
+	}
+	return m
+}
+
+// Subscriber 每次 Subscribe 加入一次 consumer group，退避重试和位移提交由 kafka.Consumer 处理
+type Subscriber struct {
+	addrs    []string
+	group    string
+	opts     []kafka.Option
+	producer *kafka.Producer // Nack(true) 时重新发布
+
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+	done   chan struct{}
+}
+
+func NewSubscriber(addrs []string, groupID string, opts ...kafka.Option) (*Subscriber, error) {
+	if groupID == "" {
+		groupID = defaultGroup
+	}
+	producer, err := kafka.NewProducer(addrs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Subscriber{addrs: addrs, group: groupID, opts: opts, producer: producer, done: make(chan struct{})}, nil
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context, topic string, h mq.Handler) error {
+	if topic == "" {
+		return mq.ErrEmptyTopic
+	}
+	if h == nil {
+		return mq.ErrNilHandler
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return mq.ErrClosed
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	consumer, err := kafka.NewConsumer(s.addrs, s.group, []string{topic}, s.opts...)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err = consumer.Run(ctx, func(ctx context.Context, cm *sarama.ConsumerMessage) error {
+		return deliver(ctx, h, s.producer, cm)
+	})
+
+	select {
+	case <-s.done:
+		return mq.ErrClosed
+	default:
+	}
+	if err == kafka.ErrClosed {
+		return mq.ErrClosed
+	}
+	return err
+}
+
+// Close 停止所有订阅，等待处理中的消息完成后关闭 producer
+func (s *Subscriber) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return s.producer.Close()
+}
+
+// deliver 调用 handler，返回 nil 时 Consumer 标记位移，重新发布失败时返回错误，由 Consumer 退避重试
+func deliver(ctx context.Context, h mq.Handler, producer *kafka.Producer, cm *sarama.ConsumerMessage) error {
+	m := FromConsumerMessage(cm)
+	m.SetAcknowledger(&acker{producer: producer})
+	return mq.Deliver(ctx, h, m)
+}
+
+type acker struct {
+	producer *kafka.Producer
+}
+
+// Ack 位移在 handler 返回后由 Consumer 标记
+func (a *acker) Ack(*mq.Message) error {
+	return nil
+}
+
+func (a *acker) Nack(m *mq.Message, requeue bool) error {
+	if !requeue {
+		return nil
+	}
+	c := m.Copy()
+	c.Attempt++
+	_, _, err := a.producer.SendMessage(ToProducerMessage(c))
+	return err
+}
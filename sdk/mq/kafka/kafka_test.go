@@ -0,0 +1,133 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+
+	"go-demo/sdk/kafka"
+	"go-demo/sdk/mq"
+)
+
+func TestPublish(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+		if string(value) != "hello" {
+			return errors.New("unexpected value " + string(value))
+		}
+		return nil
+	})
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	p := NewPublisher(kafka.NewProducerFromSync(producer))
+	defer p.Close()
+
+	if err := p.Publish(context.Background(), "orders", mq.NewMessage([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(context.Background(), "orders", mq.NewMessage([]byte("x"))); err == nil {
+		t.Error("expected error from broker")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	m := mq.NewMessage([]byte("body"))
+	m.Key = "user-1"
+	m.Headers["trace"] = "abc"
+	mq.Prepare(m, "orders")
+	m.Attempt = 3
+
+	pm := ToProducerMessage(m)
+	key, _ := pm.Key.Encode()
+	value, _ := pm.Value.Encode()
+	cm := &sarama.ConsumerMessage{Topic: pm.Topic, Key: key, Value: value, Timestamp: pm.Timestamp, Partition: 2, Offset: 7}
+	for i := range pm.Headers {
+		cm.Headers = append(cm.Headers, &pm.Headers[i])
+	}
+
+	got := FromConsumerMessage(cm)
+	if got.ID != m.ID || got.Key != "user-1" || got.Attempt != 3 || got.Headers["trace"] != "abc" ||
+		len(got.Headers) != 1 || string(got.Body) != "body" || !got.Timestamp.Equal(m.Timestamp) {
+		t.Errorf("round trip: %+v", got)
+	}
+
+	// 其他生产者的消息没有信封 header
+	plain := FromConsumerMessage(&sarama.ConsumerMessage{Topic: "orders", Value: []byte("v"), Partition: 2, Offset: 7})
+	if plain.ID != "orders-2-7" || plain.Attempt != 1 || plain.Key != "" {
+		t.Errorf("plain message: %+v", plain)
+	}
+}
+
+// recordProducer 记录重新发布的消息
+type recordProducer struct {
+	mu   sync.Mutex
+	sent []*sarama.ProducerMessage
+}
+
+func (p *recordProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, msg)
+	return 0, int64(len(p.sent)), nil
+}
+
+func (p *recordProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	for _, msg := range msgs {
+		p.SendMessage(msg)
+	}
+	return nil
+}
+
+func (p *recordProducer) Close() error { return nil }
+
+func TestDeliver(t *testing.T) {
+	producer := &recordProducer{}
+	var handled []string
+	h := func(_ context.Context, m *mq.Message) error {
+		handled = append(handled, string(m.Body))
+		switch string(m.Body) {
+		case "retry":
+			return errors.New("temporary")
+		case "drop":
+			return m.Nack(false)
+		}
+		return nil
+	}
+
+	for i, body := range []string{"ok", "retry", "drop"} {
+		cm := &sarama.ConsumerMessage{Topic: "jobs", Value: []byte(body), Offset: int64(i), Timestamp: time.Now()}
+		// 返回 nil 时 Consumer 标记位移
+		if err := deliver(context.Background(), h, kafka.NewProducerFromSync(producer), cm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(handled) != 3 {
+		t.Errorf("handled %v", handled)
+	}
+	if len(producer.sent) != 1 {
+		t.Fatalf("requeued %d messages", len(producer.sent))
+	}
+	requeued := producer.sent[0]
+	value, _ := requeued.Value.Encode()
+	if requeued.Topic != "jobs" || string(value) != "retry" {
+		t.Errorf("unexpected requeue %+v", requeued)
+	}
+	for _, header := range requeued.Headers {
+		if string(header.Key) == headerAttempt && string(header.Value) != "2" {
+			t.Errorf("attempt header = %s", header.Value)
+		}
+	}
+
+	// 重新发布失败时返回错误，由 Consumer 退避后重新处理
+	failing := mocks.NewSyncProducer(t, nil)
+	failing.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	cm := &sarama.ConsumerMessage{Topic: "jobs", Value: []byte("retry"), Offset: 3}
+	if err := deliver(context.Background(), h, kafka.NewProducerFromSync(failing), cm); err != sarama.ErrOutOfBrokers {
+		t.Errorf("deliver returned %v", err)
+	}
+}
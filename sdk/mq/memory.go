@@ -0,0 +1,288 @@
+package mq
+
+import (
+	"context"
+	"sync"
+)
+
+const defaultGroup = "default"
+
+// MemoryBroker 进程内 broker，用于测试和本地开发。
+// 每个消费组收到全部消息，组内的订阅者竞争消费；
+// 还没有消费组时发布的消息暂存在 topic 中，由第一个消费组接收
+type MemoryBroker struct {
+	mu      sync.Mutex
+	topics  map[string]*memoryTopic
+	closed  bool
+	closing chan struct{}
+}
+
+type memoryTopic struct {
+	backlog []*Message
+	groups  map[string]*memoryQueue
+}
+
+// memoryQueue 无界队列，notify 在有新消息时发出信号
+type memoryQueue struct {
+	mu     sync.Mutex
+	msgs   []*Message
+	notify chan struct{}
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics:  make(map[string]*memoryTopic),
+		closing: make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, msgs ...*Message) error {
+	if topic == "" {
+		return ErrEmptyTopic
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	t := b.topic(topic)
+	for _, m := range msgs {
+		Prepare(m, topic)
+		if len(t.groups) == 0 {
+			t.backlog = append(t.backlog, m.Copy())
+			continue
+		}
+		// 每个消费组一份拷贝，互不影响 Ack 状态
+		for _, q := range t.groups {
+			q.push(m.Copy())
+		}
+	}
+	return nil
+}
+
+// Close 关闭 broker，所有 Subscribe 返回 ErrClosed
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.closing)
+	}
+	return nil
+}
+
+// Subscriber 创建消费组 group 中的订阅者，concurrency 为并发处理数
+func (b *MemoryBroker) Subscriber(group string, concurrency int) Subscriber {
+	if group == "" {
+		group = defaultGroup
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &memorySubscriber{broker: b, group: group, concurrency: concurrency, done: make(chan struct{})}
+}
+
+// Pending 消费组中未处理的消息数，用于测试
+func (b *MemoryBroker) Pending(topic, group string) int {
+	if group == "" {
+		group = defaultGroup
+	}
+	b.mu.Lock()
+	t, ok := b.topics[topic]
+	if !ok {
+		b.mu.Unlock()
+		return 0
+	}
+	q, ok := t.groups[group]
+	if !ok {
+		defer b.mu.Unlock()
+		return len(t.backlog)
+	}
+	b.mu.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.msgs)
+}
+
+func (b *MemoryBroker) topic(name string) *memoryTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memoryTopic{groups: make(map[string]*memoryQueue)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+func (b *MemoryBroker) queue(topic, group string) (*memoryQueue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	t := b.topic(topic)
+	q, ok := t.groups[group]
+	if !ok {
+		q = &memoryQueue{notify: make(chan struct{}, 1)}
+		if len(t.groups) == 0 {
+			for _, m := range t.backlog {
+				q.push(m)
+			}
+			t.backlog = nil
+		}
+		t.groups[group] = q
+	}
+	return q, nil
+}
+
+func (q *memoryQueue) push(m *Message) {
+	q.mu.Lock()
+	q.msgs = append(q.msgs, m)
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *memoryQueue) pop() (*Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.msgs) == 0 {
+		return nil, false
+	}
+	m := q.msgs[0]
+	q.msgs[0] = nil
+	q.msgs = q.msgs[1:]
+	// 还有消息时唤醒其他 worker
+	if len(q.msgs) > 0 {
+		q.signal()
+	}
+	return m, true
+}
+
+func (q *memoryQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+type memorySubscriber struct {
+	broker      *MemoryBroker
+	group       string
+	concurrency int
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (s *memorySubscriber) Subscribe(ctx context.Context, topic string, h Handler) error {
+	if topic == "" {
+		return ErrEmptyTopic
+	}
+	if h == nil {
+		return ErrNilHandler
+	}
+	q, err := s.broker.queue(topic, s.group)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, s.concurrency)
+	for i := 0; i < s.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.work(ctx, q, h)
+		}()
+	}
+	wg.Wait()
+	return <-errs
+}
+
+func (s *memorySubscriber) work(ctx context.Context, q *memoryQueue, h Handler) error {
+	for {
+		m, ok := q.pop()
+		if !ok {
+			select {
+			case <-q.notify:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-s.done:
+				return ErrClosed
+			case <-s.broker.closing:
+				return ErrClosed
+			}
+		}
+		m.SetAcknowledger(&memoryAcker{queue: q})
+		if err := Deliver(ctx, h, m); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *memorySubscriber) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+type memoryAcker struct {
+	queue *memoryQueue
+}
+
+func (a *memoryAcker) Ack(*Message) error {
+	return nil
+}
+
+func (a *memoryAcker) Nack(m *Message, requeue bool) error {
+	if requeue {
+		c := m.Copy()
+		c.Attempt++
+		a.queue.push(c)
+	}
+	return nil
+}
+
+// memory driver 同一进程中 Addrs[0] 相同的配置共享一个 broker
+type memoryDriver struct {
+	mu      sync.Mutex
+	brokers map[string]*MemoryBroker
+}
+
+func (d *memoryDriver) broker(cfg Config) *MemoryBroker {
+	name := ""
+	if len(cfg.Addrs) > 0 {
+		name = cfg.Addrs[0]
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b, ok := d.brokers[name]
+	if !ok {
+		b = NewMemoryBroker()
+		d.brokers[name] = b
+	}
+	return b
+}
+
+func (d *memoryDriver) NewPublisher(cfg Config) (Publisher, error) {
+	return memoryPublisher{d.broker(cfg)}, nil
+}
+
+func (d *memoryDriver) NewSubscriber(cfg Config) (Subscriber, error) {
+	return d.broker(cfg).Subscriber(cfg.Group, cfg.Workers()), nil
+}
+
+// memoryPublisher 共享的 broker 不随 Publisher 关闭
+type memoryPublisher struct {
+	*MemoryBroker
+}
+
+func (memoryPublisher) Close() error {
+	return nil
+}
+
+func init() {
+	Register("memory", &memoryDriver{brokers: make(map[string]*MemoryBroker)})
+}
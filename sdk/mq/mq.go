@@ -0,0 +1,145 @@
+/**
+ * 统一的消息队列接口
+ *   1. Publisher 发布消息，Subscriber 订阅消息，业务代码只依赖这两个接口
+ *   2. Message 为消息信封，包含 header、key、时间戳和投递次数
+ *   3. 消息需要显式 Ack/Nack，handler 没有处理时按返回值自动 Ack 或 Nack
+ *   4. 适配器见 nsq、rabbitmq、kafka、mqtt 子包，测试使用内存 broker，
+ *      通过 Config.Driver 切换，见 NewPublisher
+ */
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrClosed        = errors.New("mq: closed")
+	ErrSettled       = errors.New("mq: message already acked or nacked")
+	ErrEmptyTopic    = errors.New("mq: topic is empty")
+	ErrNilHandler    = errors.New("mq: handler is nil")
+	ErrUnknownDriver = errors.New("mq: unknown driver")
+)
+
+type (
+	// Publisher 发布消息，msgs 中的 ID 和 Timestamp 为空时自动填充
+	Publisher interface {
+		Publish(ctx context.Context, topic string, msgs ...*Message) error
+		Close() error
+	}
+
+	// Subscriber 订阅消息，Subscribe 阻塞直到 ctx 取消或 Close
+	Subscriber interface {
+		Subscribe(ctx context.Context, topic string, h Handler) error
+		Close() error
+	}
+
+	// Handler 处理消息，没有调用 Ack/Nack 时，返回 nil 则 Ack，否则 Nack 并重新投递
+	Handler func(ctx context.Context, msg *Message) error
+
+	// Acknowledger 由各适配器实现，确认或拒绝一条消息
+	Acknowledger interface {
+		Ack(msg *Message) error
+		// Nack requeue 为 true 时重新投递并增加投递次数，否则丢弃
+		Nack(msg *Message, requeue bool) error
+	}
+)
+
+// Message 消息信封
+type Message struct {
+	ID        string
+	Topic     string
+	Key       string // 分区键，kafka 中相同 key 的消息有序
+	Headers   map[string]string
+	Body      []byte
+	Timestamp time.Time
+	// Attempt 第几次投递，从 1 开始
+	Attempt int
+
+	acker   Acknowledger
+	settled int32
+}
+
+// NewMessage 创建待发布的消息
+func NewMessage(body []byte) *Message {
+	return &Message{Body: body, Headers: make(map[string]string)}
+}
+
+// SetAcknowledger 供适配器在投递消息前设置
+func (m *Message) SetAcknowledger(a Acknowledger) {
+	m.acker = a
+}
+
+// Ack 确认消息已处理，重复确认返回 ErrSettled
+func (m *Message) Ack() error {
+	if !atomic.CompareAndSwapInt32(&m.settled, 0, 1) {
+		return ErrSettled
+	}
+	if m.acker == nil {
+		return nil
+	}
+	return m.acker.Ack(m)
+}
+
+// Nack 拒绝消息，requeue 为 true 时重新投递
+func (m *Message) Nack(requeue bool) error {
+	if !atomic.CompareAndSwapInt32(&m.settled, 0, 1) {
+		return ErrSettled
+	}
+	if m.acker == nil {
+		return nil
+	}
+	return m.acker.Nack(m, requeue)
+}
+
+// Settled 是否已经 Ack 或 Nack
+func (m *Message) Settled() bool {
+	return atomic.LoadInt32(&m.settled) == 1
+}
+
+// Copy 复制信封，用于重新发布，不包含 Ack 状态
+func (m *Message) Copy() *Message {
+	c := &Message{
+		ID:        m.ID,
+		Topic:     m.Topic,
+		Key:       m.Key,
+		Headers:   make(map[string]string, len(m.Headers)),
+		Body:      append([]byte(nil), m.Body...),
+		Timestamp: m.Timestamp,
+		Attempt:   m.Attempt,
+	}
+	for k, v := range m.Headers {
+		c.Headers[k] = v
+	}
+	return c
+}
+
+// Prepare 发布前填充 ID、时间戳和投递次数，供适配器调用
+func Prepare(m *Message, topic string) {
+	m.Topic = topic
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+	if m.Attempt == 0 {
+		m.Attempt = 1
+	}
+}
+
+// Deliver 调用 handler，handler 没有 Ack/Nack 时根据返回值处理，供适配器调用
+func Deliver(ctx context.Context, h Handler, m *Message) error {
+	err := h(ctx, m)
+	if m.Settled() {
+		return nil
+	}
+	if err != nil {
+		return m.Nack(true)
+	}
+	return m.Ack()
+}
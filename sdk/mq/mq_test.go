@@ -0,0 +1,211 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect 订阅 topic，直到收到 n 条消息
+func collect(t *testing.T, s Subscriber, topic string, n int, h Handler) []*Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var (
+		mu   sync.Mutex
+		msgs []*Message
+	)
+	go s.Subscribe(ctx, topic, func(ctx context.Context, m *Message) error {
+		err := h(ctx, m)
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, m)
+		if len(msgs) == n {
+			cancel()
+		}
+		return err
+	})
+	<-ctx.Done()
+	mu.Lock()
+	defer mu.Unlock()
+	if ctx.Err() == context.DeadlineExceeded {
+		t.Fatalf("received %d of %d messages", len(msgs), n)
+	}
+	return msgs
+}
+
+func ack(context.Context, *Message) error { return nil }
+
+func TestMemoryBroker(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBroker()
+	defer b.Close()
+
+	m := NewMessage([]byte("hello"))
+	m.Key = "k"
+	m.Headers["trace"] = "1"
+	// 还没有订阅者时发布的消息由第一个消费组接收
+	if err := b.Publish(ctx, "orders", m, NewMessage([]byte("world"))); err != nil {
+		t.Fatal(err)
+	}
+	if m.ID == "" || m.Timestamp.IsZero() || m.Attempt != 1 {
+		t.Errorf("message not prepared: %+v", m)
+	}
+	got := collect(t, b.Subscriber("billing", 1), "orders", 2, ack)
+	if string(got[0].Body) != "hello" || got[0].Key != "k" || got[0].Headers["trace"] != "1" || got[0].ID != m.ID {
+		t.Errorf("unexpected message %+v", got[0])
+	}
+	if !got[0].Settled() {
+		t.Error("message not acked after handler returned")
+	}
+
+	// 每个消费组都收到全部消息，组内竞争消费
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu    sync.Mutex
+		stock = make(map[string]int)
+	)
+	for i := 0; i < 2; i++ {
+		go b.Subscriber("stock", 2).Subscribe(ctx, "orders", func(_ context.Context, m *Message) error {
+			mu.Lock()
+			stock[m.ID]++
+			mu.Unlock()
+			return nil
+		})
+	}
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		b.Publish(ctx, "orders", NewMessage([]byte{byte(i)}))
+	}
+	if got = collect(t, b.Subscriber("billing", 2), "orders", 20, ack); len(got) != 20 {
+		t.Errorf("billing got %d", len(got))
+	}
+	deadline := time.Now().Add(time.Second)
+	for b.Pending("orders", "stock") > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(stock) != 20 {
+		t.Errorf("stock group got %d distinct messages", len(stock))
+	}
+	for id, n := range stock {
+		if n != 1 {
+			t.Errorf("message %s delivered %d times in one group", id, n)
+		}
+	}
+}
+
+func TestNack(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBroker()
+	defer b.Close()
+	b.Publish(ctx, "jobs", NewMessage([]byte("retry")), NewMessage([]byte("drop")))
+
+	got := collect(t, b.Subscriber("", 1), "jobs", 4, func(_ context.Context, m *Message) error {
+		switch {
+		case string(m.Body) == "drop":
+			return m.Nack(false)
+		case m.Attempt < 3:
+			// 没有 Ack/Nack 时返回错误自动重新投递
+			return errors.New("temporary")
+		}
+		if err := m.Ack(); err != nil {
+			return err
+		}
+		if err := m.Ack(); err != ErrSettled {
+			t.Errorf("double ack: %v", err)
+		}
+		return nil
+	})
+	var attempts []int
+	for _, m := range got {
+		if string(m.Body) == "retry" {
+			attempts = append(attempts, m.Attempt)
+		}
+	}
+	if len(attempts) != 3 || attempts[2] != 3 {
+		t.Errorf("attempts = %v", attempts)
+	}
+	if n := b.Pending("jobs", ""); n != 0 {
+		t.Errorf("%d messages left", n)
+	}
+}
+
+func TestSubscriberClose(t *testing.T) {
+	b := NewMemoryBroker()
+	s := b.Subscriber("g", 2)
+	done := make(chan error)
+	go func() { done <- s.Subscribe(context.Background(), "t", ack) }()
+	time.Sleep(10 * time.Millisecond)
+	s.Close()
+	select {
+	case err := <-done:
+		if err != ErrClosed {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe did not return after Close")
+	}
+	b.Close()
+	if err := b.Publish(context.Background(), "t", NewMessage(nil)); err != ErrClosed {
+		t.Errorf("publish after close: %v", err)
+	}
+}
+
+func TestConfigDriver(t *testing.T) {
+	cfg := Config{Driver: "memory", Addrs: []string{"test-config"}, Group: "g"}
+	p, err := NewPublisher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	s, err := NewSubscriber(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err = p.Publish(context.Background(), "events", NewMessage([]byte("x"))); err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(t, s, "events", 1, ack); string(got[0].Body) != "x" {
+		t.Errorf("unexpected body %q", got[0].Body)
+	}
+
+	if _, err = NewPublisher(Config{Driver: "pulsar"}); !errors.Is(err, ErrUnknownDriver) {
+		t.Errorf("expected ErrUnknownDriver, got %v", err)
+	}
+	if _, err = (Config{Params: map[string]string{"qos": "x"}}).IntParam("qos", 1); err == nil {
+		t.Error("invalid int param accepted")
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	m := NewMessage([]byte{0, 1, 2})
+	m.Key = "k"
+	m.Headers["h"] = "v"
+	Prepare(m, "t")
+	m.Attempt = 2
+	data, err := Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != m.ID || got.Key != "k" || got.Headers["h"] != "v" || got.Attempt != 2 ||
+		string(got.Body) != string(m.Body) || got.Timestamp.UnixNano()/1e6 != m.Timestamp.UnixNano()/1e6 {
+		t.Errorf("round trip: %+v", got)
+	}
+
+	// 其他发布方的原始消息
+	raw := Decode([]byte(`{"name":"pibigstar"}`))
+	if string(raw.Body) != `{"name":"pibigstar"}` || raw.Attempt != 1 {
+		t.Errorf("raw message: %+v", raw)
+	}
+}
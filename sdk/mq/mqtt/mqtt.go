@@ -0,0 +1,215 @@
+// Package mqtt mq 的 mqtt 适配器，基于 sdk/mqtt 的 Client，断线重连、恢复订阅和离线队列由 Client 处理。
+// MQTT 3.1.1 没有 header，信封编码在 payload 中。
+//
+// Config.Addrs 为 broker 地址，如 tcp://127.0.0.1:1883，
+// Group 不为空时使用共享订阅 $share/<group>/<topic>(需要 broker 支持)，
+// Params: client_id 默认随机生成；username、password；qos 默认 1。
+// MQTT 没有 broker 端的 Nack，Nack(true) 把消息重新发布到原 topic，所有订阅者都会收到
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"go-demo/sdk/mq"
+	sdkmqtt "go-demo/sdk/mqtt"
+)
+
+func init() {
+	mq.Register("mqtt", driver{})
+}
+
+type driver struct{}
+
+func (driver) NewPublisher(cfg mq.Config) (mq.Publisher, error) {
+	client, qos, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewPublisher(client, qos), nil
+}
+
+func (driver) NewSubscriber(cfg mq.Config) (mq.Subscriber, error) {
+	client, qos, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewSubscriber(client, qos, cfg.Group, cfg.Workers()), nil
+}
+
+func connect(cfg mq.Config) (*sdkmqtt.Client, byte, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, 0, errors.New("mqtt: no broker address")
+	}
+	qos, err := cfg.IntParam("qos", 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	if qos < 0 || qos > 2 {
+		return nil, 0, errors.New("mqtt: qos must be 0, 1 or 2")
+	}
+	client := sdkmqtt.NewClient(cfg.Param("client_id", "mq-"+uuid.New().String()),
+		sdkmqtt.WithBroker(cfg.Addrs...),
+		sdkmqtt.WithAuth(cfg.Param("username", ""), cfg.Param("password", "")),
+		sdkmqtt.WithCleanSession(true))
+	if err = client.Connect(); err != nil {
+		return nil, 0, err
+	}
+	return client, byte(qos), nil
+}
+
+type Publisher struct {
+	client *sdkmqtt.Client
+	qos    byte
+}
+
+// NewPublisher 使用已连接的 client，Close 时断开
+func NewPublisher(client *sdkmqtt.Client, qos byte) *Publisher {
+	return &Publisher{client: client, qos: qos}
+}
+
+func (p *Publisher) Publish(ctx context.Context, topic string, msgs ...*mq.Message) error {
+	if topic == "" {
+		return mq.ErrEmptyTopic
+	}
+	for _, m := range msgs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mq.Prepare(m, topic)
+		if err := publish(p.client, p.qos, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) Close() error {
+	p.client.Disconnect()
+	return nil
+}
+
+// publish 断线时消息进入 Client 的离线队列，重连后发送
+func publish(client *sdkmqtt.Client, qos byte, m *mq.Message) error {
+	payload, err := mq.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return client.Publish(m.Topic, qos, false, payload)
+}
+
+type Subscriber struct {
+	client      *sdkmqtt.Client
+	qos         byte
+	group       string
+	concurrency int
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewSubscriber 使用已连接的 client，group 不为空时使用共享订阅，Close 时断开 client
+func NewSubscriber(client *sdkmqtt.Client, qos byte, group string, concurrency int) *Subscriber {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Subscriber{client: client, qos: qos, group: group, concurrency: concurrency, done: make(chan struct{})}
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context, topic string, h mq.Handler) error {
+	if topic == "" {
+		return mq.ErrEmptyTopic
+	}
+	if h == nil {
+		return mq.ErrNilHandler
+	}
+	filter := topic
+	if s.group != "" {
+		filter = "$share/" + s.group + "/" + topic
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Client 在 paho 的回调中调用 handler，不能阻塞太久，交给 worker 处理
+	msgs := make(chan *mq.Message, s.concurrency)
+	callback := func(_ *sdkmqtt.Client, pm *sdkmqtt.Message) {
+		m := mq.Decode(pm.Payload)
+		m.Topic = pm.Topic
+		m.SetAcknowledger(&acker{client: s.client, qos: s.qos})
+		select {
+		case msgs <- m:
+		case <-ctx.Done():
+		}
+	}
+	if err := s.client.Subscribe(filter, s.qos, callback); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, s.concurrency)
+	for i := 0; i < s.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case m := <-msgs:
+					if err := mq.Deliver(ctx, h, m); err != nil {
+						errs <- err
+						cancel()
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-s.done:
+		err = mq.ErrClosed
+		cancel()
+	}
+	wg.Wait()
+	s.client.Unsubscribe(filter)
+	select {
+	case e := <-errs:
+		err = e
+	default:
+	}
+	return err
+}
+
+func (s *Subscriber) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.client.Disconnect()
+	})
+	return nil
+}
+
+type acker struct {
+	client *sdkmqtt.Client
+	qos    byte
+}
+
+// Ack paho 收到消息后已自动确认
+func (a *acker) Ack(*mq.Message) error {
+	return nil
+}
+
+func (a *acker) Nack(m *mq.Message, requeue bool) error {
+	if !requeue {
+		return nil
+	}
+	c := m.Copy()
+	c.Attempt++
+	return publish(a.client, a.qos, c)
+}
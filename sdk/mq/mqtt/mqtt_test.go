@@ -0,0 +1,158 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go-demo/sdk/mq"
+	sdkmqtt "go-demo/sdk/mqtt"
+	"go-demo/sdk/mqtt/broker"
+)
+
+// newTestClient 连接嵌入式 broker
+func newTestClient(t *testing.T, b *broker.Broker, id string) *sdkmqtt.Client {
+	t.Helper()
+	client := sdkmqtt.NewClient(id, sdkmqtt.WithBroker(b.URL()), sdkmqtt.WithCleanSession(true))
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Disconnect)
+	return client
+}
+
+func startBroker(t *testing.T) *broker.Broker {
+	t.Helper()
+	b := broker.New()
+	if err := b.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// subscribe 在后台订阅 topic，收到的消息写入返回的 channel，Subscribe 的返回值写入 errc。
+// 先发布探测消息等待订阅生效，探测消息不写入 channel
+func subscribe(t *testing.T, p *Publisher, s *Subscriber, topic string, h mq.Handler) (msgs <-chan *mq.Message, errc <-chan error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	var (
+		once  sync.Once
+		ready = make(chan struct{})
+		out   = make(chan *mq.Message, 16)
+		errs  = make(chan error, 1)
+	)
+	go func() {
+		errs <- s.Subscribe(ctx, topic, func(ctx context.Context, m *mq.Message) error {
+			if m.Headers["probe"] != "" {
+				once.Do(func() { close(ready) })
+				return nil
+			}
+			err := h(ctx, m)
+			out <- m
+			return err
+		})
+	}()
+
+	deadline := time.After(3 * time.Second)
+	for {
+		probe := mq.NewMessage(nil)
+		probe.Headers["probe"] = "1"
+		if err := p.Publish(ctx, topic, probe); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-ready:
+			return out, errs
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("subscription not ready")
+		}
+	}
+}
+
+func receive(t *testing.T, ch <-chan *mq.Message) *mq.Message {
+	t.Helper()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(3 * time.Second):
+		t.Fatal("message not received")
+	}
+	return nil
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := startBroker(t)
+	p := NewPublisher(newTestClient(t, b, "pub"), 1)
+	s := NewSubscriber(newTestClient(t, b, "sub"), 1, "", 2)
+	msgs, _ := subscribe(t, p, s, "orders/created", func(context.Context, *mq.Message) error { return nil })
+
+	m := mq.NewMessage([]byte("hello"))
+	m.Key = "k"
+	m.Headers["trace"] = "1"
+	if err := p.Publish(context.Background(), "orders/created", m); err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, msgs)
+	if got.ID != m.ID || got.Key != "k" || got.Headers["trace"] != "1" || string(got.Body) != "hello" ||
+		got.Attempt != 1 || got.Topic != "orders/created" || !got.Timestamp.Equal(m.Timestamp.Truncate(time.Millisecond)) {
+		t.Errorf("unexpected message %+v", got)
+	}
+	if err := p.Publish(context.Background(), "orders/#", m); err != sdkmqtt.ErrInvalidTopic {
+		t.Errorf("publish to wildcard topic returned %v", err)
+	}
+}
+
+func TestNack(t *testing.T) {
+	b := startBroker(t)
+	p := NewPublisher(newTestClient(t, b, "pub"), 1)
+	s := NewSubscriber(newTestClient(t, b, "sub"), 1, "", 1)
+	msgs, _ := subscribe(t, p, s, "jobs", func(_ context.Context, m *mq.Message) error {
+		if string(m.Body) == "drop" {
+			return m.Nack(false)
+		}
+		if m.Attempt == 1 {
+			return m.Nack(true)
+		}
+		return nil
+	})
+
+	if err := p.Publish(context.Background(), "jobs", mq.NewMessage([]byte("retry")), mq.NewMessage([]byte("drop"))); err != nil {
+		t.Fatal(err)
+	}
+	// retry 重新发布后投递次数加一，drop 被丢弃
+	got := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		m := receive(t, msgs)
+		got[fmt.Sprintf("%s@%d", m.Body, m.Attempt)] = true
+	}
+	if !got["retry@1"] || !got["retry@2"] || !got["drop@1"] {
+		t.Errorf("unexpected deliveries %v", got)
+	}
+	select {
+	case m := <-msgs:
+		t.Errorf("unexpected message %s attempt %d", m.Body, m.Attempt)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSubscriberClose(t *testing.T) {
+	b := startBroker(t)
+	p := NewPublisher(newTestClient(t, b, "pub"), 1)
+	s := NewSubscriber(newTestClient(t, b, "sub"), 1, "", 1)
+	_, errc := subscribe(t, p, s, "orders", func(context.Context, *mq.Message) error { return nil })
+
+	s.Close()
+	select {
+	case err := <-errc:
+		if err != mq.ErrClosed {
+			t.Errorf("Subscribe returned %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Subscribe did not return after Close")
+	}
+}
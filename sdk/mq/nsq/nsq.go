@@ -0,0 +1,206 @@
+// Package nsq mq 的 nsq 适配器，信封编码在消息体中，投递次数使用 nsqd 记录的 Attempts。
+//
+// Config.Addrs 为 nsqd 的 TCP 地址，Group 为 channel，
+// Params: lookupd 逗号分隔的 nsqlookupd HTTP 地址，设置后消费者通过 lookupd 发现 nsqd；
+// max_in_flight 每个消费者最多同时处理的消息数，默认等于 Concurrency。
+// sdk/nsq 基于 youzan/go-nsq，使用全局的 producer 并给 topic 加环境后缀，这里直接使用 nsqio/go-nsq
+package nsq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	gonsq "github.com/nsqio/go-nsq"
+
+	"go-demo/sdk/mq"
+)
+
+const defaultChannel = "default"
+
+func init() {
+	mq.Register("nsq", driver{})
+}
+
+type driver struct{}
+
+func (driver) NewPublisher(cfg mq.Config) (mq.Publisher, error) {
+	return NewPublisher(cfg.Addrs, gonsq.NewConfig())
+}
+
+func (driver) NewSubscriber(cfg mq.Config) (mq.Subscriber, error) {
+	config := gonsq.NewConfig()
+	maxInFlight, err := cfg.IntParam("max_in_flight", cfg.Workers())
+	if err != nil {
+		return nil, err
+	}
+	config.MaxInFlight = maxInFlight
+
+	var lookupd []string
+	if v := cfg.Param("lookupd", ""); v != "" {
+		lookupd = strings.Split(v, ",")
+	}
+	return NewSubscriber(cfg.Addrs, lookupd, cfg.Group, cfg.Workers(), config), nil
+}
+
+// Publisher 轮流向多个 nsqd 发布
+type Publisher struct {
+	producers []*gonsq.Producer
+	next      uint32
+}
+
+func NewPublisher(addrs []string, config *gonsq.Config) (*Publisher, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("nsq: no nsqd address")
+	}
+	p := &Publisher{}
+	for _, addr := range addrs {
+		producer, err := gonsq.NewProducer(addr, config)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.producers = append(p.producers, producer)
+	}
+	return p, nil
+}
+
+func (p *Publisher) Publish(ctx context.Context, topic string, msgs ...*mq.Message) error {
+	if topic == "" {
+		return mq.ErrEmptyTopic
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	bodies := make([][]byte, 0, len(msgs))
+	for _, m := range msgs {
+		mq.Prepare(m, topic)
+		body, err := mq.Marshal(m)
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, body)
+	}
+	if len(bodies) == 0 {
+		return nil
+	}
+
+	// 失败时换一个 nsqd 重试
+	var err error
+	for i := 0; i < len(p.producers); i++ {
+		producer := p.producers[int(atomic.AddUint32(&p.next, 1))%len(p.producers)]
+		if err = producer.MultiPublish(topic, bodies); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (p *Publisher) Close() error {
+	for _, producer := range p.producers {
+		producer.Stop()
+	}
+	return nil
+}
+
+type Subscriber struct {
+	nsqd        []string
+	lookupd     []string
+	channel     string
+	concurrency int
+	config      *gonsq.Config
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewSubscriber lookupd 不为空时通过 nsqlookupd 发现 nsqd，否则直连 nsqd
+func NewSubscriber(nsqd, lookupd []string, channel string, concurrency int, config *gonsq.Config) *Subscriber {
+	if channel == "" {
+		channel = defaultChannel
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Subscriber{
+		nsqd:        nsqd,
+		lookupd:     lookupd,
+		channel:     channel,
+		concurrency: concurrency,
+		config:      config,
+		done:        make(chan struct{}),
+	}
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context, topic string, h mq.Handler) error {
+	if topic == "" {
+		return mq.ErrEmptyTopic
+	}
+	if h == nil {
+		return mq.ErrNilHandler
+	}
+	consumer, err := gonsq.NewConsumer(topic, s.channel, s.config)
+	if err != nil {
+		return err
+	}
+	consumer.AddConcurrentHandlers(handler(ctx, topic, h), s.concurrency)
+
+	if len(s.lookupd) > 0 {
+		err = consumer.ConnectToNSQLookupds(s.lookupd)
+	} else {
+		err = consumer.ConnectToNSQDs(s.nsqd)
+	}
+	if err != nil {
+		consumer.Stop()
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-s.done:
+		err = mq.ErrClosed
+	}
+	// 等待处理中的消息结束
+	consumer.Stop()
+	<-consumer.StopChan
+	return err
+}
+
+// handler 解码信封后调用 h，由 Ack/Nack 决定 FIN 还是 REQ
+func handler(ctx context.Context, topic string, h mq.Handler) gonsq.HandlerFunc {
+	return func(nm *gonsq.Message) error {
+		nm.DisableAutoResponse()
+		m := mq.Decode(nm.Body)
+		m.Topic = topic
+		m.Attempt = int(nm.Attempts)
+		m.SetAcknowledger(acker{nm})
+		return mq.Deliver(ctx, h, m)
+	}
+}
+
+func (s *Subscriber) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+type acker struct {
+	msg *gonsq.Message
+}
+
+func (a acker) Ack(*mq.Message) error {
+	a.msg.Finish()
+	return nil
+}
+
+// Nack 重新入队使用 nsq 默认的退避延迟
+func (a acker) Nack(_ *mq.Message, requeue bool) error {
+	if requeue {
+		a.msg.Requeue(-1)
+	} else {
+		a.msg.Finish()
+	}
+	return nil
+}
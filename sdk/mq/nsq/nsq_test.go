@@ -0,0 +1,106 @@
+package nsq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gonsq "github.com/nsqio/go-nsq"
+
+	"go-demo/sdk/mq"
+)
+
+// recordDelegate 记录消息的 FIN 和 REQ
+type recordDelegate struct {
+	finished int
+	requeued []time.Duration
+}
+
+func (d *recordDelegate) OnFinish(*gonsq.Message) { d.finished++ }
+
+func (d *recordDelegate) OnRequeue(_ *gonsq.Message, delay time.Duration, _ bool) {
+	d.requeued = append(d.requeued, delay)
+}
+
+func (d *recordDelegate) OnTouch(*gonsq.Message) {}
+
+func newMessage(t *testing.T, m *mq.Message, attempts uint16) (*gonsq.Message, *recordDelegate) {
+	t.Helper()
+	mq.Prepare(m, "orders")
+	body, err := mq.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id gonsq.MessageID
+	copy(id[:], m.ID)
+	nm := gonsq.NewMessage(id, body)
+	nm.Attempts = attempts
+	d := &recordDelegate{}
+	nm.Delegate = d
+	return nm, d
+}
+
+func TestHandler(t *testing.T) {
+	var got *mq.Message
+	h := handler(context.Background(), "orders", func(_ context.Context, m *mq.Message) error {
+		got = m
+		switch string(m.Body) {
+		case "retry":
+			return errors.New("busy")
+		case "drop":
+			return m.Nack(false)
+		}
+		return nil
+	})
+
+	sent := mq.NewMessage([]byte("ok"))
+	sent.Key = "k"
+	sent.Headers["trace"] = "1"
+	nm, d := newMessage(t, sent, 1)
+	if err := h(nm); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != sent.ID || got.Key != "k" || got.Headers["trace"] != "1" || got.Topic != "orders" || got.Attempt != 1 {
+		t.Errorf("unexpected message %+v", got)
+	}
+	if d.finished != 1 || len(d.requeued) != 0 {
+		t.Errorf("ack: finished %d, requeued %v", d.finished, d.requeued)
+	}
+
+	// 投递次数使用 nsqd 记录的 Attempts，失败时使用默认退避重新入队
+	nm, d = newMessage(t, mq.NewMessage([]byte("retry")), 3)
+	if err := h(nm); err != nil {
+		t.Fatal(err)
+	}
+	if got.Attempt != 3 || d.finished != 0 || len(d.requeued) != 1 || d.requeued[0] != -1 {
+		t.Errorf("nack: attempt %d, finished %d, requeued %v", got.Attempt, d.finished, d.requeued)
+	}
+
+	nm, d = newMessage(t, mq.NewMessage([]byte("drop")), 1)
+	if err := h(nm); err != nil {
+		t.Fatal(err)
+	}
+	if d.finished != 1 || len(d.requeued) != 0 {
+		t.Errorf("drop: finished %d, requeued %v", d.finished, d.requeued)
+	}
+}
+
+func TestNewPublisher(t *testing.T) {
+	if _, err := NewPublisher(nil, gonsq.NewConfig()); err == nil {
+		t.Error("expected error without nsqd address")
+	}
+	p, err := NewPublisher([]string{"127.0.0.1:4150"}, gonsq.NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err = p.Publish(context.Background(), "", mq.NewMessage(nil)); err != mq.ErrEmptyTopic {
+		t.Errorf("publish to empty topic returned %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = p.Publish(ctx, "orders", mq.NewMessage(nil)); err != context.Canceled {
+		t.Errorf("publish with cancelled ctx returned %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package outbox
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	Option  func(*options)
+	options struct {
+		pollInterval time.Duration
+		batchSize    int
+		maxAttempts  int
+		backoff      time.Duration
+		maxBackoff   time.Duration
+		leaseName    string
+		leaseOwner   string
+		leaseTTL     time.Duration
+		retention    time.Duration
+		errorHandler func(error)
+		clock        func() time.Time
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	host, _ := os.Hostname()
+	optCopy := &options{
+		pollInterval: time.Second,
+		batchSize:    100,
+		maxAttempts:  10,
+		backoff:      time.Second,
+		maxBackoff:   5 * time.Minute,
+		leaseName:    "default",
+		leaseOwner:   fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.New().String()[:8]),
+		leaseTTL:     30 * time.Second,
+		errorHandler: func(error) {},
+		clock:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.batchSize < 1 {
+		optCopy.batchSize = 1
+	}
+
+	return optCopy
+}
+
+// WithPollInterval sets how often the relay polls the outbox table, default 1s.
+// Relay.Notify publishes right away without waiting for the next poll.
+func WithPollInterval(interval time.Duration) Option {
+	return func(opts *options) {
+		opts.pollInterval = interval
+	}
+}
+
+// WithBatchSize sets the max number of events read per poll, default 100.
+func WithBatchSize(n int) Option {
+	return func(opts *options) {
+		opts.batchSize = n
+	}
+}
+
+// WithMaxAttempts sets how many times an event is published before it is marked failed, default 10.
+// 0 retries forever, which keeps later events with the same key waiting.
+func WithMaxAttempts(n int) Option {
+	return func(opts *options) {
+		opts.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the first and the max delay before a failed event is retried,
+// the delay doubles after every attempt.
+func WithBackoff(backoff, max time.Duration) Option {
+	return func(opts *options) {
+		opts.backoff = backoff
+		opts.maxBackoff = max
+	}
+}
+
+// WithLease sets the lease shared by relays of the same outbox, only the holder publishes.
+// The ttl must be longer than publishing one batch, default "default" and 30s.
+func WithLease(name string, ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.leaseName = name
+		opts.leaseTTL = ttl
+	}
+}
+
+// WithOwner sets the lease owner id of this relay, default hostname-pid-random.
+func WithOwner(owner string) Option {
+	return func(opts *options) {
+		opts.leaseOwner = owner
+	}
+}
+
+// WithRetention deletes published events older than d, default 0 keeps them.
+func WithRetention(d time.Duration) Option {
+	return func(opts *options) {
+		opts.retention = d
+	}
+}
+
+// WithErrorHandler sets the function receiving publish and database errors of Run.
+func WithErrorHandler(fn func(error)) Option {
+	return func(opts *options) {
+		opts.errorHandler = fn
+	}
+}
+
+// WithClock sets the time source, used in tests.
+func WithClock(clock func() time.Time) Option {
+	return func(opts *options) {
+		opts.clock = clock
+	}
+}
@@ -0,0 +1,131 @@
+/**
+ * 事务性 outbox
+ *   1. 业务数据和事件在同一个 gorm 事务中写入，见 Transaction 和 Add，事务回滚时事件也不会发出
+ *   2. Relay 轮询 outbox 表，按写入顺序发布到 mq.Publisher，相同 Key 的事件严格有序
+ *   3. 发布失败的事件退避重试，阻塞同一 Key 的后续事件，超过最大次数后标记为失败
+ *   4. 多个 Relay 通过租约选出一个发布，消息 ID 即事件 ID，消费端用 Once 去重
+ */
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"go-demo/sdk/mq"
+	"go-demo/sdk/mysql/gormx"
+)
+
+var ErrEmptyTopic = errors.New("outbox: topic is empty")
+
+// Event outbox 表中的事件
+type Event struct {
+	ID            uint64 `gorm:"primary_key"`
+	MessageID     string `gorm:"type:varchar(64);unique_index;not null"`
+	Topic         string `gorm:"type:varchar(255);not null"`
+	Key           string `gorm:"column:msg_key;type:varchar(255);index"`
+	Headers       string `gorm:"type:text"`
+	Body          []byte
+	CreatedAt     time.Time
+	Attempts      int
+	NextAttemptAt time.Time  `gorm:"index"`
+	LastError     string     `gorm:"type:text"`
+	PublishedAt   *time.Time `gorm:"index"`
+	FailedAt      *time.Time
+}
+
+func (Event) TableName() string {
+	return "outbox_events"
+}
+
+// Message 转换为发布的消息
+func (e *Event) Message() *mq.Message {
+	m := mq.NewMessage(e.Body)
+	m.ID = e.MessageID
+	m.Key = e.Key
+	m.Timestamp = e.CreatedAt
+	if e.Headers != "" {
+		json.Unmarshal([]byte(e.Headers), &m.Headers)
+	}
+	return m
+}
+
+// Migrate 创建 outbox、租约和消费去重表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Event{}, &lease{}, &Processed{}).Error
+}
+
+// Transaction 在事务中执行 fn，fn 返回错误或 panic 时回滚，见 gormx.Transaction
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return gormx.Transaction(db, fn)
+}
+
+// Add 在业务事务 tx 中写入事件，ID 为空时自动生成，ID 已存在的事件忽略
+func Add(tx *gorm.DB, topic string, msgs ...*mq.Message) error {
+	if topic == "" {
+		return ErrEmptyTopic
+	}
+	for _, m := range msgs {
+		mq.Prepare(m, topic)
+		var count int
+		if err := tx.Model(&Event{}).Where("message_id = ?", m.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		headers, err := json.Marshal(m.Headers)
+		if err != nil {
+			return err
+		}
+		e := &Event{
+			MessageID: m.ID,
+			Topic:     topic,
+			Key:       m.Key,
+			Headers:   string(headers),
+			Body:      m.Body,
+			CreatedAt: m.Timestamp.UTC(),
+		}
+		if err = tx.Create(e).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Processed 消费端已处理的消息
+type Processed struct {
+	Consumer    string `gorm:"primary_key;type:varchar(128)"`
+	MessageID   string `gorm:"primary_key;type:varchar(64)"`
+	ProcessedAt time.Time
+}
+
+func (Processed) TableName() string {
+	return "outbox_processed"
+}
+
+// Once 在事务中执行 fn 并记录 consumer 已处理 msg，重复投递的消息不执行 fn 并返回 false。
+// Relay 发布后标记失败时会重复发布，消费端用 Once 保证业务只执行一次
+func Once(db *gorm.DB, consumer string, msg *mq.Message, fn func(tx *gorm.DB) error) (done bool, err error) {
+	err = Transaction(db, func(tx *gorm.DB) error {
+		var count int
+		if err := tx.Model(&Processed{}).Where("consumer = ? AND message_id = ?", consumer, msg.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		done = true
+		// 并发处理同一条消息时主键冲突，事务回滚，重新投递后跳过
+		return tx.Create(&Processed{Consumer: consumer, MessageID: msg.ID, ProcessedAt: time.Now().UTC()}).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return done, nil
+}
@@ -0,0 +1,397 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"go-demo/sdk/mq"
+	"go-demo/sdk/mysql/gormx/gormtest"
+)
+
+type order struct {
+	ID     uint64 `gorm:"primary_key"`
+	Amount int
+}
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := gormtest.OpenSQLite(t, &order{})
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// fakePublisher 记录发布的消息，failures 中的消息 ID 返回对应次数的错误
+type fakePublisher struct {
+	mu        sync.Mutex
+	published []string
+	failures  map[string]int
+}
+
+func (p *fakePublisher) Publish(_ context.Context, topic string, msgs ...*mq.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, m := range msgs {
+		if p.failures[m.ID] != 0 {
+			if p.failures[m.ID] > 0 {
+				p.failures[m.ID]--
+			}
+			return errors.New("broker unavailable")
+		}
+		p.published = append(p.published, m.ID)
+	}
+	return nil
+}
+
+func (p *fakePublisher) Close() error { return nil }
+
+// slowPublisher 每次发布让时钟前进 step，发布前调用 before
+type slowPublisher struct {
+	*fakePublisher
+	c      *clock
+	step   time.Duration
+	before func()
+}
+
+func (p *slowPublisher) Publish(ctx context.Context, topic string, msgs ...*mq.Message) error {
+	if p.before != nil {
+		p.before()
+	}
+	p.c.now = p.c.now.Add(p.step)
+	return p.fakePublisher.Publish(ctx, topic, msgs...)
+}
+
+func (p *fakePublisher) ids() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.published...)
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func addEvent(t *testing.T, db *gorm.DB, id, key string) {
+	t.Helper()
+	m := mq.NewMessage([]byte(id))
+	m.ID, m.Key = id, key
+	if err := Add(db, "orders", m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAddInTransaction(t *testing.T) {
+	db := openDB(t)
+
+	err := Transaction(db, func(tx *gorm.DB) error {
+		if err := tx.Create(&order{Amount: 100}).Error; err != nil {
+			return err
+		}
+		m := mq.NewMessage([]byte(`{"amount":100}`))
+		m.Key = "user-1"
+		m.Headers["type"] = "order.created"
+		return Add(tx, "orders", m)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 业务失败时事件一起回滚
+	err = Transaction(db, func(tx *gorm.DB) error {
+		tx.Create(&order{Amount: 200})
+		if err := Add(tx, "orders", mq.NewMessage([]byte(`{"amount":200}`))); err != nil {
+			return err
+		}
+		return errors.New("stock not enough")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	var orders, events int
+	db.Model(&order{}).Count(&orders)
+	db.Model(&Event{}).Count(&events)
+	if orders != 1 || events != 1 {
+		t.Fatalf("orders %d, events %d", orders, events)
+	}
+	var e Event
+	db.First(&e)
+	m := e.Message()
+	if e.Topic != "orders" || m.Key != "user-1" || m.Headers["type"] != "order.created" || string(m.Body) != `{"amount":100}` {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	// 相同 ID 的事件只写入一次
+	dup := mq.NewMessage(nil)
+	dup.ID = e.MessageID
+	if err = Add(db, "orders", dup); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&Event{}).Count(&events)
+	if events != 1 {
+		t.Errorf("duplicate event added, %d events", events)
+	}
+	if Add(db, "", mq.NewMessage(nil)) != ErrEmptyTopic {
+		t.Error("expected ErrEmptyTopic")
+	}
+}
+
+func TestRelayOrderAndRetry(t *testing.T) {
+	db := openDB(t)
+	c := &clock{now: time.Now()}
+	pub := &fakePublisher{failures: map[string]int{"a1": 1}}
+	var errs []error
+	r := NewRelay(db, pub, WithClock(c.Now), WithBackoff(time.Second, time.Minute),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }))
+
+	addEvent(t, db, "a1", "a")
+	addEvent(t, db, "a2", "a")
+	addEvent(t, db, "b1", "b")
+
+	// a1 失败，a2 等待 a1，b1 不受影响
+	n, err := r.RelayOnce(context.Background())
+	if err != nil || n != 1 || !equal(pub.ids(), []string{"b1"}) {
+		t.Fatalf("first run published %d %v, %v", n, pub.ids(), err)
+	}
+	var perr *PublishError
+	if len(errs) != 1 || !errors.As(errs[0], &perr) || perr.Event.MessageID != "a1" {
+		t.Errorf("errors %v", errs)
+	}
+	addEvent(t, db, "b2", "b")
+	// 退避时间内 a 仍然被阻塞
+	if n, _ = r.RelayOnce(context.Background()); n != 1 || !equal(pub.ids(), []string{"b1", "b2"}) {
+		t.Fatalf("second run published %v", pub.ids())
+	}
+
+	c.now = c.now.Add(2 * time.Second)
+	if n, _ = r.RelayOnce(context.Background()); n != 2 || !equal(pub.ids(), []string{"b1", "b2", "a1", "a2"}) {
+		t.Fatalf("third run published %v", pub.ids())
+	}
+	var e Event
+	db.Where("message_id = ?", "a1").First(&e)
+	if e.Attempts != 2 || e.PublishedAt == nil || e.LastError != "broker unavailable" {
+		t.Errorf("unexpected event state %+v", e)
+	}
+	if n, _ = r.RelayOnce(context.Background()); n != 0 {
+		t.Errorf("published %d events twice", n)
+	}
+
+	// 超过保留时间的已发布事件被删除
+	r.opts.retention = time.Hour
+	c.now = c.now.Add(2 * time.Hour)
+	if err = r.purge(); err != nil {
+		t.Fatal(err)
+	}
+	var left int
+	db.Model(&Event{}).Count(&left)
+	if left != 0 {
+		t.Errorf("%d events left after purge", left)
+	}
+}
+
+func TestUnkeyedEvents(t *testing.T) {
+	db := openDB(t)
+	c := &clock{now: time.Now()}
+	pub := &fakePublisher{failures: map[string]int{"u1": 1}}
+	r := NewRelay(db, pub, WithClock(c.Now), WithBackoff(time.Second, time.Minute))
+
+	addEvent(t, db, "u1", "")
+	addEvent(t, db, "u2", "")
+	addEvent(t, db, "a1", "a")
+	// 没有 key 的事件失败时不阻塞其他没有 key 的事件
+	if n, err := r.RelayOnce(context.Background()); err != nil || n != 2 || !equal(pub.ids(), []string{"u2", "a1"}) {
+		t.Fatalf("first run published %d %v, %v", n, pub.ids(), err)
+	}
+	addEvent(t, db, "u3", "")
+	if n, err := r.RelayOnce(context.Background()); err != nil || n != 1 || !equal(pub.ids(), []string{"u2", "a1", "u3"}) {
+		t.Fatalf("second run published %d %v, %v", n, pub.ids(), err)
+	}
+	c.now = c.now.Add(2 * time.Second)
+	if n, _ := r.RelayOnce(context.Background()); n != 1 || !equal(pub.ids(), []string{"u2", "a1", "u3", "u1"}) {
+		t.Fatalf("retry published %v", pub.ids())
+	}
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	db := openDB(t)
+	c := &clock{now: time.Now()}
+	pub := &slowPublisher{fakePublisher: &fakePublisher{}, c: c, step: 4 * time.Second}
+	r1 := NewRelay(db, pub, WithClock(c.Now), WithOwner("r1"), WithLease("orders", 10*time.Second))
+	r2 := NewRelay(db, &fakePublisher{}, WithClock(c.Now), WithOwner("r2"), WithLease("orders", 10*time.Second))
+
+	// 一批发布 16s，超过租约时间，中途续约
+	for _, id := range []string{"e1", "e2", "e3", "e4"} {
+		addEvent(t, db, id, "")
+	}
+	if n, err := r1.RelayOnce(context.Background()); n != 4 || err != nil {
+		t.Fatalf("r1 published %d, %v", n, err)
+	}
+	addEvent(t, db, "e5", "")
+	if n, err := r2.RelayOnce(context.Background()); n != 0 || err != nil {
+		t.Fatalf("r2 published %d while r1 renewed the lease, %v", n, err)
+	}
+
+	// 租约在发布过程中被接管后停止发布
+	c.now = c.now.Add(time.Minute)
+	addEvent(t, db, "e6", "")
+	pub.step = 6 * time.Second
+	pub.before = func() {
+		pub.before = nil
+		db.Model(&lease{}).Where("name = ?", "orders").
+			Updates(map[string]interface{}{"owner": "r2", "expires_at": c.now.Add(time.Hour)})
+	}
+	if n, err := r1.RelayOnce(context.Background()); n != 1 || err != nil {
+		t.Fatalf("r1 published %d after losing the lease, %v", n, err)
+	}
+	if !equal(pub.ids(), []string{"e1", "e2", "e3", "e4", "e5"}) {
+		t.Errorf("r1 published %v", pub.ids())
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	db := openDB(t)
+	c := &clock{now: time.Now()}
+	pub := &fakePublisher{failures: map[string]int{"poison": -1}}
+	r := NewRelay(db, pub, WithClock(c.Now), WithMaxAttempts(2), WithBackoff(time.Second, time.Second))
+
+	addEvent(t, db, "poison", "k")
+	addEvent(t, db, "next", "k")
+	for i := 0; i < 2; i++ {
+		if _, err := r.RelayOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		c.now = c.now.Add(2 * time.Second)
+	}
+	// 第二次失败后标记为失败，同一 key 的后续事件继续发布
+	if _, err := r.RelayOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !equal(pub.ids(), []string{"next"}) {
+		t.Fatalf("published %v", pub.ids())
+	}
+	failed, err := r.Failed()
+	if err != nil || len(failed) != 1 || failed[0].MessageID != "poison" || failed[0].Attempts != 2 {
+		t.Fatalf("failed events %+v, %v", failed, err)
+	}
+
+	pub.failures = nil
+	if err = r.Retry(failed[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.RelayOnce(context.Background()); n != 1 || !equal(pub.ids(), []string{"next", "poison"}) {
+		t.Errorf("retried %v", pub.ids())
+	}
+}
+
+func TestLease(t *testing.T) {
+	db := openDB(t)
+	c := &clock{now: time.Now()}
+	pub1, pub2 := &fakePublisher{}, &fakePublisher{}
+	r1 := NewRelay(db, pub1, WithClock(c.Now), WithOwner("r1"), WithLease("orders", 10*time.Second))
+	r2 := NewRelay(db, pub2, WithClock(c.Now), WithOwner("r2"), WithLease("orders", 10*time.Second))
+
+	addEvent(t, db, "e1", "")
+	if n, err := r1.RelayOnce(context.Background()); n != 1 || err != nil {
+		t.Fatalf("r1 published %d, %v", n, err)
+	}
+	addEvent(t, db, "e2", "")
+	if n, err := r2.RelayOnce(context.Background()); n != 0 || err != nil {
+		t.Fatalf("r2 published %d without the lease, %v", n, err)
+	}
+
+	// r1 停止续约，租约过期后 r2 接管
+	c.now = c.now.Add(11 * time.Second)
+	if n, err := r2.RelayOnce(context.Background()); n != 1 || err != nil {
+		t.Fatalf("r2 published %d after the lease expired, %v", n, err)
+	}
+	if n, _ := r1.RelayOnce(context.Background()); n != 0 {
+		t.Error("r1 should lose the lease")
+	}
+	r2.release()
+	addEvent(t, db, "e3", "")
+	if n, _ := r1.RelayOnce(context.Background()); n != 1 {
+		t.Error("r1 should take the released lease")
+	}
+	if !equal(pub1.ids(), []string{"e1", "e3"}) || !equal(pub2.ids(), []string{"e2"}) {
+		t.Errorf("r1 %v, r2 %v", pub1.ids(), pub2.ids())
+	}
+}
+
+func TestRunWithBroker(t *testing.T) {
+	db := openDB(t)
+	broker := mq.NewMemoryBroker()
+	defer broker.Close()
+	r := NewRelay(db, broker, WithPollInterval(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relayed := make(chan error, 1)
+	go func() { relayed <- r.Run(ctx) }()
+
+	var (
+		mu      sync.Mutex
+		handled []string
+	)
+	got := make(chan struct{}, 10)
+	sub := broker.Subscriber("billing", 1)
+	go sub.Subscribe(ctx, "orders", func(_ context.Context, m *mq.Message) error {
+		_, err := Once(db, "billing", m, func(tx *gorm.DB) error {
+			mu.Lock()
+			handled = append(handled, string(m.Body))
+			mu.Unlock()
+			return tx.Create(&order{Amount: len(m.Body)}).Error
+		})
+		got <- struct{}{}
+		return err
+	})
+
+	addEvent(t, db, "e1", "")
+	// 轮询间隔很长，Notify 后立即发布
+	r.Notify()
+	select {
+	case <-got:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event not relayed")
+	}
+
+	// 重复发布的消息只处理一次
+	var e Event
+	db.First(&e)
+	if err := broker.Publish(context.Background(), "orders", e.Message()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-got:
+	case <-time.After(2 * time.Second):
+		t.Fatal("duplicate not delivered")
+	}
+	mu.Lock()
+	if len(handled) != 1 {
+		t.Errorf("handled %v", handled)
+	}
+	mu.Unlock()
+
+	cancel()
+	if err := <-relayed; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+}
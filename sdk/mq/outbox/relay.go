@@ -0,0 +1,215 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"go-demo/sdk/mq"
+	"go-demo/utils/retry"
+)
+
+// lease 多个 Relay 之间的租约，持有者才发布
+type lease struct {
+	Name      string `gorm:"primary_key;type:varchar(64)"`
+	Owner     string `gorm:"type:varchar(128)"`
+	ExpiresAt time.Time
+}
+
+func (lease) TableName() string {
+	return "outbox_leases"
+}
+
+// PublishError 事件发布失败
+type PublishError struct {
+	Event *Event
+	Err   error
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("outbox: publish event %d to %s (attempt %d): %v", e.Event.ID, e.Event.Topic, e.Event.Attempts, e.Err)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+type Relay struct {
+	db   *gorm.DB
+	pub  mq.Publisher
+	opts *options
+	wake chan struct{}
+}
+
+// NewRelay 把 db 中的事件发布到 pub，表需要先通过 Migrate 创建
+func NewRelay(db *gorm.DB, pub mq.Publisher, opts ...Option) *Relay {
+	return &Relay{db: db, pub: pub, opts: evaluateOptions(opts), wake: make(chan struct{}, 1)}
+}
+
+// Notify 唤醒 Run 立即发布，在写入事件的事务提交后调用
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 轮询发布事件，阻塞直到 ctx 取消，退出时释放租约
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opts.pollInterval)
+	defer ticker.Stop()
+	defer r.release()
+	for {
+		for {
+			n, err := r.RelayOnce(ctx)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				r.opts.errorHandler(err)
+			}
+			// 一批读满时还有积压，继续发布
+			if err != nil || n < r.opts.batchSize {
+				break
+			}
+		}
+		if err := r.purge(); err != nil {
+			r.opts.errorHandler(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// RelayOnce 发布一批到期的事件，返回成功发布的数量，没有持有租约时返回 0
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	ok, err := r.acquire()
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	now := r.now()
+	// 发布一批可能超过租约时间，过半时续约
+	renewAt := now.Add(r.opts.leaseTTL / 2)
+	// 有事件在等待重试的 key 整体跳过，保证同一 key 的顺序，没有 key 的事件之间不要求顺序
+	var events []Event
+	err = r.db.Where("published_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+		Where("msg_key NOT IN (SELECT msg_key FROM outbox_events WHERE published_at IS NULL AND failed_at IS NULL AND msg_key <> '' AND next_attempt_at > ?)", now).
+		Order("id").Limit(r.opts.batchSize).Find(&events).Error
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	blocked := make(map[string]bool)
+	for i := range events {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+		e := &events[i]
+		if e.Key != "" && blocked[e.Key] {
+			continue
+		}
+		if r.now().After(renewAt) {
+			// 续约失败说明租约已被其他 Relay 接管，停止发布
+			if ok, err = r.acquire(); err != nil || !ok {
+				return n, err
+			}
+			renewAt = r.now().Add(r.opts.leaseTTL / 2)
+		}
+		if perr := r.pub.Publish(ctx, e.Topic, e.Message()); perr != nil {
+			if e.Key != "" {
+				blocked[e.Key] = true
+			}
+			if err = r.fail(e, perr, now); err != nil {
+				return n, err
+			}
+			continue
+		}
+		err = r.db.Model(e).Updates(map[string]interface{}{"attempts": e.Attempts + 1, "published_at": now}).Error
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// fail 记录失败并计算下次重试时间，超过最大次数后标记为失败，同一 key 的后续事件继续发布
+func (r *Relay) fail(e *Event, cause error, now time.Time) error {
+	e.Attempts++
+	updates := map[string]interface{}{
+		"attempts":        e.Attempts,
+		"last_error":      cause.Error(),
+		"next_attempt_at": now.Add(retry.Backoff(r.opts.backoff, r.opts.maxBackoff, e.Attempts)),
+	}
+	if r.opts.maxAttempts > 0 && e.Attempts >= r.opts.maxAttempts {
+		updates["failed_at"] = now
+	}
+	r.opts.errorHandler(&PublishError{Event: e, Err: cause})
+	return r.db.Model(e).Updates(updates).Error
+}
+
+// Retry 把标记为失败的事件重新放回队列
+func (r *Relay) Retry(ids ...uint64) error {
+	return r.db.Model(&Event{}).Where("id IN (?) AND failed_at IS NOT NULL", ids).
+		Updates(map[string]interface{}{"failed_at": gorm.Expr("NULL"), "attempts": 0, "next_attempt_at": r.now()}).Error
+}
+
+// Failed 标记为失败的事件
+func (r *Relay) Failed() ([]Event, error) {
+	var events []Event
+	err := r.db.Where("failed_at IS NOT NULL").Order("id").Find(&events).Error
+	return events, err
+}
+
+// acquire 获取或续约租约
+func (r *Relay) acquire() (bool, error) {
+	now := r.now()
+	res := r.db.Model(&lease{}).
+		Where("name = ? AND (owner = ? OR expires_at < ?)", r.opts.leaseName, r.opts.leaseOwner, now).
+		Updates(map[string]interface{}{"owner": r.opts.leaseOwner, "expires_at": now.Add(r.opts.leaseTTL)})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return true, nil
+	}
+	var l lease
+	err := r.db.Where("name = ?", r.opts.leaseName).First(&l).Error
+	if err == nil {
+		// MySQL 中更新的值没有变化时 RowsAffected 为 0
+		return l.Owner == r.opts.leaseOwner && !l.ExpiresAt.Before(now), nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return false, err
+	}
+	// 第一次使用时插入租约，多个 Relay 同时插入时只有一个成功
+	if err = r.db.Create(&lease{Name: r.opts.leaseName, Owner: r.opts.leaseOwner, ExpiresAt: now.Add(r.opts.leaseTTL)}).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// release 释放租约，其他 Relay 不用等待过期
+func (r *Relay) release() {
+	r.db.Model(&lease{}).Where("name = ? AND owner = ?", r.opts.leaseName, r.opts.leaseOwner).
+		Update("expires_at", time.Time{})
+}
+
+func (r *Relay) purge() error {
+	if r.opts.retention <= 0 {
+		return nil
+	}
+	return r.db.Where("published_at < ?", r.now().Add(-r.opts.retention)).Delete(&Event{}).Error
+}
+
+func (r *Relay) now() time.Time {
+	return r.opts.clock().UTC()
+}
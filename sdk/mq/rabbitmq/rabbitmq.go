@@ -0,0 +1,287 @@
+// Package rabbitmq mq 的 rabbitmq 适配器，基于 sdk/rabbitmq 的 Client，
+// 断线重连、publisher confirm 和失败重试都由 Client 处理。
+// topic 对应 topic 交换机上的 routing key，每个消费组一个持久化队列 "<group>.<topic>"，
+// 信封字段放在 AMQP 属性和 header 中。
+//
+// Config.Addrs[0] 为 amqp url，Params: exchange 交换机名，默认 "mq"；
+// prefetch 每个消费者未确认消息上限，默认等于 Concurrency。
+// Nack(true) 把消息交给 Client 延迟重试，回到本组队列时投递次数加一，
+// 超过重试次数或 Nack(false) 的消息进入死信队列 "<group>.<topic>.err"。
+// Ack/Nack 需要在 handler 返回前调用
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/streadway/amqp"
+
+	"go-demo/sdk/mq"
+	rabbit "go-demo/sdk/rabbitmq"
+)
+
+const (
+	headerKey       = "x-mq-key"
+	defaultExchange = "mq"
+	defaultGroup    = "default"
+)
+
+var errNacked = errors.New("rabbitmq: message nacked")
+
+func init() {
+	mq.Register("rabbitmq", driver{})
+}
+
+type driver struct{}
+
+func (driver) NewPublisher(cfg mq.Config) (mq.Publisher, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("rabbitmq: no url")
+	}
+	client, err := rabbit.NewClient(cfg.Addrs[0])
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPublisher(client, cfg.Param("exchange", defaultExchange))
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	p.ownClient = true
+	return p, nil
+}
+
+func (driver) NewSubscriber(cfg mq.Config) (mq.Subscriber, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("rabbitmq: no url")
+	}
+	prefetch, err := cfg.IntParam("prefetch", cfg.Workers())
+	if err != nil {
+		return nil, err
+	}
+	client, err := rabbit.NewClient(cfg.Addrs[0])
+	if err != nil {
+		return nil, err
+	}
+	s := NewSubscriber(client, cfg.Param("exchange", defaultExchange), cfg.Group,
+		rabbit.WithConcurrency(cfg.Workers()), rabbit.WithPrefetch(prefetch))
+	s.ownClient = true
+	return s, nil
+}
+
+// Publisher Publish 返回时消息已被 broker 确认，连接断开时等待重连后重试
+type Publisher struct {
+	client    *rabbit.Client
+	exchange  string
+	ownClient bool
+}
+
+// NewPublisher 使用已连接的 client，声明 topic 交换机 exchange
+func NewPublisher(client *rabbit.Client, exchange string) (*Publisher, error) {
+	if err := client.DeclareExchange(exchange, amqp.ExchangeTopic); err != nil {
+		return nil, err
+	}
+	return &Publisher{client: client, exchange: exchange}, nil
+}
+
+func (p *Publisher) Publish(ctx context.Context, topic string, msgs ...*mq.Message) error {
+	if topic == "" {
+		return mq.ErrEmptyTopic
+	}
+	for _, m := range msgs {
+		mq.Prepare(m, topic)
+		if err := p.client.Publish(ctx, p.exchange, topic, toPublishing(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 只关闭由 driver 创建的 client
+func (p *Publisher) Close() error {
+	if p.ownClient {
+		return p.client.Close()
+	}
+	return nil
+}
+
+func toPublishing(m *mq.Message) amqp.Publishing {
+	headers := amqp.Table{}
+	// 投递次数记录为 Client 的重试次数，消费时换算回 Attempt
+	if m.Attempt > 1 {
+		headers[rabbit.HeaderRetryCount] = int32(m.Attempt - 1)
+	}
+	if m.Key != "" {
+		headers[headerKey] = m.Key
+	}
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	return amqp.Publishing{
+		Headers:      headers,
+		MessageId:    m.ID,
+		Timestamp:    m.Timestamp,
+		DeliveryMode: amqp.Persistent,
+		Body:         m.Body,
+	}
+}
+
+type Subscriber struct {
+	client    *rabbit.Client
+	exchange  string
+	group     string
+	opts      []rabbit.ConsumeOption
+	ownClient bool
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewSubscriber 使用已连接的 client，opts 设置并发数、prefetch 和重试策略
+func NewSubscriber(client *rabbit.Client, exchange, group string, opts ...rabbit.ConsumeOption) *Subscriber {
+	if group == "" {
+		group = defaultGroup
+	}
+	return &Subscriber{
+		client:   client,
+		exchange: exchange,
+		group:    group,
+		opts:     opts,
+		done:     make(chan struct{}),
+	}
+}
+
+// QueueName 消费组在 topic 上的队列名
+func (s *Subscriber) QueueName(topic string) string {
+	return s.group + "." + topic
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context, topic string, h mq.Handler) error {
+	if topic == "" {
+		return mq.ErrEmptyTopic
+	}
+	if h == nil {
+		return mq.ErrNilHandler
+	}
+	queue := s.QueueName(topic)
+	if err := s.client.Bind(s.exchange, amqp.ExchangeTopic, queue, topic); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := s.client.Consume(ctx, queue, func(ctx context.Context, d amqp.Delivery) error {
+		return deliver(ctx, h, topic, d)
+	}, s.opts...)
+
+	select {
+	case <-s.done:
+		return mq.ErrClosed
+	default:
+	}
+	if err == rabbit.ErrClosed {
+		return mq.ErrClosed
+	}
+	return err
+}
+
+func (s *Subscriber) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if s.ownClient {
+			err = s.client.Close()
+		}
+	})
+	return err
+}
+
+// deliver 调用 handler，把 Ack/Nack 转换为 Client 的处理结果
+func deliver(ctx context.Context, h mq.Handler, topic string, d amqp.Delivery) error {
+	m := fromDelivery(topic, &d)
+	a := &acker{}
+	m.SetAcknowledger(a)
+	var err error
+	mq.Deliver(ctx, func(ctx context.Context, m *mq.Message) error {
+		err = h(ctx, m)
+		return err
+	}, m)
+	return a.result(err)
+}
+
+func fromDelivery(topic string, d *amqp.Delivery) *mq.Message {
+	m := &mq.Message{
+		ID:        d.MessageId,
+		Topic:     topic,
+		Headers:   make(map[string]string, len(d.Headers)),
+		Body:      d.Body,
+		Timestamp: d.Timestamp,
+		Attempt:   rabbit.RetryCount(*d) + 1,
+	}
+	for k, v := range d.Headers {
+		if k == headerKey {
+			m.Key, _ = v.(string)
+			continue
+		}
+		if s, ok := v.(string); ok {
+			m.Headers[k] = s
+		}
+	}
+	// broker 重新投递但重试次数没有增加，如消费者断开后的重投
+	if d.Redelivered && m.Attempt == 1 {
+		m.Attempt = 2
+	}
+	if m.ID == "" {
+		m.ID = d.ConsumerTag + "-" + strconv.FormatUint(d.DeliveryTag, 10)
+	}
+	return m
+}
+
+const (
+	acked int32 = iota
+	requeued
+	rejected
+)
+
+// acker 记录 Ack/Nack 的结果，handler 返回后由 deliver 交给 Client
+type acker struct {
+	state int32
+}
+
+func (a *acker) Ack(*mq.Message) error {
+	atomic.StoreInt32(&a.state, acked)
+	return nil
+}
+
+func (a *acker) Nack(_ *mq.Message, requeue bool) error {
+	state := rejected
+	if requeue {
+		state = requeued
+	}
+	atomic.StoreInt32(&a.state, state)
+	return nil
+}
+
+// result 返回 nil 时 Client ack，返回错误时延迟重试，Permanent 包装的错误进入死信队列
+func (a *acker) result(err error) error {
+	if err == nil {
+		err = errNacked
+	}
+	switch atomic.LoadInt32(&a.state) {
+	case requeued:
+		return err
+	case rejected:
+		return rabbit.Permanent(err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"go-demo/sdk/mq"
+	rabbit "go-demo/sdk/rabbitmq"
+	"go-demo/sdk/rabbitmq/rabbitmqtest"
+)
+
+func newTestClient(t *testing.T, b *rabbitmqtest.Broker) *rabbit.Client {
+	t.Helper()
+	c, err := rabbit.NewClient("amqp://test", rabbit.WithDialer(b.Dial), rabbit.WithReconnectDelay(5*time.Millisecond, 20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// collect 订阅 topic，直到收到 n 条消息
+func collect(t *testing.T, s *Subscriber, topic string, n int, h mq.Handler) []*mq.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var (
+		mu   sync.Mutex
+		msgs []*mq.Message
+	)
+	go s.Subscribe(ctx, topic, func(ctx context.Context, m *mq.Message) error {
+		err := h(ctx, m)
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, m)
+		if len(msgs) == n {
+			cancel()
+		}
+		return err
+	})
+	<-ctx.Done()
+	mu.Lock()
+	defer mu.Unlock()
+	if ctx.Err() == context.DeadlineExceeded {
+		t.Fatalf("received %d of %d messages", len(msgs), n)
+	}
+	return msgs
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := rabbitmqtest.NewBroker()
+	c := newTestClient(t, b)
+	p, err := NewPublisher(c, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	billing := NewSubscriber(c, "events", "billing")
+	stock := NewSubscriber(c, "events", "")
+	// 先声明队列，之后发布的消息每个消费组都会收到
+	for _, s := range []*Subscriber{billing, stock} {
+		if err = c.Bind("events", amqp.ExchangeTopic, s.QueueName("orders"), "orders"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := mq.NewMessage([]byte("hello"))
+	m.Key = "k"
+	m.Headers["trace"] = "1"
+	if err = p.Publish(context.Background(), "orders", m); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(b.Messages("default.orders")); n != 1 {
+		t.Fatalf("%d messages in default.orders", n)
+	}
+
+	for _, s := range []*Subscriber{billing, stock} {
+		got := collect(t, s, "orders", 1, func(context.Context, *mq.Message) error { return nil })[0]
+		if got.ID != m.ID || got.Key != "k" || got.Headers["trace"] != "1" || len(got.Headers) != 1 ||
+			string(got.Body) != "hello" || got.Attempt != 1 || got.Topic != "orders" {
+			t.Errorf("unexpected message %+v", got)
+		}
+	}
+	if left := b.Messages("billing.orders"); len(left) != 0 {
+		t.Errorf("%d messages left, acked message should be removed", len(left))
+	}
+}
+
+func TestNack(t *testing.T) {
+	b := rabbitmqtest.NewBroker()
+	c := newTestClient(t, b)
+	p, err := NewPublisher(c, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSubscriber(c, "events", "billing", rabbit.WithRetryDelays(10*time.Millisecond))
+	if err = c.Bind("events", amqp.ExchangeTopic, s.QueueName("orders"), "orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Publish(context.Background(), "orders", mq.NewMessage([]byte("retry")), mq.NewMessage([]byte("drop"))); err != nil {
+		t.Fatal(err)
+	}
+	// retry 第一次返回错误，延迟后重新投递；drop 直接进入死信队列
+	got := collect(t, s, "orders", 3, func(_ context.Context, m *mq.Message) error {
+		if string(m.Body) == "drop" {
+			return m.Nack(false)
+		}
+		if m.Attempt == 1 {
+			return errors.New("busy")
+		}
+		return nil
+	})
+	var attempts []int
+	for _, m := range got {
+		if string(m.Body) == "retry" {
+			attempts = append(attempts, m.Attempt)
+		}
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("retry attempts %v", attempts)
+	}
+	dead := b.WaitMessages(t, "billing.orders.err", 1)
+	if string(dead[0].Body) != "drop" || dead[0].Headers[rabbit.HeaderError] != errNacked.Error() {
+		t.Errorf("unexpected dead letter %+v", dead[0])
+	}
+}
+
+func TestSubscriberClose(t *testing.T) {
+	b := rabbitmqtest.NewBroker()
+	s := NewSubscriber(newTestClient(t, b), "events", "billing")
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Subscribe(context.Background(), "orders", func(context.Context, *mq.Message) error { return nil })
+	}()
+	b.WaitQueue(t, "billing.orders")
+	s.Close()
+	select {
+	case err := <-errc:
+		if err != mq.ErrClosed {
+			t.Errorf("Subscribe returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscribe did not return after Close")
+	}
+}
@@ -0,0 +1,455 @@
+/**
+ * 嵌入式 Mqtt 3.1.1 broker，用于本地开发和测试
+ *   1. Start("") 监听 127.0.0.1 的随机端口，URL 返回客户端使用的地址
+ *   2. 支持 QoS 0/1（QoS 2 的连接会被断开）、保留消息、+ 和 # 通配符、遗嘱消息
+ *   3. clean session 断开后清除；持久会话保留订阅、未确认和离线期间的 QoS 1 消息，重连后按顺序补发
+ *   4. 通过 WithAuth 或 WithUsers 校验用户名密码
+ * 所有状态都在内存中，broker 关闭后丢失
+ */
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"go-demo/sdk/mqtt/internal/topic"
+)
+
+var ErrClosed = errors.New("mqtt broker: closed")
+
+type Broker struct {
+	opts *options
+
+	mu       sync.Mutex
+	ln       net.Listener
+	closed   bool
+	sessions map[string]*session
+	retained map[string]*packets.PublishPacket
+	clients  map[*client]struct{}
+	wg       sync.WaitGroup
+	autoID   uint64
+}
+
+func New(opts ...Option) *Broker {
+	return &Broker{
+		opts:     evaluateOptions(opts),
+		sessions: make(map[string]*session),
+		retained: make(map[string]*packets.PublishPacket),
+		clients:  make(map[*client]struct{}),
+	}
+}
+
+// Start 在 addr 上监听并在后台处理连接，addr 为空时监听 127.0.0.1 的随机端口
+func (b *Broker) Start(addr string) error {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		ln.Close()
+		return ErrClosed
+	}
+	b.ln = ln
+	go b.serve(ln)
+	return nil
+}
+
+// Serve 处理 ln 上的连接，阻塞直到 ln 关闭或 broker 关闭
+func (b *Broker) Serve(ln net.Listener) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		ln.Close()
+		return ErrClosed
+	}
+	b.ln = ln
+	b.mu.Unlock()
+	return b.serve(ln)
+}
+
+func (b *Broker) serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if b.closed {
+				return ErrClosed
+			}
+			return err
+		}
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			conn.Close()
+			return ErrClosed
+		}
+		c := &client{conn: conn, writeTimeout: b.opts.writeTimeout}
+		b.clients[c] = struct{}{}
+		b.wg.Add(1)
+		b.mu.Unlock()
+		go b.handle(c)
+	}
+}
+
+// Addr 监听的地址，没有启动时返回空
+func (b *Broker) Addr() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ln == nil {
+		return ""
+	}
+	return b.ln.Addr().String()
+}
+
+// URL 客户端连接使用的地址，如 tcp://127.0.0.1:1883
+func (b *Broker) URL() string {
+	return "tcp://" + b.Addr()
+}
+
+// Close 停止监听并断开所有连接，不发送遗嘱消息
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	var err error
+	if b.ln != nil {
+		err = b.ln.Close()
+	}
+	for c := range b.clients {
+		c.conn.Close()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+	return err
+}
+
+// client 一个网络连接，持久会话在连接之间复用
+type client struct {
+	conn         net.Conn
+	writeTimeout time.Duration
+	wmu          sync.Mutex
+	// 以下字段由 Broker.mu 保护
+	session *session
+	will    *packets.PublishPacket
+}
+
+func (c *client) write(p packets.ControlPacket) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.writeLocked(p)
+}
+
+// writeLocked 调用方持有 wmu，写失败时关闭连接，读循环随之退出
+func (c *client) writeLocked(p packets.ControlPacket) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	if err := p.Write(c.conn); err != nil {
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+func (b *Broker) handle(c *client) {
+	graceful := false
+	defer func() {
+		b.disconnect(c, graceful)
+		c.conn.Close()
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+		b.wg.Done()
+	}()
+
+	c.conn.SetReadDeadline(time.Now().Add(b.opts.connectTimeout))
+	p, err := packets.ReadPacket(c.conn)
+	if err != nil {
+		b.opts.errorHandler(err)
+		return
+	}
+	// 第一个包必须是 CONNECT
+	cp, ok := p.(*packets.ConnectPacket)
+	if !ok {
+		b.opts.errorHandler(fmt.Errorf("mqtt broker: expect CONNECT from %s, got %T", c.conn.RemoteAddr(), p))
+		return
+	}
+	rc := cp.Validate()
+	if rc == packets.Accepted && !b.opts.auth(cp.ClientIdentifier, cp.Username, string(cp.Password)) {
+		rc = packets.ErrRefusedBadUsernameOrPassword
+	}
+	if rc != packets.Accepted {
+		ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+		ack.ReturnCode = rc
+		c.write(ack)
+		return
+	}
+	if err = b.connect(c, cp); err != nil {
+		b.opts.errorHandler(err)
+		return
+	}
+
+	keepAlive := time.Duration(cp.Keepalive) * time.Second
+	for {
+		deadline := time.Time{}
+		if keepAlive > 0 {
+			// 超过 1.5 倍 keep alive 没有收到任何包时断开
+			deadline = time.Now().Add(keepAlive * 3 / 2)
+		}
+		c.conn.SetReadDeadline(deadline)
+		p, err := packets.ReadPacket(c.conn)
+		if err != nil {
+			return
+		}
+		switch p := p.(type) {
+		case *packets.PublishPacket:
+			if p.Qos > 1 || !topic.ValidTopic(p.TopicName) {
+				b.opts.errorHandler(fmt.Errorf("mqtt broker: unsupported publish to %q with qos %d", p.TopicName, p.Qos))
+				return
+			}
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				c.write(ack)
+			}
+			b.publish(p)
+		case *packets.PubackPacket:
+			b.ack(c, p.MessageID)
+		case *packets.SubscribePacket:
+			b.subscribe(c, p)
+		case *packets.UnsubscribePacket:
+			b.unsubscribe(c, p)
+		case *packets.PingreqPacket:
+			c.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			graceful = true
+			return
+		default:
+			b.opts.errorHandler(fmt.Errorf("mqtt broker: unexpected %T", p))
+			return
+		}
+	}
+}
+
+// connect 绑定会话，回复 CONNACK 后补发未确认和离线期间的消息。
+// 持有 wmu 直到补发完成，之后的新消息排在补发的消息之后
+func (b *Broker) connect(c *client, cp *packets.ConnectPacket) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	b.mu.Lock()
+	id := cp.ClientIdentifier
+	if id == "" {
+		b.autoID++
+		id = fmt.Sprintf("auto-%d", b.autoID)
+	}
+	if cp.WillFlag {
+		will := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+		will.TopicName = cp.WillTopic
+		will.Payload = cp.WillMessage
+		will.Qos = cp.WillQos
+		if will.Qos > 1 {
+			will.Qos = 1
+		}
+		will.Retain = cp.WillRetain
+		c.will = will
+	}
+
+	s := b.sessions[id]
+	if s != nil && s.client != nil {
+		// 相同 ClientID 的新连接踢掉旧连接
+		s.client.conn.Close()
+	}
+	if s != nil && (cp.CleanSession || s.clean) {
+		s = nil
+	}
+	present := s != nil
+	if s == nil {
+		s = newSession(id, cp.CleanSession)
+		b.sessions[id] = s
+	}
+	s.client = c
+	c.session = s
+	pending := s.resume()
+	b.mu.Unlock()
+
+	ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+	ack.SessionPresent = present
+	if err := c.writeLocked(ack); err != nil {
+		return err
+	}
+	for _, p := range pending {
+		if err := c.writeLocked(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// disconnect 解绑会话，clean session 直接删除，非正常断开时发布遗嘱
+func (b *Broker) disconnect(c *client, graceful bool) {
+	b.mu.Lock()
+	if s := c.session; s != nil && s.client == c {
+		s.client = nil
+		// 被新连接替换的会话已经不在 sessions 中
+		if s.clean && b.sessions[s.id] == s {
+			delete(b.sessions, s.id)
+		}
+	}
+	will := c.will
+	c.will = nil
+	closed := b.closed
+	b.mu.Unlock()
+
+	if !graceful && !closed && will != nil {
+		b.publish(will)
+	}
+}
+
+type delivery struct {
+	client *client
+	packet *packets.PublishPacket
+}
+
+// publish 保存保留消息并投递给所有匹配的会话，离线的持久会话只保存 QoS 1 消息
+func (b *Broker) publish(p *packets.PublishPacket) {
+	b.mu.Lock()
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.TopicName)
+		} else {
+			r := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+			r.TopicName, r.Payload, r.Qos = p.TopicName, p.Payload, p.Qos
+			b.retained[p.TopicName] = r
+		}
+	}
+	var out []delivery
+	for _, s := range b.sessions {
+		qos, ok := s.granted(p.TopicName)
+		if !ok {
+			continue
+		}
+		if p.Qos < qos {
+			qos = p.Qos
+		}
+		if s.client == nil {
+			if qos > 0 {
+				s.enqueue(s.message(p.TopicName, p.Payload, qos, false), b.opts.maxQueued)
+			}
+			continue
+		}
+		m := s.message(p.TopicName, p.Payload, qos, false)
+		if qos > 0 {
+			s.inflight = append(s.inflight, m)
+		}
+		out = append(out, delivery{client: s.client, packet: m})
+	}
+	b.mu.Unlock()
+
+	for _, d := range out {
+		d.client.write(d.packet)
+	}
+}
+
+func (b *Broker) ack(c *client, id uint16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s := c.session; s != nil && s.client == c {
+		s.ack(id)
+	}
+}
+
+// subscribe 回复 SUBACK 后发送匹配的保留消息，最高授予 QoS 1，非法的 filter 返回 0x80
+func (b *Broker) subscribe(c *client, p *packets.SubscribePacket) {
+	ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	ack.MessageID = p.MessageID
+
+	b.mu.Lock()
+	s := c.session
+	if s == nil || s.client != c {
+		b.mu.Unlock()
+		return
+	}
+	var retained []*packets.PublishPacket
+	for i, filter := range p.Topics {
+		if !topic.ValidFilter(filter) {
+			ack.ReturnCodes = append(ack.ReturnCodes, 0x80)
+			continue
+		}
+		qos := p.Qoss[i]
+		if qos > 1 {
+			qos = 1
+		}
+		s.subs[filter] = qos
+		ack.ReturnCodes = append(ack.ReturnCodes, qos)
+		for name, r := range b.retained {
+			if !topic.Match(filter, name) {
+				continue
+			}
+			q := qos
+			if r.Qos < q {
+				q = r.Qos
+			}
+			m := s.message(name, r.Payload, q, true)
+			if q > 0 {
+				s.inflight = append(s.inflight, m)
+			}
+			retained = append(retained, m)
+		}
+	}
+	b.mu.Unlock()
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.writeLocked(ack) != nil {
+		return
+	}
+	for _, m := range retained {
+		if c.writeLocked(m) != nil {
+			return
+		}
+	}
+}
+
+func (b *Broker) unsubscribe(c *client, p *packets.UnsubscribePacket) {
+	b.mu.Lock()
+	if s := c.session; s != nil && s.client == c {
+		for _, filter := range p.Topics {
+			delete(s.subs, filter)
+		}
+	}
+	b.mu.Unlock()
+
+	ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+	ack.MessageID = p.MessageID
+	c.write(ack)
+}
+
+// Retained 当前 topic 上的保留消息，没有时返回 nil
+func (b *Broker) Retained(topic string) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r, ok := b.retained[topic]; ok {
+		return r.Payload
+	}
+	return nil
+}
+
+// Sessions 当前保存的会话数，包括离线的持久会话
+func (b *Broker) Sessions() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.sessions)
+}
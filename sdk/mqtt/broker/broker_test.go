@@ -0,0 +1,305 @@
+package broker
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	gomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func startBroker(t *testing.T, opts ...Option) *Broker {
+	t.Helper()
+	b := New(opts...)
+	if err := b.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+type testClient struct {
+	gomqtt.Client
+	received chan gomqtt.Message
+}
+
+func dial(t *testing.T, b *Broker, id string, clean bool) (*testClient, error) {
+	t.Helper()
+	c := &testClient{received: make(chan gomqtt.Message, 100)}
+	opts := gomqtt.NewClientOptions().
+		AddBroker(b.URL()).
+		SetClientID(id).
+		SetUsername("user").
+		SetPassword("secret").
+		SetProtocolVersion(4).
+		SetCleanSession(clean).
+		SetAutoReconnect(false).
+		SetDefaultPublishHandler(func(_ gomqtt.Client, msg gomqtt.Message) {
+			c.received <- msg
+		})
+	c.Client = gomqtt.NewClient(opts)
+	token := c.Connect()
+	token.Wait()
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { c.Disconnect(0) })
+	return c, nil
+}
+
+func connect(t *testing.T, b *Broker, id string, clean bool) *testClient {
+	t.Helper()
+	c, err := dial(t, b, id, clean)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (c *testClient) subscribe(t *testing.T, filter string, qos byte) {
+	t.Helper()
+	token := c.Subscribe(filter, qos, nil)
+	if token.Wait(); token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+}
+
+func (c *testClient) publish(t *testing.T, topic string, qos byte, retained bool, payload string) {
+	t.Helper()
+	token := c.Publish(topic, qos, retained, payload)
+	if token.Wait(); token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+}
+
+func (c *testClient) receive(t *testing.T) gomqtt.Message {
+	t.Helper()
+	select {
+	case msg := <-c.received:
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatal("message not received")
+	}
+	return nil
+}
+
+func (c *testClient) nothing(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-c.received:
+		t.Fatalf("unexpected message %s %s", msg.Topic(), msg.Payload())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := startBroker(t)
+	sub := connect(t, b, "sub", true)
+	pub := connect(t, b, "pub", true)
+	sub.subscribe(t, "home/+/temp", 1)
+	sub.subscribe(t, "home/#", 0)
+
+	// 重叠的订阅只收到一次，QoS 取订阅中最大的
+	pub.publish(t, "home/kitchen/temp", 1, false, "21")
+	if msg := sub.receive(t); msg.Topic() != "home/kitchen/temp" || string(msg.Payload()) != "21" || msg.Qos() != 1 {
+		t.Errorf("unexpected message %s %s qos %d", msg.Topic(), msg.Payload(), msg.Qos())
+	}
+	sub.nothing(t)
+
+	// 投递的 QoS 不超过发布的 QoS
+	pub.publish(t, "home/kitchen/light", 0, false, "on")
+	if msg := sub.receive(t); msg.Topic() != "home/kitchen/light" || msg.Qos() != 0 {
+		t.Errorf("unexpected message %s qos %d", msg.Topic(), msg.Qos())
+	}
+	pub.publish(t, "office/temp", 1, false, "25")
+	sub.nothing(t)
+
+	token := sub.Unsubscribe("home/#")
+	token.Wait()
+	pub.publish(t, "home/kitchen/light", 1, false, "off")
+	sub.nothing(t)
+
+	// QoS 2 不支持，连接被断开
+	pub.Publish("home/kitchen/temp", 2, false, "22")
+	for i := 0; pub.IsConnectionOpen(); i++ {
+		if i == 100 {
+			t.Fatal("qos 2 publisher not disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRetained(t *testing.T) {
+	b := startBroker(t)
+	pub := connect(t, b, "pub", true)
+	pub.publish(t, "status/a", 1, true, "online")
+	pub.publish(t, "status/b", 0, true, "offline")
+	pub.publish(t, "status/c", 1, false, "not retained")
+
+	sub := connect(t, b, "sub", true)
+	sub.subscribe(t, "status/+", 1)
+	got := map[string]byte{}
+	for i := 0; i < 2; i++ {
+		msg := sub.receive(t)
+		if !msg.Retained() {
+			t.Errorf("%s should be retained", msg.Topic())
+		}
+		got[string(msg.Payload())] = msg.Qos()
+	}
+	sub.nothing(t)
+	if got["online"] != 1 || got["offline"] != 0 || len(got) != 2 {
+		t.Errorf("retained messages %v", got)
+	}
+
+	// 实时投递的消息不带保留标记
+	pub.publish(t, "status/a", 1, true, "busy")
+	if msg := sub.receive(t); msg.Retained() || string(msg.Payload()) != "busy" {
+		t.Errorf("unexpected message %s retained %v", msg.Payload(), msg.Retained())
+	}
+	if string(b.Retained("status/a")) != "busy" {
+		t.Errorf("retained %q", b.Retained("status/a"))
+	}
+
+	// 空消息清除保留消息
+	pub.publish(t, "status/a", 1, true, "")
+	sub.receive(t)
+	if b.Retained("status/a") != nil {
+		t.Error("retained message not cleared")
+	}
+}
+
+func TestPersistentSession(t *testing.T) {
+	b := startBroker(t)
+	pub := connect(t, b, "pub", true)
+
+	sub := connect(t, b, "persistent", false)
+	sub.subscribe(t, "orders/#", 1)
+	sub.Disconnect(100)
+	if b.Sessions() != 2 {
+		t.Fatalf("sessions %d", b.Sessions())
+	}
+
+	// 离线期间只保存 QoS 1 消息
+	pub.publish(t, "orders/1", 1, false, "1")
+	pub.publish(t, "orders/2", 0, false, "2")
+	pub.publish(t, "orders/3", 1, false, "3")
+
+	sub = connect(t, b, "persistent", false)
+	for _, want := range []string{"orders/1", "orders/3"} {
+		if msg := sub.receive(t); msg.Topic() != want {
+			t.Fatalf("expected %s, got %s", want, msg.Topic())
+		}
+	}
+	sub.nothing(t)
+	// 订阅保留在会话中
+	pub.publish(t, "orders/4", 1, false, "4")
+	sub.receive(t)
+}
+
+func TestCleanSession(t *testing.T) {
+	b := startBroker(t)
+	pub := connect(t, b, "pub", true)
+
+	sub := connect(t, b, "clean", true)
+	sub.subscribe(t, "orders/#", 1)
+	sub.Disconnect(100)
+	for i := 0; b.Sessions() != 1; i++ {
+		if i == 100 {
+			t.Fatalf("clean session not removed, sessions %d", b.Sessions())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	pub.publish(t, "orders/1", 1, false, "1")
+
+	sub = connect(t, b, "clean", true)
+	sub.nothing(t)
+	pub.publish(t, "orders/2", 1, false, "2")
+	sub.nothing(t)
+}
+
+func TestAuth(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		clientIDs []string
+	)
+	b := startBroker(t, WithAuth(func(clientID, username, password string) bool {
+		mu.Lock()
+		clientIDs = append(clientIDs, clientID)
+		mu.Unlock()
+		return username == "user" && password == "secret"
+	}))
+	if _, err := dial(t, b, "good", true); err != nil {
+		t.Fatal(err)
+	}
+
+	b2 := startBroker(t, WithUsers(map[string]string{"user": "wrong"}))
+	if _, err := dial(t, b2, "bad", true); err == nil {
+		t.Fatal("expected auth error")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(clientIDs) != 1 || clientIDs[0] != "good" {
+		t.Errorf("auth called with %v", clientIDs)
+	}
+}
+
+func TestWill(t *testing.T) {
+	b := startBroker(t)
+	sub := connect(t, b, "sub", true)
+	sub.subscribe(t, "clients/+/status", 1)
+
+	conn, err := net.Dial("tcp", b.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+	cp.ProtocolName, cp.ProtocolVersion = "MQTT", 4
+	cp.ClientIdentifier = "device"
+	cp.CleanSession = true
+	cp.WillFlag, cp.WillQos, cp.WillTopic, cp.WillMessage = true, 1, "clients/device/status", []byte("gone")
+	if err = cp.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := packets.ReadPacket(conn); err != nil || p.(*packets.ConnackPacket).ReturnCode != packets.Accepted {
+		t.Fatalf("connack %v, %v", p, err)
+	}
+
+	// 没有发送 DISCONNECT 直接断开时发布遗嘱
+	conn.Close()
+	if msg := sub.receive(t); msg.Topic() != "clients/device/status" || string(msg.Payload()) != "gone" {
+		t.Errorf("unexpected will %s %s", msg.Topic(), msg.Payload())
+	}
+
+	// 正常断开不发布遗嘱
+	conn, _ = net.Dial("tcp", b.Addr())
+	cp.Write(conn)
+	packets.ReadPacket(conn)
+	packets.NewControlPacket(packets.Disconnect).Write(conn)
+	conn.Close()
+	sub.nothing(t)
+}
+
+func TestClose(t *testing.T) {
+	b := New()
+	if err := b.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	c := connect(t, b, "c", true)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; c.IsConnectionOpen(); i++ {
+		if i == 100 {
+			t.Fatal("client still connected after close")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := dial(t, b, "d", true); err == nil {
+		t.Error("connected to a closed broker")
+	}
+	if b.Start("") != ErrClosed {
+		t.Error("expected ErrClosed")
+	}
+}
@@ -0,0 +1,71 @@
+package broker
+
+import "time"
+
+// AuthFunc 校验客户端的用户名和密码，返回 false 时拒绝连接
+type AuthFunc func(clientID, username, password string) bool
+
+type (
+	Option  func(*options)
+	options struct {
+		auth           AuthFunc
+		maxQueued      int
+		connectTimeout time.Duration
+		writeTimeout   time.Duration
+		errorHandler   func(error)
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		auth:           func(string, string, string) bool { return true },
+		maxQueued:      1000,
+		connectTimeout: 10 * time.Second,
+		writeTimeout:   10 * time.Second,
+		errorHandler:   func(error) {},
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+// WithAuth sets the hook checking CONNECT credentials, default accepts everyone.
+func WithAuth(fn AuthFunc) Option {
+	return func(opts *options) {
+		opts.auth = fn
+	}
+}
+
+// WithUsers only accepts the given username/password pairs.
+func WithUsers(users map[string]string) Option {
+	return WithAuth(func(_, username, password string) bool {
+		p, ok := users[username]
+		return ok && p == password
+	})
+}
+
+// WithMaxQueued sets how many QoS 1 messages are kept for an offline persistent session, default 1000.
+// The oldest message is dropped when the queue is full.
+func WithMaxQueued(n int) Option {
+	return func(opts *options) {
+		opts.maxQueued = n
+	}
+}
+
+// WithTimeout sets how long to wait for CONNECT after accepting a connection
+// and how long a write to a client may block, default 10s and 10s.
+func WithTimeout(connect, write time.Duration) Option {
+	return func(opts *options) {
+		opts.connectTimeout = connect
+		opts.writeTimeout = write
+	}
+}
+
+// WithErrorHandler sets the function receiving connection errors, default discards them.
+func WithErrorHandler(fn func(error)) Option {
+	return func(opts *options) {
+		opts.errorHandler = fn
+	}
+}
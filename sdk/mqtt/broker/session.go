@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"go-demo/sdk/mqtt/internal/topic"
+)
+
+// session 客户端会话，所有字段由 Broker.mu 保护
+type session struct {
+	id     string
+	clean  bool
+	client *client // 离线时为 nil
+	subs   map[string]byte
+	// inflight 已发送未确认的 QoS 1 消息，queue 离线期间收到的 QoS 1 消息，都按发送顺序排列
+	inflight []*packets.PublishPacket
+	queue    []*packets.PublishPacket
+	nextID   uint16
+}
+
+func newSession(id string, clean bool) *session {
+	return &session{id: id, clean: clean, subs: make(map[string]byte)}
+}
+
+// granted 匹配 topic 的订阅中最大的 QoS，重叠的订阅只投递一次
+func (s *session) granted(name string) (byte, bool) {
+	qos, ok := byte(0), false
+	for filter, q := range s.subs {
+		if topic.Match(filter, name) {
+			ok = true
+			if q > qos {
+				qos = q
+			}
+		}
+	}
+	return qos, ok
+}
+
+// message 创建发给该会话的消息，QoS 1 消息分配报文 ID
+func (s *session) message(topic string, payload []byte, qos byte, retain bool) *packets.PublishPacket {
+	m := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	m.TopicName = topic
+	m.Payload = payload
+	m.Qos = qos
+	m.Retain = retain
+	if qos > 0 {
+		s.nextID++
+		if s.nextID == 0 {
+			s.nextID = 1
+		}
+		m.MessageID = s.nextID
+	}
+	return m
+}
+
+// enqueue 保存离线消息，队列满时丢弃最早的消息
+func (s *session) enqueue(m *packets.PublishPacket, max int) {
+	if max <= 0 {
+		return
+	}
+	if len(s.queue) >= max {
+		s.queue = s.queue[1:]
+	}
+	s.queue = append(s.queue, m)
+}
+
+// resume 重连后需要补发的消息，未确认的消息标记为重复发送，离线消息转为未确认
+func (s *session) resume() []*packets.PublishPacket {
+	for i, m := range s.inflight {
+		// 旧连接可能还在写这个包，复制后再修改
+		dup := *m
+		dup.Dup = true
+		s.inflight[i] = &dup
+	}
+	s.inflight = append(s.inflight, s.queue...)
+	s.queue = nil
+	pending := make([]*packets.PublishPacket, len(s.inflight))
+	copy(pending, s.inflight)
+	return pending
+}
+
+func (s *session) ack(id uint16) {
+	for i, m := range s.inflight {
+		if m.MessageID == id {
+			s.inflight = append(s.inflight[:i], s.inflight[i+1:]...)
+			return
+		}
+	}
+}
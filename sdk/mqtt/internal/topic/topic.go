@@ -0,0 +1,49 @@
+// Package topic MQTT topic 和订阅 filter 的匹配与校验，客户端和嵌入式 broker 共用
+package topic
+
+import "strings"
+
+// Match 判断 topic 是否匹配订阅的 filter，支持 + 单层和 # 多层通配符，
+// $ 开头的系统 topic 不匹配首层通配符
+func Match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			// a/# 同时匹配 a
+			return i == len(fs)-1
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+// ValidFilter 检查订阅 filter 的通配符位置是否合法
+func ValidFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+	fs := strings.Split(filter, "/")
+	for i, f := range fs {
+		if f == "#" && i != len(fs)-1 {
+			return false
+		}
+		if f != "#" && f != "+" && strings.ContainsAny(f, "#+") {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidTopic 发布的 topic 不能为空也不能包含通配符
+func ValidTopic(topic string) bool {
+	return topic != "" && !strings.ContainsAny(topic, "#+")
+}
@@ -1,156 +1,347 @@
+/**
+ * Mqtt 客户端
+ *   1. 通过 Option 配置 broker 地址、认证、会话和超时，见 option.go
+ *   2. 每个 topic filter 可以单独注册 Handler，支持 + 和 # 通配符，一条消息分发给所有匹配的 Handler
+ *   3. 消息体通过 Codec 编解码，内置 JSON、Proto 和 Raw
+ *   4. 断线期间发布的消息进入有界的离线队列，重连后先恢复订阅再按顺序发送
+ */
 package mqtt
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
-	"strings"
 	"sync"
 	"time"
 
 	gomqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
-const (
-	Host     = "192.168.1.101:8000"
-	UserName = "pibigstar"
-	Password = "123456"
+var (
+	ErrNotConnected  = errors.New("mqtt: not connected")
+	ErrQueueFull     = errors.New("mqtt: offline queue is full")
+	ErrTimeout       = errors.New("mqtt: wait timeout")
+	ErrInvalidTopic  = errors.New("mqtt: invalid topic")
+	ErrInvalidFilter = errors.New("mqtt: invalid topic filter")
+	ErrNilHandler    = errors.New("mqtt: handler is nil")
 )
 
+// Handler 处理订阅收到的消息
+type Handler func(c *Client, msg *Message)
+
+// Message 收到的消息
+type Message struct {
+	Topic     string
+	Payload   []byte
+	QoS       byte
+	Retained  bool
+	Duplicate bool
+	MessageID uint16
+
+	codec Codec
+}
+
+// Decode 用客户端的 Codec 解码消息体
+func (m *Message) Decode(v interface{}) error {
+	return m.codec.Unmarshal(m.Payload, v)
+}
+
+type route struct {
+	filter  string
+	qos     byte
+	handler Handler
+}
+
+// pending 离线队列中等待发送的消息
+type pending struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
 type Client struct {
 	nativeClient  gomqtt.Client
 	clientOptions *gomqtt.ClientOptions
-	locker        *sync.Mutex
-	// 消息收到之后处理函数
-	observer func(c *Client, msg *Message)
-}
+	opts          *options
 
-type Message struct {
-	ClientID string `json:"clientId"`
-	Type     string `json:"type"`
-	Data     string `json:"data,omitempty"`
-	Time     int64  `json:"time"`
+	locker   sync.Mutex
+	routes   []*route
+	queue    []*pending
+	flushing bool
 }
 
-func NewClient(clientId string) *Client {
+func NewClient(clientId string, opts ...Option) *Client {
+	client := &Client{opts: evaluateOptions(opts)}
+
 	clientOptions := gomqtt.NewClientOptions().
-		AddBroker(Host).
-		SetUsername(UserName).
-		SetPassword(Password).
 		SetClientID(clientId).
-		SetCleanSession(false).
+		// 固定使用 3.1.1，认证失败时 paho 不再降级到 3.1 重试
+		SetProtocolVersion(4).
+		SetUsername(client.opts.username).
+		SetPassword(client.opts.password).
+		SetCleanSession(client.opts.cleanSession).
 		SetAutoReconnect(true).
-		SetKeepAlive(120 * time.Second).
-		SetPingTimeout(10 * time.Second).
-		SetWriteTimeout(10 * time.Second).
-		SetOnConnectHandler(func(client gomqtt.Client) {
-			// 连接被建立后的回调函数
-			fmt.Println("Mqtt is connected!", "clientId", clientId)
-		}).
-		SetConnectionLostHandler(func(client gomqtt.Client, err error) {
-			// 连接被关闭后的回调函数
-			fmt.Println("Mqtt is disconnected!", "clientId", clientId, "reason", err.Error())
+		SetMaxReconnectInterval(client.opts.maxReconnectInterval).
+		SetKeepAlive(client.opts.keepAlive).
+		SetPingTimeout(client.opts.pingTimeout).
+		SetWriteTimeout(client.opts.writeTimeout).
+		SetConnectTimeout(client.opts.connectTimeout).
+		SetTLSConfig(client.opts.tlsConfig).
+		// 订阅时不注册 paho 的路由，所有消息走 dispatch 按 filter 分发
+		SetDefaultPublishHandler(client.dispatch).
+		SetOnConnectHandler(client.onConnect).
+		SetConnectionLostHandler(func(_ gomqtt.Client, err error) {
+			if client.opts.onConnectionLost != nil {
+				client.opts.onConnectionLost(client, err)
+			}
 		})
-
-	nativeClient := gomqtt.NewClient(clientOptions)
-
-	return &Client{
-		nativeClient:  nativeClient,
-		clientOptions: clientOptions,
-		locker:        &sync.Mutex{},
+	for _, broker := range client.opts.brokers {
+		clientOptions.AddBroker(broker)
 	}
+
+	client.nativeClient = gomqtt.NewClient(clientOptions)
+	client.clientOptions = clientOptions
+	return client
 }
 
 func (client *Client) GetClientID() string {
 	return client.clientOptions.ClientID
 }
 
+// Connect 连接 broker，之后断线会自动重连
 func (client *Client) Connect() error {
-	return client.ensureConnected()
+	if client.nativeClient.IsConnected() {
+		return nil
+	}
+	return waitToken(client.nativeClient.Connect(), client.opts.connectTimeout)
 }
 
-// 确保连接
-func (client *Client) ensureConnected() error {
-	if !client.nativeClient.IsConnected() {
-		client.locker.Lock()
-		defer client.locker.Unlock()
-		if !client.nativeClient.IsConnected() {
-			if token := client.nativeClient.Connect(); token.Wait() && token.Error() != nil {
-				return token.Error()
-			}
+// IsConnected 连接是否可用，重连期间返回 false
+func (client *Client) IsConnected() bool {
+	return client.nativeClient.IsConnectionOpen()
+}
+
+// Disconnect 断开连接，离线队列中未发送的消息会丢弃
+func (client *Client) Disconnect() {
+	client.nativeClient.Disconnect(250)
+	client.locker.Lock()
+	client.queue = nil
+	client.locker.Unlock()
+}
+
+// onConnect 连接建立后恢复订阅并发送离线消息，paho 在单独的 goroutine 中调用
+func (client *Client) onConnect(_ gomqtt.Client) {
+	client.locker.Lock()
+	routes := make([]route, len(client.routes))
+	for i, r := range client.routes {
+		routes[i] = *r
+	}
+	client.locker.Unlock()
+
+	for _, r := range routes {
+		// 失败时连接已经断开，下次重连会再次订阅
+		if err := client.wait(client.nativeClient.Subscribe(r.filter, r.qos, nil)); err != nil {
+			return
 		}
 	}
-	return nil
+	client.flush()
+
+	if client.opts.onConnect != nil {
+		client.opts.onConnect(client)
+	}
 }
 
 // 发布消息
 // retained: 是否保留信息
+// 断线时消息进入离线队列并返回 nil，队列已满时返回 ErrQueueFull
 func (client *Client) Publish(topic string, qos byte, retained bool, data []byte) error {
-	if err := client.ensureConnected(); err != nil {
-		return err
+	if !ValidTopic(topic) {
+		return ErrInvalidTopic
 	}
+	p := &pending{topic: topic, qos: qos, retained: retained, payload: data}
 
-	token := client.nativeClient.Publish(topic, qos, retained, data)
-	if err := token.Error(); err != nil {
+	client.locker.Lock()
+	// 离线队列没有发完时新消息也要排队，保证顺序
+	connected := client.nativeClient.IsConnectionOpen()
+	if client.flushing || len(client.queue) > 0 || !connected {
+		err := client.enqueue(p)
+		// 连接正常时 flush 超时失败，队列不会等到重连才发送
+		retry := connected && !client.flushing
+		client.locker.Unlock()
+		if retry {
+			go client.flush()
+		}
 		return err
 	}
+	client.locker.Unlock()
+
+	err := client.send(p)
+	if err == gomqtt.ErrNotConnected {
+		client.locker.Lock()
+		defer client.locker.Unlock()
+		return client.enqueue(p)
+	}
+	return err
+}
 
-	// return false is the timeout occurred
-	if !token.WaitTimeout(time.Second * 10) {
-		return errors.New("mqtt publish wait timeout")
+// PublishValue 用客户端的 Codec 编码 v 后发布
+func (client *Client) PublishValue(topic string, qos byte, retained bool, v interface{}) error {
+	data, err := client.opts.codec.Marshal(v)
+	if err != nil {
+		return err
 	}
+	return client.Publish(topic, qos, retained, data)
+}
 
+// Queued 离线队列中的消息数
+func (client *Client) Queued() int {
+	client.locker.Lock()
+	defer client.locker.Unlock()
+	return len(client.queue)
+}
+
+func (client *Client) enqueue(p *pending) error {
+	if client.opts.queueSize <= 0 {
+		return ErrNotConnected
+	}
+	if len(client.queue) >= client.opts.queueSize {
+		return ErrQueueFull
+	}
+	client.queue = append(client.queue, p)
 	return nil
 }
 
-// 消费消息
-func (client *Client) Subscribe(observer func(c *Client, msg *Message), qos byte, topics ...string) error {
-	if len(topics) == 0 {
-		return errors.New("the topic is empty")
+// flush 按顺序发送离线队列，发送成功后才出队，失败时留给下次重连或连接正常时的下一次 Publish
+func (client *Client) flush() {
+	client.locker.Lock()
+	if client.flushing {
+		client.locker.Unlock()
+		return
+	}
+	client.flushing = true
+	for len(client.queue) > 0 {
+		p := client.queue[0]
+		client.locker.Unlock()
+		if err := client.send(p); err != nil {
+			client.locker.Lock()
+			break
+		}
+		client.locker.Lock()
+		// Disconnect 可能已经清空队列
+		if len(client.queue) > 0 && client.queue[0] == p {
+			client.queue = client.queue[1:]
+		}
 	}
+	client.flushing = false
+	client.locker.Unlock()
+}
+
+func (client *Client) send(p *pending) error {
+	return client.wait(client.nativeClient.Publish(p.topic, p.qos, p.retained, p.payload))
+}
+
+func (client *Client) wait(token gomqtt.Token) error {
+	return waitToken(token, client.opts.writeTimeout)
+}
 
-	if observer == nil {
-		return errors.New("the observer func is nil")
+// waitToken 等待 token 完成。paho 的 WaitTimeout 等待时持有 token 的锁，
+// 出错时 setError 拿不到锁，要等到超时才返回，这里改用 Wait
+func waitToken(token gomqtt.Token, timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		token.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return token.Error()
+	case <-timer.C:
+		return ErrTimeout
 	}
+}
 
-	if client.observer != nil {
-		return errors.New("an existing observer subscribed on this client, you must unsubscribe it before you subscribe a new observer")
+// Subscribe 为 filter 注册 Handler，同一个 filter 再次订阅时替换 Handler。
+// 连接建立前订阅的 filter 在连接后生效，重连后自动恢复
+func (client *Client) Subscribe(filter string, qos byte, handler Handler) error {
+	if !ValidFilter(filter) {
+		return ErrInvalidFilter
+	}
+	if handler == nil {
+		return ErrNilHandler
 	}
-	client.observer = observer
 
-	filters := make(map[string]byte)
-	for _, topic := range topics {
-		filters[topic] = qos
+	client.locker.Lock()
+	exists := false
+	for _, r := range client.routes {
+		if r.filter == filter {
+			r.qos, r.handler = qos, handler
+			exists = true
+		}
+	}
+	if !exists {
+		client.routes = append(client.routes, &route{filter: filter, qos: qos, handler: handler})
 	}
-	client.nativeClient.SubscribeMultiple(filters, client.messageHandler)
+	client.locker.Unlock()
 
-	return nil
+	if !client.nativeClient.IsConnectionOpen() {
+		return nil
+	}
+	// 失败时 Handler 仍然保留，重连后再次订阅
+	return client.wait(client.nativeClient.Subscribe(filter, qos, nil))
 }
 
-func (client *Client) messageHandler(c gomqtt.Client, msg gomqtt.Message) {
-	if client.observer == nil {
-		fmt.Println("not subscribe message observer")
-		return
+// Unsubscribe 取消订阅并移除对应的 Handler
+func (client *Client) Unsubscribe(filters ...string) error {
+	if len(filters) == 0 {
+		return nil
 	}
-	message, err := decodeMessage(msg.Payload())
-	if err != nil {
-		fmt.Println("failed to decode message")
-		return
+	client.removeRoutes(filters...)
+	if !client.nativeClient.IsConnectionOpen() {
+		return nil
 	}
-	client.observer(client, message)
+	return client.wait(client.nativeClient.Unsubscribe(filters...))
 }
 
-func decodeMessage(payload []byte) (*Message, error) {
-	message := new(Message)
-	decoder := json.NewDecoder(strings.NewReader(string(payload)))
-	decoder.UseNumber()
-	if err := decoder.Decode(&message); err != nil {
-		return nil, err
+func (client *Client) removeRoutes(filters ...string) {
+	client.locker.Lock()
+	defer client.locker.Unlock()
+	routes := client.routes[:0]
+	for _, r := range client.routes {
+		remove := false
+		for _, f := range filters {
+			if r.filter == f {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			routes = append(routes, r)
+		}
 	}
-	return message, nil
+	client.routes = routes
 }
 
-func (client *Client) Unsubscribe(topics ...string) {
-	client.observer = nil
-	client.nativeClient.Unsubscribe(topics...)
+// dispatch 把消息分发给所有匹配的 Handler
+func (client *Client) dispatch(_ gomqtt.Client, msg gomqtt.Message) {
+	client.locker.Lock()
+	var handlers []Handler
+	for _, r := range client.routes {
+		if Match(r.filter, msg.Topic()) {
+			handlers = append(handlers, r.handler)
+		}
+	}
+	client.locker.Unlock()
+
+	for _, h := range handlers {
+		h(client, &Message{
+			Topic:     msg.Topic(),
+			Payload:   msg.Payload(),
+			QoS:       msg.Qos(),
+			Retained:  msg.Retained(),
+			Duplicate: msg.Duplicate(),
+			MessageID: msg.MessageID(),
+			codec:     client.opts.codec,
+		})
+	}
 }
@@ -1,52 +1,358 @@
 package mqtt
 
 import (
-	"encoding/json"
-	"fmt"
-	"os"
+	"io"
+	"net"
 	"sync"
 	"testing"
 	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"go-demo/sdk/mqtt/broker"
 )
 
-func TestMqtt(t *testing.T) {
-	hostname, _ := os.Hostname()
-	if hostname == "pibigstar" {
-		var (
-			clientId = hostname
-			wg       sync.WaitGroup
-		)
-		client := NewClient(clientId)
-		err := client.Connect()
-		if err != nil {
-			t.Errorf(err.Error())
+// startBroker 启动嵌入式 broker，addr 为空时使用随机端口
+func startBroker(t *testing.T, addr string) *broker.Broker {
+	t.Helper()
+	b := broker.New(broker.WithUsers(map[string]string{"user": "secret"}))
+	if err := b.Start(addr); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func newTestClient(t *testing.T, b *broker.Broker, id string, opts ...Option) *Client {
+	t.Helper()
+	opts = append([]Option{WithBroker(b.URL()), WithAuth("user", "secret"), WithMaxReconnectInterval(time.Second)}, opts...)
+	client := NewClient(id, opts...)
+	t.Cleanup(client.Disconnect)
+	return client
+}
+
+func receive(t *testing.T, ch <-chan *Message) *Message {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatal("message not received")
+	}
+	return nil
+}
+
+func nothing(t *testing.T, ch <-chan *Message) {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected message %s", msg.Topic)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func collect(ch chan *Message) Handler {
+	return func(_ *Client, msg *Message) {
+		ch <- msg
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		filter, topic string
+		match         bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/+/c", "a/b/c", true},
+		{"a/#", "a", true},
+		{"a/#", "a/b/c", true},
+		{"#", "a/b", true},
+		{"+/+", "/a", true},
+		{"#", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+		{"$share/g/a/+", "a/b", true},
+	}
+	for _, c := range cases {
+		if Match(c.filter, c.topic) != c.match {
+			t.Errorf("Match(%q, %q) should be %v", c.filter, c.topic, c.match)
+		}
+	}
+	for _, filter := range []string{"", "a/#/b", "a/b#", "a+/b"} {
+		if ValidFilter(filter) {
+			t.Errorf("filter %q should be invalid", filter)
+		}
+	}
+}
+
+func TestRouting(t *testing.T) {
+	b := startBroker(t, "")
+	client := newTestClient(t, b, "routing")
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	temp, all := make(chan *Message, 10), make(chan *Message, 10)
+	if err := client.Subscribe("sensor/+/temp", 1, collect(temp)); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Subscribe("sensor/#", 0, collect(all)); err != nil {
+		t.Fatal(err)
+	}
+	if client.Subscribe("sensor/#/x", 0, collect(all)) != ErrInvalidFilter || client.Subscribe("x", 0, nil) != ErrNilHandler {
+		t.Error("expected invalid subscribe errors")
+	}
+
+	if err := client.Publish("sensor/a/temp", 1, false, []byte("21")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, temp); msg.Topic != "sensor/a/temp" || string(msg.Payload) != "21" || msg.QoS != 1 {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	receive(t, all)
+
+	if err := client.Publish("sensor/a/humidity", 1, false, []byte("60")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, all); msg.Topic != "sensor/a/humidity" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	nothing(t, temp)
+
+	if err := client.Unsubscribe("sensor/#"); err != nil {
+		t.Fatal(err)
+	}
+	client.Publish("sensor/b/temp", 1, false, []byte("22"))
+	receive(t, temp)
+	nothing(t, all)
+
+	if client.Publish("sensor/+/temp", 0, false, nil) != ErrInvalidTopic {
+		t.Error("expected ErrInvalidTopic")
+	}
+}
+
+type reading struct {
+	Sensor string  `json:"sensor"`
+	Value  float64 `json:"value"`
+}
+
+func TestCodec(t *testing.T) {
+	b := startBroker(t, "")
+	received := make(chan *Message, 10)
+
+	jsonClient := newTestClient(t, b, "json")
+	if err := jsonClient.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	jsonClient.Subscribe("json", 1, collect(received))
+	if err := jsonClient.PublishValue("json", 1, false, reading{Sensor: "a", Value: 21.5}); err != nil {
+		t.Fatal(err)
+	}
+	var r reading
+	if err := receive(t, received).Decode(&r); err != nil || r.Sensor != "a" || r.Value != 21.5 {
+		t.Errorf("json decoded %+v, %v", r, err)
+	}
+
+	protoClient := newTestClient(t, b, "proto", WithCodec(Proto))
+	if err := protoClient.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	protoClient.Subscribe("proto", 1, collect(received))
+	if err := protoClient.PublishValue("proto", 1, false, &wrapperspb.StringValue{Value: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	var s wrapperspb.StringValue
+	if err := receive(t, received).Decode(&s); err != nil || s.Value != "hello" {
+		t.Errorf("proto decoded %q, %v", s.Value, err)
+	}
+	if protoClient.PublishValue("proto", 1, false, r) == nil {
+		t.Error("expected error publishing a non proto value")
+	}
+
+	rawClient := newTestClient(t, b, "raw", WithCodec(Raw))
+	if err := rawClient.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	rawClient.Subscribe("raw", 1, collect(received))
+	if err := rawClient.PublishValue("raw", 1, false, "plain text"); err != nil {
+		t.Fatal(err)
+	}
+	var text string
+	if err := receive(t, received).Decode(&text); err != nil || text != "plain text" {
+		t.Errorf("raw decoded %q, %v", text, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	b := startBroker(t, "")
+	client := NewClient("auth", WithBroker(b.URL()), WithAuth("user", "wrong"))
+	if client.Connect() == nil {
+		client.Disconnect()
+		t.Fatal("expected connect error with a wrong password")
+	}
+}
+
+func TestOfflineQueue(t *testing.T) {
+	b := startBroker(t, "")
+	lost := make(chan error, 1)
+	client := newTestClient(t, b, "offline", WithOfflineQueue(2), WithConnectionLost(func(_ *Client, err error) {
+		lost <- err
+	}))
+	received := make(chan *Message, 10)
+	client.Subscribe("queue/#", 1, collect(received))
+
+	// 连接前发布的消息进入队列，连接后先订阅再发送
+	if err := client.Publish("queue/1", 1, false, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if client.Queued() != 1 {
+		t.Fatalf("queued %d", client.Queued())
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, received); msg.Topic != "queue/1" {
+		t.Fatalf("unexpected message %s", msg.Topic)
+	}
+
+	// broker 重启，内存中的会话丢失
+	b.Close()
+	select {
+	case <-lost:
+	case <-time.After(3 * time.Second):
+		t.Fatal("connection lost not reported")
+	}
+	for i, topic := range []string{"queue/2", "queue/3"} {
+		if err := client.Publish(topic, byte(i%2), false, []byte(topic)); err != nil {
+			t.Fatal(err)
 		}
+	}
+	if err := client.Publish("queue/4", 1, false, nil); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
 
-		wg.Add(1)
-		go func() {
-			err := client.Subscribe(func(c *Client, msg *Message) {
-				fmt.Printf("接收到消息: %+v \n", msg)
-				wg.Done()
-			}, 1, "mqtt")
+	// 重连后恢复订阅，按顺序发送离线消息
+	startBroker(t, b.Addr())
+	for _, topic := range []string{"queue/2", "queue/3"} {
+		if msg := receive(t, received); msg.Topic != topic {
+			t.Fatalf("expected %s, got %s", topic, msg.Topic)
+		}
+	}
+	// 收到消息时 PUBACK 可能还没处理完
+	for i := 0; client.Queued() != 0; i++ {
+		if i == 100 {
+			t.Fatalf("queued %d after reconnect", client.Queued())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := client.Publish("queue/5", 1, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, received)
+}
+
+// stallProxy 转发 client 和 broker 之间的连接，hold 期间暂停 broker 到 client 的数据，
+// client 等不到 PUBACK 但连接不会断开
+type stallProxy struct {
+	ln   net.Listener
+	gate sync.RWMutex
+}
 
+func newStallProxy(t *testing.T, target string) *stallProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &stallProxy{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
 			if err != nil {
-				panic(err)
+				return
 			}
-		}()
-
-		msg := &Message{
-			ClientID: clientId,
-			Type:     "text",
-			Data:     "Hello Pibistar",
-			Time:     time.Now().Unix(),
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go func() {
+				io.Copy(upstream, conn)
+				upstream.Close()
+			}()
+			go func() {
+				p.forward(conn, upstream)
+				conn.Close()
+			}()
 		}
-		data, _ := json.Marshal(msg)
+	}()
+	return p
+}
 
-		err = client.Publish("mqtt", 1, false, data)
+func (p *stallProxy) forward(dst, src net.Conn) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
 		if err != nil {
-			panic(err)
+			return
 		}
+		p.gate.RLock()
+		_, err = dst.Write(buf[:n])
+		p.gate.RUnlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *stallProxy) URL() string {
+	return "tcp://" + p.ln.Addr().String()
+}
+
+func TestFlushAfterTimeout(t *testing.T) {
+	b := startBroker(t, "")
+	proxy := newStallProxy(t, b.Addr())
+	received := make(chan *Message, 10)
+	sub := newTestClient(t, b, "stall-sub")
+	sub.Subscribe("stall/#", 1, collect(received))
+	if err := sub.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient("stall-pub", WithBroker(proxy.URL()), WithAuth("user", "secret"),
+		WithOfflineQueue(10), WithTimeout(time.Second, 200*time.Millisecond))
+	t.Cleanup(client.Disconnect)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
 
-		wg.Wait()
+	// 连接正常但收不到 PUBACK，flush 超时，消息留在队列中
+	proxy.gate.Lock()
+	client.locker.Lock()
+	client.enqueue(&pending{topic: "stall/1", qos: 1, payload: []byte("1")})
+	client.locker.Unlock()
+	client.flush()
+	proxy.gate.Unlock()
+	if client.Queued() != 1 || !client.IsConnected() {
+		t.Fatalf("queued %d, connected %v", client.Queued(), client.IsConnected())
+	}
+
+	// 连接正常时 Publish 重新开始发送队列，不用等重连
+	if err := client.Publish("stall/2", 1, false, []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		// 超时的消息可能已经送达，重发后收到两次
+		if msg := receive(t, received); msg.Topic == "stall/2" {
+			break
+		}
+	}
+	for i := 0; client.Queued() != 0; i++ {
+		if i == 100 {
+			t.Fatalf("queued %d", client.Queued())
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 }
@@ -0,0 +1,129 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+type (
+	Option  func(*options)
+	options struct {
+		brokers              []string
+		username             string
+		password             string
+		cleanSession         bool
+		keepAlive            time.Duration
+		pingTimeout          time.Duration
+		writeTimeout         time.Duration
+		connectTimeout       time.Duration
+		maxReconnectInterval time.Duration
+		tlsConfig            *tls.Config
+		codec                Codec
+		queueSize            int
+		onConnect            func(c *Client)
+		onConnectionLost     func(c *Client, err error)
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		keepAlive:            120 * time.Second,
+		pingTimeout:          10 * time.Second,
+		writeTimeout:         10 * time.Second,
+		connectTimeout:       30 * time.Second,
+		maxReconnectInterval: time.Minute,
+		codec:                JSON,
+		queueSize:            100,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if len(optCopy.brokers) == 0 {
+		optCopy.brokers = []string{"tcp://127.0.0.1:1883"}
+	}
+
+	return optCopy
+}
+
+// WithBroker sets the broker addresses like tcp://host:1883 or ssl://host:8883, default tcp://127.0.0.1:1883.
+// The client tries them in order when connecting.
+func WithBroker(addrs ...string) Option {
+	return func(opts *options) {
+		opts.brokers = append(opts.brokers, addrs...)
+	}
+}
+
+// WithAuth sets the username and password sent in CONNECT.
+func WithAuth(username, password string) Option {
+	return func(opts *options) {
+		opts.username = username
+		opts.password = password
+	}
+}
+
+// WithCleanSession sets whether the broker drops the session on disconnect, default false.
+func WithCleanSession(clean bool) Option {
+	return func(opts *options) {
+		opts.cleanSession = clean
+	}
+}
+
+// WithKeepAlive sets the keep alive interval and how long to wait for PINGRESP, default 120s and 10s.
+func WithKeepAlive(keepAlive, pingTimeout time.Duration) Option {
+	return func(opts *options) {
+		opts.keepAlive = keepAlive
+		opts.pingTimeout = pingTimeout
+	}
+}
+
+// WithTimeout sets the connect and the publish/subscribe timeout, default 30s and 10s.
+func WithTimeout(connect, write time.Duration) Option {
+	return func(opts *options) {
+		opts.connectTimeout = connect
+		opts.writeTimeout = write
+	}
+}
+
+// WithMaxReconnectInterval sets the max delay between reconnect attempts, default 1m.
+func WithMaxReconnectInterval(d time.Duration) Option {
+	return func(opts *options) {
+		opts.maxReconnectInterval = d
+	}
+}
+
+// WithTLS sets the tls config used by ssl:// brokers.
+func WithTLS(config *tls.Config) Option {
+	return func(opts *options) {
+		opts.tlsConfig = config
+	}
+}
+
+// WithCodec sets the codec used by PublishValue and Message.Decode, default JSON.
+func WithCodec(codec Codec) Option {
+	return func(opts *options) {
+		opts.codec = codec
+	}
+}
+
+// WithOfflineQueue sets how many messages are kept while the connection is down, default 100.
+// Queued messages are published in order after reconnecting, 0 returns ErrNotConnected instead.
+func WithOfflineQueue(size int) Option {
+	return func(opts *options) {
+		opts.queueSize = size
+	}
+}
+
+// WithOnConnect sets the callback called after every (re)connect,
+// subscriptions are restored and the offline queue is flushed before it.
+func WithOnConnect(fn func(c *Client)) Option {
+	return func(opts *options) {
+		opts.onConnect = fn
+	}
+}
+
+// WithConnectionLost sets the callback called when the connection drops unexpectedly.
+func WithConnectionLost(fn func(c *Client, err error)) Option {
+	return func(opts *options) {
+		opts.onConnectionLost = fn
+	}
+}
@@ -0,0 +1,30 @@
+package mqtt
+
+import (
+	"strings"
+
+	"go-demo/sdk/mqtt/internal/topic"
+)
+
+// Match 判断 topic 是否匹配订阅的 filter，支持 + 单层和 # 多层通配符，
+// $share/{group}/ 共享订阅前缀会被去掉，$ 开头的系统 topic 不匹配首层通配符
+func Match(filter, name string) bool {
+	if strings.HasPrefix(filter, "$share/") {
+		parts := strings.SplitN(filter, "/", 3)
+		if len(parts) < 3 {
+			return false
+		}
+		filter = parts[2]
+	}
+	return topic.Match(filter, name)
+}
+
+// ValidFilter 检查订阅 filter 的通配符位置是否合法
+func ValidFilter(filter string) bool {
+	return topic.ValidFilter(filter)
+}
+
+// ValidTopic 发布的 topic 不能为空也不能包含通配符
+func ValidTopic(name string) bool {
+	return topic.ValidTopic(name)
+}
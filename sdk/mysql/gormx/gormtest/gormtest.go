@@ -0,0 +1,26 @@
+// Package gormtest 测试用的 sqlite 数据库
+package gormtest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// OpenSQLite 在临时目录中创建 sqlite 数据库并迁移 models，测试结束时关闭
+func OpenSQLite(t testing.TB, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// sqlite 同一时间只允许一个写事务
+	db.DB().SetMaxOpenConns(1)
+	if err = db.AutoMigrate(models...).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,25 @@
+// Package gormx gorm 的通用辅助函数
+package gormx
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// Transaction 在事务中执行 fn，fn 返回错误或 panic 时回滚
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,57 @@
+package gormx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+
+	"go-demo/sdk/mysql/gormx/gormtest"
+)
+
+type account struct {
+	ID      uint64 `gorm:"primary_key"`
+	Balance int
+}
+
+func TestTransaction(t *testing.T) {
+	db := gormtest.OpenSQLite(t, &account{})
+	insert := func(id uint64) func(tx *gorm.DB) error {
+		return func(tx *gorm.DB) error {
+			return tx.Create(&account{ID: id, Balance: 1}).Error
+		}
+	}
+
+	if err := Transaction(db, insert(1)); err != nil {
+		t.Fatal(err)
+	}
+	// fn 返回错误或 panic 时回滚
+	errFailed := errors.New("failed")
+	if err := Transaction(db, func(tx *gorm.DB) error {
+		if err := insert(2)(tx); err != nil {
+			return err
+		}
+		return errFailed
+	}); err != errFailed {
+		t.Errorf("expected errFailed, got %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic not propagated")
+			}
+		}()
+		Transaction(db, func(tx *gorm.DB) error {
+			insert(3)(tx)
+			panic("boom")
+		})
+	}()
+
+	var count int
+	if err := db.Model(&account{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d accounts, rolled back rows were committed", count)
+	}
+}
@@ -1,6 +1,7 @@
 package oss
 
 import (
+	"errors"
 	"fmt"
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"io"
@@ -68,9 +69,13 @@ func (client *ossClient) Put(key string, reader io.Reader) error {
 	return client.GetBucket().PutObject(key, reader)
 }
 
-// delete the object, actually use the nil replace the object
-func (client *ossClient) DeleteObject(key string) {
-	client.Put(key, nil)
+// delete the object, deleting a missing object is not an error
+func (client *ossClient) DeleteObject(key string) error {
+	bucket := client.GetBucket()
+	if bucket == nil {
+		return errors.New("oss: bucket not available")
+	}
+	return bucket.DeleteObject(key)
 }
 
 // get the down url
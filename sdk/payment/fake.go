@@ -0,0 +1,352 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fake 内存中的模拟网关，行为和真实渠道一致：下单幂等、已付款不能关闭、退款不能超过实付金额。
+// 通知参数使用 HMAC-SHA256 签名，Pay、SetStatus 等方法用来模拟用户和渠道侧的操作
+type Fake struct {
+	name   string
+	secret []byte
+
+	mu          sync.Mutex
+	trades      map[string]*fakeTrade
+	refunds     map[string]*Refund
+	seq         int
+	asyncRefund bool
+	failures    []error
+	calls       map[string]int
+}
+
+type fakeTrade struct {
+	req      CreateRequest
+	trade    Trade
+	refunded int64
+}
+
+var _ PaymentGateway = (*Fake)(nil)
+
+func NewFake(name string) *Fake {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return &Fake{
+		name:    name,
+		secret:  secret,
+		trades:  make(map[string]*fakeTrade),
+		refunds: make(map[string]*Refund),
+		calls:   make(map[string]int),
+	}
+}
+
+func (f *Fake) Name() string {
+	return f.name
+}
+
+func (f *Fake) Create(ctx context.Context, req *CreateRequest) (*CreateResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "Create"); err != nil {
+		return nil, err
+	}
+	if req.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	t, ok := f.trades[req.OutTradeNo]
+	if !ok {
+		f.seq++
+		t = &fakeTrade{req: *req, trade: Trade{
+			OutTradeNo: req.OutTradeNo,
+			TradeNo:    fmt.Sprintf("%s%08d", strings.ToUpper(f.name), f.seq),
+			Status:     StatusNotPay,
+			Amount:     req.Amount,
+		}}
+		f.trades[req.OutTradeNo] = t
+	}
+	switch {
+	case t.trade.Status == StatusSuccess || t.trade.Status == StatusRefund:
+		return nil, &Error{Provider: f.name, Code: "ORDERPAID", Message: "order paid", Err: ErrTradePaid}
+	case t.trade.Status == StatusClosed:
+		return nil, &Error{Provider: f.name, Code: "ORDERCLOSED", Message: "order closed", Err: ErrTradeClosed}
+	case t.req.Amount != req.Amount || t.req.Subject != req.Subject:
+		return nil, &Error{Provider: f.name, Code: "OUT_TRADE_NO_USED", Message: "out trade no used", Err: ErrDuplicateTrade}
+	}
+	return &CreateResult{
+		OutTradeNo: req.OutTradeNo,
+		PayURL:     "fake://" + f.name + "/pay/" + t.trade.TradeNo,
+		Params:     map[string]string{"trade_no": t.trade.TradeNo},
+	}, nil
+}
+
+func (f *Fake) Query(ctx context.Context, outTradeNo string) (*Trade, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "Query"); err != nil {
+		return nil, err
+	}
+	t, ok := f.trades[outTradeNo]
+	if !ok {
+		return nil, ErrTradeNotFound
+	}
+	trade := t.trade
+	return &trade, nil
+}
+
+func (f *Fake) Close(ctx context.Context, outTradeNo string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "Close"); err != nil {
+		return err
+	}
+	t, ok := f.trades[outTradeNo]
+	if !ok {
+		return ErrTradeNotFound
+	}
+	switch t.trade.Status {
+	case StatusSuccess, StatusRefund:
+		return &Error{Provider: f.name, Code: "ORDERPAID", Message: "order paid", Err: ErrTradePaid}
+	}
+	t.trade.Status = StatusClosed
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, req *RefundRequest) (*Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "Refund"); err != nil {
+		return nil, err
+	}
+	if refund, ok := f.refunds[req.OutRefundNo]; ok {
+		if refund.OutTradeNo != req.OutTradeNo || refund.Amount != req.Amount {
+			return nil, &Error{Provider: f.name, Code: "INVALID_REQUEST", Message: "out refund no used", Err: ErrDuplicateTrade}
+		}
+		r := *refund
+		return &r, nil
+	}
+	t, ok := f.trades[req.OutTradeNo]
+	if !ok {
+		return nil, ErrTradeNotFound
+	}
+	if t.trade.Status != StatusSuccess && t.trade.Status != StatusRefund {
+		return nil, &Error{Provider: f.name, Code: "TRADE_STATUS_ERROR", Message: "order not paid", Err: ErrTradeNotPaid}
+	}
+	if req.Amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if t.refunded+req.Amount > t.trade.Amount {
+		return nil, &Error{Provider: f.name, Code: "NOTENOUGH", Message: "refund exceeds paid amount", Err: ErrRefundExceeded}
+	}
+	f.seq++
+	refund := &Refund{
+		OutTradeNo:  req.OutTradeNo,
+		OutRefundNo: req.OutRefundNo,
+		RefundNo:    fmt.Sprintf("%sR%08d", strings.ToUpper(f.name), f.seq),
+		Amount:      req.Amount,
+		Status:      RefundSuccess,
+	}
+	if f.asyncRefund {
+		refund.Status = RefundProcessing
+	}
+	t.refunded += req.Amount
+	t.trade.Status = StatusRefund
+	f.refunds[req.OutRefundNo] = refund
+	r := *refund
+	return &r, nil
+}
+
+func (f *Fake) QueryRefund(ctx context.Context, outTradeNo, outRefundNo string) (*Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call(ctx, "QueryRefund"); err != nil {
+		return nil, err
+	}
+	refund, ok := f.refunds[outRefundNo]
+	if !ok || refund.OutTradeNo != outTradeNo {
+		return nil, ErrTradeNotFound
+	}
+	r := *refund
+	return &r, nil
+}
+
+func (f *Fake) VerifyNotification(r *http.Request) (*Notification, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	raw := make(map[string]string, len(r.PostForm))
+	for k := range r.PostForm {
+		raw[k] = r.PostForm.Get(k)
+	}
+	if !hmac.Equal([]byte(raw["sign"]), []byte(f.sign(raw))) {
+		return nil, ErrInvalidSignature
+	}
+	amount, err := strconv.ParseInt(raw["total_fee"], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidAmount
+	}
+	n := &Notification{
+		Provider:   f.name,
+		OutTradeNo: raw["out_trade_no"],
+		TradeNo:    raw["trade_no"],
+		Status:     TradeStatus(raw["trade_status"]),
+		Amount:     amount,
+		Passback:   raw["passback"],
+		Raw:        raw,
+	}
+	if paidAt, _ := strconv.ParseInt(raw["paid_at"], 10, 64); paidAt > 0 {
+		n.PaidAt = time.Unix(paidAt, 0)
+	}
+	return n, nil
+}
+
+func (f *Fake) AckNotification(w http.ResponseWriter, err error) {
+	if err != nil {
+		http.Error(w, "fail", http.StatusInternalServerError)
+		return
+	}
+	io.WriteString(w, "success")
+}
+
+// Pay 模拟用户付款成功
+func (f *Fake) Pay(outTradeNo string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.trades[outTradeNo]
+	if !ok {
+		return ErrTradeNotFound
+	}
+	switch t.trade.Status {
+	case StatusClosed:
+		return ErrTradeClosed
+	case StatusNotPay, StatusPaying:
+		t.trade.Status = StatusSuccess
+		t.trade.PaidAt = time.Now().Truncate(time.Second)
+	}
+	return nil
+}
+
+// SetStatus 直接修改交易状态，例如模拟用户正在付款或者渠道超时关闭
+func (f *Fake) SetStatus(outTradeNo string, status TradeStatus) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.trades[outTradeNo]
+	if !ok {
+		return ErrTradeNotFound
+	}
+	t.trade.Status = status
+	if status == StatusSuccess && t.trade.PaidAt.IsZero() {
+		t.trade.PaidAt = time.Now().Truncate(time.Second)
+	}
+	return nil
+}
+
+// SetAsyncRefund 为 true 时退款先返回 RefundProcessing，调用 CompleteRefund 后才成功，和微信支付一致
+func (f *Fake) SetAsyncRefund(async bool) {
+	f.mu.Lock()
+	f.asyncRefund = async
+	f.mu.Unlock()
+}
+
+// CompleteRefund 把处理中的退款置为成功
+func (f *Fake) CompleteRefund(outRefundNo string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	refund, ok := f.refunds[outRefundNo]
+	if !ok {
+		return ErrTradeNotFound
+	}
+	refund.Status = RefundSuccess
+	return nil
+}
+
+// FailNext 让接下来的调用依次返回 errs，用于模拟网络错误
+func (f *Fake) FailNext(errs ...error) {
+	f.mu.Lock()
+	f.failures = append(f.failures, errs...)
+	f.mu.Unlock()
+}
+
+// Calls 返回 method 被调用的次数，method 为 PaymentGateway 的方法名
+func (f *Fake) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// NotifyRequest 按交易当前的状态生成发往 target 的异步通知请求
+func (f *Fake) NotifyRequest(target, outTradeNo string) (*http.Request, error) {
+	f.mu.Lock()
+	t, ok := f.trades[outTradeNo]
+	if !ok {
+		f.mu.Unlock()
+		return nil, ErrTradeNotFound
+	}
+	params := map[string]string{
+		"out_trade_no": outTradeNo,
+		"trade_no":     t.trade.TradeNo,
+		"trade_status": string(t.trade.Status),
+		"total_fee":    strconv.FormatInt(t.trade.Amount, 10),
+		"passback":     t.req.Passback,
+	}
+	if !t.trade.PaidAt.IsZero() {
+		params["paid_at"] = strconv.FormatInt(t.trade.PaidAt.Unix(), 10)
+	}
+	f.mu.Unlock()
+
+	params["sign"] = f.sign(params)
+	form := url.Values{}
+	for k, v := range params {
+		form.Set(k, v)
+	}
+	r, err := http.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r, nil
+}
+
+// call 记录调用次数，ctx 结束或者有待返回的错误时返回错误，调用时持有锁
+func (f *Fake) call(ctx context.Context, method string) error {
+	f.calls[method]++
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(f.failures) > 0 {
+		err := f.failures[0]
+		f.failures = f.failures[1:]
+		return err
+	}
+	return nil
+}
+
+// sign 除 sign 以外的非空参数按 key 排序后计算 HMAC-SHA256
+func (f *Fake) sign(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if k != "sign" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	mac := hmac.New(sha256.New, f.secret)
+	for i, k := range keys {
+		if i > 0 {
+			io.WriteString(mac, "&")
+		}
+		io.WriteString(mac, k+"="+params[k])
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,151 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFakeLifecycle(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("fake")
+	no := OutTradeNo("order-1", 0)
+	req := &CreateRequest{OutTradeNo: no, Subject: "book", Amount: 1000, Scene: SceneNative}
+
+	first, err := f.Create(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重试下单返回同一笔交易
+	again, err := f.Create(ctx, req)
+	if err != nil || again.PayURL != first.PayURL {
+		t.Fatalf("retry %+v, %v", again, err)
+	}
+	changed := *req
+	changed.Amount = 2000
+	if _, err = f.Create(ctx, &changed); !errors.Is(err, ErrDuplicateTrade) {
+		t.Errorf("expected ErrDuplicateTrade, got %v", err)
+	}
+	if _, err = f.Refund(ctx, &RefundRequest{OutTradeNo: no, OutRefundNo: "r1", Amount: 100}); !errors.Is(err, ErrTradeNotPaid) {
+		t.Errorf("refund before pay: %v", err)
+	}
+
+	if err = f.Pay(no); err != nil {
+		t.Fatal(err)
+	}
+	trade, err := f.Query(ctx, no)
+	if err != nil || trade.Status != StatusSuccess || trade.Amount != 1000 || trade.PaidAt.IsZero() {
+		t.Fatalf("Query %+v, %v", trade, err)
+	}
+	if _, err = f.Create(ctx, req); !errors.Is(err, ErrTradePaid) {
+		t.Errorf("create after pay: %v", err)
+	}
+	if err = f.Close(ctx, no); !errors.Is(err, ErrTradePaid) {
+		t.Errorf("close after pay: %v", err)
+	}
+
+	refund, err := f.Refund(ctx, &RefundRequest{OutTradeNo: no, OutRefundNo: OutRefundNo(no, 0), TotalAmount: 1000, Amount: 600})
+	if err != nil || refund.Status != RefundSuccess {
+		t.Fatalf("Refund %+v, %v", refund, err)
+	}
+	// 同一个退款单号只退一次
+	if retry, err := f.Refund(ctx, &RefundRequest{OutTradeNo: no, OutRefundNo: OutRefundNo(no, 0), TotalAmount: 1000, Amount: 600}); err != nil || retry.RefundNo != refund.RefundNo {
+		t.Errorf("refund retry %+v, %v", retry, err)
+	}
+	if _, err = f.Refund(ctx, &RefundRequest{OutTradeNo: no, OutRefundNo: OutRefundNo(no, 1), TotalAmount: 1000, Amount: 500}); !errors.Is(err, ErrRefundExceeded) {
+		t.Errorf("expected ErrRefundExceeded, got %v", err)
+	}
+	if trade, _ = f.Query(ctx, no); trade.Status != StatusRefund {
+		t.Errorf("status after refund %s", trade.Status)
+	}
+
+	if _, err = f.Query(ctx, "missing"); err != ErrTradeNotFound {
+		t.Errorf("expected ErrTradeNotFound, got %v", err)
+	}
+	other := OutTradeNo("order-2", 0)
+	f.Create(ctx, &CreateRequest{OutTradeNo: other, Subject: "pen", Amount: 1})
+	if err = f.Close(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(ctx, other); err != nil {
+		t.Errorf("close twice: %v", err)
+	}
+	if err = f.Pay(other); err != ErrTradeClosed {
+		t.Errorf("pay closed: %v", err)
+	}
+}
+
+func TestFakeAsyncRefundAndFailures(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("fake")
+	f.SetAsyncRefund(true)
+	f.Create(ctx, &CreateRequest{OutTradeNo: "t1", Subject: "book", Amount: 100})
+	f.Pay("t1")
+	refund, err := f.Refund(ctx, &RefundRequest{OutTradeNo: "t1", OutRefundNo: "r1", Amount: 100})
+	if err != nil || refund.Status != RefundProcessing {
+		t.Fatalf("Refund %+v, %v", refund, err)
+	}
+	f.CompleteRefund("r1")
+	if refund, err = f.QueryRefund(ctx, "t1", "r1"); err != nil || refund.Status != RefundSuccess {
+		t.Errorf("QueryRefund %+v, %v", refund, err)
+	}
+	if _, err = f.QueryRefund(ctx, "t2", "r1"); err != ErrTradeNotFound {
+		t.Errorf("refund of other trade: %v", err)
+	}
+
+	boom := errors.New("boom")
+	f.FailNext(boom)
+	if _, err = f.Query(ctx, "t1"); err != boom {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	if _, err = f.Query(ctx, "t1"); err != nil {
+		t.Errorf("failure should be consumed: %v", err)
+	}
+	if n := f.Calls("Query"); n != 2 {
+		t.Errorf("calls %d", n)
+	}
+}
+
+func TestFakeNotification(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("fake")
+	f.Create(ctx, &CreateRequest{OutTradeNo: "t1", Subject: "book", Amount: 100, Passback: "uid=1"})
+	f.Pay("t1")
+
+	r, err := f.NotifyRequest("http://example.com/notify", "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := f.VerifyNotification(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Provider != "fake" || n.OutTradeNo != "t1" || n.Status != StatusSuccess || n.Amount != 100 || n.Passback != "uid=1" || n.PaidAt.IsZero() {
+		t.Errorf("notification %+v", n)
+	}
+
+	r, _ = f.NotifyRequest("http://example.com/notify", "t1")
+	r.ParseForm()
+	r.PostForm.Set("total_fee", "1")
+	if _, err = f.VerifyNotification(r); err != ErrInvalidSignature {
+		t.Errorf("tampered amount: %v", err)
+	}
+	// 另一个网关的签名无效
+	r, _ = f.NotifyRequest("http://example.com/notify", "t1")
+	if _, err = NewFake("fake").VerifyNotification(r); err != ErrInvalidSignature {
+		t.Errorf("other secret: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	f.AckNotification(w, nil)
+	if w.Code != 200 || w.Body.String() != "success" {
+		t.Errorf("ack %d %q", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	f.AckNotification(w, errors.New("db down"))
+	if w.Code != 500 || !strings.Contains(w.Body.String(), "fail") {
+		t.Errorf("nack %d %q", w.Code, w.Body)
+	}
+}
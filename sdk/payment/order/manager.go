@@ -0,0 +1,289 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"go-demo/sdk/mysql/gormx"
+	"go-demo/sdk/payment"
+)
+
+// Manager 管理订单的支付、关闭和退款，订单状态只通过 apply 修改
+type Manager struct {
+	db       *gorm.DB
+	gateways map[string]payment.PaymentGateway
+	opts     *options
+}
+
+// NewManager 使用 gateways 处理对应渠道的订单，表需要先通过 Migrate 创建
+func NewManager(db *gorm.DB, gateways []payment.PaymentGateway, opts ...Option) *Manager {
+	m := &Manager{db: db, gateways: make(map[string]payment.PaymentGateway, len(gateways)), opts: evaluateOptions(opts)}
+	for _, gw := range gateways {
+		m.gateways[gw.Name()] = gw
+	}
+	return m
+}
+
+// Create 创建订单，相同参数重复创建时返回已有的订单
+func (m *Manager) Create(orderNo, provider, subject string, amount int64) (*Order, error) {
+	if _, ok := m.gateways[provider]; !ok {
+		return nil, ErrUnknownProvider
+	}
+	if amount <= 0 {
+		return nil, payment.ErrInvalidAmount
+	}
+	o, err := m.Get(orderNo)
+	if err == nil {
+		if o.Provider != provider || o.Subject != subject || o.Amount != amount {
+			return nil, ErrDuplicateOrder
+		}
+		return o, nil
+	}
+	if err != ErrOrderNotFound {
+		return nil, err
+	}
+	now := m.now()
+	o = &Order{
+		OrderNo:    orderNo,
+		Provider:   provider,
+		Subject:    subject,
+		Amount:     amount,
+		State:      StateCreated,
+		OutTradeNo: payment.OutTradeNo(orderNo, 0),
+		CreatedAt:  now,
+		StateAt:    now,
+	}
+	if err = m.db.Create(o).Error; err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Get 查询订单，不存在时返回 ErrOrderNotFound
+func (m *Manager) Get(orderNo string) (*Order, error) {
+	return m.find(m.db.Where("order_no = ?", orderNo))
+}
+
+// Transitions 订单的状态变更记录
+func (m *Manager) Transitions(orderID uint64) ([]Transition, error) {
+	var list []Transition
+	err := m.db.Where("order_id = ?", orderID).Order("id").Find(&list).Error
+	return list, err
+}
+
+// Pay 向渠道下单并返回支付参数，req 中的订单号、标题和金额由订单填充。
+// 订单在 paying 状态时重复调用返回同一笔交易的支付参数，用户可以重新打开支付页面
+func (m *Manager) Pay(ctx context.Context, orderNo string, req payment.CreateRequest) (*payment.CreateResult, error) {
+	o, err := m.Get(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	gw, err := m.gateway(o)
+	if err != nil {
+		return nil, err
+	}
+	// 先持久化 paying 再下单，下单结果不确定时由对账处理
+	if err = m.apply(o, EventPay, SourceAPI, nil); err != nil {
+		return nil, err
+	}
+	req.OutTradeNo, req.Subject, req.Amount = o.OutTradeNo, o.Subject, o.Amount
+	result, err := gw.Create(ctx, &req)
+	if errors.Is(err, payment.ErrTradePaid) {
+		// 通知还没有到达，查询后推进状态
+		if _, qerr := m.query(ctx, gw, o, SourceAPI); qerr != nil {
+			m.opts.errorHandler(qerr)
+		}
+	}
+	return result, err
+}
+
+// Close 关闭未付款的订单，已经向渠道下单的同时关闭渠道的交易。
+// 用户已经付款时订单变为 paid，返回 payment.ErrTradePaid
+func (m *Manager) Close(ctx context.Context, orderNo string) (*Order, error) {
+	o, err := m.Get(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	if o.State == StatePaying {
+		gw, err := m.gateway(o)
+		if err != nil {
+			return nil, err
+		}
+		return o, m.close(ctx, gw, o, SourceAPI)
+	}
+	return o, m.apply(o, EventClose, SourceAPI, nil)
+}
+
+// Refund 对已付款的订单发起退款，每个订单只能退款一次，重复调用会用同一个退款单号重试。
+// 渠道同步返回结果时订单变为 refunded，否则停留在 refunding 直到对账
+func (m *Manager) Refund(ctx context.Context, orderNo string, amount int64, reason string) (*Order, error) {
+	o, err := m.Get(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	gw, err := m.gateway(o)
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, payment.ErrInvalidAmount
+	}
+	if amount > o.Amount {
+		return nil, payment.ErrRefundExceeded
+	}
+	err = m.apply(o, EventRefund, SourceAPI, map[string]interface{}{
+		"out_refund_no": payment.OutRefundNo(o.OutTradeNo, 0),
+		"refund_amount": amount,
+		"refund_reason": reason,
+	})
+	if err != nil || o.State != StateRefunding {
+		return o, err
+	}
+	return o, m.refund(ctx, gw, o, SourceAPI)
+}
+
+// query 查询渠道的交易并推进订单状态，交易不存在时返回 payment.StatusNotPay
+func (m *Manager) query(ctx context.Context, gw payment.PaymentGateway, o *Order, source string) (payment.TradeStatus, error) {
+	trade, err := gw.Query(ctx, o.OutTradeNo)
+	if errors.Is(err, payment.ErrTradeNotFound) {
+		// 用户还没有扫码或者下单请求没有到达渠道
+		return payment.StatusNotPay, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch trade.Status {
+	case payment.StatusSuccess, payment.StatusRefund:
+		if trade.Amount != o.Amount {
+			return trade.Status, ErrAmountMismatch
+		}
+		if err = m.apply(o, EventPaid, source, paidUpdates(trade.TradeNo, trade.PaidAt, m.now())); err != nil {
+			return trade.Status, err
+		}
+		if trade.Status == payment.StatusRefund {
+			err = m.apply(o, EventRefunded, source, nil)
+		}
+	case payment.StatusClosed:
+		err = m.apply(o, EventClose, source, nil)
+	}
+	return trade.Status, err
+}
+
+// close 关闭渠道的交易后关闭订单，渠道返回已付款时查询并把订单置为 paid
+func (m *Manager) close(ctx context.Context, gw payment.PaymentGateway, o *Order, source string) error {
+	err := gw.Close(ctx, o.OutTradeNo)
+	switch {
+	case err == nil, errors.Is(err, payment.ErrTradeNotFound):
+		return m.apply(o, EventClose, source, nil)
+	case errors.Is(err, payment.ErrTradePaid):
+		if _, qerr := m.query(ctx, gw, o, source); qerr != nil {
+			return qerr
+		}
+	}
+	return err
+}
+
+// refund 按订单中的退款单号向渠道发起退款，渠道明确拒绝时订单回到 paid
+func (m *Manager) refund(ctx context.Context, gw payment.PaymentGateway, o *Order, source string) error {
+	refund, err := gw.Refund(ctx, &payment.RefundRequest{
+		OutTradeNo:  o.OutTradeNo,
+		OutRefundNo: o.OutRefundNo,
+		TotalAmount: o.Amount,
+		Amount:      o.RefundAmount,
+		Reason:      o.RefundReason,
+	})
+	if err != nil {
+		if errors.Is(err, payment.ErrRefundExceeded) || errors.Is(err, payment.ErrTradeNotPaid) || errors.Is(err, payment.ErrInvalidAmount) {
+			if aerr := m.apply(o, EventRefundFailed, source, nil); aerr != nil {
+				return aerr
+			}
+		}
+		return err
+	}
+	return m.applyRefund(o, refund.Status, source)
+}
+
+func (m *Manager) applyRefund(o *Order, status payment.RefundStatus, source string) error {
+	switch status {
+	case payment.RefundSuccess:
+		return m.apply(o, EventRefunded, source, nil)
+	case payment.RefundFailed:
+		return m.apply(o, EventRefundFailed, source, nil)
+	}
+	return nil
+}
+
+// apply 处理事件并把新状态和 updates 写入数据库，成功后 o 为最新的订单。
+// 重复或过期的事件不修改订单；其他请求同时修改了订单时重新读取后再处理，
+// 每次重试都意味着有其他请求修改成功，所以不会无限循环
+func (m *Manager) apply(o *Order, event Event, source string, updates map[string]interface{}) error {
+	for {
+		to, err := Next(o.State, event)
+		if err != nil {
+			return &TransitionError{OrderNo: o.OrderNo, State: o.State, Event: event}
+		}
+		if to == o.State {
+			return nil
+		}
+
+		values := map[string]interface{}{"state": to, "version": o.Version + 1, "state_at": m.now()}
+		for k, v := range updates {
+			values[k] = v
+		}
+		changed := false
+		err = gormx.Transaction(m.db, func(tx *gorm.DB) error {
+			res := tx.Model(&Order{}).Where("id = ? AND version = ?", o.ID, o.Version).Updates(values)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			changed = true
+			return tx.Create(&Transition{OrderID: o.ID, From: o.State, To: to, Event: event, Source: source, CreatedAt: m.now()}).Error
+		})
+		if err != nil {
+			return err
+		}
+		fresh, err := m.find(m.db.Where("id = ?", o.ID))
+		if err != nil {
+			return err
+		}
+		*o = *fresh
+		if changed {
+			return nil
+		}
+	}
+}
+
+func (m *Manager) find(query *gorm.DB) (*Order, error) {
+	var o Order
+	err := query.First(&o).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (m *Manager) gateway(o *Order) (payment.PaymentGateway, error) {
+	gw, ok := m.gateways[o.Provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return gw, nil
+}
+
+func (m *Manager) now() time.Time {
+	return m.opts.clock().UTC()
+}
+
+// paidUpdates 付款时间为空时使用收到通知或查询到结果的时间
+func paidUpdates(tradeNo string, paidAt, now time.Time) map[string]interface{} {
+	if paidAt.IsZero() {
+		paidAt = now
+	}
+	return map[string]interface{}{"trade_no": tradeNo, "paid_at": paidAt.UTC()}
+}
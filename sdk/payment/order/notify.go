@@ -0,0 +1,55 @@
+package order
+
+import (
+	"errors"
+	"net/http"
+
+	"go-demo/sdk/payment"
+)
+
+// NotifyHandler 接收 provider 渠道的异步通知，验签后推进订单状态。
+// 数据库等临时错误返回失败让渠道重试；订单状态冲突或金额不符重试也无法解决，
+// 交给 WithErrorHandler 处理后确认通知，例如关闭后才付款的订单需要人工退款
+func (m *Manager) NotifyHandler(provider string) http.Handler {
+	gw, ok := m.gateways[provider]
+	if !ok {
+		panic("order: unknown payment provider " + provider)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		n, err := gw.VerifyNotification(r)
+		if err == nil {
+			err = m.HandleNotification(n)
+		}
+		if err != nil {
+			m.opts.errorHandler(err)
+			if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrAmountMismatch) {
+				err = nil
+			}
+		}
+		gw.AckNotification(w, err)
+	})
+}
+
+// HandleNotification 按已经验签的通知推进订单状态，重复的通知不修改订单
+func (m *Manager) HandleNotification(n *payment.Notification) error {
+	o, err := m.find(m.db.Where("provider = ? AND out_trade_no = ?", n.Provider, n.OutTradeNo))
+	if err != nil {
+		return err
+	}
+	switch n.Status {
+	case payment.StatusSuccess:
+		if n.Amount != o.Amount {
+			return ErrAmountMismatch
+		}
+		return m.apply(o, EventPaid, SourceNotify, paidUpdates(n.TradeNo, n.PaidAt, m.now()))
+	case payment.StatusClosed:
+		return m.apply(o, EventClose, SourceNotify, nil)
+	case payment.StatusRefund:
+		return m.apply(o, EventRefunded, SourceNotify, nil)
+	}
+	return nil
+}
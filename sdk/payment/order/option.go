@@ -0,0 +1,77 @@
+package order
+
+import "time"
+
+type (
+	Option  func(*options)
+	options struct {
+		pollInterval   time.Duration
+		batchSize      int
+		reconcileDelay time.Duration
+		payTimeout     time.Duration
+		errorHandler   func(error)
+		clock          func() time.Time
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		pollInterval:   30 * time.Second,
+		batchSize:      100,
+		reconcileDelay: time.Minute,
+		payTimeout:     30 * time.Minute,
+		errorHandler:   func(error) {},
+		clock:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.batchSize < 1 {
+		optCopy.batchSize = 1
+	}
+
+	return optCopy
+}
+
+// WithPollInterval sets how often Run looks for orders to reconcile, default 30s.
+func WithPollInterval(interval time.Duration) Option {
+	return func(opts *options) {
+		opts.pollInterval = interval
+	}
+}
+
+// WithBatchSize sets the max number of orders reconciled per poll, default 100.
+func WithBatchSize(n int) Option {
+	return func(opts *options) {
+		opts.batchSize = n
+	}
+}
+
+// WithReconcileDelay sets how long an order stays paying or refunding before it is
+// queried from the provider, leaving time for the notification to arrive, default 1m.
+func WithReconcileDelay(d time.Duration) Option {
+	return func(opts *options) {
+		opts.reconcileDelay = d
+	}
+}
+
+// WithPayTimeout sets how long a paying order waits for the user before it is closed, default 30m.
+func WithPayTimeout(d time.Duration) Option {
+	return func(opts *options) {
+		opts.payTimeout = d
+	}
+}
+
+// WithErrorHandler sets the function receiving notification and reconciliation errors.
+func WithErrorHandler(fn func(error)) Option {
+	return func(opts *options) {
+		opts.errorHandler = fn
+	}
+}
+
+// WithClock sets the time source, used in tests.
+func WithClock(clock func() time.Time) Option {
+	return func(opts *options) {
+		opts.clock = clock
+	}
+}
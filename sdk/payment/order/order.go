@@ -0,0 +1,149 @@
+/**
+ * 支付订单状态机
+ *   1. 订单状态 created -> paying -> paid -> refunding -> refunded，未付款的订单可以关闭 (closed)
+ *   2. 状态由事件推进，见 Next，非法事件返回 *TransitionError，重复或过期的事件不改变状态；
+ *      状态变更使用版本号乐观锁写入 payment_orders 表，并在同一事务中记录到 payment_order_transitions 表
+ *   3. NotifyHandler 验签渠道的异步通知后推进订单状态，支付宝和微信支付的通知地址分别为
+ *      alipay.NotifyURL 和 weixin.WeixinNotifyURL：
+ *        mux.Handle("/alipay", m.NotifyHandler(alipay.Name))
+ *        mux.Handle("/weixin/pay", m.NotifyHandler(weixin.Name))
+ *   4. Run 轮询长时间停留在 paying、refunding 的订单，向渠道查询后补齐状态，超时未付款的订单自动关闭，
+ *      状态变更是幂等的，多个实例可以同时运行
+ */
+package order
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrOrderNotFound     = errors.New("order: order not found")
+	ErrDuplicateOrder    = errors.New("order: order no already used with different parameters")
+	ErrUnknownProvider   = errors.New("order: unknown payment provider")
+	ErrAmountMismatch    = errors.New("order: paid amount does not match the order")
+	ErrInvalidTransition = errors.New("order: invalid state transition")
+)
+
+// State 订单状态
+type State string
+
+const (
+	// 已创建，还没有发起支付
+	StateCreated State = "created"
+	// 已向渠道下单，等待用户付款
+	StatePaying State = "paying"
+	// 付款成功
+	StatePaid State = "paid"
+	// 未付款关闭
+	StateClosed State = "closed"
+	// 已发起退款，等待渠道处理
+	StateRefunding State = "refunding"
+	// 退款成功
+	StateRefunded State = "refunded"
+)
+
+// Event 推进订单状态的事件
+type Event string
+
+const (
+	EventPay          Event = "pay"
+	EventPaid         Event = "paid"
+	EventClose        Event = "close"
+	EventRefund       Event = "refund"
+	EventRefunded     Event = "refunded"
+	EventRefundFailed Event = "refund_failed"
+)
+
+// 状态变更的来源，记录在 Transition 中
+const (
+	SourceAPI       = "api"
+	SourceNotify    = "notify"
+	SourceReconcile = "reconcile"
+)
+
+// transitions 每个状态可以处理的事件，目标状态和当前状态相同的是重复或过期的事件，
+// 例如重复的付款通知，或者退款之后才到达的付款通知
+var transitions = map[State]map[Event]State{
+	StateCreated:   {EventPay: StatePaying, EventClose: StateClosed},
+	StatePaying:    {EventPay: StatePaying, EventPaid: StatePaid, EventClose: StateClosed},
+	StatePaid:      {EventPaid: StatePaid, EventRefund: StateRefunding, EventRefunded: StateRefunded},
+	StateClosed:    {EventClose: StateClosed},
+	StateRefunding: {EventPaid: StateRefunding, EventRefund: StateRefunding, EventRefunded: StateRefunded, EventRefundFailed: StatePaid},
+	StateRefunded:  {EventPaid: StateRefunded, EventRefund: StateRefunded, EventRefunded: StateRefunded},
+}
+
+// Next 返回 from 状态处理 event 之后的状态，不能处理时返回 ErrInvalidTransition
+func Next(from State, event Event) (State, error) {
+	to, ok := transitions[from][event]
+	if !ok {
+		return from, ErrInvalidTransition
+	}
+	return to, nil
+}
+
+// TransitionError 订单在当前状态下不能处理该事件，例如关闭已付款的订单
+type TransitionError struct {
+	OrderNo string
+	State   State
+	Event   Event
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order: %s cannot handle event %s in state %s", e.OrderNo, e.Event, e.State)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// Order 支付订单，金额单位为分
+type Order struct {
+	ID       uint64 `gorm:"primary_key"`
+	OrderNo  string `gorm:"type:varchar(64);unique_index;not null"`
+	Provider string `gorm:"type:varchar(32);not null"`
+	Subject  string `gorm:"type:varchar(255)"`
+	Amount   int64
+	State    State `gorm:"type:varchar(16);index"`
+	// 由 OrderNo 生成，重复下单得到同一个商户订单号
+	OutTradeNo   string `gorm:"type:varchar(64);unique_index;not null"`
+	TradeNo      string `gorm:"type:varchar(64)"`
+	PaidAt       *time.Time
+	OutRefundNo  string `gorm:"type:varchar(64)"`
+	RefundAmount int64
+	RefundReason string `gorm:"type:varchar(255)"`
+	// 乐观锁，每次状态变更加一
+	Version   int
+	CreatedAt time.Time
+	// 进入当前状态的时间
+	StateAt time.Time `gorm:"index"`
+	// 最后一次对账的时间，对账时优先处理最久没有检查的订单
+	CheckedAt time.Time
+}
+
+func (Order) TableName() string {
+	return "payment_orders"
+}
+
+// Transition 状态变更记录
+type Transition struct {
+	ID        uint64 `gorm:"primary_key"`
+	OrderID   uint64 `gorm:"index"`
+	From      State  `gorm:"column:from_state;type:varchar(16)"`
+	To        State  `gorm:"column:to_state;type:varchar(16)"`
+	Event     Event  `gorm:"type:varchar(16)"`
+	Source    string `gorm:"type:varchar(16)"`
+	CreatedAt time.Time
+}
+
+func (Transition) TableName() string {
+	return "payment_order_transitions"
+}
+
+// Migrate 创建订单和状态变更表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Order{}, &Transition{}).Error
+}
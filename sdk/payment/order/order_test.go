@@ -0,0 +1,411 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-demo/sdk/mysql/gormx/gormtest"
+	"go-demo/sdk/payment"
+)
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newManager(t *testing.T, opts ...Option) (*Manager, *payment.Fake, *testClock) {
+	t.Helper()
+	db := gormtest.OpenSQLite(t)
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	clock := &testClock{now: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)}
+	fake := payment.NewFake("fake")
+	opts = append([]Option{WithClock(clock.Now)}, opts...)
+	return NewManager(db, []payment.PaymentGateway{fake}, opts...), fake, clock
+}
+
+func mustCreate(t *testing.T, m *Manager, orderNo string, amount int64) *Order {
+	t.Helper()
+	o, err := m.Create(orderNo, "fake", "book", amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func mustPay(t *testing.T, m *Manager, orderNo string) *Order {
+	t.Helper()
+	if _, err := m.Pay(context.Background(), orderNo, payment.CreateRequest{Scene: payment.SceneNative}); err != nil {
+		t.Fatal(err)
+	}
+	o, _ := m.Get(orderNo)
+	if o.State != StatePaying {
+		t.Fatalf("state %s, want paying", o.State)
+	}
+	return o
+}
+
+func assertState(t *testing.T, m *Manager, orderNo string, want State) *Order {
+	t.Helper()
+	o, err := m.Get(orderNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.State != want {
+		t.Fatalf("%s state %s, want %s", orderNo, o.State, want)
+	}
+	return o
+}
+
+func TestNext(t *testing.T) {
+	for _, c := range []struct {
+		from  State
+		event Event
+		to    State
+		err   error
+	}{
+		{StateCreated, EventPay, StatePaying, nil},
+		{StatePaying, EventPaid, StatePaid, nil},
+		{StatePaying, EventPay, StatePaying, nil},
+		{StatePaid, EventPaid, StatePaid, nil},
+		{StatePaid, EventRefund, StateRefunding, nil},
+		{StateRefunding, EventRefundFailed, StatePaid, nil},
+		{StateRefunding, EventPaid, StateRefunding, nil},
+		{StateRefunded, EventPaid, StateRefunded, nil},
+		{StateCreated, EventPaid, StateCreated, ErrInvalidTransition},
+		{StatePaid, EventClose, StatePaid, ErrInvalidTransition},
+		{StateClosed, EventPaid, StateClosed, ErrInvalidTransition},
+		{StateClosed, EventPay, StateClosed, ErrInvalidTransition},
+		{StateRefunded, EventRefundFailed, StateRefunded, ErrInvalidTransition},
+	} {
+		to, err := Next(c.from, c.event)
+		if to != c.to || err != c.err {
+			t.Errorf("Next(%s, %s) = %s, %v, want %s, %v", c.from, c.event, to, err, c.to, c.err)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	m, _, _ := newManager(t)
+	o := mustCreate(t, m, "1001", 1000)
+	if o.State != StateCreated || o.OutTradeNo != payment.OutTradeNo("1001", 0) {
+		t.Errorf("order %+v", o)
+	}
+	again := mustCreate(t, m, "1001", 1000)
+	if again.ID != o.ID {
+		t.Errorf("created twice: %d, %d", o.ID, again.ID)
+	}
+	if _, err := m.Create("1001", "fake", "book", 2000); err != ErrDuplicateOrder {
+		t.Errorf("different amount: %v", err)
+	}
+	if _, err := m.Create("1002", "paypal", "book", 1000); err != ErrUnknownProvider {
+		t.Errorf("unknown provider: %v", err)
+	}
+	if _, err := m.Create("1002", "fake", "book", 0); err != payment.ErrInvalidAmount {
+		t.Errorf("zero amount: %v", err)
+	}
+	if _, err := m.Get("1002"); err != ErrOrderNotFound {
+		t.Errorf("Get: %v", err)
+	}
+}
+
+func TestNotifyHandler(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	m, fake, _ := newManager(t, WithErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}))
+	handler := m.NotifyHandler("fake")
+	o := mustCreate(t, m, "1001", 1000)
+	mustPay(t, m, "1001")
+	// 重新打开支付页面时返回同一笔交易
+	mustPay(t, m, "1001")
+	if fake.Calls("Create") != 2 {
+		t.Errorf("Create calls %d", fake.Calls("Create"))
+	}
+
+	fake.Pay(o.OutTradeNo)
+	notify := func() *httptest.ResponseRecorder {
+		r, err := fake.NotifyRequest("/notify", o.OutTradeNo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	// 渠道重复通知
+	for i := 0; i < 3; i++ {
+		if w := notify(); w.Code != http.StatusOK || w.Body.String() != "success" {
+			t.Fatalf("notify %d: %d %q", i, w.Code, w.Body)
+		}
+	}
+	o = assertState(t, m, "1001", StatePaid)
+	if o.TradeNo == "" || o.PaidAt == nil {
+		t.Errorf("paid order %+v", o)
+	}
+	list, err := m.Transitions(o.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].To != StatePaying || list[1].To != StatePaid || list[1].Source != SourceNotify {
+		t.Errorf("transitions %+v", list)
+	}
+
+	// 伪造的通知
+	r, _ := fake.NotifyRequest("/notify", o.OutTradeNo)
+	r.ParseForm()
+	form := r.PostForm
+	form.Set("total_fee", "1")
+	forged := httptest.NewRequest(http.MethodPost, "/notify", strings.NewReader(form.Encode()))
+	forged.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, forged)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("forged: %d", w.Code)
+	}
+
+	// 关闭之后才到达的付款通知需要人工处理，确认通知避免渠道一直重试
+	closed := mustCreate(t, m, "1002", 500)
+	mustPay(t, m, "1002")
+	fake.SetStatus(closed.OutTradeNo, payment.StatusClosed)
+	if _, err = m.Close(context.Background(), "1002"); err != nil {
+		t.Fatal(err)
+	}
+	fake.SetStatus(closed.OutTradeNo, payment.StatusSuccess)
+	r, _ = fake.NotifyRequest("/notify", closed.OutTradeNo)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("paid after close: %d", w.Code)
+	}
+	assertState(t, m, "1002", StateClosed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 2 || !errors.Is(errs[0], payment.ErrInvalidSignature) || !errors.Is(errs[1], ErrInvalidTransition) {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestHandleNotificationConcurrent(t *testing.T) {
+	m, fake, _ := newManager(t)
+	o := mustCreate(t, m, "1001", 1000)
+	mustPay(t, m, "1001")
+	fake.Pay(o.OutTradeNo)
+
+	n := &payment.Notification{Provider: "fake", OutTradeNo: o.OutTradeNo, TradeNo: "T1", Status: payment.StatusSuccess, Amount: 1000}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.HandleNotification(n); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	o = assertState(t, m, "1001", StatePaid)
+	if list, _ := m.Transitions(o.ID); len(list) != 2 {
+		t.Errorf("transitions %+v", list)
+	}
+
+	wrong := *n
+	wrong.Amount = 1
+	if err := m.HandleNotification(&wrong); err != ErrAmountMismatch {
+		t.Errorf("amount: %v", err)
+	}
+	wrong.OutTradeNo = "unknown"
+	if err := m.HandleNotification(&wrong); err != ErrOrderNotFound {
+		t.Errorf("unknown order: %v", err)
+	}
+}
+
+func TestCloseAndRefund(t *testing.T) {
+	ctx := context.Background()
+	m, fake, _ := newManager(t)
+
+	mustCreate(t, m, "1001", 1000)
+	if _, err := m.Close(ctx, "1001"); err != nil {
+		t.Fatal(err)
+	}
+	assertState(t, m, "1001", StateClosed)
+	if fake.Calls("Close") != 0 {
+		t.Errorf("closed unpaid trade at the provider")
+	}
+	var te *TransitionError
+	if _, err := m.Pay(ctx, "1001", payment.CreateRequest{Scene: payment.SceneNative}); !errors.As(err, &te) || te.State != StateClosed {
+		t.Errorf("pay closed order: %v", err)
+	}
+
+	mustCreate(t, m, "1002", 1000)
+	mustPay(t, m, "1002")
+	if _, err := m.Close(ctx, "1002"); err != nil {
+		t.Fatal(err)
+	}
+	assertState(t, m, "1002", StateClosed)
+
+	// 关闭时用户已经付款
+	o := mustCreate(t, m, "1003", 1000)
+	mustPay(t, m, "1003")
+	fake.Pay(o.OutTradeNo)
+	if _, err := m.Close(ctx, "1003"); !errors.Is(err, payment.ErrTradePaid) {
+		t.Errorf("close paid: %v", err)
+	}
+	assertState(t, m, "1003", StatePaid)
+	if _, err := m.Close(ctx, "1003"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("close paid again: %v", err)
+	}
+
+	if _, err := m.Refund(ctx, "1003", 2000, "damaged"); err != payment.ErrRefundExceeded {
+		t.Errorf("refund exceeded: %v", err)
+	}
+	o, err := m.Refund(ctx, "1003", 600, "damaged")
+	if err != nil || o.State != StateRefunded || o.RefundAmount != 600 || o.OutRefundNo == "" {
+		t.Fatalf("Refund %+v, %v", o, err)
+	}
+	if o, err = m.Refund(ctx, "1003", 600, "damaged"); err != nil || o.State != StateRefunded {
+		t.Errorf("refund twice %+v, %v", o, err)
+	}
+	if fake.Calls("Refund") != 1 {
+		t.Errorf("Refund calls %d", fake.Calls("Refund"))
+	}
+	if _, err = m.Refund(ctx, "1002", 600, "damaged"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("refund closed: %v", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	m, fake, clock := newManager(t, WithReconcileDelay(time.Minute), WithPayTimeout(30*time.Minute))
+
+	paid := mustCreate(t, m, "paid", 1000)
+	mustPay(t, m, "paid")
+	mustCreate(t, m, "waiting", 1000)
+	mustPay(t, m, "waiting")
+	fake.Pay(paid.OutTradeNo)
+
+	// 还没有到对账时间
+	if n, err := m.Reconcile(ctx); err != nil || n != 0 || fake.Calls("Query") != 0 {
+		t.Fatalf("Reconcile %d, %v", n, err)
+	}
+	clock.Add(2 * time.Minute)
+	if n, err := m.Reconcile(ctx); err != nil || n != 1 {
+		t.Fatalf("Reconcile %d, %v", n, err)
+	}
+	o := assertState(t, m, "paid", StatePaid)
+	if list, _ := m.Transitions(o.ID); len(list) != 2 || list[1].Source != SourceReconcile {
+		t.Errorf("transitions %+v", list)
+	}
+	assertState(t, m, "waiting", StatePaying)
+
+	// 超时未付款的订单关闭
+	clock.Add(30 * time.Minute)
+	if n, err := m.Reconcile(ctx); err != nil || n != 1 {
+		t.Fatalf("Reconcile %d, %v", n, err)
+	}
+	assertState(t, m, "waiting", StateClosed)
+	if fake.Calls("Close") != 1 {
+		t.Errorf("Close calls %d", fake.Calls("Close"))
+	}
+
+	// 微信支付的退款是异步的
+	fake.SetAsyncRefund(true)
+	o, err := m.Refund(ctx, "paid", 1000, "")
+	if err != nil || o.State != StateRefunding {
+		t.Fatalf("Refund %+v, %v", o, err)
+	}
+	clock.Add(2 * time.Minute)
+	if n, err := m.Reconcile(ctx); err != nil || n != 0 {
+		t.Fatalf("Reconcile %d, %v", n, err)
+	}
+	fake.CompleteRefund(o.OutRefundNo)
+	if n, err := m.Reconcile(ctx); err != nil || n != 1 {
+		t.Fatalf("Reconcile %d, %v", n, err)
+	}
+	assertState(t, m, "paid", StateRefunded)
+}
+
+func TestReconcileRetriesRefund(t *testing.T) {
+	ctx := context.Background()
+	var errs []error
+	m, fake, clock := newManager(t, WithErrorHandler(func(err error) { errs = append(errs, err) }))
+	o := mustCreate(t, m, "1001", 1000)
+	mustPay(t, m, "1001")
+	fake.Pay(o.OutTradeNo)
+
+	// 下单返回已付款时查询交易，不用等通知
+	if _, err := m.Pay(ctx, "1001", payment.CreateRequest{Scene: payment.SceneNative}); !errors.Is(err, payment.ErrTradePaid) {
+		t.Fatalf("pay again: %v", err)
+	}
+	assertState(t, m, "1001", StatePaid)
+
+	timeout := errors.New("i/o timeout")
+	fake.FailNext(timeout)
+	if _, err := m.Refund(ctx, "1001", 1000, ""); err != timeout {
+		t.Fatalf("Refund: %v", err)
+	}
+	assertState(t, m, "1001", StateRefunding)
+
+	clock.Add(2 * time.Minute)
+	fake.FailNext(timeout)
+	if n, err := m.Reconcile(ctx); err != nil || n != 0 || len(errs) != 1 {
+		t.Fatalf("Reconcile %d, %v, %v", n, err, errs)
+	}
+	// 退款请求没有到达渠道，用同一个退款单号重新发起
+	if n, err := m.Reconcile(ctx); err != nil || n != 1 {
+		t.Fatalf("Reconcile %d, %v", n, err)
+	}
+	assertState(t, m, "1001", StateRefunded)
+	if fake.Calls("Refund") != 2 {
+		t.Errorf("Refund calls %d", fake.Calls("Refund"))
+	}
+}
+
+func TestRun(t *testing.T) {
+	m, fake, clock := newManager(t, WithPollInterval(10*time.Millisecond))
+	o := mustCreate(t, m, "1001", 1000)
+	mustPay(t, m, "1001")
+	fake.Pay(o.OutTradeNo)
+	clock.Add(2 * time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if o, _ = m.Get("1001"); o.State == StatePaid {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("order not reconciled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run: %v", err)
+	}
+}
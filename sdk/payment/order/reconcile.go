@@ -0,0 +1,90 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-demo/sdk/payment"
+)
+
+// Run 定时对账，阻塞直到 ctx 取消
+func (m *Manager) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.opts.pollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.Reconcile(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			m.opts.errorHandler(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile 查询一批停留在 paying、refunding 超过 WithReconcileDelay 的订单，返回状态发生变化的数量。
+// 单个订单的错误交给 WithErrorHandler 处理，不影响其他订单
+func (m *Manager) Reconcile(ctx context.Context) (int, error) {
+	now := m.now()
+	var orders []Order
+	err := m.db.Where("state IN (?) AND state_at < ?", []State{StatePaying, StateRefunding}, now.Add(-m.opts.reconcileDelay)).
+		Order("checked_at, id").Limit(m.opts.batchSize).Find(&orders).Error
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := range orders {
+		if err = ctx.Err(); err != nil {
+			return n, err
+		}
+		o := &orders[i]
+		version := o.Version
+		if err = m.reconcile(ctx, o, now); err != nil {
+			m.opts.errorHandler(err)
+		}
+		if o.Version != version {
+			n++
+		}
+		if err = m.db.Model(&Order{}).Where("id = ?", o.ID).UpdateColumn("checked_at", now).Error; err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (m *Manager) reconcile(ctx context.Context, o *Order, now time.Time) error {
+	gw, err := m.gateway(o)
+	if err != nil {
+		return err
+	}
+	switch o.State {
+	case StatePaying:
+		status, err := m.query(ctx, gw, o, SourceReconcile)
+		if err != nil {
+			return err
+		}
+		// 用户正在付款时不关闭
+		if status == payment.StatusNotPay && now.Sub(o.StateAt) >= m.opts.payTimeout {
+			if err = m.close(ctx, gw, o, SourceReconcile); err != nil && !errors.Is(err, payment.ErrTradePaid) {
+				return err
+			}
+		}
+	case StateRefunding:
+		refund, err := gw.QueryRefund(ctx, o.OutTradeNo, o.OutRefundNo)
+		if errors.Is(err, payment.ErrTradeNotFound) {
+			// 退款请求没有到达渠道，用同一个退款单号重新发起
+			return m.refund(ctx, gw, o, SourceReconcile)
+		}
+		if err != nil {
+			return err
+		}
+		return m.applyRefund(o, refund.Status, SourceReconcile)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+/**
+ * 支付网关抽象
+ *   1. PaymentGateway 统一下单、查询、关闭、退款、退款查询和异步通知验签，金额统一以分为单位
+ *   2. OutTradeNo 由业务订单号和第几次发起支付确定，重试下单得到同一个商户订单号，不会重复收款
+ *   3. Fake 本地模拟网关，可以模拟用户付款并生成带签名的异步通知，用于测试，见 fake.go
+ * 支付宝的实现见 sdk/alipay，微信支付 v2 的实现见 sdk/weixin
+ */
+package payment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTradeNotFound    = errors.New("payment: trade not found")
+	ErrTradePaid        = errors.New("payment: trade already paid")
+	ErrTradeNotPaid     = errors.New("payment: trade not paid")
+	ErrTradeClosed      = errors.New("payment: trade closed")
+	ErrDuplicateTrade   = errors.New("payment: out trade no already used with different parameters")
+	ErrRefundExceeded   = errors.New("payment: refund amount exceeds paid amount")
+	ErrInvalidAmount    = errors.New("payment: invalid amount")
+	ErrInvalidSignature = errors.New("payment: invalid notification signature")
+	ErrUnsupportedScene = errors.New("payment: scene not supported by the gateway")
+)
+
+// TradeStatus 交易在渠道侧的状态
+type TradeStatus string
+
+const (
+	// 已下单，等待付款
+	StatusNotPay TradeStatus = "NOTPAY"
+	// 用户正在付款，例如输入密码中
+	StatusPaying TradeStatus = "USERPAYING"
+	// 付款成功
+	StatusSuccess TradeStatus = "SUCCESS"
+	// 未付款关闭，或者超时关闭
+	StatusClosed TradeStatus = "CLOSED"
+	// 付款成功后发生了退款
+	StatusRefund TradeStatus = "REFUND"
+)
+
+// Scene 支付场景，决定 CreateResult 中返回的内容
+type Scene string
+
+const (
+	// 电脑网站，PayURL 为跳转地址
+	ScenePage Scene = "page"
+	// 手机网站，PayURL 为跳转地址
+	SceneWap Scene = "wap"
+	// APP，Params 为客户端调起支付的参数
+	SceneApp Scene = "app"
+	// 扫码，PayURL 为二维码内容
+	SceneNative Scene = "native"
+	// 公众号、小程序，需要 OpenID，Params 为前端调起支付的参数
+	SceneJSAPI Scene = "jsapi"
+)
+
+// CreateRequest 下单参数
+type CreateRequest struct {
+	OutTradeNo string
+	Subject    string
+	// 金额，单位为分
+	Amount int64
+	Scene  Scene
+	// 为空时使用网关配置的地址
+	NotifyURL string
+	ReturnURL string
+	ClientIP  string
+	OpenID    string
+	// 原样在异步通知中返回
+	Passback string
+}
+
+// CreateResult 下单结果
+type CreateResult struct {
+	OutTradeNo string
+	PayURL     string
+	Params     map[string]string
+}
+
+// Trade 查询到的交易
+type Trade struct {
+	OutTradeNo string
+	// 渠道的交易号
+	TradeNo string
+	Status  TradeStatus
+	Amount  int64
+	PaidAt  time.Time
+}
+
+// RefundRequest 退款参数，重试同一笔退款时使用相同的 OutRefundNo
+type RefundRequest struct {
+	OutTradeNo  string
+	OutRefundNo string
+	// 订单总金额，微信支付需要
+	TotalAmount int64
+	Amount      int64
+	Reason      string
+}
+
+// RefundStatus 退款状态
+type RefundStatus string
+
+const (
+	// 已受理，结果以查询或通知为准
+	RefundProcessing RefundStatus = "PROCESSING"
+	RefundSuccess    RefundStatus = "SUCCESS"
+	// 退款关闭或异常，需要人工处理
+	RefundFailed RefundStatus = "FAILED"
+)
+
+// Refund 退款结果
+type Refund struct {
+	OutTradeNo  string
+	OutRefundNo string
+	RefundNo    string
+	Amount      int64
+	Status      RefundStatus
+}
+
+// Notification 验签通过的异步通知
+type Notification struct {
+	Provider   string
+	OutTradeNo string
+	TradeNo    string
+	Status     TradeStatus
+	Amount     int64
+	PaidAt     time.Time
+	Passback   string
+	// 通知的原始参数
+	Raw map[string]string
+}
+
+// PaymentGateway 支付渠道
+type PaymentGateway interface {
+	// Name 渠道名，和 Notification.Provider 相同
+	Name() string
+	// Create 下单，同一个 OutTradeNo 使用相同参数重复调用时返回同一笔交易，
+	// 已经付款时返回 ErrTradePaid，参数不同时返回 ErrDuplicateTrade
+	Create(ctx context.Context, req *CreateRequest) (*CreateResult, error)
+	// Query 查询交易，交易不存在时返回 ErrTradeNotFound
+	Query(ctx context.Context, outTradeNo string) (*Trade, error)
+	// Close 关闭未付款的交易，已经关闭时不报错，已经付款时返回 ErrTradePaid
+	Close(ctx context.Context, outTradeNo string) error
+	// Refund 申请退款，同一个 OutRefundNo 重复调用只退一次
+	Refund(ctx context.Context, req *RefundRequest) (*Refund, error)
+	// QueryRefund 查询退款，退款不存在时返回 ErrTradeNotFound
+	QueryRefund(ctx context.Context, outTradeNo, outRefundNo string) (*Refund, error)
+	// VerifyNotification 解析异步通知并验签，签名错误时返回 ErrInvalidSignature
+	VerifyNotification(r *http.Request) (*Notification, error)
+	// AckNotification 按渠道的格式应答异步通知，err 不为空时渠道稍后会重新通知
+	AckNotification(w http.ResponseWriter, err error)
+}
+
+// Error 渠道返回的业务错误，可以用 errors.Is 和 ErrTradePaid 等比较
+type Error struct {
+	Provider string
+	Code     string
+	Message  string
+	// 对应的包内错误，没有对应时为 nil
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("payment: %s: %s: %s", e.Provider, e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// OutTradeNo 由业务订单号和第几次发起支付生成 32 位商户订单号，同样的参数总是得到同样的结果，
+// 重试下单不会产生新的交易。上一笔交易关闭后重新支付时 attempt 加一
+func OutTradeNo(bizID string, attempt int) string {
+	sum := sha256.Sum256([]byte(bizID + "\x00" + strconv.Itoa(attempt)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// OutRefundNo 由商户订单号和第几次退款生成 32 位退款单号
+func OutRefundNo(outTradeNo string, seq int) string {
+	return OutTradeNo("refund\x00"+outTradeNo, seq)
+}
+
+// FormatYuan 分转换为保留两位小数的元
+func FormatYuan(fen int64) string {
+	sign := ""
+	if fen < 0 {
+		sign, fen = "-", -fen
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, fen/100, fen%100)
+}
+
+// ParseYuan 元转换为分，不经过浮点数，超过两位小数时返回 ErrInvalidAmount
+func ParseYuan(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	yuan, cents := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		yuan, cents = s[:i], s[i+1:]
+	}
+	if yuan == "" || len(cents) > 2 || strings.Trim(yuan+cents, "0123456789") != "" {
+		return 0, ErrInvalidAmount
+	}
+	y, err := strconv.ParseInt(yuan, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	cents += strings.Repeat("0", 2-len(cents))
+	c, _ := strconv.ParseInt(cents, 10, 64)
+	return y*100 + c, nil
+}
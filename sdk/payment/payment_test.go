@@ -0,0 +1,38 @@
+package payment
+
+import (
+	"testing"
+)
+
+func TestOutTradeNo(t *testing.T) {
+	a := OutTradeNo("order-1", 0)
+	if len(a) != 32 || a != OutTradeNo("order-1", 0) {
+		t.Fatalf("not stable: %s", a)
+	}
+	seen := map[string]bool{a: true}
+	for _, no := range []string{OutTradeNo("order-1", 1), OutTradeNo("order-2", 0), OutTradeNo("order-10", 0), OutRefundNo(a, 0), OutRefundNo(a, 1)} {
+		if len(no) != 32 || seen[no] {
+			t.Errorf("duplicate or invalid %s", no)
+		}
+		seen[no] = true
+	}
+}
+
+func TestYuan(t *testing.T) {
+	for fen, yuan := range map[int64]string{0: "0.00", 1: "0.01", 10: "0.10", 100: "1.00", 123456: "1234.56", -5: "-0.05"} {
+		if got := FormatYuan(fen); got != yuan {
+			t.Errorf("FormatYuan(%d) = %s, want %s", fen, got, yuan)
+		}
+	}
+	valid := map[string]int64{"0.01": 1, "0.1": 10, "1": 100, "1.": 100, "1234.56": 123456, " 8.88 ": 888, "100000000.00": 10000000000}
+	for yuan, fen := range valid {
+		if got, err := ParseYuan(yuan); err != nil || got != fen {
+			t.Errorf("ParseYuan(%q) = %d, %v, want %d", yuan, got, err, fen)
+		}
+	}
+	for _, yuan := range []string{"", ".5", "1.001", "-1", "+1", "1.-1", "1.+1", "abc", "1e3", "0x10"} {
+		if _, err := ParseYuan(yuan); err != ErrInvalidAmount {
+			t.Errorf("ParseYuan(%q): expected ErrInvalidAmount, got %v", yuan, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package mq
+
+import (
+	"github.com/streadway/amqp"
+
+	"go-demo/sdk/rabbitmq/internal/amqpconn"
+)
+
+type (
+	// Connection amqp.Connection 中用到的方法，测试中可以替换为 rabbitmqtest.Broker
+	Connection = amqpconn.Connection
+
+	// Channel amqp.Channel 中用到的方法
+	Channel = amqpconn.Channel
+
+	// Dialer 建立连接，默认为 DialAMQP
+	Dialer func(url string) (Connection, error)
+)
+
+// DialAMQP 连接真实的 RabbitMQ
+func DialAMQP(url string) (Connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return amqpConnection{conn}, nil
+}
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (c amqpConnection) Channel() (Channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
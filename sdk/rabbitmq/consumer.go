@@ -0,0 +1,239 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	// HeaderRetryCount 已经重试的次数
+	HeaderRetryCount = "x-retry-count"
+	// HeaderError 进入死信队列前最后一次处理的错误
+	HeaderError = "x-error"
+	// HeaderOriginalQueue 进入死信队列前所在的队列
+	HeaderOriginalQueue = "x-original-queue"
+)
+
+var errCallbackFailed = errors.New("rabbitmq: callback failed")
+
+// Handler 返回 nil 时 ack，返回错误时延迟重试，Permanent 包装的错误不再重试直接进入死信队列
+type Handler func(ctx context.Context, d amqp.Delivery) error
+
+type permanentError struct {
+	err error
+}
+
+// Permanent 标记不需要重试的错误，如消息格式错误
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// RetryCount 消息已经重试的次数，第一次投递为 0
+func RetryCount(d amqp.Delivery) int {
+	switch n := d.Headers[HeaderRetryCount].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// DelayQueueName 重试延迟队列名，消息在其中过期后通过 DLX 回到 queue
+func DelayQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queue, delay/time.Millisecond)
+}
+
+// Consume 手动 ack 消费 queue，阻塞直到 ctx 取消或 Client 关闭，连接断开时自动恢复。
+// 处理失败的消息发布到延迟队列(x-message-ttl + x-dead-letter-exchange)，
+// 过期后回到 queue 重新消费，超过最大重试次数后进入死信队列
+func (c *Client) Consume(ctx context.Context, queue string, h Handler, opts ...ConsumeOption) error {
+	o := evaluateConsumeOptions(queue, opts)
+	for {
+		conn, err := c.connection(ctx)
+		if err != nil {
+			return err
+		}
+		started, err := c.consume(ctx, conn, queue, h, o)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// 声明队列等配置错误不重试
+		if !started && err != nil && err != amqp.ErrClosed {
+			return err
+		}
+		// 连接断开，等待重连后继续消费
+		select {
+		case <-time.After(c.opts.reconnectDelay):
+		case <-c.done:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// StartConsume 兼容原来的接口，callback 返回 false 时重试，超过次数后进入 qName.err 队列
+func (c *Client) StartConsume(qName, cName string, callback func(msg []byte) bool) error {
+	return c.Consume(context.Background(), qName, func(_ context.Context, d amqp.Delivery) error {
+		if !callback(d.Body) {
+			return errCallbackFailed
+		}
+		return nil
+	}, WithConsumerTag(cName))
+}
+
+var consumerSeq uint64
+
+// consume 在一个连接上消费，直到连接断开或 ctx 取消，started 表示是否已经开始消费
+func (c *Client) consume(ctx context.Context, conn Connection, queue string, h Handler, o *consumeOptions) (started bool, err error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, err
+	}
+	defer ch.Close()
+	if err = declareRetry(ch, queue, o); err != nil {
+		return false, err
+	}
+	if err = ch.Qos(o.prefetch, 0, false); err != nil {
+		return false, err
+	}
+	// 重试和死信使用单独的 channel 发布
+	pub, err := newPublisher(conn)
+	if err != nil {
+		return false, err
+	}
+	defer pub.channel.Close()
+
+	tag := o.consumerTag
+	if tag == "" {
+		tag = fmt.Sprintf("%s-%d-%d", queue, time.Now().UnixNano(), atomic.AddUint64(&consumerSeq, 1))
+	}
+	deliveries, err := ch.Consume(queue, tag, false, false, false, false, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// ctx 取消时停止接收新消息，处理中的消息完成后再关闭 channel
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ch.Cancel(tag, false)
+		case <-stop:
+		}
+	}()
+
+	done := make(chan struct{}, o.concurrency)
+	for i := 0; i < o.concurrency; i++ {
+		go func() {
+			for d := range deliveries {
+				handle(ctx, pub, queue, h, o, d)
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < o.concurrency; i++ {
+		<-done
+	}
+	return true, nil
+}
+
+func declareRetry(ch Channel, queue string, o *consumeOptions) error {
+	if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+		return err
+	}
+	for _, delay := range o.retryDelays {
+		_, err := ch.QueueDeclare(DelayQueueName(queue, delay), true, false, false, false, amqp.Table{
+			"x-message-ttl":             int64(delay / time.Millisecond),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ch.QueueDeclare(o.deadLetter, true, false, false, false, nil)
+	return err
+}
+
+// handle 处理一条消息，重试或进入死信队列的消息先发布成功再 ack，发布失败时重新入队，不会丢消息
+func handle(ctx context.Context, pub *publisher, queue string, h Handler, o *consumeOptions, d amqp.Delivery) {
+	err := call(ctx, h, d)
+	if err == nil {
+		d.Ack(false)
+		return
+	}
+
+	retries := RetryCount(d)
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	delete(headers, "x-death")
+
+	var (
+		key  string
+		perm *permanentError
+	)
+	if errors.As(err, &perm) || retries >= o.maxRetries {
+		key = o.deadLetter
+		headers[HeaderError] = err.Error()
+		headers[HeaderOriginalQueue] = queue
+		headers[HeaderRetryCount] = int32(retries)
+	} else {
+		delay := o.retryDelays[len(o.retryDelays)-1]
+		if retries < len(o.retryDelays) {
+			delay = o.retryDelays[retries]
+		}
+		key = DelayQueueName(queue, delay)
+		headers[HeaderRetryCount] = int32(retries + 1)
+	}
+
+	msg := amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+	// 通过默认交换机直接投递到延迟队列或死信队列
+	if err = pub.publish(context.Background(), "", key, msg); err != nil {
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+}
+
+// call handler panic 时按错误处理
+func call(ctx context.Context, h Handler, d amqp.Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rabbitmq: handler panic: %v", r)
+		}
+	}()
+	return h(ctx, d)
+}
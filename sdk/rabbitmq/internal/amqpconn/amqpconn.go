@@ -0,0 +1,28 @@
+// Package amqpconn 客户端用到的 amqp 连接和 channel 方法，
+// 单独成包使测试用的 rabbitmqtest 不需要依赖客户端
+package amqpconn
+
+import "github.com/streadway/amqp"
+
+type (
+	// Connection amqp.Connection 中用到的方法
+	Connection interface {
+		Channel() (Channel, error)
+		NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+		Close() error
+	}
+
+	// Channel amqp.Channel 中用到的方法
+	Channel interface {
+		ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+		QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+		QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+		Qos(prefetchCount, prefetchSize int, global bool) error
+		Confirm(noWait bool) error
+		NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+		Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+		Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+		Cancel(consumer string, noWait bool) error
+		Close() error
+	}
+)
@@ -0,0 +1,119 @@
+package mq
+
+import "time"
+
+type (
+	Option  func(*options)
+	options struct {
+		dialer            Dialer
+		reconnectDelay    time.Duration
+		maxReconnectDelay time.Duration
+	}
+
+	ConsumeOption  func(*consumeOptions)
+	consumeOptions struct {
+		consumerTag string
+		prefetch    int
+		concurrency int
+		maxRetries  int
+		retryDelays []time.Duration
+		deadLetter  string
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		dialer:            DialAMQP,
+		reconnectDelay:    time.Second,
+		maxReconnectDelay: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+func evaluateConsumeOptions(queue string, opts []ConsumeOption) *consumeOptions {
+	optCopy := &consumeOptions{
+		prefetch:    10,
+		concurrency: 1,
+		maxRetries:  3,
+		retryDelays: []time.Duration{time.Second, 10 * time.Second, time.Minute},
+		deadLetter:  queue + ".err",
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.concurrency < 1 {
+		optCopy.concurrency = 1
+	}
+	if optCopy.prefetch < optCopy.concurrency {
+		optCopy.prefetch = optCopy.concurrency
+	}
+	if len(optCopy.retryDelays) == 0 {
+		optCopy.maxRetries = 0
+	}
+
+	return optCopy
+}
+
+// WithDialer sets how to connect to the broker, it is used to plug in a local broker in tests.
+func WithDialer(dialer Dialer) Option {
+	return func(opts *options) {
+		opts.dialer = dialer
+	}
+}
+
+// WithReconnectDelay sets the first and the max delay between reconnect attempts,
+// the delay doubles after every failed attempt.
+func WithReconnectDelay(delay, max time.Duration) Option {
+	return func(opts *options) {
+		opts.reconnectDelay = delay
+		opts.maxReconnectDelay = max
+	}
+}
+
+// WithConsumerTag sets the consumer tag, the broker generates one when empty.
+func WithConsumerTag(tag string) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.consumerTag = tag
+	}
+}
+
+// WithPrefetch sets the max number of unacknowledged deliveries (QoS prefetch count).
+func WithPrefetch(n int) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.prefetch = n
+	}
+}
+
+// WithConcurrency sets the number of goroutines handling deliveries.
+func WithConcurrency(n int) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.concurrency = n
+	}
+}
+
+// WithMaxRetries sets how many times a failed message is retried before it goes to the dead-letter queue.
+func WithMaxRetries(n int) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.maxRetries = n
+	}
+}
+
+// WithRetryDelays sets the delay before each retry, the last delay is reused for later retries.
+// Each distinct delay is a delay queue with a message TTL that dead-letters back to the consumed queue.
+func WithRetryDelays(delays ...time.Duration) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.retryDelays = delays
+	}
+}
+
+// WithDeadLetterQueue sets the queue receiving messages that exhausted their retries,
+// defaults to "<queue>.err", e.g. TransOSSErrQueueName for TransOSSQueueName.
+func WithDeadLetterQueue(name string) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.deadLetter = name
+	}
+}
@@ -1,7 +1,285 @@
 package mq
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
 
-func TestRabbitMq(t *testing.T) {
-	t.Log("RabbitMQ Success!")
+	"github.com/streadway/amqp"
+
+	"go-demo/sdk/rabbitmq/rabbitmqtest"
+)
+
+func newTestClient(t *testing.T, b *rabbitmqtest.Broker) *Client {
+	t.Helper()
+	c, err := NewClient(RabbitURL, WithDialer(b.Dial), WithReconnectDelay(5*time.Millisecond, 20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// consume 在后台消费，返回的函数停止消费并返回 Consume 的结果
+func consume(c *Client, queue string, h Handler, opts ...ConsumeOption) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- c.Consume(ctx, queue, h, opts...) }()
+	var (
+		once sync.Once
+		err  error
+	)
+	return func() error {
+		once.Do(func() {
+			cancel()
+			err = <-errc
+		})
+		return err
+	}
+}
+
+type recorder struct {
+	mu   sync.Mutex
+	msgs []amqp.Delivery
+	got  chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{got: make(chan struct{}, 100)}
+}
+
+func (r *recorder) record(d amqp.Delivery) {
+	r.mu.Lock()
+	r.msgs = append(r.msgs, d)
+	r.mu.Unlock()
+	r.got <- struct{}{}
+}
+
+func (r *recorder) wait(t *testing.T, n int) []amqp.Delivery {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.got:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %d messages, want %d", i, n)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]amqp.Delivery(nil), r.msgs...)
+}
+
+func TestPublishConsume(t *testing.T) {
+	b := rabbitmqtest.NewBroker()
+	c := newTestClient(t, b)
+	if err := c.Bind(TransExchangeName, amqp.ExchangeTopic, TransOSSQueueName, "oss.#"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PublishText(TransExchangeName, "oss.upload.png", []byte("a.png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PublishText(TransExchangeName, "cos.upload", []byte("skip")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRecorder()
+	stop := consume(c, TransOSSQueueName, func(_ context.Context, d amqp.Delivery) error {
+		r.record(d)
+		return nil
+	})
+	msgs := r.wait(t, 1)
+	if err := stop(); err != context.Canceled {
+		t.Errorf("Consume returned %v", err)
+	}
+	if string(msgs[0].Body) != "a.png" || msgs[0].DeliveryMode != amqp.Persistent || RetryCount(msgs[0]) != 0 {
+		t.Errorf("unexpected delivery %+v", msgs[0])
+	}
+	if left := b.Messages(TransOSSQueueName); len(left) != 0 {
+		t.Errorf("%d messages left, acked message should be removed", len(left))
+	}
+}
+
+func TestRetryDeadLetter(t *testing.T) {
+	b := rabbitmqtest.NewBroker()
+	c := newTestClient(t, b)
+
+	r := newRecorder()
+	stop := consume(c, TransOSSQueueName, func(_ context.Context, d amqp.Delivery) error {
+		r.record(d)
+		// 第二次重试后成功
+		if string(d.Body) == "flaky" && RetryCount(d) == 2 {
+			return nil
+		}
+		return errors.New("upload failed")
+	}, WithMaxRetries(2), WithRetryDelays(10*time.Millisecond, 20*time.Millisecond))
+	defer stop()
+
+	b.WaitQueue(t, TransOSSQueueName)
+	ctx := context.Background()
+	if err := c.Publish(ctx, "", TransOSSQueueName, amqp.Publishing{Body: []byte("broken"), MessageId: "m1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(ctx, "", TransOSSQueueName, amqp.Publishing{Body: []byte("flaky")}); err != nil {
+		t.Fatal(err)
+	}
+
+	dead := b.WaitMessages(t, TransOSSErrQueueName, 1)
+	msgs := r.wait(t, 6)
+	counts := map[string][]int{}
+	for _, d := range msgs {
+		counts[string(d.Body)] = append(counts[string(d.Body)], RetryCount(d))
+	}
+	for _, body := range []string{"broken", "flaky"} {
+		if got := counts[body]; len(got) != 3 || got[0] != 0 || got[1] != 1 || got[2] != 2 {
+			t.Errorf("%s retry counts %v", body, got)
+		}
+	}
+
+	if len(dead) != 1 {
+		t.Fatalf("dead letters %d", len(dead))
+	}
+	d := dead[0]
+	if string(d.Body) != "broken" || d.MessageId != "m1" || d.Headers[HeaderError] != "upload failed" ||
+		d.Headers[HeaderOriginalQueue] != TransOSSQueueName || d.Headers[HeaderRetryCount] != int32(2) {
+		t.Errorf("unexpected dead letter %+v", d)
+	}
+	if _, ok := d.Headers["x-death"]; ok {
+		t.Error("x-death header should be dropped")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := len(b.Messages(TransOSSErrQueueName)); n != 1 {
+		t.Errorf("flaky message should not be dead-lettered, dlq has %d", n)
+	}
+}
+
+func TestPermanentError(t *testing.T) {
+	b := rabbitmqtest.NewBroker()
+	c := newTestClient(t, b)
+
+	r := newRecorder()
+	stop := consume(c, "jobs", func(_ context.Context, d amqp.Delivery) error {
+		r.record(d)
+		if string(d.Body) == "panic" {
+			panic("boom")
+		}
+		return Permanent(errors.New("bad json"))
+	}, WithDeadLetterQueue("jobs.dead"), WithRetryDelays(time.Hour))
+	defer stop()
+
+	b.WaitQueue(t, "jobs")
+	if err := c.Publish(context.Background(), "", "jobs", amqp.Publishing{Body: []byte("{")}); err != nil {
+		t.Fatal(err)
+	}
+	dead := b.WaitMessages(t, "jobs.dead", 1)
+	if len(r.wait(t, 1)) != 1 || dead[0].Headers[HeaderError] != "bad json" {
+		t.Errorf("unexpected dead letter %+v", dead[0])
+	}
+
+	if n := len(b.Messages(DelayQueueName("jobs", time.Hour))); n != 0 {
+		t.Errorf("permanent error should not be retried, delay queue has %d messages", n)
+	}
+
+	// panic 和普通错误一样进入延迟队列
+	if err := c.Publish(context.Background(), "", "jobs", amqp.Publishing{Body: []byte("panic")}); err != nil {
+		t.Fatal(err)
+	}
+	delayed := b.WaitMessages(t, DelayQueueName("jobs", time.Hour), 1)
+	if string(delayed[0].Body) != "panic" || delayed[0].Headers[HeaderRetryCount] != int32(1) {
+		t.Errorf("unexpected delayed message %+v", delayed[0])
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	b := rabbitmqtest.NewBroker()
+	c := newTestClient(t, b)
+
+	var (
+		mu             sync.Mutex
+		inflight, peak int
+	)
+	release := make(chan struct{})
+	r := newRecorder()
+	stop := consume(c, "jobs", func(_ context.Context, d amqp.Delivery) error {
+		mu.Lock()
+		if inflight++; inflight > peak {
+			peak = inflight
+		}
+		mu.Unlock()
+		r.record(d)
+		<-release
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		return nil
+	}, WithPrefetch(3), WithConcurrency(3))
+
+	b.WaitQueue(t, "jobs")
+	for i := 0; i < 10; i++ {
+		if err := c.Publish(context.Background(), "", "jobs", amqp.Publishing{Body: []byte("job")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.wait(t, 3)
+	// 未 ack 的消息达到 prefetch 后 broker 不再投递
+	if n := len(b.Messages("jobs")); n != 7 {
+		t.Errorf("%d messages left in queue, want 7", n)
+	}
+	close(release)
+	r.wait(t, 7)
+	if err := stop(); err != context.Canceled {
+		t.Errorf("Consume returned %v", err)
+	}
+	if peak != 3 {
+		t.Errorf("peak concurrency %d", peak)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	b := rabbitmqtest.NewBroker()
+	c := newTestClient(t, b)
+	if err := c.Bind(TransExchangeName, amqp.ExchangeDirect, TransOSSQueueName, TransOSSRoutingKey); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRecorder()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.StartConsume(TransOSSQueueName, "oss", func(msg []byte) bool {
+			r.record(amqp.Delivery{Body: msg})
+			return true
+		})
+	}()
+	if err := c.PublishText(TransExchangeName, TransOSSRoutingKey, []byte("before")); err != nil {
+		t.Fatal(err)
+	}
+	r.wait(t, 1)
+
+	// broker 重启期间发布的消息在重连后发送，交换机和绑定重新声明
+	b.SetDown(true)
+	b.Restart()
+	published := make(chan error, 1)
+	go func() { published <- c.PublishText(TransExchangeName, TransOSSRoutingKey, []byte("after")) }()
+	time.Sleep(30 * time.Millisecond)
+	b.SetDown(false)
+
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+	msgs := r.wait(t, 1)
+	if string(msgs[1].Body) != "after" {
+		t.Errorf("unexpected message %s", msgs[1].Body)
+	}
+	if n := b.DialCount(); n < 3 {
+		t.Errorf("dialed %d times, want reconnect attempts while down", n)
+	}
+
+	c.Close()
+	if err := <-errc; err != ErrClosed {
+		t.Errorf("Consume after Close returned %v", err)
+	}
+	if err := c.PublishText(TransExchangeName, TransOSSRoutingKey, nil); err != ErrClosed {
+		t.Errorf("Publish after Close returned %v", err)
+	}
 }
@@ -0,0 +1,559 @@
+// Package rabbitmqtest 测试用的本地 RabbitMQ broker，Dial 可以作为客户端的 Dialer：
+//
+//	b := rabbitmqtest.NewBroker()
+//	c, err := mq.NewClient(url, mq.WithDialer(b.Dial))
+package rabbitmqtest
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"go-demo/sdk/rabbitmq/internal/amqpconn"
+)
+
+// Broker 支持默认、direct、topic、fanout 交换机，队列 TTL 和死信，
+// prefetch、confirm，channel 关闭后未 ack 的消息重新入队
+type Broker struct {
+	mu        sync.Mutex
+	exchanges map[string]string
+	bindings  []binding
+	queues    map[string]*fakeQueue
+	conns     []*fakeConn
+	dials     int
+	down      bool
+}
+
+type binding struct {
+	exchange, queue, key string
+}
+
+type fakeMsg struct {
+	exchange, key string
+	pub           amqp.Publishing
+	redelivered   bool
+}
+
+type fakeQueue struct {
+	name      string
+	ttl       time.Duration
+	dlx       *string
+	dlk       string
+	msgs      []*fakeMsg
+	consumers []*fakeConsumer
+	next      int
+}
+
+type fakeConsumer struct {
+	tag string
+	ch  *fakeChannel
+	q   *fakeQueue
+	out chan amqp.Delivery
+}
+
+type fakeConn struct {
+	b        *Broker
+	closed   bool
+	channels []*fakeChannel
+	notify   []chan *amqp.Error
+}
+
+type fakeChannel struct {
+	conn      *fakeConn
+	closed    bool
+	prefetch  int
+	confirm   bool
+	published uint64
+	notify    []chan amqp.Confirmation
+	tag       uint64
+	unacked   map[uint64]unacked
+	consumers map[string]*fakeConsumer
+}
+
+type unacked struct {
+	q *fakeQueue
+	m *fakeMsg
+}
+
+func NewBroker() *Broker {
+	return &Broker{exchanges: map[string]string{}, queues: map[string]*fakeQueue{}}
+}
+
+// Dial 建立到 broker 的连接，url 被忽略
+func (b *Broker) Dial(string) (amqpconn.Connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dials++
+	if b.down {
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	c := &fakeConn{b: b}
+	b.conns = append(b.conns, c)
+	return c, nil
+}
+
+// SetDown 为 true 时新的连接失败
+func (b *Broker) SetDown(down bool) {
+	b.mu.Lock()
+	b.down = down
+	b.mu.Unlock()
+}
+
+// Restart 断开所有连接，清空交换机和绑定，持久化队列中的消息保留
+func (b *Broker) Restart() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.conns {
+		b.closeConn(c, &amqp.Error{Code: amqp.ConnectionForced, Reason: "CONNECTION_FORCED"})
+	}
+	b.conns = nil
+	b.exchanges = map[string]string{}
+	b.bindings = nil
+}
+
+// DialCount 建立连接的次数，包括失败的
+func (b *Broker) DialCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dials
+}
+
+// Messages 队列中待投递的消息
+func (b *Broker) Messages(queue string) []amqp.Publishing {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var pubs []amqp.Publishing
+	if q, ok := b.queues[queue]; ok {
+		for _, m := range q.msgs {
+			pubs = append(pubs, m.pub)
+		}
+	}
+	return pubs
+}
+
+// WaitMessages 等待队列中至少有 n 条待投递的消息
+func (b *Broker) WaitMessages(t testing.TB, queue string, n int) []amqp.Publishing {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		pubs := b.Messages(queue)
+		if len(pubs) >= n {
+			return pubs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queue %s has %d messages, want %d", queue, len(pubs), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitQueue 等待队列上有消费者
+func (b *Broker) WaitQueue(t testing.TB, queue string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		b.mu.Lock()
+		q, ok := b.queues[queue]
+		consuming := ok && len(q.consumers) > 0
+		b.mu.Unlock()
+		if consuming {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no consumer on queue %s", queue)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (b *Broker) closeConn(c *fakeConn, err *amqp.Error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for _, ch := range c.channels {
+		b.closeChannel(ch)
+	}
+	for _, n := range c.notify {
+		if err != nil {
+			n <- err
+		}
+		close(n)
+	}
+}
+
+func (b *Broker) closeChannel(ch *fakeChannel) {
+	if ch.closed {
+		return
+	}
+	ch.closed = true
+	for _, consumer := range ch.consumers {
+		b.removeConsumer(consumer)
+	}
+	for _, u := range ch.unacked {
+		u.m.redelivered = true
+		u.q.msgs = append([]*fakeMsg{u.m}, u.q.msgs...)
+	}
+	ch.unacked = nil
+	for _, n := range ch.notify {
+		close(n)
+	}
+	b.dispatchAll()
+}
+
+func (b *Broker) removeConsumer(consumer *fakeConsumer) {
+	delete(consumer.ch.consumers, consumer.tag)
+	q := consumer.q
+	for i, c := range q.consumers {
+		if c == consumer {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+	close(consumer.out)
+}
+
+func (b *Broker) route(exchange, key string, pub amqp.Publishing) {
+	var queues []*fakeQueue
+	if exchange == "" {
+		if q, ok := b.queues[key]; ok {
+			queues = append(queues, q)
+		}
+	}
+	kind := b.exchanges[exchange]
+	for _, bd := range b.bindings {
+		if bd.exchange != exchange {
+			continue
+		}
+		if kind == amqp.ExchangeFanout || (kind == amqp.ExchangeDirect && bd.key == key) ||
+			(kind == amqp.ExchangeTopic && topicMatch(strings.Split(bd.key, "."), strings.Split(key, "."))) {
+			queues = append(queues, b.queues[bd.queue])
+		}
+	}
+	for _, q := range queues {
+		m := &fakeMsg{exchange: exchange, key: key, pub: pub}
+		m.pub.Headers = amqp.Table{}
+		for k, v := range pub.Headers {
+			m.pub.Headers[k] = v
+		}
+		b.enqueue(q, m)
+	}
+}
+
+func topicMatch(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if topicMatch(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && topicMatch(pattern[1:], words[1:])
+	}
+	return len(words) > 0 && pattern[0] == words[0] && topicMatch(pattern[1:], words[1:])
+}
+
+func (b *Broker) enqueue(q *fakeQueue, m *fakeMsg) {
+	q.msgs = append(q.msgs, m)
+	if q.ttl > 0 && q.dlx != nil {
+		time.AfterFunc(q.ttl, func() { b.expire(q, m) })
+	}
+	b.dispatch(q)
+}
+
+// expire 消息过期后投递到死信交换机
+func (b *Broker) expire(q *fakeQueue, m *fakeMsg) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, msg := range q.msgs {
+		if msg != m {
+			continue
+		}
+		q.msgs = append(q.msgs[:i], q.msgs[i+1:]...)
+		key := q.dlk
+		if key == "" {
+			key = m.key
+		}
+		pub := m.pub
+		pub.Headers["x-death"] = []interface{}{amqp.Table{"queue": q.name, "reason": "expired"}}
+		b.route(*q.dlx, key, pub)
+		return
+	}
+}
+
+func (b *Broker) dispatchAll() {
+	for _, q := range b.queues {
+		b.dispatch(q)
+	}
+}
+
+// dispatch 按轮询投递给还有 prefetch 余量的消费者
+func (b *Broker) dispatch(q *fakeQueue) {
+	for len(q.msgs) > 0 {
+		var consumer *fakeConsumer
+		for i := 0; i < len(q.consumers); i++ {
+			c := q.consumers[(q.next+i)%len(q.consumers)]
+			if (c.ch.prefetch == 0 || len(c.ch.unacked) < c.ch.prefetch) && len(c.out) < cap(c.out) {
+				consumer = c
+				q.next = (q.next + i + 1) % len(q.consumers)
+				break
+			}
+		}
+		if consumer == nil {
+			return
+		}
+		m := q.msgs[0]
+		q.msgs = q.msgs[1:]
+		ch := consumer.ch
+		ch.tag++
+		ch.unacked[ch.tag] = unacked{q: q, m: m}
+		consumer.out <- amqp.Delivery{
+			Acknowledger:    ch,
+			Headers:         m.pub.Headers,
+			ContentType:     m.pub.ContentType,
+			ContentEncoding: m.pub.ContentEncoding,
+			DeliveryMode:    m.pub.DeliveryMode,
+			Priority:        m.pub.Priority,
+			CorrelationId:   m.pub.CorrelationId,
+			ReplyTo:         m.pub.ReplyTo,
+			MessageId:       m.pub.MessageId,
+			Timestamp:       m.pub.Timestamp,
+			Type:            m.pub.Type,
+			AppId:           m.pub.AppId,
+			ConsumerTag:     consumer.tag,
+			DeliveryTag:     ch.tag,
+			Redelivered:     m.redelivered,
+			Exchange:        m.exchange,
+			RoutingKey:      m.key,
+			Body:            m.pub.Body,
+		}
+	}
+}
+
+func (c *fakeConn) Channel() (amqpconn.Channel, error) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	ch := &fakeChannel{conn: c, unacked: map[uint64]unacked{}, consumers: map[string]*fakeConsumer{}}
+	c.channels = append(c.channels, ch)
+	return ch, nil
+}
+
+func (c *fakeConn) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if c.closed {
+		close(receiver)
+		return receiver
+	}
+	c.notify = append(c.notify, receiver)
+	return receiver
+}
+
+func (c *fakeConn) Close() error {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	c.b.closeConn(c, nil)
+	return nil
+}
+
+// lock 加锁并检查 channel 是否已关闭，返回的 broker 需要调用方解锁
+func (ch *fakeChannel) lock() (*Broker, error) {
+	b := ch.conn.b
+	b.mu.Lock()
+	if ch.closed {
+		b.mu.Unlock()
+		return nil, amqp.ErrClosed
+	}
+	return b, nil
+}
+
+func (ch *fakeChannel) ExchangeDeclare(name, kind string, _, _, _, _ bool, _ amqp.Table) error {
+	b, err := ch.lock()
+	if err != nil {
+		return err
+	}
+	defer b.mu.Unlock()
+	b.exchanges[name] = kind
+	return nil
+}
+
+func (ch *fakeChannel) QueueDeclare(name string, _, _, _, _ bool, args amqp.Table) (amqp.Queue, error) {
+	b, err := ch.lock()
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	defer b.mu.Unlock()
+	q, ok := b.queues[name]
+	if !ok {
+		q = &fakeQueue{name: name}
+		if ttl, ok := args["x-message-ttl"].(int64); ok {
+			q.ttl = time.Duration(ttl) * time.Millisecond
+		}
+		if dlx, ok := args["x-dead-letter-exchange"].(string); ok {
+			q.dlx = &dlx
+		}
+		q.dlk, _ = args["x-dead-letter-routing-key"].(string)
+		b.queues[name] = q
+	}
+	return amqp.Queue{Name: name, Messages: len(q.msgs), Consumers: len(q.consumers)}, nil
+}
+
+func (ch *fakeChannel) QueueBind(name, key, exchange string, _ bool, _ amqp.Table) error {
+	b, err := ch.lock()
+	if err != nil {
+		return err
+	}
+	defer b.mu.Unlock()
+	if _, ok := b.exchanges[exchange]; !ok {
+		return &amqp.Error{Code: amqp.NotFound, Reason: "no exchange " + exchange}
+	}
+	if _, ok := b.queues[name]; !ok {
+		return &amqp.Error{Code: amqp.NotFound, Reason: "no queue " + name}
+	}
+	bd := binding{exchange: exchange, queue: name, key: key}
+	for _, old := range b.bindings {
+		if old == bd {
+			return nil
+		}
+	}
+	b.bindings = append(b.bindings, bd)
+	return nil
+}
+
+func (ch *fakeChannel) Qos(prefetchCount, _ int, _ bool) error {
+	b, err := ch.lock()
+	if err != nil {
+		return err
+	}
+	defer b.mu.Unlock()
+	ch.prefetch = prefetchCount
+	return nil
+}
+
+func (ch *fakeChannel) Confirm(bool) error {
+	b, err := ch.lock()
+	if err != nil {
+		return err
+	}
+	defer b.mu.Unlock()
+	ch.confirm = true
+	return nil
+}
+
+func (ch *fakeChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	b, err := ch.lock()
+	if err != nil {
+		close(confirm)
+		return confirm
+	}
+	defer b.mu.Unlock()
+	ch.notify = append(ch.notify, confirm)
+	return confirm
+}
+
+func (ch *fakeChannel) Publish(exchange, key string, _, _ bool, msg amqp.Publishing) error {
+	b, err := ch.lock()
+	if err != nil {
+		return err
+	}
+	defer b.mu.Unlock()
+	if _, ok := b.exchanges[exchange]; exchange != "" && !ok {
+		return &amqp.Error{Code: amqp.NotFound, Reason: "no exchange " + exchange}
+	}
+	b.route(exchange, key, msg)
+	if ch.confirm {
+		ch.published++
+		for _, n := range ch.notify {
+			select {
+			case n <- amqp.Confirmation{DeliveryTag: ch.published, Ack: true}:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+func (ch *fakeChannel) Consume(queue, consumer string, _, _, _, _ bool, _ amqp.Table) (<-chan amqp.Delivery, error) {
+	b, err := ch.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer b.mu.Unlock()
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil, &amqp.Error{Code: amqp.NotFound, Reason: "no queue " + queue}
+	}
+	c := &fakeConsumer{tag: consumer, ch: ch, q: q, out: make(chan amqp.Delivery, 1024)}
+	ch.consumers[consumer] = c
+	q.consumers = append(q.consumers, c)
+	b.dispatch(q)
+	return c.out, nil
+}
+
+func (ch *fakeChannel) Cancel(consumer string, _ bool) error {
+	b, err := ch.lock()
+	if err != nil {
+		return err
+	}
+	defer b.mu.Unlock()
+	if c, ok := ch.consumers[consumer]; ok {
+		b.removeConsumer(c)
+	}
+	return nil
+}
+
+func (ch *fakeChannel) Close() error {
+	b, err := ch.lock()
+	if err != nil {
+		return err
+	}
+	defer b.mu.Unlock()
+	b.closeChannel(ch)
+	return nil
+}
+
+func (ch *fakeChannel) Ack(tag uint64, _ bool) error {
+	return ch.settle(tag, false)
+}
+
+func (ch *fakeChannel) Nack(tag uint64, _ bool, requeue bool) error {
+	return ch.settle(tag, requeue)
+}
+
+func (ch *fakeChannel) Reject(tag uint64, requeue bool) error {
+	return ch.settle(tag, requeue)
+}
+
+func (ch *fakeChannel) settle(tag uint64, requeue bool) error {
+	b, err := ch.lock()
+	if err != nil {
+		return err
+	}
+	defer b.mu.Unlock()
+	u, ok := ch.unacked[tag]
+	if !ok {
+		return &amqp.Error{Code: amqp.PreconditionFailed, Reason: "unknown delivery tag"}
+	}
+	delete(ch.unacked, tag)
+	if requeue {
+		u.m.redelivered = true
+		u.q.msgs = append([]*fakeMsg{u.m}, u.q.msgs...)
+	}
+	b.dispatchAll()
+	return nil
+}
@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis"
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache cache-aside 缓存，读时未命中回源并写入，数据更新后调用 Delete 删除缓存
+type Cache struct {
+	client *RedisClient
+	opts   *cacheOptions
+	group  singleflight.Group
+}
+
+func NewCache(client *RedisClient, opts ...CacheOption) *Cache {
+	return &Cache{client: client, opts: evaluateCacheOptions(opts)}
+}
+
+// Fetch 读取 key，未命中时调用 load 并写入缓存。同一个 key 并发未命中时只调用一次 load，
+// load 使用第一个调用方的 ctx，其他调用方 ctx 结束时不再等待
+func Fetch[T any](ctx context.Context, c *Cache, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	data, err := c.fetch(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return load(ctx)
+	})
+	if err != nil {
+		return v, err
+	}
+	err = c.client.opts.codec.Unmarshal(data, &v)
+	return v, err
+}
+
+func (c *Cache) fetch(ctx context.Context, key string, load func(ctx context.Context) (interface{}, error)) ([]byte, error) {
+	client, err := c.client.with(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.Get(key).Bytes()
+	if err == nil {
+		return data, nil
+	}
+	if err != redis.Nil {
+		return nil, err
+	}
+
+	// 返回编码后的数据，每个调用方各自解码，不共享同一个值
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		v, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.client.opts.codec.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		// 写缓存失败不影响本次读取，下次读取再回源
+		client.Set(key, data, c.ttl())
+		return data, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]byte), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Set 写入缓存，TTL 带随机抖动
+func (c *Cache) Set(ctx context.Context, key string, v interface{}) error {
+	return c.client.SetValue(ctx, key, v, c.ttl())
+}
+
+// Delete 删除缓存，先更新数据再删除缓存
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	client, err := c.client.with(ctx)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return client.Del(keys...).Err()
+}
+
+// ttl 在配置的 TTL 上增加 [0, jitter*ttl) 的随机时间，避免同时写入的 key 同时过期
+func (c *Cache) ttl() time.Duration {
+	max := int64(float64(c.opts.ttl) * c.opts.jitter)
+	if max <= 0 {
+		return c.opts.ttl
+	}
+	return c.opts.ttl + time.Duration(rand.Int63n(max))
+}
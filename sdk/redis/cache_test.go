@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheFetch(t *testing.T) {
+	ctx := context.Background()
+	client, s := newTestClient(t)
+	cache := NewCache(client, WithCacheTTL(time.Minute), WithJitter(0.5))
+
+	var loads int32
+	load := func(ctx context.Context) (user, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(50 * time.Millisecond)
+		return user{ID: 1, Name: "pibigstar"}, nil
+	}
+
+	// 并发未命中只回源一次
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := Fetch(ctx, cache, "user:1", load)
+			if err != nil || u.Name != "pibigstar" {
+				t.Errorf("fetched %+v, %v", u, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loads != 1 {
+		t.Fatalf("loaded %d times", loads)
+	}
+	if ttl := s.TTL("user:1"); ttl < time.Minute || ttl >= 90*time.Second {
+		t.Errorf("ttl %v out of jitter range", ttl)
+	}
+
+	if _, err := Fetch(ctx, cache, "user:1", load); err != nil || loads != 1 {
+		t.Errorf("cache hit loaded %d times, %v", loads, err)
+	}
+	if err := cache.Delete(ctx, "user:1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Fetch(ctx, cache, "user:1", load); err != nil || loads != 2 {
+		t.Errorf("loaded %d times after delete, %v", loads, err)
+	}
+}
+
+func TestCacheLoadError(t *testing.T) {
+	ctx := context.Background()
+	client, s := newTestClient(t)
+	cache := NewCache(client)
+
+	notFound := errors.New("user not found")
+	_, err := Fetch(ctx, cache, "user:2", func(ctx context.Context) (*user, error) {
+		return nil, notFound
+	})
+	if err != notFound || s.Exists("user:2") {
+		t.Fatalf("load error %v, cached %v", err, s.Exists("user:2"))
+	}
+
+	if err = cache.Set(ctx, "user:2", user{ID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	u, err := Fetch(ctx, cache, "user:2", func(ctx context.Context) (*user, error) {
+		t.Error("should not load a cached key")
+		return nil, nil
+	})
+	if err != nil || u.ID != 2 {
+		t.Errorf("fetched %+v, %v", u, err)
+	}
+
+	// 等待回源的调用方 ctx 结束时直接返回
+	block := make(chan struct{})
+	defer close(block)
+	go Fetch(ctx, cache, "slow", func(ctx context.Context) (int, error) {
+		<-block
+		return 1, nil
+	})
+	time.Sleep(20 * time.Millisecond)
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err = Fetch(timeout, cache, "slow", func(ctx context.Context) (int, error) { return 2, nil }); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+}
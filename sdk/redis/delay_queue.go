@@ -0,0 +1,337 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+
+	"go-demo/utils/retry"
+)
+
+var ErrStaleTask = errors.New("redis: task was delivered again after the visibility timeout")
+
+var (
+	// 任务 ID 已存在时不重复添加
+	pushScript = redis.NewScript(`
+if redis.call("HSETNX", KEYS[2], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+return 1`)
+
+	// 取出到期的任务，分数改为可见超时的时间，超时没有确认的任务会再次被取出
+	popScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+local res = {}
+for _, id in ipairs(ids) do
+	redis.call("ZADD", KEYS[1], ARGV[2], id)
+	local n = redis.call("HINCRBY", KEYS[3], id, 1)
+	table.insert(res, id)
+	table.insert(res, redis.call("HGET", KEYS[2], id) or "")
+	table.insert(res, n)
+end
+return res`)
+
+	// 投递次数一致才确认，可见超时后被别人取走的任务不能再确认
+	ackScript = redis.NewScript(`
+if redis.call("HGET", KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+redis.call("HDEL", KEYS[2], ARGV[1])
+redis.call("HDEL", KEYS[3], ARGV[1])
+return 1`)
+
+	retryScript = redis.NewScript(`
+if redis.call("HGET", KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+return 1`)
+
+	// 移到死信集合，保留内容和投递次数
+	buryScript = redis.NewScript(`
+if redis.call("HGET", KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+redis.call("ZADD", KEYS[4], ARGV[3], ARGV[1])
+return 1`)
+
+	requeueScript = redis.NewScript(`
+local n = 0
+for i = 2, #ARGV do
+	if redis.call("ZREM", KEYS[4], ARGV[i]) == 1 then
+		redis.call("ZADD", KEYS[1], ARGV[1], ARGV[i])
+		redis.call("HDEL", KEYS[3], ARGV[i])
+		n = n + 1
+	end
+end
+return n`)
+)
+
+// Task 延迟队列中的任务，Attempts 为包括本次在内的投递次数
+type Task struct {
+	ID       string
+	Payload  []byte
+	Attempts int
+}
+
+// TaskHandler 处理任务，返回错误时退避重试，超过最大次数后进入死信集合
+type TaskHandler func(ctx context.Context, t *Task) error
+
+// DelayQueue 基于有序集合的延迟队列，分数为任务可以被取出的时间。
+// 取出的任务在可见超时内没有确认会再次被取出，至少处理一次，Handler 需要幂等
+type DelayQueue struct {
+	client *RedisClient
+	name   string
+	opts   *consumeOptions
+	// 队列、内容、投递次数、死信，使用相同的 hash tag，可以在集群中执行脚本
+	keys []string
+}
+
+func NewDelayQueue(client *RedisClient, name string, opts ...ConsumeOption) *DelayQueue {
+	prefix := "{" + name + "}:"
+	return &DelayQueue{
+		client: client,
+		name:   name,
+		opts:   evaluateConsumeOptions(opts),
+		keys:   []string{prefix + "queue", prefix + "payload", prefix + "attempts", prefix + "dead"},
+	}
+}
+
+// Push 添加任务，delay 后可以被取出。id 为空时自动生成，id 已存在时忽略，返回任务 ID
+func (q *DelayQueue) Push(ctx context.Context, id string, payload []byte, delay time.Duration) (string, error) {
+	return q.PushAt(ctx, id, payload, time.Now().Add(delay))
+}
+
+// PushAt 添加在 at 之后可以被取出的任务
+func (q *DelayQueue) PushAt(ctx context.Context, id string, payload []byte, at time.Time) (string, error) {
+	client, err := q.client.with(ctx)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		id = uuid.New().String()
+	}
+	return id, pushScript.Run(client, q.keys, id, payload, millis(at)).Err()
+}
+
+// Pop 取出最多 n 个到期的任务，处理完成后需要调用 Ack，否则可见超时后会再次被取出
+func (q *DelayQueue) Pop(ctx context.Context, n int) ([]*Task, error) {
+	client, err := q.client.with(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res, err := popScript.Run(client, q.keys, millis(now), millis(now.Add(q.opts.visibilityTimeout)), n).Result()
+	if err != nil {
+		return nil, err
+	}
+	items, _ := res.([]interface{})
+	tasks := make([]*Task, 0, len(items)/3)
+	for i := 0; i+2 < len(items); i += 3 {
+		id, _ := items[i].(string)
+		payload, _ := items[i+1].(string)
+		attempts, _ := items[i+2].(int64)
+		tasks = append(tasks, &Task{ID: id, Payload: []byte(payload), Attempts: int(attempts)})
+	}
+	return tasks, nil
+}
+
+// Ack 确认任务完成并删除，任务已经被再次取出时返回 ErrStaleTask
+func (q *DelayQueue) Ack(ctx context.Context, t *Task) error {
+	return q.run(ctx, ackScript, t)
+}
+
+// Retry 任务在 delay 后重新可以被取出
+func (q *DelayQueue) Retry(ctx context.Context, t *Task, delay time.Duration) error {
+	return q.run(ctx, retryScript, t, millis(time.Now().Add(delay)))
+}
+
+// Bury 把任务移到死信集合，不再被取出
+func (q *DelayQueue) Bury(ctx context.Context, t *Task) error {
+	return q.run(ctx, buryScript, t, millis(time.Now()))
+}
+
+func (q *DelayQueue) run(ctx context.Context, script *redis.Script, t *Task, args ...interface{}) error {
+	client, err := q.client.with(ctx)
+	if err != nil {
+		return err
+	}
+	args = append([]interface{}{t.ID, strconv.Itoa(t.Attempts)}, args...)
+	n, err := script.Run(client, q.keys, args...).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStaleTask
+	}
+	return nil
+}
+
+// Dead 死信集合中的任务，按进入时间排序
+func (q *DelayQueue) Dead(ctx context.Context) ([]*Task, error) {
+	client, err := q.client.with(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := client.ZRange(q.keys[3], 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	payloads, err := client.HMGet(q.keys[1], ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := client.HMGet(q.keys[2], ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*Task, len(ids))
+	for i, id := range ids {
+		payload, _ := payloads[i].(string)
+		n, _ := attempts[i].(string)
+		t := &Task{ID: id, Payload: []byte(payload)}
+		t.Attempts, _ = strconv.Atoi(n)
+		tasks[i] = t
+	}
+	return tasks, nil
+}
+
+// Requeue 把死信任务放回队列立即可以被取出，投递次数清零，返回放回的数量
+func (q *DelayQueue) Requeue(ctx context.Context, ids ...string) (int, error) {
+	client, err := q.client.with(ctx)
+	if err != nil {
+		return 0, err
+	}
+	args := []interface{}{millis(time.Now())}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	n, err := requeueScript.Run(client, q.keys, args...).Int64()
+	return int(n), err
+}
+
+// Len 队列中的任务数，包括正在处理的任务，不包括死信
+func (q *DelayQueue) Len(ctx context.Context) (int64, error) {
+	client, err := q.client.with(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return client.ZCard(q.keys[0]).Result()
+}
+
+// Run 取出任务交给 h 处理，最多同时处理 WithConcurrency 个。
+// ctx 结束后不再取新任务，等待正在处理的任务完成，超过 WithShutdownTimeout 后取消它们的 context
+func (q *DelayQueue) Run(ctx context.Context, h TaskHandler) error {
+	hctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	defer waitShutdown(&wg, cancel, q.opts.shutdownTimeout)
+
+	slots := make(chan struct{}, q.opts.concurrency)
+	for {
+		// 至少有一个空闲的 worker 才取任务，避免取出的任务在本地等待时可见超时
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case slots <- struct{}{}:
+		}
+		n := 1
+	acquire:
+		for n < q.opts.batchSize {
+			select {
+			case slots <- struct{}{}:
+				n++
+			default:
+				break acquire
+			}
+		}
+
+		tasks, err := q.Pop(ctx, n)
+		if err != nil && ctx.Err() == nil {
+			q.opts.errorHandler(err)
+		}
+		for i := len(tasks); i < n; i++ {
+			<-slots
+		}
+		for _, t := range tasks {
+			wg.Add(1)
+			go func(t *Task) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				q.handle(hctx, h, t)
+			}(t)
+		}
+		if len(tasks) == 0 {
+			timer := time.NewTimer(q.opts.pollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+func (q *DelayQueue) handle(ctx context.Context, h TaskHandler, t *Task) {
+	err := safeCall(func() error { return h(ctx, t) })
+	// 关闭时 ctx 可能已经取消，确认和重试使用独立的 context
+	bg := context.Background()
+	if err == nil {
+		if err = q.Ack(bg, t); err != nil {
+			q.opts.errorHandler(fmt.Errorf("redis: ack task %s: %w", t.ID, err))
+		}
+		return
+	}
+	q.opts.errorHandler(fmt.Errorf("redis: task %s attempt %d: %w", t.ID, t.Attempts, err))
+	if q.opts.maxAttempts > 0 && t.Attempts >= q.opts.maxAttempts {
+		err = q.Bury(bg, t)
+	} else {
+		err = q.Retry(bg, t, retry.Backoff(q.opts.backoff, q.opts.maxBackoff, t.Attempts))
+	}
+	if err != nil {
+		q.opts.errorHandler(fmt.Errorf("redis: retry task %s: %w", t.ID, err))
+	}
+}
+
+// safeCall Handler panic 时转为错误
+func safeCall(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("redis: handler panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// waitShutdown 等待正在处理的任务完成，超时后取消它们的 context 再继续等待
+func waitShutdown(wg *sync.WaitGroup, cancel context.CancelFunc, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		cancel()
+		<-done
+	}
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,172 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newTestClient(t)
+	q := NewDelayQueue(client, "test", WithVisibilityTimeout(100*time.Millisecond))
+
+	id, err := q.Push(ctx, "", []byte("later"), time.Hour)
+	if err != nil || id == "" {
+		t.Fatalf("Push %q, %v", id, err)
+	}
+	if _, err = q.Push(ctx, "now", []byte("now"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// 相同 ID 不重复添加
+	if _, err = q.Push(ctx, "now", []byte("again"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := q.Len(ctx); n != 2 {
+		t.Errorf("Len %d", n)
+	}
+
+	tasks, err := q.Pop(ctx, 10)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("Pop %v, %v", tasks, err)
+	}
+	task := tasks[0]
+	if task.ID != "now" || string(task.Payload) != "now" || task.Attempts != 1 {
+		t.Errorf("task %+v", task)
+	}
+	// 可见超时内不会再次取出
+	if tasks, _ = q.Pop(ctx, 10); len(tasks) != 0 {
+		t.Errorf("popped again %v", tasks)
+	}
+
+	// 可见超时后再次取出，之前的投递不能再确认
+	time.Sleep(150 * time.Millisecond)
+	tasks, err = q.Pop(ctx, 10)
+	if err != nil || len(tasks) != 1 || tasks[0].Attempts != 2 {
+		t.Fatalf("Pop after timeout %v, %v", tasks, err)
+	}
+	if err = q.Ack(ctx, task); err != ErrStaleTask {
+		t.Errorf("expected ErrStaleTask, got %v", err)
+	}
+	if err = q.Ack(ctx, tasks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := q.Len(ctx); n != 1 {
+		t.Errorf("Len after ack %d", n)
+	}
+}
+
+func TestDelayQueueRun(t *testing.T) {
+	client, _ := newTestClient(t)
+	var (
+		mu   sync.Mutex
+		done []string
+	)
+	q := NewDelayQueue(client, "run",
+		WithPollInterval(10*time.Millisecond),
+		WithBackoff(10*time.Millisecond, 20*time.Millisecond),
+		WithMaxAttempts(3),
+		WithConcurrency(4),
+	)
+	ctx := context.Background()
+	if _, err := q.Push(ctx, "ok", []byte("ok"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Push(ctx, "flaky", []byte("flaky"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Push(ctx, "bad", []byte("bad"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- q.Run(runCtx, func(ctx context.Context, task *Task) error {
+			switch {
+			case task.ID == "bad":
+				panic("bad task")
+			case task.ID == "flaky" && task.Attempts < 2:
+				return errors.New("try again")
+			}
+			mu.Lock()
+			done = append(done, task.ID)
+			mu.Unlock()
+			return nil
+		})
+	}()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		n, _ := q.Len(ctx)
+		dead, _ := q.Dead(ctx)
+		if n == 0 && len(dead) == 1 {
+			if dead[0].ID != "bad" || dead[0].Attempts != 3 || string(dead[0].Payload) != "bad" {
+				t.Errorf("dead %+v", dead[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout, len %d, dead %v", n, dead)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+	mu.Lock()
+	if len(done) != 2 {
+		t.Errorf("done %v", done)
+	}
+	mu.Unlock()
+
+	// 死信放回队列后投递次数清零
+	if n, err := q.Requeue(ctx, "bad", "missing"); err != nil || n != 1 {
+		t.Fatalf("Requeue %d, %v", n, err)
+	}
+	tasks, err := q.Pop(ctx, 10)
+	if err != nil || len(tasks) != 1 || tasks[0].ID != "bad" || tasks[0].Attempts != 1 {
+		t.Errorf("Pop requeued %v, %v", tasks, err)
+	}
+}
+
+func TestDelayQueueShutdown(t *testing.T) {
+	client, _ := newTestClient(t)
+	q := NewDelayQueue(client, "shutdown",
+		WithPollInterval(10*time.Millisecond),
+		WithShutdownTimeout(50*time.Millisecond),
+	)
+	ctx := context.Background()
+	if _, err := q.Push(ctx, "slow", nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	started := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- q.Run(runCtx, func(ctx context.Context, task *Task) error {
+			close(started)
+			// 超过关闭超时后 ctx 被取消
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-started
+	cancel()
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Errorf("Run returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the shutdown timeout")
+	}
+	// 被取消的任务退避后重试，不会丢失
+	if n, _ := q.Len(ctx); n != 1 {
+		t.Errorf("Len %d", n)
+	}
+}
@@ -0,0 +1,258 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	ErrNotObtained = errors.New("redis: lock not obtained")
+	ErrLockLost    = errors.New("redis: lock lost")
+)
+
+var (
+	// 值为 token 时才续期
+	extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// 值为 token 时才删除
+	unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Locker Redlock 分布式锁，clients 为相互独立的 redis 实例，
+// 超过半数实例加锁成功且剩余有效期大于 0 才算成功。只有一个实例时退化为单实例锁
+type Locker struct {
+	clients []redis.Cmdable
+	quorum  int
+}
+
+func NewLocker(clients ...redis.Cmdable) *Locker {
+	return &Locker{clients: clients, quorum: len(clients)/2 + 1}
+}
+
+// TryLock 尝试加锁一次，锁被占用时返回 ErrNotObtained
+func (l *Locker) TryLock(ctx context.Context, key string, opts ...LockOption) (*Lock, error) {
+	return l.try(ctx, key, evaluateLockOptions(opts))
+}
+
+// Lock 加锁，锁被占用时随机间隔后重试，直到成功或 ctx 结束
+func (l *Locker) Lock(ctx context.Context, key string, opts ...LockOption) (*Lock, error) {
+	o := evaluateLockOptions(opts)
+	for {
+		lock, err := l.try(ctx, key, o)
+		if err != ErrNotObtained {
+			return lock, err
+		}
+		// 随机等待，避免多个客户端同时重试再次平票
+		delay := o.retryDelay/2 + time.Duration(mrand.Int63n(int64(o.retryDelay)+1))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *Locker) try(ctx context.Context, key string, o *lockOptions) (*Lock, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	n, failed := 0, 0
+	var lastErr error
+	for _, c := range l.clients {
+		ok, err := c.SetNX(key, token, o.ttl).Result()
+		if err != nil {
+			failed++
+			lastErr = err
+		} else if ok {
+			n++
+		}
+	}
+	// 扣除加锁耗时和时钟漂移后的有效期
+	validity := o.ttl - time.Since(start) - drift(o.ttl)
+	if n < l.quorum || validity <= 0 {
+		l.release(key, token)
+		// 出错的实例太多，不可能达到多数
+		if failed > len(l.clients)-l.quorum {
+			return nil, lastErr
+		}
+		return nil, ErrNotObtained
+	}
+
+	lock := &Lock{
+		locker: l,
+		key:    key,
+		token:  token,
+		ttl:    o.ttl,
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if o.autoRenew {
+		go lock.renew(o.renewInterval)
+	} else {
+		close(lock.done)
+	}
+	return lock, nil
+}
+
+// extend 在多数实例上续期，token 不匹配说明锁已经被别人持有，返回 false 和 nil
+func (l *Locker) extend(key, token string, ttl time.Duration) (bool, error) {
+	n, failed := 0, 0
+	var lastErr error
+	for _, c := range l.clients {
+		res, err := extendScript.Run(c, []string{key}, token, ttl.Milliseconds()).Int64()
+		if err != nil {
+			failed++
+			lastErr = err
+		} else if res == 1 {
+			n++
+		}
+	}
+	if n >= l.quorum {
+		return true, nil
+	}
+	if failed > len(l.clients)-l.quorum {
+		return false, lastErr
+	}
+	return false, nil
+}
+
+// release 在所有实例上删除锁，返回删除成功的实例数
+func (l *Locker) release(key, token string) (int, error) {
+	n := 0
+	var lastErr error
+	for _, c := range l.clients {
+		res, err := unlockScript.Run(c, []string{key}, token).Int64()
+		if err != nil {
+			lastErr = err
+		} else if res == 1 {
+			n++
+		}
+	}
+	return n, lastErr
+}
+
+// Lock 持有的锁
+type Lock struct {
+	locker *Locker
+	key    string
+	token  string
+	ttl    time.Duration
+
+	lostOnce sync.Once
+	lost     chan struct{}
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token 锁的随机值，可以作为 fencing token 写入受保护的资源
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Lost 自动续期失败、锁已经不再持有时关闭，业务应当停止操作受保护的资源
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Refresh 手动续期，锁已经丢失时返回 ErrLockLost
+func (l *Lock) Refresh(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ok, err := l.locker.extend(l.key, l.token, l.ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		l.markLost()
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Unlock 停止自动续期并释放锁，锁已经过期或被别人持有时返回 ErrLockLost
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	n, err := l.locker.release(l.key, l.token)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// renew 定时续期，网络错误时继续重试，距离上次成功续期超过 ttl 或锁被别人持有时标记丢失
+func (l *Lock) renew(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		ok, err := l.locker.extend(l.key, l.token, l.ttl)
+		if ok {
+			last = time.Now()
+			continue
+		}
+		if err == nil || time.Since(last) >= l.ttl {
+			l.markLost()
+			return
+		}
+	}
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() { close(l.lost) })
+}
+
+func drift(ttl time.Duration) time.Duration {
+	return ttl/100 + 2*time.Millisecond
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func newInstances(t *testing.T, n int) ([]*miniredis.Miniredis, []redis.Cmdable) {
+	t.Helper()
+	servers := make([]*miniredis.Miniredis, n)
+	clients := make([]redis.Cmdable, n)
+	for i := range servers {
+		s, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(s.Close)
+		client := redis.NewClient(&redis.Options{Addr: s.Addr(), DialTimeout: 100 * time.Millisecond})
+		t.Cleanup(func() { client.Close() })
+		servers[i], clients[i] = s, client
+	}
+	return servers, clients
+}
+
+func TestLockQuorum(t *testing.T) {
+	ctx := context.Background()
+	servers, clients := newInstances(t, 3)
+	locker := NewLocker(clients...)
+
+	lock, err := locker.TryLock(ctx, "order:1", WithAutoRenew(false, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range servers {
+		if v, _ := s.Get("order:1"); v != lock.Token() {
+			t.Fatalf("lock not set on %s", s.Addr())
+		}
+	}
+	if _, err = locker.TryLock(ctx, "order:1"); err != ErrNotObtained {
+		t.Fatalf("expected ErrNotObtained, got %v", err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err = locker.Lock(timeout, "order:1", WithRetryDelay(20*time.Millisecond)); err != context.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	// 其他客户端在等待时拿到释放的锁
+	acquired := make(chan *Lock, 1)
+	go func() {
+		l, err := locker.Lock(ctx, "order:1", WithRetryDelay(20*time.Millisecond), WithAutoRenew(false, 0))
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- l
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err = lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case l := <-acquired:
+		l.Unlock(ctx)
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiting Lock not acquired")
+	}
+
+	// 只有少数实例持有锁时加锁失败，并且回滚已经加上的锁
+	servers[0].Set("order:2", "other")
+	servers[1].Set("order:2", "other")
+	if _, err = locker.TryLock(ctx, "order:2"); err != ErrNotObtained {
+		t.Fatalf("expected ErrNotObtained, got %v", err)
+	}
+	if servers[2].Exists("order:2") {
+		t.Error("minority lock not released")
+	}
+
+	// 一个实例宕机时仍然可以加锁，多数宕机时返回错误
+	servers[0].Close()
+	lock, err = locker.TryLock(ctx, "order:3", WithAutoRenew(false, 0))
+	if err != nil {
+		t.Fatalf("lock with one instance down: %v", err)
+	}
+	servers[1].Close()
+	if _, err = locker.TryLock(ctx, "order:4"); err == nil || err == ErrNotObtained {
+		t.Errorf("expected connection error, got %v", err)
+	}
+}
+
+func TestLockRenew(t *testing.T) {
+	ctx := context.Background()
+	servers, clients := newInstances(t, 1)
+	s := servers[0]
+	locker := NewLocker(clients...)
+
+	lock, err := locker.TryLock(ctx, "job", WithLockTTL(300*time.Millisecond), WithAutoRenew(true, 30*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// miniredis 的时间不会自动流逝，快进后等待续期把 TTL 恢复
+	s.FastForward(250 * time.Millisecond)
+	for i := 0; s.TTL("job") <= 100*time.Millisecond; i++ {
+		if i == 100 {
+			t.Fatalf("lock not renewed, ttl %v", s.TTL("job"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = lock.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 锁被别人持有后续期失败，Lost 关闭
+	s.Set("job", "other")
+	select {
+	case <-lock.Lost():
+	case <-time.After(2 * time.Second):
+		t.Fatal("lost lock not reported")
+	}
+	if err = lock.Refresh(ctx); err != ErrLockLost {
+		t.Errorf("expected ErrLockLost from Refresh, got %v", err)
+	}
+	if err = lock.Unlock(ctx); err != ErrLockLost {
+		t.Errorf("expected ErrLockLost from Unlock, got %v", err)
+	}
+	if v, _ := s.Get("job"); v != "other" {
+		t.Error("unlock removed a lock held by others")
+	}
+}
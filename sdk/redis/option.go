@@ -0,0 +1,266 @@
+package redis
+
+import "time"
+
+type (
+	Option  func(*options)
+	options struct {
+		addr         string
+		password     string
+		db           int
+		poolSize     int
+		dialTimeout  time.Duration
+		readTimeout  time.Duration
+		writeTimeout time.Duration
+		codec        Codec
+	}
+
+	LockOption  func(*lockOptions)
+	lockOptions struct {
+		ttl           time.Duration
+		retryDelay    time.Duration
+		autoRenew     bool
+		renewInterval time.Duration
+	}
+
+	CacheOption  func(*cacheOptions)
+	cacheOptions struct {
+		ttl    time.Duration
+		jitter float64
+	}
+
+	ConsumeOption  func(*consumeOptions)
+	consumeOptions struct {
+		visibilityTimeout time.Duration
+		pollInterval      time.Duration
+		batchSize         int
+		concurrency       int
+		maxAttempts       int
+		backoff           time.Duration
+		maxBackoff        time.Duration
+		shutdownTimeout   time.Duration
+		deadLetter        string
+		errorHandler      func(error)
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		addr:         "127.0.0.1:6379",
+		poolSize:     10,
+		dialTimeout:  5 * time.Second,
+		readTimeout:  3 * time.Second,
+		writeTimeout: 3 * time.Second,
+		codec:        JSON,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+func evaluateLockOptions(opts []LockOption) *lockOptions {
+	optCopy := &lockOptions{
+		ttl:        10 * time.Second,
+		retryDelay: 100 * time.Millisecond,
+		autoRenew:  true,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.renewInterval <= 0 || optCopy.renewInterval >= optCopy.ttl {
+		optCopy.renewInterval = optCopy.ttl / 3
+	}
+
+	return optCopy
+}
+
+func evaluateCacheOptions(opts []CacheOption) *cacheOptions {
+	optCopy := &cacheOptions{
+		ttl:    10 * time.Minute,
+		jitter: 0.1,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+func evaluateConsumeOptions(opts []ConsumeOption) *consumeOptions {
+	optCopy := &consumeOptions{
+		visibilityTimeout: 30 * time.Second,
+		pollInterval:      time.Second,
+		batchSize:         10,
+		concurrency:       1,
+		maxAttempts:       5,
+		backoff:           time.Second,
+		maxBackoff:        time.Minute,
+		shutdownTimeout:   30 * time.Second,
+		errorHandler:      func(error) {},
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.batchSize < 1 {
+		optCopy.batchSize = 1
+	}
+	if optCopy.concurrency < 1 {
+		optCopy.concurrency = 1
+	}
+
+	return optCopy
+}
+
+// WithAddr sets the redis address, default 127.0.0.1:6379.
+func WithAddr(addr string) Option {
+	return func(opts *options) {
+		opts.addr = addr
+	}
+}
+
+// WithPassword sets the redis password.
+func WithPassword(password string) Option {
+	return func(opts *options) {
+		opts.password = password
+	}
+}
+
+// WithDB sets the database index, default 0.
+func WithDB(db int) Option {
+	return func(opts *options) {
+		opts.db = db
+	}
+}
+
+// WithPoolSize sets the max number of connections, default 10.
+func WithPoolSize(size int) Option {
+	return func(opts *options) {
+		opts.poolSize = size
+	}
+}
+
+// WithTimeout sets the dial, read and write timeout, default 5s, 3s and 3s.
+func WithTimeout(dial, read, write time.Duration) Option {
+	return func(opts *options) {
+		opts.dialTimeout = dial
+		opts.readTimeout = read
+		opts.writeTimeout = write
+	}
+}
+
+// WithCodec sets the codec used by the typed get/set and the cache, default JSON.
+func WithCodec(codec Codec) Option {
+	return func(opts *options) {
+		opts.codec = codec
+	}
+}
+
+// WithLockTTL sets how long the lock is held without renewal, default 10s.
+func WithLockTTL(ttl time.Duration) LockOption {
+	return func(opts *lockOptions) {
+		opts.ttl = ttl
+	}
+}
+
+// WithRetryDelay sets the average delay between attempts of Locker.Lock, default 100ms.
+func WithRetryDelay(delay time.Duration) LockOption {
+	return func(opts *lockOptions) {
+		opts.retryDelay = delay
+	}
+}
+
+// WithAutoRenew sets whether the lock is extended in the background until Unlock,
+// and how often, default true and every ttl/3.
+func WithAutoRenew(renew bool, interval time.Duration) LockOption {
+	return func(opts *lockOptions) {
+		opts.autoRenew = renew
+		opts.renewInterval = interval
+	}
+}
+
+// WithCacheTTL sets the ttl of cached values, default 10m.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.ttl = ttl
+	}
+}
+
+// WithJitter adds a random [0, fraction*ttl) to every ttl so keys written together
+// do not expire together, default 0.1.
+func WithJitter(fraction float64) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.jitter = fraction
+	}
+}
+
+// WithVisibilityTimeout sets how long a received task or stream message stays invisible to other
+// consumers before it is delivered again, default 30s.
+func WithVisibilityTimeout(d time.Duration) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.visibilityTimeout = d
+	}
+}
+
+// WithPollInterval sets how long to wait when nothing is ready, default 1s.
+// Stream consumers block on XREADGROUP for this long.
+func WithPollInterval(d time.Duration) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.pollInterval = d
+	}
+}
+
+// WithBatchSize sets the max number of tasks or messages read at once, default 10.
+func WithBatchSize(n int) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.batchSize = n
+	}
+}
+
+// WithConcurrency sets how many delayed tasks are handled in parallel, default 1.
+// Stream messages are always handled in order by one goroutine per consumer.
+func WithConcurrency(n int) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.concurrency = n
+	}
+}
+
+// WithMaxAttempts sets how many times a task or message is delivered before it is dead-lettered, default 5.
+// 0 retries forever.
+func WithMaxAttempts(n int) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the first and the max delay before a failed delayed task is retried,
+// the delay doubles after every attempt, default 1s and 1m.
+func WithBackoff(backoff, max time.Duration) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.backoff = backoff
+		opts.maxBackoff = max
+	}
+}
+
+// WithShutdownTimeout sets how long Run waits for running handlers after ctx is done,
+// their context is canceled after it, default 30s.
+func WithShutdownTimeout(d time.Duration) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.shutdownTimeout = d
+	}
+}
+
+// WithDeadLetter sets the dead-letter stream of a stream consumer, default "{stream}:dead".
+func WithDeadLetter(stream string) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.deadLetter = stream
+	}
+}
+
+// WithErrorHandler sets the function receiving handler and redis errors of Run.
+func WithErrorHandler(fn func(error)) ConsumeOption {
+	return func(opts *consumeOptions) {
+		opts.errorHandler = fn
+	}
+}
@@ -1,33 +1,45 @@
+/**
+ * Redis 工具集
+ *   1. NewRedisClient 通过 Option 配置地址、密码、DB、连接池和超时
+ *   2. GetValue/SetValue/Get 按 Codec 编解码读写，SetValues/MGet 通过 pipeline 批量读写
+ *   3. Locker 实现 Redlock，多数实例加锁成功才算成功，持有期间自动续期，见 lock.go
+ *   4. Cache 实现 cache-aside，TTL 带随机抖动，并发未命中时只回源一次，见 cache.go
+ *   5. DelayQueue 基于有序集合的延迟队列，带可见超时、退避重试和死信集合，见 delay_queue.go
+ *   6. StreamConsumer 封装 Streams 消费组，认领超时未确认的消息，超过投递次数转入死信流，见 stream.go
+ */
 package redis
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github.com/go-redis/redis"
+	"sync"
 	"time"
+
+	"github.com/go-redis/redis"
 )
 
-var Redis *RedisClient
+var ErrNotFound = errors.New("redis: key not found")
 
 // RedisClient extend client and have itself func
 type RedisClient struct {
 	*redis.Client
+	opts *options
 }
 
-// Init the redis client
-func NewRedisClient() error {
-	if Redis != nil {
-		return nil
-	}
+// NewRedisClient 创建客户端并 Ping 一次，连接失败时返回错误
+func NewRedisClient(opts ...Option) (*RedisClient, error) {
+	o := evaluateOptions(opts)
 	client := redis.NewClient(&redis.Options{
-		Addr:     "127.0.0.1:6379",
-		Password: "",
-		DB:       1,
-		PoolSize: 10, //连接池大小
+		Addr:     o.addr,
+		Password: o.password,
+		DB:       o.db,
+		PoolSize: o.poolSize, //连接池大小
 		//超时
-		DialTimeout:  5 * time.Second, //连接建立超时时间，默认5秒。
-		ReadTimeout:  3 * time.Second, //读超时，默认3秒， -1表示取消读超时
-		WriteTimeout: 3 * time.Second, //写超时，默认等于读超时
-		PoolTimeout:  4 * time.Second, //当所有连接都处在繁忙状态时，客户端等待可用连接的最大等待时长，默认为读超时+1秒。
+		DialTimeout:  o.dialTimeout,               //连接建立超时时间，默认5秒。
+		ReadTimeout:  o.readTimeout,               //读超时，默认3秒， -1表示取消读超时
+		WriteTimeout: o.writeTimeout,              //写超时，默认等于读超时
+		PoolTimeout:  o.readTimeout + time.Second, //当所有连接都处在繁忙状态时，客户端等待可用连接的最大等待时长，默认为读超时+1秒。
 
 		//闲置连接检查包括IdleTimeout，MaxConnAge
 		IdleCheckFrequency: 60 * time.Second, //闲置连接检查的周期，默认为1分钟，-1表示不做周期性检查，只在客户端获取连接时对闲置连接进行处理。
@@ -38,54 +50,146 @@ func NewRedisClient() error {
 		MaxRetries:      0,                      //命令执行失败时，最多重试多少次，默认为0即不重试
 		MinRetryBackoff: 8 * time.Millisecond,   //每次计算重试间隔时间的下限，默认8毫秒，-1表示取消间隔
 		MaxRetryBackoff: 512 * time.Millisecond, //每次计算重试间隔时间的上限，默认512毫秒，-1表示取消间隔
-
-		//仅当客户端执行命令时需要从连接池获取连接时，如果连接池需要新建连接时则会调用此钩子函数
-		OnConnect: func(conn *redis.Conn) error {
-			fmt.Printf("创建新的连接: %v\n", conn)
-			return nil
-		},
 	})
 
-	_, err := client.Ping().Result()
-	if err != nil {
-		return err
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis: connect %s: %w", o.addr, err)
 	}
-	Redis = &RedisClient{client}
-	return nil
+	return &RedisClient{Client: client, opts: o}, nil
 }
 
-// init the redis  client
-func init() {
-	err := NewRedisClient()
-	if err != nil {
-		fmt.Println("failed to connect redis client")
+var (
+	defaultClient *RedisClient
+	defaultLocker sync.Mutex
+)
+
+// get the redis client，if client not initialization
+// and create the redis client with opts
+func GetRedisClient(opts ...Option) (*RedisClient, error) {
+	defaultLocker.Lock()
+	defer defaultLocker.Unlock()
+	if defaultClient == nil {
+		client, err := NewRedisClient(opts...)
+		if err != nil {
+			return nil, err
+		}
+		defaultClient = client
 	}
+	return defaultClient, nil
 }
 
-// set the string to redis，the expire default is seven days
-func (redis *RedisClient) SSet(key string, value interface{}) *redis.StatusCmd {
-	return redis.Set(key, value, 24*time.Hour)
+// set the string to redis，the expire default is one day
+func (r *RedisClient) SSet(key string, value interface{}) *redis.StatusCmd {
+	return r.Set(key, value, 24*time.Hour)
 }
 
-// get the string value by key
-func (redis *RedisClient) SGet(key string) string {
-	return redis.Get(key).String()
+// get the string value by key, return ErrNotFound if the key does not exist
+func (r *RedisClient) SGet(key string) (string, error) {
+	s, err := r.Get(key).Result()
+	if err == redis.Nil {
+		return "", ErrNotFound
+	}
+	return s, err
 }
 
 // close the redis client
-func (redis *RedisClient) Close() {
-	redis.Close()
+func (r *RedisClient) Close() error {
+	return r.Client.Close()
 }
 
-// get the redis client，if client not initialization
-// and create the redis client
-func GetRedisClient() (*RedisClient, error) {
-	if Redis == nil {
-		err := NewRedisClient()
-		if err != nil {
-			return nil, err
+// Codec 客户端使用的编解码
+func (r *RedisClient) Codec() Codec {
+	return r.opts.codec
+}
+
+// with 绑定 ctx，ctx 已经结束时返回错误
+func (r *RedisClient) with(ctx context.Context) (*redis.Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.Client.WithContext(ctx), nil
+}
+
+// SetValue 用 Codec 编码 v 后写入，ttl 为 0 时不过期
+func (r *RedisClient) SetValue(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	client, err := r.with(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := r.opts.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return client.Set(key, data, ttl).Err()
+}
+
+// GetValue 读取 key 并解码到 v，key 不存在时返回 ErrNotFound
+func (r *RedisClient) GetValue(ctx context.Context, key string, v interface{}) error {
+	client, err := r.with(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := client.Get(key).Bytes()
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return r.opts.codec.Unmarshal(data, v)
+}
+
+// SetValues 通过一个 pipeline 写入多个 key
+func (r *RedisClient) SetValues(ctx context.Context, values map[string]interface{}, ttl time.Duration) error {
+	client, err := r.with(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.Pipelined(func(pipe redis.Pipeliner) error {
+		for key, v := range values {
+			data, err := r.opts.codec.Marshal(v)
+			if err != nil {
+				return err
+			}
+			pipe.Set(key, data, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Get 读取 key 并解码为 T，key 不存在时返回 ErrNotFound
+func Get[T any](ctx context.Context, r *RedisClient, key string) (T, error) {
+	var v T
+	err := r.GetValue(ctx, key, &v)
+	return v, err
+}
+
+// MGet 一次读取多个 key，不存在的 key 不出现在结果中
+func MGet[T any](ctx context.Context, r *RedisClient, keys ...string) (map[string]T, error) {
+	values := make(map[string]T, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+	client, err := r.with(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range res {
+		s, ok := item.(string)
+		if !ok {
+			continue
+		}
+		var v T
+		if err = r.opts.codec.Unmarshal([]byte(s), &v); err != nil {
+			return nil, fmt.Errorf("redis: decode %s: %w", keys[i], err)
 		}
-		return Redis, nil
+		values[keys[i]] = v
 	}
-	return Redis, nil
+	return values, nil
 }
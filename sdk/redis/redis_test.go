@@ -1,13 +1,48 @@
 package redis
 
 import (
-	"github.com/go-redis/redis"
+	"context"
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
 )
 
+func newTestClient(t *testing.T, opts ...Option) (*RedisClient, *miniredis.Miniredis) {
+	t.Helper()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	client, err := NewRedisClient(append([]Option{WithAddr(s.Addr())}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, s
+}
+
 func TestRedis(t *testing.T) {
-	Redis.SSet("test", "pibigstar")
-	t.Log(Redis.SGet("test"))
+	client, s := newTestClient(t)
+	if err := client.SSet("test", "pibigstar").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.SGet("test"); err != nil || v != "pibigstar" {
+		t.Errorf("SGet %q, %v", v, err)
+	}
+	if s.TTL("test") != 24*time.Hour {
+		t.Errorf("ttl %v", s.TTL("test"))
+	}
+	if _, err := client.SGet("missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := NewRedisClient(WithAddr("127.0.0.1:1"), WithTimeout(100*time.Millisecond, time.Second, time.Second)); err == nil {
+		t.Error("expected connect error")
+	}
 }
 
 var lua = `
@@ -28,12 +63,68 @@ return 0
 `
 
 func TestLua(t *testing.T) {
-	client, err := GetRedisClient()
-	if err != nil {
-		t.Error(err)
-	}
+	client, s := newTestClient(t)
 	script := redis.NewScript(lua)
 
-	cmd := script.Run(client, []string{"user", "test"}, 1, 2)
-	t.Log(cmd.Result())
+	n, err := script.Run(client, []string{"user", "test"}, 1, 2).Int64()
+	if err != nil || n != 1 {
+		t.Fatalf("script returned %d, %v", n, err)
+	}
+	if v, _ := s.Get("user"); v != "1" {
+		t.Errorf("user %q", v)
+	}
+}
+
+type user struct {
+	ID   int
+	Name string
+	Tags []string
+}
+
+func TestTypedValue(t *testing.T) {
+	ctx := context.Background()
+	for name, codec := range map[string]Codec{"json": JSON, "gob": Gob} {
+		client, s := newTestClient(t, WithCodec(codec))
+		want := user{ID: 1, Name: "pibigstar", Tags: []string{"admin"}}
+		if err := client.SetValue(ctx, "user:1", want, time.Minute); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if s.TTL("user:1") != time.Minute {
+			t.Errorf("%s: ttl %v", name, s.TTL("user:1"))
+		}
+		got, err := Get[user](ctx, client, "user:1")
+		if err != nil || got.Name != want.Name || len(got.Tags) != 1 {
+			t.Errorf("%s: got %+v, %v", name, got, err)
+		}
+		if _, err = Get[user](ctx, client, "user:2"); err != ErrNotFound {
+			t.Errorf("%s: expected ErrNotFound, got %v", name, err)
+		}
+
+		err = client.SetValues(ctx, map[string]interface{}{
+			"user:2": user{ID: 2, Name: "a"},
+			"user:3": user{ID: 3, Name: "b"},
+		}, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		users, err := MGet[user](ctx, client, "user:1", "user:2", "user:3", "user:4")
+		if err != nil || len(users) != 3 || users["user:3"].Name != "b" {
+			t.Errorf("%s: MGet %+v, %v", name, users, err)
+		}
+	}
+
+	client, _ := newTestClient(t, WithCodec(Raw))
+	client.SetValue(ctx, "raw", "plain", 0)
+	if s, err := Get[string](ctx, client, "raw"); err != nil || s != "plain" {
+		t.Errorf("raw %q, %v", s, err)
+	}
+	if client.SetValue(ctx, "raw", 1, 0) == nil {
+		t.Error("raw codec should reject int")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := client.SetValue(canceled, "raw", "x", 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
 }
@@ -0,0 +1,240 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 进入死信流的消息额外带上原消息 ID 和投递次数
+const (
+	FieldOriginalID = "x-original-id"
+	FieldDeliveries = "x-deliveries"
+)
+
+// StreamMessage 消费组收到的消息，Deliveries 为包括本次在内的投递次数
+type StreamMessage struct {
+	ID         string
+	Values     map[string]interface{}
+	Deliveries int64
+}
+
+// StreamHandler 处理消息，返回 nil 时确认，返回错误时消息保持未确认，可见超时后被重新认领
+type StreamHandler func(ctx context.Context, msg *StreamMessage) error
+
+// AddStream 向 stream 追加消息，maxLen 大于 0 时近似裁剪到 maxLen 条，返回消息 ID
+func (r *RedisClient) AddStream(ctx context.Context, stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	client, err := r.with(ctx)
+	if err != nil {
+		return "", err
+	}
+	return client.XAdd(&redis.XAddArgs{Stream: stream, MaxLenApprox: maxLen, Values: values}).Result()
+}
+
+// StreamConsumer Redis Streams 消费组中的一个消费者。
+// 其他消费者超过可见超时没有确认的消息会被认领后重新处理，投递次数超过 WithMaxAttempts 的消息转入死信流
+type StreamConsumer struct {
+	client   *RedisClient
+	stream   string
+	group    string
+	consumer string
+	opts     *consumeOptions
+}
+
+func NewStreamConsumer(client *RedisClient, stream, group, consumer string, opts ...ConsumeOption) *StreamConsumer {
+	o := evaluateConsumeOptions(opts)
+	if o.deadLetter == "" {
+		o.deadLetter = stream + ":dead"
+	}
+	return &StreamConsumer{client: client, stream: stream, group: group, consumer: consumer, opts: o}
+}
+
+// EnsureGroup 创建消费组，stream 不存在时一起创建，消费组已存在时忽略
+func (c *StreamConsumer) EnsureGroup(ctx context.Context) error {
+	client, err := c.client.with(ctx)
+	if err != nil {
+		return err
+	}
+	err = client.XGroupCreateMkStream(c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// Run 读取消息交给 h 按顺序处理，并定期认领超时未确认的消息。
+// ctx 结束后不再读取新消息，等待当前消息处理完成，超过 WithShutdownTimeout 后取消它的 context。
+// 阻塞读取最多持续 WithPollInterval，关闭最多因此延迟这么久
+func (c *StreamConsumer) Run(ctx context.Context, h StreamHandler) error {
+	if err := c.EnsureGroup(ctx); err != nil {
+		return err
+	}
+	hctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+		}
+		timer := time.NewTimer(c.opts.shutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-stop:
+		case <-timer.C:
+			cancel()
+		}
+	}()
+
+	// 认领间隔取可见超时的一半，不小于轮询间隔
+	claimInterval := c.opts.visibilityTimeout / 2
+	if claimInterval < c.opts.pollInterval {
+		claimInterval = c.opts.pollInterval
+	}
+	var lastClaim time.Time
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if time.Since(lastClaim) >= claimInterval {
+			lastClaim = time.Now()
+			msgs, err := c.claim()
+			if err != nil {
+				c.opts.errorHandler(fmt.Errorf("redis: claim %s: %w", c.stream, err))
+			}
+			if !c.process(ctx, hctx, h, msgs) {
+				return ctx.Err()
+			}
+		}
+
+		msgs, err := c.read()
+		if err != nil {
+			c.opts.errorHandler(fmt.Errorf("redis: read %s: %w", c.stream, err))
+			timer := time.NewTimer(c.opts.pollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+		if !c.process(ctx, hctx, h, msgs) {
+			return ctx.Err()
+		}
+	}
+}
+
+// process 依次处理消息，ctx 结束时停止并返回 false，剩余的消息保持未确认
+func (c *StreamConsumer) process(ctx, hctx context.Context, h StreamHandler, msgs []*StreamMessage) bool {
+	for _, msg := range msgs {
+		if ctx.Err() != nil {
+			return false
+		}
+		c.handle(hctx, h, msg)
+	}
+	return ctx.Err() == nil
+}
+
+func (c *StreamConsumer) handle(ctx context.Context, h StreamHandler, msg *StreamMessage) {
+	if err := safeCall(func() error { return h(ctx, msg) }); err != nil {
+		c.opts.errorHandler(fmt.Errorf("redis: stream %s message %s delivery %d: %w", c.stream, msg.ID, msg.Deliveries, err))
+		return
+	}
+	if err := c.client.XAck(c.stream, c.group, msg.ID).Err(); err != nil {
+		c.opts.errorHandler(fmt.Errorf("redis: ack %s message %s: %w", c.stream, msg.ID, err))
+	}
+}
+
+// read 读取新消息，没有消息时阻塞最多 WithPollInterval
+func (c *StreamConsumer) read() ([]*StreamMessage, error) {
+	res, err := c.client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, ">"},
+		Count:    int64(c.opts.batchSize),
+		Block:    c.opts.pollInterval,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*StreamMessage
+	for _, s := range res {
+		for _, m := range s.Messages {
+			msgs = append(msgs, &StreamMessage{ID: m.ID, Values: m.Values, Deliveries: 1})
+		}
+	}
+	return msgs, nil
+}
+
+// claim 认领空闲超过可见超时的未确认消息，投递次数超过上限的转入死信流，返回需要重新处理的消息
+func (c *StreamConsumer) claim() ([]*StreamMessage, error) {
+	pending, err := c.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Start:  "-",
+		End:    "+",
+		Count:  int64(c.opts.batchSize),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make(map[string]int64, len(pending))
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		if p.Idle >= c.opts.visibilityTimeout {
+			ids = append(ids, p.Id)
+			deliveries[p.Id] = p.RetryCount + 1
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// 同时认领时 MinIdle 保证只有一个消费者成功
+	claimed, err := c.client.XClaim(&redis.XClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.consumer,
+		MinIdle:  c.opts.visibilityTimeout,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*StreamMessage, 0, len(claimed))
+	for _, m := range claimed {
+		msg := &StreamMessage{ID: m.ID, Values: m.Values, Deliveries: deliveries[m.ID]}
+		if c.opts.maxAttempts > 0 && msg.Deliveries > int64(c.opts.maxAttempts) {
+			if err := c.bury(msg); err != nil {
+				c.opts.errorHandler(fmt.Errorf("redis: dead-letter %s message %s: %w", c.stream, msg.ID, err))
+			}
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// bury 把消息写入死信流后确认
+func (c *StreamConsumer) bury(msg *StreamMessage) error {
+	values := make(map[string]interface{}, len(msg.Values)+2)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values[FieldOriginalID] = msg.ID
+	values[FieldDeliveries] = strconv.FormatInt(msg.Deliveries-1, 10)
+	if err := c.client.XAdd(&redis.XAddArgs{Stream: c.opts.deadLetter, Values: values}).Err(); err != nil {
+		return err
+	}
+	return c.client.XAck(c.stream, c.group, msg.ID).Err()
+}
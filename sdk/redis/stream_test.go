@@ -0,0 +1,143 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStreamConsumer(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newTestClient(t)
+	for _, v := range []string{"a", "b", "c"} {
+		if _, err := client.AddStream(ctx, "events", map[string]interface{}{"v": v}, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	c := NewStreamConsumer(client, "events", "group", "c1", WithPollInterval(20*time.Millisecond))
+	runCtx, cancel := context.WithCancel(ctx)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Run(runCtx, func(ctx context.Context, msg *StreamMessage) error {
+			mu.Lock()
+			got = append(got, msg.Values["v"].(string))
+			mu.Unlock()
+			return nil
+		})
+	}()
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 3
+	})
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+	mu.Lock()
+	if got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("got %v", got)
+	}
+	mu.Unlock()
+	pending, err := client.XPending("events", "group").Result()
+	if err != nil || pending.Count != 0 {
+		t.Errorf("pending %+v, %v", pending, err)
+	}
+}
+
+func TestStreamClaim(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newTestClient(t)
+	opts := []ConsumeOption{
+		WithPollInterval(10 * time.Millisecond),
+		WithVisibilityTimeout(50 * time.Millisecond),
+		WithMaxAttempts(3),
+	}
+	id, err := client.AddStream(ctx, "orders", map[string]interface{}{"order": "1"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.AddStream(ctx, "orders", map[string]interface{}{"order": "2"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// c1 读到消息后没有确认就退出
+	c1 := NewStreamConsumer(client, "orders", "group", "c1", opts...)
+	if err = c1.EnsureGroup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, err := c1.read(); err != nil || len(msgs) != 2 {
+		t.Fatalf("read %v, %v", msgs, err)
+	}
+
+	// c2 认领超时的消息，order 1 一直失败，超过最大投递次数后进入死信流
+	var (
+		mu         sync.Mutex
+		deliveries = make(map[string][]int64)
+	)
+	c2 := NewStreamConsumer(client, "orders", "group", "c2", opts...)
+	runCtx, cancel := context.WithCancel(ctx)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c2.Run(runCtx, func(ctx context.Context, msg *StreamMessage) error {
+			order := msg.Values["order"].(string)
+			mu.Lock()
+			deliveries[order] = append(deliveries[order], msg.Deliveries)
+			mu.Unlock()
+			if order == "1" {
+				return errors.New("failed")
+			}
+			return nil
+		})
+	}()
+
+	waitFor(t, func() bool {
+		n, _ := client.XLen("orders:dead").Result()
+		return n == 1
+	})
+	cancel()
+	if err = <-errc; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+
+	mu.Lock()
+	if d := deliveries["1"]; len(d) != 2 || d[0] != 2 || d[1] != 3 {
+		t.Errorf("order 1 deliveries %v", d)
+	}
+	if d := deliveries["2"]; len(d) != 1 || d[0] != 2 {
+		t.Errorf("order 2 deliveries %v", d)
+	}
+	mu.Unlock()
+
+	dead, err := client.XRange("orders:dead", "-", "+").Result()
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("dead %v, %v", dead, err)
+	}
+	v := dead[0].Values
+	if v["order"] != "1" || v[FieldOriginalID] != id || v[FieldDeliveries] != "3" {
+		t.Errorf("dead values %v", v)
+	}
+	pending, err := client.XPending("orders", "group").Result()
+	if err != nil || pending.Count != 0 {
+		t.Errorf("pending %+v, %v", pending, err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -11,15 +11,18 @@ import (
 	"net"
 )
 
-func RunGRPCServe() error {
+// RunGRPCServe interceptors 追加在链路追踪和 recovery 之后，如需限流传入
+// adaptive.UnaryServerInterceptor(adaptive.New(adaptive.NewGradient2()))
+func RunGRPCServe(interceptors ...grpc.UnaryServerInterceptor) error {
 	grpc_prometheus.EnableHandlingTimeHistogram()
 
+	unary := append([]grpc.UnaryServerInterceptor{
+		grpc_ctxtags.UnaryServerInterceptor(),
+		grpc_opentracing.UnaryServerInterceptor(),
+		grpc_recovery.UnaryServerInterceptor(),
+	}, interceptors...)
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-			grpc_ctxtags.UnaryServerInterceptor(),
-			grpc_opentracing.UnaryServerInterceptor(),
-			grpc_recovery.UnaryServerInterceptor(),
-		)),
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unary...)),
 
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
 			grpc_ctxtags.StreamServerInterceptor(),
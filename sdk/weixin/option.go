@@ -0,0 +1,67 @@
+package weixin
+
+import (
+	"net/http"
+	"time"
+)
+
+type (
+	Option  func(*options)
+	options struct {
+		baseURL    string
+		notifyURL  string
+		signType   string
+		clientIP   string
+		httpClient *http.Client
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		baseURL:    BaseURL,
+		notifyURL:  WeixinNotifyURL,
+		signType:   SignTypeMD5,
+		clientIP:   CreateIP,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+// WithBaseURL sets the api address, default BaseURL, use SandboxURL for the sandbox.
+func WithBaseURL(baseURL string) Option {
+	return func(opts *options) {
+		opts.baseURL = baseURL
+	}
+}
+
+// WithNotifyURL sets the default notify url used when the request has none, default WeixinNotifyURL.
+func WithNotifyURL(notifyURL string) Option {
+	return func(opts *options) {
+		opts.notifyURL = notifyURL
+	}
+}
+
+// WithSignType sets the sign type, SignTypeMD5 (default) or SignTypeHMACSHA256.
+func WithSignType(signType string) Option {
+	return func(opts *options) {
+		opts.signType = signType
+	}
+}
+
+// WithClientIP sets the spbill_create_ip used when the request has none, default CreateIP.
+func WithClientIP(ip string) Option {
+	return func(opts *options) {
+		opts.clientIP = ip
+	}
+}
+
+// WithHTTPClient sets the http client, refunds require a client configured with the merchant certificate.
+func WithHTTPClient(client *http.Client) Option {
+	return func(opts *options) {
+		opts.httpClient = client
+	}
+}
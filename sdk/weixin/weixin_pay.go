@@ -1,187 +1,422 @@
 package weixin
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"go-demo/sdk/payment"
 )
 
 const (
-	// 统一下单API接口
-	WeiXinPayUnifedURL = "https://api.mch.weixin.qq.com/pay/unifiedorder"
+	// 接口地址
+	BaseURL = "https://api.mch.weixin.qq.com"
+	// 仿真测试地址
+	SandboxURL = "https://api.mch.weixin.qq.com/sandboxnew"
 	// 通知地址
 	WeixinNotifyURL = "https://pibigstar.com/weixin/pay"
 	// 交易类型
 	TradeTypeJSAPI  = "JSAPI"
 	TradeTypeNATIVE = "NATIVE"
+	TradeTypeAPP    = "APP"
+	TradeTypeMWEB   = "MWEB"
+	// 签名类型
+	SignTypeMD5        = "MD5"
+	SignTypeHMACSHA256 = "HMAC-SHA256"
 	// 商品描述
 	RewardBody = "微信支付Demo"
 	// 终端IP，用户的客户端IP
 	CreateIP = "127.0.0.1"
-	// 微信支付分配的公众账号ID（企业号corpid即为此appId）
-	AppID = "wx8888888888888888"
-	// 商户号
-	MchID = "1230000109"
-	// 商户Key
-	MchKey = "pibigstar"
+
+	// 渠道名
+	Name = "weixin"
 )
 
-type PayRequest struct {
-	TimeStamp string `json:"timeStamp"`
-	NonceStr  string `json:"nonceStr"`
-	Package   string `json:"package"`
-	PaySign   string `json:"paySign"`
-	SignType  string `json:"signType"`
+// 微信支付时间为北京时间
+var cst = time.FixedZone("CST", 8*3600)
+
+// Client 微信支付 v2 接口，实现 payment.PaymentGateway
+type Client struct {
+	appID string
+	mchID string
+	key   string
+	opts  *options
 }
 
-// 微信支付
-func WeiXinPay(amount int32, openId string) (*PayRequest, error) {
-	// 商户server调用统一下单接口请求订单
-	response, err := createUnifyOrder(amount, openId, TradeTypeJSAPI)
+var _ payment.PaymentGateway = (*Client)(nil)
+
+// NewClient appID 为公众账号ID（企业号corpid即为此appId），mchID 为商户号，key 为商户平台设置的 API 密钥
+func NewClient(appID, mchID, key string, opts ...Option) *Client {
+	return &Client{appID: appID, mchID: mchID, key: key, opts: evaluateOptions(opts)}
+}
+
+func (c *Client) Name() string {
+	return Name
+}
+
+// Create 统一下单
+// https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=9_1
+// 同一个商户订单号参数不变时重复下单返回同一个预支付交易，参数变化时返回 payment.ErrDuplicateTrade
+func (c *Client) Create(ctx context.Context, req *payment.CreateRequest) (*payment.CreateResult, error) {
+	var tradeType string
+	switch req.Scene {
+	case payment.SceneJSAPI:
+		tradeType = TradeTypeJSAPI
+	case payment.SceneNative:
+		tradeType = TradeTypeNATIVE
+	case payment.SceneApp:
+		tradeType = TradeTypeAPP
+	case payment.SceneWap:
+		tradeType = TradeTypeMWEB
+	default:
+		return nil, payment.ErrUnsupportedScene
+	}
+	if req.Amount <= 0 {
+		return nil, payment.ErrInvalidAmount
+	}
+	p := params{
+		"body":             firstNonEmpty(req.Subject, RewardBody),
+		"out_trade_no":     req.OutTradeNo,
+		"total_fee":        strconv.FormatInt(req.Amount, 10),
+		"spbill_create_ip": firstNonEmpty(req.ClientIP, c.opts.clientIP),
+		"notify_url":       firstNonEmpty(req.NotifyURL, c.opts.notifyURL),
+		"trade_type":       tradeType,
+		"openid":           req.OpenID,
+		"attach":           req.Passback,
+	}
+	resp, err := c.call(ctx, "/pay/unifiedorder", p)
 	if err != nil {
 		return nil, err
 	}
 
-	timeStamp := fmt.Sprintf("%d", time.Now().Unix())
+	result := &payment.CreateResult{OutTradeNo: req.OutTradeNo}
+	// 预支付交易会话标识，用于后续接口调用中使用，该值有效期为2小时
+	prepayID := resp["prepay_id"]
+	timeStamp := strconv.FormatInt(time.Now().Unix(), 10)
 	nonceStr := genNonceStr(16)
-	// 预支付交易会话标识
-	// 用于后续接口调用中使用，该值有效期为2小时
-	packageStr := "prepay_id=" + response.PrepayID
-
-	// 生成支付签名
-	paySign := buildSign(map[string]string{
-		"appId":     AppID,
-		"timeStamp": timeStamp,
-		"nonceStr":  nonceStr,
-		"package":   packageStr,
-		"signType":  "MD5",
-	})
+	switch tradeType {
+	case TradeTypeNATIVE:
+		// 二维码链接
+		result.PayURL = resp["code_url"]
+	case TradeTypeMWEB:
+		result.PayURL = resp["mweb_url"]
+	case TradeTypeJSAPI:
+		// 使用：https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=7_7&index=6
+		result.Params = map[string]string{
+			"appId":     c.appID,
+			"timeStamp": timeStamp,
+			"nonceStr":  nonceStr,
+			"package":   "prepay_id=" + prepayID,
+			"signType":  c.opts.signType,
+		}
+		result.Params["paySign"] = buildSign(result.Params, c.key, c.opts.signType)
+	case TradeTypeAPP:
+		// https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_12
+		result.Params = map[string]string{
+			"appid":     c.appID,
+			"partnerid": c.mchID,
+			"prepayid":  prepayID,
+			"package":   "Sign=WXPay",
+			"noncestr":  nonceStr,
+			"timestamp": timeStamp,
+		}
+		result.Params["sign"] = buildSign(result.Params, c.key, c.opts.signType)
+	}
+	return result, nil
+}
 
-	// 使用：https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=7_7&index=6
-	return &PayRequest{
-		TimeStamp: timeStamp,
-		NonceStr:  nonceStr,
-		Package:   packageStr,
-		PaySign:   paySign,
-		SignType:  "MD5",
-	}, nil
-}
-
-// 微信扫码支付
-// 生成支付二维码
-func WeixinPayCode(amount int32, openId string) (string, error) {
-	// 商户server调用统一下单接口请求订单
-	response, err := createUnifyOrder(amount, openId, TradeTypeNATIVE)
+// Query 查询订单
+// https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=9_2
+func (c *Client) Query(ctx context.Context, outTradeNo string) (*payment.Trade, error) {
+	resp, err := c.call(ctx, "/pay/orderquery", params{"out_trade_no": outTradeNo})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	trade := &payment.Trade{
+		OutTradeNo: resp["out_trade_no"],
+		TradeNo:    resp["transaction_id"],
+		Status:     tradeStatus(resp["trade_state"]),
 	}
-	// 当trade_type=NATIVE时才有返回
-	codeURL := response.CodeURL
-	fmt.Println(codeURL)
+	trade.Amount, _ = strconv.ParseInt(resp["total_fee"], 10, 64)
+	trade.PaidAt, _ = time.ParseInLocation("20060102150405", resp["time_end"], cst)
+	return trade, nil
+}
 
-	return codeURL, nil
+// Close 关闭订单，订单已经关闭时不报错
+// https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=9_3
+func (c *Client) Close(ctx context.Context, outTradeNo string) error {
+	_, err := c.call(ctx, "/pay/closeorder", params{"out_trade_no": outTradeNo})
+	if errors.Is(err, payment.ErrTradeClosed) {
+		return nil
+	}
+	return err
 }
 
-// 统一下单
-// https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=9_1
-func createUnifyOrder(amount int32, openId, tradeType string) (*UnifyOrderResponse, error) {
-	bodyData := buildUnifyParams(amount, openId, tradeType)
-	requestParams, err := xml.Marshal(bodyData)
+// Refund 申请退款，需要通过 WithHTTPClient 配置商户证书。退款是异步的，返回 payment.RefundProcessing
+// https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=9_4
+func (c *Client) Refund(ctx context.Context, req *payment.RefundRequest) (*payment.Refund, error) {
+	if req.Amount <= 0 || req.TotalAmount <= 0 {
+		return nil, payment.ErrInvalidAmount
+	}
+	if req.Amount > req.TotalAmount {
+		return nil, payment.ErrRefundExceeded
+	}
+	resp, err := c.call(ctx, "/secapi/pay/refund", params{
+		"out_trade_no":  req.OutTradeNo,
+		"out_refund_no": req.OutRefundNo,
+		"total_fee":     strconv.FormatInt(req.TotalAmount, 10),
+		"refund_fee":    strconv.FormatInt(req.Amount, 10),
+		"refund_desc":   req.Reason,
+	})
 	if err != nil {
 		return nil, err
 	}
+	refund := &payment.Refund{
+		OutTradeNo:  req.OutTradeNo,
+		OutRefundNo: req.OutRefundNo,
+		RefundNo:    resp["refund_id"],
+		Status:      payment.RefundProcessing,
+	}
+	refund.Amount, _ = strconv.ParseInt(resp["refund_fee"], 10, 64)
+	return refund, nil
+}
+
+// QueryRefund 查询退款
+// https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=9_5
+func (c *Client) QueryRefund(ctx context.Context, outTradeNo, outRefundNo string) (*payment.Refund, error) {
+	resp, err := c.call(ctx, "/pay/refundquery", params{"out_refund_no": outRefundNo})
+	if err != nil {
+		return nil, err
+	}
+	// 按退款单号查询时只返回这一笔，序号为 0
+	if resp["out_trade_no"] != outTradeNo || resp["out_refund_no_0"] != outRefundNo {
+		return nil, payment.ErrTradeNotFound
+	}
+	refund := &payment.Refund{
+		OutTradeNo:  outTradeNo,
+		OutRefundNo: outRefundNo,
+		RefundNo:    resp["refund_id_0"],
+		Status:      refundStatus(resp["refund_status_0"]),
+	}
+	refund.Amount, _ = strconv.ParseInt(resp["refund_fee_0"], 10, 64)
+	return refund, nil
+}
 
-	strReq := string(requestParams)
-	strReq = strings.Replace(strReq, "UnifyOrderRequest", "xml", -1)
-	response, err := http.Post(WeiXinPayUnifedURL, "text/xml:charset=UTF-8", strings.NewReader(strReq))
+// VerifyNotification 解析并校验支付结果通知
+// https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=9_7
+func (c *Client) VerifyNotification(r *http.Request) (*payment.Notification, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	p, err := parseParams(body)
 	if err != nil {
 		return nil, err
 	}
+	if p["return_code"] != "SUCCESS" {
+		return nil, &payment.Error{Provider: Name, Code: p["return_code"], Message: p["return_msg"]}
+	}
+	if !c.verify(p) || p["appid"] != c.appID || p["mch_id"] != c.mchID {
+		return nil, payment.ErrInvalidSignature
+	}
+	n := &payment.Notification{
+		Provider:   Name,
+		OutTradeNo: p["out_trade_no"],
+		TradeNo:    p["transaction_id"],
+		Status:     payment.StatusNotPay,
+		Passback:   p["attach"],
+		Raw:        p,
+	}
+	if p["result_code"] == "SUCCESS" {
+		n.Status = payment.StatusSuccess
+	}
+	if n.Amount, err = strconv.ParseInt(p["total_fee"], 10, 64); err != nil {
+		return nil, payment.ErrInvalidAmount
+	}
+	n.PaidAt, _ = time.ParseInLocation("20060102150405", p["time_end"], cst)
+	return n, nil
+}
+
+// AckNotification 应答通知，返回 FAIL 时微信会按 15s/15s/30s/3m/10m... 的间隔重新通知
+func (c *Client) AckNotification(w http.ResponseWriter, err error) {
+	code, msg := "SUCCESS", "OK"
+	if err != nil {
+		code, msg = "FAIL", err.Error()
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.Write(params{"return_code": code, "return_msg": msg}.encode())
+}
+
+// call 补充公共参数并签名，校验应答的签名，业务失败时返回 *payment.Error
+func (c *Client) call(ctx context.Context, path string, p params) (params, error) {
+	p["appid"] = c.appID
+	p["mch_id"] = c.mchID
+	p["nonce_str"] = genNonceStr(16)
+	if c.opts.signType != SignTypeMD5 {
+		p["sign_type"] = c.opts.signType
+	}
+	p["sign"] = buildSign(p, c.key, c.opts.signType)
 
-	response.Header.Set("Content-Type", "text/xml;charset=utf-8")
+	req, err := http.NewRequest(http.MethodPost, c.opts.baseURL+path, bytes.NewReader(p.encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	response, err := c.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
 	defer response.Body.Close()
-	responseBody, err := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("weixin: %s: http status %d", path, response.StatusCode)
+	}
+	responseBody, err := ioutil.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := parseParams(responseBody)
 	if err != nil {
 		return nil, err
 	}
 
-	uoResp := new(UnifyOrderResponse)
-	if _err := xml.Unmarshal(responseBody, uoResp); _err != nil {
-		return nil, _err
-	}
-
-	createOrder(bodyData.OutTradeNo, amount)
-	return uoResp, nil
-}
-func createOrder(outTradeNo string, amount int32) {
-	// 将此订单存储到数据库中
-	fmt.Printf("save to db, outTradeNo: %s, amount: %d", outTradeNo, amount)
-}
-
-// 统一下单请求体
-type UnifyOrderRequest struct {
-	AppID          string `xml:"appid"`
-	MchID          string `xml:"mch_id"`
-	NonceStr       string `xml:"nonce_str"`
-	Sign           string `xml:"sign"`
-	Body           string `xml:"body"`
-	OutTradeNo     string `xml:"out_trade_no"`
-	TotalFee       string `xml:"total_fee"`
-	SpbillCreateIP string `xml:"spbill_create_ip"`
-	NotifyURL      string `xml:"notify_url"`
-	TradeType      string `xml:"trade_type"`
-	OpenID         string `xml:"openid"`
-}
-
-// 统一下单响应体
-type UnifyOrderResponse struct {
-	ReturnCode string `xml:"return_code"`
-	ResultCode string `xml:"result_code"`
-	ErrCode    string `xml:"err_code"`
-	ErrCodeDes string `xml:"err_code_des"`
-	ReturnMsg  string `xml:"return_msg"`
-	PrepayID   string `xml:"prepay_id"`
-	CodeURL    string `xml:"code_url"`
-	NoneceStr  string `xml:"nonce_str"`
-}
-
-// 构造统一下单参数
-func buildUnifyParams(amount int32, openID, tradeType string) *UnifyOrderRequest {
-	unifyParams := UnifyOrderRequest{
-		AppID:          AppID,
-		MchID:          MchID,
-		NonceStr:       genNonceStr(16),
-		Body:           RewardBody,
-		OutTradeNo:     buildOutTradeNo(),
-		TotalFee:       fmt.Sprintf("%d", amount),
-		SpbillCreateIP: CreateIP,
-		NotifyURL:      WeixinNotifyURL,
-		TradeType:      tradeType,
-		OpenID:         openID,
-	}
-
-	sign := buildSign(map[string]string{
-		"appid":            unifyParams.AppID,
-		"mch_id":           unifyParams.MchID,
-		"nonce_str":        unifyParams.NonceStr,
-		"body":             unifyParams.Body,
-		"out_trade_no":     unifyParams.OutTradeNo,
-		"total_fee":        unifyParams.TotalFee,
-		"spbill_create_ip": unifyParams.SpbillCreateIP,
-		"notify_url":       unifyParams.NotifyURL,
-		"trade_type":       unifyParams.TradeType,
-		"openid":           unifyParams.OpenID,
-	})
+	// return_code 表示通信结果，result_code 表示业务结果
+	if resp["return_code"] != "SUCCESS" {
+		return nil, &payment.Error{Provider: Name, Code: resp["return_code"], Message: resp["return_msg"]}
+	}
+	if !c.verify(resp) {
+		return nil, fmt.Errorf("weixin: %s: %w", path, payment.ErrInvalidSignature)
+	}
+	if resp["result_code"] != "SUCCESS" {
+		return nil, &payment.Error{
+			Provider: Name,
+			Code:     resp["err_code"],
+			Message:  resp["err_code_des"],
+			Err:      errorByCode(resp["err_code"]),
+		}
+	}
+	return resp, nil
+}
+
+// verify 按应答中的 sign_type 校验签名，没有 sign_type 时使用配置的签名类型
+func (c *Client) verify(p params) bool {
+	signType := firstNonEmpty(p["sign_type"], c.opts.signType)
+	return p["sign"] != "" && hmac.Equal([]byte(p["sign"]), []byte(buildSign(p, c.key, signType)))
+}
+
+func errorByCode(code string) error {
+	switch code {
+	case "ORDERPAID":
+		return payment.ErrTradePaid
+	case "ORDERCLOSED":
+		return payment.ErrTradeClosed
+	case "ORDERNOTEXIST", "REFUNDNOTEXIST":
+		return payment.ErrTradeNotFound
+	case "OUT_TRADE_NO_USED":
+		return payment.ErrDuplicateTrade
+	}
+	return nil
+}
+
+func tradeStatus(state string) payment.TradeStatus {
+	switch state {
+	case "SUCCESS":
+		return payment.StatusSuccess
+	case "REFUND":
+		return payment.StatusRefund
+	case "USERPAYING":
+		return payment.StatusPaying
+	case "CLOSED", "REVOKED":
+		return payment.StatusClosed
+	}
+	// NOTPAY、PAYERROR 可以继续付款
+	return payment.StatusNotPay
+}
 
-	unifyParams.Sign = sign
-	return &unifyParams
+func refundStatus(status string) payment.RefundStatus {
+	switch status {
+	case "SUCCESS":
+		return payment.RefundSuccess
+	case "PROCESSING":
+		return payment.RefundProcessing
+	}
+	// REFUNDCLOSE、CHANGE
+	return payment.RefundFailed
+}
+
+// params 请求和应答的参数，编码为只有一层的 xml
+type params map[string]string
+
+func (p params) encode() []byte {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	buf.WriteString("<xml>")
+	for _, k := range keys {
+		if p[k] == "" {
+			continue
+		}
+		buf.WriteString("<" + k + ">")
+		xml.EscapeText(&buf, []byte(p[k]))
+		buf.WriteString("</" + k + ">")
+	}
+	buf.WriteString("</xml>")
+	return buf.Bytes()
+}
+
+func parseParams(data []byte) (params, error) {
+	p := params{}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	depth, key := 0, ""
+	var value strings.Builder
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				key = t.Name.Local
+				value.Reset()
+			}
+		case xml.CharData:
+			if depth == 2 {
+				value.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 {
+				p[key] = value.String()
+			}
+			depth--
+		}
+	}
+	if len(p) == 0 {
+		return nil, errors.New("weixin: empty xml")
+	}
+	return p, nil
 }
 
 // 获取指定长度随机字符串
@@ -195,36 +430,38 @@ func genNonceStr(n int) string {
 	return string(b)
 }
 
-// 生成商户订单号
-func buildOutTradeNo() string {
-	timeStamp := time.Now().UnixNano()
-	outTradeNoStr := fmt.Sprintf("%d", timeStamp)
-	h := md5.New()
-	io.WriteString(h, outTradeNoStr)
-	return fmt.Sprintf("%x", h.Sum(nil))
-}
-
-// 生成签名
+// 生成签名，忽略 sign 和空值参数
 // https://pay.weixin.qq.com/wiki/doc/api/jsapi.php?chapter=4_3
-func buildSign(params map[string]string) string {
-	var signString string
+func buildSign(params map[string]string, key, signType string) string {
 	var keys []string
-	for key := range params {
-		keys = append(keys, key)
+	for k, v := range params {
+		if k != "sign" && v != "" {
+			keys = append(keys, k)
+		}
 	}
-
 	sort.Strings(keys)
 
-	for _, key := range keys {
-		if params[key] != "" {
-			signString += key + "=" + params[key] + "&"
-		}
+	var signString strings.Builder
+	for _, k := range keys {
+		signString.WriteString(k + "=" + params[k] + "&")
 	}
+	signString.WriteString("key=" + key)
 
-	signString += "key=" + MchKey
+	var h hash.Hash
+	if signType == SignTypeHMACSHA256 {
+		h = hmac.New(sha256.New, []byte(key))
+	} else {
+		h = md5.New()
+	}
+	io.WriteString(h, signString.String())
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+}
 
-	h := md5.New()
-	io.WriteString(h, signString)
-	signString = strings.ToUpper(fmt.Sprintf("%x", h.Sum(nil)))
-	return signString
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
@@ -0,0 +1,319 @@
+package weixin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-demo/sdk/payment"
+)
+
+const (
+	testAppID = "wxd930ea5d5a258f4f"
+	testMchID = "10000100"
+	testKey   = "192006250b4c09247ec02edce69f6a2d"
+)
+
+// 签名示例来自微信支付文档的安全规范
+func TestBuildSign(t *testing.T) {
+	p := map[string]string{
+		"appid":       testAppID,
+		"mch_id":      testMchID,
+		"device_info": "1000",
+		"body":        "test",
+		"nonce_str":   "ibuaiVcKdpRxkhJA",
+		"sign":        "ignored",
+		"empty":       "",
+	}
+	if got := buildSign(p, testKey, SignTypeMD5); got != "9A0A8659F005D6984697E2CA0A9CF3B7" {
+		t.Errorf("MD5 %s", got)
+	}
+	if got := buildSign(p, testKey, SignTypeHMACSHA256); got != "6A9AE1657590FD6257D693A078E1C3E4BB6BA4DC30B23E0EE2496E54170DACD6" {
+		t.Errorf("HMAC-SHA256 %s", got)
+	}
+}
+
+func TestParams(t *testing.T) {
+	p := params{"body": "a<b>&c", "total_fee": "1", "empty": ""}
+	data := p.encode()
+	if string(data) != "<xml><body>a&lt;b&gt;&amp;c</body><total_fee>1</total_fee></xml>" {
+		t.Errorf("encode %s", data)
+	}
+	parsed, err := parseParams([]byte(`<xml><return_code><![CDATA[SUCCESS]]></return_code><body>a&lt;b</body><nested><x>1</x></nested></xml>`))
+	if err != nil || parsed["return_code"] != "SUCCESS" || parsed["body"] != "a<b" {
+		t.Errorf("parse %v, %v", parsed, err)
+	}
+	if _, err = parseParams([]byte("not xml")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+// fakeServer 模拟微信支付 v2 接口，校验请求签名并返回签名的应答
+type fakeServer struct {
+	signType string
+	mu       sync.Mutex
+	trades   map[string]params
+	refunds  map[string]params
+}
+
+func newFakeServer(signType string) (*fakeServer, *httptest.Server) {
+	f := &fakeServer{signType: signType, trades: map[string]params{}, refunds: map[string]params{}}
+	return f, httptest.NewServer(f)
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	req, err := parseParams(body)
+	resp := params{"return_code": "SUCCESS", "appid": testAppID, "mch_id": testMchID, "nonce_str": genNonceStr(8)}
+	switch {
+	case err != nil:
+		resp = params{"return_code": "FAIL", "return_msg": "invalid xml"}
+	case req["sign"] != buildSign(req, testKey, firstNonEmpty(req["sign_type"], SignTypeMD5)):
+		resp = params{"return_code": "FAIL", "return_msg": "签名错误"}
+	default:
+		f.handle(r.URL.Path, req, resp)
+	}
+	if resp["return_code"] == "SUCCESS" {
+		resp["sign"] = buildSign(resp, testKey, f.signType)
+	}
+	w.Write(resp.encode())
+}
+
+func (f *fakeServer) handle(path string, req, resp params) {
+	fail := func(code string) {
+		resp["result_code"] = "FAIL"
+		resp["err_code"] = code
+		resp["err_code_des"] = strings.ToLower(code)
+	}
+	resp["result_code"] = "SUCCESS"
+	no := req["out_trade_no"]
+	trade := f.trades[no]
+	switch path {
+	case "/pay/unifiedorder":
+		switch {
+		case trade == nil:
+			trade = params{"trade_state": "NOTPAY", "total_fee": req["total_fee"], "body": req["body"], "transaction_id": "42000" + strconv.Itoa(len(f.trades))}
+			f.trades[no] = trade
+		case trade["trade_state"] == "SUCCESS":
+			fail("ORDERPAID")
+			return
+		case trade["total_fee"] != req["total_fee"]:
+			fail("OUT_TRADE_NO_USED")
+			return
+		}
+		resp["prepay_id"] = "wx" + no
+		resp["code_url"] = "weixin://wxpay/bizpayurl?pr=" + no
+	case "/pay/orderquery":
+		if trade == nil {
+			fail("ORDERNOTEXIST")
+			return
+		}
+		resp["out_trade_no"] = no
+		resp["trade_state"] = trade["trade_state"]
+		resp["total_fee"] = trade["total_fee"]
+		if trade["trade_state"] == "SUCCESS" {
+			resp["transaction_id"] = trade["transaction_id"]
+			resp["time_end"] = "20141030133525"
+		}
+	case "/pay/closeorder":
+		switch {
+		case trade == nil:
+			fail("ORDERNOTEXIST")
+		case trade["trade_state"] == "SUCCESS":
+			fail("ORDERPAID")
+		case trade["trade_state"] == "CLOSED":
+			fail("ORDERCLOSED")
+		default:
+			trade["trade_state"] = "CLOSED"
+		}
+	case "/secapi/pay/refund":
+		f.refunds[req["out_refund_no"]] = params{"out_trade_no": no, "refund_fee": req["refund_fee"]}
+		resp["refund_id"] = "50000" + req["out_refund_no"]
+		resp["refund_fee"] = req["refund_fee"]
+	case "/pay/refundquery":
+		refund := f.refunds[req["out_refund_no"]]
+		if refund == nil {
+			fail("REFUNDNOTEXIST")
+			return
+		}
+		resp["out_trade_no"] = refund["out_trade_no"]
+		resp["refund_count"] = "1"
+		resp["out_refund_no_0"] = req["out_refund_no"]
+		resp["refund_id_0"] = "50000" + req["out_refund_no"]
+		resp["refund_fee_0"] = refund["refund_fee"]
+		resp["refund_status_0"] = "SUCCESS"
+	}
+}
+
+func TestClient(t *testing.T) {
+	for _, signType := range []string{SignTypeMD5, SignTypeHMACSHA256} {
+		t.Run(signType, func(t *testing.T) {
+			fake, srv := newFakeServer(signType)
+			defer srv.Close()
+			testClient(t, fake, NewClient(testAppID, testMchID, testKey, WithBaseURL(srv.URL), WithSignType(signType)))
+		})
+	}
+}
+
+func testClient(t *testing.T, fake *fakeServer, c *Client) {
+	ctx := context.Background()
+	no := payment.OutTradeNo("order-1", 0)
+	req := &payment.CreateRequest{OutTradeNo: no, Subject: "book", Amount: 100, Scene: payment.SceneNative}
+
+	result, err := c.Create(ctx, req)
+	if err != nil || result.PayURL != "weixin://wxpay/bizpayurl?pr="+no {
+		t.Fatalf("Create %+v, %v", result, err)
+	}
+	// 同一个商户订单号重试得到同一个预支付交易
+	if again, err := c.Create(ctx, req); err != nil || again.PayURL != result.PayURL {
+		t.Errorf("retry %+v, %v", again, err)
+	}
+	changed := *req
+	changed.Amount = 200
+	if _, err = c.Create(ctx, &changed); !errors.Is(err, payment.ErrDuplicateTrade) {
+		t.Errorf("expected ErrDuplicateTrade, got %v", err)
+	}
+
+	jsapi := *req
+	jsapi.Scene, jsapi.OpenID = payment.SceneJSAPI, "oUpF8uMuAJO_M2pxb1Q9zNjWeS6o"
+	result, err = c.Create(ctx, &jsapi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := map[string]string{}
+	for k, v := range result.Params {
+		if k != "paySign" {
+			signed[k] = v
+		}
+	}
+	if result.Params["package"] != "prepay_id=wx"+no || result.Params["paySign"] != buildSign(signed, testKey, c.opts.signType) {
+		t.Errorf("jsapi params %v", result.Params)
+	}
+	if _, err = c.Create(ctx, &payment.CreateRequest{OutTradeNo: "x", Amount: 1, Scene: payment.ScenePage}); err != payment.ErrUnsupportedScene {
+		t.Errorf("page scene: %v", err)
+	}
+
+	trade, err := c.Query(ctx, no)
+	if err != nil || trade.Status != payment.StatusNotPay || trade.Amount != 100 {
+		t.Fatalf("Query %+v, %v", trade, err)
+	}
+	fake.mu.Lock()
+	fake.trades[no]["trade_state"] = "SUCCESS"
+	fake.mu.Unlock()
+	trade, err = c.Query(ctx, no)
+	if err != nil || trade.Status != payment.StatusSuccess || trade.TradeNo == "" || trade.PaidAt.Format("2006-01-02 15:04:05") != "2014-10-30 13:35:25" {
+		t.Fatalf("Query paid %+v, %v", trade, err)
+	}
+	if _, err = c.Query(ctx, "missing"); !errors.Is(err, payment.ErrTradeNotFound) {
+		t.Errorf("expected ErrTradeNotFound, got %v", err)
+	}
+	if err = c.Close(ctx, no); !errors.Is(err, payment.ErrTradePaid) {
+		t.Errorf("close paid: %v", err)
+	}
+
+	other := payment.OutTradeNo("order-2", 0)
+	c.Create(ctx, &payment.CreateRequest{OutTradeNo: other, Amount: 1, Scene: payment.SceneNative})
+	if err = c.Close(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Close(ctx, other); err != nil {
+		t.Errorf("close twice: %v", err)
+	}
+
+	refundNo := payment.OutRefundNo(no, 0)
+	if _, err = c.Refund(ctx, &payment.RefundRequest{OutTradeNo: no, OutRefundNo: refundNo, TotalAmount: 100, Amount: 101}); err != payment.ErrRefundExceeded {
+		t.Errorf("expected ErrRefundExceeded, got %v", err)
+	}
+	refund, err := c.Refund(ctx, &payment.RefundRequest{OutTradeNo: no, OutRefundNo: refundNo, TotalAmount: 100, Amount: 60})
+	if err != nil || refund.Status != payment.RefundProcessing || refund.Amount != 60 {
+		t.Fatalf("Refund %+v, %v", refund, err)
+	}
+	refund, err = c.QueryRefund(ctx, no, refundNo)
+	if err != nil || refund.Status != payment.RefundSuccess || refund.RefundNo != "50000"+refundNo {
+		t.Errorf("QueryRefund %+v, %v", refund, err)
+	}
+	if _, err = c.QueryRefund(ctx, other, refundNo); err != payment.ErrTradeNotFound {
+		t.Errorf("refund of other trade: %v", err)
+	}
+	if _, err = c.QueryRefund(ctx, no, "missing"); !errors.Is(err, payment.ErrTradeNotFound) {
+		t.Errorf("missing refund: %v", err)
+	}
+
+	// 密钥错误时应答没有签名
+	bad := NewClient(testAppID, testMchID, "wrong", WithBaseURL(c.opts.baseURL), WithSignType(c.opts.signType))
+	var perr *payment.Error
+	if _, err = bad.Query(ctx, no); !errors.As(err, &perr) || perr.Code != "FAIL" {
+		t.Errorf("wrong key: %v", err)
+	}
+}
+
+func TestVerifyNotification(t *testing.T) {
+	c := NewClient(testAppID, testMchID, testKey)
+	notify := func(p params) *http.Request {
+		if p["sign"] == "" {
+			p["sign"] = buildSign(p, testKey, SignTypeMD5)
+		}
+		return httptest.NewRequest(http.MethodPost, "/weixin/pay", bytes.NewReader(p.encode()))
+	}
+	paid := func() params {
+		return params{
+			"return_code":    "SUCCESS",
+			"result_code":    "SUCCESS",
+			"appid":          testAppID,
+			"mch_id":         testMchID,
+			"nonce_str":      "5K8264ILTKCH16CQ2502SI8ZNMTM67VS",
+			"out_trade_no":   "1409811653",
+			"transaction_id": "1004400740201409030005092168",
+			"total_fee":      "1",
+			"time_end":       "20140903131540",
+			"attach":         "uid=1",
+		}
+	}
+
+	n, err := c.VerifyNotification(notify(paid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Provider != Name || n.OutTradeNo != "1409811653" || n.Status != payment.StatusSuccess || n.Amount != 1 ||
+		n.Passback != "uid=1" || n.PaidAt.UTC().Format("15:04:05") != "05:15:40" {
+		t.Errorf("notification %+v", n)
+	}
+
+	tampered := paid()
+	tampered["sign"] = buildSign(tampered, testKey, SignTypeMD5)
+	tampered["total_fee"] = "100"
+	if _, err = c.VerifyNotification(notify(tampered)); err != payment.ErrInvalidSignature {
+		t.Errorf("tampered: %v", err)
+	}
+	otherMch := paid()
+	otherMch["mch_id"] = "1"
+	if _, err = c.VerifyNotification(notify(otherMch)); err != payment.ErrInvalidSignature {
+		t.Errorf("other merchant: %v", err)
+	}
+	hmacSigned := paid()
+	hmacSigned["sign_type"] = SignTypeHMACSHA256
+	hmacSigned["sign"] = buildSign(hmacSigned, testKey, SignTypeHMACSHA256)
+	if _, err = c.VerifyNotification(notify(hmacSigned)); err != nil {
+		t.Errorf("HMAC-SHA256 notification: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c.AckNotification(w, nil)
+	if p, _ := parseParams(w.Body.Bytes()); p["return_code"] != "SUCCESS" {
+		t.Errorf("ack %s", w.Body)
+	}
+	w = httptest.NewRecorder()
+	c.AckNotification(w, errors.New("db down"))
+	if p, _ := parseParams(w.Body.Bytes()); p["return_code"] != "FAIL" || p["return_msg"] != "db down" {
+		t.Errorf("nack %s", w.Body)
+	}
+}
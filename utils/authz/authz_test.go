@@ -0,0 +1,276 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	cryptox "go-demo/utils/crypto"
+	tokenx "go-demo/utils/token"
+)
+
+const testPolicy = `
+roles:
+  - name: viewer
+    permissions:
+      - resource: /articles/**
+        actions: [GET]
+  - name: editor
+    inherits: [viewer]
+    permissions:
+      - resource: /articles/:id
+        actions: [PUT, DELETE]
+        condition: owner == subject
+  - name: admin
+    inherits: [editor]
+    permissions:
+      - resource: /**
+        actions: ["*"]
+      - resource: /admin/**
+        actions: ["*"]
+        effect: deny
+        condition: "!(ip == '10.0.0.1')"
+bindings:
+  - subject: "*"
+    roles: [viewer]
+  - subject: alice
+    roles: [editor]
+  - subject: root
+    roles: [admin]
+`
+
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEngine(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestAuthorize(t *testing.T) {
+	e := newTestEngine(t)
+	cases := []struct {
+		name string
+		req  Request
+		want bool
+	}{
+		{"viewer read", Request{Subject: "bob", Action: "GET", Resource: "/articles/1/comments"}, true},
+		{"viewer write", Request{Subject: "bob", Action: "PUT", Resource: "/articles/1"}, false},
+		{"anonymous", Request{Action: "GET", Resource: "/articles/1"}, false},
+		{"owner edit", Request{Subject: "alice", Action: "put", Resource: "/articles/1", Attributes: map[string]interface{}{"owner": "alice"}}, true},
+		{"not owner", Request{Subject: "alice", Action: "PUT", Resource: "/articles/1", Attributes: map[string]interface{}{"owner": "bob"}}, false},
+		{"missing attribute", Request{Subject: "alice", Action: "DELETE", Resource: "/articles/1"}, false},
+		{"nested path", Request{Subject: "alice", Action: "PUT", Resource: "/articles/1/title", Attributes: map[string]interface{}{"owner": "alice"}}, false},
+		{"admin", Request{Subject: "root", Action: "POST", Resource: "/users"}, true},
+		{"admin outside office", Request{Subject: "root", Action: "GET", Resource: "/admin/stats", Attributes: map[string]interface{}{"ip": "1.2.3.4"}}, false},
+		{"admin in office", Request{Subject: "root", Action: "GET", Resource: "/admin/stats", Attributes: map[string]interface{}{"ip": "10.0.0.1"}}, true},
+		{"deny on condition error", Request{Subject: "root", Action: "GET", Resource: "/admin/stats"}, false},
+		{"role from token", Request{Subject: "carol", Roles: []string{"admin"}, Action: "POST", Resource: "/users"}, true},
+	}
+	for _, c := range cases {
+		if got := e.Authorize(&c.req); got != c.want {
+			t.Errorf("%s: Authorize = %v, want %v", c.name, got, c.want)
+		}
+		if got := e.Explain(&c.req).Allowed; got != c.want {
+			t.Errorf("%s: Explain = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	e := newTestEngine(t)
+	d := e.Explain(&Request{Subject: "alice", Action: "PUT", Resource: "/articles/1", Attributes: map[string]interface{}{"owner": "bob"}})
+	if d.Allowed || d.Reason != reasonDefault || d.Rule != nil {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+	if len(d.Roles) != 2 || d.Roles[0] != "editor" || d.Roles[1] != "viewer" {
+		t.Errorf("roles = %v", d.Roles)
+	}
+	if len(d.Trace) != 1 || d.Trace[0].Role != "editor" || d.Trace[0].Result != resultConditionFalse {
+		t.Errorf("trace = %+v", d.Trace)
+	}
+
+	d = e.Explain(&Request{Subject: "root", Action: "GET", Resource: "/admin/stats", Attributes: map[string]interface{}{"ip": "1.2.3.4"}})
+	if d.Allowed || d.Rule == nil || d.Rule.Effect != EffectDeny || len(d.Trace) < 2 {
+		t.Errorf("unexpected decision %+v", d)
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown parent":  "roles: [{name: a, inherits: [b]}]",
+		"cycle":           "roles: [{name: a, inherits: [b]}, {name: b, inherits: [a]}]",
+		"unknown binding": "bindings: [{subject: x, roles: [a]}]",
+		"bad condition":   "roles: [{name: a, permissions: [{resource: /a, actions: [GET], condition: 'a =='}]}]",
+		"bad effect":      "roles: [{name: a, permissions: [{resource: /a, actions: [GET], effect: maybe}]}]",
+		"bad pattern":     "roles: [{name: a, permissions: [{resource: /**/a, actions: [GET]}]}]",
+		"unknown field":   "roles: [{name: a, permission: []}]",
+	}
+	for name, data := range cases {
+		if _, err := ParsePolicy([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := ParsePolicy([]byte(cases["cycle"])); !errors.Is(err, ErrRoleCycle) {
+		t.Errorf("expected ErrRoleCycle, got %v", err)
+	}
+}
+
+func TestInFunction(t *testing.T) {
+	in := conditionFunctions["in"]
+	for _, c := range []struct {
+		args []interface{}
+		want bool
+	}{
+		{[]interface{}{"a", "b", "a"}, true},
+		{[]interface{}{1.0, 2.0}, false},
+		// 不可比较的类型不能 panic
+		{[]interface{}{[]interface{}{"a"}, []interface{}{"a"}}, true},
+		{[]interface{}{[]string{"a"}, []string{"b"}}, false},
+		{[]interface{}{map[string]interface{}{"k": 1}, "k"}, false},
+	} {
+		got, err := in(c.args...)
+		if err != nil || got != c.want {
+			t.Errorf("in(%v) = %v, %v", c.args, got, err)
+		}
+	}
+}
+
+func TestHotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := ioutil.WriteFile(path, []byte(testPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan error, 10)
+	e, err := Load(path, WithReloadCallback(func(_ *Policy, err error) { reloaded <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	req := &Request{Subject: "bob", Action: "GET", Resource: "/articles/1"}
+	if !e.Authorize(req) {
+		t.Fatal("viewer should read articles")
+	}
+
+	write := func(data string) error {
+		// 先写临时文件再重命名，模拟编辑器保存
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-reloaded:
+			return err
+		case <-time.After(3 * time.Second):
+			t.Fatal("policy not reloaded")
+			return nil
+		}
+	}
+
+	// 不合法的策略被拒绝，原策略继续生效
+	if err = write("roles: [{name: a, inherits: [missing]}]"); err == nil {
+		t.Error("invalid policy accepted")
+	}
+	if !e.Authorize(req) {
+		t.Error("previous policy lost after invalid reload")
+	}
+
+	if err = write("roles: [{name: viewer}]"); err != nil {
+		t.Fatal(err)
+	}
+	if e.Authorize(req) {
+		t.Error("reloaded policy not applied")
+	}
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	signer, err := cryptox.GenerateSigner(cryptox.SignES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := tokenx.NewIssuer("k1", signer)
+	keys := tokenx.NewKeySet()
+	keys.Add(issuer.KeyID(), issuer.Verifier())
+	tokens := tokenx.NewManager(issuer, tokenx.NewVerifier(keys), tokenx.NewMemoryStore())
+
+	e := newTestEngine(t)
+	r := gin.New()
+	r.Use(tokenx.GinMiddleware(tokens), GinMiddleware(e, WithExplain(true),
+		WithAttributes(func(r *http.Request) map[string]interface{} {
+			return map[string]interface{}{"owner": r.Header.Get("X-Owner")}
+		})))
+	r.PUT("/articles/:id", func(c *gin.Context) {
+		d, _ := FromContext(c.Request.Context())
+		c.String(http.StatusOK, d.Rule.Role)
+	})
+
+	do := func(subject, owner string) *httptest.ResponseRecorder {
+		pair, err := tokens.Login(tokenx.RegisteredClaims{Subject: subject})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPut, "/articles/1", nil)
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		req.Header.Set("X-Owner", owner)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("alice", "alice"); w.Code != http.StatusOK || w.Body.String() != "editor" {
+		t.Errorf("owner: %d %s", w.Code, w.Body.String())
+	}
+	w := do("alice", "bob")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("not owner: %d", w.Code)
+	}
+	var d Decision
+	if err = json.Unmarshal(w.Body.Bytes(), &d); err != nil || len(d.Trace) == 0 {
+		t.Errorf("explain body: %s", w.Body.String())
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	e := newTestEngine(t)
+	h := HTTPMiddleware(e, WithSubject(func(r *http.Request) string { return r.Header.Get("X-User") }))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		user, method string
+		code         int
+	}{
+		{"", http.MethodGet, http.StatusUnauthorized},
+		{"bob", http.MethodGet, http.StatusOK},
+		{"bob", http.MethodPost, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/articles/1", nil)
+		req.Header.Set("X-User", c.user)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.code {
+			t.Errorf("%s %s: %d, want %d", c.user, c.method, w.Code, c.code)
+		}
+		if w.Code == http.StatusForbidden && w.Header().Get("Content-Type") == "application/json; charset=utf-8" {
+			t.Error("decision exposed without WithExplain")
+		}
+	}
+}
@@ -0,0 +1,219 @@
+/**
+ * RBAC/ABAC 授权引擎
+ *   1. 角色 -> 权限(资源模式 + 操作)，角色可以继承
+ *   2. 权限可以带 govaluate 条件表达式，按主体、资源和环境属性判断
+ *   3. deny 优先，没有匹配的 allow 时默认拒绝
+ *   4. 策略从 YAML 文件加载，文件变化时热更新，见 Load
+ */
+package authz
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"go-demo/utils/fsnotify"
+)
+
+// Request 一次授权请求，条件表达式中可以使用以下变量:
+// subject、action、resource、roles(可配合 IN 使用)、资源模式中 :name 捕获的参数以及 Attributes
+type Request struct {
+	Subject  string
+	Roles    []string // 额外的角色，如 token 中携带的角色，与策略中绑定的角色合并
+	Action   string
+	Resource string
+	// Attributes 主体、资源和环境的属性，如 owner、ip，与内置变量同名时内置变量优先
+	Attributes map[string]interface{}
+}
+
+// Decision 授权结果及其原因，用于排查请求为什么被拒绝
+type Decision struct {
+	Allowed bool     `json:"allowed"`
+	Reason  string   `json:"reason"`
+	Roles   []string `json:"roles"`
+	// Rule 决定结果的规则，默认拒绝时为空
+	Rule  *Match  `json:"rule,omitempty"`
+	Trace []Match `json:"trace,omitempty"`
+}
+
+// Match 资源和操作匹配上的规则
+type Match struct {
+	Role      string   `json:"role"`
+	Resource  string   `json:"resource"`
+	Actions   []string `json:"actions"`
+	Effect    string   `json:"effect"`
+	Condition string   `json:"condition,omitempty"`
+	// Result applied、condition false 或条件求值错误
+	Result string `json:"result"`
+}
+
+const (
+	resultApplied        = "applied"
+	resultConditionFalse = "condition false"
+
+	reasonDenied  = "denied by rule"
+	reasonAllowed = "allowed by rule"
+	reasonDefault = "no rule allows the request"
+)
+
+type (
+	LoadOption func(*Engine)
+
+	Engine struct {
+		policy   atomic.Value // *compiled
+		path     string
+		onReload func(*Policy, error)
+		watcher  *fsnotify.FileWatcher
+		reloadMu sync.Mutex
+	}
+)
+
+// WithReloadCallback sets the callback fired after every reload attempt,
+// err is not nil when the new policy was rejected.
+func WithReloadCallback(fn func(policy *Policy, err error)) LoadOption {
+	return func(e *Engine) {
+		e.onReload = fn
+	}
+}
+
+// NewEngine 使用内存中的策略，不监听文件
+func NewEngine(policy *Policy) (*Engine, error) {
+	e := &Engine{}
+	if err := e.SetPolicy(policy); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetPolicy 替换当前策略，新策略不合法时保留原策略
+func (e *Engine) SetPolicy(policy *Policy) error {
+	c, err := compile(policy)
+	if err != nil {
+		return err
+	}
+	e.policy.Store(c)
+	return nil
+}
+
+// Policy 返回当前生效的策略
+func (e *Engine) Policy() *Policy {
+	return e.load().policy
+}
+
+func (e *Engine) load() *compiled {
+	return e.policy.Load().(*compiled)
+}
+
+// Authorize 是否允许该请求
+func (e *Engine) Authorize(req *Request) bool {
+	return e.evaluate(req, false).Allowed
+}
+
+// Explain 与 Authorize 结果相同，同时返回所有匹配上的规则
+func (e *Engine) Explain(req *Request) *Decision {
+	return e.evaluate(req, true)
+}
+
+func (e *Engine) evaluate(req *Request, explain bool) *Decision {
+	c := e.load()
+	roles := c.rolesOf(req)
+	d := &Decision{Roles: roles, Reason: reasonDefault}
+
+	var allow *Match
+	for _, role := range roles {
+		for _, ru := range c.roles[role] {
+			if !ru.matchAction(req.Action) {
+				continue
+			}
+			ok, captured := ru.pattern.match(req.Resource)
+			if !ok {
+				continue
+			}
+			m := Match{
+				Role:      ru.role,
+				Resource:  ru.permission.Resource,
+				Actions:   ru.permission.Actions,
+				Effect:    ru.permission.Effect,
+				Condition: ru.permission.Condition,
+				Result:    resultApplied,
+			}
+			applied, err := ru.eval(req, roles, captured)
+			if err != nil {
+				m.Result = "condition error: " + err.Error()
+			} else if !applied {
+				m.Result = resultConditionFalse
+			}
+			if explain {
+				d.Trace = append(d.Trace, m)
+			}
+
+			// deny 规则条件求值出错时按拒绝处理
+			if ru.permission.Effect == EffectDeny && (applied || err != nil) {
+				if d.Rule == nil {
+					d.Allowed, d.Reason, d.Rule = false, reasonDenied, &m
+				}
+				if !explain {
+					return d
+				}
+				continue
+			}
+			if applied && allow == nil {
+				allow = &m
+			}
+		}
+	}
+	if d.Rule == nil && allow != nil {
+		d.Allowed, d.Reason, d.Rule = true, reasonAllowed, allow
+	}
+	return d
+}
+
+// rolesOf 请求中的角色、绑定到该主体的角色以及绑定到 * 的角色，去重排序
+func (c *compiled) rolesOf(req *Request) []string {
+	set := make(map[string]bool)
+	for _, r := range req.Roles {
+		set[r] = true
+	}
+	if req.Subject != "" {
+		for _, r := range c.bindings[req.Subject] {
+			set[r] = true
+		}
+		for _, r := range c.bindings["*"] {
+			set[r] = true
+		}
+	}
+	roles := make([]string, 0, len(set))
+	for r := range set {
+		roles = append(roles, r)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func (r *rule) eval(req *Request, roles []string, captured map[string]string) (bool, error) {
+	if r.condition == nil {
+		return true, nil
+	}
+	params := make(map[string]interface{}, len(req.Attributes)+len(captured)+4)
+	for k, v := range req.Attributes {
+		params[k] = v
+	}
+	for k, v := range captured {
+		params[k] = v
+	}
+	list := make([]interface{}, len(roles))
+	for i, role := range roles {
+		list[i] = role
+	}
+	params["subject"] = req.Subject
+	params["action"] = req.Action
+	params["resource"] = req.Resource
+	params["roles"] = list
+
+	result, err := r.condition.Evaluate(params)
+	if err != nil {
+		return false, err
+	}
+	ok, _ := result.(bool)
+	return ok, nil
+}
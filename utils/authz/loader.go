@@ -0,0 +1,56 @@
+package authz
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"go-demo/utils/fsnotify"
+)
+
+// Load 加载 path 中的 YAML 策略，之后监听文件变化并热更新，
+// 新策略不合法时保留上一次生效的策略
+func Load(path string, opts ...LoadOption) (*Engine, error) {
+	e := &Engine{path: filepath.Clean(path)}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.WatchFile(e.path, func() {
+		err := e.reload()
+		if e.onReload != nil {
+			e.onReload(e.Policy(), err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.watcher = watcher
+	return e, nil
+}
+
+// Close 停止监听，已加载的策略继续生效
+func (e *Engine) Close() error {
+	if e.watcher == nil {
+		return nil
+	}
+	return e.watcher.Close()
+}
+
+func (e *Engine) reload() error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	data, err := ioutil.ReadFile(e.path)
+	if err != nil {
+		return err
+	}
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return err
+	}
+	return e.SetPolicy(policy)
+}
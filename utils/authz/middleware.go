@@ -0,0 +1,75 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type contextKey struct{}
+
+// FromContext 取出中间件的授权结果
+func FromContext(ctx context.Context) (*Decision, bool) {
+	d, ok := ctx.Value(contextKey{}).(*Decision)
+	return d, ok
+}
+
+// HTTPMiddleware 以请求方法为操作、URL 路径为资源进行授权，
+// 需要放在 token 中间件之后，没有主体时返回 401，拒绝时返回 403
+func HTTPMiddleware(e *Engine, opts ...Option) func(http.Handler) http.Handler {
+	o := evaluateOptions(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d, ok := authorize(e, o, w, r)
+			if !ok {
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, d)))
+		})
+	}
+}
+
+// GinMiddleware gin 版本，授权结果同样通过 FromContext(ctx.Request.Context()) 获取
+func GinMiddleware(e *Engine, opts ...Option) gin.HandlerFunc {
+	o := evaluateOptions(opts)
+	return func(ctx *gin.Context) {
+		d, ok := authorize(e, o, ctx.Writer, ctx.Request)
+		if !ok {
+			ctx.Abort()
+			return
+		}
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), contextKey{}, d))
+		ctx.Next()
+	}
+}
+
+// authorize 未通过时写入错误响应
+func authorize(e *Engine, o *options, w http.ResponseWriter, r *http.Request) (*Decision, bool) {
+	subject := o.subject(r)
+	if subject == "" {
+		http.Error(w, "authz: no subject", http.StatusUnauthorized)
+		return nil, false
+	}
+	req := &Request{Subject: subject, Action: r.Method, Resource: o.resource(r)}
+	if o.roles != nil {
+		req.Roles = o.roles(r)
+	}
+	if o.attributes != nil {
+		req.Attributes = o.attributes(r)
+	}
+
+	d := e.evaluate(req, o.explain)
+	if d.Allowed {
+		return d, true
+	}
+	if !o.explain {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(d)
+	return nil, false
+}
@@ -0,0 +1,75 @@
+package authz
+
+import (
+	"net/http"
+
+	tokenx "go-demo/utils/token"
+)
+
+type (
+	Option  func(*options)
+	options struct {
+		subject    func(*http.Request) string
+		roles      func(*http.Request) []string
+		attributes func(*http.Request) map[string]interface{}
+		resource   func(*http.Request) string
+		explain    bool
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		subject:  tokenSubject,
+		resource: func(r *http.Request) string { return r.URL.Path },
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+
+	return optCopy
+}
+
+// tokenSubject 取 token 中间件校验通过的 access token 的 sub
+func tokenSubject(r *http.Request) string {
+	if t, ok := tokenx.FromContext(r.Context()); ok {
+		return t.Registered.Subject
+	}
+	return ""
+}
+
+// WithSubject sets how to read the subject from a request,
+// by default it is the sub claim of the token verified by the token middleware.
+func WithSubject(fn func(r *http.Request) string) Option {
+	return func(opts *options) {
+		opts.subject = fn
+	}
+}
+
+// WithRoles sets extra roles of the request, e.g. roles carried in the token.
+func WithRoles(fn func(r *http.Request) []string) Option {
+	return func(opts *options) {
+		opts.roles = fn
+	}
+}
+
+// WithAttributes sets the attributes available to policy conditions.
+func WithAttributes(fn func(r *http.Request) map[string]interface{}) Option {
+	return func(opts *options) {
+		opts.attributes = fn
+	}
+}
+
+// WithResource sets how to map a request to a resource, defaults to the URL path.
+func WithResource(fn func(r *http.Request) string) Option {
+	return func(opts *options) {
+		opts.resource = fn
+	}
+}
+
+// WithExplain includes the decision in the body of denied responses,
+// it exposes the policy and should only be enabled for debugging.
+func WithExplain(explain bool) Option {
+	return func(opts *options) {
+		opts.explain = explain
+	}
+}
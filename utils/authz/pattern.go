@@ -0,0 +1,65 @@
+package authz
+
+import (
+	"errors"
+	"strings"
+)
+
+// pattern 资源路径模式，按 / 分段匹配
+type pattern struct {
+	raw      string
+	segments []string
+}
+
+func compilePattern(s string) (*pattern, error) {
+	if !strings.HasPrefix(s, "/") {
+		return nil, errors.New("resource must start with /: " + s)
+	}
+	segments := split(s)
+	for i, seg := range segments {
+		if seg == "**" && i != len(segments)-1 {
+			return nil, errors.New("** must be the last segment: " + s)
+		}
+		if seg == ":" {
+			return nil, errors.New("empty parameter name: " + s)
+		}
+	}
+	return &pattern{raw: s, segments: segments}, nil
+}
+
+// match 返回是否匹配以及 :name 捕获的参数
+func (p *pattern) match(resource string) (bool, map[string]string) {
+	parts := split(resource)
+	var params map[string]string
+	for i, seg := range p.segments {
+		if seg == "**" {
+			return true, params
+		}
+		if i >= len(parts) {
+			return false, nil
+		}
+		switch {
+		case seg == "*":
+		case len(seg) > 1 && seg[0] == ':':
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:]] = parts[i]
+		case seg != parts[i]:
+			return false, nil
+		}
+	}
+	if len(parts) != len(p.segments) {
+		return false, nil
+	}
+	return true, params
+}
+
+// split 去掉首尾的 / 后分段，/ 本身为空切片
+func split(s string) []string {
+	s = strings.Trim(s, "/")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "/")
+}
@@ -0,0 +1,203 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/Knetic/govaluate.v3"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+var (
+	ErrUnknownRole = errors.New("authz: unknown role")
+	ErrRoleCycle   = errors.New("authz: role inheritance cycle")
+)
+
+type (
+	// Policy 策略文件，示例见 README.md
+	Policy struct {
+		Roles    []Role    `yaml:"roles" json:"roles"`
+		Bindings []Binding `yaml:"bindings" json:"bindings"`
+	}
+
+	// Role 角色，继承父角色的全部权限
+	Role struct {
+		Name        string       `yaml:"name" json:"name"`
+		Inherits    []string     `yaml:"inherits" json:"inherits,omitempty"`
+		Permissions []Permission `yaml:"permissions" json:"permissions"`
+	}
+
+	// Permission 资源支持 * 匹配一段路径、** 匹配任意多段、:name 匹配一段并作为条件变量，
+	// Actions 中 * 表示全部操作，Condition 为 govaluate 表达式，为空时总是成立
+	Permission struct {
+		Resource  string   `yaml:"resource" json:"resource"`
+		Actions   []string `yaml:"actions" json:"actions"`
+		Effect    string   `yaml:"effect" json:"effect,omitempty"`
+		Condition string   `yaml:"condition" json:"condition,omitempty"`
+	}
+
+	// Binding 给主体分配角色，Subject 为 * 时对所有已登录主体生效
+	Binding struct {
+		Subject string   `yaml:"subject" json:"subject"`
+		Roles   []string `yaml:"roles" json:"roles"`
+	}
+)
+
+// ParsePolicy 解析 YAML 策略并校验角色引用和条件表达式
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, err
+	}
+	if _, err := compile(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// compiled 编译后的策略，角色已展开继承关系
+type compiled struct {
+	policy   *Policy
+	roles    map[string][]*rule // 角色 -> 自身及继承的规则
+	bindings map[string][]string
+}
+
+type rule struct {
+	role       string // 定义该规则的角色
+	permission Permission
+	pattern    *pattern
+	actions    map[string]bool
+	condition  *govaluate.EvaluableExpression
+}
+
+func compile(p *Policy) (*compiled, error) {
+	defined := make(map[string]*Role, len(p.Roles))
+	for i := range p.Roles {
+		r := &p.Roles[i]
+		if r.Name == "" {
+			return nil, errors.New("authz: role name is empty")
+		}
+		if _, ok := defined[r.Name]; ok {
+			return nil, fmt.Errorf("authz: duplicate role %q", r.Name)
+		}
+		defined[r.Name] = r
+	}
+
+	own := make(map[string][]*rule, len(defined))
+	for name, r := range defined {
+		for _, parent := range r.Inherits {
+			if _, ok := defined[parent]; !ok {
+				return nil, fmt.Errorf("%w %q inherited by %q", ErrUnknownRole, parent, name)
+			}
+		}
+		for _, perm := range r.Permissions {
+			ru, err := compileRule(name, perm)
+			if err != nil {
+				return nil, err
+			}
+			own[name] = append(own[name], ru)
+		}
+	}
+
+	c := &compiled{policy: p, roles: make(map[string][]*rule, len(defined)), bindings: make(map[string][]string)}
+	for name := range defined {
+		rules, err := expand(name, defined, own, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		c.roles[name] = rules
+	}
+	for _, b := range p.Bindings {
+		if b.Subject == "" {
+			return nil, errors.New("authz: binding subject is empty")
+		}
+		for _, role := range b.Roles {
+			if _, ok := defined[role]; !ok {
+				return nil, fmt.Errorf("%w %q bound to %q", ErrUnknownRole, role, b.Subject)
+			}
+		}
+		c.bindings[b.Subject] = append(c.bindings[b.Subject], b.Roles...)
+	}
+	return c, nil
+}
+
+// expand 按深度优先收集角色及其父角色的规则，visiting 用于发现循环继承
+func expand(name string, defined map[string]*Role, own map[string][]*rule, visiting map[string]bool) ([]*rule, error) {
+	if visiting[name] {
+		return nil, fmt.Errorf("%w at %q", ErrRoleCycle, name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	rules := append([]*rule(nil), own[name]...)
+	for _, parent := range defined[name].Inherits {
+		inherited, err := expand(parent, defined, own, visiting)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, inherited...)
+	}
+	return rules, nil
+}
+
+func compileRule(role string, perm Permission) (*rule, error) {
+	switch perm.Effect {
+	case "":
+		perm.Effect = EffectAllow
+	case EffectAllow, EffectDeny:
+	default:
+		return nil, fmt.Errorf("authz: role %q: unknown effect %q", role, perm.Effect)
+	}
+	if len(perm.Actions) == 0 {
+		return nil, fmt.Errorf("authz: role %q: no actions for %q", role, perm.Resource)
+	}
+	pat, err := compilePattern(perm.Resource)
+	if err != nil {
+		return nil, fmt.Errorf("authz: role %q: %v", role, err)
+	}
+	ru := &rule{role: role, permission: perm, pattern: pat, actions: make(map[string]bool, len(perm.Actions))}
+	for _, a := range perm.Actions {
+		ru.actions[strings.ToUpper(a)] = true
+	}
+	if perm.Condition != "" {
+		if ru.condition, err = govaluate.NewEvaluableExpressionWithFunctions(perm.Condition, conditionFunctions); err != nil {
+			return nil, fmt.Errorf("authz: role %q: condition %q: %v", role, perm.Condition, err)
+		}
+	}
+	return ru, nil
+}
+
+func (r *rule) matchAction(action string) bool {
+	return r.actions["*"] || r.actions[strings.ToUpper(action)]
+}
+
+// conditionFunctions 条件表达式中可用的函数
+var conditionFunctions = map[string]govaluate.ExpressionFunction{
+	// in(x, a, b, ...) x 是否等于后面任意一个参数，数组等不可比较的类型按内容比较
+	"in": func(args ...interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, errors.New("in: missing arguments")
+		}
+		for _, a := range args[1:] {
+			if reflect.DeepEqual(a, args[0]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	},
+	"hasPrefix": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, errors.New("hasPrefix: need 2 arguments")
+		}
+		s, ok1 := args[0].(string)
+		prefix, ok2 := args[1].(string)
+		return ok1 && ok2 && strings.HasPrefix(s, prefix), nil
+	},
+}
@@ -0,0 +1,249 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// 熔断器：关闭 -> 打开 -> 半开 -> 关闭/打开
+// 关闭状态下统计滑动窗口内的失败与慢调用，达到阈值后打开；
+// 打开状态直接拒绝请求，超时后进入半开；
+// 半开状态只放行有限的探测请求，全部成功则关闭，任一失败则重新打开。
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+var (
+	ErrOpenState       = errors.New("circuit breaker is open")
+	ErrTooManyRequests = errors.New("too many requests in half-open state")
+)
+
+type Breaker struct {
+	name string
+	opts *options
+
+	mu          sync.Mutex
+	state       State
+	generation  uint64 // 每次状态切换加一，丢弃上一代请求的结果
+	window      *window
+	consecutive uint64    // 连续失败次数
+	expiry      time.Time // 打开状态的到期时间
+	probes      int       // 半开状态下正在进行的探测数
+	successes   int       // 半开状态下成功的探测数
+}
+
+func New(name string, opts ...Option) *Breaker {
+	options := evaluateOptions(opts)
+	return &Breaker{
+		name:   name,
+		opts:   options,
+		window: newWindow(options.window, options.buckets),
+	}
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State 返回当前状态，打开状态到期时会切到半开
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState(b.opts.clock())
+}
+
+// Allow 申请一次调用，成功时返回的 done 必须在调用结束后传入调用结果
+func (b *Breaker) Allow() (done func(err error), err error) {
+	generation, err := b.before()
+	if err != nil {
+		return nil, err
+	}
+	start := b.opts.clock()
+	return func(err error) {
+		b.after(generation, start, err)
+	}, nil
+}
+
+// Do 在熔断器保护下执行 fn
+func (b *Breaker) Do(fn func() error) error {
+	_, err := Execute(b, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+// Execute 在熔断器保护下执行 fn，fn panic 时记为失败并继续 panic
+func Execute[T any](b *Breaker, fn func() (T, error)) (T, error) {
+	var zero T
+	done, err := b.Allow()
+	if err != nil {
+		return zero, err
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			done(errPanic)
+			panic(e)
+		}
+	}()
+
+	result, err := fn()
+	done(err)
+	return result, err
+}
+
+// ExecuteWithFallback 执行失败或被熔断拒绝时调用 fallback 降级
+func ExecuteWithFallback[T any](b *Breaker, fn func() (T, error), fallback func(err error) (T, error)) (T, error) {
+	result, err := Execute(b, fn)
+	if err != nil && fallback != nil {
+		return fallback(err)
+	}
+	return result, err
+}
+
+var errPanic = errors.New("circuit breaker: call panicked")
+
+func (b *Breaker) before() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(b.opts.clock()) {
+	case StateOpen:
+		return 0, ErrOpenState
+	case StateHalfOpen:
+		if b.probes >= b.opts.halfOpenProbes {
+			return 0, ErrTooManyRequests
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+func (b *Breaker) after(generation uint64, start time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.opts.clock()
+	state := b.currentState(now)
+	if generation != b.generation {
+		return
+	}
+
+	failed := err != nil && (err == errPanic || b.opts.isFailure(err))
+	slow := b.opts.slowThreshold > 0 && now.Sub(start) >= b.opts.slowThreshold
+
+	switch state {
+	case StateClosed:
+		b.window.add(now, failed, slow)
+		if failed {
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		if b.shouldTrip(now) {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		b.probes--
+		if failed || slow {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.opts.halfOpenProbes {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+func (b *Breaker) shouldTrip(now time.Time) bool {
+	if b.opts.consecutiveFailures > 0 && b.consecutive >= b.opts.consecutiveFailures {
+		return true
+	}
+
+	c := b.window.sum(now)
+	if c.requests == 0 || c.requests < b.opts.minRequests {
+		return false
+	}
+	if b.opts.errorRatio > 0 && float64(c.failures)/float64(c.requests) >= b.opts.errorRatio {
+		return true
+	}
+	if b.opts.slowRatio > 0 && float64(c.slow)/float64(c.requests) >= b.opts.slowRatio {
+		return true
+	}
+	return false
+}
+
+func (b *Breaker) currentState(now time.Time) State {
+	if b.state == StateOpen && !now.Before(b.expiry) {
+		b.setState(StateHalfOpen, now)
+	}
+	return b.state
+}
+
+// 状态切换时清空统计，回调在持有锁时同步执行，回调中不要再调用该熔断器
+func (b *Breaker) setState(state State, now time.Time) {
+	if b.state == state {
+		return
+	}
+	prev := b.state
+	b.state = state
+	b.generation++
+	b.window.reset()
+	b.consecutive = 0
+	b.probes = 0
+	b.successes = 0
+	if state == StateOpen {
+		b.expiry = now.Add(b.opts.openTimeout)
+	}
+
+	if b.opts.onStateChange != nil {
+		b.opts.onStateChange(b.name, prev, state)
+	}
+}
+
+// Group 按名称管理一组共享配置的熔断器
+type Group struct {
+	opts []Option
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewGroup(opts ...Option) *Group {
+	return &Group{
+		opts:     opts,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get 获取名称对应的熔断器，不存在时创建
+func (g *Group) Get(name string) *Breaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b, ok := g.breakers[name]
+	if !ok {
+		b = New(name, g.opts...)
+		g.breakers[name] = b
+	}
+	return b
+}
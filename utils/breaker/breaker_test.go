@@ -0,0 +1,304 @@
+package breaker
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errTest = errors.New("this is error")
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestBreaker(clock *fakeClock, opts ...Option) *Breaker {
+	b := New("test", opts...)
+	b.opts.clock = clock.Now
+	return b
+}
+
+func fail() error    { return errTest }
+func succeed() error { return nil }
+
+func TestConsecutiveFailures(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	var changes []State
+	b := newTestBreaker(clock,
+		WithConsecutiveFailures(3),
+		WithErrorRatio(0),
+		WithOnStateChange(func(name string, from, to State) {
+			changes = append(changes, to)
+		}),
+	)
+
+	for i := 0; i < 2; i++ {
+		b.Do(fail)
+	}
+	b.Do(succeed)
+	if b.State() != StateClosed {
+		t.Fatalf("success should reset the counter, got %s", b.State())
+	}
+	for i := 0; i < 3; i++ {
+		b.Do(fail)
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("want open, got %s", b.State())
+	}
+	if err := b.Do(succeed); err != ErrOpenState {
+		t.Fatalf("want ErrOpenState, got %v", err)
+	}
+	if len(changes) != 1 || changes[0] != StateOpen {
+		t.Errorf("unexpected state changes: %v", changes)
+	}
+}
+
+func TestErrorRatio(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := newTestBreaker(clock,
+		WithConsecutiveFailures(0),
+		WithErrorRatio(0.5),
+		WithMinRequests(4),
+		WithWindow(10*time.Second, 10),
+	)
+
+	b.Do(fail)
+	b.Do(succeed)
+	b.Do(fail)
+	if b.State() != StateClosed {
+		t.Fatal("should not trip below min requests")
+	}
+	b.Do(succeed)
+	if b.State() != StateOpen {
+		t.Fatalf("want open at 50%% errors, got %s", b.State())
+	}
+}
+
+func TestErrorRatioWindowExpire(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := newTestBreaker(clock,
+		WithConsecutiveFailures(0),
+		WithErrorRatio(0.5),
+		WithMinRequests(4),
+		WithWindow(10*time.Second, 10),
+	)
+
+	for i := 0; i < 3; i++ {
+		b.Do(fail)
+	}
+	// 旧的失败滑出窗口
+	clock.Add(11 * time.Second)
+	for i := 0; i < 4; i++ {
+		b.Do(succeed)
+	}
+	b.Do(fail)
+	if b.State() != StateClosed {
+		t.Fatalf("expired failures should not count, got %s", b.State())
+	}
+}
+
+func TestSlowCallRatio(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := newTestBreaker(clock,
+		WithConsecutiveFailures(0),
+		WithErrorRatio(0),
+		WithMinRequests(2),
+		WithSlowCallRatio(100*time.Millisecond, 1),
+	)
+
+	slow := func() error {
+		clock.Add(200 * time.Millisecond)
+		return nil
+	}
+	b.Do(slow)
+	b.Do(slow)
+	if b.State() != StateOpen {
+		t.Fatalf("want open after slow calls, got %s", b.State())
+	}
+}
+
+func TestHalfOpenProbe(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := newTestBreaker(clock,
+		WithConsecutiveFailures(1),
+		WithOpenTimeout(time.Second),
+		WithHalfOpenProbes(2),
+	)
+
+	b.Do(fail)
+	clock.Add(time.Second)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("want half-open, got %s", b.State())
+	}
+
+	done1, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done2, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Allow(); err != ErrTooManyRequests {
+		t.Fatalf("want ErrTooManyRequests, got %v", err)
+	}
+	done1(nil)
+	if b.State() != StateHalfOpen {
+		t.Fatal("one probe should not close the breaker")
+	}
+	done2(nil)
+	if b.State() != StateClosed {
+		t.Fatalf("want closed, got %s", b.State())
+	}
+
+	// 半开时探测失败重新打开
+	b.Do(fail)
+	clock.Add(time.Second)
+	b.Do(fail)
+	if b.State() != StateOpen {
+		t.Fatalf("want open, got %s", b.State())
+	}
+}
+
+func TestStaleGeneration(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := newTestBreaker(clock, WithConsecutiveFailures(1), WithOpenTimeout(time.Second))
+
+	done, _ := b.Allow()
+	b.Do(fail)
+	clock.Add(time.Second)
+	// 打开前发起的请求结果不影响半开状态
+	done(nil)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("want half-open, got %s", b.State())
+	}
+}
+
+func TestExecuteWithFallback(t *testing.T) {
+	b := New("fallback", WithConsecutiveFailures(1))
+
+	v, err := Execute(b, func() (int, error) { return 1, nil })
+	if err != nil || v != 1 {
+		t.Fatalf("got %d, %v", v, err)
+	}
+
+	v, err = ExecuteWithFallback(b, func() (int, error) {
+		return 0, errTest
+	}, func(err error) (int, error) {
+		return -1, nil
+	})
+	if err != nil || v != -1 {
+		t.Fatalf("fallback not used: %d, %v", v, err)
+	}
+
+	var got error
+	ExecuteWithFallback(b, func() (int, error) {
+		return 1, nil
+	}, func(err error) (int, error) {
+		got = err
+		return 0, nil
+	})
+	if got != ErrOpenState {
+		t.Fatalf("want ErrOpenState in fallback, got %v", got)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: NewTransport(NewGroup(WithConsecutiveFailures(2)), nil),
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrOpenState) {
+		t.Fatalf("want ErrOpenState, got %v", err)
+	}
+
+	// 熔断时也要关闭请求的 Body
+	body := &closeRecorder{Reader: strings.NewReader("data")}
+	req, _ := http.NewRequest(http.MethodPost, server.URL, body)
+	if _, err := client.Transport.RoundTrip(req); !errors.Is(err, ErrOpenState) {
+		t.Fatalf("want ErrOpenState, got %v", err)
+	}
+	if !body.closed {
+		t.Fatal("request body not closed")
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware(NewGroup(WithConsecutiveFailures(1)), nil))
+	router.GET("/ping", func(ctx *gin.Context) {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+	})
+
+	codes := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		codes = append(codes, w.Code)
+	}
+	if codes[0] != http.StatusInternalServerError || codes[1] != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status codes: %v", codes)
+	}
+}
+
+func TestGinMiddlewareFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware(NewGroup(WithConsecutiveFailures(1)), func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "fallback")
+	}))
+	calls := 0
+	router.GET("/ping", func(ctx *gin.Context) {
+		calls++
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+	})
+
+	for i := 0; i < 2; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	}
+	if calls != 1 {
+		t.Fatalf("handler called %d times after fallback", calls)
+	}
+}
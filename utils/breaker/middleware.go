@@ -0,0 +1,39 @@
+package breaker
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GinMiddleware 按路由熔断，handler 返回 5xx 记为失败
+// fallback 为空时熔断返回 503，fallback 执行后不再执行后续的 handler
+func GinMiddleware(group *Group, fallback func(ctx *gin.Context)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		done, err := group.Get(ctx.FullPath()).Allow()
+		if err != nil {
+			if fallback != nil {
+				fallback(ctx)
+				ctx.Abort()
+			} else {
+				ctx.AbortWithStatus(http.StatusServiceUnavailable)
+			}
+			return
+		}
+
+		defer func() {
+			if e := recover(); e != nil {
+				done(errPanic)
+				panic(e)
+			}
+		}()
+
+		ctx.Next()
+
+		if ctx.Writer.Status() >= http.StatusInternalServerError {
+			done(ErrServerError)
+			return
+		}
+		done(nil)
+	}
+}
@@ -0,0 +1,121 @@
+package breaker
+
+import "time"
+
+const (
+	defaultWindow              = 10 * time.Second
+	defaultBuckets             = 10
+	defaultOpenTimeout         = 5 * time.Second
+	defaultHalfOpenProbes      = 1
+	defaultMinRequests         = 10
+	defaultConsecutiveFailures = 5
+	defaultErrorRatio          = 0.5
+)
+
+type (
+	Option  func(*options)
+	options struct {
+		window              time.Duration // 滚动统计窗口长度
+		buckets             int           // 窗口切分的桶数
+		openTimeout         time.Duration // 熔断后多久进入半开状态
+		halfOpenProbes      int           // 半开状态下允许的探测请求数
+		minRequests         uint64        // 按比例熔断时窗口内的最少请求数
+		consecutiveFailures uint64        // 连续失败多少次熔断，0 表示不启用
+		errorRatio          float64       // 错误比例阈值，0 表示不启用
+		slowThreshold       time.Duration // 超过该耗时记为慢调用
+		slowRatio           float64       // 慢调用比例阈值，0 表示不启用
+		isFailure           func(error) bool
+		onStateChange       func(name string, from, to State)
+		clock               func() time.Time
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		window:              defaultWindow,
+		buckets:             defaultBuckets,
+		openTimeout:         defaultOpenTimeout,
+		halfOpenProbes:      defaultHalfOpenProbes,
+		minRequests:         defaultMinRequests,
+		consecutiveFailures: defaultConsecutiveFailures,
+		errorRatio:          defaultErrorRatio,
+		isFailure:           func(err error) bool { return err != nil },
+		clock:               time.Now,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.buckets <= 0 {
+		optCopy.buckets = 1
+	}
+	if optCopy.halfOpenProbes <= 0 {
+		optCopy.halfOpenProbes = 1
+	}
+	return optCopy
+}
+
+// WithWindow sets the rolling window length and how many buckets it is split into.
+func WithWindow(window time.Duration, buckets int) Option {
+	return func(opts *options) {
+		opts.window = window
+		opts.buckets = buckets
+	}
+}
+
+// WithOpenTimeout sets how long the breaker stays open before probing.
+func WithOpenTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.openTimeout = timeout
+	}
+}
+
+// WithHalfOpenProbes sets how many probe calls are let through while half-open,
+// all of them must succeed to close the breaker again.
+func WithHalfOpenProbes(n int) Option {
+	return func(opts *options) {
+		opts.halfOpenProbes = n
+	}
+}
+
+// WithMinRequests sets the minimum calls in the window before ratios are checked.
+func WithMinRequests(n uint64) Option {
+	return func(opts *options) {
+		opts.minRequests = n
+	}
+}
+
+// WithConsecutiveFailures trips the breaker after n failures in a row, 0 disables it.
+func WithConsecutiveFailures(n uint64) Option {
+	return func(opts *options) {
+		opts.consecutiveFailures = n
+	}
+}
+
+// WithErrorRatio trips the breaker when the error ratio in the window reaches ratio, 0 disables it.
+func WithErrorRatio(ratio float64) Option {
+	return func(opts *options) {
+		opts.errorRatio = ratio
+	}
+}
+
+// WithSlowCallRatio trips the breaker when calls slower than threshold reach ratio in the window.
+func WithSlowCallRatio(threshold time.Duration, ratio float64) Option {
+	return func(opts *options) {
+		opts.slowThreshold = threshold
+		opts.slowRatio = ratio
+	}
+}
+
+// WithIsFailure decides which errors count as failures, e.g. ignore context.Canceled.
+func WithIsFailure(fn func(err error) bool) Option {
+	return func(opts *options) {
+		opts.isFailure = fn
+	}
+}
+
+// WithOnStateChange sets the callback fired on every state transition.
+func WithOnStateChange(fn func(name string, from, to State)) Option {
+	return func(opts *options) {
+		opts.onStateChange = fn
+	}
+}
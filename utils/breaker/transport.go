@@ -0,0 +1,48 @@
+package breaker
+
+import (
+	"errors"
+	"net/http"
+)
+
+var ErrServerError = errors.New("circuit breaker: server responded 5xx")
+
+// Transport 为 http.Client 提供按 Host 熔断的能力，响应 5xx 记为失败
+type Transport struct {
+	Group *Group
+	Base  http.RoundTripper
+}
+
+func NewTransport(group *Group, base http.RoundTripper) *Transport {
+	return &Transport{
+		Group: group,
+		Base:  base,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	done, err := t.Group.Get(req.URL.Host).Allow()
+	if err != nil {
+		// RoundTripper 即使出错也要关闭请求的 Body
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := base.RoundTrip(req)
+	switch {
+	case err != nil:
+		done(err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		done(ErrServerError)
+	default:
+		done(nil)
+	}
+	return resp, err
+}
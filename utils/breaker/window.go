@@ -0,0 +1,68 @@
+package breaker
+
+import "time"
+
+// 窗口内的调用统计
+type counts struct {
+	requests uint64
+	failures uint64
+	slow     uint64
+}
+
+type bucket struct {
+	counts
+	index int64 // 桶对应的时间片编号
+}
+
+// 滑动窗口，按时间片切成多个桶，过期的桶在写入时被复用
+type window struct {
+	span    int64 // 每个桶的时长(ns)
+	buckets []bucket
+}
+
+func newWindow(size time.Duration, n int) *window {
+	span := int64(size) / int64(n)
+	if span <= 0 {
+		span = 1
+	}
+	return &window{
+		span:    span,
+		buckets: make([]bucket, n),
+	}
+}
+
+func (w *window) add(now time.Time, failed, slow bool) {
+	idx := now.UnixNano() / w.span
+	b := &w.buckets[idx%int64(len(w.buckets))]
+	if b.index != idx {
+		b.index = idx
+		b.counts = counts{}
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	if slow {
+		b.slow++
+	}
+}
+
+func (w *window) sum(now time.Time) counts {
+	var c counts
+	idx := now.UnixNano() / w.span
+	for _, b := range w.buckets {
+		if idx-b.index >= int64(len(w.buckets)) {
+			continue
+		}
+		c.requests += b.requests
+		c.failures += b.failures
+		c.slow += b.slow
+	}
+	return c
+}
+
+func (w *window) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
@@ -20,6 +20,7 @@ const (
 
 var (
 	ErrKeyLength = errors.New("the key length is illegal")
+	ErrIVLength  = errors.New("the iv is shorter than the block size")
 )
 
 func AesEncryptWithSalt(plaintext, key []byte, iterCount int, magic string, h func() hash.Hash) (dst []byte, err error) {
@@ -32,12 +33,17 @@ func AesEncryptWithSalt(plaintext, key []byte, iterCount int, magic string, h fu
 	}
 
 	salt := make([]byte, Pkcs5SaltLength)
-	_, err = rand.Read(salt)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
 
 	var sKey = pbkdf2.Key(key, salt, iterCount, len(key), h)
 	var sIV = pbkdf2.Key(sKey, salt, iterCount, EvpMaxIvLength, h)
 
-	dst, err = AesCbcDecrypt(plaintext, sKey, sIV)
+	dst, err = AesCbcEncrypt(plaintext, sKey, sIV)
+	if err != nil {
+		return nil, err
+	}
 
 	dst = append(salt, dst...)
 	dst = append([]byte(magic), dst...)
@@ -72,6 +78,9 @@ func AesCbcEncrypt(plaintext, key, iv []byte) ([]byte, error) {
 		return nil, err
 	}
 	var blockSize = block.BlockSize()
+	if len(iv) < blockSize {
+		return nil, ErrIVLength
+	}
 	iv = iv[:blockSize]
 
 	var src = PKCS7Padding(plaintext, blockSize)
@@ -88,6 +97,9 @@ func AesCbcDecrypt(cipherText, key, iv []byte) ([]byte, error) {
 		return nil, err
 	}
 	var blockSize = block.BlockSize()
+	if len(iv) < blockSize {
+		return nil, ErrIVLength
+	}
 	iv = iv[:blockSize]
 
 	var dst = make([]byte, len(cipherText))
@@ -105,6 +117,9 @@ func AesCfbEncrypt(plaintext, key, iv []byte) ([]byte, error) {
 		return nil, err
 	}
 	var blockSize = block.BlockSize()
+	if len(iv) < blockSize {
+		return nil, ErrIVLength
+	}
 	iv = iv[:blockSize]
 
 	var dst = make([]byte, len(plaintext))
@@ -120,6 +135,9 @@ func AesCfbDecrypt(cipherText, key, iv []byte) ([]byte, error) {
 		return nil, err
 	}
 	var blockSize = block.BlockSize()
+	if len(iv) < blockSize {
+		return nil, ErrIVLength
+	}
 	iv = iv[:blockSize]
 
 	var dst = make([]byte, len(cipherText))
@@ -7,20 +7,64 @@ import (
 
 var plaintext = "Hello pibigstar"
 var key = "11111111111111111111111111111111"
-var iv = "123456789"
+var iv = "1234567890123456"
 
 func TestAesCbc(t *testing.T) {
-	var r, _ = AesCbcEncrypt([]byte(plaintext), []byte(key), []byte(iv))
+	r, err := AesCbcEncrypt([]byte(plaintext), []byte(key), []byte(iv))
+	if err != nil {
+		t.Fatal(err)
+	}
 	t.Log("AES CBC Encrypt: ", hex.EncodeToString(r))
 
-	r, _ = AesCbcDecrypt(r, []byte(key), []byte(iv))
-	t.Log("AES CBC Decrypt: ", string(r))
+	r, err = AesCbcDecrypt(r, []byte(key), []byte(iv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r) != plaintext {
+		t.Errorf("want %s, got %s", plaintext, r)
+	}
 }
 
 func TestAesCfb(t *testing.T) {
-	encryptStr, _ := AesCfbEncrypt([]byte(plaintext), []byte(key), []byte(iv))
+	encryptStr, err := AesCfbEncrypt([]byte(plaintext), []byte(key), []byte(iv))
+	if err != nil {
+		t.Fatal(err)
+	}
 	t.Log("AES CFB Encrypt: ", hex.EncodeToString(encryptStr))
 
-	decryptStr, _ := AesCfbDecrypt(encryptStr, []byte(key), []byte(iv))
-	t.Log("AES CFB Decrypt: ", string(decryptStr))
+	decryptStr, err := AesCfbDecrypt(encryptStr, []byte(key), []byte(iv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decryptStr) != plaintext {
+		t.Errorf("want %s, got %s", plaintext, decryptStr)
+	}
+}
+
+func TestAesShortIV(t *testing.T) {
+	short := []byte("123456789")
+	if _, err := AesCbcEncrypt([]byte(plaintext), []byte(key), short); err != ErrIVLength {
+		t.Errorf("cbc: %v", err)
+	}
+	if _, err := AesCfbEncrypt([]byte(plaintext), []byte(key), short); err != ErrIVLength {
+		t.Errorf("cfb encrypt: %v", err)
+	}
+	if _, err := AesCfbDecrypt([]byte(plaintext), []byte(key), short); err != ErrIVLength {
+		t.Errorf("cfb decrypt: %v", err)
+	}
+}
+
+func TestAesWithSalt(t *testing.T) {
+	encrypted, err := AesEncryptWithSalt([]byte(plaintext), []byte(key), 0, Pkcs5DefaultMagic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := AesDecryptWithSalt(encrypted, []byte(key), 0, Pkcs5DefaultMagic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != plaintext {
+		t.Errorf("want %s, got %s", plaintext, decrypted)
+	}
 }
@@ -0,0 +1,349 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+/**
+带认证的加密信封，格式(大端序)：
+	version(1) | mode(1) | algorithm(1) | kdf(1) | [kdf params] | keyIDLen(1) | keyID | [chunkSize(4)] | nonce
+之后单次加密为 ciphertext+tag，流式加密为若干个独立认证的分块。
+整个信封头作为附加数据参与认证，篡改任何字段都会导致解密失败。
+*/
+
+const EnvelopeVersion = 1
+
+// 认证加密算法
+type Algorithm byte
+
+const (
+	AlgAESGCM           Algorithm = 1
+	AlgChaCha20Poly1305 Algorithm = 2
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case AlgAESGCM:
+		return "AES-GCM"
+	case AlgChaCha20Poly1305:
+		return "ChaCha20-Poly1305"
+	}
+	return "unknown"
+}
+
+const (
+	modeSingle byte = 1
+	modeStream byte = 2
+
+	maxKeyIDLength = 255
+)
+
+var (
+	ErrInvalidEnvelope      = errors.New("invalid envelope")
+	ErrUnsupportedVersion   = errors.New("unsupported envelope version")
+	ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+	ErrDecrypt              = errors.New("message authentication failed")
+)
+
+// Envelope 解析后的信封
+type Envelope struct {
+	Version    byte
+	Algorithm  Algorithm
+	KeyID      string
+	KDF        *KDFParams // 使用口令加密时不为空
+	Nonce      []byte
+	ChunkSize  uint32 // 仅流式加密
+	Ciphertext []byte // 仅单次加密，包含 tag
+
+	mode   byte
+	header []byte
+}
+
+// KeyLookup 根据信封头(密钥ID、派生参数)返回解密密钥
+type KeyLookup func(e *Envelope) ([]byte, error)
+
+// StaticKey 固定使用 key 解密
+func StaticKey(key []byte) KeyLookup {
+	return func(e *Envelope) ([]byte, error) {
+		return key, nil
+	}
+}
+
+// PasswordKey 使用信封头中的派生参数从口令计算密钥
+func PasswordKey(password []byte) KeyLookup {
+	return func(e *Envelope) ([]byte, error) {
+		if e.KDF == nil {
+			return nil, ErrKDFParams
+		}
+		return e.KDF.DeriveKey(password)
+	}
+}
+
+func newAEAD(alg Algorithm, key []byte) (cipher.AEAD, error) {
+	switch alg {
+	case AlgAESGCM:
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return nil, ErrKeyLength
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AlgChaCha20Poly1305:
+		if len(key) != chacha20poly1305.KeySize {
+			return nil, ErrKeyLength
+		}
+		return chacha20poly1305.New(key)
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// SealEnvelope 使用 key 加密 plaintext，keyID 写入信封用于解密时选择密钥
+func SealEnvelope(alg Algorithm, key []byte, keyID string, plaintext, aad []byte) ([]byte, error) {
+	return sealEnvelope(alg, key, keyID, nil, plaintext, aad)
+}
+
+// SealEnvelopeWithPassword 使用口令派生的密钥加密，派生参数写入信封
+func SealEnvelopeWithPassword(alg Algorithm, password []byte, params KDFParams, plaintext, aad []byte) ([]byte, error) {
+	params.Salt = nil
+	key, err := params.DeriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+	return sealEnvelope(alg, key, "", &params, plaintext, aad)
+}
+
+func sealEnvelope(alg Algorithm, key []byte, keyID string, params *KDFParams, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(alg, key)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newEnvelope(modeSingle, alg, keyID, params, aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	header := e.marshalHeader()
+	dst := make([]byte, len(header), len(header)+len(plaintext)+aead.Overhead())
+	copy(dst, header)
+	return aead.Seal(dst, e.Nonce, plaintext, additionalData(header, aad)), nil
+}
+
+func newEnvelope(mode byte, alg Algorithm, keyID string, params *KDFParams, nonceSize int) (*Envelope, error) {
+	if len(keyID) > maxKeyIDLength {
+		return nil, ErrInvalidEnvelope
+	}
+	e := &Envelope{
+		Version:   EnvelopeVersion,
+		Algorithm: alg,
+		KeyID:     keyID,
+		KDF:       params,
+		Nonce:     make([]byte, nonceSize),
+		mode:      mode,
+	}
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ParseEnvelope 解析单次加密的信封，不做解密
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	r := &recordReader{r: bytes.NewReader(data)}
+	e, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode != modeSingle {
+		return nil, ErrInvalidEnvelope
+	}
+	e.Ciphertext = data[len(e.header):]
+	return e, nil
+}
+
+// OpenEnvelope 使用 key 解密 SealEnvelope 生成的信封
+func OpenEnvelope(data, key, aad []byte) ([]byte, error) {
+	return OpenEnvelopeFunc(data, aad, StaticKey(key))
+}
+
+// OpenEnvelopeWithPassword 使用口令解密 SealEnvelopeWithPassword 生成的信封
+func OpenEnvelopeWithPassword(data, password, aad []byte) ([]byte, error) {
+	return OpenEnvelopeFunc(data, aad, PasswordKey(password))
+}
+
+// OpenEnvelopeFunc 解析信封后通过 lookup 获取密钥并解密
+func OpenEnvelopeFunc(data, aad []byte, lookup KeyLookup) ([]byte, error) {
+	e, err := ParseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := lookup(e)
+	if err != nil {
+		return nil, err
+	}
+	return e.Open(key, aad)
+}
+
+func (e *Envelope) Open(key, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(e.Algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, additionalData(e.header, aad))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func additionalData(header, aad []byte) []byte {
+	if len(aad) == 0 {
+		return header
+	}
+	data := make([]byte, 0, len(header)+len(aad))
+	data = append(data, header...)
+	return append(data, aad...)
+}
+
+func (e *Envelope) marshalHeader() []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{e.Version, e.mode, byte(e.Algorithm)})
+
+	if e.KDF == nil {
+		buf.WriteByte(byte(KDFNone))
+	} else {
+		p := e.KDF
+		buf.WriteByte(byte(p.KDF))
+		switch p.KDF {
+		case KDFArgon2id:
+			binary.Write(&buf, binary.BigEndian, p.Time)
+			binary.Write(&buf, binary.BigEndian, p.Memory)
+			buf.WriteByte(p.Threads)
+		case KDFScrypt:
+			buf.WriteByte(p.LogN)
+			binary.Write(&buf, binary.BigEndian, p.R)
+			binary.Write(&buf, binary.BigEndian, p.P)
+		}
+		buf.WriteByte(byte(len(p.Salt)))
+		buf.Write(p.Salt)
+	}
+
+	buf.WriteByte(byte(len(e.KeyID)))
+	buf.WriteString(e.KeyID)
+	if e.mode == modeStream {
+		binary.Write(&buf, binary.BigEndian, e.ChunkSize)
+	}
+	buf.Write(e.Nonce)
+
+	e.header = buf.Bytes()
+	return e.header
+}
+
+func readHeader(r *recordReader) (*Envelope, error) {
+	fixed, err := r.next(4)
+	if err != nil {
+		return nil, err
+	}
+	e := &Envelope{
+		Version:   fixed[0],
+		mode:      fixed[1],
+		Algorithm: Algorithm(fixed[2]),
+	}
+	if e.Version != EnvelopeVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	if e.mode != modeSingle && e.mode != modeStream {
+		return nil, ErrInvalidEnvelope
+	}
+
+	if kdf := KDF(fixed[3]); kdf != KDFNone {
+		p := &KDFParams{KDF: kdf}
+		switch kdf {
+		case KDFArgon2id:
+			b, err := r.next(9)
+			if err != nil {
+				return nil, err
+			}
+			p.Time = binary.BigEndian.Uint32(b)
+			p.Memory = binary.BigEndian.Uint32(b[4:])
+			p.Threads = b[8]
+		case KDFScrypt:
+			b, err := r.next(9)
+			if err != nil {
+				return nil, err
+			}
+			p.LogN = b[0]
+			p.R = binary.BigEndian.Uint32(b[1:])
+			p.P = binary.BigEndian.Uint32(b[5:])
+		default:
+			return nil, ErrKDFParams
+		}
+		if p.Salt, err = r.nextWithLength(); err != nil {
+			return nil, err
+		}
+		if err = p.validate(true); err != nil {
+			return nil, err
+		}
+		e.KDF = p
+	}
+
+	keyID, err := r.nextWithLength()
+	if err != nil {
+		return nil, err
+	}
+	e.KeyID = string(keyID)
+
+	nonceSize := 12
+	if e.Algorithm != AlgAESGCM && e.Algorithm != AlgChaCha20Poly1305 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if e.mode == modeStream {
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		e.ChunkSize = binary.BigEndian.Uint32(b)
+		if e.ChunkSize == 0 || e.ChunkSize > maxChunkSize {
+			return nil, ErrInvalidEnvelope
+		}
+		nonceSize -= streamNonceSuffix
+	}
+	if e.Nonce, err = r.next(nonceSize); err != nil {
+		return nil, err
+	}
+
+	e.header = r.buf.Bytes()
+	return e, nil
+}
+
+// 读取信封头，同时记录读过的原始字节作为附加数据
+type recordReader struct {
+	r   io.Reader
+	buf bytes.Buffer
+}
+
+func (r *recordReader) next(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, ErrInvalidEnvelope
+	}
+	r.buf.Write(b)
+	return b, nil
+}
+
+func (r *recordReader) nextWithLength() ([]byte, error) {
+	n, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	return r.next(int(n[0]))
+}
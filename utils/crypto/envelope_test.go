@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+var envelopeKey = []byte("01234567890123456789012345678901")
+
+// 测试用的低强度参数，加快测试速度
+var (
+	testArgon2id = KDFParams{KDF: KDFArgon2id, Time: 1, Memory: 8 * 1024, Threads: 1}
+	testScrypt   = KDFParams{KDF: KDFScrypt, LogN: 10, R: 8, P: 1}
+)
+
+func TestEnvelope(t *testing.T) {
+	for _, alg := range []Algorithm{AlgAESGCM, AlgChaCha20Poly1305} {
+		data, err := SealEnvelope(alg, envelopeKey, "key-1", []byte(plaintext), []byte("user:1"))
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+
+		e, err := ParseEnvelope(data)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if e.Algorithm != alg || e.KeyID != "key-1" || e.Version != EnvelopeVersion {
+			t.Errorf("%s: unexpected envelope %+v", alg, e)
+		}
+
+		decrypted, err := OpenEnvelope(data, envelopeKey, []byte("user:1"))
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if string(decrypted) != plaintext {
+			t.Errorf("%s: want %s, got %s", alg, plaintext, decrypted)
+		}
+
+		if _, err = OpenEnvelope(data, envelopeKey, []byte("user:2")); err != ErrDecrypt {
+			t.Errorf("%s: aad mismatch should fail, got %v", alg, err)
+		}
+	}
+}
+
+func TestEnvelopeTamper(t *testing.T) {
+	data, err := SealEnvelope(AlgAESGCM, envelopeKey, "key-1", []byte(plaintext), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改 keyID 中的一个字节
+	tampered := append([]byte(nil), data...)
+	tampered[5] ^= 1
+	if _, err = OpenEnvelope(tampered, envelopeKey, nil); err != ErrDecrypt {
+		t.Errorf("tampered header should fail, got %v", err)
+	}
+
+	tampered = append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err = OpenEnvelope(tampered, envelopeKey, nil); err != ErrDecrypt {
+		t.Errorf("tampered tag should fail, got %v", err)
+	}
+
+	tampered = append([]byte(nil), data...)
+	tampered[0] = 9
+	if _, err = OpenEnvelope(tampered, envelopeKey, nil); err != ErrUnsupportedVersion {
+		t.Errorf("want ErrUnsupportedVersion, got %v", err)
+	}
+
+	if _, err = OpenEnvelope(data[:3], envelopeKey, nil); err != ErrInvalidEnvelope {
+		t.Errorf("want ErrInvalidEnvelope, got %v", err)
+	}
+}
+
+func TestEnvelopeWithPassword(t *testing.T) {
+	for _, params := range []KDFParams{testArgon2id, testScrypt} {
+		data, err := SealEnvelopeWithPassword(AlgChaCha20Poly1305, []byte("pibigstar"), params, []byte(plaintext), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := OpenEnvelopeWithPassword(data, []byte("pibigstar"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decrypted) != plaintext {
+			t.Errorf("want %s, got %s", plaintext, decrypted)
+		}
+		if _, err = OpenEnvelopeWithPassword(data, []byte("wrong"), nil); err != ErrDecrypt {
+			t.Errorf("wrong password should fail, got %v", err)
+		}
+	}
+}
+
+func encryptStream(t *testing.T, plain []byte, chunkSize int) []byte {
+	var buf bytes.Buffer
+	w, err := newEncryptWriter(&buf, AlgAESGCM, envelopeKey, "key-1", nil, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 分多次写入
+	for i := 0; i < len(plain); i += 7 {
+		end := i + 7
+		if end > len(plain) {
+			end = len(plain)
+		}
+		if _, err = w.Write(plain[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStream(t *testing.T) {
+	const chunkSize = 16
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize, 100} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		r, err := NewDecryptReader(bytes.NewReader(encryptStream(t, plain, chunkSize)), envelopeKey)
+		if err != nil {
+			t.Fatal(size, err)
+		}
+		decrypted, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(size, err)
+		}
+		if !bytes.Equal(plain, decrypted) {
+			t.Errorf("size %d: plaintext mismatch", size)
+		}
+	}
+}
+
+func TestStreamTruncateAndReorder(t *testing.T) {
+	const chunkSize = 16
+	plain := make([]byte, 3*chunkSize)
+	rand.Read(plain)
+	data := encryptStream(t, plain, chunkSize)
+
+	readAll := func(data []byte) error {
+		r, err := NewDecryptReader(bytes.NewReader(data), envelopeKey)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(ioutil.Discard, r)
+		return err
+	}
+
+	e := &recordReader{r: bytes.NewReader(data)}
+	if _, err := readHeader(e); err != nil {
+		t.Fatal(err)
+	}
+	headerSize := e.buf.Len()
+	sealed := chunkSize + 16
+
+	// 在块边界截断
+	if err := readAll(data[:headerSize+2*sealed]); err != ErrDecrypt {
+		t.Errorf("truncated stream should fail, got %v", err)
+	}
+
+	// 交换前两块
+	swapped := append([]byte(nil), data...)
+	first := append([]byte(nil), swapped[headerSize:headerSize+sealed]...)
+	copy(swapped[headerSize:], swapped[headerSize+sealed:headerSize+2*sealed])
+	copy(swapped[headerSize+sealed:], first)
+	if err := readAll(swapped); err != ErrDecrypt {
+		t.Errorf("reordered stream should fail, got %v", err)
+	}
+
+	if err := readAll(data); err != nil {
+		t.Errorf("original stream should pass, got %v", err)
+	}
+}
+
+func TestStreamWithPassword(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewPasswordEncryptWriter(&buf, AlgChaCha20Poly1305, []byte("pibigstar"), testArgon2id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, plaintext)
+	w.Close()
+
+	r, err := NewDecryptReaderFunc(&buf, PasswordKey([]byte("pibigstar")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != plaintext {
+		t.Errorf("want %s, got %s", plaintext, decrypted)
+	}
+}
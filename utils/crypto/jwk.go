@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+var ErrJWK = errors.New("invalid jwk")
+
+// JWK RFC 7517 格式的密钥，支持 RSA、EC(P-256)、OKP(Ed25519)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+
+	// RSA
+	N  string `json:"n,omitempty"`
+	E  string `json:"e,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+
+	// EC、OKP 的公钥
+	X string `json:"x,omitempty"`
+	Y string `json:"y,omitempty"`
+
+	// 私钥部分，RSA 为私钥指数，EC 为标量，OKP 为种子
+	D string `json:"d,omitempty"`
+}
+
+// JWKSet JWKS 格式的密钥集合
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Find 根据 kid 查找密钥
+func (s *JWKSet) Find(kid string) (*JWK, bool) {
+	for i := range s.Keys {
+		if s.Keys[i].Kid == kid {
+			return &s.Keys[i], true
+		}
+	}
+	return nil, false
+}
+
+func ParseJWK(data []byte) (*JWK, error) {
+	var jwk JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, err
+	}
+	return &jwk, nil
+}
+
+// NewJWK 从公钥或私钥生成 JWK，alg 可为空
+func NewJWK(key interface{}, kid string, alg SignAlgorithm) (*JWK, error) {
+	jwk := &JWK{Kid: kid, Alg: string(alg)}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, ErrJWK
+		}
+		k.Precompute()
+		jwk.setRSAPublic(&k.PublicKey)
+		jwk.D = encodeBigInt(k.D)
+		jwk.P = encodeBigInt(k.Primes[0])
+		jwk.Q = encodeBigInt(k.Primes[1])
+		jwk.DP = encodeBigInt(k.Precomputed.Dp)
+		jwk.DQ = encodeBigInt(k.Precomputed.Dq)
+		jwk.QI = encodeBigInt(k.Precomputed.Qinv)
+	case *rsa.PublicKey:
+		jwk.setRSAPublic(k)
+	case *ecdsa.PrivateKey:
+		if err := jwk.setECPublic(&k.PublicKey); err != nil {
+			return nil, err
+		}
+		jwk.D = encodeFixed(k.D, 32)
+	case *ecdsa.PublicKey:
+		if err := jwk.setECPublic(k); err != nil {
+			return nil, err
+		}
+	case ed25519.PrivateKey:
+		jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.Public().(ed25519.PublicKey))
+		jwk.D = base64.RawURLEncoding.EncodeToString(k.Seed())
+	case ed25519.PublicKey:
+		jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return nil, ErrKeyType
+	}
+	return jwk, nil
+}
+
+func (j *JWK) setRSAPublic(key *rsa.PublicKey) {
+	j.Kty = "RSA"
+	j.N = encodeBigInt(key.N)
+	j.E = encodeBigInt(big.NewInt(int64(key.E)))
+}
+
+func (j *JWK) setECPublic(key *ecdsa.PublicKey) error {
+	if key.Curve != elliptic.P256() {
+		return ErrKeyType
+	}
+	j.Kty, j.Crv = "EC", "P-256"
+	j.X = encodeFixed(key.X, 32)
+	j.Y = encodeFixed(key.Y, 32)
+	return nil
+}
+
+// IsPrivate 是否包含私钥
+func (j *JWK) IsPrivate() bool {
+	return j.D != ""
+}
+
+// Public 返回去掉私钥部分的副本，用于发布到 JWKS
+func (j *JWK) Public() *JWK {
+	pub := *j
+	pub.D, pub.P, pub.Q, pub.DP, pub.DQ, pub.QI = "", "", "", "", "", ""
+	return &pub
+}
+
+func (j *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 || e.Int64() < 3 {
+			return nil, ErrJWK
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if j.Crv != "P-256" {
+			return nil, ErrKeyType
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, ErrJWK
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, ErrKeyType
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrJWK
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrKeyType
+}
+
+func (j *JWK) PrivateKey() (crypto.PrivateKey, error) {
+	if !j.IsPrivate() {
+		return nil, ErrPrivateKey
+	}
+	pub, err := j.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	d, err := base64.RawURLEncoding.DecodeString(j.D)
+	if err != nil {
+		return nil, ErrJWK
+	}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		p, err := decodeBigInt(j.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := decodeBigInt(j.Q)
+		if err != nil {
+			return nil, err
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: *pub,
+			D:         new(big.Int).SetBytes(d),
+			Primes:    []*big.Int{p, q},
+		}
+		if err = key.Validate(); err != nil {
+			return nil, err
+		}
+		key.Precompute()
+		return key, nil
+	case *ecdsa.PublicKey:
+		key := &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(d)}
+		x, y := pub.Curve.ScalarBaseMult(d)
+		if x.Cmp(pub.X) != 0 || y.Cmp(pub.Y) != 0 {
+			return nil, ErrJWK
+		}
+		return key, nil
+	case ed25519.PublicKey:
+		if len(d) != ed25519.SeedSize {
+			return nil, ErrJWK
+		}
+		key := ed25519.NewKeyFromSeed(d)
+		if !pub.Equal(key.Public()) {
+			return nil, ErrJWK
+		}
+		return key, nil
+	}
+	return nil, ErrKeyType
+}
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+// EC 坐标需要按曲线长度补齐前导零
+func encodeFixed(n *big.Int, size int) string {
+	return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, size)))
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, ErrJWK
+	}
+	return new(big.Int).SetBytes(b), nil
+}
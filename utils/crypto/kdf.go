@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// 口令派生密钥算法
+type KDF byte
+
+const (
+	KDFNone KDF = iota
+	KDFArgon2id
+	KDFScrypt
+)
+
+const (
+	kdfKeyLength  = 32
+	kdfSaltLength = 16
+
+	// 解析信封中的参数时的上限，防止构造的密文耗尽内存
+	maxArgon2Time    = 16
+	maxArgon2Memory  = 1 << 21 // 2GiB
+	maxScryptLogN    = 24
+	maxScryptRP      = 1 << 20
+	minKDFSaltLength = 8
+)
+
+var ErrKDFParams = errors.New("invalid key derivation params")
+
+// KDFParams 口令派生密钥的参数，会写入信封头用于解密
+type KDFParams struct {
+	KDF KDF
+
+	// argon2id
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+
+	// scrypt, N = 1 << LogN
+	LogN uint8
+	R    uint32
+	P    uint32
+
+	Salt []byte
+}
+
+// 参考 RFC 9106 第二推荐配置
+func DefaultArgon2id() KDFParams {
+	return KDFParams{
+		KDF:     KDFArgon2id,
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}
+}
+
+func DefaultScrypt() KDFParams {
+	return KDFParams{
+		KDF:  KDFScrypt,
+		LogN: 15,
+		R:    8,
+		P:    1,
+	}
+}
+
+// DeriveKey 使用口令派生 32 字节密钥，Salt 为空时随机生成并回填
+func (p *KDFParams) DeriveKey(password []byte) ([]byte, error) {
+	if err := p.validate(false); err != nil {
+		return nil, err
+	}
+	if len(p.Salt) == 0 {
+		p.Salt = make([]byte, kdfSaltLength)
+		if _, err := rand.Read(p.Salt); err != nil {
+			return nil, err
+		}
+	}
+
+	switch p.KDF {
+	case KDFArgon2id:
+		return argon2.IDKey(password, p.Salt, p.Time, p.Memory, p.Threads, kdfKeyLength), nil
+	case KDFScrypt:
+		return scrypt.Key(password, p.Salt, 1<<p.LogN, int(p.R), int(p.P), kdfKeyLength)
+	}
+	return nil, ErrKDFParams
+}
+
+func (p *KDFParams) validate(needSalt bool) error {
+	if needSalt && len(p.Salt) < minKDFSaltLength {
+		return ErrKDFParams
+	}
+	switch p.KDF {
+	case KDFArgon2id:
+		if p.Time == 0 || p.Time > maxArgon2Time || p.Memory == 0 || p.Memory > maxArgon2Memory || p.Threads == 0 {
+			return ErrKDFParams
+		}
+	case KDFScrypt:
+		if p.LogN <= 1 || p.LogN > maxScryptLogN || p.R == 0 || p.P == 0 || p.R > maxScryptRP || p.P > maxScryptRP {
+			return ErrKDFParams
+		}
+	default:
+		return ErrKDFParams
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/**
+密钥环：保存多个带版本号(keyID)的密钥，其中一个为当前使用的密钥。
+加密始终使用当前密钥，解密根据信封中的 keyID 选择密钥，
+轮换时先添加新密钥并设为当前密钥，再用 Rewrap 把旧密文重新加密，最后删除旧密钥。
+*/
+
+var (
+	ErrKeyNotFound  = errors.New("key not found in keyring")
+	ErrKeyExists    = errors.New("key already exists in keyring")
+	ErrNoActiveKey  = errors.New("keyring has no active key")
+	ErrRemoveActive = errors.New("can not remove the active key")
+	ErrKeyID        = errors.New("key id is illegal")
+)
+
+type Keyring struct {
+	alg Algorithm
+
+	mu     sync.RWMutex
+	keys   map[string][]byte
+	active string
+}
+
+func NewKeyring(alg Algorithm) *Keyring {
+	return &Keyring{
+		alg:  alg,
+		keys: make(map[string][]byte),
+	}
+}
+
+func (k *Keyring) Algorithm() Algorithm {
+	return k.alg
+}
+
+// Add 添加密钥，保存的是 key 的副本
+func (k *Keyring) Add(id string, key []byte) error {
+	if id == "" || len(id) > maxKeyIDLength {
+		return ErrKeyID
+	}
+	if _, err := newAEAD(k.alg, key); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; ok {
+		return ErrKeyExists
+	}
+	k.keys[id] = append([]byte(nil), key...)
+	if k.active == "" {
+		k.active = id
+	}
+	return nil
+}
+
+// Generate 随机生成 32 字节密钥并添加
+func (k *Keyring) Generate(id string) error {
+	key := make([]byte, 32)
+	defer wipe(key)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	return k.Add(id, key)
+}
+
+// SetActive 设置加密使用的密钥
+func (k *Keyring) SetActive(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return ErrKeyNotFound
+	}
+	k.active = id
+	return nil
+}
+
+func (k *Keyring) Active() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// IDs 返回所有密钥ID，按字典序排列
+func (k *Keyring) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Remove 删除密钥并清零内存中的密钥数据，不能删除当前密钥
+func (k *Keyring) Remove(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, ok := k.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if id == k.active {
+		return ErrRemoveActive
+	}
+	wipe(key)
+	delete(k.keys, id)
+	return nil
+}
+
+// Close 清零并删除所有密钥
+func (k *Keyring) Close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for id, key := range k.keys {
+		wipe(key)
+		delete(k.keys, id)
+	}
+	k.active = ""
+}
+
+// Encrypt 使用当前密钥加密
+func (k *Keyring) Encrypt(plaintext, aad []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.active == "" {
+		return nil, ErrNoActiveKey
+	}
+	return SealEnvelope(k.alg, k.keys[k.active], k.active, plaintext, aad)
+}
+
+// Decrypt 使用信封中 keyID 对应的密钥解密
+func (k *Keyring) Decrypt(data, aad []byte) ([]byte, error) {
+	e, err := ParseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[e.KeyID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return e.Open(key, aad)
+}
+
+// Rewrap 把旧密钥加密的数据用当前密钥重新加密，已是当前密钥时原样返回，changed 为 false
+func (k *Keyring) Rewrap(data, aad []byte) (rewrapped []byte, changed bool, err error) {
+	e, err := ParseEnvelope(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if e.KeyID == k.Active() {
+		return data, false, nil
+	}
+
+	plaintext, err := k.Decrypt(data, aad)
+	if err != nil {
+		return nil, false, err
+	}
+	defer wipe(plaintext)
+
+	rewrapped, err = k.Encrypt(plaintext, aad)
+	if err != nil {
+		return nil, false, err
+	}
+	return rewrapped, true, nil
+}
+
+// NewEncryptWriter 使用当前密钥流式加密
+func (k *Keyring) NewEncryptWriter(w io.Writer) (io.WriteCloser, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.active == "" {
+		return nil, ErrNoActiveKey
+	}
+	return NewEncryptWriter(w, k.alg, k.keys[k.active], k.active)
+}
+
+// NewDecryptReader 根据流中的 keyID 选择密钥解密
+func (k *Keyring) NewDecryptReader(r io.Reader) (io.Reader, error) {
+	var key []byte
+	defer func() { wipe(key) }()
+
+	return NewDecryptReaderFunc(r, func(e *Envelope) ([]byte, error) {
+		k.mu.RLock()
+		defer k.mu.RUnlock()
+		found, ok := k.keys[e.KeyID]
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+		// 返回副本，创建完 cipher 后清零
+		key = append([]byte(nil), found...)
+		return key, nil
+	})
+}
+
+// 尽力清除内存中的密钥，GC 移动前留下的副本无法保证清除
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// KeyringConfig 密钥环的 JSON 格式，key 使用标准 base64 编码
+//
+//	{"algorithm": "AES-GCM", "active": "v2", "keys": [{"id": "v1", "key": "..."}, {"id": "v2", "key": "..."}]}
+type KeyringConfig struct {
+	Algorithm string       `json:"algorithm"`
+	Active    string       `json:"active"`
+	Keys      []KeyringKey `json:"keys"`
+}
+
+type KeyringKey struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+}
+
+// ParseAlgorithm 解析算法名称，不区分大小写
+func ParseAlgorithm(name string) (Algorithm, error) {
+	for _, alg := range []Algorithm{AlgAESGCM, AlgChaCha20Poly1305} {
+		if strings.EqualFold(name, alg.String()) {
+			return alg, nil
+		}
+	}
+	return 0, ErrUnsupportedAlgorithm
+}
+
+// LoadKeyringJSON 从 JSON 加载密钥环，algorithm 为空时默认 AES-GCM，active 为空时使用第一个密钥
+func LoadKeyringJSON(data []byte) (*Keyring, error) {
+	var config KeyringConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	alg := AlgAESGCM
+	if config.Algorithm != "" {
+		var err error
+		if alg, err = ParseAlgorithm(config.Algorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	ring := NewKeyring(alg)
+	for _, k := range config.Keys {
+		if err := ring.addEncoded(k.ID, k.Key); err != nil {
+			ring.Close()
+			return nil, err
+		}
+	}
+	if config.Active != "" {
+		if err := ring.SetActive(config.Active); err != nil {
+			ring.Close()
+			return nil, err
+		}
+	}
+	if ring.Active() == "" {
+		return nil, ErrNoActiveKey
+	}
+	return ring, nil
+}
+
+// LoadKeyringFile 从 JSON 文件加载密钥环
+func LoadKeyringFile(path string) (*Keyring, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(data)
+	return LoadKeyringJSON(data)
+}
+
+// LoadKeyringEnv 从环境变量加载密钥环：
+//
+//	{prefix}_ALGORITHM=AES-GCM
+//	{prefix}_ACTIVE=v2
+//	{prefix}_KEY_v1=base64...
+//	{prefix}_KEY_v2=base64...
+func LoadKeyringEnv(prefix string) (*Keyring, error) {
+	config := KeyringConfig{
+		Algorithm: os.Getenv(prefix + "_ALGORITHM"),
+		Active:    os.Getenv(prefix + "_ACTIVE"),
+	}
+	keyPrefix := prefix + "_KEY_"
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, keyPrefix) {
+			continue
+		}
+		kv = strings.TrimPrefix(kv, keyPrefix)
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			continue
+		}
+		config.Keys = append(config.Keys, KeyringKey{ID: kv[:i], Key: kv[i+1:]})
+	}
+	// 环境变量顺序不固定，未指定 active 时不能默认取第一个
+	if config.Active == "" && len(config.Keys) > 1 {
+		return nil, ErrNoActiveKey
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(data)
+	return LoadKeyringJSON(data)
+}
+
+func (k *Keyring) addEncoded(id, encoded string) error {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	defer wipe(key)
+	return k.Add(id, key)
+}
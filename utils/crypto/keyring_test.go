@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyringRotate(t *testing.T) {
+	ring := NewKeyring(AlgAESGCM)
+	if err := ring.Generate("v1"); err != nil {
+		t.Fatal(err)
+	}
+	old, err := ring.Encrypt([]byte(plaintext), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮换到 v2
+	if err = ring.Generate("v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ring.SetActive("v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := ring.Decrypt(old, nil)
+	if err != nil || string(decrypted) != plaintext {
+		t.Fatalf("old ciphertext should still decrypt: %s, %v", decrypted, err)
+	}
+
+	rewrapped, changed, err := ring.Rewrap(old, nil)
+	if err != nil || !changed {
+		t.Fatalf("rewrap failed: %v, changed=%v", err, changed)
+	}
+	if e, _ := ParseEnvelope(rewrapped); e.KeyID != "v2" {
+		t.Errorf("rewrapped with %s, want v2", e.KeyID)
+	}
+	if _, changed, _ = ring.Rewrap(rewrapped, nil); changed {
+		t.Error("active ciphertext should not be rewrapped")
+	}
+
+	if err = ring.Remove("v2"); err != ErrRemoveActive {
+		t.Errorf("want ErrRemoveActive, got %v", err)
+	}
+	if err = ring.Remove("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ring.Decrypt(old, nil); err != ErrKeyNotFound {
+		t.Errorf("want ErrKeyNotFound, got %v", err)
+	}
+	if decrypted, err = ring.Decrypt(rewrapped, nil); err != nil || string(decrypted) != plaintext {
+		t.Errorf("rewrapped ciphertext should decrypt: %v", err)
+	}
+}
+
+func TestKeyringWipe(t *testing.T) {
+	ring := NewKeyring(AlgChaCha20Poly1305)
+	ring.Add("v1", envelopeKey)
+	ring.Add("v2", envelopeKey)
+
+	stored := ring.keys["v2"]
+	ring.Remove("v2")
+	if !bytes.Equal(stored, make([]byte, len(stored))) {
+		t.Error("removed key should be wiped")
+	}
+	if envelopeKey[0] == 0 {
+		t.Fatal("caller's key should not be wiped")
+	}
+
+	stored = ring.keys["v1"]
+	ring.Close()
+	if !bytes.Equal(stored, make([]byte, len(stored))) || ring.Active() != "" {
+		t.Error("close should wipe all keys")
+	}
+	if _, err := ring.Encrypt([]byte(plaintext), nil); err != ErrNoActiveKey {
+		t.Errorf("want ErrNoActiveKey, got %v", err)
+	}
+}
+
+func TestKeyringStream(t *testing.T) {
+	ring := NewKeyring(AlgAESGCM)
+	ring.Generate("v1")
+
+	var buf bytes.Buffer
+	w, err := ring.NewEncryptWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, plaintext)
+	w.Close()
+
+	ring.Generate("v2")
+	ring.SetActive("v2")
+	r, err := ring.NewDecryptReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, _ := ioutil.ReadAll(r)
+	if string(decrypted) != plaintext {
+		t.Errorf("want %s, got %s", plaintext, decrypted)
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(envelopeKey)
+	k2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	config := fmt.Sprintf(`{"algorithm": "chacha20-poly1305", "active": "v2", "keys": [{"id": "v1", "key": "%s"}, {"id": "v2", "key": "%s"}]}`, k1, k2)
+
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.json")
+	ioutil.WriteFile(path, []byte(config), 0600)
+
+	ring, err := LoadKeyringFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.Algorithm() != AlgChaCha20Poly1305 || ring.Active() != "v2" || len(ring.IDs()) != 2 {
+		t.Errorf("unexpected keyring: %s %s %v", ring.Algorithm(), ring.Active(), ring.IDs())
+	}
+
+	os.Setenv("TEST_KEYRING_ACTIVE", "v2")
+	os.Setenv("TEST_KEYRING_KEY_v1", k1)
+	os.Setenv("TEST_KEYRING_KEY_v2", k2)
+	defer func() {
+		os.Unsetenv("TEST_KEYRING_ACTIVE")
+		os.Unsetenv("TEST_KEYRING_KEY_v1")
+		os.Unsetenv("TEST_KEYRING_KEY_v2")
+	}()
+	envRing, err := LoadKeyringEnv("TEST_KEYRING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envRing.Algorithm() != AlgAESGCM || envRing.Active() != "v2" || len(envRing.IDs()) != 2 {
+		t.Errorf("unexpected keyring: %s %s %v", envRing.Algorithm(), envRing.Active(), envRing.IDs())
+	}
+
+	for name, data := range map[string]string{
+		"bad base64":    `{"keys": [{"id": "v1", "key": "!!"}]}`,
+		"bad length":    `{"keys": [{"id": "v1", "key": "AAAA"}]}`,
+		"no keys":       `{"keys": []}`,
+		"unknown alg":   `{"algorithm": "des", "keys": []}`,
+		"active absent": fmt.Sprintf(`{"active": "v9", "keys": [{"id": "v1", "key": "%s"}]}`, k1),
+	} {
+		if _, err = LoadKeyringJSON([]byte(data)); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+)
+
+// ParsePrivateKeyPEM 解析 PEM 格式的 RSA、ECDSA、Ed25519 私钥(PKCS#1、SEC1、PKCS#8)
+func ParsePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrPrivateKey
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return parsePKCS8(block.Bytes)
+	}
+	return nil, ErrPrivateKey
+}
+
+// ParsePublicKeyPEM 解析 PEM 格式的公钥(PKIX、PKCS#1)
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrPublicKey
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return parsePKIX(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return nil, ErrPublicKey
+}
+
+// ParsePrivateKeyAny 依次尝试 PEM、JWK JSON 以及不带头尾的 base64 DER
+func ParsePrivateKeyAny(data []byte) (crypto.PrivateKey, error) {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("-----BEGIN")):
+		return ParsePrivateKeyPEM(data)
+	case bytes.HasPrefix(data, []byte("{")):
+		jwk, err := ParseJWK(data)
+		if err != nil {
+			return nil, err
+		}
+		return jwk.PrivateKey()
+	}
+
+	der, err := decodeBareBase64(data)
+	if err != nil {
+		return nil, ErrPrivateKey
+	}
+	if key, err := parsePKCS8(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, ErrPrivateKey
+}
+
+// ParsePublicKeyAny 依次尝试 PEM、JWK JSON 以及不带头尾的 base64 DER
+func ParsePublicKeyAny(data []byte) (crypto.PublicKey, error) {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("-----BEGIN")):
+		return ParsePublicKeyPEM(data)
+	case bytes.HasPrefix(data, []byte("{")):
+		jwk, err := ParseJWK(data)
+		if err != nil {
+			return nil, err
+		}
+		return jwk.PublicKey()
+	}
+
+	der, err := decodeBareBase64(data)
+	if err != nil {
+		return nil, ErrPublicKey
+	}
+	if key, err := parsePKIX(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return key, nil
+	}
+	return nil, ErrPublicKey
+}
+
+// MarshalPrivateKeyPEM 以 PKCS#8 格式导出私钥
+func MarshalPrivateKeyPEM(key crypto.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// MarshalPublicKeyPEM 以 PKIX 格式导出公钥
+func MarshalPublicKeyPEM(key crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+func parsePKCS8(der []byte) (crypto.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, ErrPrivateKey
+}
+
+func parsePKIX(der []byte) (crypto.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, ErrPublicKey
+}
+
+// 去掉换行空白后按标准 base64 解码
+func decodeBareBase64(data []byte) ([]byte, error) {
+	s := strings.Join(strings.Fields(string(data)), "")
+	return base64.StdEncoding.DecodeString(s)
+}
@@ -0,0 +1,315 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// 签名算法，名称与 JWS(RFC 7518/8037) 保持一致
+type SignAlgorithm string
+
+const (
+	SignRS256 SignAlgorithm = "RS256" // RSA PKCS#1 v1.5 + SHA256，即支付宝的 RSA2
+	SignPS256 SignAlgorithm = "PS256" // RSA-PSS + SHA256
+	SignES256 SignAlgorithm = "ES256" // ECDSA P-256 + SHA256，签名为 r||s 共 64 字节
+	SignEdDSA SignAlgorithm = "EdDSA" // Ed25519
+
+	minRSABits = 2048
+)
+
+var (
+	ErrSignAlgorithm = errors.New("unsupported sign algorithm")
+	ErrKeyType       = errors.New("key type does not match sign algorithm")
+	ErrWeakKey       = errors.New("rsa key must be at least 2048 bits")
+	ErrSignature     = errors.New("signature verification failed")
+)
+
+type Verifier interface {
+	Algorithm() SignAlgorithm
+	Verify(data, signature []byte) error
+	PublicKey() crypto.PublicKey
+}
+
+type Signer interface {
+	Algorithm() SignAlgorithm
+	Sign(data []byte) ([]byte, error)
+	PrivateKey() crypto.PrivateKey
+	Verifier() Verifier
+}
+
+type keySigner struct {
+	alg SignAlgorithm
+	key crypto.Signer
+}
+
+type keyVerifier struct {
+	alg SignAlgorithm
+	key crypto.PublicKey
+}
+
+// NewSigner 使用私钥创建签名器，算法与密钥类型必须匹配
+func NewSigner(alg SignAlgorithm, key crypto.PrivateKey) (Signer, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrKeyType
+	}
+	if err := checkKey(alg, signer.Public()); err != nil {
+		return nil, err
+	}
+	return &keySigner{alg: alg, key: signer}, nil
+}
+
+// NewVerifier 使用公钥创建验签器
+func NewVerifier(alg SignAlgorithm, key crypto.PublicKey) (Verifier, error) {
+	if err := checkKey(alg, key); err != nil {
+		return nil, err
+	}
+	return &keyVerifier{alg: alg, key: key}, nil
+}
+
+// GenerateSigner 生成对应算法的密钥对，RSA 为 2048 位
+func GenerateSigner(alg SignAlgorithm) (Signer, error) {
+	var (
+		key crypto.PrivateKey
+		err error
+	)
+	switch alg {
+	case SignRS256, SignPS256:
+		key, err = rsa.GenerateKey(rand.Reader, minRSABits)
+	case SignES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case SignEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrSignAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(alg, key)
+}
+
+// DefaultSignAlgorithm 根据密钥类型选择默认算法
+func DefaultSignAlgorithm(key interface{}) (SignAlgorithm, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return SignRS256, nil
+	case *ecdsa.PrivateKey, *ecdsa.PublicKey:
+		return SignES256, nil
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return SignEdDSA, nil
+	}
+	return "", ErrKeyType
+}
+
+func checkKey(alg SignAlgorithm, key crypto.PublicKey) error {
+	switch alg {
+	case SignRS256, SignPS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrKeyType
+		}
+		if pub.N.BitLen() < minRSABits {
+			return ErrWeakKey
+		}
+	case SignES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return ErrKeyType
+		}
+	case SignEdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || len(pub) != ed25519.PublicKeySize {
+			return ErrKeyType
+		}
+	default:
+		return ErrSignAlgorithm
+	}
+	return nil
+}
+
+func (s *keySigner) Algorithm() SignAlgorithm {
+	return s.alg
+}
+
+func (s *keySigner) PrivateKey() crypto.PrivateKey {
+	return s.key
+}
+
+func (s *keySigner) Verifier() Verifier {
+	return &keyVerifier{alg: s.alg, key: s.key.Public()}
+}
+
+func (s *keySigner) Sign(data []byte) ([]byte, error) {
+	switch s.alg {
+	case SignEdDSA:
+		return s.key.Sign(rand.Reader, data, crypto.Hash(0))
+	case SignRS256:
+		hashed := sha256.Sum256(data)
+		return s.key.Sign(rand.Reader, hashed[:], crypto.SHA256)
+	case SignPS256:
+		hashed := sha256.Sum256(data)
+		return s.key.Sign(rand.Reader, hashed[:], &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       crypto.SHA256,
+		})
+	case SignES256:
+		hashed := sha256.Sum256(data)
+		r, ss, err := ecdsa.Sign(rand.Reader, s.key.(*ecdsa.PrivateKey), hashed[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		ss.FillBytes(sig[32:])
+		return sig, nil
+	}
+	return nil, ErrSignAlgorithm
+}
+
+func (v *keyVerifier) Algorithm() SignAlgorithm {
+	return v.alg
+}
+
+func (v *keyVerifier) PublicKey() crypto.PublicKey {
+	return v.key
+}
+
+func (v *keyVerifier) Verify(data, signature []byte) error {
+	var ok bool
+	switch v.alg {
+	case SignEdDSA:
+		ok = ed25519.Verify(v.key.(ed25519.PublicKey), data, signature)
+	case SignRS256:
+		hashed := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(v.key.(*rsa.PublicKey), crypto.SHA256, hashed[:], signature) == nil
+	case SignPS256:
+		hashed := sha256.Sum256(data)
+		ok = rsa.VerifyPSS(v.key.(*rsa.PublicKey), crypto.SHA256, hashed[:], signature, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       crypto.SHA256,
+		}) == nil
+	case SignES256:
+		if len(signature) != 64 {
+			return ErrSignature
+		}
+		hashed := sha256.Sum256(data)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		ok = ecdsa.Verify(v.key.(*ecdsa.PublicKey), hashed[:], r, s)
+	default:
+		return ErrSignAlgorithm
+	}
+	if !ok {
+		return ErrSignature
+	}
+	return nil
+}
+
+// SignerConfig 签名配置，修改 Algorithm 和密钥即可切换算法
+// 密钥支持 PEM、不带头尾的 base64 DER(支付宝后台导出的格式) 以及 JWK JSON
+type SignerConfig struct {
+	Algorithm  string `json:"algorithm" yaml:"algorithm"` // 为空时根据密钥类型选择
+	PrivateKey string `json:"privateKey" yaml:"privateKey"`
+	PublicKey  string `json:"publicKey" yaml:"publicKey"`
+}
+
+func (c SignerConfig) NewSigner() (Signer, error) {
+	key, err := ParsePrivateKeyAny([]byte(c.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	alg, err := c.algorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(alg, key)
+}
+
+// NewVerifier 优先使用 PublicKey，为空时从 PrivateKey 推导
+func (c SignerConfig) NewVerifier() (Verifier, error) {
+	if c.PublicKey == "" {
+		signer, err := c.NewSigner()
+		if err != nil {
+			return nil, err
+		}
+		return signer.Verifier(), nil
+	}
+	key, err := ParsePublicKeyAny([]byte(c.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	alg, err := c.algorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewVerifier(alg, key)
+}
+
+func (c SignerConfig) algorithm(key interface{}) (SignAlgorithm, error) {
+	if c.Algorithm == "" {
+		return DefaultSignAlgorithm(key)
+	}
+	for _, alg := range []SignAlgorithm{SignRS256, SignPS256, SignES256, SignEdDSA} {
+		if strings.EqualFold(c.Algorithm, string(alg)) {
+			return alg, nil
+		}
+	}
+	// 兼容支付宝的算法名
+	if strings.EqualFold(c.Algorithm, "RSA2") {
+		return SignRS256, nil
+	}
+	return "", ErrSignAlgorithm
+}
+
+// SignParams 按支付宝的方式签名参数：
+// 去掉 sign 和空值后按 key 排序，拼接成 k1=v1&k2=v2 签名，结果为标准 base64
+func SignParams(signer Signer, params url.Values) (string, error) {
+	sig, err := signer.Sign([]byte(paramsContent(params)))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyParams 校验 SignParams 生成的签名
+func VerifyParams(verifier Verifier, params url.Values, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrSignature
+	}
+	return verifier.Verify([]byte(paramsContent(params)), sig)
+}
+
+func paramsContent(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k == "sign" || params.Get(k) == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte('&')
+		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(params.Get(k))
+	}
+	return buf.String()
+}
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/url"
+	"testing"
+)
+
+var signAlgorithms = []SignAlgorithm{SignRS256, SignPS256, SignES256, SignEdDSA}
+
+func TestSignVerify(t *testing.T) {
+	for _, alg := range signAlgorithms {
+		signer, err := GenerateSigner(alg)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		sig, err := signer.Sign([]byte(content))
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		verifier := signer.Verifier()
+		if err = verifier.Verify([]byte(content), sig); err != nil {
+			t.Errorf("%s: %v", alg, err)
+		}
+		if err = verifier.Verify([]byte(content+"!"), sig); err != ErrSignature {
+			t.Errorf("%s: tampered data want ErrSignature, got %v", alg, err)
+		}
+		sig[len(sig)-1] ^= 1
+		if err = verifier.Verify([]byte(content), sig); err != ErrSignature {
+			t.Errorf("%s: tampered signature want ErrSignature, got %v", alg, err)
+		}
+	}
+}
+
+func TestSignerKeyMismatch(t *testing.T) {
+	ec, _ := GenerateSigner(SignES256)
+	if _, err := NewSigner(SignEdDSA, ec.PrivateKey()); err != ErrKeyType {
+		t.Errorf("want ErrKeyType, got %v", err)
+	}
+	if _, err := NewVerifier(SignRS256, ec.Verifier().PublicKey()); err != ErrKeyType {
+		t.Errorf("want ErrKeyType, got %v", err)
+	}
+	if _, err := NewSigner("HS256", ec.PrivateKey()); err != ErrSignAlgorithm {
+		t.Errorf("want ErrSignAlgorithm, got %v", err)
+	}
+
+	// rsa_test 中的 1024 位密钥强度不够
+	weak, err := ParsePrivateKeyPEM([]byte(privateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewSigner(SignRS256, weak); err != ErrWeakKey {
+		t.Errorf("want ErrWeakKey, got %v", err)
+	}
+}
+
+func TestPEMRoundTrip(t *testing.T) {
+	for _, alg := range signAlgorithms {
+		signer, _ := GenerateSigner(alg)
+		priPEM, err := MarshalPrivateKeyPEM(signer.PrivateKey())
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		pubPEM, err := MarshalPublicKeyPEM(signer.Verifier().PublicKey())
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+
+		pri, err := ParsePrivateKeyPEM(priPEM)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		pub, err := ParsePublicKeyPEM(pubPEM)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		assertKeyPair(t, alg, pri, pub)
+	}
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	set := JWKSet{}
+	for _, alg := range signAlgorithms {
+		signer, _ := GenerateSigner(alg)
+		jwk, err := NewJWK(signer.PrivateKey(), string(alg), alg)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		data, _ := json.Marshal(jwk)
+		parsed, err := ParseJWK(data)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		pri, err := parsed.PrivateKey()
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		pub, err := parsed.Public().PublicKey()
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		assertKeyPair(t, alg, pri, pub)
+		set.Keys = append(set.Keys, *jwk.Public())
+	}
+
+	data, _ := json.Marshal(set)
+	if bytes.Contains(data, []byte(`"d"`)) {
+		t.Errorf("public jwks should not contain private parts: %s", data)
+	}
+	if jwk, ok := set.Find(string(SignEdDSA)); !ok || jwk.Kty != "OKP" || jwk.IsPrivate() {
+		t.Errorf("unexpected jwk: %+v", jwk)
+	}
+	if _, err := set.Keys[0].PrivateKey(); err != ErrPrivateKey {
+		t.Errorf("want ErrPrivateKey, got %v", err)
+	}
+
+	// x 与 d 不匹配
+	a, _ := GenerateSigner(SignEdDSA)
+	b, _ := GenerateSigner(SignEdDSA)
+	ja, _ := NewJWK(a.PrivateKey(), "", "")
+	jb, _ := NewJWK(b.PrivateKey(), "", "")
+	ja.D = jb.D
+	if _, err := ja.PrivateKey(); err != ErrJWK {
+		t.Errorf("want ErrJWK, got %v", err)
+	}
+}
+
+func TestSignerConfig(t *testing.T) {
+	params := url.Values{}
+	params.Set("app_id", "2016091800540000")
+	params.Set("method", "alipay.trade.page.pay")
+	params.Set("biz_content", `{"out_trade_no":"1"}`)
+	params.Set("empty", "")
+
+	for _, alg := range signAlgorithms {
+		signer, _ := GenerateSigner(alg)
+		priPEM, _ := MarshalPrivateKeyPEM(signer.PrivateKey())
+		jwk, _ := NewJWK(signer.Verifier().PublicKey(), "", "")
+		pubJWK, _ := json.Marshal(jwk)
+
+		config := SignerConfig{Algorithm: string(alg), PrivateKey: string(priPEM), PublicKey: string(pubJWK)}
+		s, err := config.NewSigner()
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		v, err := config.NewVerifier()
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		sign, err := SignParams(s, params)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+
+		params.Set("sign", sign)
+		if err = VerifyParams(v, params, sign); err != nil {
+			t.Errorf("%s: %v", alg, err)
+		}
+		params.Set("method", "alipay.trade.refund")
+		if err = VerifyParams(v, params, sign); err != ErrSignature {
+			t.Errorf("%s: want ErrSignature, got %v", alg, err)
+		}
+		params.Set("method", "alipay.trade.page.pay")
+		params.Del("sign")
+	}
+}
+
+func TestSignerConfigBareKey(t *testing.T) {
+	// 支付宝后台导出的不带头尾的 base64 私钥
+	signer, _ := GenerateSigner(SignRS256)
+	priPEM, _ := MarshalPrivateKeyPEM(signer.PrivateKey())
+	block, _ := pem.Decode(priPEM)
+	bare := base64.StdEncoding.EncodeToString(block.Bytes)
+
+	s, err := SignerConfig{Algorithm: "RSA2", PrivateKey: bare}.NewSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Algorithm() != SignRS256 {
+		t.Errorf("want RS256, got %s", s.Algorithm())
+	}
+	v, err := SignerConfig{PrivateKey: bare}.NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := s.Sign([]byte(content))
+	if err = v.Verify([]byte(content), sig); err != nil {
+		t.Error(err)
+	}
+	if _, err = (SignerConfig{Algorithm: "SM2", PrivateKey: bare}).NewSigner(); err != ErrSignAlgorithm {
+		t.Errorf("want ErrSignAlgorithm, got %v", err)
+	}
+}
+
+func assertKeyPair(t *testing.T, alg SignAlgorithm, pri, pub interface{}) {
+	t.Helper()
+	signer, err := NewSigner(alg, pri)
+	if err != nil {
+		t.Fatalf("%s: %v", alg, err)
+	}
+	verifier, err := NewVerifier(alg, pub)
+	if err != nil {
+		t.Fatalf("%s: %v", alg, err)
+	}
+	sig, _ := signer.Sign([]byte(content))
+	if err = verifier.Verify([]byte(content), sig); err != nil {
+		t.Errorf("%s: %v", alg, err)
+	}
+}
@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+/**
+流式加密：明文按 chunkSize 切块，每块单独加密认证。
+块的 nonce = 信封中的随机前缀(7) | 块序号(4) | 是否最后一块(1)，
+块被重排、删除或在块边界截断都会导致解密失败。
+*/
+
+const (
+	DefaultChunkSize = 64 * 1024
+
+	maxChunkSize      = 16 << 20
+	streamNonceSuffix = 5
+)
+
+var ErrStreamClosed = errors.New("encrypt stream is closed")
+
+type encryptWriter struct {
+	w         io.Writer
+	aead      cipher.AEAD
+	header    []byte
+	prefix    []byte
+	counter   uint32
+	chunkSize int
+	buf       []byte
+	out       []byte
+	closed    bool
+	err       error
+}
+
+// NewEncryptWriter 返回加密写入器，写入的数据加密后写到 w，Close 时写入最后一块
+// Close 不会关闭 w
+func NewEncryptWriter(w io.Writer, alg Algorithm, key []byte, keyID string) (io.WriteCloser, error) {
+	return newEncryptWriter(w, alg, key, keyID, nil, DefaultChunkSize)
+}
+
+// NewPasswordEncryptWriter 使用口令派生的密钥流式加密
+func NewPasswordEncryptWriter(w io.Writer, alg Algorithm, password []byte, params KDFParams) (io.WriteCloser, error) {
+	params.Salt = nil
+	key, err := params.DeriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptWriter(w, alg, key, "", &params, DefaultChunkSize)
+}
+
+func newEncryptWriter(w io.Writer, alg Algorithm, key []byte, keyID string, params *KDFParams, chunkSize int) (*encryptWriter, error) {
+	aead, err := newAEAD(alg, key)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newEnvelope(modeStream, alg, keyID, params, aead.NonceSize()-streamNonceSuffix)
+	if err != nil {
+		return nil, err
+	}
+	e.ChunkSize = uint32(chunkSize)
+
+	header := e.marshalHeader()
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:         w,
+		aead:      aead,
+		header:    header,
+		prefix:    e.Nonce,
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrStreamClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	var n int
+	for len(p) > 0 {
+		// 缓冲区满且还有数据时才写出，保证最后一块在 Close 时写出
+		if len(w.buf) == w.chunkSize {
+			if w.err = w.seal(false); w.err != nil {
+				return n, w.err
+			}
+		}
+		c := copy(w.buf[len(w.buf):w.chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (w *encryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	return w.seal(true)
+}
+
+func (w *encryptWriter) seal(last bool) error {
+	if w.counter == math.MaxUint32 {
+		return ErrInvalidEnvelope
+	}
+	nonce := chunkNonce(w.prefix, w.counter, last)
+	w.out = w.aead.Seal(w.out[:0], nonce, w.buf, w.header)
+	if _, err := w.w.Write(w.out); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	w.counter++
+	return nil
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, len(prefix)+streamNonceSuffix)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	in      []byte
+	plain   []byte
+	unread  []byte
+	done    bool
+	err     error
+}
+
+// NewDecryptReader 返回解密读取器，读到 io.EOF 时表示数据完整且认证通过
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	return NewDecryptReaderFunc(r, StaticKey(key))
+}
+
+// NewDecryptReaderFunc 读取信封头后通过 lookup 获取解密密钥
+func NewDecryptReaderFunc(r io.Reader, lookup KeyLookup) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	e, err := readHeader(&recordReader{r: br})
+	if err != nil {
+		return nil, err
+	}
+	if e.mode != modeStream {
+		return nil, ErrInvalidEnvelope
+	}
+	key, err := lookup(e)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(e.Algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:      br,
+		aead:   aead,
+		header: e.header,
+		prefix: e.Nonce,
+		in:     make([]byte, int(e.ChunkSize)+aead.Overhead()),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.unread) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.readChunk()
+	}
+	n := copy(p, d.unread)
+	d.unread = d.unread[n:]
+	return n, nil
+}
+
+func (d *decryptReader) readChunk() error {
+	n, err := io.ReadFull(d.r, d.in)
+	last := false
+	switch err {
+	case nil:
+		// 满块之后没有数据了，说明是最后一块
+		if _, err = d.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		// 缺少最后一块，数据被截断
+		return ErrDecrypt
+	default:
+		return err
+	}
+
+	nonce := chunkNonce(d.prefix, d.counter, last)
+	d.plain, err = d.aead.Open(d.plain[:0], nonce, d.in[:n], d.header)
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.unread = d.plain
+	d.counter++
+	d.done = last
+	return nil
+}
@@ -2,11 +2,16 @@ package fsnotify_test
 
 import (
 	"context"
+	"io/ioutil"
 	"log"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+
+	watch "go-demo/utils/fsnotify"
 )
 
 func TestFileChangeListen(t *testing.T) {
@@ -40,3 +45,38 @@ func TestFileChangeListen(t *testing.T) {
 		}
 	}
 }
+
+func TestWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("a: 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes int32
+	w, err := watch.WatchFile(path, func() { atomic.AddInt32(&changes, 1) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 其他文件的变化不通知
+	ioutil.WriteFile(filepath.Join(dir, "other.yaml"), []byte("b: 1"), 0644)
+	// 连续写入合并为一次通知
+	for i := 0; i < 3; i++ {
+		ioutil.WriteFile(path, []byte("a: 2"), 0644)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt32(&changes) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&changes); n != 1 {
+		t.Errorf("want 1 change, got %d", n)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Errorf("close twice: %v", err)
+	}
+}
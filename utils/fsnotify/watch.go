@@ -0,0 +1,104 @@
+package fsnotify
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 编辑器保存文件时可能触发多次事件，合并后再通知
+const debounceDelay = 100 * time.Millisecond
+
+// FileWatcher 监听单个文件的变化，用于配置热加载
+type FileWatcher struct {
+	path     string
+	onChange func()
+	watcher  *fsnotify.Watcher
+
+	once sync.Once
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// WatchFile 在 path 被写入、创建或重命名后调用 onChange，短时间内的多次变化只调用一次
+func WatchFile(path string, onChange func()) (*FileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &FileWatcher{
+		path:     filepath.Clean(path),
+		onChange: onChange,
+		watcher:  watcher,
+		done:     make(chan struct{}),
+	}
+	// 监听目录而不是文件，兼容先写临时文件再重命名的保存方式
+	if err = watcher.Add(filepath.Dir(w.path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	w.wg.Add(1)
+	go w.watch()
+	return w, nil
+}
+
+// Close 停止监听并等待正在执行的 onChange 返回，可以重复调用
+func (w *FileWatcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.watcher.Close()
+		w.wg.Wait()
+	})
+	return err
+}
+
+func (w *FileWatcher) watch() {
+	defer w.wg.Done()
+
+	var (
+		timer  *time.Timer
+		notify <-chan time.Time
+	)
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != w.path {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if timer == nil {
+				timer = time.NewTimer(debounceDelay)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(debounceDelay)
+			}
+			notify = timer.C
+		case <-notify:
+			notify = nil
+			w.onChange()
+		case _, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+	}
+}
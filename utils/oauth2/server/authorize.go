@@ -0,0 +1,193 @@
+package server
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//go:embed static/authorize.html
+var authorizePage string
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(authorizePage))
+
+// 授权请求中需要在登录表单里原样带回的参数
+var authorizeParams = []string{
+	"response_type", "client_id", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method",
+}
+
+type authorizeRequest struct {
+	client              *Client
+	redirectURI         string
+	scope               string
+	state               string
+	nonce               string
+	codeChallenge       string
+	codeChallengeMethod string
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// client_id 和 redirect_uri 不合法时不能跳转，直接显示错误
+	client, err := s.clients.GetClient(r.Context(), r.Form.Get("client_id"))
+	if err == ErrNotFound {
+		http.Error(w, "invalid_client: unknown client", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redirectURI := r.Form.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	} else if !client.AllowRedirect(redirectURI) {
+		http.Error(w, "invalid_request: redirect_uri is not registered", http.StatusBadRequest)
+		return
+	}
+
+	req := &authorizeRequest{
+		client:              client,
+		redirectURI:         redirectURI,
+		scope:               r.Form.Get("scope"),
+		state:               r.Form.Get("state"),
+		nonce:               r.Form.Get("nonce"),
+		codeChallenge:       r.Form.Get("code_challenge"),
+		codeChallengeMethod: r.Form.Get("code_challenge_method"),
+	}
+	if oerr := req.validate(r.Form.Get("response_type")); oerr != nil {
+		s.redirectError(w, r, req, oerr)
+		return
+	}
+
+	user, handled := s.authenticateUser(w, r, req)
+	if handled {
+		return
+	}
+	if user == nil {
+		s.redirectError(w, r, req, errAccessDenied("the user is not authenticated"))
+		return
+	}
+	s.issueCode(w, r, req, user)
+}
+
+func (req *authorizeRequest) validate(responseType string) *oauthError {
+	if responseType != "code" {
+		return &oauthError{Code: "unsupported_response_type", Description: responseType}
+	}
+	if !req.client.AllowGrant(GrantAuthorizationCode) {
+		return errUnauthorizedClient("authorization code is not allowed for this client")
+	}
+	if !req.client.AllowScope(req.scope) {
+		return errInvalidScope(req.scope)
+	}
+	if req.codeChallenge == "" {
+		if req.client.Public() {
+			return errInvalidRequest("public client must use PKCE")
+		}
+		return nil
+	}
+	// RFC 7636 4.3 未指定时为 plain
+	if req.codeChallengeMethod == "" {
+		req.codeChallengeMethod = "plain"
+	}
+	if req.codeChallengeMethod != "S256" && req.codeChallengeMethod != "plain" {
+		return errInvalidRequest("code_challenge_method is not supported")
+	}
+	return nil
+}
+
+// authenticateUser 默认显示登录授权页，提交的用户名密码通过 UserStore 校验
+func (s *Server) authenticateUser(w http.ResponseWriter, r *http.Request, req *authorizeRequest) (*User, bool) {
+	if s.opts.authenticate != nil {
+		return s.opts.authenticate(w, r)
+	}
+	if r.Method != http.MethodPost {
+		s.renderAuthorize(w, r, req, "")
+		return nil, true
+	}
+	if r.PostForm.Get("action") == "deny" {
+		s.redirectError(w, r, req, errAccessDenied("the user denied the request"))
+		return nil, true
+	}
+	user, err := s.users.Authenticate(r.Context(), r.PostForm.Get("username"), r.PostForm.Get("password"))
+	if err == ErrNotFound {
+		s.renderAuthorize(w, r, req, "用户名或密码错误")
+		return nil, true
+	}
+	if err != nil {
+		s.redirectError(w, r, req, errServer(err))
+		return nil, true
+	}
+	return user, false
+}
+
+func (s *Server) renderAuthorize(w http.ResponseWriter, r *http.Request, req *authorizeRequest, errMsg string) {
+	params := make(map[string]string, len(authorizeParams))
+	for _, k := range authorizeParams {
+		if v := r.Form.Get(k); v != "" {
+			params[k] = v
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// 防止授权页被嵌入 iframe 点击劫持
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+	authorizeTemplate.Execute(w, map[string]interface{}{
+		"ClientID": req.client.ID,
+		"Scope":    req.scope,
+		"Error":    errMsg,
+		"Params":   params,
+	})
+}
+
+func (s *Server) issueCode(w http.ResponseWriter, r *http.Request, req *authorizeRequest, user *User) {
+	code, err := randomToken()
+	if err != nil {
+		s.redirectError(w, r, req, errServer(err))
+		return
+	}
+	now := s.opts.clock()
+	err = s.tokens.SaveCode(r.Context(), &AuthorizationCode{
+		Code:                code,
+		ClientID:            req.client.ID,
+		UserID:              user.ID,
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		Scope:               req.scope,
+		Nonce:               req.nonce,
+		CodeChallenge:       req.codeChallenge,
+		CodeChallengeMethod: req.codeChallengeMethod,
+		AuthTime:            now,
+		ExpiresAt:           now.Add(s.opts.codeTTL),
+	})
+	if err != nil {
+		s.redirectError(w, r, req, errServer(err))
+		return
+	}
+	s.redirect(w, r, req, url.Values{"code": {code}})
+}
+
+func (s *Server) redirectError(w http.ResponseWriter, r *http.Request, req *authorizeRequest, oerr *oauthError) {
+	v := url.Values{"error": {oerr.Code}}
+	if oerr.Description != "" {
+		v.Set("error_description", oerr.Description)
+	}
+	s.redirect(w, r, req, v)
+}
+
+func (s *Server) redirect(w http.ResponseWriter, r *http.Request, req *authorizeRequest, v url.Values) {
+	if req.state != "" {
+		v.Set("state", req.state)
+	}
+	sep := "?"
+	if strings.Contains(req.redirectURI, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, req.redirectURI+sep+v.Encode(), http.StatusFound)
+}
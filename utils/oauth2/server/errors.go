@@ -0,0 +1,60 @@
+package server
+
+import "net/http"
+
+// oauthError RFC 6749 5.2 的错误响应
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	status      int
+}
+
+func (e *oauthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func (e *oauthError) Status() int {
+	if e.status == 0 {
+		return http.StatusBadRequest
+	}
+	return e.status
+}
+
+func errInvalidRequest(desc string) *oauthError {
+	return &oauthError{Code: "invalid_request", Description: desc}
+}
+
+func errInvalidClient(desc string) *oauthError {
+	return &oauthError{Code: "invalid_client", Description: desc, status: http.StatusUnauthorized}
+}
+
+func errInvalidGrant(desc string) *oauthError {
+	return &oauthError{Code: "invalid_grant", Description: desc}
+}
+
+func errUnauthorizedClient(desc string) *oauthError {
+	return &oauthError{Code: "unauthorized_client", Description: desc}
+}
+
+func errUnsupportedGrantType(desc string) *oauthError {
+	return &oauthError{Code: "unsupported_grant_type", Description: desc}
+}
+
+func errInvalidScope(desc string) *oauthError {
+	return &oauthError{Code: "invalid_scope", Description: desc}
+}
+
+func errAccessDenied(desc string) *oauthError {
+	return &oauthError{Code: "access_denied", Description: desc}
+}
+
+func errInvalidToken(desc string) *oauthError {
+	return &oauthError{Code: "invalid_token", Description: desc, status: http.StatusUnauthorized}
+}
+
+func errServer(err error) *oauthError {
+	return &oauthError{Code: "server_error", Description: err.Error(), status: http.StatusInternalServerError}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	cryptox "go-demo/utils/crypto"
+	"go-demo/utils/oauth2/server"
+)
+
+// 配合 utils/oauth2/client 使用，用户名密码 admin/admin
+func main() {
+	clients := server.NewMemoryClientStore(&server.Client{
+		// 分配给第三方的ID
+		ID: "123456",
+		// 分配给第三方的密钥
+		Secret: "pibigstar",
+		// 授权成功之后的回调地址
+		RedirectURIs: []string{"http://localhost:8000/oauth2"},
+		GrantTypes: []string{
+			server.GrantAuthorizationCode, server.GrantRefreshToken,
+			server.GrantPassword, server.GrantClientCredentials,
+		},
+	})
+
+	users := server.NewMemoryUserStore()
+	if err := users.Add("admin", "admin", &server.User{
+		ID:     "pibigstar",
+		Claims: map[string]interface{}{"name": "pibigstar"},
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	// 设置令牌存储方式
+	tokens := server.NewRedisTokenStore(redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+		DB:   0,
+	}), "")
+
+	// 每次启动生成新的签名密钥，生产环境应从配置中加载
+	signer, err := cryptox.GenerateSigner(cryptox.SignES256)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := server.New("http://localhost:9000", "demo", signer, clients, users, tokens,
+		server.WithAccessTokenTTL(time.Hour),
+		server.WithRefreshTokenTTL(3*24*time.Hour),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", srv.Handler())
+	// client 请求 服务中心数据
+	mux.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+		token, err := srv.ValidateBearer(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		e.Encode(map[string]interface{}{
+			"expires_in": int64(time.Until(token.Registered.Expiration()).Seconds()),
+			"client_id":  token.Claims.ClientID,
+			"user_id":    token.Registered.Subject,
+		})
+	})
+
+	log.Println("Server is running at 9000 port.")
+	log.Fatal(http.ListenAndServe(":9000", mux))
+}
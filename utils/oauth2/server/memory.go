@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryClientStore 内存客户端存储
+type MemoryClientStore struct {
+	mu      sync.RWMutex
+	clients map[string]*Client
+}
+
+func NewMemoryClientStore(clients ...*Client) *MemoryClientStore {
+	s := &MemoryClientStore{clients: make(map[string]*Client)}
+	for _, c := range clients {
+		s.Set(c)
+	}
+	return s
+}
+
+func (s *MemoryClientStore) Set(c *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[c.ID] = c
+}
+
+func (s *MemoryClientStore) GetClient(ctx context.Context, id string) (*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return c, nil
+}
+
+type memoryUser struct {
+	user     *User
+	password []byte // bcrypt
+}
+
+// MemoryUserStore 内存用户存储，密码以 bcrypt 保存
+type MemoryUserStore struct {
+	mu     sync.RWMutex
+	byName map[string]*memoryUser
+	byID   map[string]*User
+}
+
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		byName: make(map[string]*memoryUser),
+		byID:   make(map[string]*User),
+	}
+}
+
+func (s *MemoryUserStore) Add(username, password string, user *User) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byName[username] = &memoryUser{user: user, password: hash}
+	s.byID[user.ID] = user
+	return nil
+}
+
+func (s *MemoryUserStore) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	s.mu.RLock()
+	u, ok := s.byName[username]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if bcrypt.CompareHashAndPassword(u.password, []byte(password)) != nil {
+		return nil, ErrNotFound
+	}
+	return u.user, nil
+}
+
+func (s *MemoryUserStore) GetUser(ctx context.Context, id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return u, nil
+}
+
+type memoryRefresh struct {
+	token *RefreshToken
+	used  bool
+}
+
+// MemoryTokenStore 内存令牌存储，只适合单机和测试
+type MemoryTokenStore struct {
+	mu       sync.Mutex
+	codes    map[string]*AuthorizationCode
+	refresh  map[string]*memoryRefresh
+	families map[string]time.Time // 已吊销的 Family 及其过期时间
+	clock    func() time.Time
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		codes:    make(map[string]*AuthorizationCode),
+		refresh:  make(map[string]*memoryRefresh),
+		families: make(map[string]time.Time),
+		clock:    time.Now,
+	}
+}
+
+func (s *MemoryTokenStore) SaveCode(ctx context.Context, code *AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	s.codes[code.Code] = code
+	return nil
+}
+
+func (s *MemoryTokenStore) TakeCode(ctx context.Context, code string) (*AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.codes[code]
+	if !ok || !s.clock().Before(c.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	delete(s.codes, code)
+	return c, nil
+}
+
+func (s *MemoryTokenStore) SaveRefresh(ctx context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	s.refresh[token.ID] = &memoryRefresh{token: token}
+	return nil
+}
+
+func (s *MemoryTokenStore) UseRefresh(ctx context.Context, id string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.refresh[id]
+	if !ok || !s.clock().Before(r.token.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	if _, revoked := s.families[r.token.Family]; revoked {
+		return nil, ErrNotFound
+	}
+	if r.used {
+		return r.token, ErrRefreshReused
+	}
+	r.used = true
+	return r.token, nil
+}
+
+func (s *MemoryTokenStore) RevokeFamily(ctx context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expiresAt time.Time
+	for _, r := range s.refresh {
+		if r.token.Family == family && r.token.ExpiresAt.After(expiresAt) {
+			expiresAt = r.token.ExpiresAt
+		}
+	}
+	s.families[family] = expiresAt
+	return nil
+}
+
+// 清理过期数据，调用方需持有锁
+func (s *MemoryTokenStore) purge() {
+	now := s.clock()
+	for k, c := range s.codes {
+		if !now.Before(c.ExpiresAt) {
+			delete(s.codes, k)
+		}
+	}
+	for k, r := range s.refresh {
+		if !now.Before(r.token.ExpiresAt) {
+			delete(s.refresh, k)
+		}
+	}
+	for k, expiresAt := range s.families {
+		if !now.Before(expiresAt) {
+			delete(s.families, k)
+		}
+	}
+}
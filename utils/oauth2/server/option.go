@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	defaultAccessTokenTTL  = time.Hour
+	defaultRefreshTokenTTL = 3 * 24 * time.Hour
+	defaultCodeTTL         = time.Minute
+	defaultIDTokenTTL      = time.Hour
+)
+
+// UserAuthenticator 从请求中识别已登录用户。
+// 用户未登录时自行输出登录页或跳转并返回 handled=true，授权端点不再处理该请求
+type UserAuthenticator func(w http.ResponseWriter, r *http.Request) (user *User, handled bool)
+
+type (
+	Option  func(*options)
+	options struct {
+		accessTokenTTL  time.Duration
+		refreshTokenTTL time.Duration
+		codeTTL         time.Duration
+		idTokenTTL      time.Duration
+		authenticate    UserAuthenticator
+		clock           func() time.Time
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		accessTokenTTL:  defaultAccessTokenTTL,
+		refreshTokenTTL: defaultRefreshTokenTTL,
+		codeTTL:         defaultCodeTTL,
+		idTokenTTL:      defaultIDTokenTTL,
+		clock:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	return optCopy
+}
+
+// WithAccessTokenTTL sets the lifetime of access tokens.
+func WithAccessTokenTTL(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.accessTokenTTL = ttl
+	}
+}
+
+// WithRefreshTokenTTL sets the lifetime of refresh tokens, 0 disables refresh tokens.
+func WithRefreshTokenTTL(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.refreshTokenTTL = ttl
+	}
+}
+
+// WithCodeTTL sets the lifetime of authorization codes.
+func WithCodeTTL(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.codeTTL = ttl
+	}
+}
+
+// WithIDTokenTTL sets the lifetime of OIDC ID tokens.
+func WithIDTokenTTL(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.idTokenTTL = ttl
+	}
+}
+
+// WithUserAuthenticator replaces the built-in login form, e.g. with the
+// service's own session.
+func WithUserAuthenticator(fn UserAuthenticator) Option {
+	return func(opts *options) {
+		opts.authenticate = fn
+	}
+}
+
+// WithClock sets the time source, used in tests.
+func WithClock(clock func() time.Time) Option {
+	return func(opts *options) {
+		opts.clock = clock
+	}
+}
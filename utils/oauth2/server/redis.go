@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const defaultFamilyRevokeTTL = 30 * 24 * time.Hour
+
+// RedisTokenStore 基于 Redis 的令牌存储，client 可以直接传入 sdk/redis 的 RedisClient
+type RedisTokenStore struct {
+	client redis.Cmdable
+	prefix string
+	// FamilyRevokeTTL 吊销记录的保存时间，应不小于刷新令牌的有效期
+	FamilyRevokeTTL time.Duration
+}
+
+// NewRedisTokenStore prefix 为空时使用 "oauth2:"
+func NewRedisTokenStore(client redis.Cmdable, prefix string) *RedisTokenStore {
+	if prefix == "" {
+		prefix = "oauth2:"
+	}
+	return &RedisTokenStore{client: client, prefix: prefix, FamilyRevokeTTL: defaultFamilyRevokeTTL}
+}
+
+func (s *RedisTokenStore) SaveCode(ctx context.Context, code *AuthorizationCode) error {
+	return s.setJSON(s.prefix+"code:"+code.Code, code, time.Until(code.ExpiresAt))
+}
+
+func (s *RedisTokenStore) TakeCode(ctx context.Context, code string) (*AuthorizationCode, error) {
+	key := s.prefix + "code:" + code
+	// MULTI 中 GET 和 DEL，并发兑换时只有一个能拿到
+	var get *redis.StringCmd
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c AuthorizationCode
+	if err = json.Unmarshal([]byte(get.Val()), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *RedisTokenStore) SaveRefresh(ctx context.Context, token *RefreshToken) error {
+	return s.setJSON(s.prefix+"refresh:"+token.ID, token, time.Until(token.ExpiresAt))
+}
+
+func (s *RedisTokenStore) UseRefresh(ctx context.Context, id string) (*RefreshToken, error) {
+	data, err := s.client.Get(s.prefix + "refresh:" + id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token RefreshToken
+	if err = json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.client.Exists(s.prefix + "family:" + token.Family).Result()
+	if err != nil {
+		return nil, err
+	}
+	if revoked > 0 {
+		return nil, ErrNotFound
+	}
+	// SETNX 保证同一个刷新令牌只有一次能使用成功
+	first, err := s.client.SetNX(s.prefix+"used:"+id, 1, time.Until(token.ExpiresAt)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		return &token, ErrRefreshReused
+	}
+	return &token, nil
+}
+
+func (s *RedisTokenStore) RevokeFamily(ctx context.Context, family string) error {
+	return s.client.Set(s.prefix+"family:"+family, 1, s.FamilyRevokeTTL).Err()
+}
+
+func (s *RedisTokenStore) setJSON(key string, v interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(key, data, ttl).Err()
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	cryptox "go-demo/utils/crypto"
+	tokenx "go-demo/utils/token"
+)
+
+/**
+可嵌入的 OAuth2/OIDC 授权服务：
+- 授权码模式(支持 PKCE，公开客户端必须使用)、客户端模式、密码模式和刷新令牌
+- access token 和 ID token 都是 JWT，资源服务可以通过 JWKS 自行验签
+- 刷新令牌每次使用后轮换，旧令牌被重用时吊销整个授权
+客户端、用户、令牌的存储都可以替换，挂载在子路径时 issuer 需要包含该路径:
+
+	mux.Handle("/oauth2/", http.StripPrefix("/oauth2", srv.Handler()))
+*/
+
+const (
+	PathAuthorize = "/authorize"
+	PathToken     = "/token"
+	PathUserInfo  = "/userinfo"
+	PathJWKS      = "/jwks.json"
+	PathDiscovery = "/.well-known/openid-configuration"
+
+	ScopeOpenID = "openid"
+)
+
+// AccessClaims access token 中的自定义声明
+type AccessClaims struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+type Server struct {
+	issuer  string
+	clients ClientStore
+	users   UserStore
+	tokens  TokenStore
+	opts    *options
+
+	signer   cryptox.Signer
+	keys     *tokenx.KeySet
+	access   *tokenx.Issuer
+	idToken  *tokenx.Issuer
+	verifier *tokenx.Verifier
+}
+
+// New issuer 为对外的完整地址，如 https://auth.example.com，kid 和 signer 用于签发 JWT
+func New(issuer, kid string, signer cryptox.Signer, clients ClientStore, users UserStore, tokens TokenStore, opts ...Option) *Server {
+	s := &Server{
+		issuer:  strings.TrimSuffix(issuer, "/"),
+		clients: clients,
+		users:   users,
+		tokens:  tokens,
+		opts:    evaluateOptions(opts),
+		signer:  signer,
+		keys:    tokenx.NewKeySet(),
+	}
+	s.keys.Add(kid, signer.Verifier())
+	s.access = tokenx.NewIssuer(kid, signer,
+		tokenx.WithIssuer(s.issuer), tokenx.WithTTL(s.opts.accessTokenTTL), tokenx.WithClock(s.opts.clock))
+	s.idToken = tokenx.NewIssuer(kid, signer,
+		tokenx.WithIssuer(s.issuer), tokenx.WithTTL(s.opts.idTokenTTL), tokenx.WithClock(s.opts.clock))
+	s.verifier = tokenx.NewVerifier(s.keys, tokenx.WithIssuer(s.issuer), tokenx.WithClock(s.opts.clock))
+	return s
+}
+
+// Handler 返回所有端点，路径见 Path 常量
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathAuthorize, s.handleAuthorize)
+	mux.HandleFunc(PathToken, s.handleToken)
+	mux.HandleFunc(PathUserInfo, s.handleUserInfo)
+	mux.Handle(PathJWKS, tokenx.JWKSHandler(s.keys))
+	mux.HandleFunc(PathDiscovery, s.handleDiscovery)
+	return mux
+}
+
+// KeySet 轮换签名密钥时把旧公钥留在这里，直到旧令牌全部过期
+func (s *Server) KeySet() *tokenx.KeySet {
+	return s.keys
+}
+
+// ValidateBearer 校验请求中的 access token，同进程的资源服务可以直接使用
+func (s *Server) ValidateBearer(r *http.Request) (*tokenx.Token[AccessClaims], error) {
+	t, err := tokenx.Parse[AccessClaims](s.verifier, tokenx.BearerToken(r))
+	if err != nil {
+		return nil, err
+	}
+	// ID token 没有 client_id，不能当作 access token 使用
+	if t.Claims.ClientID == "" {
+		return nil, tokenx.ErrTokenType
+	}
+	return t, nil
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + PathAuthorize,
+		"token_endpoint":                        s.issuer + PathToken,
+		"userinfo_endpoint":                     s.issuer + PathUserInfo,
+		"jwks_uri":                              s.issuer + PathJWKS,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken, GrantPassword},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{string(s.signer.Algorithm())},
+		"scopes_supported":                      []string{ScopeOpenID},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+	})
+}
+
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	t, err := s.ValidateBearer(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, errInvalidToken(err.Error()))
+		return
+	}
+	if !hasScope(t.Claims.Scope, ScopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		writeJSON(w, http.StatusForbidden, &oauthError{Code: "insufficient_scope"})
+		return
+	}
+	user, err := s.users.GetUser(r.Context(), t.Registered.Subject)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errInvalidToken("user not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, userClaims(user))
+}
+
+func userClaims(user *User) map[string]interface{} {
+	claims := make(map[string]interface{}, len(user.Claims)+1)
+	for k, v := range user.Claims {
+		claims[k] = v
+	}
+	claims["sub"] = user.ID
+	return claims
+}
+
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 刷新令牌只保存哈希
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
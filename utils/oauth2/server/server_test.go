@@ -0,0 +1,337 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+
+	cryptox "go-demo/utils/crypto"
+	tokenx "go-demo/utils/token"
+)
+
+const (
+	testRedirect = "http://app.example.com/cb"
+	testVerifier = "dBjftJeZ4CVP-mJ92K9MxbrN3Z7lQbHiRlXaEcGgK3Nt0"
+)
+
+type testEnv struct {
+	srv    *Server
+	ts     *httptest.Server
+	client *http.Client
+}
+
+func newTestEnv(t *testing.T, tokens TokenStore) *testEnv {
+	t.Helper()
+	signer, err := cryptox.GenerateSigner(cryptox.SignEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := NewMemoryClientStore(
+		&Client{ID: "spa", RedirectURIs: []string{testRedirect}},
+		&Client{
+			ID:           "web",
+			Secret:       "s3cret",
+			RedirectURIs: []string{testRedirect},
+			GrantTypes:   []string{GrantAuthorizationCode, GrantRefreshToken, GrantPassword, GrantClientCredentials},
+			Scopes:       []string{ScopeOpenID, "read", "write"},
+		},
+	)
+	users := NewMemoryUserStore()
+	if err = users.Add("admin", "admin", &User{ID: "u1", Claims: map[string]interface{}{"name": "Admin"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{}
+	var handler http.Handler
+	env.ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(env.ts.Close)
+	env.srv = New(env.ts.URL, "k1", signer, clients, users, tokens)
+	handler = env.srv.Handler()
+	env.client = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	return env
+}
+
+// authorize 提交登录表单，返回回调地址上的参数
+func (e *testEnv) authorize(t *testing.T, params url.Values) url.Values {
+	t.Helper()
+	form := url.Values{"username": {"admin"}, "password": {"admin"}, "action": {"allow"}}
+	for k, v := range params {
+		form[k] = v
+	}
+	resp, err := e.client.PostForm(e.ts.URL+PathAuthorize, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("authorize: status %d: %s", resp.StatusCode, body)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(loc.String(), testRedirect+"?") {
+		t.Fatalf("unexpected redirect %s", loc)
+	}
+	return loc.Query()
+}
+
+func (e *testEnv) token(t *testing.T, form url.Values, basic ...string) (int, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, e.ts.URL+PathToken, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(basic) == 2 {
+		req.SetBasicAuth(basic[0], basic[1])
+	}
+	return e.do(t, req)
+}
+
+func (e *testEnv) do(t *testing.T, req *http.Request) (int, map[string]interface{}) {
+	t.Helper()
+	resp, err := e.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := make(map[string]interface{})
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestAuthorizationCodePKCE(t *testing.T) {
+	env := newTestEnv(t, NewMemoryTokenStore())
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"spa"},
+		"redirect_uri":          {testRedirect},
+		"state":                 {"xyz"},
+		"code_challenge":        {s256(testVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	// GET 显示授权页，授权参数作为隐藏字段带回
+	resp, err := env.client.Get(env.ts.URL + PathAuthorize + "?" + params.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), `name="code_challenge"`) {
+		t.Fatalf("authorize page: status %d", resp.StatusCode)
+	}
+
+	q := env.authorize(t, params)
+	if q.Get("state") != "xyz" || q.Get("code") == "" {
+		t.Fatalf("unexpected callback %v", q)
+	}
+	exchange := url.Values{
+		"grant_type":    {GrantAuthorizationCode},
+		"client_id":     {"spa"},
+		"code":          {q.Get("code")},
+		"redirect_uri":  {testRedirect},
+		"code_verifier": {"wrong" + testVerifier},
+	}
+	status, body := env.token(t, exchange)
+	if status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("wrong verifier: %d %v", status, body)
+	}
+
+	// 校验失败授权码也已作废
+	exchange.Set("code_verifier", testVerifier)
+	if status, body = env.token(t, exchange); body["error"] != "invalid_grant" {
+		t.Fatalf("code reused: %d %v", status, body)
+	}
+
+	exchange.Set("code", env.authorize(t, params).Get("code"))
+	status, body = env.token(t, exchange)
+	if status != http.StatusOK || body["access_token"] == nil || body["refresh_token"] == nil {
+		t.Fatalf("exchange: %d %v", status, body)
+	}
+	if _, ok := body["id_token"]; ok {
+		t.Error("id_token issued without openid scope")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+body["access_token"].(string))
+	token, err := env.srv.ValidateBearer(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Registered.Subject != "u1" || token.Claims.ClientID != "spa" {
+		t.Errorf("unexpected access token %+v", token)
+	}
+
+	// 公开客户端必须使用 PKCE
+	params.Del("code_challenge")
+	if q = env.authorize(t, params); q.Get("error") != "invalid_request" || q.Get("state") != "xyz" {
+		t.Errorf("missing PKCE: %v", q)
+	}
+}
+
+func TestOpenIDConnect(t *testing.T) {
+	env := newTestEnv(t, NewMemoryTokenStore())
+
+	req, _ := http.NewRequest(http.MethodGet, env.ts.URL+PathDiscovery, nil)
+	_, discovery := env.do(t, req)
+	if discovery["issuer"] != env.ts.URL || discovery["jwks_uri"] != env.ts.URL+PathJWKS {
+		t.Fatalf("unexpected discovery %v", discovery)
+	}
+
+	q := env.authorize(t, url.Values{
+		"response_type": {"code"},
+		"client_id":     {"web"},
+		"redirect_uri":  {testRedirect},
+		"scope":         {"openid read"},
+		"nonce":         {"n-0S6_WzA2Mj"},
+	})
+	status, body := env.token(t, url.Values{
+		"grant_type":   {GrantAuthorizationCode},
+		"code":         {q.Get("code")},
+		"redirect_uri": {testRedirect},
+	}, "web", "s3cret")
+	if status != http.StatusOK {
+		t.Fatalf("exchange: %d %v", status, body)
+	}
+
+	// 依赖方通过 JWKS 验证 ID token
+	verifier := tokenx.NewVerifier(tokenx.NewRemoteKeySet(discovery["jwks_uri"].(string)),
+		tokenx.WithIssuer(env.ts.URL), tokenx.WithAudience("web"))
+	idToken, err := tokenx.Parse[map[string]interface{}](verifier, body["id_token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idToken.Registered.Subject != "u1" || idToken.Claims["nonce"] != "n-0S6_WzA2Mj" ||
+		idToken.Claims["name"] != "Admin" || idToken.Claims["azp"] != "web" {
+		t.Errorf("unexpected id token %+v", idToken)
+	}
+	// ID token 不能当作 access token
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+body["id_token"].(string))
+	if _, err = env.srv.ValidateBearer(req); err == nil {
+		t.Error("id token accepted as access token")
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, env.ts.URL+PathUserInfo, nil)
+	req.Header.Set("Authorization", "Bearer "+body["access_token"].(string))
+	status, info := env.do(t, req)
+	if status != http.StatusOK || info["sub"] != "u1" || info["name"] != "Admin" {
+		t.Errorf("userinfo: %d %v", status, info)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	for name, tokens := range map[string]TokenStore{
+		"memory": NewMemoryTokenStore(),
+		"redis":  NewRedisTokenStore(client, ""),
+	} {
+		env := newTestEnv(t, tokens)
+		status, body := env.token(t, url.Values{
+			"grant_type": {GrantPassword}, "username": {"admin"}, "password": {"admin"}, "scope": {"read write"},
+		}, "web", "s3cret")
+		if status != http.StatusOK {
+			t.Fatalf("%s: password grant: %d %v", name, status, body)
+		}
+		first := body["refresh_token"].(string)
+
+		refresh := url.Values{"grant_type": {GrantRefreshToken}, "refresh_token": {first}, "scope": {"read"}}
+		status, body = env.token(t, refresh, "web", "s3cret")
+		if status != http.StatusOK || body["scope"] != "read" {
+			t.Fatalf("%s: refresh: %d %v", name, status, body)
+		}
+		second := body["refresh_token"].(string)
+		if second == first {
+			t.Fatalf("%s: refresh token not rotated", name)
+		}
+
+		// scope 不能扩大
+		if _, body = env.token(t, url.Values{
+			"grant_type": {GrantRefreshToken}, "refresh_token": {second}, "scope": {"read admin"},
+		}, "web", "s3cret"); body["error"] != "invalid_scope" {
+			t.Errorf("%s: scope widened: %v", name, body)
+		}
+
+		// 旧令牌重用，整个授权被吊销
+		if _, body = env.token(t, refresh, "web", "s3cret"); body["error"] != "invalid_grant" {
+			t.Errorf("%s: reuse accepted: %v", name, body)
+		}
+		refresh.Set("refresh_token", second)
+		if _, body = env.token(t, refresh, "web", "s3cret"); body["error"] != "invalid_grant" {
+			t.Errorf("%s: family not revoked: %v", name, body)
+		}
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	env := newTestEnv(t, NewMemoryTokenStore())
+	form := url.Values{"grant_type": {GrantClientCredentials}, "scope": {"read"}}
+
+	status, body := env.token(t, form, "web", "s3cret")
+	if status != http.StatusOK || body["access_token"] == nil {
+		t.Fatalf("client credentials: %d %v", status, body)
+	}
+	if _, ok := body["refresh_token"]; ok {
+		t.Error("refresh token issued for client credentials")
+	}
+
+	if status, body = env.token(t, form, "web", "wrong"); status != http.StatusUnauthorized || body["error"] != "invalid_client" {
+		t.Errorf("wrong secret: %d %v", status, body)
+	}
+	form.Set("client_id", "spa")
+	if _, body = env.token(t, form); body["error"] != "unauthorized_client" {
+		t.Errorf("public client: %v", body)
+	}
+}
+
+func TestAuthorizeErrors(t *testing.T) {
+	env := newTestEnv(t, NewMemoryTokenStore())
+
+	// redirect_uri 未注册时不跳转
+	resp, err := env.client.Get(env.ts.URL + PathAuthorize + "?response_type=code&client_id=web&redirect_uri=http://evil.com/cb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Location") != "" {
+		t.Errorf("unregistered redirect: %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	params := url.Values{"response_type": {"code"}, "client_id": {"web"}, "state": {"s"}}
+	params.Set("scope", "admin")
+	if q := env.authorize(t, params); q.Get("error") != "invalid_scope" {
+		t.Errorf("invalid scope: %v", q)
+	}
+	params.Set("scope", "read")
+	params.Set("action", "deny")
+	if q := env.authorize(t, params); q.Get("error") != "access_denied" || q.Get("state") != "s" {
+		t.Errorf("deny: %v", q)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrRefreshReused = errors.New("refresh token has been reused")
+)
+
+// 支持的授权类型
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+	GrantPassword          = "password"
+)
+
+// Client 第三方应用，Secret 为空表示公开客户端(SPA、移动端)，必须使用 PKCE
+type Client struct {
+	ID           string
+	Secret       string
+	RedirectURIs []string
+	GrantTypes   []string // 为空时只允许授权码和刷新
+	Scopes       []string // 为空时不限制
+}
+
+func (c *Client) Public() bool {
+	return c.Secret == ""
+}
+
+func (c *Client) AllowGrant(grant string) bool {
+	if len(c.GrantTypes) == 0 {
+		return grant == GrantAuthorizationCode || grant == GrantRefreshToken
+	}
+	for _, g := range c.GrantTypes {
+		if g == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowRedirect 回调地址必须与注册的完全一致
+func (c *Client) AllowRedirect(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowScope 请求的 scope 必须都在注册范围内
+func (c *Client) AllowScope(scope string) bool {
+	if len(c.Scopes) == 0 {
+		return true
+	}
+	for _, s := range strings.Fields(scope) {
+		allowed := false
+		for _, registered := range c.Scopes {
+			if s == registered {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// User 资源所有者，Claims 会写入 ID token 和 userinfo，如 name、email
+type User struct {
+	ID     string
+	Claims map[string]interface{}
+}
+
+type ClientStore interface {
+	GetClient(ctx context.Context, id string) (*Client, error)
+}
+
+type UserStore interface {
+	// Authenticate 校验用户名和密码，失败返回 ErrNotFound
+	Authenticate(ctx context.Context, username, password string) (*User, error)
+	GetUser(ctx context.Context, id string) (*User, error)
+}
+
+// AuthorizationCode 授权码，只能使用一次
+type AuthorizationCode struct {
+	Code                string
+	ClientID            string
+	UserID              string
+	RedirectURI         string
+	Scope               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+	ExpiresAt           time.Time
+}
+
+// RefreshToken 刷新令牌，ID 为令牌的 SHA-256，原文不落库。
+// 每次刷新都会换一个新的，同一次授权产生的刷新令牌属于同一个 Family
+type RefreshToken struct {
+	ID        string
+	Family    string
+	ClientID  string
+	UserID    string
+	Scope     string
+	ExpiresAt time.Time
+}
+
+type TokenStore interface {
+	SaveCode(ctx context.Context, code *AuthorizationCode) error
+	// TakeCode 取出并删除授权码，不存在返回 ErrNotFound
+	TakeCode(ctx context.Context, code string) (*AuthorizationCode, error)
+
+	SaveRefresh(ctx context.Context, token *RefreshToken) error
+	// UseRefresh 把刷新令牌标记为已使用并返回，已使用过的返回 ErrRefreshReused，
+	// 不存在或所在 Family 已吊销返回 ErrNotFound
+	UseRefresh(ctx context.Context, id string) (*RefreshToken, error)
+	RevokeFamily(ctx context.Context, family string) error
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	tokenx "go-demo/utils/token"
+)
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// grant 一次授权的结果，用于签发令牌
+type grant struct {
+	client   *Client
+	subject  string // 用户ID，客户端模式为客户端ID
+	scope    string
+	family   string // 刷新令牌所属的授权
+	refresh  bool   // 是否签发刷新令牌，客户端模式没有用户，不签发
+	user     *User  // 需要签发 ID token 时不为空
+	nonce    string
+	authTime int64
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, errInvalidRequest("method must be POST"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errInvalidRequest(err.Error()))
+		return
+	}
+
+	resp, oerr := s.token(r)
+	if oerr != nil {
+		if oerr.Code == "invalid_client" {
+			if _, _, ok := r.BasicAuth(); ok {
+				w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+			}
+		}
+		writeJSON(w, oerr.Status(), oerr)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) token(r *http.Request) (*tokenResponse, *oauthError) {
+	client, oerr := s.authenticateClient(r)
+	if oerr != nil {
+		return nil, oerr
+	}
+	grantType := r.PostForm.Get("grant_type")
+	if !client.AllowGrant(grantType) {
+		return nil, errUnauthorizedClient("grant type is not allowed for this client")
+	}
+
+	var g *grant
+	switch grantType {
+	case GrantAuthorizationCode:
+		g, oerr = s.grantAuthorizationCode(r, client)
+	case GrantRefreshToken:
+		g, oerr = s.grantRefreshToken(r, client)
+	case GrantClientCredentials:
+		g, oerr = s.grantClientCredentials(r, client)
+	case GrantPassword:
+		g, oerr = s.grantPassword(r, client)
+	default:
+		return nil, errUnsupportedGrantType(grantType)
+	}
+	if oerr != nil {
+		return nil, oerr
+	}
+	return s.issue(r, g)
+}
+
+// authenticateClient 支持 client_secret_basic、client_secret_post，公开客户端只需 client_id
+func (s *Server) authenticateClient(r *http.Request) (*Client, *oauthError) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 2.3.1 要求先做 form 编码
+		var err error
+		if id, err = url.QueryUnescape(id); err != nil {
+			return nil, errInvalidClient("malformed client id")
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return nil, errInvalidClient("malformed client secret")
+		}
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id == "" {
+		return nil, errInvalidClient("client authentication is required")
+	}
+
+	client, err := s.clients.GetClient(r.Context(), id)
+	if err == ErrNotFound {
+		return nil, errInvalidClient("unknown client")
+	}
+	if err != nil {
+		return nil, errServer(err)
+	}
+	if client.Public() {
+		if secret != "" {
+			return nil, errInvalidClient("public client must not send a secret")
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(client.Secret)) != 1 {
+		return nil, errInvalidClient("client authentication failed")
+	}
+	return client, nil
+}
+
+func (s *Server) grantAuthorizationCode(r *http.Request, client *Client) (*grant, *oauthError) {
+	code, err := s.tokens.TakeCode(r.Context(), r.PostForm.Get("code"))
+	if err == ErrNotFound {
+		return nil, errInvalidGrant("authorization code is invalid or expired")
+	}
+	if err != nil {
+		return nil, errServer(err)
+	}
+	if code.ClientID != client.ID {
+		return nil, errInvalidGrant("authorization code was issued to another client")
+	}
+	if code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		return nil, errInvalidGrant("redirect_uri does not match")
+	}
+	if !verifyCodeChallenge(code.CodeChallenge, code.CodeChallengeMethod, r.PostForm.Get("code_verifier")) {
+		return nil, errInvalidGrant("code_verifier is invalid")
+	}
+
+	g := &grant{
+		client:   client,
+		subject:  code.UserID,
+		scope:    code.Scope,
+		refresh:  true,
+		nonce:    code.Nonce,
+		authTime: code.AuthTime.Unix(),
+	}
+	if hasScope(code.Scope, ScopeOpenID) {
+		if g.user, err = s.users.GetUser(r.Context(), code.UserID); err != nil {
+			return nil, errInvalidGrant("user not found")
+		}
+	}
+	return g, nil
+}
+
+func (s *Server) grantRefreshToken(r *http.Request, client *Client) (*grant, *oauthError) {
+	token, err := s.tokens.UseRefresh(r.Context(), hashToken(r.PostForm.Get("refresh_token")))
+	switch err {
+	case nil:
+	case ErrRefreshReused:
+		// 已使用过的刷新令牌再次出现说明已泄露，吊销整个授权
+		if err = s.tokens.RevokeFamily(r.Context(), token.Family); err != nil {
+			return nil, errServer(err)
+		}
+		return nil, errInvalidGrant("refresh token has been used")
+	case ErrNotFound:
+		return nil, errInvalidGrant("refresh token is invalid or expired")
+	default:
+		return nil, errServer(err)
+	}
+	if token.ClientID != client.ID {
+		return nil, errInvalidGrant("refresh token was issued to another client")
+	}
+
+	// 可以缩小 scope，不能扩大
+	scope := token.Scope
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		if !subsetScope(requested, token.Scope) {
+			return nil, errInvalidScope("scope exceeds the original grant")
+		}
+		scope = requested
+	}
+	return &grant{client: client, subject: token.UserID, scope: scope, family: token.Family, refresh: true}, nil
+}
+
+func (s *Server) grantClientCredentials(r *http.Request, client *Client) (*grant, *oauthError) {
+	if client.Public() {
+		return nil, errUnauthorizedClient("public client can not use client credentials")
+	}
+	scope := r.PostForm.Get("scope")
+	if !client.AllowScope(scope) {
+		return nil, errInvalidScope(scope)
+	}
+	return &grant{client: client, subject: client.ID, scope: scope}, nil
+}
+
+func (s *Server) grantPassword(r *http.Request, client *Client) (*grant, *oauthError) {
+	if client.Public() {
+		return nil, errUnauthorizedClient("public client can not use password grant")
+	}
+	scope := r.PostForm.Get("scope")
+	if !client.AllowScope(scope) {
+		return nil, errInvalidScope(scope)
+	}
+	user, err := s.users.Authenticate(r.Context(), r.PostForm.Get("username"), r.PostForm.Get("password"))
+	if err == ErrNotFound {
+		return nil, errInvalidGrant("username or password is incorrect")
+	}
+	if err != nil {
+		return nil, errServer(err)
+	}
+	return &grant{client: client, subject: user.ID, scope: scope, refresh: true}, nil
+}
+
+func (s *Server) issue(r *http.Request, g *grant) (*tokenResponse, *oauthError) {
+	access, err := tokenx.Sign(s.access, tokenx.RegisteredClaims{Subject: g.subject}, AccessClaims{ClientID: g.client.ID, Scope: g.scope})
+	if err != nil {
+		return nil, errServer(err)
+	}
+	resp := &tokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.opts.accessTokenTTL.Seconds()),
+		Scope:       g.scope,
+	}
+
+	if g.refresh && s.opts.refreshTokenTTL > 0 && g.client.AllowGrant(GrantRefreshToken) {
+		if resp.RefreshToken, err = s.newRefreshToken(r, g); err != nil {
+			return nil, errServer(err)
+		}
+	}
+
+	if g.user != nil {
+		claims := userClaims(g.user)
+		delete(claims, "sub")
+		claims["azp"] = g.client.ID
+		claims["auth_time"] = g.authTime
+		if g.nonce != "" {
+			claims["nonce"] = g.nonce
+		}
+		registered := tokenx.RegisteredClaims{Subject: g.user.ID, Audience: tokenx.Audience{g.client.ID}}
+		if resp.IDToken, err = tokenx.Sign(s.idToken, registered, claims); err != nil {
+			return nil, errServer(err)
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) newRefreshToken(r *http.Request, g *grant) (string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	family := g.family
+	if family == "" {
+		if family, err = randomToken(); err != nil {
+			return "", err
+		}
+	}
+	err = s.tokens.SaveRefresh(r.Context(), &RefreshToken{
+		ID:        hashToken(raw),
+		Family:    family,
+		ClientID:  g.client.ID,
+		UserID:    g.subject,
+		Scope:     g.scope,
+		ExpiresAt: s.opts.clock().Add(s.opts.refreshTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// verifyCodeChallenge RFC 7636，授权时没有 code_challenge 则不校验
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return true
+	}
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	var computed string
+	switch method {
+	case "S256":
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	case "plain":
+		computed = verifier
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func subsetScope(requested, granted string) bool {
+	for _, s := range strings.Fields(requested) {
+		if !hasScope(granted, s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package adaptive
+
+import (
+	"math"
+	"time"
+)
+
+// Algorithm 根据每次请求的耗时调整并发上限，由 Limiter 加锁调用
+type Algorithm interface {
+	// Update 记录一次请求的耗时、发起时的并发数以及是否被丢弃，返回新的并发上限
+	Update(rtt time.Duration, inflight int, dropped bool) int
+	Limit() int
+}
+
+// AIMD 加性增、乘性减：
+// 请求被丢弃或超时时限流值乘以 backoffRatio，否则在并发接近上限时加一
+type AIMD struct {
+	opts  *options
+	limit float64
+}
+
+func NewAIMD(opts ...Option) *AIMD {
+	options := evaluateOptions(opts)
+	return &AIMD{
+		opts:  options,
+		limit: clamp(float64(options.initialLimit), options),
+	}
+}
+
+func (a *AIMD) Update(rtt time.Duration, inflight int, dropped bool) int {
+	if dropped || rtt > a.opts.timeout {
+		a.limit = a.limit * a.opts.backoffRatio
+	} else if float64(inflight*2) >= a.limit {
+		a.limit++
+	}
+	a.limit = clamp(a.limit, a.opts)
+	return a.Limit()
+}
+
+func (a *AIMD) Limit() int {
+	return int(a.limit)
+}
+
+// Gradient2 比较短期延迟与长期平均延迟：
+// 短期延迟升高说明开始排队，按比例缩小限流值；延迟平稳时每次增加 sqrt(limit) 的排队余量
+type Gradient2 struct {
+	opts    *options
+	limit   float64
+	longRtt *ema
+}
+
+func NewGradient2(opts ...Option) *Gradient2 {
+	options := evaluateOptions(opts)
+	return &Gradient2{
+		opts:    options,
+		limit:   clamp(float64(options.initialLimit), options),
+		longRtt: newEMA(options.longWindow),
+	}
+}
+
+func (g *Gradient2) Update(rtt time.Duration, inflight int, dropped bool) int {
+	if rtt <= 0 {
+		return g.Limit()
+	}
+	shortRtt := float64(rtt)
+	longRtt := g.longRtt.add(shortRtt)
+
+	// 长期延迟远大于当前延迟时快速衰减，避免负载下降后迟迟不恢复
+	if longRtt/shortRtt > 2 {
+		g.longRtt.value *= 0.95
+	}
+
+	// 并发不到上限一半时说明应用本身压力不大，不调整
+	if float64(inflight) < g.limit/2 {
+		return g.Limit()
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, g.opts.tolerance*longRtt/shortRtt))
+	newLimit := g.limit*gradient + math.Sqrt(g.limit)
+	newLimit = g.limit*(1-g.opts.smoothing) + newLimit*g.opts.smoothing
+	g.limit = clamp(newLimit, g.opts)
+	return g.Limit()
+}
+
+func (g *Gradient2) Limit() int {
+	return int(g.limit)
+}
+
+func clamp(limit float64, opts *options) float64 {
+	return math.Max(float64(opts.minLimit), math.Min(float64(opts.maxLimit), limit))
+}
+
+// 指数移动平均，前 window 个样本使用算术平均预热
+type ema struct {
+	window int
+	count  int
+	value  float64
+}
+
+func newEMA(window int) *ema {
+	if window < 1 {
+		window = 1
+	}
+	return &ema{window: window}
+}
+
+func (e *ema) add(sample float64) float64 {
+	if e.count < e.window {
+		e.count++
+		e.value += (sample - e.value) / float64(e.count)
+		return e.value
+	}
+	factor := 2 / float64(e.window+1)
+	e.value = e.value*(1-factor) + sample*factor
+	return e.value
+}
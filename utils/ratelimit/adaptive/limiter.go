@@ -0,0 +1,84 @@
+package adaptive
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter 自适应并发限流器，并发数超过算法给出的上限时拒绝请求
+type Limiter struct {
+	alg   Algorithm
+	clock func() time.Time
+
+	mu       sync.Mutex
+	inflight int
+	limit    int
+}
+
+func New(alg Algorithm) *Limiter {
+	return &Limiter{
+		alg:   alg,
+		clock: time.Now,
+		limit: alg.Limit(),
+	}
+}
+
+// Acquire 申请一个并发名额，拿到的 Token 必须调用 Success、Dropped 或 Ignore 之一归还
+func (l *Limiter) Acquire() (*Token, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight >= l.limit {
+		return nil, false
+	}
+	l.inflight++
+	return &Token{
+		limiter:  l,
+		start:    l.clock(),
+		inflight: l.inflight,
+	}, true
+}
+
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *Limiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+func (l *Limiter) release(t *Token, sample, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	if sample {
+		l.limit = l.alg.Update(l.clock().Sub(t.start), t.inflight, dropped)
+	}
+}
+
+type Token struct {
+	limiter  *Limiter
+	start    time.Time
+	inflight int // 申请时的并发数
+	once     sync.Once
+}
+
+// Success 请求正常完成，耗时计入样本
+func (t *Token) Success() {
+	t.once.Do(func() { t.limiter.release(t, true, false) })
+}
+
+// Dropped 请求因超时或下游过载失败，触发限流值下调
+func (t *Token) Dropped() {
+	t.once.Do(func() { t.limiter.release(t, true, true) })
+}
+
+// Ignore 请求结果不代表负载情况(如参数错误)，只归还名额
+func (t *Token) Ignore() {
+	t.once.Do(func() { t.limiter.release(t, false, false) })
+}
@@ -0,0 +1,128 @@
+package adaptive
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAIMD(t *testing.T) {
+	a := NewAIMD(WithInitialLimit(10), WithLimitRange(5, 12), WithBackoff(0.5, time.Second))
+
+	// 并发不到上限一半时不增加
+	if a.Update(time.Millisecond, 2, false) != 10 {
+		t.Errorf("limit should not grow when app limited, got %d", a.Limit())
+	}
+	if a.Update(time.Millisecond, 5, false) != 11 {
+		t.Errorf("want 11, got %d", a.Limit())
+	}
+	a.Update(time.Millisecond, 10, false)
+	if a.Update(time.Millisecond, 10, false) != 12 {
+		t.Errorf("limit should be capped at 12, got %d", a.Limit())
+	}
+	if a.Update(time.Millisecond, 10, true) != 6 {
+		t.Errorf("want 6 after drop, got %d", a.Limit())
+	}
+	if a.Update(2*time.Second, 10, false) != 5 {
+		t.Errorf("timeout should back off to min 5, got %d", a.Limit())
+	}
+}
+
+func TestGradient2(t *testing.T) {
+	g := NewGradient2(WithInitialLimit(20), WithLimitRange(1, 100), WithLongWindow(10))
+
+	// 延迟稳定时上限增长
+	for i := 0; i < 50; i++ {
+		g.Update(10*time.Millisecond, g.Limit(), false)
+	}
+	grown := g.Limit()
+	if grown <= 20 {
+		t.Fatalf("limit should grow under stable latency, got %d", grown)
+	}
+
+	// 延迟突增时上限下降
+	for i := 0; i < 10; i++ {
+		g.Update(100*time.Millisecond, g.Limit(), false)
+	}
+	if g.Limit() >= grown {
+		t.Fatalf("limit should shrink when latency rises, %d >= %d", g.Limit(), grown)
+	}
+
+	// 应用压力小时不调整
+	limit := g.Limit()
+	g.Update(time.Millisecond, 0, false)
+	if g.Limit() != limit {
+		t.Errorf("limit changed while app limited: %d -> %d", limit, g.Limit())
+	}
+}
+
+func TestLimiterAcquire(t *testing.T) {
+	l := New(NewAIMD(WithInitialLimit(2), WithLimitRange(1, 2)))
+
+	t1, ok := l.Acquire()
+	if !ok {
+		t.Fatal("first acquire should succeed")
+	}
+	t2, ok := l.Acquire()
+	if !ok {
+		t.Fatal("second acquire should succeed")
+	}
+	if _, ok = l.Acquire(); ok {
+		t.Fatal("third acquire should be rejected")
+	}
+
+	t1.Success()
+	t1.Success()
+	if l.Inflight() != 1 {
+		t.Errorf("token released twice, inflight = %d", l.Inflight())
+	}
+	t2.Dropped()
+	if l.Limit() != 1 {
+		t.Errorf("want limit 1 after drop, got %d", l.Limit())
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	l := New(NewAIMD(WithInitialLimit(1), WithLimitRange(1, 1)))
+	block := make(chan struct{})
+	entered := make(chan struct{})
+	handler := HTTPMiddleware(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-block
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-entered
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	close(block)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("want 429, got %d", w.Code)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	l := New(NewAIMD(WithInitialLimit(4), WithLimitRange(1, 4), WithBackoff(0.5, time.Second)))
+	interceptor := UnaryServerInterceptor(l)
+	info := &grpc.UnaryServerInfo{FullMethod: "/demo.Service/Hello"}
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "overload")
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatal(err)
+	}
+	if l.Limit() != 2 {
+		t.Errorf("unavailable should back off, limit = %d", l.Limit())
+	}
+	if l.Inflight() != 0 {
+		t.Errorf("token not released, inflight = %d", l.Inflight())
+	}
+}
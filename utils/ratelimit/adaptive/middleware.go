@@ -0,0 +1,82 @@
+package adaptive
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HTTPMiddleware 超过并发上限时返回 429，响应 503/504 视为过载
+func HTTPMiddleware(l *Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := l.Acquire()
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				if e := recover(); e != nil {
+					token.Ignore()
+					panic(e)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+			ReleaseByStatus(token, rw.status)
+		})
+	}
+}
+
+// ReleaseByStatus 根据 HTTP 状态码归还名额
+func ReleaseByStatus(token *Token, status int) {
+	switch status {
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		token.Dropped()
+	default:
+		token.Success()
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// UnaryServerInterceptor 超过并发上限时返回 ResourceExhausted
+func UnaryServerInterceptor(l *Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		token, ok := l.Acquire()
+		if !ok {
+			return nil, status.Errorf(codes.ResourceExhausted, "%s is rejected by adaptive limiter", info.FullMethod)
+		}
+
+		defer func() {
+			if e := recover(); e != nil {
+				token.Ignore()
+				panic(e)
+			}
+		}()
+		resp, err := handler(ctx, req)
+		switch status.Code(err) {
+		case codes.DeadlineExceeded, codes.ResourceExhausted, codes.Unavailable:
+			token.Dropped()
+		default:
+			if ctx.Err() == context.DeadlineExceeded {
+				token.Dropped()
+			} else {
+				token.Success()
+			}
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,96 @@
+package adaptive
+
+import "time"
+
+const (
+	defaultInitialLimit = 20
+	defaultMinLimit     = 1
+	defaultMaxLimit     = 1000
+	defaultBackoffRatio = 0.9
+	defaultTimeout      = 5 * time.Second
+	defaultSmoothing    = 0.2
+	defaultTolerance    = 1.5
+	defaultLongWindow   = 600
+)
+
+type (
+	Option  func(*options)
+	options struct {
+		initialLimit int
+		minLimit     int
+		maxLimit     int
+		backoffRatio float64       // AIMD: 丢弃或超时后限流值乘以该系数
+		timeout      time.Duration // AIMD: 耗时超过该值视为过载
+		smoothing    float64       // Gradient2: 新旧限流值的平滑系数
+		tolerance    float64       // Gradient2: 允许短期延迟高于长期延迟的倍数
+		longWindow   int           // Gradient2: 长期延迟的指数平均窗口(样本数)
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		initialLimit: defaultInitialLimit,
+		minLimit:     defaultMinLimit,
+		maxLimit:     defaultMaxLimit,
+		backoffRatio: defaultBackoffRatio,
+		timeout:      defaultTimeout,
+		smoothing:    defaultSmoothing,
+		tolerance:    defaultTolerance,
+		longWindow:   defaultLongWindow,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.minLimit < 1 {
+		optCopy.minLimit = 1
+	}
+	if optCopy.maxLimit < optCopy.minLimit {
+		optCopy.maxLimit = optCopy.minLimit
+	}
+	return optCopy
+}
+
+// WithInitialLimit sets the concurrency limit used before any sample arrives.
+func WithInitialLimit(n int) Option {
+	return func(opts *options) {
+		opts.initialLimit = n
+	}
+}
+
+// WithLimitRange bounds the adjusted limit to [min, max].
+func WithLimitRange(min, max int) Option {
+	return func(opts *options) {
+		opts.minLimit = min
+		opts.maxLimit = max
+	}
+}
+
+// WithBackoff sets the AIMD decrease ratio and the latency treated as overload.
+func WithBackoff(ratio float64, timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.backoffRatio = ratio
+		opts.timeout = timeout
+	}
+}
+
+// WithSmoothing sets how fast Gradient2 moves towards the new limit, in (0, 1].
+func WithSmoothing(smoothing float64) Option {
+	return func(opts *options) {
+		opts.smoothing = smoothing
+	}
+}
+
+// WithTolerance sets how much the short-term latency may exceed the long-term one
+// before Gradient2 starts shrinking the limit.
+func WithTolerance(tolerance float64) Option {
+	return func(opts *options) {
+		opts.tolerance = tolerance
+	}
+}
+
+// WithLongWindow sets the sample count of the long-term latency average.
+func WithLongWindow(n int) Option {
+	return func(opts *options) {
+		opts.longWindow = n
+	}
+}
@@ -27,6 +27,18 @@ func Retry(attempts int, sleep time.Duration, fn func() error) error {
 	return nil
 }
 
+// Backoff 第 attempt 次失败后的等待时间，从 base 开始每次翻倍，最多为 max
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
 type Stop struct {
 	error
 }
@@ -21,3 +21,14 @@ func TestRetry(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range []time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 5: 5 * time.Second} {
+		if attempt == 0 {
+			continue
+		}
+		if d := Backoff(time.Second, 5*time.Second, attempt); d != want {
+			t.Errorf("attempt %d: backoff %v, want %v", attempt, d, want)
+		}
+	}
+}
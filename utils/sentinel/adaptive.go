@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go-demo/utils/ratelimit/adaptive"
+)
+
+// AdaptiveLimitMiddleware 自适应并发限流，并发上限根据请求延迟自动调整
+// 被拒绝时优先使用 WithBlockFallback 中对应路由的回调，默认返回 429
+func AdaptiveLimitMiddleware(limiter *adaptive.Limiter, opts ...Option) gin.HandlerFunc {
+	options := evaluateOptions(opts)
+	return func(ctx *gin.Context) {
+		token, ok := limiter.Acquire()
+		if !ok {
+			resource := ctx.FullPath()
+			if options.resourcePrefix != nil {
+				resource = strings.ReplaceAll(resource, options.resourcePrefix(ctx), "")
+			}
+			if fn, ok := options.blockFallbackMap[resource]; ok {
+				fn(ctx)
+			} else {
+				// 默认失败回调
+				ctx.AbortWithStatus(http.StatusTooManyRequests)
+			}
+			return
+		}
+
+		defer func() {
+			if e := recover(); e != nil {
+				token.Ignore()
+				panic(e)
+			}
+		}()
+		ctx.Next()
+		adaptive.ReleaseByStatus(token, ctx.Writer.Status())
+	}
+}
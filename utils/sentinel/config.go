@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alibaba/sentinel-golang/core/circuitbreaker"
+	"github.com/alibaba/sentinel-golang/core/flow"
+	"github.com/alibaba/sentinel-golang/core/system"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	FlowPrefix    = "flow"
+	BreakerPrefix = "breaker"
+)
+
+var ErrNoSentinelSection = errors.New("sentinel: config has no sentinel section")
+
+type Config struct {
+	Sentinel *Sentinel `yaml:"sentinel"`
+}
+
+type Sentinel struct {
+	Flows    []FlowRule    `yaml:"flows"`
+	Breakers []BreakerRule `yaml:"breakers"`
+	System   []SystemRule  `yaml:"system"`
+}
+
+type FlowRule struct {
+	Resource          string  `yaml:"resource"`          // 资源名
+	MetricType        int     `yaml:"metricType"`        // 流量控制类型，0 并发， 1 QPS
+	Count             float64 `yaml:"count"`             // 每秒只能通过多少个请求
+	ControlBehavior   int     `yaml:"controlBehavior"`   // 流量控制效果，0 直接拒绝， 2 排队等待
+	MaxQueueingTimeMs uint32  `yaml:"maxQueueingTimeMs"` // 排队等待最长等待时间
+}
+
+type BreakerRule struct {
+	Resource            string  `yaml:"resource"`            // 资源名
+	Strategy            int     `yaml:"strategy"`            // 熔断控制类型， 0慢请求, 1错误百分比, 2错误请求统计
+	RetryTimeoutMs      uint32  `yaml:"retryTimeoutMs"`      // 熔断后等待多长时间后重试
+	MinRequestAmount    uint64  `yaml:"minRequestAmount"`    // 触发熔断的最小请求数目，若当前统计窗口内的请求数小于此值，即使达到熔断条件规则也不会触发。
+	StatIntervalMs      uint32  `yaml:"statIntervalMs"`      // 统计的时间窗口长度(单位ms)
+	MaxAllowedRt        uint64  `yaml:"maxAllowedRt"`        // 响应时间超过该值，将被标记为慢请求
+	MaxSlowRequestRatio float64 `yaml:"maxSlowRequestRatio"` // 最大响应时间，只在Strategy为0时有效
+	MaxErrorRatio       float64 `yaml:"maxErrorRatio"`       // 最大错误占比，只在Strategy为1时有效
+	MaxErrorCount       uint64  `yaml:"maxErrorCount"`       // 最大错误数，只在Strategy为2时有效
+}
+
+// 系统自适应流控
+type SystemRule struct {
+	MetricType   int     `yaml:"metricType"`
+	TriggerCount float64 `yaml:"count"`
+	Strategy     int     `yaml:"strategy"`
+}
+
+// 转换后的 sentinel 规则
+type rules struct {
+	flows    []*flow.FlowRule
+	breakers []circuitbreaker.Rule
+	systems  []*system.SystemRule
+}
+
+// ParseConfig 解析配置并校验所有规则，任一规则不合法都返回错误
+func ParseConfig(data []byte) (*Config, error) {
+	config, _, err := parseConfig(data)
+	return config, err
+}
+
+func parseConfig(data []byte) (*Config, *rules, error) {
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, nil, err
+	}
+	if config.Sentinel == nil {
+		return nil, nil, ErrNoSentinelSection
+	}
+	rs, err := config.Sentinel.build()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &config, rs, nil
+}
+
+func (s *Sentinel) build() (*rules, error) {
+	var rs rules
+
+	// 流量控制规则
+	for i, r := range s.Flows {
+		rule := &flow.FlowRule{
+			Resource:          FlowPrefix + r.Resource,
+			MetricType:        flow.MetricType(r.MetricType),
+			ControlBehavior:   flow.ControlBehavior(r.ControlBehavior),
+			Count:             r.Count,
+			MaxQueueingTimeMs: r.MaxQueueingTimeMs,
+		}
+		if r.Resource == "" {
+			return nil, fmt.Errorf("sentinel: flows[%d]: empty resource name", i)
+		}
+		if err := flow.IsValidFlowRule(rule); err != nil {
+			return nil, fmt.Errorf("sentinel: flows[%d] %s: %v", i, r.Resource, err)
+		}
+		rs.flows = append(rs.flows, rule)
+	}
+
+	// 熔断降级控制规则
+	for i, r := range s.Breakers {
+		var rule circuitbreaker.Rule
+		switch circuitbreaker.Strategy(r.Strategy) {
+		case circuitbreaker.SlowRequestRatio:
+			rule = circuitbreaker.NewSlowRtRule(BreakerPrefix+r.Resource, r.StatIntervalMs, r.RetryTimeoutMs, r.MaxAllowedRt, r.MinRequestAmount, r.MaxSlowRequestRatio)
+		case circuitbreaker.ErrorRatio:
+			rule = circuitbreaker.NewErrorRatioRule(BreakerPrefix+r.Resource, r.StatIntervalMs, r.RetryTimeoutMs, r.MinRequestAmount, r.MaxErrorRatio)
+		case circuitbreaker.ErrorCount:
+			rule = circuitbreaker.NewErrorCountRule(BreakerPrefix+r.Resource, r.StatIntervalMs, r.RetryTimeoutMs, r.MinRequestAmount, r.MaxErrorCount)
+		default:
+			return nil, fmt.Errorf("sentinel: breakers[%d] %s: unknown strategy %d", i, r.Resource, r.Strategy)
+		}
+		if r.Resource == "" {
+			return nil, fmt.Errorf("sentinel: breakers[%d]: empty resource name", i)
+		}
+		if err := rule.IsApplicable(); err != nil {
+			return nil, fmt.Errorf("sentinel: breakers[%d] %s: %v", i, r.Resource, err)
+		}
+		rs.breakers = append(rs.breakers, rule)
+	}
+
+	// 系统自适应流控规则
+	for i, r := range s.System {
+		rule := &system.SystemRule{
+			MetricType:   system.MetricType(r.MetricType),
+			Strategy:     system.AdaptiveStrategy(r.Strategy),
+			TriggerCount: r.TriggerCount,
+		}
+		if err := system.IsValidSystemRule(rule); err != nil {
+			return nil, fmt.Errorf("sentinel: system[%d]: %v", i, err)
+		}
+		rs.systems = append(rs.systems, rule)
+	}
+	return &rs, nil
+}
+
+// 依次替换三类规则，中途失败时回滚到旧规则
+func (rs *rules) apply(prev *rules) error {
+	if prev == nil {
+		prev = &rules{}
+	}
+	if _, err := flow.LoadRules(rs.flows); err != nil {
+		flow.LoadRules(prev.flows)
+		return err
+	}
+	if _, err := circuitbreaker.LoadRules(rs.breakers); err != nil {
+		flow.LoadRules(prev.flows)
+		circuitbreaker.LoadRules(prev.breakers)
+		return err
+	}
+	if _, err := system.LoadRules(rs.systems); err != nil {
+		flow.LoadRules(prev.flows)
+		circuitbreaker.LoadRules(prev.breakers)
+		system.LoadRules(prev.systems)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/alibaba/sentinel-golang/api"
+
+	"go-demo/utils/fsnotify"
+)
+
+type (
+	LoadOption func(*Loader)
+
+	// Loader 加载规则配置文件，并在文件变化时热更新规则
+	// 新配置不合法时保留上一次生效的规则
+	Loader struct {
+		path     string
+		onReload func(*Config, error)
+		watcher  *fsnotify.FileWatcher
+
+		mu      sync.RWMutex
+		config  *Config
+		applied *rules
+	}
+)
+
+// WithReloadCallback sets the callback fired after every reload attempt,
+// err is not nil when the new config was rejected.
+func WithReloadCallback(fn func(config *Config, err error)) LoadOption {
+	return func(l *Loader) {
+		l.onReload = fn
+	}
+}
+
+// Load 初始化 sentinel 并加载 path 中的规则，之后监听文件变化
+func Load(path string, opts ...LoadOption) (*Loader, error) {
+	if err := api.Init(path); err != nil {
+		return nil, err
+	}
+	return newLoader(path, opts...)
+}
+
+func newLoader(path string, opts ...LoadOption) (*Loader, error) {
+	l := &Loader{path: filepath.Clean(path)}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.WatchFile(l.path, func() {
+		err := l.reload()
+		if l.onReload != nil {
+			l.onReload(l.Config(), err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.watcher = watcher
+	return l, nil
+}
+
+// Config 返回当前生效的配置
+func (l *Loader) Config() *Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.config
+}
+
+// Close 停止监听，已加载的规则继续生效
+func (l *Loader) Close() error {
+	return l.watcher.Close()
+}
+
+func (l *Loader) reload() error {
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return err
+	}
+	config, rs, err := parseConfig(data)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err = rs.apply(l.applied); err != nil {
+		return err
+	}
+	l.config = config
+	l.applied = rs
+	return nil
+}
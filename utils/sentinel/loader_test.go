@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alibaba/sentinel-golang/core/circuitbreaker"
+	"github.com/alibaba/sentinel-golang/core/flow"
+)
+
+const goodConfig = `
+sentinel:
+  app:
+    name: gin-test
+  flows:
+    - resource: /ping
+      metricType: 1
+      count: 10
+  breakers:
+    - resource: /ping
+      strategy: 1
+      retryTimeoutMs: 3000
+      minRequestAmount: 10
+      statIntervalMs: 5000
+      maxErrorRatio: 0.5
+`
+
+const changedConfig = `
+sentinel:
+  flows:
+    - resource: /ping
+      metricType: 1
+      count: 20
+    - resource: /pong
+      metricType: 1
+      count: 5
+`
+
+// 熔断策略不存在
+const badConfig = `
+sentinel:
+  flows:
+    - resource: /ping
+      metricType: 1
+      count: 1
+  breakers:
+    - resource: /ping
+      strategy: 9
+`
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(goodConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Sentinel.Flows) != 1 || len(config.Sentinel.Breakers) != 1 {
+		t.Errorf("unexpected config: %+v", config.Sentinel)
+	}
+
+	for name, data := range map[string]string{
+		"bad strategy":   badConfig,
+		"no section":     "flows: []",
+		"empty resource": "sentinel:\n  flows:\n    - count: 1\n",
+		"negative count": "sentinel:\n  flows:\n    - resource: /a\n      count: -1\n",
+		"broken yaml":    "sentinel: [",
+	} {
+		if _, err := ParseConfig([]byte(data)); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func flowCount(resource string) float64 {
+	for _, r := range flow.GetRules() {
+		if r.Resource == FlowPrefix+resource {
+			return r.Count
+		}
+	}
+	return -1
+}
+
+func TestLoaderReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sentinel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err = ioutil.WriteFile(path, []byte(goodConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan error, 10)
+	loader, err := newLoader(path, WithReloadCallback(func(config *Config, err error) {
+		reloaded <- err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loader.Close()
+
+	if flowCount("/ping") != 10 || len(circuitbreaker.GetResRules(BreakerPrefix+"/ping")) != 1 {
+		t.Fatal("initial rules not loaded")
+	}
+
+	wait := func() error {
+		select {
+		case err := <-reloaded:
+			return err
+		case <-time.After(3 * time.Second):
+			t.Fatal("reload timeout")
+		}
+		return nil
+	}
+
+	ioutil.WriteFile(path, []byte(changedConfig), 0644)
+	if err = wait(); err != nil {
+		t.Fatal(err)
+	}
+	if flowCount("/ping") != 20 || flowCount("/pong") != 5 {
+		t.Errorf("rules not swapped: %+v", flow.GetRules())
+	}
+	if len(circuitbreaker.GetResRules(BreakerPrefix+"/ping")) != 0 {
+		t.Error("breaker rules should be removed")
+	}
+
+	// 错误的配置不生效，保留上一次的规则
+	ioutil.WriteFile(path, []byte(badConfig), 0644)
+	if err = wait(); err == nil {
+		t.Fatal("want reload error")
+	}
+	if flowCount("/ping") != 20 || loader.Config().Sentinel.Flows[0].Count != 20 {
+		t.Error("last good rules should be kept")
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := newLoader(filepath.Join(os.TempDir(), "not-exist", "config.yaml")); err == nil {
+		t.Error("want error for missing file")
+	}
+}
@@ -0,0 +1,34 @@
+package seq
+
+import "errors"
+
+/**
+分布式ID生成器：
+- Snowflake: 41位毫秒时间 + 10位 worker ID + 12位序列号，worker ID 需要显式分配
+- Sonyflake: 39位10毫秒时间 + 8位序列号 + 16位机器ID，默认取内网IP低16位
+- ULID: 48位毫秒时间 + 80位随机数，26位 Crockford base32，字典序即时间序
+- UUIDv7: RFC 9562，48位毫秒时间 + 12位计数器 + 62位随机数
+- Segment: 号段模式，从存储中批量取号，双缓冲异步预取，不依赖时钟
+同一个生成器产生的ID严格递增；时钟小幅回拨时沿用上次的时间戳继续递增，
+回拨超过 WithMaxClockBackward 返回 ErrClockBackward
+*/
+
+var (
+	ErrClockBackward    = errors.New("seq: clock moved backwards")
+	ErrTimeOverflow     = errors.New("seq: timestamp overflows the id layout")
+	ErrWorkerID         = errors.New("seq: worker id out of range")
+	ErrMachineID        = errors.New("seq: can not get machine id")
+	ErrInvalidID        = errors.New("seq: invalid id")
+	ErrEpoch            = errors.New("seq: epoch is in the future")
+	ErrSegmentExhausted = errors.New("seq: segment store returned an empty segment")
+)
+
+// Generator 数值型ID生成器，Snowflake、Sonyflake、Segment 实现
+type Generator interface {
+	NextID() (uint64, error)
+}
+
+// StringGenerator 字符串ID生成器，ULID、UUIDv7 实现，字典序递增
+type StringGenerator interface {
+	NextString() (string, error)
+}
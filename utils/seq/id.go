@@ -2,37 +2,62 @@ package seq
 
 import (
 	"context"
-	"github.com/sony/sonyflake"
-	"google.golang.org/grpc/metadata"
 	"strconv"
+	"sync"
 	"time"
+
+	"google.golang.org/grpc/metadata"
 )
 
 var (
-	sf        *sonyflake.Sonyflake
 	startTime = time.Date(2019, 7, 28, 0, 0, 0, 0, time.UTC)
+
+	defaultMu  sync.RWMutex
+	defaultGen Generator
 )
 
-func init() {
-	var st sonyflake.Settings
-	st.StartTime = startTime
-	sf = sonyflake.NewSonyflake(st)
-	if sf == nil {
-		panic("sonyflake not created")
+// SetDefault 设置 NextNumID、NextID 使用的生成器，多实例部署时应使用分配了 worker ID 的 Snowflake
+func SetDefault(g Generator) {
+	defaultMu.Lock()
+	defaultGen = g
+	defaultMu.Unlock()
+}
+
+// Default 未设置时懒加载 Sonyflake，机器ID取内网IP低16位，取不到时返回 ErrMachineID
+func Default() (Generator, error) {
+	defaultMu.RLock()
+	g := defaultGen
+	defaultMu.RUnlock()
+	if g != nil {
+		return g, nil
 	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultGen == nil {
+		sf, err := NewSonyflake()
+		if err != nil {
+			return nil, err
+		}
+		defaultGen = sf
+	}
+	return defaultGen, nil
 }
 
-func NextNumID() uint64 {
-	id, _ := sf.NextID()
-	return id
+func NextNumID() (uint64, error) {
+	g, err := Default()
+	if err != nil {
+		return 0, err
+	}
+	return g.NextID()
 }
 
 const IdPrefixKey = "p-id"
 
-func NextID(ctx context.Context) string {
-	nextId, err := sf.NextID()
+func NextID(ctx context.Context) (string, error) {
+	nextId, err := NextNumID()
 	if err != nil {
-		return err.Error()
+		return "", err
 	}
 	// uit64 转成 str
 	id := strconv.FormatUint(nextId, 10)
@@ -43,14 +68,14 @@ func NextID(ctx context.Context) string {
 
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
 		if ps := md.Get(IdPrefixKey); len(ps) != 0 {
-			return ps[0] + id
+			return ps[0] + id, nil
 		}
 	}
 
 	if md, ok := metadata.FromOutgoingContext(ctx); ok {
 		if ps := md.Get(IdPrefixKey); len(ps) != 0 {
-			return ps[0] + id
+			return ps[0] + id, nil
 		}
 	}
-	return id
+	return id, nil
 }
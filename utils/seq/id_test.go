@@ -2,26 +2,113 @@ package seq
 
 import (
 	"context"
-	"encoding/json"
-	"github.com/sony/sonyflake"
-	"google.golang.org/grpc/metadata"
+	"sync"
 	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
 )
 
+// fakeClock 测试用时钟，sleep 直接拨快时间
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *fakeClock) options() []Option {
+	return []Option{WithClock(c.Now), func(o *options) { o.sleep = c.Add }}
+}
+
 // 利用雪花算法生成不重复ID
 func TestID(t *testing.T) {
-	id := NextNumID()
-	t.Log(id)
-	body, err := json.Marshal(sonyflake.Decompose(id))
+	sf, err := NewSonyflake(WithMachineID(7))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	var last uint64
+	for i := 0; i < 1000; i++ {
+		id, err := sf.NextID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= last {
+			t.Fatalf("id not increasing: %d <= %d", id, last)
+		}
+		last = id
+	}
+	parts := sf.Decode(last)
+	if parts.MachineID != 7 || time.Since(parts.Time) > time.Second {
+		t.Errorf("unexpected parts %+v", parts)
 	}
-	t.Log(string(body))
 }
 
-//根据上下文生成带前缀的ID
+// 根据上下文生成带前缀的ID
 func TestNextID(t *testing.T) {
+	sf, err := NewSnowflake(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDefault(sf)
 	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdPrefixKey, "P66-"))
-	id := NextID(ctx)
+	id, err := NextID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
 	t.Log(id)
 }
+
+func TestSnowflake(t *testing.T) {
+	if _, err := NewSnowflake(MaxSnowflakeWorkerID + 1); err != ErrWorkerID {
+		t.Errorf("expected ErrWorkerID, got %v", err)
+	}
+
+	clock := newFakeClock()
+	sf, err := NewSnowflake(42, clock.options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := clock.Now()
+	var last uint64
+	// 同一毫秒内序列号用完后等到下一毫秒
+	for i := 0; i < 10000; i++ {
+		id, err := sf.NextID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= last {
+			t.Fatalf("id not increasing at %d", i)
+		}
+		last = id
+	}
+	parts := sf.Decode(last)
+	if parts.WorkerID != 42 || !parts.Time.Equal(start.Add(2*time.Millisecond)) || parts.Sequence != 10000-2*4096-1 {
+		t.Errorf("unexpected parts %+v", parts)
+	}
+
+	// 小幅回拨沿用上次时间
+	clock.Add(-5 * time.Millisecond)
+	id, err := sf.NextID()
+	if err != nil || id <= last {
+		t.Fatalf("small rollback: %d %v", id, err)
+	}
+	clock.Add(-time.Second)
+	if _, err = sf.NextID(); err != ErrClockBackward {
+		t.Errorf("expected ErrClockBackward, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package lease
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// ConsulBackend 每个 worker ID 一个 session 锁，session 失效时 key 被删除。
+// Consul 要求 TTL 不小于 10s，实际失效时间最长可达 2 倍 TTL
+type ConsulBackend struct {
+	client *api.Client
+	prefix string
+
+	mu       sync.Mutex
+	sessions map[int64]string
+}
+
+// NewConsulBackend prefix 为空时使用 "seq/worker/"
+func NewConsulBackend(client *api.Client, prefix string) *ConsulBackend {
+	if prefix == "" {
+		prefix = "seq/worker/"
+	}
+	return &ConsulBackend{client: client, prefix: prefix, sessions: make(map[int64]string)}
+}
+
+func (b *ConsulBackend) Acquire(ctx context.Context, workerID int64, owner string, ttl time.Duration) (bool, error) {
+	q := (&api.WriteOptions{}).WithContext(ctx)
+	session, _, err := b.client.Session().CreateNoChecks(&api.SessionEntry{
+		Name:     owner,
+		TTL:      ttl.String(),
+		Behavior: api.SessionBehaviorDelete,
+	}, q)
+	if err != nil {
+		return false, err
+	}
+	ok, _, err := b.client.KV().Acquire(&api.KVPair{
+		Key:     b.key(workerID),
+		Value:   []byte(owner),
+		Session: session,
+	}, q)
+	if err != nil || !ok {
+		b.client.Session().Destroy(session, q)
+		return false, err
+	}
+	b.mu.Lock()
+	b.sessions[workerID] = session
+	b.mu.Unlock()
+	return true, nil
+}
+
+func (b *ConsulBackend) Renew(ctx context.Context, workerID int64, owner string, ttl time.Duration) error {
+	session, ok := b.session(workerID)
+	if !ok {
+		return ErrLeaseLost
+	}
+	entry, _, err := b.client.Session().Renew(session, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	// session 已失效
+	if entry == nil {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (b *ConsulBackend) Release(ctx context.Context, workerID int64, owner string) error {
+	session, ok := b.session(workerID)
+	if !ok {
+		return nil
+	}
+	b.mu.Lock()
+	delete(b.sessions, workerID)
+	b.mu.Unlock()
+	// 销毁 session 时按 Behavior 删除 key
+	_, err := b.client.Session().Destroy(session, (&api.WriteOptions{}).WithContext(ctx))
+	return err
+}
+
+func (b *ConsulBackend) session(workerID int64) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.sessions[workerID]
+	return s, ok
+}
+
+func (b *ConsulBackend) key(workerID int64) string {
+	return b.prefix + strconv.FormatInt(workerID, 10)
+}
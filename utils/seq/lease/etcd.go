@@ -0,0 +1,158 @@
+package lease
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EtcdBackend 通过 etcd v3 的 gRPC gateway(JSON over HTTP)租用 worker ID，
+// 每个 worker ID 一个绑定了 etcd lease 的 key，lease 过期时 key 自动删除。
+// 仓库锁定的 clientv3 与 grpc 版本不兼容，这里不依赖 clientv3
+type EtcdBackend struct {
+	// APIPath gateway 路径前缀，etcd 3.3 为 /v3beta，3.4 及以后为 /v3
+	APIPath string
+	Client  *http.Client
+
+	endpoint string
+	prefix   string
+
+	mu     sync.Mutex
+	leases map[int64]int64
+}
+
+// NewEtcdBackend endpoint 如 http://127.0.0.1:2379，prefix 为空时使用 "/seq/worker/"
+func NewEtcdBackend(endpoint, prefix string) *EtcdBackend {
+	if prefix == "" {
+		prefix = "/seq/worker/"
+	}
+	return &EtcdBackend{
+		APIPath:  "/v3",
+		Client:   http.DefaultClient,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		prefix:   prefix,
+		leases:   make(map[int64]int64),
+	}
+}
+
+func (b *EtcdBackend) Acquire(ctx context.Context, workerID int64, owner string, ttl time.Duration) (bool, error) {
+	var grant struct {
+		ID  int64 `json:"ID,string"`
+		TTL int64 `json:"TTL,string"`
+	}
+	if err := b.call(ctx, "/lease/grant", map[string]interface{}{"TTL": int64(ttl.Seconds())}, &grant); err != nil {
+		return false, err
+	}
+
+	// key 不存在时才写入
+	key := b.encode(b.key(workerID))
+	var txn struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	err := b.call(ctx, "/kv/txn", map[string]interface{}{
+		"compare": []map[string]interface{}{
+			{"key": key, "target": "CREATE", "result": "EQUAL", "create_revision": "0"},
+		},
+		"success": []map[string]interface{}{
+			{"request_put": map[string]interface{}{"key": key, "value": b.encode(owner), "lease": strconv.FormatInt(grant.ID, 10)}},
+		},
+	}, &txn)
+	if err != nil || !txn.Succeeded {
+		b.revoke(ctx, grant.ID)
+		return false, err
+	}
+	b.mu.Lock()
+	b.leases[workerID] = grant.ID
+	b.mu.Unlock()
+	return true, nil
+}
+
+func (b *EtcdBackend) Renew(ctx context.Context, workerID int64, owner string, ttl time.Duration) error {
+	id, ok := b.lease(workerID)
+	if !ok {
+		return ErrLeaseLost
+	}
+	var resp struct {
+		Result struct {
+			TTL int64 `json:"TTL,string"`
+		} `json:"result"`
+	}
+	if err := b.call(ctx, "/lease/keepalive", map[string]interface{}{"ID": strconv.FormatInt(id, 10)}, &resp); err != nil {
+		return err
+	}
+	// lease 已过期时 TTL 为 0 或负数
+	if resp.Result.TTL <= 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (b *EtcdBackend) Release(ctx context.Context, workerID int64, owner string) error {
+	id, ok := b.lease(workerID)
+	if !ok {
+		return nil
+	}
+	b.mu.Lock()
+	delete(b.leases, workerID)
+	b.mu.Unlock()
+	return b.revoke(ctx, id)
+}
+
+// revoke 吊销 lease，绑定的 key 随之删除
+func (b *EtcdBackend) revoke(ctx context.Context, id int64) error {
+	return b.call(ctx, "/kv/lease/revoke", map[string]interface{}{"ID": strconv.FormatInt(id, 10)}, nil)
+}
+
+func (b *EtcdBackend) lease(workerID int64) (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id, ok := b.leases[workerID]
+	return id, ok
+}
+
+func (b *EtcdBackend) call(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.endpoint+b.APIPath+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		// keepalive 一个不存在的 lease
+		if strings.Contains(e.Error, "lease not found") {
+			return ErrLeaseLost
+		}
+		return fmt.Errorf("lease: etcd %s: %d %s", path, resp.StatusCode, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (b *EtcdBackend) key(workerID int64) string {
+	return b.prefix + strconv.FormatInt(workerID, 10)
+}
+
+func (b *EtcdBackend) encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
@@ -0,0 +1,187 @@
+package lease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+/**
+Snowflake worker ID 租约：
+多个副本各自从 etcd、Consul 或 Redis 租用一个唯一的 worker ID，后台定期续约。
+续约失败时本地在租约到期前就停止发号，租约被他人接管后不会再产生重复ID:
+
+	l, err := lease.Acquire(ctx, lease.NewRedisBackend(client, ""))
+	sf, err := seq.NewLeasedSnowflake(l)
+	seq.SetDefault(sf)
+	defer l.Close(context.Background())
+
+租约丢失后不会自动重新租用，可以监听 Done() 重新 Acquire 并创建新的生成器
+*/
+
+var (
+	ErrLeaseLost  = errors.New("lease: worker id lease lost")
+	ErrNoWorkerID = errors.New("lease: no free worker id")
+)
+
+// Backend 协调服务
+type Backend interface {
+	// Acquire 占用 workerID，已被其他 owner 占用时返回 false
+	Acquire(ctx context.Context, workerID int64, owner string, ttl time.Duration) (bool, error)
+	// Renew 续约，租约已过期或不再属于 owner 时返回 ErrLeaseLost
+	Renew(ctx context.Context, workerID int64, owner string, ttl time.Duration) error
+	// Release 释放租约，不属于 owner 时忽略
+	Release(ctx context.Context, workerID int64, owner string) error
+}
+
+// Lease 实现 seq.WorkerLease
+type Lease struct {
+	backend  Backend
+	opts     *options
+	workerID int64
+
+	mu       sync.Mutex
+	deadline time.Time
+	lost     bool
+	done     chan struct{}
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Acquire 从随机位置开始依次尝试，避免多个副本同时启动时争抢同一个 ID
+func Acquire(ctx context.Context, backend Backend, opts ...Option) (*Lease, error) {
+	o := evaluateOptions(opts)
+	if o.owner == "" {
+		o.owner = defaultOwner()
+	}
+	n := o.maxWorkerID + 1
+	offset, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return nil, err
+	}
+	for i := int64(0); i < n; i++ {
+		id := (offset.Int64() + i) % n
+		start := o.clock()
+		ok, err := backend.Acquire(ctx, id, o.owner, o.ttl)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		l := &Lease{
+			backend:  backend,
+			opts:     o,
+			workerID: id,
+			deadline: start.Add(o.ttl),
+			done:     make(chan struct{}),
+			stop:     make(chan struct{}),
+		}
+		l.wg.Add(1)
+		go l.renewLoop()
+		return l, nil
+	}
+	return nil, ErrNoWorkerID
+}
+
+func (l *Lease) WorkerID() int64 {
+	return l.workerID
+}
+
+func (l *Lease) Owner() string {
+	return l.opts.owner
+}
+
+// Valid 租约丢失或本地估计已过期时返回 ErrLeaseLost
+func (l *Lease) Valid() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lost || !l.opts.clock().Before(l.deadline) {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Done 租约丢失或 Close 后关闭
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Close 停止续约并释放 worker ID
+func (l *Lease) Close(ctx context.Context) error {
+	l.mu.Lock()
+	select {
+	case <-l.stop:
+		l.mu.Unlock()
+		return nil
+	default:
+		close(l.stop)
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	l.markLost()
+	return l.backend.Release(ctx, l.workerID, l.opts.owner)
+}
+
+func (l *Lease) renewLoop() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.opts.renewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		if !l.renew() {
+			return
+		}
+	}
+}
+
+// renew 续约失败但未过期时下次重试，返回 false 表示租约已丢失
+func (l *Lease) renew() bool {
+	start := l.opts.clock()
+	// 单次续约不能超过剩余的有效期
+	l.mu.Lock()
+	remaining := l.deadline.Sub(start)
+	l.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), remaining)
+	err := l.backend.Renew(ctx, l.workerID, l.opts.owner, l.opts.ttl)
+	cancel()
+
+	switch {
+	case err == nil:
+		l.mu.Lock()
+		l.deadline = start.Add(l.opts.ttl)
+		l.mu.Unlock()
+		return true
+	case errors.Is(err, ErrLeaseLost) || l.Valid() != nil:
+		l.markLost()
+		return false
+	default:
+		return true
+	}
+}
+
+func (l *Lease) markLost() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.lost {
+		l.lost = true
+		close(l.done)
+	}
+}
+
+func defaultOwner() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
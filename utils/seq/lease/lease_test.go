@@ -0,0 +1,311 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/hashicorp/consul/api"
+
+	"go-demo/utils/seq"
+)
+
+// fakeEtcd etcd v3 gateway 中用到的几个接口
+type fakeEtcd struct {
+	mu     sync.Mutex
+	nextID int64
+	leases map[int64][]string // lease -> keys
+	keys   map[string]string
+}
+
+func newFakeEtcd(t *testing.T) (*fakeEtcd, string) {
+	f := &fakeEtcd{leases: make(map[int64][]string), keys: make(map[string]string)}
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+	return f, ts.URL
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var req struct {
+		ID      json.Number `json:"ID"`
+		Compare []struct {
+			Key string `json:"key"`
+		} `json:"compare"`
+		Success []struct {
+			Put struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+				Lease string `json:"lease"`
+			} `json:"request_put"`
+		} `json:"success"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	id, _ := req.ID.Int64()
+
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		f.nextID++
+		f.leases[f.nextID] = nil
+		json.NewEncoder(w).Encode(map[string]string{"ID": strconv.FormatInt(f.nextID, 10), "TTL": "10"})
+	case "/v3/kv/txn":
+		if _, ok := f.keys[req.Compare[0].Key]; ok {
+			json.NewEncoder(w).Encode(map[string]bool{})
+			return
+		}
+		put := req.Success[0].Put
+		lease, _ := strconv.ParseInt(put.Lease, 10, 64)
+		f.keys[put.Key] = put.Value
+		f.leases[lease] = append(f.leases[lease], put.Key)
+		json.NewEncoder(w).Encode(map[string]bool{"succeeded": true})
+	case "/v3/lease/keepalive":
+		if _, ok := f.leases[id]; !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]string{"ID": req.ID.String()}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]string{"ID": req.ID.String(), "TTL": "10"}})
+	case "/v3/kv/lease/revoke":
+		f.revoke(id)
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeEtcd) revoke(id int64) {
+	for _, k := range f.leases[id] {
+		delete(f.keys, k)
+	}
+	delete(f.leases, id)
+}
+
+func (f *fakeEtcd) expireAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id := range f.leases {
+		f.revoke(id)
+	}
+}
+
+// fakeConsul Consul session 和 KV 锁
+type fakeConsul struct {
+	mu       sync.Mutex
+	nextID   int
+	sessions map[string]bool
+	locks    map[string]string // key -> session
+}
+
+func newFakeConsul(t *testing.T) (*fakeConsul, *api.Client) {
+	f := &fakeConsul{sessions: make(map[string]bool), locks: make(map[string]string)}
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+	client, err := api.NewClient(&api.Config{Address: strings.TrimPrefix(ts.URL, "http://")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, client
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch path := r.URL.Path; {
+	case path == "/v1/session/create":
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.sessions[id] = true
+		json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	case strings.HasPrefix(path, "/v1/session/renew/"):
+		id := strings.TrimPrefix(path, "/v1/session/renew/")
+		if !f.sessions[id] {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]string{{"ID": id}})
+	case strings.HasPrefix(path, "/v1/session/destroy/"):
+		f.destroy(strings.TrimPrefix(path, "/v1/session/destroy/"))
+		w.Write([]byte("true"))
+	case strings.HasPrefix(path, "/v1/kv/"):
+		key := strings.TrimPrefix(path, "/v1/kv/")
+		session := r.URL.Query().Get("acquire")
+		if held, ok := f.locks[key]; !f.sessions[session] || ok && held != session {
+			w.Write([]byte("false"))
+			return
+		}
+		f.locks[key] = session
+		w.Write([]byte("true"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeConsul) destroy(id string) {
+	delete(f.sessions, id)
+	for k, s := range f.locks {
+		if s == id {
+			delete(f.locks, k)
+		}
+	}
+}
+
+func (f *fakeConsul) expireAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id := range f.sessions {
+		f.destroy(id)
+	}
+}
+
+type backendCase struct {
+	name   string
+	new    func() Backend // 模拟多个进程，各自一个 backend
+	expire func()
+}
+
+func testBackends(t *testing.T) []backendCase {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	etcd, endpoint := newFakeEtcd(t)
+	consul, consulClient := newFakeConsul(t)
+	return []backendCase{
+		{"redis", func() Backend { return NewRedisBackend(client, "") }, mr.FlushAll},
+		{"etcd", func() Backend { return NewEtcdBackend(endpoint, "") }, etcd.expireAll},
+		{"consul", func() Backend { return NewConsulBackend(consulClient, "") }, consul.expireAll},
+	}
+}
+
+func TestAcquireUnique(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range testBackends(t) {
+		opts := []Option{WithMaxWorkerID(1), WithTTL(10 * time.Second)}
+		a, err := Acquire(ctx, c.new(), append(opts, WithOwner("a"))...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		b, err := Acquire(ctx, c.new(), append(opts, WithOwner("b"))...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if a.WorkerID() == b.WorkerID() {
+			t.Errorf("%s: both leased worker %d", c.name, a.WorkerID())
+		}
+		if _, err = Acquire(ctx, c.new(), append(opts, WithOwner("c"))...); err != ErrNoWorkerID {
+			t.Errorf("%s: expected ErrNoWorkerID, got %v", c.name, err)
+		}
+
+		// 释放后可以被其他进程租用
+		if err = a.Close(ctx); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if a.Valid() == nil {
+			t.Errorf("%s: closed lease still valid", c.name)
+		}
+		d, err := Acquire(ctx, c.new(), append(opts, WithOwner("d"))...)
+		if err != nil || d.WorkerID() != a.WorkerID() {
+			t.Errorf("%s: reacquire released id: %v", c.name, err)
+		}
+		b.Close(ctx)
+		d.Close(ctx)
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range testBackends(t) {
+		l, err := Acquire(ctx, c.new(), WithTTL(10*time.Second), WithRenewInterval(10*time.Millisecond))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		sf, err := seq.NewLeasedSnowflake(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = sf.NextID(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		// 续约正常进行
+		time.Sleep(50 * time.Millisecond)
+		if err = l.Valid(); err != nil {
+			t.Fatalf("%s: lease lost after renewals: %v", c.name, err)
+		}
+
+		c.expire()
+		select {
+		case <-l.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%s: lost lease not detected", c.name)
+		}
+		if _, err = sf.NextID(); err != ErrLeaseLost {
+			t.Errorf("%s: expected ErrLeaseLost, got %v", c.name, err)
+		}
+		l.Close(ctx)
+	}
+}
+
+// unreachable 续约时网络不通
+type unreachable struct {
+	Backend
+}
+
+func (unreachable) Renew(context.Context, int64, string, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestLeaseExpiresLocally(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	var mu sync.Mutex
+	now := time.Now()
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	l, err := Acquire(context.Background(), unreachable{NewRedisBackend(client, "")},
+		WithTTL(time.Second), WithRenewInterval(10*time.Millisecond), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close(context.Background())
+
+	// 续约失败但还在有效期内，继续发号
+	time.Sleep(30 * time.Millisecond)
+	if err = l.Valid(); err != nil {
+		t.Fatalf("lease invalid before deadline: %v", err)
+	}
+
+	mu.Lock()
+	now = now.Add(time.Second)
+	mu.Unlock()
+	if err = l.Valid(); err != ErrLeaseLost {
+		t.Errorf("expected ErrLeaseLost after deadline, got %v", err)
+	}
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Error("renew loop did not give up after deadline")
+	}
+}
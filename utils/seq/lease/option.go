@@ -0,0 +1,71 @@
+package lease
+
+import (
+	"time"
+
+	"go-demo/utils/seq"
+)
+
+const defaultTTL = 10 * time.Second
+
+type (
+	Option  func(*options)
+	options struct {
+		ttl           time.Duration
+		renewInterval time.Duration
+		maxWorkerID   int64
+		owner         string
+		clock         func() time.Time
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		ttl:         defaultTTL,
+		maxWorkerID: seq.MaxSnowflakeWorkerID,
+		clock:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	if optCopy.renewInterval <= 0 {
+		optCopy.renewInterval = optCopy.ttl / 3
+	}
+	return optCopy
+}
+
+// WithTTL sets the lease TTL. Consul requires at least 10s.
+func WithTTL(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.ttl = ttl
+	}
+}
+
+// WithRenewInterval sets how often the lease is renewed, default TTL/3.
+func WithRenewInterval(d time.Duration) Option {
+	return func(opts *options) {
+		opts.renewInterval = d
+	}
+}
+
+// WithMaxWorkerID limits the worker IDs to [0, max].
+func WithMaxWorkerID(max int64) Option {
+	return func(opts *options) {
+		opts.maxWorkerID = max
+	}
+}
+
+// WithOwner sets the value stored in the backend to identify this process,
+// default hostname-pid-random.
+func WithOwner(owner string) Option {
+	return func(opts *options) {
+		opts.owner = owner
+	}
+}
+
+// WithClock replaces time.Now, mainly for tests.
+func WithClock(clock func() time.Time) Option {
+	return func(opts *options) {
+		opts.clock = clock
+	}
+}
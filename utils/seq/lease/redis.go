@@ -0,0 +1,62 @@
+package lease
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	// 值为 owner 时才续期
+	renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// 值为 owner 时才删除
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// RedisBackend 每个 worker ID 一个带过期时间的 key，值为 owner
+type RedisBackend struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisBackend prefix 为空时使用 "seq:worker:"
+func NewRedisBackend(client redis.Cmdable, prefix string) *RedisBackend {
+	if prefix == "" {
+		prefix = "seq:worker:"
+	}
+	return &RedisBackend{client: client, prefix: prefix}
+}
+
+func (b *RedisBackend) Acquire(ctx context.Context, workerID int64, owner string, ttl time.Duration) (bool, error) {
+	return b.client.SetNX(b.key(workerID), owner, ttl).Result()
+}
+
+func (b *RedisBackend) Renew(ctx context.Context, workerID int64, owner string, ttl time.Duration) error {
+	n, err := renewScript.Run(b.client, []string{b.key(workerID)}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (b *RedisBackend) Release(ctx context.Context, workerID int64, owner string) error {
+	return releaseScript.Run(b.client, []string{b.key(workerID)}, owner).Err()
+}
+
+func (b *RedisBackend) key(workerID int64) string {
+	return b.prefix + strconv.FormatInt(workerID, 10)
+}
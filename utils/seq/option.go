@@ -0,0 +1,86 @@
+package seq
+
+import (
+	"crypto/rand"
+	"io"
+	"time"
+)
+
+const (
+	defaultMaxClockBackward = 10 * time.Millisecond
+	defaultStep             = 1000
+)
+
+// 所有生成器共用一套选项，不适用的选项会被忽略
+type (
+	Option  func(*options)
+	options struct {
+		epoch            time.Time
+		clock            func() time.Time
+		sleep            func(time.Duration)
+		maxClockBackward time.Duration
+		entropy          io.Reader
+		machineID        func() (uint16, error)
+		step             int64
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		epoch:            startTime,
+		clock:            time.Now,
+		sleep:            time.Sleep,
+		maxClockBackward: defaultMaxClockBackward,
+		entropy:          rand.Reader,
+		step:             defaultStep,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	return optCopy
+}
+
+// WithEpoch sets the custom epoch of Snowflake and Sonyflake IDs.
+// Changing it for an existing deployment produces duplicate IDs.
+func WithEpoch(epoch time.Time) Option {
+	return func(opts *options) {
+		opts.epoch = epoch
+	}
+}
+
+// WithClock replaces time.Now, mainly for tests.
+func WithClock(clock func() time.Time) Option {
+	return func(opts *options) {
+		opts.clock = clock
+	}
+}
+
+// WithMaxClockBackward sets how far the clock may move backwards before
+// NextID returns ErrClockBackward. Smaller rollbacks keep using the last
+// timestamp so IDs stay monotonic.
+func WithMaxClockBackward(d time.Duration) Option {
+	return func(opts *options) {
+		opts.maxClockBackward = d
+	}
+}
+
+// WithEntropy sets the random source of ULID and UUIDv7, default crypto/rand.
+func WithEntropy(r io.Reader) Option {
+	return func(opts *options) {
+		opts.entropy = r
+	}
+}
+
+// WithMachineID sets the Sonyflake machine ID instead of the lower 16 bits of the private IP.
+func WithMachineID(id uint16) Option {
+	return func(opts *options) {
+		opts.machineID = func() (uint16, error) { return id, nil }
+	}
+}
+
+// WithStep sets how many IDs a segment generator fetches from the store at once.
+func WithStep(step int64) Option {
+	return func(opts *options) {
+		opts.step = step
+	}
+}
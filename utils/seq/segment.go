@@ -0,0 +1,141 @@
+package seq
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+// Segment 号段 [Start, End]
+type Segment struct {
+	Start int64
+	End   int64
+}
+
+// SegmentStore 号段存储，同一个 tag 每次返回的号段必须递增且不重叠，
+// 一般实现为 UPDATE max_id = max_id + step 或 Redis INCRBY
+type SegmentStore interface {
+	NextSegment(ctx context.Context, tag string, step int64) (Segment, error)
+}
+
+// SegmentGenerator 号段模式(美团 Leaf-segment)，当前号段剩余不足 20% 时异步预取下一个号段，
+// 存储短暂不可用时仍可以继续发号。进程重启会浪费未用完的号段，ID 不连续但严格递增
+type SegmentGenerator struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	store   SegmentStore
+	tag     string
+	opts    *options
+	current Segment
+	pos     int64
+	next    *Segment
+	loading bool
+	loadErr error
+}
+
+// NewSegmentGenerator 同步加载第一个号段，存储不可用时直接返回错误
+func NewSegmentGenerator(store SegmentStore, tag string, opts ...Option) (*SegmentGenerator, error) {
+	g := &SegmentGenerator{store: store, tag: tag, opts: evaluateOptions(opts)}
+	g.cond = sync.NewCond(&g.mu)
+	seg, err := g.fetch()
+	if err != nil {
+		return nil, err
+	}
+	g.current, g.pos = seg, seg.Start
+	return g, nil
+}
+
+func (g *SegmentGenerator) NextID() (uint64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for g.pos > g.current.End {
+		if g.next != nil {
+			g.current, g.pos, g.next = *g.next, g.next.Start, nil
+			break
+		}
+		if !g.loading {
+			g.startLoad()
+		}
+		g.cond.Wait()
+		if g.next == nil && g.loadErr != nil {
+			return 0, g.loadErr
+		}
+	}
+
+	id := g.pos
+	g.pos++
+	if g.next == nil && !g.loading && (g.current.End-g.pos+1)*5 < g.current.End-g.current.Start+1 {
+		g.startLoad()
+	}
+	return uint64(id), nil
+}
+
+// startLoad 需持有锁
+func (g *SegmentGenerator) startLoad() {
+	g.loading, g.loadErr = true, nil
+	go func() {
+		seg, err := g.fetch()
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.loading = false
+		if err != nil {
+			g.loadErr = err
+		} else {
+			g.next = &seg
+		}
+		g.cond.Broadcast()
+	}()
+}
+
+func (g *SegmentGenerator) fetch() (Segment, error) {
+	seg, err := g.store.NextSegment(context.Background(), g.tag, g.opts.step)
+	if err != nil {
+		return Segment{}, err
+	}
+	if seg.End < seg.Start {
+		return Segment{}, ErrSegmentExhausted
+	}
+	return seg, nil
+}
+
+// MemorySegmentStore 内存号段存储，用于测试和单机
+type MemorySegmentStore struct {
+	mu  sync.Mutex
+	max map[string]int64
+}
+
+func NewMemorySegmentStore() *MemorySegmentStore {
+	return &MemorySegmentStore{max: make(map[string]int64)}
+}
+
+func (s *MemorySegmentStore) NextSegment(ctx context.Context, tag string, step int64) (Segment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := s.max[tag] + 1
+	s.max[tag] += step
+	return Segment{Start: start, End: s.max[tag]}, nil
+}
+
+// RedisSegmentStore 用 INCRBY 分配号段，key 为 prefix+tag，Redis 需要开启持久化
+type RedisSegmentStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisSegmentStore prefix 为空时使用 "seq:"
+func NewRedisSegmentStore(client redis.Cmdable, prefix string) *RedisSegmentStore {
+	if prefix == "" {
+		prefix = "seq:"
+	}
+	return &RedisSegmentStore{client: client, prefix: prefix}
+}
+
+func (s *RedisSegmentStore) NextSegment(ctx context.Context, tag string, step int64) (Segment, error) {
+	end, err := s.client.IncrBy(s.prefix+tag, step).Result()
+	if err != nil {
+		return Segment{}, err
+	}
+	return Segment{Start: end - step + 1, End: end}, nil
+}
@@ -0,0 +1,109 @@
+package seq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+type failingStore struct {
+	SegmentStore
+	mu   sync.Mutex
+	fail bool
+}
+
+func (s *failingStore) NextSegment(ctx context.Context, tag string, step int64) (Segment, error) {
+	s.mu.Lock()
+	fail := s.fail
+	s.mu.Unlock()
+	if fail {
+		return Segment{}, errors.New("store down")
+	}
+	return s.SegmentStore.NextSegment(ctx, tag, step)
+}
+
+func TestSegmentGenerator(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	for name, store := range map[string]SegmentStore{
+		"memory": NewMemorySegmentStore(),
+		"redis":  NewRedisSegmentStore(client, ""),
+	} {
+		a, err := NewSegmentGenerator(store, "order", WithStep(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewSegmentGenerator(store, "order", WithStep(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 并发取号不重复，单个生成器内严格递增
+		var mu sync.Mutex
+		seen := make(map[uint64]bool)
+		var wg sync.WaitGroup
+		for _, g := range []*SegmentGenerator{a, b} {
+			wg.Add(1)
+			go func(g *SegmentGenerator) {
+				defer wg.Done()
+				var last uint64
+				for i := 0; i < 500; i++ {
+					id, err := g.NextID()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if id <= last {
+						t.Errorf("%s: id not increasing: %d <= %d", name, id, last)
+					}
+					last = id
+					mu.Lock()
+					if seen[id] {
+						t.Errorf("%s: duplicate id %d", name, id)
+					}
+					seen[id] = true
+					mu.Unlock()
+				}
+			}(g)
+		}
+		wg.Wait()
+	}
+}
+
+func TestSegmentStoreDown(t *testing.T) {
+	store := &failingStore{SegmentStore: NewMemorySegmentStore()}
+	g, err := NewSegmentGenerator(store, "order", WithStep(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 预取的号段用完前不受存储故障影响
+	for i := 0; i < 9; i++ {
+		g.NextID()
+	}
+	g.mu.Lock()
+	for g.loading {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+	store.mu.Lock()
+	store.fail = true
+	store.mu.Unlock()
+	for i := 0; i < 11; i++ {
+		if id, err := g.NextID(); err != nil || id != uint64(i+10) {
+			t.Fatalf("NextID() = %d, %v", id, err)
+		}
+	}
+	if _, err = g.NextID(); err == nil {
+		t.Error("expected error when store is down")
+	}
+}
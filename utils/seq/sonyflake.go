@@ -0,0 +1,65 @@
+package seq
+
+import (
+	"time"
+
+	"github.com/sony/sonyflake"
+)
+
+const sonyflakeTimeUnit = 10 * time.Millisecond
+
+// Sonyflake 对 github.com/sony/sonyflake 的封装。
+// sonyflake 在时钟回拨时会沿用上次的时间继续递增，这里额外限制回拨的幅度
+type Sonyflake struct {
+	opts *options
+	sf   *sonyflake.Sonyflake
+}
+
+// SonyflakeID Sonyflake ID 的组成部分
+type SonyflakeID struct {
+	Time      time.Time
+	MachineID uint16
+	Sequence  uint16
+}
+
+// NewSonyflake 未指定 WithMachineID 时取内网IP低16位，取不到时返回 ErrMachineID
+func NewSonyflake(opts ...Option) (*Sonyflake, error) {
+	o := evaluateOptions(opts)
+	if o.epoch.After(o.clock()) {
+		return nil, ErrEpoch
+	}
+	sf := sonyflake.NewSonyflake(sonyflake.Settings{
+		StartTime: o.epoch,
+		MachineID: o.machineID,
+	})
+	if sf == nil {
+		return nil, ErrMachineID
+	}
+	return &Sonyflake{opts: o, sf: sf}, nil
+}
+
+func (s *Sonyflake) NextID() (uint64, error) {
+	id, err := s.sf.NextID()
+	if err != nil {
+		return 0, ErrTimeOverflow
+	}
+	// ID 中的时间领先当前时间太多，说明时钟回拨过大
+	if s.Decode(id).Time.Sub(s.opts.clock()) > s.opts.maxClockBackward+sonyflakeTimeUnit {
+		return 0, ErrClockBackward
+	}
+	return id, nil
+}
+
+// Decode 拆解本生成器(相同 epoch)产生的ID
+func (s *Sonyflake) Decode(id uint64) SonyflakeID {
+	return DecodeSonyflake(id, s.opts.epoch)
+}
+
+func DecodeSonyflake(id uint64, epoch time.Time) SonyflakeID {
+	parts := sonyflake.Decompose(id)
+	return SonyflakeID{
+		Time:      epoch.Truncate(sonyflakeTimeUnit).Add(time.Duration(parts["time"]) * sonyflakeTimeUnit),
+		MachineID: uint16(parts["machine-id"]),
+		Sequence:  uint16(parts["sequence"]),
+	}
+}
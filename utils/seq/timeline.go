@@ -0,0 +1,49 @@
+package seq
+
+import "time"
+
+// timeline 为基于时间的生成器提供单调不减的时间戳
+type timeline struct {
+	opts   *options
+	origin time.Time
+	unit   time.Duration
+	last   int64
+}
+
+func newTimeline(opts *options, origin time.Time, unit time.Duration) *timeline {
+	return &timeline{opts: opts, origin: origin, unit: unit, last: -1}
+}
+
+func (t *timeline) current() int64 {
+	return int64(t.opts.clock().Sub(t.origin) / t.unit)
+}
+
+// next 返回当前时间戳以及是否与上次相同。
+// 时钟回拨不超过 maxClockBackward 时沿用上次的时间戳，由调用方继续递增计数器
+func (t *timeline) next() (int64, bool, error) {
+	now := t.current()
+	if now < t.last {
+		if time.Duration(t.last-now)*t.unit > t.opts.maxClockBackward {
+			return 0, false, ErrClockBackward
+		}
+		now = t.last
+	}
+	same := now == t.last
+	t.last = now
+	return now, same, nil
+}
+
+// after 计数器在同一时间单位内用完时，等到下一个时间单位
+func (t *timeline) after() (int64, error) {
+	for {
+		now := t.current()
+		if now > t.last {
+			t.last = now
+			return now, nil
+		}
+		if time.Duration(t.last-now)*t.unit > t.opts.maxClockBackward {
+			return 0, ErrClockBackward
+		}
+		t.opts.sleep(time.Duration(t.last+1)*t.unit - t.opts.clock().Sub(t.origin))
+	}
+}
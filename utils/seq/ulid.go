@@ -0,0 +1,154 @@
+package seq
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+// ULID https://github.com/ulid/spec
+type ULID [16]byte
+
+const (
+	ulidEncoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	ulidLen      = 26
+	ulidMaxTime  = 1<<48 - 1
+)
+
+var ulidDecoding = func() [256]byte {
+	var d [256]byte
+	for i := range d {
+		d[i] = 0xff
+	}
+	for i := 0; i < len(ulidEncoding); i++ {
+		c := ulidEncoding[i]
+		d[c] = byte(i)
+		if c >= 'A' {
+			d[c+'a'-'A'] = byte(i)
+		}
+	}
+	// Crockford base32 容易混淆的字符
+	for c, v := range map[byte]byte{'O': 0, 'o': 0, 'I': 1, 'i': 1, 'L': 1, 'l': 1} {
+		d[c] = v
+	}
+	return d
+}()
+
+// ULIDGenerator 同一毫秒内随机部分加一，保证严格递增
+type ULIDGenerator struct {
+	mu       sync.Mutex
+	opts     *options
+	timeline *timeline
+	last     ULID
+}
+
+func NewULIDGenerator(opts ...Option) *ULIDGenerator {
+	o := evaluateOptions(opts)
+	return &ULIDGenerator{opts: o, timeline: newTimeline(o, time.Unix(0, 0), time.Millisecond)}
+}
+
+func (g *ULIDGenerator) New() (ULID, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms, same, err := g.timeline.next()
+	if err != nil {
+		return ULID{}, err
+	}
+	if same && incrementBytes(g.last[6:]) {
+		return g.last, nil
+	}
+	// 新的毫秒或随机部分溢出
+	if same {
+		if ms, err = g.timeline.after(); err != nil {
+			return ULID{}, err
+		}
+	}
+	if ms < 0 || ms > ulidMaxTime {
+		return ULID{}, ErrTimeOverflow
+	}
+	var id ULID
+	putUint48(id[:6], uint64(ms))
+	if _, err = io.ReadFull(g.opts.entropy, id[6:]); err != nil {
+		return ULID{}, err
+	}
+	g.last = id
+	return id, nil
+}
+
+func (g *ULIDGenerator) NextString() (string, error) {
+	id, err := g.New()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+func (id ULID) Time() time.Time {
+	return time.UnixMilli(int64(uint48(id[:6])))
+}
+
+func (id ULID) String() string {
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	b := make([]byte, ulidLen)
+	// 128 位从低到高每 5 位一个字符，最高字符只有 3 位
+	for i := ulidLen - 1; i >= 0; i-- {
+		b[i] = ulidEncoding[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b)
+}
+
+func (id ULID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *ULID) UnmarshalText(b []byte) error {
+	parsed, err := ParseULID(string(b))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// ParseULID 不区分大小写，首字符大于 7 时超出 128 位
+func ParseULID(s string) (ULID, error) {
+	if len(s) != ulidLen || ulidDecoding[s[0]] > 7 {
+		return ULID{}, ErrInvalidID
+	}
+	var hi, lo uint64
+	for i := 0; i < ulidLen; i++ {
+		v := ulidDecoding[s[i]]
+		if v == 0xff {
+			return ULID{}, ErrInvalidID
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	var id ULID
+	binary.BigEndian.PutUint64(id[:8], hi)
+	binary.BigEndian.PutUint64(id[8:], lo)
+	return id, nil
+}
+
+// incrementBytes 大端加一，溢出返回 false
+func incrementBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func putUint48(b []byte, v uint64) {
+	b[0], b[1], b[2], b[3], b[4], b[5] = byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v)
+}
+
+func uint48(b []byte) uint64 {
+	return uint64(b[0])<<40 | uint64(b[1])<<32 | uint64(b[2])<<24 | uint64(b[3])<<16 | uint64(b[4])<<8 | uint64(b[5])
+}
@@ -0,0 +1,72 @@
+package seq
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestULIDEncoding(t *testing.T) {
+	var max ULID
+	for i := range max {
+		max[i] = 0xff
+	}
+	for id, want := range map[ULID]string{
+		{}:  "00000000000000000000000000",
+		max: "7ZZZZZZZZZZZZZZZZZZZZZZZZZ",
+	} {
+		if got := id.String(); got != want {
+			t.Errorf("String() = %s, want %s", got, want)
+		}
+	}
+
+	g := NewULIDGenerator()
+	id, err := g.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{id.String(), string(bytes.ToLower([]byte(id.String())))} {
+		parsed, err := ParseULID(s)
+		if err != nil || parsed != id {
+			t.Errorf("ParseULID(%s) = %v, %v", s, parsed, err)
+		}
+	}
+	if time.Since(id.Time()) > time.Second {
+		t.Errorf("unexpected time %v", id.Time())
+	}
+	for _, s := range []string{"", "8ZZZZZZZZZZZZZZZZZZZZZZZZZ", "0000000000000000000000000U"} {
+		if _, err = ParseULID(s); err != ErrInvalidID {
+			t.Errorf("ParseULID(%q) expected ErrInvalidID, got %v", s, err)
+		}
+	}
+}
+
+func TestULIDMonotonic(t *testing.T) {
+	clock := newFakeClock()
+	g := NewULIDGenerator(clock.options()...)
+	last, err := g.NextString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if i == 500 {
+			clock.Add(-5 * time.Millisecond)
+		}
+		s, err := g.NextString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s <= last {
+			t.Fatalf("ulid not increasing: %s <= %s", s, last)
+		}
+		last = s
+	}
+	id, _ := ParseULID(last)
+	if !id.Time().Equal(clock.Now().Add(5 * time.Millisecond)) {
+		t.Errorf("unexpected time %v", id.Time())
+	}
+	clock.Add(-time.Second)
+	if _, err = g.New(); err != ErrClockBackward {
+		t.Errorf("expected ErrClockBackward, got %v", err)
+	}
+}
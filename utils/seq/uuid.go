@@ -1,8 +1,13 @@
 package seq
 
 import (
-	"github.com/google/uuid"
+	"encoding/binary"
+	"io"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 func UUID() string {
@@ -12,3 +17,70 @@ func UUID() string {
 func UUIDShort() string {
 	return strings.Replace(UUID(), "-", "", -1)
 }
+
+const uuidV7CounterMask = 1<<12 - 1
+
+// UUIDv7Generator RFC 9562 6.2 方法一：rand_a 的 12 位作为计数器，
+// 每毫秒以 11 位随机数开始，留出一半空间给同一毫秒内的递增
+type UUIDv7Generator struct {
+	mu       sync.Mutex
+	opts     *options
+	timeline *timeline
+	counter  uint16
+}
+
+func NewUUIDv7Generator(opts ...Option) *UUIDv7Generator {
+	o := evaluateOptions(opts)
+	return &UUIDv7Generator{opts: o, timeline: newTimeline(o, time.Unix(0, 0), time.Millisecond)}
+}
+
+func (g *UUIDv7Generator) New() (uuid.UUID, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var id uuid.UUID
+	if _, err := io.ReadFull(g.opts.entropy, id[6:]); err != nil {
+		return id, err
+	}
+	ms, same, err := g.timeline.next()
+	if err != nil {
+		return id, err
+	}
+	if same {
+		g.counter = (g.counter + 1) & uuidV7CounterMask
+		if g.counter == 0 {
+			// 计数器用完，等到下一毫秒
+			if ms, err = g.timeline.after(); err != nil {
+				return id, err
+			}
+			same = false
+		}
+	}
+	if !same {
+		g.counter = binary.BigEndian.Uint16(id[6:8]) & (uuidV7CounterMask >> 1)
+	}
+	if ms < 0 || ms > ulidMaxTime {
+		return id, ErrTimeOverflow
+	}
+
+	putUint48(id[:6], uint64(ms))
+	binary.BigEndian.PutUint16(id[6:8], 0x7000|g.counter)
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+	return id, nil
+}
+
+func (g *UUIDv7Generator) NextString() (string, error) {
+	id, err := g.New()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// UUIDv7Time 取出 UUIDv7 中的毫秒时间
+func UUIDv7Time(id uuid.UUID) (time.Time, error) {
+	if id.Version() != 7 || id.Variant() != uuid.RFC4122 {
+		return time.Time{}, ErrInvalidID
+	}
+	return time.UnixMilli(int64(uint48(id[:6]))), nil
+}
@@ -2,6 +2,7 @@ package seq
 
 import (
 	"testing"
+	"time"
 )
 
 func TestUUID(t *testing.T) {
@@ -11,3 +12,43 @@ func TestUUID(t *testing.T) {
 	shortUUID := UUIDShort()
 	t.Log(shortUUID)
 }
+
+func TestUUIDv7(t *testing.T) {
+	clock := newFakeClock()
+	g := NewUUIDv7Generator(clock.options()...)
+	start := clock.Now()
+	var last string
+	// 同一毫秒内计数器用完后等到下一毫秒
+	for i := 0; i < 5000; i++ {
+		id, err := g.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.Version() != 7 {
+			t.Fatalf("unexpected version %d", id.Version())
+		}
+		if s := id.String(); s <= last {
+			t.Fatalf("uuid not increasing: %s <= %s", s, last)
+		} else {
+			last = s
+		}
+	}
+	if !clock.Now().After(start) {
+		t.Error("counter overflow did not wait for the next millisecond")
+	}
+
+	id, err := g.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := UUIDv7Time(id)
+	if err != nil || !ts.Equal(clock.Now()) {
+		t.Errorf("UUIDv7Time = %v, %v", ts, err)
+	}
+	if _, err = UUIDv7Time([16]byte{}); err != ErrInvalidID {
+		t.Errorf("expected ErrInvalidID, got %v", err)
+	}
+	if ts.Before(time.Unix(0, 0)) {
+		t.Error("time before unix epoch")
+	}
+}
@@ -0,0 +1,77 @@
+package session
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	csrfKey = "_csrf"
+
+	CSRFHeader    = "X-CSRF-Token"
+	CSRFFormField = "csrf_token"
+)
+
+// CSRFToken 返回会话中的 CSRF token，没有时生成一个，放到表单隐藏字段或页面 meta 中
+func CSRFToken(s *Session) (string, error) {
+	if token := s.GetString(csrfKey); token != "" {
+		return token, nil
+	}
+	token, err := newID()
+	if err != nil {
+		return "", err
+	}
+	return token, s.Set(csrfKey, token)
+}
+
+// VerifyCSRF 比较请求中的 token 与会话中的 token
+func VerifyCSRF(s *Session, token string) bool {
+	expected := s.GetString(csrfKey)
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+// RequestCSRFToken 依次从请求头 X-CSRF-Token 和表单字段 csrf_token 中读取
+func RequestCSRFToken(r *http.Request) string {
+	if token := r.Header.Get(CSRFHeader); token != "" {
+		return token
+	}
+	return r.PostFormValue(CSRFFormField)
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// CSRFMiddleware 校验非安全方法请求的 CSRF token，需要放在 HTTPMiddleware 之后
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r.Method) {
+			s, ok := FromContext(r.Context())
+			if !ok || !VerifyCSRF(s, RequestCSRFToken(r)) {
+				http.Error(w, "invalid csrf token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GinCSRFMiddleware gin 版本，需要放在 GinMiddleware 之后
+func GinCSRFMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !safeMethod(ctx.Request.Method) {
+			s, ok := FromContext(ctx.Request.Context())
+			if !ok || !VerifyCSRF(s, RequestCSRFToken(ctx.Request)) {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid csrf token"})
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
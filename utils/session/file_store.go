@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileRecord struct {
+	Record
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// FileStore 每个会话一个文件，适合单机部署，过期文件需要定期调用 GC 清理
+type FileStore struct {
+	dir   string
+	clock func() time.Time
+}
+
+// NewFileStore 目录不存在时自动创建，权限为 0700
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, clock: time.Now}, nil
+}
+
+func (s *FileStore) Load(ctx context.Context, id string) (*Record, error) {
+	path, ok := s.path(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r fileRecord
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if !s.clock().Before(r.ExpiresAt) {
+		os.Remove(path)
+		return nil, ErrNotFound
+	}
+	return &r.Record, nil
+}
+
+func (s *FileStore) Save(ctx context.Context, id string, record *Record, ttl time.Duration) error {
+	path, ok := s.path(id)
+	if !ok {
+		return ErrNotFound
+	}
+	data, err := json.Marshal(fileRecord{Record: *record, ExpiresAt: s.clock().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免并发读到写了一半的文件
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	path, ok := s.path(id)
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// GC 删除过期的会话文件
+func (s *FileStore) GC() error {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !validID(e.Name()) {
+			continue
+		}
+		// Load 会删除过期文件
+		s.Load(context.Background(), e.Name())
+	}
+	return nil
+}
+
+// path 会话ID 来自 cookie，校验字符集防止路径穿越
+func (s *FileStore) path(id string) (string, bool) {
+	if !validID(id) {
+		return "", false
+	}
+	return filepath.Join(s.dir, id), true
+}
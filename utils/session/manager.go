@@ -0,0 +1,225 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	idBytes    = 32
+	minKeySize = 32
+)
+
+var (
+	ErrWeakKey      = errors.New("session: sign key must be at least 32 bytes")
+	ErrInvalidValue = errors.New("session: invalid cookie value")
+)
+
+type Manager struct {
+	store Store
+	keys  [][]byte // 第一个用于签名，其余只用于验证
+	opts  *options
+}
+
+// NewManager signKey 用于 cookie 的 HMAC-SHA256 签名，至少 32 字节
+func NewManager(store Store, signKey []byte, opts ...Option) (*Manager, error) {
+	o := evaluateOptions(opts)
+	keys := append([][]byte{signKey}, o.previousKeys...)
+	for _, k := range keys {
+		if len(k) < minKeySize {
+			return nil, ErrWeakKey
+		}
+	}
+	return &Manager{store: store, keys: keys, opts: o}, nil
+}
+
+// Load 读取请求中的会话，没有 cookie、签名错误或已过期时返回新会话
+func (m *Manager) Load(r *http.Request) (*Session, error) {
+	now := m.opts.clock()
+	if c, err := r.Cookie(m.opts.cookieName); err == nil {
+		if id, err := m.decode(c.Value); err == nil {
+			record, err := m.store.Load(r.Context(), id)
+			switch {
+			case err == nil && !m.expired(record, now):
+				if record.Values == nil {
+					record.Values = make(map[string]json.RawMessage)
+				}
+				return &Session{id: id, values: record.Values, createdAt: record.CreatedAt, lastSeen: record.LastSeen}, nil
+			case err == nil:
+				// 已过期，保存新会话时删除
+				s, err := m.newSession(now)
+				if s != nil {
+					s.oldID = id
+				}
+				return s, err
+			case err != ErrNotFound:
+				return nil, err
+			}
+		}
+	}
+	return m.newSession(now)
+}
+
+// Save 写入存储并设置 cookie，必须在写响应体之前调用。
+// 未修改的会话只在距上次访问超过空闲超时的 1/10 时才刷新，减少存储写入
+func (m *Manager) Save(w http.ResponseWriter, r *http.Request, s *Session) error {
+	ctx := r.Context()
+	if s.oldID != "" {
+		if err := m.store.Delete(ctx, s.oldID); err != nil {
+			return err
+		}
+		s.oldID = ""
+	}
+	if s.destroyed {
+		if !s.isNew {
+			if err := m.store.Delete(ctx, s.id); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, m.cookie("", -1))
+		return nil
+	}
+
+	now := m.opts.clock()
+	if !s.dirty && !s.isNew && now.Sub(s.lastSeen) < m.opts.idleTimeout/10 {
+		return nil
+	}
+	// 新会话没有数据时不落库，避免匿名请求产生大量会话
+	if s.isNew && len(s.values) == 0 {
+		return nil
+	}
+
+	s.lastSeen = now
+	ttl := m.opts.idleTimeout
+	if remaining := s.createdAt.Add(m.opts.absoluteTimeout).Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+	if err := m.store.Save(ctx, s.id, s.record(), ttl); err != nil {
+		return err
+	}
+	value, err := m.encode(s.id)
+	if err != nil {
+		return err
+	}
+	// cookie 为会话 cookie，过期由服务端控制
+	http.SetCookie(w, m.cookie(value, 0))
+	s.isNew, s.dirty = false, false
+	return nil
+}
+
+// Revoke 删除指定会话，如管理员强制下线
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	return m.store.Delete(ctx, id)
+}
+
+func (m *Manager) expired(r *Record, now time.Time) bool {
+	return now.Sub(r.LastSeen) >= m.opts.idleTimeout || now.Sub(r.CreatedAt) >= m.opts.absoluteTimeout
+}
+
+func (m *Manager) newSession(now time.Time) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{id: id, values: make(map[string]json.RawMessage), createdAt: now, lastSeen: now, isNew: true}, nil
+}
+
+func (m *Manager) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.opts.cookieName,
+		Value:    value,
+		Path:     m.opts.path,
+		Domain:   m.opts.domain,
+		MaxAge:   maxAge,
+		Secure:   m.opts.secure,
+		HttpOnly: true,
+		SameSite: m.opts.sameSite,
+	}
+}
+
+// encode cookie 值为 base64(payload).base64(hmac(name|payload))，payload 为会话ID或其密文
+func (m *Manager) encode(id string) (string, error) {
+	payload := []byte(id)
+	if m.opts.keyring != nil {
+		var err error
+		if payload, err = m.opts.keyring.Encrypt(payload, []byte(m.opts.cookieName)); err != nil {
+			return "", err
+		}
+	}
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	return p + "." + base64.RawURLEncoding.EncodeToString(m.mac(m.keys[0], p)), nil
+}
+
+func (m *Manager) decode(value string) (string, error) {
+	i := strings.IndexByte(value, '.')
+	if i < 0 {
+		return "", ErrInvalidValue
+	}
+	p := value[:i]
+	sig, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	verified := false
+	for _, k := range m.keys {
+		if hmac.Equal(sig, m.mac(k, p)) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return "", ErrInvalidValue
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	if m.opts.keyring != nil {
+		if payload, err = m.opts.keyring.Decrypt(payload, []byte(m.opts.cookieName)); err != nil {
+			return "", ErrInvalidValue
+		}
+	}
+	if !validID(string(payload)) {
+		return "", ErrInvalidValue
+	}
+	return string(payload), nil
+}
+
+// mac 签名包含 cookie 名，防止把一个 cookie 的值挪用到另一个 cookie
+func (m *Manager) mac(key []byte, payload string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(m.opts.cookieName))
+	h.Write([]byte{'|'})
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func newID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validID 会话ID 为 base64url 编码的随机数
+func validID(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(idBytes) {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
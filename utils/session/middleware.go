@@ -0,0 +1,122 @@
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type contextKey struct{}
+
+// FromContext 取出中间件加载的会话
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(contextKey{}).(*Session)
+	return s, ok
+}
+
+// HTTPMiddleware 加载会话，在响应头写出前保存
+func HTTPMiddleware(m *Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, err := m.Load(r)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, s))
+			sw := &saveWriter{ResponseWriter: w, save: func() error { return m.Save(w, r, s) }}
+			next.ServeHTTP(sw, r)
+			// 处理函数没有写响应时在这里保存
+			sw.commit()
+		})
+	}
+}
+
+// GinMiddleware gin 版本，会话同样通过 FromContext(ctx.Request.Context()) 获取
+func GinMiddleware(m *Manager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		s, err := m.Load(ctx.Request)
+		if err != nil {
+			ctx.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), contextKey{}, s))
+		w := ctx.Writer
+		gw := &ginSaveWriter{ResponseWriter: w, sw: saveWriter{ResponseWriter: w, save: func() error {
+			return m.Save(w, ctx.Request, s)
+		}}}
+		ctx.Writer = gw
+		ctx.Next()
+		if !w.Written() {
+			gw.sw.commit()
+		}
+	}
+}
+
+// saveWriter 第一次写响应头时保存会话，此时还可以设置 cookie
+type saveWriter struct {
+	http.ResponseWriter
+	save      func() error
+	committed bool
+	failed    bool
+}
+
+// commit 保存失败时改为返回 500，并丢弃处理函数写的内容
+func (w *saveWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	if err := w.save(); err != nil {
+		w.failed = true
+		http.Error(w.ResponseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func (w *saveWriter) WriteHeader(status int) {
+	w.commit()
+	if !w.failed {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *saveWriter) Write(b []byte) (int, error) {
+	w.commit()
+	if w.failed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *saveWriter) Flush() {
+	w.commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.failed {
+		f.Flush()
+	}
+}
+
+// ginSaveWriter gin 的 WriteHeader 只记录状态码，真正写出发生在 Write、WriteHeaderNow
+type ginSaveWriter struct {
+	gin.ResponseWriter
+	sw saveWriter
+}
+
+func (w *ginSaveWriter) Write(b []byte) (int, error) {
+	return w.sw.Write(b)
+}
+
+func (w *ginSaveWriter) WriteString(s string) (int, error) {
+	return w.sw.Write([]byte(s))
+}
+
+func (w *ginSaveWriter) WriteHeaderNow() {
+	w.sw.commit()
+	if !w.sw.failed {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *ginSaveWriter) Flush() {
+	w.sw.Flush()
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"net/http"
+	"time"
+
+	cryptox "go-demo/utils/crypto"
+)
+
+const (
+	defaultCookieName      = "session_id"
+	defaultIdleTimeout     = 30 * time.Minute
+	defaultAbsoluteTimeout = 24 * time.Hour
+)
+
+type (
+	Option  func(*options)
+	options struct {
+		cookieName      string
+		path            string
+		domain          string
+		secure          bool
+		sameSite        http.SameSite
+		idleTimeout     time.Duration
+		absoluteTimeout time.Duration
+		previousKeys    [][]byte
+		keyring         *cryptox.Keyring
+		clock           func() time.Time
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		cookieName:      defaultCookieName,
+		path:            "/",
+		secure:          true,
+		sameSite:        http.SameSiteLaxMode,
+		idleTimeout:     defaultIdleTimeout,
+		absoluteTimeout: defaultAbsoluteTimeout,
+		clock:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	return optCopy
+}
+
+// WithCookieName sets the session cookie name, default "session_id".
+func WithCookieName(name string) Option {
+	return func(opts *options) {
+		opts.cookieName = name
+	}
+}
+
+// WithCookiePath sets the cookie path, default "/".
+func WithCookiePath(path string) Option {
+	return func(opts *options) {
+		opts.path = path
+	}
+}
+
+// WithCookieDomain sets the cookie domain, default host-only.
+func WithCookieDomain(domain string) Option {
+	return func(opts *options) {
+		opts.domain = domain
+	}
+}
+
+// WithSecure controls the Secure attribute, default true. Only disable it for local HTTP development.
+func WithSecure(secure bool) Option {
+	return func(opts *options) {
+		opts.secure = secure
+	}
+}
+
+// WithSameSite sets the SameSite attribute, default Lax.
+func WithSameSite(sameSite http.SameSite) Option {
+	return func(opts *options) {
+		opts.sameSite = sameSite
+	}
+}
+
+// WithIdleTimeout expires a session that has not been used for d, default 30 minutes.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(opts *options) {
+		opts.idleTimeout = d
+	}
+}
+
+// WithAbsoluteTimeout expires a session d after it was created no matter how
+// active it is, default 24 hours.
+func WithAbsoluteTimeout(d time.Duration) Option {
+	return func(opts *options) {
+		opts.absoluteTimeout = d
+	}
+}
+
+// WithPreviousSignKeys keeps accepting cookies signed by old keys during key rotation.
+func WithPreviousSignKeys(keys ...[]byte) Option {
+	return func(opts *options) {
+		opts.previousKeys = keys
+	}
+}
+
+// WithEncryption encrypts the cookie value with the active key of the keyring.
+func WithEncryption(keyring *cryptox.Keyring) Option {
+	return func(opts *options) {
+		opts.keyring = keyring
+	}
+}
+
+// WithClock replaces time.Now, mainly for tests.
+func WithClock(clock func() time.Time) Option {
+	return func(opts *options) {
+		opts.clock = clock
+	}
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+	"encoding/json"
+	"time"
+)
+
+/**
+服务端会话：
+- cookie 中只保存 HMAC 签名(可选再加密)的会话ID，数据保存在 Store(内存、文件、Redis)
+- 空闲超时和绝对超时，过期后自动换成新会话
+- 登录成功后调用 Regenerate 更换会话ID，防止会话固定攻击
+- CSRF token 保存在会话中，见 CSRFToken、CSRFMiddleware
+通过 HTTPMiddleware、GinMiddleware 使用，处理函数中用 FromContext 取出会话
+*/
+
+// Session 一次请求中使用的会话，不能跨 goroutine 并发修改
+type Session struct {
+	id        string
+	oldID     string // Regenerate 前的ID，保存时删除
+	values    map[string]json.RawMessage
+	createdAt time.Time
+	lastSeen  time.Time
+
+	isNew     bool
+	dirty     bool
+	destroyed bool
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew 本次请求新建的会话(没有 cookie 或原会话已过期)
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+func (s *Session) CreatedAt() time.Time {
+	return s.createdAt
+}
+
+// Get 把值解码到 v 中，不存在或解码失败时返回 false
+func (s *Session) Get(key string, v interface{}) bool {
+	raw, ok := s.values[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+func (s *Session) GetString(key string) string {
+	var v string
+	s.Get(key, &v)
+	return v
+}
+
+// Set 值以 JSON 保存
+func (s *Session) Set(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.values[key] = raw
+	s.dirty = true
+	return nil
+}
+
+func (s *Session) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.dirty = true
+	}
+}
+
+// Regenerate 更换会话ID并保留数据，登录、提权后必须调用
+func (s *Session) Regenerate() error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.id
+	}
+	s.id = id
+	// 旧页面中的 CSRF token 一并失效
+	delete(s.values, csrfKey)
+	s.dirty = true
+	return nil
+}
+
+// Destroy 删除会话数据并清除 cookie，用于退出登录
+func (s *Session) Destroy() {
+	s.destroyed = true
+}
+
+func (s *Session) record() *Record {
+	return &Record{Values: s.values, CreatedAt: s.createdAt, LastSeen: s.lastSeen}
+}
@@ -0,0 +1,307 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+
+	cryptox "go-demo/utils/crypto"
+)
+
+var (
+	testKey = []byte("0123456789abcdef0123456789abcdef")
+	oldKey  = []byte("fedcba9876543210fedcba9876543210")
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func testStores(t *testing.T) map[string]Store {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+	file, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   file,
+		"redis":  NewRedisStore(client, ""),
+	}
+}
+
+// testHandler /login 登录，/me 返回当前用户，/logout 退出
+func testHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		s, _ := FromContext(r.Context())
+		if err := s.Regenerate(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.Set("user", r.FormValue("user"))
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		s, _ := FromContext(r.Context())
+		w.Write([]byte(s.GetString("user")))
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		s, _ := FromContext(r.Context())
+		s.Destroy()
+	})
+	return mux
+}
+
+func do(t *testing.T, h http.Handler, method, target string, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == defaultCookieName {
+			return w, c
+		}
+	}
+	return w, nil
+}
+
+func TestLoginFlow(t *testing.T) {
+	for name, store := range testStores(t) {
+		m, err := NewManager(store, testKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := HTTPMiddleware(m)(testHandler())
+
+		// 匿名访问不创建会话
+		w, anon := do(t, h, http.MethodGet, "/me", nil)
+		if anon != nil || w.Body.Len() != 0 {
+			t.Fatalf("%s: anonymous request created a session", name)
+		}
+
+		_, pre := do(t, h, http.MethodGet, "/login?user=alice", nil)
+		if pre == nil || !pre.HttpOnly || !pre.Secure || pre.SameSite != http.SameSiteLaxMode {
+			t.Fatalf("%s: unexpected cookie %+v", name, pre)
+		}
+		// 再次登录会更换会话ID，旧 cookie 失效
+		_, cookie := do(t, h, http.MethodGet, "/login?user=bob", pre)
+		if cookie == nil || cookie.Value == pre.Value {
+			t.Fatalf("%s: session id not regenerated", name)
+		}
+		if w, _ = do(t, h, http.MethodGet, "/me", cookie); w.Body.String() != "bob" {
+			t.Errorf("%s: /me = %q", name, w.Body.String())
+		}
+		if w, _ = do(t, h, http.MethodGet, "/me", pre); w.Body.String() != "" {
+			t.Errorf("%s: old session still valid: %q", name, w.Body.String())
+		}
+
+		// 篡改签名
+		tampered := *cookie
+		tampered.Value = cookie.Value[:len(cookie.Value)-2] + "AA"
+		if w, _ = do(t, h, http.MethodGet, "/me", &tampered); w.Body.String() != "" {
+			t.Errorf("%s: tampered cookie accepted", name)
+		}
+
+		_, cleared := do(t, h, http.MethodGet, "/logout", cookie)
+		if cleared == nil || cleared.MaxAge >= 0 {
+			t.Errorf("%s: logout did not clear cookie: %+v", name, cleared)
+		}
+		if w, _ = do(t, h, http.MethodGet, "/me", cookie); w.Body.String() != "" {
+			t.Errorf("%s: destroyed session still valid", name)
+		}
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	m, err := NewManager(NewMemoryStore(), testKey, WithClock(clock.Now),
+		WithIdleTimeout(10*time.Minute), WithAbsoluteTimeout(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := HTTPMiddleware(m)(testHandler())
+
+	_, cookie := do(t, h, http.MethodGet, "/login?user=alice", nil)
+	// 持续访问不会空闲超时
+	for i := 0; i < 5; i++ {
+		clock.Add(9 * time.Minute)
+		if w, _ := do(t, h, http.MethodGet, "/me", cookie); w.Body.String() != "alice" {
+			t.Fatalf("session expired after %d active requests", i)
+		}
+	}
+	// 绝对超时
+	clock.Add(16 * time.Minute)
+	if w, _ := do(t, h, http.MethodGet, "/me", cookie); w.Body.String() != "" {
+		t.Error("session survived the absolute timeout")
+	}
+
+	_, cookie = do(t, h, http.MethodGet, "/login?user=alice", nil)
+	clock.Add(10 * time.Minute)
+	if w, _ := do(t, h, http.MethodGet, "/me", cookie); w.Body.String() != "" {
+		t.Error("session survived the idle timeout")
+	}
+}
+
+func TestCookieKeys(t *testing.T) {
+	store := NewMemoryStore()
+	keyring := cryptox.NewKeyring(cryptox.AlgAESGCM)
+	if err := keyring.Generate("k1"); err != nil {
+		t.Fatal(err)
+	}
+	old, err := NewManager(store, oldKey, WithEncryption(keyring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cookie := do(t, HTTPMiddleware(old)(testHandler()), http.MethodGet, "/login?user=alice", nil)
+	if strings.Contains(cookie.Value, cookieID(t, old, cookie)) {
+		t.Error("session id is not encrypted")
+	}
+
+	// 轮换签名密钥后旧 cookie 仍然有效
+	m, err := NewManager(store, testKey, WithEncryption(keyring), WithPreviousSignKeys(oldKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := do(t, HTTPMiddleware(m)(testHandler()), http.MethodGet, "/me", cookie); w.Body.String() != "alice" {
+		t.Errorf("cookie signed by previous key rejected")
+	}
+	// 不带旧密钥时拒绝
+	m, _ = NewManager(store, testKey, WithEncryption(keyring))
+	if w, _ := do(t, HTTPMiddleware(m)(testHandler()), http.MethodGet, "/me", cookie); w.Body.String() != "" {
+		t.Errorf("cookie signed by unknown key accepted")
+	}
+	// 签名绑定 cookie 名
+	other, _ := NewManager(store, oldKey, WithEncryption(keyring), WithCookieName("other"))
+	if _, err = other.decode(cookie.Value); err != ErrInvalidValue {
+		t.Errorf("cookie accepted under another name: %v", err)
+	}
+
+	if _, err = NewManager(store, []byte("short")); err != ErrWeakKey {
+		t.Errorf("expected ErrWeakKey, got %v", err)
+	}
+}
+
+// cookieID 解码 cookie 得到会话ID
+func cookieID(t *testing.T, m *Manager, cookie *http.Cookie) string {
+	t.Helper()
+	id, err := m.decode(cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestCSRF(t *testing.T) {
+	m, err := NewManager(NewMemoryStore(), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/form", func(w http.ResponseWriter, r *http.Request) {
+		s, _ := FromContext(r.Context())
+		token, _ := CSRFToken(s)
+		w.Write([]byte(token))
+	})
+	mux.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	})
+	h := HTTPMiddleware(m)(CSRFMiddleware(mux))
+
+	w, cookie := do(t, h, http.MethodGet, "/form", nil)
+	token := w.Body.String()
+	if token == "" || cookie == nil {
+		t.Fatal("no csrf token")
+	}
+
+	post := func(form url.Values, header string) int {
+		req := httptest.NewRequest(http.MethodPost, "/submit", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			req.Header.Set(CSRFHeader, header)
+		}
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := post(nil, ""); code != http.StatusForbidden {
+		t.Errorf("missing token: %d", code)
+	}
+	if code := post(url.Values{CSRFFormField: {"wrong"}}, ""); code != http.StatusForbidden {
+		t.Errorf("wrong token: %d", code)
+	}
+	if code := post(url.Values{CSRFFormField: {token}}, ""); code != http.StatusOK {
+		t.Errorf("form token: %d", code)
+	}
+	if code := post(nil, token); code != http.StatusOK {
+		t.Errorf("header token: %d", code)
+	}
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, err := NewManager(NewMemoryStore(), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(GinMiddleware(m), GinCSRFMiddleware())
+	r.GET("/login", func(c *gin.Context) {
+		s, _ := FromContext(c.Request.Context())
+		s.Regenerate()
+		s.Set("user", c.Query("user"))
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	r.GET("/me", func(c *gin.Context) {
+		s, _ := FromContext(c.Request.Context())
+		c.String(http.StatusOK, s.GetString("user"))
+	})
+	r.POST("/logout", func(c *gin.Context) {
+		s, _ := FromContext(c.Request.Context())
+		s.Destroy()
+		c.Status(http.StatusNoContent)
+	})
+
+	_, cookie := do(t, r, http.MethodGet, "/login?user=alice", nil)
+	if cookie == nil {
+		t.Fatal("gin middleware did not set cookie")
+	}
+	if w, _ := do(t, r, http.MethodGet, "/me", cookie); w.Body.String() != "alice" {
+		t.Errorf("/me = %q", w.Body.String())
+	}
+	// 没有 CSRF token 的 POST 被拒绝
+	if w, _ := do(t, r, http.MethodPost, "/logout", cookie); w.Code != http.StatusForbidden {
+		t.Errorf("logout without csrf token: %d", w.Code)
+	}
+}
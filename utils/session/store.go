@@ -0,0 +1,90 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("session: not found")
+
+// Record 会话在存储中的内容
+type Record struct {
+	Values    map[string]json.RawMessage `json:"values"`
+	CreatedAt time.Time                  `json:"created_at"`
+	LastSeen  time.Time                  `json:"last_seen"`
+}
+
+// Store 会话存储，ttl 到期后 Load 返回 ErrNotFound
+type Store interface {
+	Load(ctx context.Context, id string) (*Record, error)
+	Save(ctx context.Context, id string, record *Record, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// MemoryStore 单机内存存储，重启后会话丢失
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	clock     func() time.Time
+	lastPurge time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), clock: time.Now}
+}
+
+func (s *MemoryStore) Load(ctx context.Context, id string) (*Record, error) {
+	s.mu.Lock()
+	e, ok := s.entries[id]
+	s.mu.Unlock()
+	if !ok || !s.clock().Before(e.expiresAt) {
+		return nil, ErrNotFound
+	}
+	// 保存序列化后的数据，避免调用方修改共享的 map
+	var r Record
+	if err := json.Unmarshal(e.data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, id string, record *Record, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	s.entries[id] = memoryEntry{data: data, expiresAt: s.clock().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.entries, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// purge 最多每分钟清理一次过期会话，需持有锁
+func (s *MemoryStore) purge() {
+	now := s.clock()
+	if now.Sub(s.lastPurge) < time.Minute {
+		return
+	}
+	s.lastPurge = now
+	for id, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, id)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// RegisteredClaims RFC 7519 中定义的标准声明，时间为 unix 秒
+type RegisteredClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Audience aud 可以是字符串也可以是字符串数组
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Contains 是否包含 expected 中的任意一个
+func (a Audience) Contains(expected ...string) bool {
+	for _, aud := range a {
+		for _, e := range expected {
+			if aud == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Expiration 返回过期时间，没有 exp 时返回零值
+func (c *RegisteredClaims) Expiration() time.Time {
+	if c.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// validate 校验时间、签发者和受众，leeway 为允许的时钟偏差
+func (c *RegisteredClaims) validate(opts *options) error {
+	now := opts.clock()
+	if c.ExpiresAt == 0 {
+		if opts.requireExp {
+			return ErrTokenExpired
+		}
+	} else if !now.Before(time.Unix(c.ExpiresAt, 0).Add(opts.leeway)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Add(opts.leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrTokenNotValidYet
+	}
+	if c.IssuedAt != 0 && now.Add(opts.leeway).Before(time.Unix(c.IssuedAt, 0)) {
+		return ErrTokenNotValidYet
+	}
+	if opts.issuer != "" && c.Issuer != opts.issuer {
+		return ErrTokenIssuer
+	}
+	if len(opts.audience) > 0 && !c.Audience.Contains(opts.audience...) {
+		return ErrTokenAudience
+	}
+	return nil
+}
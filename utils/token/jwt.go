@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	cryptox "go-demo/utils/crypto"
+)
+
+/**
+JWT 签发与校验，只支持非对称算法(RS256、PS256、ES256、EdDSA)。
+签发方持有私钥，校验方通过 KeySource 按 kid 查找公钥，公钥自带算法，
+token 头中的 alg 必须与公钥的算法一致，避免把公钥当作 HMAC 密钥的算法混淆攻击。
+*/
+
+var (
+	ErrTokenMalformed   = errors.New("token is malformed")
+	ErrTokenAlgorithm   = errors.New("token signing algorithm is not allowed")
+	ErrTokenSignature   = errors.New("token signature is invalid")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+	ErrTokenIssuer      = errors.New("token issuer is invalid")
+	ErrTokenAudience    = errors.New("token audience is invalid")
+	ErrUnknownKey       = errors.New("token signing key is unknown")
+)
+
+// Token 解析后的 token，Claims 为自定义声明
+type Token[T any] struct {
+	Raw        string
+	Header     Header
+	Registered RegisteredClaims
+	Claims     T
+}
+
+type Issuer struct {
+	kid    string
+	signer cryptox.Signer
+	opts   *options
+}
+
+// NewIssuer 创建签发者，kid 会写入 token 头，用于校验方选择公钥
+func NewIssuer(kid string, signer cryptox.Signer, opts ...Option) *Issuer {
+	return &Issuer{
+		kid:    kid,
+		signer: signer,
+		opts:   evaluateOptions(opts),
+	}
+}
+
+func (i *Issuer) KeyID() string {
+	return i.kid
+}
+
+// Verifier 返回签发公钥的验签器，可加入 KeySet 发布到 JWKS
+func (i *Issuer) Verifier() cryptox.Verifier {
+	return i.signer.Verifier()
+}
+
+// Issue 签发只包含标准声明的 token
+func (i *Issuer) Issue(claims RegisteredClaims) (string, error) {
+	return Sign(i, claims, struct{}{})
+}
+
+// Sign 签发带自定义声明的 token，claims 序列化后必须是 JSON 对象。
+// registered 中未设置的 iss、aud、iat、exp、jti 会按 Issuer 的配置填充，
+// 与自定义声明重名时以 registered 为准
+func Sign[T any](i *Issuer, registered RegisteredClaims, claims T) (string, error) {
+	now := i.opts.clock()
+	if registered.Issuer == "" {
+		registered.Issuer = i.opts.issuer
+	}
+	if len(registered.Audience) == 0 {
+		registered.Audience = i.opts.audience
+	}
+	if registered.IssuedAt == 0 {
+		registered.IssuedAt = now.Unix()
+	}
+	if registered.ExpiresAt == 0 && i.opts.ttl > 0 {
+		registered.ExpiresAt = now.Add(i.opts.ttl).Unix()
+	}
+	if registered.ID == "" {
+		id, err := newJTI()
+		if err != nil {
+			return "", err
+		}
+		registered.ID = id
+	}
+
+	payload, err := mergeClaims(registered, claims)
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(Header{Alg: string(i.signer.Algorithm()), Typ: "JWT", Kid: i.kid})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	sig, err := i.signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encodeSegment(sig), nil
+}
+
+type Verifier struct {
+	keys KeySource
+	opts *options
+}
+
+func NewVerifier(keys KeySource, opts ...Option) *Verifier {
+	return &Verifier{
+		keys: keys,
+		opts: evaluateOptions(opts),
+	}
+}
+
+// Verify 校验 token 并返回标准声明
+func (v *Verifier) Verify(token string) (*RegisteredClaims, error) {
+	t, err := Parse[struct{}](v, token)
+	if err != nil {
+		return nil, err
+	}
+	return &t.Registered, nil
+}
+
+// Parse 校验 token 并把自定义声明解析到 T
+func Parse[T any](v *Verifier, token string) (*Token[T], error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	t := &Token[T]{Raw: token}
+	if err := decodeSegmentJSON(parts[0], &t.Header); err != nil {
+		return nil, err
+	}
+	alg := cryptox.SignAlgorithm(t.Header.Alg)
+	if !v.opts.algorithms[alg] {
+		return nil, ErrTokenAlgorithm
+	}
+	verifier, err := v.keys.Verifier(t.Header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if verifier.Algorithm() != alg {
+		return nil, ErrTokenAlgorithm
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if err = verifier.Verify([]byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, ErrTokenSignature
+	}
+
+	// 签名通过后再解析声明
+	if err = decodeSegmentJSON(parts[1], &t.Registered); err != nil {
+		return nil, err
+	}
+	if err = decodeSegmentJSON(parts[1], &t.Claims); err != nil {
+		return nil, err
+	}
+	if err = t.Registered.validate(v.opts); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func mergeClaims(registered RegisteredClaims, claims interface{}) ([]byte, error) {
+	custom, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(custom, &merged); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	std, err := json.Marshal(registered)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(std, &merged); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merged)
+}
+
+func newJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegmentJSON(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrTokenMalformed
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return ErrTokenMalformed
+	}
+	return nil
+}
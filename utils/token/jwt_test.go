@@ -0,0 +1,388 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cryptox "go-demo/utils/crypto"
+)
+
+type userClaims struct {
+	UID   string   `json:"uid"`
+	Roles []string `json:"roles"`
+}
+
+func newTestIssuer(t *testing.T, kid string, alg cryptox.SignAlgorithm, opts ...Option) *Issuer {
+	t.Helper()
+	signer, err := cryptox.GenerateSigner(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewIssuer(kid, signer, opts...)
+}
+
+func TestSignParse(t *testing.T) {
+	for _, alg := range []cryptox.SignAlgorithm{cryptox.SignRS256, cryptox.SignES256, cryptox.SignEdDSA} {
+		issuer := newTestIssuer(t, "k1", alg, WithIssuer("go-demo"), WithAudience("web"))
+		keys := NewKeySet()
+		keys.Add(issuer.KeyID(), issuer.Verifier())
+		verifier := NewVerifier(keys, WithIssuer("go-demo"), WithAudience("web", "app"))
+
+		raw, err := Sign(issuer, RegisteredClaims{Subject: "pibigstar"}, userClaims{UID: "1", Roles: []string{"admin"}})
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		token, err := Parse[userClaims](verifier, raw)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if token.Header.Alg != string(alg) || token.Header.Kid != "k1" {
+			t.Errorf("%s: unexpected header %+v", alg, token.Header)
+		}
+		if token.Claims.UID != "1" || len(token.Claims.Roles) != 1 || token.Registered.Subject != "pibigstar" {
+			t.Errorf("%s: unexpected claims %+v %+v", alg, token.Claims, token.Registered)
+		}
+		if token.Registered.ID == "" || token.Registered.ExpiresAt-token.Registered.IssuedAt != int64(defaultTTL/time.Second) {
+			t.Errorf("%s: default claims not filled %+v", alg, token.Registered)
+		}
+
+		// 篡改声明
+		parts := strings.Split(raw, ".")
+		parts[1] = encodeSegment([]byte(`{"uid":"2","exp":9999999999}`))
+		if _, err = verifier.Verify(strings.Join(parts, ".")); err != ErrTokenSignature {
+			t.Errorf("%s: want ErrTokenSignature, got %v", alg, err)
+		}
+	}
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	issuer := newTestIssuer(t, "k1", cryptox.SignRS256)
+	keys := NewKeySet()
+	keys.Add("k1", issuer.Verifier())
+	verifier := NewVerifier(keys)
+	payload := encodeSegment([]byte(`{"sub":"admin","exp":9999999999}`))
+
+	// 用公钥作为 HMAC 密钥伪造
+	pub, _ := cryptox.MarshalPublicKeyPEM(issuer.Verifier().PublicKey())
+	input := encodeSegment([]byte(`{"alg":"HS256","kid":"k1"}`)) + "." + payload
+	mac := hmac.New(sha256.New, pub)
+	mac.Write([]byte(input))
+	if _, err := verifier.Verify(input + "." + encodeSegment(mac.Sum(nil))); err != ErrTokenAlgorithm {
+		t.Errorf("HS256: want ErrTokenAlgorithm, got %v", err)
+	}
+
+	input = encodeSegment([]byte(`{"alg":"none","kid":"k1"}`)) + "." + payload
+	if _, err := verifier.Verify(input + "."); err != ErrTokenAlgorithm {
+		t.Errorf("none: want ErrTokenAlgorithm, got %v", err)
+	}
+
+	// 头部声明的算法与公钥算法不一致
+	input = encodeSegment([]byte(`{"alg":"PS256","kid":"k1"}`)) + "." + payload
+	if _, err := verifier.Verify(input + ".c2ln"); err != ErrTokenAlgorithm {
+		t.Errorf("PS256: want ErrTokenAlgorithm, got %v", err)
+	}
+
+	// 限制只允许 EdDSA
+	raw, _ := issuer.Issue(RegisteredClaims{})
+	if _, err := NewVerifier(keys, WithAlgorithms(cryptox.SignEdDSA)).Verify(raw); err != ErrTokenAlgorithm {
+		t.Errorf("want ErrTokenAlgorithm, got %v", err)
+	}
+
+	for _, malformed := range []string{"", "a.b", "a.b.c.d", "!!.e30.c2ln"} {
+		if _, err := verifier.Verify(malformed); err != ErrTokenMalformed {
+			t.Errorf("%q: want ErrTokenMalformed, got %v", malformed, err)
+		}
+	}
+}
+
+func TestKeySelection(t *testing.T) {
+	old := newTestIssuer(t, "2020", cryptox.SignEdDSA)
+	cur := newTestIssuer(t, "2021", cryptox.SignES256)
+	keys := NewKeySet()
+	keys.Add(old.KeyID(), old.Verifier())
+	keys.Add(cur.KeyID(), cur.Verifier())
+	verifier := NewVerifier(keys)
+
+	for _, issuer := range []*Issuer{old, cur} {
+		raw, _ := issuer.Issue(RegisteredClaims{Subject: "1"})
+		if _, err := verifier.Verify(raw); err != nil {
+			t.Errorf("%s: %v", issuer.KeyID(), err)
+		}
+	}
+
+	keys.Remove("2020")
+	raw, _ := old.Issue(RegisteredClaims{})
+	if _, err := verifier.Verify(raw); err != ErrUnknownKey {
+		t.Errorf("want ErrUnknownKey, got %v", err)
+	}
+
+	// 没有 kid 时只有一个公钥才会使用
+	noKid := NewIssuer("", cur.signer)
+	raw, _ = noKid.Issue(RegisteredClaims{})
+	if _, err := verifier.Verify(raw); err != nil {
+		t.Error(err)
+	}
+	keys.Add("2022", old.Verifier())
+	if _, err := verifier.Verify(raw); err != ErrUnknownKey {
+		t.Errorf("want ErrUnknownKey, got %v", err)
+	}
+	if err := keys.Add("", old.Verifier()); err != ErrKeyID {
+		t.Errorf("want ErrKeyID, got %v", err)
+	}
+}
+
+func TestClaimsValidation(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	clock := func() time.Time { return now }
+	issuer := newTestIssuer(t, "k1", cryptox.SignEdDSA, WithClock(clock), WithTTL(time.Minute))
+	keys := NewKeySet()
+	keys.Add("k1", issuer.Verifier())
+
+	cases := []struct {
+		name   string
+		claims RegisteredClaims
+		opts   []Option
+		at     time.Time
+		want   error
+	}{
+		{"valid", RegisteredClaims{}, nil, now, nil},
+		{"expired within leeway", RegisteredClaims{}, nil, now.Add(time.Minute + 10*time.Second), nil},
+		{"expired", RegisteredClaims{}, nil, now.Add(time.Minute + time.Hour), ErrTokenExpired},
+		{"expired no leeway", RegisteredClaims{}, []Option{WithLeeway(0)}, now.Add(time.Minute), ErrTokenExpired},
+		{"nbf within leeway", RegisteredClaims{NotBefore: now.Unix() + 10}, nil, now, nil},
+		{"nbf", RegisteredClaims{NotBefore: now.Unix() + 60}, nil, now, ErrTokenNotValidYet},
+		{"iat in future", RegisteredClaims{IssuedAt: now.Unix() + 60}, nil, now, ErrTokenNotValidYet},
+		{"issuer", RegisteredClaims{Issuer: "evil"}, []Option{WithIssuer("go-demo")}, now, ErrTokenIssuer},
+		{"audience", RegisteredClaims{Audience: Audience{"web"}}, []Option{WithAudience("app")}, now, ErrTokenAudience},
+		{"audience list", RegisteredClaims{Audience: Audience{"web", "app"}}, []Option{WithAudience("app")}, now, nil},
+		{"no audience", RegisteredClaims{}, []Option{WithAudience("app")}, now, ErrTokenAudience},
+	}
+	for _, c := range cases {
+		raw, err := issuer.Issue(c.claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := c.at
+		opts := append([]Option{WithClock(func() time.Time { return at })}, c.opts...)
+		if _, err = NewVerifier(keys, opts...).Verify(raw); err != c.want {
+			t.Errorf("%s: want %v, got %v", c.name, c.want, err)
+		}
+	}
+
+	noExp := newTestIssuer(t, "k2", cryptox.SignEdDSA, WithTTL(0))
+	keys.Add("k2", noExp.Verifier())
+	raw, _ := noExp.Issue(RegisteredClaims{})
+	if _, err := NewVerifier(keys).Verify(raw); err != ErrTokenExpired {
+		t.Errorf("want ErrTokenExpired, got %v", err)
+	}
+	if _, err := NewVerifier(keys, WithoutExpiration()).Verify(raw); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAudienceJSON(t *testing.T) {
+	var c RegisteredClaims
+	json.Unmarshal([]byte(`{"aud":"web"}`), &c)
+	if len(c.Audience) != 1 || c.Audience[0] != "web" {
+		t.Errorf("unexpected audience %v", c.Audience)
+	}
+	json.Unmarshal([]byte(`{"aud":["web","app"]}`), &c)
+	if len(c.Audience) != 2 {
+		t.Errorf("unexpected audience %v", c.Audience)
+	}
+	data, _ := json.Marshal(RegisteredClaims{Audience: Audience{"web"}})
+	if string(data) != `{"aud":"web"}` {
+		t.Errorf("unexpected json %s", data)
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	old := newTestIssuer(t, "k1", cryptox.SignRS256)
+	cur := newTestIssuer(t, "k2", cryptox.SignEdDSA)
+	keys := NewKeySet()
+	keys.Add(old.KeyID(), old.Verifier())
+
+	var fetches int32
+	handler := JWKSHandler(keys)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	remote := NewRemoteKeySet(server.URL, WithMinRefreshInterval(time.Minute))
+	remote.clock = func() time.Time { return now }
+	verifier := NewVerifier(remote)
+
+	raw, _ := old.Issue(RegisteredClaims{})
+	for i := 0; i < 3; i++ {
+		if _, err := verifier.Verify(raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("want 1 fetch, got %d", n)
+	}
+
+	// 轮换后出现未知 kid，在最小间隔内不重新拉取
+	keys.Add(cur.KeyID(), cur.Verifier())
+	raw, _ = cur.Issue(RegisteredClaims{})
+	if _, err := verifier.Verify(raw); err != ErrUnknownKey {
+		t.Errorf("want ErrUnknownKey, got %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := verifier.Verify(raw); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("want 2 fetches, got %d", n)
+	}
+
+	// 超过 max-age 后刷新，服务不可用时沿用旧公钥
+	server.Close()
+	now = now.Add(10 * time.Minute)
+	if _, err := verifier.Verify(raw); err != nil {
+		t.Errorf("cached key should still work: %v", err)
+	}
+
+	if _, err := NewVerifier(NewRemoteKeySet(server.URL)).Verify(raw); err == nil {
+		t.Error("want fetch error")
+	}
+}
+
+func TestRemoteKeySetFetchError(t *testing.T) {
+	issuer := newTestIssuer(t, "k1", cryptox.SignEdDSA)
+	keys := NewKeySet()
+	keys.Add(issuer.KeyID(), issuer.Verifier())
+
+	var fetches int32
+	var down int32 = 1
+	handler := JWKSHandler(keys)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	remote := NewRemoteKeySet(server.URL, WithMinRefreshInterval(time.Minute))
+	remote.clock = func() time.Time { return now }
+	verifier := NewVerifier(remote)
+	raw, _ := issuer.Issue(RegisteredClaims{})
+
+	// 第一次拉取失败后，间隔内返回同一个错误，不再拉取
+	for i := 0; i < 3; i++ {
+		if _, err := verifier.Verify(raw); !errors.Is(err, ErrJWKSFetch) {
+			t.Fatalf("want ErrJWKSFetch, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("want 1 fetch, got %d", n)
+	}
+
+	atomic.StoreInt32(&down, 0)
+	now = now.Add(2 * time.Minute)
+	if _, err := verifier.Verify(raw); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("want 2 fetches, got %d", n)
+	}
+}
+
+func TestRemoteKeySetSlowFetch(t *testing.T) {
+	issuer := newTestIssuer(t, "k1", cryptox.SignES256)
+	keys := NewKeySet()
+	keys.Add(issuer.KeyID(), issuer.Verifier())
+
+	var fetches int32
+	release := make(chan struct{})
+	handler := JWKSHandler(keys)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次之后的拉取一直阻塞，模拟慢的 JWKS 服务
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	now := time.Now()
+	remote := NewRemoteKeySet(server.URL)
+	var mu sync.Mutex
+	remote.clock = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	verifier := NewVerifier(remote)
+	raw, _ := issuer.Issue(RegisteredClaims{})
+	if _, err := verifier.Verify(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未知 kid 和缓存过期都会触发拉取，并发的拉取合并为一次
+	mu.Lock()
+	now = now.Add(time.Hour)
+	mu.Unlock()
+	for i := 0; i < 3; i++ {
+		go remote.Verifier("unknown")
+	}
+	for deadline := time.Now().Add(2 * time.Second); atomic.LoadInt32(&fetches) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("refresh not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := verifier.Verify(raw)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("cached kid blocked by a slow jwks fetch")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("want 2 fetches, got %d", n)
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	issuer := newTestIssuer(t, "k1", cryptox.SignES256)
+	keys := NewKeySet()
+	keys.Add("k1", issuer.Verifier())
+
+	rec := httptest.NewRecorder()
+	JWKSHandler(keys).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	var set cryptox.JWKSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	jwk, ok := set.Find("k1")
+	if !ok || jwk.Alg != "ES256" || jwk.Use != "sig" || jwk.IsPrivate() {
+		t.Errorf("unexpected jwks %s", rec.Body.String())
+	}
+	if cacheMaxAge(rec.Header().Get("Cache-Control"), 0) != 5*time.Minute {
+		t.Errorf("unexpected cache control %s", rec.Header().Get("Cache-Control"))
+	}
+}
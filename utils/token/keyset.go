@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+
+	cryptox "go-demo/utils/crypto"
+)
+
+var ErrKeyID = errors.New("key id is required")
+
+// KeySource 按 kid 查找验签公钥
+type KeySource interface {
+	Verifier(kid string) (cryptox.Verifier, error)
+}
+
+// KeySet 本地公钥集合，轮换时先加入新公钥，等旧 token 过期后再删除旧公钥
+type KeySet struct {
+	mu   sync.RWMutex
+	keys map[string]cryptox.Verifier
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]cryptox.Verifier)}
+}
+
+func (s *KeySet) Add(kid string, verifier cryptox.Verifier) error {
+	if kid == "" {
+		return ErrKeyID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = verifier
+	return nil
+}
+
+func (s *KeySet) Remove(kid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, kid)
+}
+
+// Verifier token 没有 kid 时，只有集合中恰好一个公钥才使用它
+func (s *KeySet) Verifier(kid string) (cryptox.Verifier, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if kid == "" && len(s.keys) == 1 {
+		for _, v := range s.keys {
+			return v, nil
+		}
+	}
+	v, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return v, nil
+}
+
+// JWKS 导出公钥集合，按 kid 排序
+func (s *KeySet) JWKS() (*cryptox.JWKSet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set := &cryptox.JWKSet{Keys: make([]cryptox.JWK, 0, len(s.keys))}
+	for kid, v := range s.keys {
+		jwk, err := cryptox.NewJWK(v.PublicKey(), kid, v.Algorithm())
+		if err != nil {
+			return nil, err
+		}
+		jwk.Use = "sig"
+		set.Keys = append(set.Keys, *jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set, nil
+}
+
+// JWKSHandler 发布公钥集合，一般挂载在 /.well-known/jwks.json
+func JWKSHandler(keys *KeySet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		set, err := keys.JWKS()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(set)
+	})
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type contextKey struct{}
+
+// FromContext 取出中间件校验通过的 access token
+func FromContext(ctx context.Context) (*Token[SessionClaims], bool) {
+	t, ok := ctx.Value(contextKey{}).(*Token[SessionClaims])
+	return t, ok
+}
+
+// BearerToken 从 Authorization: Bearer xxx 中取出 token
+func BearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// HTTPMiddleware 校验 access token 签名、有效期以及是否已被吊销
+func HTTPMiddleware(m *Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, err := m.Verify(BearerToken(r))
+			if err != nil {
+				unauthorized(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, t)))
+		})
+	}
+}
+
+// GinMiddleware gin 版本，token 同样通过 FromContext(ctx.Request.Context()) 获取
+func GinMiddleware(m *Manager) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		t, err := m.Verify(BearerToken(ctx.Request))
+		if err != nil {
+			unauthorized(ctx.Writer, err)
+			ctx.Abort()
+			return
+		}
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), contextKey{}, t))
+		ctx.Next()
+	}
+}
+
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"time"
+
+	cryptox "go-demo/utils/crypto"
+)
+
+const (
+	defaultTTL    = time.Hour
+	defaultLeeway = 30 * time.Second
+)
+
+type (
+	Option  func(*options)
+	options struct {
+		issuer     string                         // 签发时写入 iss，校验时要求 iss 一致
+		audience   []string                       // 签发时写入 aud，校验时要求 aud 至少包含其中一个
+		ttl        time.Duration                  // 签发 token 的有效期
+		leeway     time.Duration                  // 校验时间时允许的时钟偏差
+		algorithms map[cryptox.SignAlgorithm]bool // 允许的签名算法
+		requireExp bool                           // 是否要求必须有 exp
+		clock      func() time.Time
+	}
+)
+
+func evaluateOptions(opts []Option) *options {
+	optCopy := &options{
+		ttl:    defaultTTL,
+		leeway: defaultLeeway,
+		algorithms: map[cryptox.SignAlgorithm]bool{
+			cryptox.SignRS256: true,
+			cryptox.SignPS256: true,
+			cryptox.SignES256: true,
+			cryptox.SignEdDSA: true,
+		},
+		requireExp: true,
+		clock:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(optCopy)
+	}
+	return optCopy
+}
+
+// WithIssuer sets the iss claim written by Issuer and required by Verifier.
+func WithIssuer(iss string) Option {
+	return func(opts *options) {
+		opts.issuer = iss
+	}
+}
+
+// WithAudience sets the aud claim written by Issuer; Verifier accepts a token
+// whose aud contains any of them.
+func WithAudience(aud ...string) Option {
+	return func(opts *options) {
+		opts.audience = aud
+	}
+}
+
+// WithTTL sets the lifetime of issued tokens.
+func WithTTL(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.ttl = ttl
+	}
+}
+
+// WithLeeway sets the tolerated clock skew when checking exp, nbf and iat.
+func WithLeeway(leeway time.Duration) Option {
+	return func(opts *options) {
+		opts.leeway = leeway
+	}
+}
+
+// WithAlgorithms restricts the accepted signing algorithms.
+func WithAlgorithms(algs ...cryptox.SignAlgorithm) Option {
+	return func(opts *options) {
+		opts.algorithms = make(map[cryptox.SignAlgorithm]bool, len(algs))
+		for _, alg := range algs {
+			opts.algorithms[alg] = true
+		}
+	}
+}
+
+// WithoutExpiration accepts tokens without exp claim.
+func WithoutExpiration() Option {
+	return func(opts *options) {
+		opts.requireExp = false
+	}
+}
+
+// WithClock sets the time source, used in tests.
+func WithClock(clock func() time.Time) Option {
+	return func(opts *options) {
+		opts.clock = clock
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 当前值等于 old 时替换为 next，返回 1 成功，0 重用，-1 家族不存在
+var rotateScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// RedisStore 基于 Redis 的存储，client 可以直接传入 sdk/redis 的 RedisClient
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore prefix 为空时使用 "token:"
+func NewRedisStore(client redis.Cmdable, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "token:"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) revokedKey(jti string) string {
+	return s.prefix + "revoked:" + jti
+}
+
+func (s *RedisStore) familyKey(family string) string {
+	return s.prefix + "family:" + family
+}
+
+func (s *RedisStore) Revoke(jti string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.Set(s.revokedKey(jti), 1, ttl).Err()
+}
+
+func (s *RedisStore) IsRevoked(jti string) (bool, error) {
+	n, err := s.client.Exists(s.revokedKey(jti)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *RedisStore) Save(family, jti string, ttl time.Duration) error {
+	return s.client.Set(s.familyKey(family), jti, ttl).Err()
+}
+
+func (s *RedisStore) Rotate(family, old, next string, ttl time.Duration) error {
+	res, err := rotateScript.Run(s.client, []string{s.familyKey(family)}, old, next, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 0:
+		return ErrRefreshReused
+	case -1:
+		return ErrFamilyNotFound
+	}
+	return nil
+}
+
+func (s *RedisStore) Delete(family string) error {
+	return s.client.Del(s.familyKey(family)).Err()
+}
@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	cryptox "go-demo/utils/crypto"
+)
+
+const (
+	defaultCacheTTL           = 10 * time.Minute
+	defaultMinRefreshInterval = time.Minute
+)
+
+var ErrJWKSFetch = errors.New("fetch jwks failed")
+
+type RemoteOption func(*RemoteKeySet)
+
+// WithHTTPClient sets the client used to fetch the JWKS.
+func WithHTTPClient(client *http.Client) RemoteOption {
+	return func(s *RemoteKeySet) {
+		s.client = client
+	}
+}
+
+// WithCacheTTL sets how long fetched keys are cached when the response has
+// no Cache-Control max-age.
+func WithCacheTTL(ttl time.Duration) RemoteOption {
+	return func(s *RemoteKeySet) {
+		s.cacheTTL = ttl
+	}
+}
+
+// WithMinRefreshInterval limits how often an unknown kid triggers a refetch.
+func WithMinRefreshInterval(d time.Duration) RemoteOption {
+	return func(s *RemoteKeySet) {
+		s.minRefresh = d
+	}
+}
+
+// RemoteKeySet 从 JWKS 地址拉取公钥并缓存。
+// 缓存过期或遇到未知 kid 时重新拉取(受最小间隔限制，避免伪造 kid 打爆 JWKS 服务)，
+// 拉取失败时继续使用旧的公钥。拉取在锁外进行，并发的拉取合并为一次，
+// 已缓存的 kid 在缓存过期时后台刷新，不会被慢的 JWKS 服务阻塞
+type RemoteKeySet struct {
+	url        string
+	client     *http.Client
+	cacheTTL   time.Duration
+	minRefresh time.Duration
+	clock      func() time.Time
+	group      singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]cryptox.Verifier
+	expiresAt time.Time
+	fetchedAt time.Time
+	fetchErr  error
+}
+
+func NewRemoteKeySet(url string, opts ...RemoteOption) *RemoteKeySet {
+	s := &RemoteKeySet{
+		url:        url,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		cacheTTL:   defaultCacheTTL,
+		minRefresh: defaultMinRefreshInterval,
+		clock:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *RemoteKeySet) Verifier(kid string) (cryptox.Verifier, error) {
+	s.mu.Lock()
+	now := s.clock()
+	v, ok := s.lookup(kid)
+	stale := s.keys == nil || now.After(s.expiresAt)
+	recent := now.Sub(s.fetchedAt) < s.minRefresh
+	fetchErr := s.fetchErr
+	s.mu.Unlock()
+
+	if ok {
+		if stale {
+			go s.refresh()
+		}
+		return v, nil
+	}
+	if recent {
+		if !stale {
+			return nil, ErrUnknownKey
+		}
+		// 还没有拉取成功过，间隔内返回上次的错误，JWKS 服务不可用时不会每个请求都拉取一次
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+	}
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok = s.lookup(kid); ok {
+		return v, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (s *RemoteKeySet) lookup(kid string) (cryptox.Verifier, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, v := range s.keys {
+			return v, true
+		}
+	}
+	v, ok := s.keys[kid]
+	return v, ok
+}
+
+// refresh 并发调用只拉取一次
+func (s *RemoteKeySet) refresh() error {
+	_, err, _ := s.group.Do(s.url, func() (interface{}, error) {
+		return nil, s.fetch()
+	})
+	return err
+}
+
+func (s *RemoteKeySet) fetch() error {
+	s.mu.Lock()
+	now := s.clock()
+	s.fetchedAt = now
+	s.mu.Unlock()
+
+	keys, maxAge, err := s.download()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetchErr = err
+	if err != nil {
+		// 拉取失败时沿用旧公钥，间隔一段时间再重试
+		if s.keys != nil {
+			s.expiresAt = now.Add(s.minRefresh)
+		}
+		return err
+	}
+	s.keys = keys
+	s.expiresAt = now.Add(maxAge)
+	return nil
+}
+
+func (s *RemoteKeySet) download() (map[string]cryptox.Verifier, time.Duration, error) {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrJWKSFetch, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%w: status %d", ErrJWKSFetch, resp.StatusCode)
+	}
+
+	var set cryptox.JWKSet
+	if err = json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrJWKSFetch, err)
+	}
+	keys := make(map[string]cryptox.Verifier, len(set.Keys))
+	for i := range set.Keys {
+		jwk := &set.Keys[i]
+		// 跳过加密用的公钥和不支持的密钥类型
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		v, err := jwkVerifier(jwk)
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = v
+	}
+	return keys, cacheMaxAge(resp.Header.Get("Cache-Control"), s.cacheTTL), nil
+}
+
+func jwkVerifier(jwk *cryptox.JWK) (cryptox.Verifier, error) {
+	pub, err := jwk.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	alg := cryptox.SignAlgorithm(jwk.Alg)
+	if alg == "" {
+		if alg, err = cryptox.DefaultSignAlgorithm(pub); err != nil {
+			return nil, err
+		}
+	}
+	return cryptox.NewVerifier(alg, pub)
+}
+
+func cacheMaxAge(cacheControl string, def time.Duration) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		if sec, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && sec > 0 {
+			return time.Duration(sec) * time.Second
+		}
+	}
+	return def
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"errors"
+	"time"
+)
+
+/**
+access/refresh token 对：
+access token 有效期短，每次请求校验签名并检查吊销列表；
+refresh token 有效期长，每次刷新都会换一个新的(轮换)，同一次登录产生的 refresh token 属于同一个家族(fid)。
+旧的 refresh token 被再次使用说明已经泄露，此时吊销整个家族，攻击者和用户都需要重新登录。
+*/
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+
+	defaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrTokenType    = errors.New("token type is invalid")
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// SessionClaims Manager 签发的 token 中的自定义声明
+type SessionClaims struct {
+	Type   string `json:"typ"`
+	Family string `json:"fid"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // access token 剩余秒数
+}
+
+type ManagerOption func(*Manager)
+
+// WithRefreshTTL sets the lifetime of refresh tokens, each rotation restarts it.
+func WithRefreshTTL(ttl time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.refreshTTL = ttl
+	}
+}
+
+type Manager struct {
+	issuer     *Issuer
+	verifier   *Verifier
+	store      Store
+	refreshTTL time.Duration
+}
+
+// NewManager access token 的有效期由 issuer 的 WithTTL 决定
+func NewManager(issuer *Issuer, verifier *Verifier, store Store, opts ...ManagerOption) *Manager {
+	m := &Manager{
+		issuer:     issuer,
+		verifier:   verifier,
+		store:      store,
+		refreshTTL: defaultRefreshTTL,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Login 登录成功后签发 token 对，claims 中一般只需设置 Subject
+func (m *Manager) Login(claims RegisteredClaims) (*TokenPair, error) {
+	family, err := newJTI()
+	if err != nil {
+		return nil, err
+	}
+	refreshID, err := newJTI()
+	if err != nil {
+		return nil, err
+	}
+	if err = m.store.Save(family, refreshID, m.refreshTTL); err != nil {
+		return nil, err
+	}
+	return m.issuePair(claims, family, refreshID)
+}
+
+// Refresh 用 refresh token 换取新的 token 对，旧的 refresh token 随即失效
+func (m *Manager) Refresh(refreshToken string) (*TokenPair, error) {
+	t, err := m.parse(refreshToken, TokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshID, err := newJTI()
+	if err != nil {
+		return nil, err
+	}
+	err = m.store.Rotate(t.Claims.Family, t.Registered.ID, refreshID, m.refreshTTL)
+	switch err {
+	case nil:
+	case ErrRefreshReused:
+		// 重用检测：吊销整个家族，已签发的 access token 也随之失效
+		if err := m.RevokeFamily(t.Claims.Family); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshReused
+	case ErrFamilyNotFound:
+		return nil, ErrTokenRevoked
+	default:
+		return nil, err
+	}
+
+	claims := t.Registered
+	claims.ID, claims.IssuedAt, claims.ExpiresAt, claims.NotBefore = "", 0, 0, 0
+	return m.issuePair(claims, t.Claims.Family, refreshID)
+}
+
+// Verify 校验 access token 并检查吊销列表
+func (m *Manager) Verify(accessToken string) (*Token[SessionClaims], error) {
+	return m.parse(accessToken, TokenTypeAccess)
+}
+
+// Logout 吊销 token 所在的家族，access token 和 refresh token 都可以
+func (m *Manager) Logout(token string) error {
+	t, err := Parse[SessionClaims](m.verifier, token)
+	if err != nil {
+		return err
+	}
+	return m.RevokeFamily(t.Claims.Family)
+}
+
+// Revoke 只吊销单个 token
+func (m *Manager) Revoke(token string) error {
+	t, err := Parse[SessionClaims](m.verifier, token)
+	if err != nil {
+		return err
+	}
+	return m.store.Revoke(t.Registered.ID, t.Registered.Expiration())
+}
+
+// RevokeFamily 吊销一次登录产生的所有 token
+func (m *Manager) RevokeFamily(family string) error {
+	// 家族中最晚的 token 也会在 refreshTTL 内过期
+	if err := m.store.Revoke(family, m.issuer.opts.clock().Add(m.refreshTTL)); err != nil {
+		return err
+	}
+	return m.store.Delete(family)
+}
+
+func (m *Manager) parse(token, typ string) (*Token[SessionClaims], error) {
+	t, err := Parse[SessionClaims](m.verifier, token)
+	if err != nil {
+		return nil, err
+	}
+	if t.Claims.Type != typ || t.Claims.Family == "" {
+		return nil, ErrTokenType
+	}
+	for _, id := range []string{t.Registered.ID, t.Claims.Family} {
+		revoked, err := m.store.IsRevoked(id)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return t, nil
+}
+
+func (m *Manager) issuePair(claims RegisteredClaims, family, refreshID string) (*TokenPair, error) {
+	access, err := Sign(m.issuer, claims, SessionClaims{Type: TokenTypeAccess, Family: family})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshClaims := claims
+	refreshClaims.ID = refreshID
+	refreshClaims.ExpiresAt = m.issuer.opts.clock().Add(m.refreshTTL).Unix()
+	refresh, err := Sign(m.issuer, refreshClaims, SessionClaims{Type: TokenTypeRefresh, Family: family})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(m.issuer.opts.ttl / time.Second),
+	}, nil
+}
@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+
+	cryptox "go-demo/utils/crypto"
+)
+
+func newTestManager(t *testing.T, store Store) *Manager {
+	t.Helper()
+	issuer := newTestIssuer(t, "k1", cryptox.SignEdDSA, WithTTL(5*time.Minute))
+	keys := NewKeySet()
+	keys.Add(issuer.KeyID(), issuer.Verifier())
+	return NewManager(issuer, NewVerifier(keys), store, WithRefreshTTL(time.Hour))
+}
+
+func testStores(t *testing.T) map[string]Store {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"redis":  NewRedisStore(client, ""),
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	for name, store := range testStores(t) {
+		m := newTestManager(t, store)
+		pair, err := m.Login(RegisteredClaims{Subject: "1"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if pair.ExpiresIn != 300 || pair.TokenType != "Bearer" {
+			t.Errorf("%s: unexpected pair %+v", name, pair)
+		}
+		if _, err = m.Verify(pair.RefreshToken); err != ErrTokenType {
+			t.Errorf("%s: refresh token used as access token, got %v", name, err)
+		}
+		if _, err = m.Refresh(pair.AccessToken); err != ErrTokenType {
+			t.Errorf("%s: access token used as refresh token, got %v", name, err)
+		}
+
+		next, err := m.Refresh(pair.RefreshToken)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		access, err := m.Verify(next.AccessToken)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if access.Registered.Subject != "1" {
+			t.Errorf("%s: subject lost after refresh: %+v", name, access.Registered)
+		}
+
+		// 旧 refresh token 重用，整个家族被吊销
+		if _, err = m.Refresh(pair.RefreshToken); err != ErrRefreshReused {
+			t.Errorf("%s: want ErrRefreshReused, got %v", name, err)
+		}
+		for _, token := range []string{next.AccessToken, pair.AccessToken} {
+			if _, err = m.Verify(token); err != ErrTokenRevoked {
+				t.Errorf("%s: want ErrTokenRevoked, got %v", name, err)
+			}
+		}
+		if _, err = m.Refresh(next.RefreshToken); err != ErrTokenRevoked {
+			t.Errorf("%s: want ErrTokenRevoked, got %v", name, err)
+		}
+
+		// 其它登录不受影响
+		other, _ := m.Login(RegisteredClaims{Subject: "1"})
+		if _, err = m.Verify(other.AccessToken); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestLogoutAndRevoke(t *testing.T) {
+	for name, store := range testStores(t) {
+		m := newTestManager(t, store)
+		a, _ := m.Login(RegisteredClaims{Subject: "1"})
+		b, _ := m.Login(RegisteredClaims{Subject: "1"})
+
+		// 只吊销单个 access token
+		if err := m.Revoke(a.AccessToken); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := m.Verify(a.AccessToken); err != ErrTokenRevoked {
+			t.Errorf("%s: want ErrTokenRevoked, got %v", name, err)
+		}
+		if _, err := m.Refresh(a.RefreshToken); err != nil {
+			t.Errorf("%s: refresh token should still work: %v", name, err)
+		}
+
+		if err := m.Logout(b.RefreshToken); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := m.Verify(b.AccessToken); err != ErrTokenRevoked {
+			t.Errorf("%s: want ErrTokenRevoked, got %v", name, err)
+		}
+		if _, err := m.Refresh(b.RefreshToken); err != ErrTokenRevoked {
+			t.Errorf("%s: want ErrTokenRevoked, got %v", name, err)
+		}
+	}
+}
+
+func TestMemoryStoreExpire(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.clock = func() time.Time { return now }
+
+	store.Revoke("a", now.Add(time.Minute))
+	store.Save("f", "r1", time.Minute)
+	if revoked, _ := store.IsRevoked("a"); !revoked {
+		t.Error("want revoked")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if revoked, _ := store.IsRevoked("a"); revoked {
+		t.Error("revocation should expire with the token")
+	}
+	if err := store.Rotate("f", "r1", "r2", time.Minute); err != ErrFamilyNotFound {
+		t.Errorf("want ErrFamilyNotFound, got %v", err)
+	}
+	store.Revoke("b", now.Add(time.Minute))
+	if len(store.revoked) != 1 || len(store.families) != 0 {
+		t.Errorf("expired entries should be purged: %v %v", store.revoked, store.families)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestManager(t, NewMemoryStore())
+	pair, _ := m.Login(RegisteredClaims{Subject: "pibigstar"})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		token, ok := FromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(token.Registered.Subject))
+	}
+	router := gin.New()
+	router.Use(GinMiddleware(m))
+	router.GET("/me", func(ctx *gin.Context) { handler(ctx.Writer, ctx.Request) })
+
+	servers := map[string]http.Handler{
+		"http": HTTPMiddleware(m)(http.HandlerFunc(handler)),
+		"gin":  router,
+	}
+	for name, server := range servers {
+		do := func(token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			return rec
+		}
+
+		if rec := do(pair.AccessToken); rec.Code != http.StatusOK || rec.Body.String() != "pibigstar" {
+			t.Errorf("%s: unexpected response %d %s", name, rec.Code, rec.Body.String())
+		}
+		if rec := do(""); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: want 401, got %d", name, rec.Code)
+		}
+		if rec := do(pair.RefreshToken); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: refresh token should be rejected, got %d", name, rec.Code)
+		}
+	}
+
+	m.Logout(pair.AccessToken)
+	for name, server := range servers {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: revoked token should be rejected, got %d", name, rec.Code)
+		}
+	}
+}
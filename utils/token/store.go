@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRefreshReused  = errors.New("refresh token has been reused")
+	ErrFamilyNotFound = errors.New("refresh token family not found")
+)
+
+// RevocationStore 吊销列表，以 jti 为键，until 之后 token 本身已过期，记录可以删除
+type RevocationStore interface {
+	Revoke(jti string, until time.Time) error
+	IsRevoked(jti string) (bool, error)
+}
+
+// RefreshStore 记录每个 refresh token 家族当前有效的 jti，用于轮换和重用检测
+type RefreshStore interface {
+	// Save 登录时创建家族
+	Save(family, jti string, ttl time.Duration) error
+	// Rotate 原子地把当前 jti 从 old 换成 next，当前 jti 不是 old 时返回 ErrRefreshReused，
+	// 家族不存在时返回 ErrFamilyNotFound
+	Rotate(family, old, next string, ttl time.Duration) error
+	Delete(family string) error
+}
+
+// Store 同时实现吊销列表和 refresh 家族存储
+type Store interface {
+	RevocationStore
+	RefreshStore
+}
+
+const memoryPurgeInterval = time.Minute
+
+type memoryEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// MemoryStore 单机内存存储，多实例部署请使用 RedisStore
+type MemoryStore struct {
+	mu       sync.Mutex
+	revoked  map[string]time.Time
+	families map[string]memoryEntry
+	purgedAt time.Time
+	clock    func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		revoked:  make(map[string]time.Time),
+		families: make(map[string]memoryEntry),
+		clock:    time.Now,
+	}
+}
+
+func (s *MemoryStore) Revoke(jti string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	if s.revoked[jti].Before(until) {
+		s.revoked[jti] = until
+	}
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.revoked[jti]
+	return ok && s.clock().Before(until), nil
+}
+
+func (s *MemoryStore) Save(family, jti string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	s.families[family] = memoryEntry{value: jti, expiresAt: s.clock().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Rotate(family, old, next string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock()
+	entry, ok := s.families[family]
+	if !ok || !now.Before(entry.expiresAt) {
+		return ErrFamilyNotFound
+	}
+	if entry.value != old {
+		return ErrRefreshReused
+	}
+	s.families[family] = memoryEntry{value: next, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Delete(family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.families, family)
+	return nil
+}
+
+// 定期清理过期记录，调用方需持有锁
+func (s *MemoryStore) purge() {
+	now := s.clock()
+	if now.Sub(s.purgedAt) < memoryPurgeInterval {
+		return
+	}
+	s.purgedAt = now
+	for jti, until := range s.revoked {
+		if !now.Before(until) {
+			delete(s.revoked, jti)
+		}
+	}
+	for family, entry := range s.families {
+		if !now.Before(entry.expiresAt) {
+			delete(s.families, family)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 )
 
 //  使用jwt 生成token 与使用
+//  这里是固定密钥的 HS256，新代码请使用 Issuer 和 Verifier
 
 const (
 	// 加密的key值
@@ -51,6 +52,10 @@ func CheckJwtTokenExpected(tokenString string) error {
 // 解析token
 func ParseJwtToken(tokenString string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// 必须校验算法，否则可以用 none 或其它算法伪造 token
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
 		_, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
 			return nil, errors.New("unexpected token claims")